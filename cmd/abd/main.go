@@ -0,0 +1,95 @@
+// Command abd serves the site with the posts' title experiments running:
+// a reverse proxy to the origin, the R2 bucket's public URL, through
+// abtest.Handler, which shows each visitor one variant of every post with
+// alternates in its front matter. `blogctl ab report` picks the winners.
+//
+// Route the HTML pages of rednafi.com to it at the CDN while experiments
+// run; the assets can stay static. It reads the experiments once, so
+// restart it after a deploy changes them.
+//
+// Usage:
+//
+//	abd -origin https://pub-xxxx.r2.dev [-addr :8090] [-content content] [-ip-header CF-Connecting-IP]
+//
+// Endpoints:
+//
+//	GET /healthz    200 while the server is up
+//	everything else is the site's
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/abtest"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("abd: ")
+
+	addr := flag.String("addr", ":8090", "listen address")
+	origin := flag.String("origin", "", "URL of the built site to proxy")
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	dir := flag.String("content", content.Dir, "content directory")
+	ipHeader := flag.String("ip-header", "", "header with the client IP when behind a proxy, e.g. CF-Connecting-IP")
+	flag.Parse()
+
+	target, err := url.Parse(*origin)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		log.Fatalf("-origin %q: want an absolute URL", *origin)
+	}
+	cfg, err := site.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exps, err := abtest.Experiments(posts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", &abtest.Handler{Next: proxy, Experiments: exps, BaseURL: cfg.BaseURL, IPHeader: *ipHeader})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("running %d experiment(s) in front of %s on %s", len(exps), target, *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
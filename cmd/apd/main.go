@@ -0,0 +1,374 @@
+// Command apd federates the blog over ActivityPub as @blog@rednafi.com. It
+// answers WebFinger lookups, serves the actor and its outbox, accepts
+// follows in its inbox, and delivers the posts `blogctl ap publish` hands
+// it to every follower's server. Followers and published Notes are kept in
+// SQLite; the actor's key in -key, created on first run.
+//
+// Route rednafi.com/.well-known/webfinger and rednafi.com/ap/* to it at
+// the CDN. The publish endpoint needs AP_ADMIN_TOKEN as a bearer token.
+//
+// Usage:
+//
+//	apd [-addr :8086] [-db activitypub.db] [-key activitypub.pem] [-user blog]
+//
+// Endpoints:
+//
+//	GET  /.well-known/webfinger?resource=acct:blog@rednafi.com
+//	GET  /ap/<user>                the actor
+//	GET  /ap/<user>/outbox         the published Notes, newest first
+//	GET  /ap/<user>/followers      the follower count
+//	GET  /ap/<user>/notes/<slug>   a published Note
+//	POST /ap/<user>/inbox          signed Follow and Undo activities, and Deletes of gone actors
+//	POST /ap/admin/publish         a Create to store and deliver (bearer token)
+//	GET  /healthz                  200 while the server is up
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/activitypub"
+	"github.com/rednafi/rednafi.com/internal/publicnet"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("apd: ")
+
+	addr := flag.String("addr", ":8086", "listen address")
+	dbPath := flag.String("db", "activitypub.db", "SQLite database")
+	keyPath := flag.String("key", "activitypub.pem", "actor's private key; created if missing")
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	user := flag.String("user", activitypub.DefaultUser, "the blog's handle")
+	workers := flag.Int("j", 8, "concurrent deliveries")
+	flag.Parse()
+
+	token := os.Getenv("AP_ADMIN_TOKEN")
+	if token == "" {
+		log.Fatal("AP_ADMIN_TOKEN is not set")
+	}
+	cfg, err := site.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, err := activitypub.LoadKey(*keyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pub, err := activitypub.PublicKeyPEM(&key.PublicKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := activitypub.OpenStore(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	blog := activitypub.FromSite(cfg, *user)
+	s := &server{
+		blog:    blog,
+		actor:   blog.Actor(pub),
+		store:   store,
+		client:  &activitypub.Client{HTTP: publicnet.Client(20 * time.Second), KeyID: blog.KeyID(), Key: key},
+		token:   token,
+		workers: *workers,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s.ctx = ctx
+
+	prefix := "/ap/" + *user
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/webfinger", s.webfinger)
+	mux.HandleFunc("GET "+prefix, s.actorDoc)
+	mux.HandleFunc("GET "+prefix+"/outbox", s.outbox)
+	mux.HandleFunc("GET "+prefix+"/followers", s.followers)
+	mux.HandleFunc("GET "+prefix+"/notes/{slug}", s.note)
+	mux.HandleFunc("POST "+prefix+"/inbox", s.inbox)
+	mux.HandleFunc("POST /ap/admin/publish", s.publish)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("federating as @%s on %s", blog.Handle(), *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	s.wg.Wait()
+}
+
+type server struct {
+	blog    activitypub.Blog
+	actor   activitypub.Actor
+	store   *activitypub.Store
+	client  *activitypub.Client
+	token   string
+	workers int
+
+	// ctx outlives requests, for the Accepts sent after answering one.
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+func (s *server) webfinger(w http.ResponseWriter, r *http.Request) {
+	jrd, ok := s.blog.WebFinger(r.URL.Query().Get("resource"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, "application/jrd+json", jrd)
+}
+
+func (s *server) actorDoc(w http.ResponseWriter, r *http.Request) {
+	// People following the profile link get the site.
+	if accept := r.Header.Get("Accept"); strings.Contains(accept, "text/html") && !strings.Contains(accept, "json") {
+		http.Redirect(w, r, s.blog.BaseURL+"/", http.StatusFound)
+		return
+	}
+	writeJSON(w, activitypub.ContentType, s.actor)
+}
+
+func (s *server) outbox(w http.ResponseWriter, r *http.Request) {
+	total, items, err := s.store.Outbox(r.Context(), 20)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	writeJSON(w, activitypub.ContentType, activitypub.NewCollection(s.blog.Outbox(), total, items))
+}
+
+func (s *server) followers(w http.ResponseWriter, r *http.Request) {
+	n, err := s.store.FollowerCount(r.Context())
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	// Only the count; who follows the blog is their business.
+	writeJSON(w, activitypub.ContentType, activitypub.NewCollection(s.blog.Followers(), n, nil))
+}
+
+func (s *server) note(w http.ResponseWriter, r *http.Request) {
+	obj, err := s.store.Object(r.Context(), s.blog.NoteID(r.PathValue("slug")))
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	if obj == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, activitypub.ContentType, obj)
+}
+
+func (s *server) inbox(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 256<<10))
+	if err != nil {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var a activitypub.Activity
+	if err := json.Unmarshal(body, &a); err != nil {
+		http.Error(w, "not an activity", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+	// An actor deleting itself can't be verified: its key is gone with it.
+	// So ask its server instead, and only drop the follower if the actor
+	// is gone there too; anyone can post an unsigned Delete.
+	if a.Type == "Delete" && a.ObjectID() == a.Actor {
+		_, err := s.client.FetchActor(ctx, a.Actor)
+		switch {
+		case errors.Is(err, activitypub.ErrGone):
+			if err := s.store.Unfollow(ctx, a.Actor); err != nil {
+				internalError(w, err)
+				return
+			}
+			log.Printf("inbox: %s deleted itself", a.Actor)
+		case err != nil:
+			// Answered like the rest, so the inbox doesn't tell the
+			// poster what the fetch ran into.
+			log.Printf("inbox: Delete from %s: %v", a.Actor, err)
+		default:
+			log.Printf("inbox: Delete from %s, which still exists; ignored", a.Actor)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	signer, err := activitypub.Verify(ctx, r, body, s.client.PublicKey)
+	if err != nil {
+		log.Printf("inbox: %s from %s: %v", a.Type, a.Actor, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if signer != a.Actor {
+		http.Error(w, "signed by another actor", http.StatusUnauthorized)
+		return
+	}
+
+	switch a.Type {
+	case "Follow":
+		if a.ObjectID() != s.blog.ActorID() {
+			http.Error(w, "can only follow "+s.blog.ActorID(), http.StatusUnprocessableEntity)
+			return
+		}
+		follower, err := s.client.FetchActor(ctx, a.Actor)
+		if err != nil {
+			log.Printf("inbox: Follow from %s: %v", a.Actor, err)
+			http.Error(w, "couldn't fetch the actor", http.StatusBadGateway)
+			return
+		}
+		if err := s.store.Follow(ctx, follower, time.Now()); err != nil {
+			internalError(w, err)
+			return
+		}
+		log.Printf("inbox: %s followed", a.Actor)
+		s.accept(a, follower.Inbox)
+	case "Undo":
+		in, err := a.Inner()
+		if err != nil || in.Type != "Follow" {
+			break
+		}
+		if err := s.store.Unfollow(ctx, a.Actor); err != nil {
+			internalError(w, err)
+			return
+		}
+		log.Printf("inbox: %s unfollowed", a.Actor)
+	default:
+		// Replies, likes, and boosts are welcome but not kept.
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// accept tells the follower's server the Follow went through, after the
+// response, since some servers only record the Follow once it's answered.
+func (s *server) accept(follow activitypub.Activity, inbox string) {
+	raw, _ := json.Marshal(follow)
+	sum := sha256.Sum256([]byte(follow.ID))
+	accept := activitypub.Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      s.blog.ActorID() + "#accepts/" + hex.EncodeToString(sum[:8]),
+		Type:    "Accept",
+		Actor:   s.blog.ActorID(),
+		Object:  raw,
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		time.Sleep(time.Second)
+		ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+		defer cancel()
+		if err := s.client.Deliver(ctx, inbox, accept); err != nil {
+			log.Printf("accept %s: %v", follow.Actor, err)
+		}
+	}()
+}
+
+// publishResult is the publish endpoint's answer.
+type publishResult struct {
+	New       bool     `json:"new"`
+	Delivered int      `json:"delivered"`
+	Failed    []string `json:"failed,omitempty"`
+}
+
+// publish stores a Create and delivers it to every follower's server. A
+// Create that was published before is delivered again, so a rerun reaches
+// the servers that failed.
+func (s *server) publish(w http.ResponseWriter, r *http.Request) {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var a activitypub.Activity
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10)).Decode(&a); err != nil {
+		http.Error(w, "not an activity", http.StatusBadRequest)
+		return
+	}
+	if a.Type != "Create" || a.Actor != s.blog.ActorID() || !strings.HasPrefix(a.ObjectID(), s.blog.NoteID("")) {
+		http.Error(w, "only the blog's Creates of Notes can be published", http.StatusUnprocessableEntity)
+		return
+	}
+	isNew, err := s.store.Publish(r.Context(), a)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	inboxes, err := s.store.Inboxes(r.Context())
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	res := publishResult{New: isNew}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		jobs = make(chan string)
+	)
+	for range min(s.workers, len(inboxes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for inbox := range jobs {
+				ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+				err := s.client.Deliver(ctx, inbox, a)
+				cancel()
+				mu.Lock()
+				if err != nil {
+					log.Print(err)
+					res.Failed = append(res.Failed, inbox)
+				} else {
+					res.Delivered++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, inbox := range inboxes {
+		jobs <- inbox
+	}
+	close(jobs)
+	wg.Wait()
+	log.Printf("published %s to %d of %d inbox(es)", a.ObjectID(), res.Delivered, len(inboxes))
+	writeJSON(w, "application/json", res)
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func internalError(w http.ResponseWriter, err error) {
+	log.Print(err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
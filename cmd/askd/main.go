@@ -0,0 +1,142 @@
+// Command askd answers readers' questions about the posts. It loads the
+// index written by `blogctl index`, retrieves the sections closest to each
+// question, and has a language model answer from them with citations that
+// link to the posts and sections it used. Questions the posts don't cover
+// get a fixed reply without a call to the model.
+//
+// Embeddings are read from EMBED_BASE_URL, EMBED_API_KEY, and EMBED_MODEL,
+// which must match the index, and the chat model from ASK_BASE_URL,
+// ASK_API_KEY (or OPENAI_API_KEY), and ASK_MODEL. Each client IP may ask
+// -burst questions at once and one per -every after that; IPs are only
+// held in memory.
+//
+// Usage:
+//
+//	askd [-addr :8090] [-index ask-index.json] [-origin https://rednafi.com] [-ip-header CF-Connecting-IP]
+//
+// Endpoints:
+//
+//	POST /ask       form-encoded q; the answer and its citations as JSON
+//	GET  /healthz   200 once the index is loaded
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rednafi/rednafi.com/internal/ask"
+	"github.com/rednafi/rednafi.com/internal/embed"
+	"github.com/rednafi/rednafi.com/internal/ratelimit"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("askd: ")
+
+	addr := flag.String("addr", ":8090", "listen address")
+	path := flag.String("index", ask.DefaultPath, "index")
+	origin := flag.String("origin", "https://rednafi.com", "allowed CORS origin")
+	ipHeader := flag.String("ip-header", "", "header with the client IP when behind a proxy, e.g. CF-Connecting-IP")
+	every := flag.Duration("every", time.Minute, "after a burst, allow one question per client IP this often")
+	burst := flag.Int("burst", 5, "questions a client IP may ask at once")
+	k := flag.Int("k", 6, "passages to give the model")
+	perPost := flag.Int("per-post", 2, "passages to give the model from one post")
+	minScore := flag.Float64("min-score", 0.3, "similarity below which a passage isn't relevant")
+	flag.Parse()
+
+	idx, err := ask.Load(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := embed.ClientFromEnv()
+	if idx.Model != c.Model {
+		log.Fatalf("index was built with %q but EMBED_MODEL is %q", idx.Model, c.Model)
+	}
+	chat := ask.ChatFromEnv()
+	log.Printf("loaded %d post(s) from %s; answering with %s", len(idx.Posts), *path, chat.Model)
+
+	s := &server{
+		asker:    &ask.Asker{Index: idx, Embed: c, Chat: chat, K: *k, PerPost: *perPost, MinScore: *minScore},
+		limiter:  ratelimit.New(*every, *burst),
+		origin:   *origin,
+		ipHeader: *ipHeader,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go s.limiter.PruneEvery(ctx, time.Minute)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /ask", s.ask)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("listening on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	asker    *ask.Asker
+	limiter  *ratelimit.Limiter
+	origin   string
+	ipHeader string
+}
+
+// maxQuestionLen bounds the question, in characters, sent to the APIs.
+const maxQuestionLen = 500
+
+func (s *server) ask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+	q := strings.TrimSpace(r.PostFormValue("q"))
+	if q == "" {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(q) > maxQuestionLen {
+		http.Error(w, "question too long", http.StatusBadRequest)
+		return
+	}
+	if !s.limiter.Allow(ratelimit.ClientIP(r, s.ipHeader), time.Now()) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many questions, slow down", http.StatusTooManyRequests)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	ans, err := s.asker.Ask(ctx, q)
+	if err != nil {
+		log.Printf("ask %q: %v", q, err)
+		http.Error(w, "answers unavailable", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(ans)
+}
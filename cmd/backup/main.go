@@ -0,0 +1,259 @@
+// Command backup keeps age-encrypted, content-addressed snapshots of
+// content/, data/, and static/ in an R2 bucket of their own; see
+// internal/backup for the layout and data/backup.toml for the settings.
+//
+// Without a subcommand it takes a snapshot, uploading only the files no
+// earlier snapshot has, and then prunes the snapshots the retention policy
+// doesn't keep, once or, with -every, on a schedule. Neither needs more
+// than the recipients' public keys. list prints the snapshots, prune only
+// prunes, and restore writes a snapshot, or the files under the given
+// paths in it, into -to with the identity in -identity.
+//
+// R2 credentials are read as for cmd/r2sync; the bucket comes from
+// data/backup.toml, or R2_BUCKET.
+//
+// Usage:
+//
+//	backup [-config data/backup.toml] [-root .] [-every 0] [-j 8] [-dry-run]
+//	backup list
+//	backup prune [-dry-run]
+//	backup restore [-identity $BACKUP_IDENTITY] [-to restore] <id|latest> [path ...]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/backup"
+	"github.com/rednafi/rednafi.com/internal/r2"
+)
+
+type config struct {
+	settings backup.Config
+	r2       r2.Config
+	jobs     int
+	dryRun   bool
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("backup: ")
+
+	args := os.Args[1:]
+	sub := ""
+	if len(args) > 0 && (args[0] == "list" || args[0] == "prune" || args[0] == "restore") {
+		sub, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("backup "+sub, flag.ExitOnError)
+	settings := fs.String("config", backup.DefaultConfig, "backup settings")
+	root := fs.String("root", ".", "directory the backed up directories are relative to")
+	every := fs.Duration("every", 0, "take a snapshot this often instead of once")
+	jobs := fs.Int("j", 8, "number of parallel uploads and downloads")
+	dryRun := fs.Bool("dry-run", false, "report what would be uploaded or pruned")
+	identity := fs.String("identity", os.Getenv("BACKUP_IDENTITY"), "age identity file to decrypt with, for restore")
+	to := fs.String("to", "restore", "directory to restore into")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := config{r2: r2.ConfigFromEnv(), jobs: *jobs, dryRun: *dryRun}
+	var err error
+	if c.settings, err = backup.Load(*settings); err != nil {
+		log.Fatal(err)
+	}
+	if c.settings.Bucket != "" {
+		c.r2.Bucket = c.settings.Bucket
+	}
+
+	switch sub {
+	case "list":
+		err = c.list(ctx)
+	case "prune":
+		err = c.prune(ctx)
+	case "restore":
+		if fs.NArg() == 0 {
+			log.Fatal("restore: missing the snapshot ID; see `backup list`")
+		}
+		err = c.restore(ctx, *identity, *to, fs.Arg(0), fs.Args()[1:])
+	default:
+		if *every <= 0 {
+			err = c.snapshot(ctx, *root, time.Now())
+			break
+		}
+		log.Printf("taking a snapshot every %s", *every)
+		t := time.NewTicker(*every)
+		defer t.Stop()
+		for {
+			// A failed snapshot is retried on the next tick rather than
+			// ending the process.
+			if err := c.snapshot(ctx, *root, time.Now()); err != nil {
+				log.Print(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (c config) store() (*backup.Store, error) {
+	recipients, err := c.settings.ParseRecipients()
+	if err != nil {
+		return nil, err
+	}
+	client, err := r2.New(c.r2)
+	if err != nil {
+		return nil, err
+	}
+	return backup.NewStore(client, recipients), nil
+}
+
+// snapshot takes a snapshot at now and prunes.
+func (c config) snapshot(ctx context.Context, root string, now time.Time) error {
+	st, err := c.store()
+	if err != nil {
+		return err
+	}
+	s, err := backup.Take(root, c.settings.Dirs, now)
+	if err != nil {
+		return err
+	}
+	missing, err := st.Missing(ctx, s)
+	if err != nil {
+		return err
+	}
+	log.Printf("snapshot %s: %d file(s), %s, %d new blob(s)", s.ID, len(s.Files), size(s.Size()), len(missing))
+	if c.dryRun {
+		return c.prune(ctx)
+	}
+	if err := st.Save(ctx, root, s, missing, c.jobs, func(string) {}); err != nil {
+		return err
+	}
+	log.Printf("saved snapshot %s", s.ID)
+	return c.prune(ctx)
+}
+
+func (c config) list(ctx context.Context) error {
+	st, err := c.store()
+	if err != nil {
+		return err
+	}
+	snaps, err := st.List(ctx)
+	if err != nil {
+		return err
+	}
+	keep, _ := c.settings.Keep.Apply(snaps)
+	kept := map[string]bool{}
+	for _, s := range keep {
+		kept[s.ID] = true
+	}
+	for _, s := range snaps {
+		mark := ""
+		if !kept[s.ID] {
+			mark = "  (pruned next run)"
+		}
+		fmt.Printf("%s  %s  %8s%s\n", s.ID, s.Time.Local().Format("2006-01-02 15:04"), size(s.Size), mark)
+	}
+	return nil
+}
+
+// prune forgets the snapshots the policy doesn't keep and collects the
+// blobs only they had.
+func (c config) prune(ctx context.Context) error {
+	if c.settings.Keep.IsZero() {
+		return nil
+	}
+	st, err := c.store()
+	if err != nil {
+		return err
+	}
+	snaps, err := st.List(ctx)
+	if err != nil {
+		return err
+	}
+	_, forget := c.settings.Keep.Apply(snaps)
+	ids := make([]string, len(forget))
+	for i, s := range forget {
+		ids[i] = s.ID
+		fmt.Println("forget", s.ID)
+	}
+	if c.dryRun {
+		log.Printf("would forget %d snapshot(s)", len(ids))
+		return nil
+	}
+	if err := st.Forget(ctx, ids); err != nil {
+		return err
+	}
+	unused, err := st.Unused(ctx)
+	if err != nil {
+		return err
+	}
+	if err := st.Collect(ctx, unused, c.jobs); err != nil {
+		return err
+	}
+	log.Printf("forgot %d snapshot(s), deleted %d unused blob(s)", len(ids), len(unused))
+	return nil
+}
+
+func (c config) restore(ctx context.Context, identity, dir, id string, paths []string) error {
+	if identity == "" {
+		return errors.New("restore: missing -identity or BACKUP_IDENTITY, the age identity file to decrypt with")
+	}
+	identities, err := backup.ReadIdentities(identity)
+	if err != nil {
+		return err
+	}
+	st, err := c.store()
+	if err != nil {
+		return err
+	}
+	if id == "latest" {
+		snaps, err := st.List(ctx)
+		if err != nil {
+			return err
+		}
+		if len(snaps) == 0 {
+			return errors.New("restore: no snapshots yet")
+		}
+		id = snaps[len(snaps)-1].ID
+	} else if _, err := backup.ParseID(id); err != nil {
+		return err
+	}
+	s, err := st.Get(ctx, id, identities)
+	if err != nil {
+		return err
+	}
+	n, err := st.Restore(ctx, s, identities, dir, paths, c.jobs, func(p string) { fmt.Println(p) })
+	if err != nil {
+		return err
+	}
+	log.Printf("restored %d file(s) from %s into %s", n, id, dir)
+	return nil
+}
+
+// size formats n bytes for people.
+func size(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
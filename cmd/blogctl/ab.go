@@ -0,0 +1,9 @@
+package main
+
+var abCmd = &command{
+	name:    "ab",
+	summary: "manage the posts' title experiments",
+	run: group("blogctl ab", []*command{
+		abReportCmd,
+	}),
+}
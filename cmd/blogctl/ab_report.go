@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/abtest"
+	"github.com/rednafi/rednafi.com/internal/cloudflare"
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+var abReportCmd = &command{
+	name:    "report",
+	summary: "tally the title experiments and write back the winners",
+	run:     runABReport,
+}
+
+// runABReport tallies the clicks on each variant of the posts' title
+// experiments, or just the posts named, over the last -days from
+// Cloudflare's GraphQL Analytics API, and prints them. An experiment with
+// -min clicks whose leader is ahead with -confidence ends: the leader
+// becomes the post's title and description, and the alternates are
+// dropped. The rest keep running.
+//
+// It needs CLOUDFLARE_API_TOKEN, with the Analytics Read permission, and
+// CLOUDFLARE_ZONE_ID.
+func runABReport(ctx context.Context, args []string) error {
+	fs := newFlags("ab report", "[slug ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	days := fs.Int("days", 14, "days of analytics to read")
+	limit := fs.Int("limit", 1000, "distinct paths to fetch per day")
+	minClicks := fs.Int("min", 100, "clicks an experiment needs before it can end")
+	confidence := fs.Float64("confidence", 0.95, "confidence, 0-1, the leader needs to win")
+	dryRun := fs.Bool("dry-run", false, "report without writing the winners back")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *confidence <= 0 || *confidence >= 1 {
+		return fmt.Errorf("-confidence %v: want between 0 and 1", *confidence)
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	exps, err := abtest.Experiments(posts)
+	if err != nil {
+		return err
+	}
+	if only := fs.Args(); len(only) > 0 {
+		exps = slices.DeleteFunc(exps, func(e abtest.Experiment) bool { return !slices.Contains(only, e.Slug) })
+	}
+	if len(exps) == 0 {
+		log.Print("no experiments running")
+		return nil
+	}
+	cf, err := cloudflare.New(cloudflare.ConfigFromEnv(), "zone")
+	if err != nil {
+		return err
+	}
+	until := time.Now().UTC().Truncate(24 * time.Hour)
+	tallies, err := abtest.Collect(ctx, cf, exps, until.AddDate(0, 0, -*days), until, *limit)
+	if err != nil {
+		return err
+	}
+
+	var ended int
+	for _, t := range tallies {
+		win, p := t.Winner()
+		fmt.Printf("%s (%d clicks, ~%.0f impressions per variant)\n", t.Slug, t.Total(), t.Impressions())
+		for i, v := range t.Variants {
+			label := "alternate " + fmt.Sprint(i)
+			if i == 0 {
+				label = "control"
+			}
+			fmt.Printf("  %-12s %6d  %6.3f%%  %q\n", label, t.Clicks[i], 100*t.CTR(i), v.Title)
+		}
+		switch {
+		case t.Total() < *minClicks:
+			fmt.Printf("  running: %d of %d clicks\n", t.Total(), *minClicks)
+			continue
+		case p > 1-*confidence:
+			fmt.Printf("  running: no clear leader (p = %.3f)\n", p)
+			continue
+		}
+		fmt.Printf("  winner: %q (p = %.3f)\n", t.Variants[win].Title, p)
+		if *dryRun {
+			continue
+		}
+		path := filepath.Join(*dir, filepath.FromSlash(t.Path))
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out, err := abtest.Apply(src, t.Experiment, win)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return err
+		}
+		ended++
+	}
+	if !*dryRun {
+		log.Printf("%d of %d experiment(s) ended", ended, len(tallies))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/syndicate"
+)
+
+var announceCmd = &command{
+	name:    "announce",
+	summary: "post new articles to Bluesky and Mastodon",
+	run:     runAnnounce,
+}
+
+// runAnnounce posts every recent article that hasn't been announced on a
+// target yet and records the resulting post in data/syndication.json. The
+// record is saved after each post, so an interrupted run never posts twice.
+//
+// Targets are enabled by their credentials: BLUESKY_HANDLE and
+// BLUESKY_APP_PASSWORD, and MASTODON_SERVER and MASTODON_TOKEN.
+func runAnnounce(ctx context.Context, args []string) error {
+	fs := newFlags("announce", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", syndicate.DefaultPath, "announcement record")
+	since := fs.Duration("since", 7*24*time.Hour, "only announce posts published within this window")
+	only := fs.String("targets", "", "comma-separated targets to post to (default: all configured)")
+	dryRun := fs.Bool("dry-run", false, "print the announcements instead of posting them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	store, err := syndicate.Load(*data)
+	if err != nil {
+		return err
+	}
+	targets, err := announceTargets(*only)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("no targets configured; set the Bluesky or Mastodon credentials")
+	}
+
+	cutoff := time.Now().Add(-*since)
+	var posted int
+	// Notes are cross-posted when they're written; see `blogctl note`.
+	for _, p := range content.Articles(content.Published(posts)) {
+		if p.Date.Before(cutoff) {
+			continue
+		}
+		a := syndicate.Announcement{
+			Title:   p.Title,
+			URL:     cfg.Permalink(p.RelPermalink()),
+			Summary: p.Description,
+			Tags:    p.Tags,
+		}
+		if a.Summary == "" {
+			a.Summary = p.Summary
+		}
+		for _, t := range targets {
+			if store.Announced(p.RelPermalink(), t.Name()) {
+				continue
+			}
+			if *dryRun {
+				fmt.Printf("%s: %s\n", t.Name(), strings.ReplaceAll(a.Text(), "\n\n", " "))
+				continue
+			}
+			r, err := t.Post(ctx, a)
+			if err != nil {
+				return fmt.Errorf("%s on %s: %w", p.Path, t.Name(), err)
+			}
+			store.Record(p.RelPermalink(), t.Name(), r)
+			if err := store.Save(*data); err != nil {
+				return err
+			}
+			posted++
+			fmt.Printf("%s -> %s\n", a.URL, r.URL)
+		}
+	}
+	log.Printf("%d announcement(s) posted", posted)
+	return nil
+}
+
+// announceTargets returns the configured targets, narrowed to the names in
+// only if it's set.
+func announceTargets(only string) ([]syndicate.Target, error) {
+	var all []syndicate.Target
+	if b := syndicate.BlueskyFromEnv(); b != nil {
+		all = append(all, b)
+	}
+	if m := syndicate.MastodonFromEnv(); m != nil {
+		all = append(all, m)
+	}
+	if only == "" {
+		return all, nil
+	}
+	var out []syndicate.Target
+	for _, name := range strings.Split(only, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, t := range all {
+			if t.Name() == name {
+				out = append(out, t)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("target %q isn't configured", name)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/activitypub"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/syndicate"
+)
+
+var apCmd = &command{
+	name:    "ap",
+	summary: "federate the blog over ActivityPub",
+	run: group("blogctl ap", []*command{
+		apPublishCmd,
+	}),
+}
+
+var apPublishCmd = &command{
+	name:    "publish",
+	summary: "deliver new posts to the blog's followers through apd",
+	run:     runAPPublish,
+}
+
+// apTarget is the name publishes are recorded under in the syndication
+// record, next to the announcements.
+const apTarget = "activitypub"
+
+// runAPPublish hands each recent post that wasn't published yet to apd as
+// a Create of a Note, which apd stores in the outbox and delivers to every
+// follower. Run it after the deploy so the links work when followers see
+// them. It needs AP_ADMIN_TOKEN, the token apd was started with.
+func runAPPublish(ctx context.Context, args []string) error {
+	fs := newFlags("ap publish", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", syndicate.DefaultPath, "announcement record")
+	server := fs.String("server", "", "apd base URL (default the site's baseURL)")
+	user := fs.String("user", activitypub.DefaultUser, "the blog's handle")
+	since := fs.Duration("since", 7*24*time.Hour, "only publish posts published within this window")
+	dryRun := fs.Bool("dry-run", false, "print the Notes instead of publishing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	store, err := syndicate.Load(*data)
+	if err != nil {
+		return err
+	}
+	token := os.Getenv("AP_ADMIN_TOKEN")
+	if token == "" && !*dryRun {
+		return errors.New("AP_ADMIN_TOKEN is not set")
+	}
+	if *server == "" {
+		*server = cfg.BaseURL
+	}
+	endpoint := strings.TrimSuffix(*server, "/") + "/ap/admin/publish"
+	blog := activitypub.FromSite(cfg, *user)
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	cutoff := time.Now().Add(-*since)
+	var published int
+	for _, p := range content.Published(posts) {
+		if p.Date.Before(cutoff) || store.Announced(p.RelPermalink(), apTarget) {
+			continue
+		}
+		a := blog.Create(cfg, p)
+		if *dryRun {
+			b, _ := json.MarshalIndent(a, "", "  ")
+			fmt.Printf("%s\n", b)
+			continue
+		}
+		res, err := apPublish(ctx, client, endpoint, token, a)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		store.Record(p.RelPermalink(), apTarget, syndicate.Result{
+			URI:      a.ObjectID(),
+			URL:      cfg.Permalink(p.RelPermalink()),
+			PostedAt: time.Now().UTC(),
+		})
+		if err := store.Save(*data); err != nil {
+			return err
+		}
+		published++
+		fmt.Printf("%s -> %d inbox(es)\n", a.ObjectID(), res.Delivered)
+		for _, inbox := range res.Failed {
+			log.Printf("%s: couldn't deliver to %s", p.Path, inbox)
+		}
+	}
+	log.Printf("%d post(s) published", published)
+	return nil
+}
+
+type apPublishResult struct {
+	Delivered int      `json:"delivered"`
+	Failed    []string `json:"failed"`
+}
+
+func apPublish(ctx context.Context, client *http.Client, endpoint, token string, a activitypub.Activity) (apPublishResult, error) {
+	var res apPublishResult
+	body, err := json.Marshal(a)
+	if err != nil {
+		return res, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Content-Type", activitypub.ContentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return res, fmt.Errorf("apd: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return res, json.NewDecoder(resp.Body).Decode(&res)
+}
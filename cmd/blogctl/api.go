@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/api"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/gitmeta"
+	"github.com/rednafi/rednafi.com/internal/readtime"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var apiCmd = &command{
+	name:    "api",
+	summary: "generate the static JSON content API under /api/",
+	run:     runAPI,
+}
+
+// runAPI writes the JSON documents of package api under -out, which Hugo
+// copies into the build as static files, and removes the ones left over
+// from posts that no longer exist. Updated dates come from
+// data/gitmeta.json when `blogctl gitmeta` has run, as for the feeds.
+func runAPI(ctx context.Context, args []string) error {
+	fs := newFlags("api", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", "static", "directory to write the API into")
+	perPage := fs.Int("per-page", api.DefaultPerPage, "posts per page of /api/posts/")
+	history := fs.String("gitmeta", gitmeta.DefaultPath, "post history from blogctl gitmeta")
+	pace := fs.String("reading-speed", readtime.DefaultConfig, "reading pace and costs for the reading times")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	meta, err := gitmeta.Load(*history)
+	if err != nil {
+		return err
+	}
+	gitmeta.Apply(posts, meta)
+	speed, err := readtime.LoadConfig(*pace)
+	if err != nil {
+		return err
+	}
+	files, err := api.Build(cfg, posts, *perPage, speed)
+	if err != nil {
+		return err
+	}
+	written, removed, err := api.Write(*out, files)
+	for _, p := range written {
+		fmt.Println(p)
+	}
+	for _, p := range removed {
+		fmt.Println("removed", p)
+	}
+	log.Printf("%d document(s), %d updated, %d removed", len(files), len(written), len(removed))
+	return err
+}
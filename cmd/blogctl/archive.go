@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/archive"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/linkcheck"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var archiveCmd = &command{
+	name:    "archive",
+	summary: "snapshot outbound links in the Wayback Machine",
+	run:     runArchive,
+}
+
+// runArchive records a Wayback Machine snapshot for every outbound link in
+// data/archives.json. Links that already have a snapshot are skipped unless
+// it's older than -refresh. When a linkcheck cache is available, links it
+// found broken are marked dead so the render hook serves the snapshot.
+func runArchive(ctx context.Context, args []string) error {
+	fs := newFlags("archive", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", archive.DefaultPath, "snapshot map to update")
+	cachePath := fs.String("linkcheck-cache", ".linkcheck.db", "linkcheck cache used to mark dead links")
+	refresh := fs.Duration("refresh", 0, "re-archive snapshots older than this (0 never re-archives)")
+	delay := fs.Duration("delay", 5*time.Second, "pause between Save Page Now requests")
+	dryRun := fs.Bool("dry-run", false, "list the links that would be archived")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	host, err := linkcheck.HostOf(cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	store, err := archive.Load(*data)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, u := range outboundURLs(host, content.Published(posts)) {
+		e, ok := store[u]
+		if !ok || (*refresh > 0 && time.Since(e.ArchivedAt) > *refresh) {
+			pending = append(pending, u)
+		}
+	}
+	log.Printf("%d outbound link(s) need a snapshot", len(pending))
+	if *dryRun {
+		for _, u := range pending {
+			fmt.Println(u)
+		}
+		return nil
+	}
+
+	client := &archive.Client{
+		HTTP:      &http.Client{Timeout: 2 * time.Minute},
+		AccessKey: os.Getenv("WAYBACK_ACCESS_KEY"),
+		SecretKey: os.Getenv("WAYBACK_SECRET_KEY"),
+	}
+	// Archiving hundreds of links takes a while, so whatever got archived
+	// is saved even if the run fails or is interrupted.
+	archived, err := snapshotAll(ctx, client, store, pending, *delay)
+	log.Printf("archived %d link(s)", archived)
+
+	if markErr := markDead(store, *cachePath); markErr != nil {
+		log.Printf("skipping dead-link marking: %v", markErr)
+	}
+	if saveErr := store.Save(*data); saveErr != nil {
+		return errors.Join(err, saveErr)
+	}
+	return err
+}
+
+func snapshotAll(
+	ctx context.Context,
+	client *archive.Client,
+	store archive.Store,
+	urls []string,
+	delay time.Duration,
+) (int, error) {
+	var archived int
+	for i, u := range urls {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return archived, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		e, ok, err := client.Latest(ctx, u)
+		if err == nil && !ok {
+			e, err = client.Save(ctx, u)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return archived, ctx.Err()
+			}
+			log.Printf("%s: %v", u, err)
+			continue
+		}
+		e.Dead = store[u].Dead
+		store[u] = e
+		archived++
+		fmt.Printf("%s -> %s\n", u, e.Snapshot)
+	}
+	return archived, nil
+}
+
+// markDead flags archived links the linkcheck cache last saw failing, and
+// clears the flag on ones that work again.
+func markDead(store archive.Store, cachePath string) error {
+	if _, err := os.Stat(cachePath); err != nil {
+		return err
+	}
+	cache, err := linkcheck.OpenCache(cachePath)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+	for u, e := range store {
+		if r, ok := cache.Get(linkcheck.Normalize(u)); ok {
+			e.Dead = !r.OK
+			store[u] = e
+		}
+	}
+	return nil
+}
+
+// outboundURLs returns the sorted, deduplicated links in posts to sites
+// other than host.
+func outboundURLs(host string, posts []*content.Post) []string {
+	seen := map[string]bool{}
+	for _, p := range posts {
+		for _, l := range markdown.Parse([]byte(p.Body), p.BodyLine).Links() {
+			if linkcheck.IsExternal(host, l.Dest) && !archive.IsSnapshot(l.Dest) {
+				seen[l.Dest] = true
+			}
+		}
+	}
+	urls := make([]string, 0, len(seen))
+	for u := range seen {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/ask"
+	"github.com/rednafi/rednafi.com/internal/embed"
+)
+
+var askEvalCmd = &command{
+	name:    "ask-eval",
+	summary: "score askd's answers against the golden questions",
+	run:     runAskEval,
+}
+
+// runAskEval asks each question in data/ask_eval.toml the way askd would
+// and reports the ones whose answer misses its posts or phrases. It fails
+// when fewer than -min of them pass, so a change to the chunking, the
+// prompt, or the models can be checked before it's deployed.
+// -retrieval-only scores the retrieval alone, without the chat API.
+func runAskEval(ctx context.Context, args []string) error {
+	fs := newFlags("ask-eval", "")
+	golden := fs.String("golden", ask.DefaultGolden, "golden questions")
+	path := fs.String("index", ask.DefaultPath, "index")
+	k := fs.Int("k", 6, "passages to retrieve")
+	perPost := fs.Int("per-post", 2, "passages to retrieve from one post")
+	minScore := fs.Float64("min-score", 0.3, "similarity below which a passage isn't relevant")
+	retrievalOnly := fs.Bool("retrieval-only", false, "score what's retrieved without asking the model")
+	minPass := fs.Float64("min", 0.8, "share of questions that must pass")
+	verbose := fs.Bool("v", false, "print every answer")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pairs, err := ask.LoadGolden(*golden)
+	if err != nil {
+		return err
+	}
+	idx, err := ask.Load(*path)
+	if err != nil {
+		return err
+	}
+	c := embed.ClientFromEnv()
+	if idx.Model != c.Model {
+		return fmt.Errorf("index was built with %q but EMBED_MODEL is %q; run blogctl index", idx.Model, c.Model)
+	}
+	a := &ask.Asker{Index: idx, Embed: c, Chat: ask.ChatFromEnv(), K: *k, PerPost: *perPost, MinScore: *minScore}
+	results, err := ask.Eval(ctx, a, pairs, *retrievalOnly)
+	if err != nil {
+		return err
+	}
+
+	var passed int
+	for _, r := range results {
+		if r.Pass {
+			passed++
+		}
+		if r.Pass && !*verbose {
+			continue
+		}
+		status := "PASS"
+		if !r.Pass {
+			status = "FAIL"
+		}
+		fmt.Printf("%s %q\n", status, r.Golden.Question)
+		if !r.Golden.Unanswerable {
+			fmt.Printf("    retrieved %t, cited %t\n", r.Retrieved, r.Cited)
+		}
+		if len(r.Missing) > 0 {
+			fmt.Printf("    missing %s\n", strings.Join(r.Missing, ", "))
+		}
+		for _, s := range r.Answer.Retrieved {
+			fmt.Printf("    [%d] %.3f %s\n", s.N, s.Score, s.URL)
+		}
+		if !*retrievalOnly {
+			fmt.Printf("    %s\n", strings.ReplaceAll(r.Answer.Answer, "\n", "\n    "))
+		}
+	}
+	log.Printf("%d of %d question(s) passed", passed, len(results))
+	if float64(passed) < *minPass*float64(len(results)) {
+		return fmt.Errorf("ask-eval: %d of %d passed, below -min %.2f", passed, len(results), *minPass)
+	}
+	return nil
+}
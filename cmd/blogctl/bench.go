@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/rednafi/rednafi.com/internal/bench"
+	"github.com/rednafi/rednafi.com/internal/bundle"
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+var benchCmd = &command{
+	name:    "bench",
+	summary: "run each post's Go benchmarks and write the results into it",
+	run:     runBench,
+}
+
+// runBench runs the benchmarks under code/<slug>/ for every post with
+// <!-- bench --> markers, or just the posts named, and replaces what's
+// between the markers with a table of the results. Posts with benchmarks
+// but no markers are reported, since their numbers aren't shown.
+func runBench(ctx context.Context, args []string) error {
+	fs := newFlags("bench", "[slug ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	code := fs.String("code", bundle.DefaultDir, "directory of code folders named after the posts' slugs")
+	count := fs.Int("count", bench.DefaultCount, "times to run each benchmark")
+	benchtime := fs.String("benchtime", "", "go test -benchtime, like 2s or 1000x")
+	dryRun := fs.Bool("dry-run", false, "print the tables instead of writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	only := fs.Args()
+	var updated, unchanged int
+	for _, p := range posts {
+		if len(only) > 0 && !slices.Contains(only, p.Slug) {
+			continue
+		}
+		path := filepath.Join(*dir, filepath.FromSlash(p.Path))
+		names, err := bench.Find(filepath.Join(*code, p.Slug))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		markers, err := bench.Markers(src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		switch {
+		case len(markers) == 0 && len(names) > 0:
+			log.Printf("%s: %d benchmark(s) but no <!-- bench --> marker to show them", path, len(names))
+			continue
+		case len(markers) == 0:
+			continue
+		case len(names) == 0:
+			return fmt.Errorf("%s:%d: no benchmarks under %s", path, markers[0].Line, filepath.Join(*code, p.Slug))
+		}
+
+		log.Printf("%s: running %d benchmark(s)", path, len(names))
+		r, err := bench.Run(ctx, filepath.Join(*code, p.Slug), bench.Options{Count: *count, Benchtime: *benchtime})
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if *dryRun {
+			for _, m := range markers {
+				table, err := bench.Table(r, m.Pattern)
+				if err != nil {
+					return fmt.Errorf("%s:%d: %w", path, m.Line, err)
+				}
+				fmt.Printf("%s:%d:\n%s\n", path, m.Line, table)
+			}
+			continue
+		}
+		out, err := bench.Inject(src, markers, r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if bytes.Equal(out, src) {
+			unchanged++
+			continue
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return err
+		}
+		updated++
+		fmt.Println(path)
+	}
+	if !*dryRun {
+		log.Printf("%d post(s) updated, %d unchanged", updated, unchanged)
+	}
+	return nil
+}
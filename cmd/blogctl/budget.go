@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rednafi/rednafi.com/internal/budget"
+)
+
+var budgetCmd = &command{
+	name:    "budget",
+	summary: "check each built page's weight and requests against data/budgets.toml",
+	run:     runBudget,
+}
+
+// runBudget measures every page of the built site, checks it against the
+// budgets in -config, and fails listing the measurements over budget with
+// their change since -baseline. A build within budget becomes the new
+// baseline, so the change is against the last build that passed. It reads
+// the pages as they're deployed, so it runs after `blogctl minify`.
+func runBudget(ctx context.Context, args []string) error {
+	fs := newFlags("budget", "")
+	public := fs.String("public", "public", "built site to measure")
+	configPath := fs.String("config", budget.DefaultConfig, "budgets")
+	baselinePath := fs.String("baseline", budget.DefaultBaseline, "last passing build's measurements; empty to skip")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := budget.Load(*configPath)
+	if err != nil {
+		return err
+	}
+	prev := map[string]budget.Page{}
+	if *baselinePath != "" {
+		if prev, err = budget.LoadBaseline(*baselinePath); err != nil {
+			return err
+		}
+	}
+	pages, err := budget.Measure(*public)
+	if err != nil {
+		return err
+	}
+
+	violations := budget.Check(cfg, pages, prev)
+	if len(violations) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PAGE\tMETRIC\tVALUE\tBUDGET\tBASELINE\tCHANGE")
+		for _, v := range violations {
+			base, change := "new", ""
+			if v.Baseline >= 0 {
+				base, change = fmt.Sprint(v.Baseline), fmt.Sprintf("%+d", v.Value-v.Baseline)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", v.Page, v.Metric, v.Value, v.Limit, base, change)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d budget violation(s)", len(violations))
+	}
+	log.Printf("%d page(s) within budget", len(pages))
+	if *baselinePath != "" {
+		return budget.SaveBaseline(*baselinePath, pages)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/pipeline"
+	"github.com/rednafi/rednafi.com/internal/telemetry"
+)
+
+var buildCmd = &command{
+	name:    "build",
+	summary: "build the site, running the stages in data/pipeline.toml whose inputs changed",
+	run:     runBuild,
+}
+
+// runBuild runs the stages of the pipeline in -config, as many at once as
+// -j allows, skipping the ones whose inputs are as they were when they last
+// succeeded. Naming stages builds just them and what they need. -force
+// reruns every stage it builds, or with stage names just those; -graph
+// prints the graph for Graphviz instead of building.
+func runBuild(ctx context.Context, args []string) error {
+	fs := newFlags("build", "[stage...]")
+	configPath := fs.String("config", pipeline.DefaultConfig, "stages of the build")
+	cachePath := fs.String("cache", pipeline.DefaultCache, "input hashes of the stages' last successful runs")
+	jobs := fs.Int("j", runtime.NumCPU(), "stages to run at once")
+	force := fs.Bool("force", false, "rerun stages whose inputs haven't changed")
+	graph := fs.Bool("graph", false, "print the stages as a dot graph and exit")
+	dryRun := fs.Bool("dry-run", false, "list what would run without running it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := pipeline.Load(*configPath)
+	if err != nil {
+		return err
+	}
+	if names := fs.Args(); len(names) > 0 {
+		if cfg, err = cfg.Select(names); err != nil {
+			return err
+		}
+	}
+	if *graph {
+		fmt.Print(cfg.Dot())
+		return nil
+	}
+	cache, err := pipeline.LoadCache(*cachePath)
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// The stages' spans would otherwise add to the last build's when trace
+	// report sums them.
+	if !*dryRun {
+		if err := telemetry.FromEnv().Reset(); err != nil {
+			return err
+		}
+	}
+
+	r := &pipeline.Runner{
+		Root:   ".",
+		Jobs:   *jobs,
+		Cache:  cache,
+		DryRun: *dryRun,
+		Exec:   func(ctx context.Context, s pipeline.Stage) ([]byte, error) { return runStage(ctx, self, s) },
+		Done:   printResult(*dryRun),
+	}
+	if *force {
+		r.Force, r.ForceAll = fs.Args(), len(fs.Args()) == 0
+	}
+	start := time.Now()
+	results, err := r.Run(ctx, cfg)
+	if !*dryRun {
+		if serr := r.Cache.Save(*cachePath); serr != nil {
+			return errors.Join(err, serr)
+		}
+	}
+
+	counts := map[string]int{}
+	for _, res := range results {
+		counts[res.Status]++
+	}
+	ran := "ran"
+	if *dryRun {
+		ran = "would run"
+	}
+	log.Printf("%d %s, %d skipped, %d failed, %d blocked in %s",
+		counts[pipeline.Ran], ran, counts[pipeline.Skipped], counts[pipeline.Failed], counts[pipeline.Blocked],
+		time.Since(start).Round(time.Millisecond))
+	return err
+}
+
+// runStage runs s's command with sh, a leading "blogctl" standing for self,
+// and times it as a stage of the build trace.
+func runStage(ctx context.Context, self string, s pipeline.Stage) ([]byte, error) {
+	command := s.Run
+	if rest, ok := strings.CutPrefix(command, "blogctl "); ok {
+		command = "'" + strings.ReplaceAll(self, "'", `'\''`) + "' " + rest
+	}
+	ctx, timer := telemetry.Start(ctx, s.Name)
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	cmd.Env = append(os.Environ(), telemetry.FromEnv().Env(timer.Stage(), timer.Depth()+1)...)
+	err := cmd.Run()
+	if terr := timer.End(err); terr != nil {
+		log.Print(terr)
+	}
+	return out.Bytes(), err
+}
+
+// printResult prints each stage as it finishes, with its output, which is
+// held back until then so the output of stages running at once doesn't
+// interleave.
+func printResult(dryRun bool) func(pipeline.Result) {
+	return func(res pipeline.Result) {
+		status := res.Status
+		if dryRun && status == pipeline.Ran {
+			status = "would run"
+		}
+		line := fmt.Sprintf("%s %s (%s)", status, res.Stage.Name, res.Reason)
+		if res.Dur > 0 {
+			line += " in " + res.Dur.Round(time.Millisecond).String()
+		}
+		fmt.Println(line)
+		os.Stdout.Write(res.Output)
+		if res.Err != nil {
+			msg := res.Err.Error()
+			if res.Stage.Optional {
+				msg += ", but it's optional"
+			}
+			fmt.Printf("%s: %s\n", res.Stage.Name, msg)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/bundle"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/r2"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var bundlesCmd = &command{
+	name:    "bundles",
+	summary: "zip each post's code for a download link and upload it to R2",
+	run:     runBundles,
+}
+
+// runBundles zips the code that goes with each published article, from
+// code/<slug>/ or its named code blocks, and uploads the zip to R2 as
+// <prefix><slug>-<hash>.zip, cached as immutable since changed code gets
+// a new name. Posts whose zip didn't change since data/bundles.json was
+// written are skipped, as are posts with `bundle: false`. Run over every
+// post, it also deletes the bundles of posts that no longer have code.
+//
+// R2 credentials are read as for cmd/r2sync; -base is the URL the bucket
+// is public at.
+func runBundles(ctx context.Context, args []string) error {
+	r2cfg := r2.ConfigFromEnv()
+	fs := newFlags("bundles", "[slug ...]")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	code := fs.String("code", bundle.DefaultDir, "directory of code folders named after the posts' slugs")
+	data := fs.String("data", bundle.DefaultPath, "bundles manifest")
+	fs.StringVar(&r2cfg.Bucket, "bucket", r2cfg.Bucket, "bucket to store the bundles in")
+	prefix := fs.String("prefix", "code/", "key prefix inside the bucket")
+	base := fs.String("base", "", "public URL of the bucket, e.g. https://files.rednafi.com")
+	force := fs.Bool("force", false, "upload the bundles again even if they didn't change")
+	dryRun := fs.Bool("dry-run", false, "list the bundles that would be uploaded and their files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *base == "" && !*dryRun {
+		return errors.New("bundles: -base is required")
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	manifest, err := bundle.Load(*data)
+	if err != nil {
+		return err
+	}
+	var client *r2.Client
+	if !*dryRun {
+		if client, err = r2.New(r2cfg); err != nil {
+			return err
+		}
+	}
+
+	only := fs.Args()
+	have := map[string]bool{}
+	var uploaded, skipped int
+	for _, p := range content.Articles(content.Published(posts)) {
+		if len(only) > 0 && !slices.Contains(only, p.Slug) {
+			continue
+		}
+		if on, ok := p.Params["bundle"].(bool); ok && !on {
+			continue
+		}
+		files, err := bundle.Files(p, *code)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		have[p.Slug] = true
+		zip, err := bundle.Zip(p, cfg.Permalink(p.RelPermalink()), files)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		hash := bundle.Hash(zip)
+		prev, ok := manifest[p.Slug]
+		if ok && prev.Hash == hash && !*force {
+			skipped++
+			continue
+		}
+		names := make([]string, len(files))
+		for i, f := range files {
+			names[i] = f.Name
+		}
+		if *dryRun {
+			fmt.Printf("%s: %s\n", p.Path, strings.Join(names, ", "))
+			continue
+		}
+
+		key := *prefix + p.Slug + "-" + hash[:12] + ".zip"
+		if err := client.Put(ctx, key, zip, r2.PutOptions{
+			ContentType:  "application/zip",
+			CacheControl: "public, max-age=31536000, immutable",
+		}); err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		if ok && prev.Key != key {
+			if err := client.Delete(ctx, prev.Key); err != nil {
+				log.Printf("%s: deleting the old bundle: %v", p.Path, err)
+			}
+		}
+		manifest[p.Slug] = bundle.Bundle{
+			Hash:  hash,
+			Key:   key,
+			Src:   strings.TrimSuffix(*base, "/") + "/" + key,
+			Bytes: len(zip),
+			Files: names,
+		}
+		uploaded++
+		fmt.Println(manifest[p.Slug].Src)
+	}
+
+	var removed int
+	if len(only) == 0 {
+		for slug, b := range manifest {
+			if have[slug] {
+				continue
+			}
+			removed++
+			if *dryRun {
+				fmt.Printf("%s: no code anymore; its bundle would be deleted\n", slug)
+				continue
+			}
+			if err := client.Delete(ctx, b.Key); err != nil {
+				return fmt.Errorf("%s: %w", slug, err)
+			}
+			delete(manifest, slug)
+		}
+	}
+	if *dryRun {
+		log.Printf("%d post(s) unchanged, %d bundle(s) to delete", skipped, removed)
+		return nil
+	}
+	if err := manifest.Save(*data); err != nil {
+		return err
+	}
+	log.Printf("%d bundle(s) uploaded, %d unchanged, %d deleted", uploaded, skipped, removed)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/rednafi/rednafi.com/internal/cite"
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+var citeCmd = &command{
+	name:    "cite",
+	summary: "number the posts' citations and write data/cite.json",
+	run:     runCite,
+}
+
+// runCite numbers the references each post cites with the cite shortcode
+// and writes them, formatted, for the shortcode and the references
+// partial to read as site.Data.cite. A cite of a key that's in none of
+// the reference files fails the command, after the file is written.
+func runCite(ctx context.Context, args []string) error {
+	fs := newFlags("cite", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	refsDir := fs.String("refs", cite.DefaultDir, "directory of reference files")
+	out := fs.String("out", cite.DefaultPath, "file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	refs, err := cite.Load(*refsDir)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	cites, problems := cite.Posts(posts, refs)
+	written, err := cite.Write(*out, cites)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	for _, p := range problems {
+		p.Path = filepath.Join(*dir, p.Path)
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d unknown reference(s)", len(problems))
+	}
+	log.Printf("%d reference(s), cited in %d post(s)", len(refs), len(cites))
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/comments"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/webmention"
+)
+
+var commentsCmd = &command{
+	name:    "comments",
+	summary: "moderate the webmentions cmd/webmentiond received",
+	run: group("blogctl comments", []*command{
+		commentsApproveCmd,
+		commentsBlockDomainCmd,
+		commentsExportCmd,
+		commentsListCmd,
+	}),
+}
+
+var commentsListCmd = &command{
+	name:    "list",
+	summary: "list the mentions in the store",
+	run:     runCommentsList,
+}
+
+// runCommentsList prints the mentions, oldest first, every one unless
+// -pending narrows it to those awaiting approval.
+func runCommentsList(ctx context.Context, args []string) error {
+	fs := newFlags("comments list", "")
+	dbPath := fs.String("db", webmention.DefaultDB, "webmentiond's SQLite database")
+	pending := fs.Bool("pending", false, "only the mentions awaiting approval")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := webmention.OpenStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	status := ""
+	if *pending {
+		status = webmention.StatusPending
+	}
+	ms, err := store.List(ctx, status)
+	if err != nil {
+		return err
+	}
+	if len(ms) == 0 {
+		log.Print("no mentions")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tRECEIVED\tSOURCE\tTARGET\tAUTHOR")
+	for _, m := range ms {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", m.Status, m.Received.Local().Format(time.DateTime), m.Source, m.Target, m.Author)
+	}
+	return tw.Flush()
+}
+
+var commentsApproveCmd = &command{
+	name:    "approve",
+	summary: "approve pending mentions by source URL",
+	run:     runCommentsApprove,
+}
+
+// runCommentsApprove approves the mentions each source URL sent, of every
+// post it mentions unless -target names one.
+func runCommentsApprove(ctx context.Context, args []string) error {
+	fs := newFlags("comments approve", "<source> ...")
+	dbPath := fs.String("db", webmention.DefaultDB, "webmentiond's SQLite database")
+	target := fs.String("target", "", "approve only the mentions of this post URL")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no source URLs given")
+	}
+
+	store, err := webmention.OpenStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	var approved int
+	for _, source := range fs.Args() {
+		n, err := store.Approve(ctx, source, *target)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			log.Printf("%s: nothing pending", source)
+		}
+		approved += n
+	}
+	log.Printf("%d mention(s) approved; run `blogctl comments export` to publish them", approved)
+	return nil
+}
+
+var commentsBlockDomainCmd = &command{
+	name:    "block-domain",
+	summary: "turn away a domain's mentions and drop its comments",
+	run:     runCommentsBlockDomain,
+}
+
+// runCommentsBlockDomain blocks each domain, subdomains included: the
+// mentions it already sent are deleted, later ones are refused, and the
+// fediverse comments from accounts on it are dropped from data/comments/.
+// cmd/fedicomments keeps them out when it's given the same -db.
+func runCommentsBlockDomain(ctx context.Context, args []string) error {
+	fs := newFlags("comments block-domain", "<domain> ...")
+	dbPath := fs.String("db", webmention.DefaultDB, "webmentiond's SQLite database")
+	dir := fs.String("comments", comments.DefaultDir, "fediverse comment files to prune")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no domains given")
+	}
+
+	store, err := webmention.OpenStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	now := time.Now().UTC()
+	var deleted int
+	for _, d := range fs.Args() {
+		n, err := store.Block(ctx, d, now)
+		if err != nil {
+			return err
+		}
+		deleted += n
+	}
+	blocked, err := store.Blocked(ctx)
+	if err != nil {
+		return err
+	}
+	dropped, err := pruneComments(*dir, blocked)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d domain(s) now blocked, %d mention(s) deleted, %d comment(s) dropped", len(blocked), deleted, dropped)
+	return nil
+}
+
+// pruneComments drops the comments by authors on the blocked domains from
+// the files in dir, rewriting the files that change.
+func pruneComments(dir string, blocked []string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	var total int
+	for _, path := range paths {
+		f, err := comments.Load(path)
+		if err != nil {
+			return total, err
+		}
+		n := f.Drop(func(c comments.Comment) bool { return fromBlocked(c.Author, blocked) })
+		if n == 0 {
+			continue
+		}
+		if _, err := comments.Write(dir, strings.TrimSuffix(filepath.Base(path), ".json"), f); err != nil {
+			return total, err
+		}
+		fmt.Printf("%s: %d comment(s) dropped\n", path, n)
+		total += n
+	}
+	return total, nil
+}
+
+// fromBlocked reports whether a's account is on one of the blocked
+// domains.
+func fromBlocked(a comments.Author, blocked []string) bool {
+	return slices.ContainsFunc(a.Hosts(), func(h string) bool { return webmention.OnDomain(h, blocked) })
+}
+
+var commentsExportCmd = &command{
+	name:    "export",
+	summary: "snapshot the approved mentions into data/webmentions/",
+	run:     runCommentsExport,
+}
+
+// runCommentsExport writes each post's approved mentions to
+// data/webmentions/<slug>.json for the comments partial to render, and
+// removes the files of posts that no longer have any.
+func runCommentsExport(ctx context.Context, args []string) error {
+	fs := newFlags("comments export", "")
+	dbPath := fs.String("db", webmention.DefaultDB, "webmentiond's SQLite database")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", webmention.DefaultExportDir, "directory to write mention files into")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	store, err := webmention.OpenStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	all, err := store.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Translations share their original's slug, and so its mentions.
+	bySlug := map[string][]webmention.Mention{}
+	for _, p := range content.Published(posts) {
+		if ms := all[cfg.Permalink(p.RelPermalink())]; len(ms) > 0 {
+			bySlug[p.Slug] = append(bySlug[p.Slug], ms...)
+		}
+	}
+	keep := map[string]bool{}
+	var written, total int
+	for slug, ms := range bySlug {
+		slices.SortStableFunc(ms, func(a, b webmention.Mention) int {
+			return cmp.Or(a.Received.Compare(b.Received), cmp.Compare(a.Source, b.Source))
+		})
+		keep[slug] = true
+		total += len(ms)
+		ok, err := webmention.WriteExport(*out, slug, ms)
+		if err != nil {
+			return err
+		}
+		if ok {
+			written++
+			fmt.Printf("%s: %d mention(s)\n", slug, len(ms))
+		}
+	}
+	removed, err := webmention.PruneExport(*out, keep)
+	if err != nil {
+		return err
+	}
+	for _, path := range removed {
+		fmt.Printf("%s: removed\n", path)
+	}
+	log.Printf("%d mention(s) of %d post(s), %d file(s) updated, %d removed", total, len(bySlug), written, len(removed))
+	return nil
+}
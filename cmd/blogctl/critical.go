@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/critical"
+)
+
+var criticalCmd = &command{
+	name:    "critical",
+	summary: "inline each kind of page's above-the-fold CSS and defer the stylesheets",
+	run:     runCritical,
+}
+
+// runCritical inlines the CSS that styles the top of the home page, the
+// posts, and the list pages into each of them, worked out from -sample
+// pages of each kind, and defers their stylesheets. It reads the
+// stylesheets fingerprinted, so it runs after `blogctl fingerprint`, and
+// before `blogctl csp`, which hashes the inlined CSS and the stylesheets'
+// onload handlers.
+func runCritical(ctx context.Context, args []string) error {
+	fs := newFlags("critical", "")
+	public := fs.String("public", "public", "built site to rewrite")
+	sample := fs.Int("sample", 10, "pages of each kind to work out the critical CSS from")
+	budget := fs.Int("budget", 1500, "characters of text counted as above the fold")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	st, err := critical.Run(*public, critical.Options{Sample: *sample, Budget: *budget})
+	if err != nil {
+		return err
+	}
+	for _, kind := range []string{critical.Home, critical.Post, critical.List} {
+		if st.Pages[kind] > 0 {
+			log.Printf("%s: %d byte(s) of critical CSS in %d page(s)", kind, st.Bytes[kind], st.Pages[kind])
+		}
+	}
+	return nil
+}
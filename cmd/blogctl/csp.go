@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+
+	"github.com/rednafi/rednafi.com/internal/csp"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/headers"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var cspCmd = &command{
+	name:    "csp",
+	summary: "build each page's content security policy into public/_headers",
+	run:     runCSP,
+}
+
+// runCSP scans the built site in -dir and writes its _headers file: the
+// rules from data/headers.toml, with its cache classes and the build's
+// fingerprinted files as rules of their own, then each page's
+// Content-Security-Policy, allowing just the origins and inline code the
+// page uses. The widgets' APIs from config.yml are allowed to connect
+// everywhere. Violations are reported to -report, cmd/cspreportd's
+// endpoint.
+func runCSP(ctx context.Context, args []string) error {
+	fs := newFlags("csp", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("dir", "public", "built site to scan")
+	policyPath := fs.String("headers", headers.DefaultPath, "response header policy the pages' policies are added to")
+	report := fs.String("report", "", "violation report URL (default params.cspreport + /report)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	if !flagSet(fs, "report") && cfg.Params.CSPReport != "" {
+		*report, err = url.JoinPath(cfg.Params.CSPReport, "report")
+		if err != nil {
+			return err
+		}
+	}
+	written, n, err := writeCSP(cfg, *dir, *policyPath, *report)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(filepath.Join(*dir, headers.File))
+	}
+	log.Printf("%d page(s), reporting to %q", n, *report)
+	return nil
+}
+
+// writeCSP writes dir's _headers file for cfg's site, reporting to report,
+// unless it's unchanged. It returns whether it wrote and the number of
+// pages.
+func writeCSP(cfg *site.Config, dir, policyPath, report string) (bool, int, error) {
+	policy, err := headers.Load(policyPath)
+	if err != nil {
+		return false, 0, err
+	}
+	if policy, err = policy.Expand(dir); err != nil {
+		return false, 0, err
+	}
+	base, err := url.Parse(cfg.BaseURL + "/")
+	if err != nil {
+		return false, 0, err
+	}
+	opts := csp.Options{Report: report}
+	for _, api := range []string{cfg.Params.ViewCount, cfg.Params.Kudos, cfg.Params.Suggest} {
+		if api != "" {
+			opts.Connect = append(opts.Connect, api)
+		}
+	}
+	pages, err := csp.Build(dir, base, opts)
+	if err != nil {
+		return false, 0, err
+	}
+	b := csp.Headers(policy, pages, report).Format()
+	wrote, err := fsutil.WriteIfChanged(filepath.Join(dir, headers.File), b)
+	return wrote, len(pages), err
+}
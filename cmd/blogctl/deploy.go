@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/cloudflare"
+	"github.com/rednafi/rednafi.com/internal/deploy"
+	"github.com/rednafi/rednafi.com/internal/fingerprint"
+	"github.com/rednafi/rednafi.com/internal/headers"
+	"github.com/rednafi/rednafi.com/internal/r2"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/telemetry"
+)
+
+var deployCmd = &command{
+	name:    "deploy",
+	summary: "upload the built site to R2 and purge the changed URLs from Cloudflare",
+	run:     runDeploy,
+}
+
+// runDeploy syncs the Hugo output to the R2 bucket the site is served
+// from, uploading only files whose hash differs from the object's ETag.
+// With -purge, the URLs of exactly those files are then purged from
+// Cloudflare's cache, so unchanged pages stay cached at the edge.
+//
+// -env picks the environment from data/deploy.toml, whose bucket, prefix,
+// URL, and purge setting apply unless the flags say otherwise. If the file
+// names a snapshots bucket, every deploy is recorded there, with the
+// contents of each file, so `blogctl rollback` can restore it, and the
+// pages added, changed, and removed since the environment's last deploy
+// are printed.
+//
+// -preview deploys a branch's build to the preview bucket instead, under
+// preview/<branch>/, uncached, with a _headers file that keeps the
+// previews out of search results. Files the branch's previous preview had
+// and this build doesn't are deleted; `blogctl preview gc` deletes whole
+// previews once they go stale.
+//
+// R2 credentials are read as for cmd/r2sync; purging needs
+// CLOUDFLARE_API_TOKEN and CLOUDFLARE_ZONE_ID.
+func runDeploy(ctx context.Context, args []string) error {
+	r2cfg := r2.ConfigFromEnv()
+	fs := newFlags("deploy", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	envsPath := fs.String("deploys", deploy.DefaultConfig, "deploy environments and snapshots bucket")
+	envName := fs.String("env", deploy.DefaultEnv, "environment to deploy to, like prod or staging")
+	branch := fs.String("preview", "", "deploy a preview of this branch instead of an environment")
+	dir := fs.String("dir", "public", "built site to upload")
+	fs.StringVar(&r2cfg.Bucket, "bucket", r2cfg.Bucket, "destination bucket")
+	prefix := fs.String("prefix", "", "key prefix inside the bucket")
+	maxAge := fs.Int("max-age", 3600, "cache-control max-age in seconds, for paths the header policy doesn't cover")
+	policyPath := fs.String("headers", headers.DefaultPath, "response header policy, for each file's cache-control")
+	jobs := fs.Int("j", 8, "number of parallel uploads")
+	purge := fs.Bool("purge", false, "purge the changed URLs from Cloudflare's cache")
+	dryRun := fs.Bool("dry-run", false, "print what would be uploaded and purged")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	var store *deploy.Store
+	var preview string
+	if *branch != "" {
+		preview, err = previewTarget(fs, *envsPath, *branch, &r2cfg, prefix)
+	} else {
+		store, err = environment(fs, *envsPath, *envName, &r2cfg, prefix, purge, cfg)
+	}
+	if err != nil {
+		return err
+	}
+	policy, err := headers.Load(*policyPath)
+	if err != nil {
+		return err
+	}
+	client, err := r2.New(r2cfg)
+	if err != nil {
+		return err
+	}
+	var cf *cloudflare.Client
+	if *purge && !*dryRun {
+		// Fail before uploading anything rather than leave stale pages
+		// cached.
+		if cf, err = cloudflare.New(cloudflare.ConfigFromEnv(), "zone"); err != nil {
+			return err
+		}
+	}
+
+	local, err := r2.Walk(*dir, *prefix)
+	if err != nil {
+		return err
+	}
+	rel := func(f r2.File) string {
+		return "/" + strings.TrimPrefix(strings.TrimPrefix(f.Key, *prefix), "/")
+	}
+	// The headers file `blogctl csp` writes is for the edge to read, not to
+	// serve.
+	local = slices.DeleteFunc(local, func(f r2.File) bool { return rel(f) == "/"+headers.File })
+	policy.SetMetadata(local, rel)
+	if preview != "" {
+		for i, f := range local {
+			// Previews aren't purged, and a reviewer reloading should see
+			// the latest push; a fingerprinted file still never changes.
+			if !fingerprint.Hashed(rel(f)) {
+				local[i].CacheControl = "no-cache"
+			}
+		}
+	}
+	_, timer := telemetry.Start(ctx, "compare")
+	pending, remote, err := client.Changed(ctx, local, *prefix)
+	timer.End(err)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d local files, %d remote objects, %d to upload", len(local), remote, len(pending))
+	if preview != "" {
+		return deployPreview(ctx, client, local, pending, *prefix, preview, *jobs, *dryRun)
+	}
+
+	snap := deploy.Snap(*envName, *prefix, time.Now(), local)
+	var diff deploy.Diff
+	if store != nil {
+		prev, err := store.Latest(ctx, *envName)
+		if err != nil {
+			return err
+		}
+		diff = deploy.Compare(prev, snap)
+		// Objects keep the metadata they were uploaded with, so a policy
+		// change only reaches them uploaded again.
+		pending = deploy.Restamp(prev, local, pending)
+	}
+
+	var urls []string
+	if *dryRun {
+		for _, f := range pending {
+			fmt.Println(f.Key)
+			urls = append(urls, purgeURLs(cfg, *prefix, f.Key)...)
+		}
+		if *purge {
+			for _, u := range urls {
+				fmt.Println("purge", u)
+			}
+		}
+		if store != nil {
+			diff.Print(os.Stdout)
+			log.Printf("would deploy %s to %s: %s", snap.ID, *envName, diff)
+		}
+		return nil
+	}
+
+	// The contents go into the store first, so a recorded deploy can
+	// always be restored.
+	if store != nil {
+		_, timer := telemetry.Start(ctx, "keep")
+		kept, err := store.Keep(ctx, local, *jobs)
+		timer.End(err)
+		if err != nil {
+			return err
+		}
+		log.Printf("kept %d new file(s) for rollbacks", kept)
+	}
+
+	// Pages are purged on every deploy they change in, so the edge can
+	// keep them for max-age without going stale; unlike r2sync's assets,
+	// they aren't immutable. Files data/headers.toml gives a Cache-Control
+	// use that instead.
+	cacheControl := fmt.Sprintf("public, max-age=%d", *maxAge)
+	_, timer = telemetry.Start(ctx, "upload")
+	uploadErr := client.Upload(ctx, pending, cacheControl, *jobs, func(f r2.File) {
+		fmt.Println(f.Key)
+		urls = append(urls, purgeURLs(cfg, *prefix, f.Key)...)
+	})
+	timer.End(uploadErr)
+	// Purge what did upload even if some files failed.
+	if cf != nil && len(urls) > 0 {
+		_, timer := telemetry.Start(ctx, "purge")
+		err := cf.PurgeFiles(ctx, urls)
+		timer.End(err)
+		if err != nil {
+			return errors.Join(uploadErr, err)
+		}
+		log.Printf("purged %d URL(s)", len(urls))
+	}
+	// A partial upload isn't a state worth rolling back to.
+	if uploadErr != nil || store == nil {
+		return uploadErr
+	}
+	if err := store.Save(ctx, snap); err != nil {
+		return err
+	}
+	diff.Print(os.Stdout)
+	log.Printf("deploy %s to %s: %s", snap.ID, *envName, diff)
+	return nil
+}
+
+// previewTarget points the flags fs didn't set at branch's preview, from
+// the settings at envsPath, and returns the URL it's served at.
+func previewTarget(fs *flag.FlagSet, envsPath, branch string, r2cfg *r2.Config, prefix *string) (string, error) {
+	if flagSet(fs, "purge") || flagSet(fs, "env") {
+		return "", errors.New("-preview doesn't take -env or -purge")
+	}
+	settings, err := deploy.Load(envsPath)
+	if err != nil {
+		return "", err
+	}
+	p := settings.Preview
+	if p.Bucket == "" && !flagSet(fs, "bucket") {
+		// Never fall back to R2_BUCKET, which is the live site's.
+		return "", fmt.Errorf("%s: no [preview] bucket", envsPath)
+	}
+	if p.Bucket != "" && !flagSet(fs, "bucket") {
+		r2cfg.Bucket = p.Bucket
+	}
+	if !flagSet(fs, "prefix") {
+		if *prefix, err = deploy.PreviewPrefix(branch); err != nil {
+			return "", err
+		}
+	}
+	return p.URL(*prefix), nil
+}
+
+// deployPreview uploads a preview's pending files, deletes the objects
+// under prefix the build no longer has, and makes sure the bucket's
+// _headers file marks the previews noindex.
+func deployPreview(ctx context.Context, client *r2.Client, local, pending []r2.File, prefix, url string, jobs int, dryRun bool) error {
+	remote, err := client.List(ctx, prefix+"/")
+	if err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	for _, f := range local {
+		keep[f.Key] = true
+	}
+	var stale []string
+	for _, o := range remote {
+		if !keep[o.Key] {
+			stale = append(stale, o.Key)
+		}
+	}
+	if dryRun {
+		for _, f := range pending {
+			fmt.Println(f.Key)
+		}
+		for _, key := range stale {
+			fmt.Println("delete", key)
+		}
+		return nil
+	}
+
+	noindex := deploy.NoIndex.Format()
+	if err := client.Put(ctx, headers.File, noindex, r2.PutOptions{ContentType: "text/plain; charset=utf-8", CacheControl: "no-cache"}); err != nil {
+		return err
+	}
+	if err := client.Upload(ctx, pending, "no-cache", jobs, func(f r2.File) { fmt.Println(f.Key) }); err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := client.Delete(ctx, key); err != nil {
+			return err
+		}
+		fmt.Println("delete", key)
+	}
+	log.Printf("preview at %s", url)
+	return nil
+}
+
+// environment applies the deploy environment name, from the settings at
+// envsPath, to the flags fs didn't set, and returns the store deploys are
+// recorded in, or nil if the settings name no snapshots bucket.
+func environment(fs *flag.FlagSet, envsPath, name string, r2cfg *r2.Config, prefix *string, purge *bool, cfg *site.Config) (*deploy.Store, error) {
+	settings, err := deploy.Load(envsPath)
+	if err != nil {
+		return nil, err
+	}
+	env, err := settings.Env(name)
+	if err != nil {
+		return nil, err
+	}
+	if env.Bucket != "" && !flagSet(fs, "bucket") {
+		r2cfg.Bucket = env.Bucket
+	}
+	if env.Prefix != "" && !flagSet(fs, "prefix") {
+		*prefix = env.Prefix
+	}
+	if env.Purge && !flagSet(fs, "purge") {
+		*purge = true
+	}
+	if env.BaseURL != "" {
+		cfg.BaseURL = strings.TrimRight(env.BaseURL, "/")
+	}
+	if settings.Snapshots == "" {
+		log.Printf("%s: no snapshots bucket; deploys to %s aren't recorded", envsPath, name)
+		return nil, nil
+	}
+	sc := *r2cfg
+	sc.Bucket = settings.Snapshots
+	c, err := r2.New(sc)
+	if err != nil {
+		return nil, err
+	}
+	return deploy.NewStore(c), nil
+}
+
+// purgeURLs returns the URLs a visitor can fetch the object key by: its
+// own, plus the directory URL for an index.html.
+func purgeURLs(cfg *site.Config, prefix, key string) []string {
+	rel := "/" + strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/")
+	urls := []string{cfg.Permalink(rel)}
+	if path.Base(rel) == "index.html" {
+		dir := strings.TrimSuffix(rel, "index.html")
+		urls = append(urls, cfg.Permalink(dir))
+	}
+	return urls
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/diagram"
+)
+
+var diagramsCmd = &command{
+	name:    "diagrams",
+	summary: "render mermaid and d2 blocks to SVG into data/diagrams/",
+	run:     runDiagrams,
+}
+
+// runDiagrams renders the posts' diagrams that have no stored rendering
+// yet into data/diagrams/ for the render-codeblock-mermaid and
+// render-codeblock-d2 hooks, and removes the renderings no post uses
+// anymore. Diagrams that fail to render are reported and show their
+// source.
+func runDiagrams(ctx context.Context, args []string) error {
+	fs := newFlags("diagrams", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", diagram.DefaultDir, "directory to write diagrams into")
+	mermaid := fs.String("mermaid", strings.Join(diagram.DefaultMermaid, " "), "mermaid CLI command")
+	d2 := fs.String("d2", strings.Join(diagram.DefaultD2, " "), "d2 CLI command")
+	force := fs.Bool("force", false, "re-render diagrams that are already stored")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(strings.Fields(*mermaid)) == 0 || len(strings.Fields(*d2)) == 0 {
+		return errors.New("-mermaid and -d2 can't be empty")
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	r := diagram.Renderer{Mermaid: strings.Fields(*mermaid), D2: strings.Fields(*d2)}
+	blocks := diagram.Blocks(posts)
+	var (
+		rendered int
+		errs     []error
+	)
+	for _, b := range blocks {
+		if !*force {
+			d, err := diagram.Load(*out, b.Hash)
+			if err != nil {
+				return err
+			}
+			if d != nil {
+				continue
+			}
+		}
+		d, err := r.Render(ctx, b)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := diagram.Write(*out, b.Hash, d); err != nil {
+			return err
+		}
+		fmt.Printf("%s:%d\n", b.Post, b.Line)
+		rendered++
+	}
+	removed, err := diagram.Prune(*out, blocks)
+	if err != nil {
+		return err
+	}
+	for _, p := range removed {
+		fmt.Println("removed", p)
+	}
+	for _, err := range errs {
+		log.Print(err)
+	}
+	log.Printf("%d diagram(s), %d rendered", len(blocks), rendered)
+	if len(errs) > 0 {
+		return errors.New("some diagrams show their source")
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/embed"
+)
+
+var embedCmd = &command{
+	name:    "embed",
+	summary: "compute post embeddings for semsearch",
+	run:     runEmbed,
+}
+
+// runEmbed updates the embeddings index, only calling the API for posts
+// whose text changed. The endpoint, key, and model come from EMBED_BASE_URL,
+// EMBED_API_KEY, and EMBED_MODEL.
+func runEmbed(ctx context.Context, args []string) error {
+	fs := newFlags("embed", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", embed.DefaultPath, "embeddings index")
+	batch := fs.Int("batch", 64, "passages per API request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	idx, err := embed.Load(*out)
+	if err != nil {
+		return err
+	}
+	c := embed.ClientFromEnv()
+	st, err := idx.Update(ctx, c, posts, *batch)
+	if err != nil {
+		return err
+	}
+	if st.Embedded > 0 {
+		if err := idx.Save(*out); err != nil {
+			return err
+		}
+	}
+	log.Printf("%s: %d post(s) embedded, %d unchanged", c.Model, st.Embedded, st.Reused)
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/export"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var exportCmd = &command{
+	name:    "export",
+	summary: "bundle the content, its images, and a manifest into a tarball",
+	run:     runExport,
+}
+
+// runExport writes every markdown file under -content, with its front
+// matter normalized to YAML, the files under -static they reference, and
+// a manifest.json describing both into a gzipped tarball, for backups or
+// for moving off Hugo. The files are under a <host>-<date>/ folder.
+func runExport(ctx context.Context, args []string) error {
+	now := time.Now()
+	fs := newFlags("export", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	static := fs.String("static", "static", "directory root-relative references are under")
+	out := fs.String("out", "", "tarball to write (default <host>-<date>.tar.gz)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	host := "site"
+	if u, err := url.Parse(cfg.BaseURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	root := host + "-" + now.Format("20060102")
+	if *out == "" {
+		*out = root + ".tar.gz"
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	m, problems, err := export.Write(f, export.Options{
+		Content: *dir,
+		Static:  *static,
+		Site:    export.Site{Title: cfg.Title, BaseURL: cfg.BaseURL},
+		Root:    root,
+		Time:    now,
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	log.Printf("%s: %d page(s), %d asset(s)", *out, len(m.Pages), len(m.Assets))
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/feeds"
+	"github.com/rednafi/rednafi.com/internal/gitmeta"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/telemetry"
+)
+
+var feedsCmd = &command{
+	name:    "feeds",
+	summary: "generate RSS, Atom, and JSON feeds for the site and each tag",
+	run:     runFeeds,
+}
+
+// runFeeds writes index.xml (RSS), atom.xml, and feed.json at the site root,
+// under /notes/, and under every /tags/<tag>/ directory of -out, which Hugo then copies
+// into the build as static files. Updated dates come from data/gitmeta.json
+// when `blogctl gitmeta` has run, and from lastmod otherwise.
+func runFeeds(ctx context.Context, args []string) error {
+	fs := newFlags("feeds", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", "static", "directory to write feeds into")
+	limit := fs.Int("limit", 0, "maximum items per feed (0 for all)")
+	history := fs.String("gitmeta", gitmeta.DefaultPath, "post history from blogctl gitmeta")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	meta, err := gitmeta.Load(*history)
+	if err != nil {
+		return err
+	}
+	gitmeta.Apply(posts, meta)
+	_, timer := telemetry.Start(ctx, "build")
+	all, err := feeds.Build(cfg, posts, *limit)
+	timer.End(err)
+	if err != nil {
+		return err
+	}
+	_, timer = telemetry.Start(ctx, "write")
+	written, err := feeds.Write(*out, cfg, all)
+	timer.End(err)
+	for _, p := range written {
+		fmt.Println(p)
+	}
+	log.Printf("%d feed(s), %d file(s) updated", len(all), len(written))
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/fingerprint"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var fingerprintCmd = &command{
+	name:    "fingerprint",
+	summary: "rename the built assets after their hashes and rewrite the references",
+	run:     runFingerprint,
+}
+
+// runFingerprint renames the stylesheets, scripts, images, and fonts in
+// the built site to name.<hash>.ext and points the pages and stylesheets
+// at the new names, after Hugo and the other rewrites have run, so that
+// `blogctl deploy` can store them as immutable. The originals of -keep
+// stay as they are, for the URLs that are linked from outside the pages.
+func runFingerprint(ctx context.Context, args []string) error {
+	fs := newFlags("fingerprint", "")
+	public := fs.String("public", "public", "built site to rewrite")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	keep := fs.String("keep", strings.Join(fingerprint.DefaultKeep, ","), "comma-separated paths, or prefixes ending in *, whose originals are kept")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	base, err := url.Parse(cfg.BaseURL + "/")
+	if err != nil {
+		return err
+	}
+	var patterns []string
+	for p := range strings.SplitSeq(*keep, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	st, err := fingerprint.Run(*public, base, patterns)
+	if err != nil {
+		return err
+	}
+	log.Printf("fingerprinted %d asset(s), rewrote %d page(s)", st.Assets, st.Pages)
+	return nil
+}
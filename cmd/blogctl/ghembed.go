@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/ghembed"
+	"github.com/rednafi/rednafi.com/internal/github"
+)
+
+var ghembedCmd = &command{
+	name:    "ghembed",
+	summary: "render the files posts embed from GitHub into data/ghembed.json",
+	run:     runGHEmbed,
+}
+
+// runGHEmbed fetches the file of every ghembed shortcode at its commit,
+// or reads it from the cache, and writes the highlighted lines the
+// shortcode reads as site.Data.ghembed.
+// A shortcode whose ref is a branch, tag, or short SHA fails the command,
+// since what it shows would drift; -pin replaces the ref in the post with
+// the commit it names today. GITHUB_TOKEN, if set, raises the API's rate
+// limit for -pin; fetching the files doesn't use the API.
+func runGHEmbed(ctx context.Context, args []string) error {
+	fs := newFlags("ghembed", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", ghembed.DefaultPath, "file to write")
+	cache := fs.String("cache", ghembed.DefaultCache, "directory to keep the fetched files in")
+	pin := fs.Bool("pin", false, "replace refs that aren't commit SHAs with the commit they name")
+	timeout := fs.Duration("timeout", 20*time.Second, "per-request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	prev, err := ghembed.Load(*out)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: *timeout}
+	gh := &github.Client{HTTP: client, Token: os.Getenv("GITHUB_TOKEN")}
+	f := &ghembed.Fetcher{HTTP: client, Cache: *cache}
+
+	m := ghembed.Manifest{}
+	var problems []error
+	for _, p := range posts {
+		scs, err := ghembed.Find(p)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		path := filepath.Join(*dir, filepath.FromSlash(p.Path))
+		shas := map[int]string{}
+		for i, sc := range scs {
+			if sc.Pinned() {
+				continue
+			}
+			if !*pin {
+				problems = append(problems, fmt.Errorf("%s:%d: ref %q isn't a commit SHA; run with -pin to pin it", path, sc.Line, sc.Ref))
+				continue
+			}
+			sha, err := gh.CommitSHA(ctx, sc.Repo, sc.Ref)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s:%d: %w", path, sc.Line, err))
+				continue
+			}
+			shas[sc.Line] = sha
+			scs[i].Ref = sha
+			fmt.Printf("%s:%d: pinned %s to %s\n", path, sc.Line, sc.Ref, sha)
+		}
+		if len(shas) > 0 {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, ghembed.Pin(src, p, scs, shas), 0o644); err != nil {
+				return err
+			}
+		}
+
+		for _, sc := range scs {
+			if !sc.Pinned() {
+				continue
+			}
+			src, err := f.Fetch(ctx, sc.Embed)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s:%d: %w", path, sc.Line, err))
+				continue
+			}
+			r, err := ghembed.Render(sc.Embed, src)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s:%d: %w", path, sc.Line, err))
+				continue
+			}
+			m[sc.Key()] = r
+		}
+	}
+
+	if !reflect.DeepEqual(m, prev) {
+		if err := m.Save(*out); err != nil {
+			return err
+		}
+		fmt.Println(*out)
+	}
+	for _, err := range problems {
+		log.Print(err)
+	}
+	log.Printf("%d embed(s), %d file(s) fetched", len(m), f.Fetched)
+	if len(problems) > 0 {
+		return errors.New("some embeds weren't rendered")
+	}
+	return nil
+}
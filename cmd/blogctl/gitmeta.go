@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/gitmeta"
+)
+
+var gitmetaCmd = &command{
+	name:    "gitmeta",
+	summary: "derive post dates and changelogs from git into data/gitmeta.json",
+	run:     runGitmeta,
+}
+
+// runGitmeta writes the slug → history map the lastmod partial reads as
+// site.Data.gitmeta. Commits listed in .git-blame-ignore-revs don't count as
+// edits, so bulk reformatting doesn't bump every post's date.
+func runGitmeta(ctx context.Context, args []string) error {
+	fs := newFlags("gitmeta", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", gitmeta.DefaultPath, "file to write")
+	ignoreRevs := fs.String("ignore-revs", gitmeta.IgnoreRevsFile, "file of commits that aren't edits")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	ignore, err := gitmeta.LoadIgnoreRevs(*ignoreRevs)
+	if err != nil {
+		return err
+	}
+	m, err := gitmeta.Collect(ctx, *dir, content.Published(posts), ignore)
+	if err != nil {
+		return err
+	}
+	written, err := gitmeta.Write(*out, m)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d of %d post(s) have history", len(m), len(content.Published(posts)))
+	return nil
+}
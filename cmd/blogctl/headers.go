@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/headers"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var headersCmd = &command{
+	name:    "headers",
+	summary: "show and verify the response header and cache policy",
+	run: group("blogctl headers", []*command{
+		headersShowCmd,
+		headersVerifyCmd,
+	}),
+}
+
+var headersShowCmd = &command{
+	name:    "show",
+	summary: "print the headers and caching the policy gives paths",
+	run:     runHeadersShow,
+}
+
+// runHeadersShow prints the headers data/headers.toml gives each URL path,
+// and what decided its Cache-Control.
+func runHeadersShow(ctx context.Context, args []string) error {
+	fs := newFlags("headers show", "<path...>")
+	policyPath := fs.String("headers", headers.DefaultPath, "response header policy")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("need a URL path, like / or /css/main.css")
+	}
+	policy, err := headers.Load(*policyPath)
+	if err != nil {
+		return err
+	}
+
+	for i, u := range fs.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		c := policy.CacheFor(u)
+		h := policy.For(u)
+		if c.Control != "" {
+			h.Set("Cache-Control", c.Control)
+		}
+		fmt.Println(u)
+		for _, k := range slices.Sorted(maps.Keys(h)) {
+			fmt.Printf("  %s: %s\n", k, h.Get(k))
+		}
+		if c.Control == "" {
+			fmt.Println("  # no Cache-Control; deploy's -max-age applies")
+			continue
+		}
+		notes := []string{"from " + c.From}
+		if c.Immutable {
+			notes = append(notes, "immutable")
+		}
+		if c.ETag {
+			notes = append(notes, "revalidated by ETag")
+		}
+		fmt.Printf("  # %s\n", strings.Join(notes, ", "))
+	}
+	return nil
+}
+
+var headersVerifyCmd = &command{
+	name:    "verify",
+	summary: "fetch live URLs and check their headers match the policy",
+	run:     runHeadersVerify,
+}
+
+// runHeadersVerify fetches paths of the live site and fails listing the
+// headers that differ from the policy: the built site's _headers file, if
+// `blogctl csp` has written it, or else data/headers.toml. Without paths
+// it samples -per files from the build in -dir for each rule, class, or
+// fingerprint that caches them, so every way of caching gets checked.
+func runHeadersVerify(ctx context.Context, args []string) error {
+	fs := newFlags("headers verify", "[path...]")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	base := fs.String("base", "", "site to check (default baseURL)")
+	dir := fs.String("dir", "public", "built site to sample paths from and read _headers in")
+	policyPath := fs.String("headers", headers.DefaultPath, "response header policy, without a built _headers")
+	per := fs.Int("per", 3, "paths to sample for each way of caching")
+	jobs := fs.Int("j", 8, "number of URLs to fetch at once")
+	timeout := fs.Duration("timeout", 15*time.Second, "timeout for each request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *base == "" {
+		cfg, err := site.Load(*config)
+		if err != nil {
+			return err
+		}
+		*base = cfg.BaseURL
+	}
+	*base = strings.TrimRight(*base, "/")
+	policy, err := builtPolicy(*dir, *policyPath)
+	if err != nil {
+		return err
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		if paths, err = policy.Samples(*dir, *per); err != nil {
+			return err
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("nothing to check; build the site into %s or name paths", *dir)
+	}
+
+	client := &http.Client{
+		Timeout: *timeout,
+		// A redirect's headers are the redirect's, not the file's.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	type result struct {
+		mismatches []headers.Mismatch
+		err        error
+	}
+	results := make([]result, len(paths))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(*jobs, 1))
+	for i, u := range paths {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			got, err := fetchHeaders(ctx, client, *base+u)
+			results[i] = result{err: err}
+			if err == nil {
+				results[i].mismatches = policy.Check(u, got)
+			}
+		})
+	}
+	wg.Wait()
+
+	var bad int
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, r := range results {
+		switch {
+		case r.err != nil:
+			bad++
+			fmt.Fprintf(tw, "%s\t\t%v\t\n", paths[i], r.err)
+		case len(r.mismatches) > 0:
+			bad++
+			for _, m := range r.mismatches {
+				got := m.Got
+				if got == "" {
+					got = "(none)"
+				}
+				fmt.Fprintf(tw, "%s\t%s\twant %s\tgot %s\n", paths[i], m.Header, m.Want, got)
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d of %d URL(s) differ from the policy", bad, len(paths))
+	}
+	log.Printf("%d URL(s) of %s match the policy", len(paths), *base)
+	return nil
+}
+
+// builtPolicy returns the policy of the site built into dir, from its
+// _headers file, or the one at policyPath if it has none.
+func builtPolicy(dir, policyPath string) (*headers.Policy, error) {
+	f, err := os.Open(filepath.Join(dir, headers.File))
+	if errors.Is(err, os.ErrNotExist) {
+		return headers.Load(policyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return headers.Parse(f)
+}
+
+// fetchHeaders GETs url and returns its response's headers, which must
+// come with a 200.
+func fetchHeaders(ctx context.Context, client *http.Client, url string) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	return resp.Header, nil
+}
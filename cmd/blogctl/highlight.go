@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/highlight"
+)
+
+var highlightCmd = &command{
+	name:    "highlight",
+	summary: "pre-render code blocks with Chroma into data/highlight/",
+	run:     runHighlight,
+}
+
+// runHighlight renders every post's fenced blocks into
+// data/highlight/<key>.json for the render-codeblock hook, and writes the
+// matching stylesheet. Blocks with bad attributes are reported and left to
+// Hugo's highlighter.
+func runHighlight(ctx context.Context, args []string) error {
+	fs := newFlags("highlight", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", highlight.DefaultDir, "directory to write blocks into")
+	css := fs.String("css", highlight.DefaultCSS, "stylesheet to write")
+	style := fs.String("style", highlight.DefaultStyle, "Chroma style for the stylesheet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sheet, err := highlight.CSS(*style)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	var (
+		blocks int
+		errs   []error
+	)
+	for _, p := range posts {
+		bs, perr := highlight.Post(p)
+		errs = append(errs, perr...)
+		if len(bs) == 0 {
+			continue
+		}
+		blocks += len(bs)
+		written, err := highlight.Write(*out, p.DataKey(), bs)
+		if err != nil {
+			return err
+		}
+		if written {
+			fmt.Println(p.Path)
+		}
+	}
+	written, err := fsutil.WriteIfChanged(*css, []byte(sheet))
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*css)
+	}
+	for _, err := range errs {
+		log.Print(err)
+	}
+	log.Printf("%d block(s) in %d post(s)", blocks, len(posts))
+	if len(errs) > 0 {
+		return errors.New("some blocks were left to Hugo")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/rednafi/rednafi.com/internal/icons"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var iconsCmd = &command{
+	name:    "icons",
+	summary: "render the favicons, touch and maskable icons, and site.webmanifest from one SVG",
+	run:     runIcons,
+}
+
+// runIcons renders every icon the site needs from -src into -static,
+// along with site.webmanifest, and writes the <link> tags for them to
+// -links, which the icons partial reads. The manifest takes its name and
+// description from the Hugo config.
+func runIcons(ctx context.Context, args []string) error {
+	fs := newFlags("icons", "")
+	src := fs.String("src", icons.DefaultSource, "source SVG")
+	static := fs.String("static", "static", "directory to write the icons into")
+	links := fs.String("links", icons.DefaultLinks, "<link> tags for the icons partial")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	shortName := fs.String("short-name", "Reflections", "name under the icon on a home screen")
+	background := fs.String("background", "#1d1e20", "background of the splash screen and opaque icons")
+	theme := fs.String("theme", "#1d1e20", "color of the browser's chrome")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(*src)
+	if err != nil {
+		return err
+	}
+	set, err := icons.Generate(b, icons.Options{
+		Name:        cfg.Title,
+		ShortName:   *shortName,
+		Description: cfg.Params.Description,
+		Background:  *background,
+		Theme:       *theme,
+	})
+	if err != nil {
+		return err
+	}
+	n, err := set.Write(*static, *links)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d file(s), %d written", len(set.Files)+1, n)
+	return nil
+}
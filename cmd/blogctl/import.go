@@ -0,0 +1,10 @@
+package main
+
+var importCmd = &command{
+	name:    "import",
+	summary: "bring drafts written elsewhere into the site",
+	run: group("blogctl import", []*command{
+		importNotionCmd,
+		importObsidianCmd,
+	}),
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/importers/notion"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+var importNotionCmd = &command{
+	name:    "notion",
+	summary: "convert Notion pages, from an export zip or the API, into draft posts",
+	run:     runImportNotion,
+}
+
+// runImportNotion converts the pages of a "Markdown & CSV" export zip, or
+// those titled after it, or with NOTION_TOKEN the pages with the given IDs
+// or URLs, into drafts at content/<section>/<date>-<slug>.md, with their
+// images in static/. As with `import obsidian`, an existing draft is only
+// replaced with -force.
+func runImportNotion(ctx context.Context, args []string) error {
+	fs := newFlags("import notion", "<export.zip> [title ...] | <page-id> ...")
+	dir := fs.String("content", content.Dir, "content directory")
+	static := fs.String("static", "static", "static directory")
+	section := fs.String("section", "misc", "section to create the drafts in")
+	images := fs.String("images", "images", "where images go, relative to -static")
+	date := fs.String("date", time.Now().Format(time.DateOnly), "date for pages without one, YYYY-MM-DD")
+	tmpl := fs.String("template", newpost.DefaultTemplate, "front matter template")
+	aliasesPath := fs.String("aliases", tags.DefaultAliases, "tag alias map")
+	force := fs.Bool("force", false, "replace drafts an earlier import created")
+	dryRun := fs.Bool("dry-run", false, "report what would be written without writing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("import notion: missing the export or page IDs")
+	}
+	d, err := time.Parse(time.DateOnly, *date)
+	if err != nil {
+		return fmt.Errorf("-date: %w", err)
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	aliases, err := tags.LoadAliases(*aliasesPath)
+	if err != nil {
+		return err
+	}
+	var pages []*notion.Page
+	if strings.HasSuffix(fs.Arg(0), ".zip") {
+		if pages, err = notion.FromZip(fs.Arg(0), fs.Args()[1:]); err != nil {
+			return err
+		}
+	} else {
+		c, err := notion.ClientFromEnv()
+		if err != nil {
+			return err
+		}
+		for _, id := range fs.Args() {
+			p, err := c.Page(ctx, id)
+			if err != nil {
+				return err
+			}
+			pages = append(pages, p)
+		}
+	}
+	r, err := notion.Import(ctx, pages, notion.Options{
+		Section:  *section,
+		Template: *tmpl,
+		Date:     d,
+		Aliases:  aliases,
+		Posts:    posts,
+		Images:   *images,
+		HTTP:     &http.Client{Timeout: time.Minute},
+	})
+	if err != nil {
+		return err
+	}
+
+	var written, copied, problems int
+	for _, p := range r.Posts {
+		path := filepath.Join(*dir, filepath.FromSlash(p.Path))
+		for _, msg := range p.Page.Problems {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", p.Page.Title, msg)
+			problems++
+		}
+		if _, err := os.Stat(path); err == nil && !*force {
+			log.Printf("%s: %s exists; pass -force to replace it", p.Page.Title, path)
+			continue
+		}
+		fmt.Printf("%s -> %s\n", p.Page.Title, filepath.ToSlash(path))
+		if *dryRun {
+			continue
+		}
+		if err := writeFile(path, p.Body); err != nil {
+			return err
+		}
+		written++
+	}
+	for _, a := range r.Attachments {
+		path := filepath.Join(*static, filepath.FromSlash(a.Dest))
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, a.Data) {
+			continue
+		}
+		fmt.Println(filepath.ToSlash(path))
+		if *dryRun {
+			continue
+		}
+		if err := writeFile(path, a.Data); err != nil {
+			return err
+		}
+		copied++
+	}
+	log.Printf("%d draft(s) written, %d image(s) copied, %d problem(s)", written, copied, problems)
+	return nil
+}
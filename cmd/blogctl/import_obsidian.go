@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/importers/obsidian"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+var importObsidianCmd = &command{
+	name:    "obsidian",
+	summary: "convert notes from an Obsidian vault into draft posts",
+	run:     runImportObsidian,
+}
+
+// runImportObsidian converts the named notes, or those with `publish:
+// true`, into drafts at content/<section>/<date>-<slug>.md, with their
+// wiki-links turned into refs and their attachments copied into static/.
+// Links to notes that aren't imported and aren't posts are reported as
+// path:line and left as plain text. An existing draft is only replaced
+// with -force, so edits made after an earlier import aren't lost.
+func runImportObsidian(ctx context.Context, args []string) error {
+	fs := newFlags("import obsidian", "<vault> [note ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	static := fs.String("static", "static", "static directory")
+	section := fs.String("section", "misc", "section to create the drafts in")
+	images := fs.String("images", "images", "where embedded images go, relative to -static")
+	files := fs.String("files", "files", "where other attachments go, relative to -static")
+	date := fs.String("date", time.Now().Format(time.DateOnly), "date for notes without one, YYYY-MM-DD")
+	tmpl := fs.String("template", newpost.DefaultTemplate, "front matter template")
+	aliasesPath := fs.String("aliases", tags.DefaultAliases, "tag alias map")
+	force := fs.Bool("force", false, "replace drafts an earlier import created")
+	dryRun := fs.Bool("dry-run", false, "report what would be written without writing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("import obsidian: missing the vault")
+	}
+	d, err := time.Parse(time.DateOnly, *date)
+	if err != nil {
+		return fmt.Errorf("-date: %w", err)
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	aliases, err := tags.LoadAliases(*aliasesPath)
+	if err != nil {
+		return err
+	}
+	v, err := obsidian.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	notes, err := v.Select(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	if len(notes) == 0 {
+		log.Printf("no notes in %s set `publish: true`; name the ones to import", v.Root)
+		return nil
+	}
+	r, err := v.Import(notes, obsidian.Options{
+		Section:  *section,
+		Template: *tmpl,
+		Date:     d,
+		Aliases:  aliases,
+		Posts:    posts,
+		Images:   *images,
+		Files:    *files,
+	})
+	if err != nil {
+		return err
+	}
+
+	var written int
+	for _, p := range r.Posts {
+		path := filepath.Join(*dir, filepath.FromSlash(p.Path))
+		if _, err := os.Stat(path); err == nil && !*force {
+			log.Printf("%s: %s exists; pass -force to replace it", p.Note, path)
+			continue
+		}
+		fmt.Printf("%s -> %s\n", p.Note, filepath.ToSlash(path))
+		if *dryRun {
+			continue
+		}
+		if err := writeFile(path, p.Body); err != nil {
+			return err
+		}
+		written++
+	}
+	var copied int
+	for _, a := range r.Attachments {
+		b, err := os.ReadFile(filepath.Join(v.Root, filepath.FromSlash(a.Src)))
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(*static, filepath.FromSlash(a.Dest))
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, b) {
+			continue
+		}
+		fmt.Printf("%s -> %s\n", a.Src, filepath.ToSlash(path))
+		if *dryRun {
+			continue
+		}
+		if err := writeFile(path, b); err != nil {
+			return err
+		}
+		copied++
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	log.Printf("%d draft(s) written, %d attachment(s) copied, %d problem(s)", written, copied, len(r.Problems))
+	return nil
+}
+
+func writeFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
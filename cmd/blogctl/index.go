@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/ask"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/embed"
+)
+
+var indexCmd = &command{
+	name:    "index",
+	summary: "embed the posts section by section for askd",
+	run:     runIndex,
+}
+
+// runIndex updates askd's index, only calling the embeddings API for posts
+// whose sections changed. The endpoint, key, and model come from
+// EMBED_BASE_URL, EMBED_API_KEY, and EMBED_MODEL, as for `blogctl embed`.
+func runIndex(ctx context.Context, args []string) error {
+	fs := newFlags("index", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", ask.DefaultPath, "index")
+	batch := fs.Int("batch", 64, "passages per API request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	idx, err := ask.Load(*out)
+	if err != nil {
+		return err
+	}
+	c := embed.ClientFromEnv()
+	st, err := idx.Update(ctx, c, posts, *batch)
+	if err != nil {
+		return err
+	}
+	if st.Embedded > 0 {
+		if err := idx.Save(*out); err != nil {
+			return err
+		}
+	}
+	log.Printf("%s: %d post(s) embedded, %d unchanged", c.Model, st.Embedded, st.Reused)
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/kudos"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var kudosCmd = &command{
+	name:    "kudos",
+	summary: "work with the hearts kudosd collects",
+	run: group("blogctl kudos", []*command{
+		kudosExportCmd,
+	}),
+}
+
+var kudosExportCmd = &command{
+	name:    "export",
+	summary: "snapshot the hearts into data/kudos.json",
+	run:     runKudosExport,
+}
+
+// runKudosExport writes the slug → hearts map the kudos partial reads as
+// site.Data.kudos, keeping only published posts. Without a kudosd URL it
+// does nothing, so the build step is harmless until one is deployed.
+func runKudosExport(ctx context.Context, args []string) error {
+	fs := newFlags("kudos export", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	from := fs.String("from", "", "kudosd base URL (default params.kudos)")
+	out := fs.String("out", kudos.DefaultPath, "file to write")
+	timeout := fs.Duration("timeout", 20*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == "" {
+		cfg, err := site.Load(*config)
+		if err != nil {
+			return err
+		}
+		*from = cfg.Params.Kudos
+	}
+	if *from == "" {
+		log.Print("params.kudos isn't set; nothing to export")
+		return nil
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	counts, err := kudos.Fetch(ctx, &http.Client{Timeout: *timeout}, *from)
+	if err != nil {
+		return err
+	}
+	snapshot := map[string]int{}
+	for _, p := range content.Published(posts) {
+		if n, ok := counts[p.Slug]; ok {
+			snapshot[p.Slug] = n
+		}
+	}
+	written, err := kudos.Write(*out, snapshot)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d post(s) with kudos", len(snapshot))
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+var lintCmd = &command{
+	name:    "lint",
+	summary: "check the posts for problems",
+	run: group("blogctl lint", []*command{
+		lintA11yCmd,
+		lintAnchorsCmd,
+		lintFrontmatterCmd,
+		lintHTMLCmd,
+		lintImagesCmd,
+		lintProseCmd,
+		lintTranslationsCmd,
+		lintURLsCmd,
+	}),
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/a11y"
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+var lintA11yCmd = &command{
+	name:    "a11y",
+	summary: "find missing alt text, heading skips, vague links, and low contrast",
+	run:     runLintA11y,
+}
+
+// runLintA11y renders every post and reports accessibility problems as
+// path:line: rule: message. It fails if any are found, so CI stops before
+// the build. The rules are img-alt, heading-order, link-text, and contrast.
+func runLintA11y(ctx context.Context, args []string) error {
+	fs := newFlags("lint a11y", "[post ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	drafts := fs.Bool("drafts", false, "check drafts too")
+	rules := fs.String("rules", "", "comma-separated rules to report (default: all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	if !*drafts {
+		posts = content.Published(posts)
+	}
+	posts, err = selectPosts(posts, fs.Args(), *dir)
+	if err != nil {
+		return err
+	}
+	var only []string
+	if *rules != "" {
+		only = strings.Split(*rules, ",")
+	}
+	var n int
+	for _, p := range posts {
+		problems, err := a11y.Post(p)
+		if err != nil {
+			return err
+		}
+		for _, pr := range problems {
+			if only != nil && !slices.Contains(only, pr.Rule) {
+				continue
+			}
+			fmt.Printf("%s/%s:%s\n", *dir, p.Path, pr)
+			n++
+		}
+	}
+	log.Printf("%d post(s) checked", len(posts))
+	if n > 0 {
+		return fmt.Errorf("%d accessibility problem(s)", n)
+	}
+	return nil
+}
+
+// selectPosts narrows posts to the content-relative paths in named, or
+// returns them all if named is empty.
+func selectPosts(posts []*content.Post, named []string, dir string) ([]*content.Post, error) {
+	if len(named) == 0 {
+		return posts, nil
+	}
+	var out []*content.Post
+	for _, n := range named {
+		i := slices.IndexFunc(posts, func(p *content.Post) bool { return p.Path == n })
+		if i < 0 {
+			return nil, fmt.Errorf("no post %q under %s", n, dir)
+		}
+		out = append(out, posts[i])
+	}
+	return out, nil
+}
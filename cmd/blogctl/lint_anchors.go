@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/linkcheck"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var lintAnchorsCmd = &command{
+	name:    "anchors",
+	summary: "find #fragment links to anchors the built site doesn't have",
+	run:     runLintAnchors,
+}
+
+// runLintAnchors checks the #fragment of every internal link in the posts,
+// same-page and cross-post alike, against the ids in Hugo's output, so it
+// runs after the build. A reworded heading changes its anchor without
+// breaking the build, and this is where the links to the old one show up.
+func runLintAnchors(ctx context.Context, args []string) error {
+	fs := newFlags("lint anchors", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	public := fs.String("public", "public", "Hugo's output directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	src, err := linkcheck.FromMarkdown(cfg.BaseURL, *dir, posts, "")
+	if err != nil {
+		return err
+	}
+	built, err := linkcheck.FromHTML(cfg.BaseURL, *public)
+	if err != nil {
+		return err
+	}
+	problems := src.CheckAnchors(built)
+	for _, p := range problems {
+		fmt.Printf("%s:%d: %s: %s\n", p.Source, p.Line, p.Dest, p.Reason)
+	}
+	log.Printf("%d page(s) checked", len(built.Pages))
+	if len(problems) > 0 {
+		return fmt.Errorf("%d broken anchor(s)", len(problems))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/frontmatter"
+)
+
+var lintFrontmatterCmd = &command{
+	name:    "frontmatter",
+	summary: "validate every post's front matter against the schema",
+	run:     runLintFrontmatter,
+}
+
+// runLintFrontmatter checks every post file, drafts included, and reports
+// all violations at once as path:line: field: message rather than stopping
+// at the first file that doesn't parse.
+func runLintFrontmatter(ctx context.Context, args []string) error {
+	fs := newFlags("lint frontmatter", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	paths, err := content.Files(*dir)
+	if err != nil {
+		return err
+	}
+	var (
+		files    []*frontmatter.File
+		problems []frontmatter.Problem
+	)
+	for _, rel := range paths {
+		b, err := os.ReadFile(filepath.Join(*dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		f, ps := frontmatter.Check(rel, b)
+		problems = append(problems, ps...)
+		if f != nil {
+			files = append(files, f)
+		}
+	}
+	problems = append(problems, frontmatter.CheckSite(files)...)
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Path != problems[j].Path {
+			return problems[i].Path < problems[j].Path
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	for _, p := range problems {
+		p.Path = filepath.ToSlash(filepath.Join(*dir, p.Path))
+		fmt.Println(p)
+	}
+	log.Printf("%d file(s) checked", len(paths))
+	if len(problems) > 0 {
+		return fmt.Errorf("%d front matter problem(s)", len(problems))
+	}
+	return nil
+}
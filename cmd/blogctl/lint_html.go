@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rednafi/rednafi.com/internal/htmlcheck"
+)
+
+var lintHTMLCmd = &command{
+	name:    "html",
+	summary: "validate the built pages' markup and metadata",
+	run:     runLintHTML,
+}
+
+// runLintHTML checks every page Hugo generated, after the build, and
+// reports problems as path:line: rule: message followed by a table of how
+// many pages break each rule. It fails if there are any. The rules are
+// structure, duplicate-id, canonical, og, twitter, description, and h1.
+func runLintHTML(ctx context.Context, args []string) error {
+	fs := newFlags("lint html", "")
+	public := fs.String("public", "public", "Hugo's output directory")
+	rules := fs.String("rules", "", "comma-separated rules to report (default: all)")
+	opts := htmlcheck.DefaultOptions
+	fs.IntVar(&opts.MinDescription, "min-description", opts.MinDescription, "shortest description, in characters")
+	fs.IntVar(&opts.MaxDescription, "max-description", opts.MaxDescription, "longest description, in characters")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	only := htmlcheck.Rules
+	if *rules != "" {
+		only = strings.Split(*rules, ",")
+	}
+
+	type tally struct{ pages, problems int }
+	counts := map[string]*tally{}
+	var pages, failed int
+	err := filepath.WalkDir(*public, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".html" {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if htmlcheck.Redirect(b) {
+			return nil
+		}
+		rel, err := filepath.Rel(*public, p)
+		if err != nil {
+			return err
+		}
+		u := "/" + filepath.ToSlash(rel)
+		if path.Base(u) == "index.html" {
+			u = strings.TrimSuffix(u, "index.html")
+		}
+		problems, err := htmlcheck.Check(bytes.NewReader(b), u, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		pages++
+		seen := map[string]bool{}
+		for _, pr := range problems {
+			if !slices.Contains(only, pr.Rule) {
+				continue
+			}
+			fmt.Printf("%s:%s\n", filepath.ToSlash(p), pr)
+			if counts[pr.Rule] == nil {
+				counts[pr.Rule] = &tally{}
+			}
+			counts[pr.Rule].problems++
+			if !seen[pr.Rule] {
+				counts[pr.Rule].pages++
+			}
+			seen[pr.Rule] = true
+		}
+		if len(seen) > 0 {
+			failed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%d page(s) checked", pages)
+	if failed == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nRULE\tPAGES\tPROBLEMS")
+	for _, r := range htmlcheck.Rules {
+		if c := counts[r]; c != nil {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", r, c.pages, c.problems)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d of %d page(s) have problems", failed, pages)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/budget"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/imgcheck"
+	"github.com/rednafi/rednafi.com/internal/imgopt"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/telemetry"
+)
+
+var lintImagesCmd = &command{
+	name:    "images",
+	summary: "find missing, oversized, and orphaned images",
+	run:     runLintImages,
+}
+
+// runLintImages checks every image the posts show: that the file exists,
+// that it's within the byte and pixel budgets, and that a raster image
+// under static/ is shown through the img shortcode with the variants
+// cmd/imgopt makes. It also lists the images under static/images/ that
+// no post shows and no template or config mentions. Remote images are
+// only checked with -remote.
+func runLintImages(ctx context.Context, args []string) error {
+	fs := newFlags("lint images", "[post ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	static := fs.String("static", "static", "static directory")
+	images := fs.String("images", "images", "source images, relative to -static, to look for orphans in")
+	skip := fs.String("skip", "opt,og", "comma-separated generated directories under -images")
+	manifest := fs.String("manifest", imgopt.DefaultManifest, "cmd/imgopt's manifest")
+	budgets := fs.String("budgets", budget.DefaultConfig, "budgets file whose default image budget caps the bytes")
+	maxBytes := fs.Int64("max-bytes", 0, "bytes an image may take (default: the image budget in -budgets)")
+	maxWidth := fs.Int("max-width", 3200, "pixels wide an image may be, 0 for any")
+	maxHeight := fs.Int("max-height", 3200, "pixels high an image may be, 0 for any")
+	remote := fs.Bool("remote", false, "fetch remote images to check them too")
+	timeout := fs.Duration("timeout", 15*time.Second, "timeout per remote image")
+	jobs := fs.Int("j", 8, "remote images to fetch at once")
+	drafts := fs.Bool("drafts", false, "check drafts too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	if !*drafts {
+		posts = content.Published(posts)
+	}
+	checked, err := selectPosts(posts, fs.Args(), *dir)
+	if err != nil {
+		return err
+	}
+	m, err := imgopt.Load(*manifest)
+	if err != nil {
+		return err
+	}
+	if *maxBytes == 0 {
+		cfg, err := budget.Load(*budgets)
+		if err != nil {
+			return err
+		}
+		*maxBytes = cfg.Default.Image
+	}
+	o := imgcheck.Options{
+		Static:   *static,
+		Content:  *dir,
+		Budget:   imgcheck.Budget{Bytes: *maxBytes, Width: *maxWidth, Height: *maxHeight},
+		Manifest: m,
+		Jobs:     *jobs,
+	}
+	if *remote {
+		o.HTTP = &http.Client{Timeout: *timeout}
+	}
+
+	var refs []imgcheck.Ref
+	for _, p := range checked {
+		refs = append(refs, imgcheck.Refs(p)...)
+	}
+	_, timer := telemetry.Start(ctx, "check")
+	problems := imgcheck.Check(ctx, refs, o)
+	timer.End(nil)
+	// Orphans are only orphans when every post is looked at.
+	if len(fs.Args()) == 0 {
+		var all []imgcheck.Ref
+		for _, p := range posts {
+			all = append(all, imgcheck.Refs(p)...)
+		}
+		_, timer := telemetry.Start(ctx, "orphans")
+		orphans, err := imgcheck.Orphans(*images, strings.Split(*skip, ","), all, o, []string{"layouts", "assets", site.ConfigPath})
+		timer.End(err)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, orphans...)
+	}
+	for _, p := range problems {
+		if p.Line > 0 {
+			p.Path = *dir + "/" + p.Path
+		}
+		fmt.Println(p)
+	}
+	log.Printf("%d image reference(s) in %d post(s) checked", len(refs), len(checked))
+	if len(problems) > 0 {
+		return fmt.Errorf("%d image problem(s)", len(problems))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/prose"
+)
+
+var lintProseCmd = &command{
+	name:    "prose",
+	summary: "flag long sentences, filler, weasel words, repeats, and passive voice",
+	run:     runLintProse,
+}
+
+// runLintProse lints the prose of every post, or the named ones, and lists
+// the findings under each post's path as line:col, rule, and message. It
+// fails if there are any. The rules are passive-voice, weasel-words,
+// repeated-word, sentence-length, and filler; data/prose.toml tunes them.
+func runLintProse(ctx context.Context, args []string) error {
+	fs := newFlags("lint prose", "[post ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	configPath := fs.String("config", prose.DefaultConfig, "rule settings")
+	drafts := fs.Bool("drafts", false, "check drafts too")
+	rules := fs.String("rules", "", "comma-separated rules to report (default: all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := prose.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	if !*drafts {
+		posts = content.Published(posts)
+	}
+	posts, err = selectPosts(posts, fs.Args(), *dir)
+	if err != nil {
+		return err
+	}
+	var only []string
+	if *rules != "" {
+		only = strings.Split(*rules, ",")
+	}
+
+	l := prose.NewLinter(cfg)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	var n int
+	for _, p := range posts {
+		problems, err := l.Post(p)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", *dir, p.Path, err)
+		}
+		problems = slices.DeleteFunc(problems, func(pr prose.Problem) bool {
+			return only != nil && !slices.Contains(only, pr.Rule)
+		})
+		if len(problems) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s/%s\n", *dir, p.Path)
+		for _, pr := range problems {
+			fmt.Fprintf(w, "  %d:%d\t%s\t%s\n", pr.Line, pr.Col, pr.Rule, pr.Msg)
+		}
+		fmt.Fprintln(w)
+		n += len(problems)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	log.Printf("%d post(s) checked", len(posts))
+	if n > 0 {
+		return fmt.Errorf("%d prose problem(s)", n)
+	}
+	return nil
+}
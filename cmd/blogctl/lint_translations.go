@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/gitmeta"
+	"github.com/rednafi/rednafi.com/internal/i18n"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var lintTranslationsCmd = &command{
+	name:    "translations",
+	summary: "check translations for unknown languages, missing originals, and drift",
+	run:     runLintTranslations,
+}
+
+// runLintTranslations reports the translations in a language config.yml
+// doesn't list, without an original in the default language, doubled up,
+// or more than -days behind their original's last change. Dates come from
+// data/gitmeta.json when `blogctl gitmeta` has run, and from lastmod
+// otherwise.
+func runLintTranslations(ctx context.Context, args []string) error {
+	fs := newFlags("lint translations", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	history := fs.String("gitmeta", gitmeta.DefaultPath, "post history from blogctl gitmeta")
+	days := fs.Int("days", int(i18n.DefaultMaxLag/(24*time.Hour)), "days a translation may fall behind its original")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	meta, err := gitmeta.Load(*history)
+	if err != nil {
+		return err
+	}
+	gitmeta.Apply(posts, meta)
+
+	problems := i18n.Check(cfg, posts, time.Duration(*days)*24*time.Hour)
+	for _, p := range problems {
+		if p.Path == site.ConfigPath {
+			p.Path = *config
+		} else {
+			p.Path = filepath.ToSlash(filepath.Join(*dir, p.Path))
+		}
+		fmt.Println(p)
+	}
+	log.Printf("%d translation group(s) checked", len(i18n.Groups(posts)))
+	if len(problems) > 0 {
+		return fmt.Errorf("%d translation problem(s)", len(problems))
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/htmlcheck"
+	"github.com/rednafi/rednafi.com/internal/redirects"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/urlcheck"
+)
+
+var lintURLsCmd = &command{
+	name:    "urls",
+	summary: "check canonical links, hardcoded site URLs, and trailing slashes",
+	run:     runLintURLs,
+}
+
+// runLintURLs checks that the posts link to the site's own pages by path,
+// not by https://rednafi.com, at the path the page is served at rather
+// than an alias or redirect, and with the trailing slash. With -fix the
+// links are rewritten in place; review the diff before committing. When
+// the site is built, it also checks that each page's canonical link is
+// the URL the page is served at.
+func runLintURLs(ctx context.Context, args []string) error {
+	fs := newFlags("lint urls", "[post ...]")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	public := fs.String("public", "public", "Hugo's output directory, skipped if it doesn't exist")
+	redirectMap := fs.String("redirects", redirects.DefaultPath, "redirect map")
+	rules := fs.String("rules", "", "comma-separated rules to report (default: all)")
+	fix := fs.Bool("fix", false, "rewrite the links in the posts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	only := urlcheck.Rules
+	if *rules != "" {
+		only = strings.Split(*rules, ",")
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	all, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	rs, err := redirects.Load(*redirectMap)
+	if err != nil {
+		return err
+	}
+	s, err := urlcheck.NewSite(cfg.BaseURL, all, rs)
+	if err != nil {
+		return err
+	}
+	posts, err := selectPosts(all, fs.Args(), *dir)
+	if err != nil {
+		return err
+	}
+
+	var problems, fixed int
+	report := func(p urlcheck.Problem) {
+		problems++
+		fmt.Println(p)
+	}
+
+	for _, p := range posts {
+		file := filepath.Join(*dir, filepath.FromSlash(p.Path))
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var found []urlcheck.Problem
+		for _, pr := range s.Links(p, b) {
+			if slices.Contains(only, pr.Rule) {
+				found = append(found, pr)
+			}
+		}
+		for _, pr := range found {
+			pr.Path = filepath.ToSlash(file)
+			report(pr)
+		}
+		if !*fix || len(found) == 0 {
+			continue
+		}
+		head, ok := strings.CutSuffix(string(b), p.Body)
+		if !ok {
+			return fmt.Errorf("%s changed while reading it", file)
+		}
+		body, n := urlcheck.Fix(p.Body, p.BodyLine, found)
+		out := []byte(head + body)
+		for _, pr := range found {
+			if pr.Line < p.BodyLine {
+				if out, err = content.SetString(out, "url", pr.Fix); err != nil {
+					return fmt.Errorf("%s: %w", file, err)
+				}
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if err := os.WriteFile(file, out, 0o644); err != nil {
+			return err
+		}
+		fixed += n
+	}
+	log.Printf("%d post(s) checked", len(posts))
+
+	if slices.Contains(only, urlcheck.RuleCanonical) && len(fs.Args()) == 0 {
+		pages, err := lintCanonical(*public, cfg, all)
+		if err != nil {
+			return err
+		}
+		for _, p := range pages {
+			report(p)
+		}
+	}
+
+	if *fix {
+		log.Printf("%d link(s) fixed", fixed)
+		problems -= fixed
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d URL problem(s)", problems)
+	}
+	return nil
+}
+
+// lintCanonical checks the canonical link of every page under public
+// against the URL it's served at, or the canonicalURL a post sets to
+// point at its original elsewhere.
+func lintCanonical(public string, cfg *site.Config, posts []*content.Post) ([]urlcheck.Problem, error) {
+	if _, err := os.Stat(public); os.IsNotExist(err) {
+		log.Printf("no built site at %s; skipping canonical links", public)
+		return nil, nil
+	}
+	elsewhere := map[string]string{}
+	for _, p := range posts {
+		if c, ok := p.Params["canonicalurl"].(string); ok && strings.TrimSpace(c) != "" {
+			elsewhere[p.RelPermalink()] = strings.TrimSpace(c)
+		}
+	}
+	var problems []urlcheck.Problem
+	var pages int
+	err := filepath.WalkDir(public, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".html" {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if htmlcheck.Redirect(b) {
+			return nil
+		}
+		rel, err := filepath.Rel(public, p)
+		if err != nil {
+			return err
+		}
+		u := "/" + filepath.ToSlash(rel)
+		if path.Base(u) == "index.html" {
+			u = strings.TrimSuffix(u, "index.html")
+		}
+		want := cfg.Permalink(u)
+		if c, ok := elsewhere[u]; ok {
+			want = c
+		}
+		found, err := urlcheck.Canonical(bytes.NewReader(b), filepath.ToSlash(p), want)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		pages++
+		problems = append(problems, found...)
+		return nil
+	})
+	log.Printf("%d page(s) checked", pages)
+	return problems, err
+}
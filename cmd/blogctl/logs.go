@@ -0,0 +1,9 @@
+package main
+
+var logsCmd = &command{
+	name:    "logs",
+	summary: "analyze the site's request logs",
+	run: group("blogctl logs", []*command{
+		logs404Cmd,
+	}),
+}
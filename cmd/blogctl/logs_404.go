@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/cloudflare"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/redirects"
+)
+
+var logs404Cmd = &command{
+	name:    "404",
+	summary: "propose redirects for the paths visitors get 404s on",
+	run:     runLogs404,
+}
+
+// scannerPaths are 404s from vulnerability scanners rather than people
+// following a broken link.
+const scannerPaths = `(?i)\.(php|aspx?|jsp|cgi|env|ini|sql|bak)$|^/(wp-|wordpress|xmlrpc|\.git|\.env|cgi-bin|admin|phpmyadmin)`
+
+// runLogs404 pulls the 404s of the last -days from Cloudflare's GraphQL
+// Analytics API, clusters the paths, and prints the ones that match a post
+// as [[redirect]] entries ready to paste into data/redirects.toml. Paths
+// that match nothing are listed as comments.
+//
+// It needs CLOUDFLARE_API_TOKEN, with the Analytics Read permission, and
+// CLOUDFLARE_ZONE_ID.
+func runLogs404(ctx context.Context, args []string) error {
+	fs := newFlags("logs 404", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", redirects.DefaultPath, "redirect map; paths already in it are skipped")
+	days := fs.Int("days", 7, "days of logs to read")
+	limit := fs.Int("limit", 1000, "distinct paths to fetch per day")
+	minScore := fs.Float64("min", 0.6, "minimum match score, 0-1, to propose a redirect")
+	minHits := fs.Int("hits", 2, "ignore paths with fewer 404s than this")
+	ignore := fs.String("ignore", scannerPaths, "regexp of paths to ignore")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ignoreRe, err := regexp.Compile(*ignore)
+	if err != nil {
+		return fmt.Errorf("-ignore: %w", err)
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	existing, err := redirects.Load(*data)
+	if err != nil {
+		return err
+	}
+	pages, err := redirects.Pages(*dir, posts)
+	if err != nil {
+		return err
+	}
+	cf, err := cloudflare.New(cloudflare.ConfigFromEnv(), "zone")
+	if err != nil {
+		return err
+	}
+	until := time.Now().UTC().Truncate(time.Hour)
+	counts, err := cf.NotFound(ctx, until.AddDate(0, 0, -*days), until, *limit)
+	if err != nil {
+		return err
+	}
+
+	var hits []redirects.Hit
+	for _, c := range counts {
+		if c.Count >= *minHits && !ignoreRe.MatchString(c.Path) {
+			hits = append(hits, redirects.Hit{Path: c.Path, Count: c.Count})
+		}
+	}
+	proposals := redirects.Propose(hits, posts, existing, pages, *minScore)
+
+	var matched int
+	var unmatched []redirects.Proposal
+	for _, p := range proposals {
+		if p.To == "" {
+			unmatched = append(unmatched, p)
+			continue
+		}
+		matched++
+		fmt.Printf("# %d hit(s), score %.2f: %s\n", p.Count, p.Score, p.Title)
+		for _, from := range append([]string{p.From}, p.Variants...) {
+			fmt.Printf("[[redirect]]\nfrom = %q\nto = %q\n\n", from, p.To)
+		}
+	}
+	if len(unmatched) > 0 {
+		fmt.Println("# No matching post:")
+		for _, p := range unmatched {
+			fmt.Printf("#   %s (%d hit(s))", p.From, p.Count)
+			if len(p.Variants) > 0 {
+				fmt.Printf(", also %s", strings.Join(p.Variants, ", "))
+			}
+			fmt.Println()
+		}
+	}
+	log.Printf("%d 404 path(s) in %d day(s), %d cluster(s), %d matched", len(counts), *days, len(proposals), matched)
+	return nil
+}
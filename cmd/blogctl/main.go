@@ -0,0 +1,194 @@
+// Command blogctl bundles the site's maintenance tasks behind subcommands.
+//
+// Usage:
+//
+//	blogctl <command> [flags] [args]
+//
+// Run "blogctl help" for the list of commands and "blogctl <command> -h" for
+// a command's flags.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/telemetry"
+)
+
+// command is a blogctl subcommand. run receives the arguments following the
+// command name.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+func commands() []*command {
+	return []*command{
+		abCmd,
+		announceCmd,
+		apiCmd,
+		apCmd,
+		archiveCmd,
+		askEvalCmd,
+		benchCmd,
+		budgetCmd,
+		buildCmd,
+		bundlesCmd,
+		citeCmd,
+		commentsCmd,
+		criticalCmd,
+		cspCmd,
+		deployCmd,
+		diagramsCmd,
+		embedCmd,
+		exportCmd,
+		feedsCmd,
+		fingerprintCmd,
+		ghembedCmd,
+		gitmetaCmd,
+		headersCmd,
+		highlightCmd,
+		iconsCmd,
+		importCmd,
+		indexCmd,
+		kudosCmd,
+		lintCmd,
+		logsCmd,
+		mathCmd,
+		minifyCmd,
+		newCmd,
+		noteCmd,
+		nowCmd,
+		playgroundCmd,
+		pluginsCmd,
+		podcastCmd,
+		postArchiveCmd,
+		previewCmd,
+		projectsCmd,
+		readtimeCmd,
+		redirectsCmd,
+		relatedCmd,
+		reviewCmd,
+		robotsCmd,
+		rollbackCmd,
+		schemaCmd,
+		seriesCmd,
+		serveCmd,
+		shortenCmd,
+		sidenotesCmd,
+		sitemapCmd,
+		snippetsCmd,
+		spellCmd,
+		statsCmd,
+		suggestLinksCmd,
+		summarizeCmd,
+		swCmd,
+		syndicateCmd,
+		tagsCmd,
+		threadCmd,
+		tocCmd,
+		traceCmd,
+		ttsCmd,
+		viewsCmd,
+		webmentionCmd,
+		wellknownCmd,
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("blogctl: ")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// With $BLOGCTL_TRACE set, every command is timed as a stage of the
+	// build, except `blogctl trace` and `blogctl build`, which time the stages
+	// they run themselves.
+	ctx = telemetry.WithRecorder(ctx, telemetry.FromEnv())
+	timer := &telemetry.Timer{}
+	if args := os.Args[1:]; len(args) > 0 && args[0] != traceCmd.name && args[0] != buildCmd.name {
+		ctx, timer = telemetry.Start(ctx, stageName(args))
+	}
+	err := dispatch(ctx, "blogctl", commands(), os.Args[1:])
+	if terr := timer.End(err); terr != nil {
+		log.Print(terr)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// dispatch runs the command in cmds named by args[0]. It's used both for
+// the top-level commands and for command groups like "blogctl lint".
+func dispatch(ctx context.Context, prog string, cmds []*command, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(prog, cmds)
+		return flag.ErrHelp
+	}
+	for _, c := range cmds {
+		if c.name == args[0] {
+			return c.run(ctx, args[1:])
+		}
+	}
+	usage(prog, cmds)
+	return fmt.Errorf("unknown command %q", strings.TrimSpace(prog+" "+args[0]))
+}
+
+func usage(prog string, cmds []*command) {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags] [args]\n\ncommands:\n", prog)
+	for _, c := range cmds {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.summary)
+	}
+}
+
+// group returns a run func that dispatches to subcommands, for commands
+// like "blogctl lint <check>".
+func group(prog string, cmds []*command) func(context.Context, []string) error {
+	groups[prog] = cmds
+	return func(ctx context.Context, args []string) error {
+		return dispatch(ctx, prog, cmds, args)
+	}
+}
+
+// groups are the subcommands of each command group, by its prog.
+var groups = map[string][]*command{}
+
+// stageName names the command args run, like "blogctl lint images",
+// leaving out its flags and arguments.
+func stageName(args []string) string {
+	name, cmds := "blogctl", commands()
+	for _, a := range args {
+		i := slices.IndexFunc(cmds, func(c *command) bool { return c.name == a })
+		if i < 0 {
+			break
+		}
+		name += " " + a
+		if cmds = groups[name]; cmds == nil {
+			break
+		}
+	}
+	return name
+}
+
+// newFlags returns a flag set for a subcommand that reports parse errors
+// instead of exiting.
+func newFlags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: blogctl %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/math"
+)
+
+var mathCmd = &command{
+	name:    "math",
+	summary: "render the built posts' TeX to MathML",
+	run:     runMath,
+}
+
+// runMath renders the $...$ and $$...$$ math in each published post's page
+// under the built site, after Hugo has run. Expressions KaTeX rejects and
+// pages whose dollar signs can't be matched up with the post's fail the
+// command once every page has been tried.
+func runMath(ctx context.Context, args []string) error {
+	fs := newFlags("math", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	public := fs.String("public", "public", "built site to rewrite")
+	cache := fs.String("cache", math.DefaultCache, "rendered expression cache")
+	katex := fs.String("katex", strings.Join(math.DefaultKaTeX, " "), "KaTeX CLI command")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	r, err := math.LoadRenderer(strings.Fields(*katex), *cache)
+	if err != nil {
+		return err
+	}
+	var pages, exprs, failed int
+	for _, p := range content.Published(posts) {
+		toks := math.Scan([]byte(p.Body))
+		exs := math.Exprs(toks)
+		if len(exs) == 0 {
+			continue
+		}
+		mathml, err := r.RenderAll(ctx, exs)
+		if err != nil {
+			log.Printf("%s: %v", p.Path, err)
+			failed++
+			continue
+		}
+		path := filepath.Join(*public, filepath.FromSlash(p.RelPermalink()), "index.html")
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("%s: not built; skipping", p.Path)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		out, err := math.RewritePage(b, toks, mathml)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			failed++
+			continue
+		}
+		if bytes.Equal(out, b) {
+			continue
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+		pages++
+		exprs += len(mathml)
+	}
+	if err := r.Save(*cache); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d page(s) with math that couldn't be rendered", failed)
+	}
+	log.Printf("%d expression(s) in %d page(s)", exprs, pages)
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rednafi/rednafi.com/internal/minify"
+)
+
+var minifyCmd = &command{
+	name:    "minify",
+	summary: "minify the built site and report its weight by file type",
+	run:     runMinify,
+}
+
+// runMinify minifies the built site in place, last among the commands
+// that rewrite it but before `blogctl csp` hashes the inline code, and
+// prints its weight by type. Fingerprinted files only count toward the
+// weight; Hugo minified the theme's assets before hashing them. The report
+// is saved to -report, and the next run prints the change in compressed
+// size from it, so a build that adds weight says by how much. XML is off
+// by default, as it is in config.yml, since feed readers are less
+// forgiving than browsers.
+func runMinify(ctx context.Context, args []string) error {
+	fs := newFlags("minify", "")
+	public := fs.String("public", "public", "built site to minify")
+	reportPath := fs.String("report", ".minify-report.json", "weight report to compare with and save; empty to skip")
+	toggles := map[string]*bool{}
+	for _, t := range []struct {
+		name string
+		on   bool
+	}{{"html", true}, {"css", true}, {"js", true}, {"svg", true}, {"json", true}, {"xml", false}} {
+		toggles[t.name] = fs.Bool(t.name, t.on, "minify "+t.name+" files")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts := minify.Options{}
+	for name, on := range toggles {
+		opts[name] = *on
+	}
+
+	var prev *minify.Report
+	if *reportPath != "" {
+		var err error
+		if prev, err = minify.LoadReport(*reportPath); err != nil {
+			return err
+		}
+	}
+	rep, err := minify.Run(*public, minify.New(opts))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TYPE\tFILES\tBEFORE\tAFTER\tGZIP\tBROTLI\tCHANGE\t")
+	row := func(name string, s, old *minify.Size) {
+		change := ""
+		if old != nil {
+			change = fmt.Sprintf("%+d", s.Brotli-old.Brotli)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t\n", name, s.Files, s.Before, s.After, s.Gzip, s.Brotli, change)
+	}
+	for _, t := range rep.Names() {
+		var old *minify.Size
+		if prev != nil {
+			old = prev.Types[t]
+		}
+		row(t, rep.Types[t], old)
+	}
+	var old *minify.Size
+	if prev != nil {
+		old = &prev.Total
+	}
+	row("total", &rep.Total, old)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	log.Printf("minified %d file(s), %d bytes saved", rep.Minified, rep.Total.Before-rep.Total.After)
+	if *reportPath != "" {
+		return rep.Save(*reportPath)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+var newCmd = &command{
+	name:    "new",
+	summary: "scaffold a draft post from a title",
+	run:     runNew,
+}
+
+// runNew creates content/<section>/<date>-<slug>.md as a draft, with the
+// front matter rendered from the template and tags guessed from the title.
+// It refuses to create a post whose slug another post already has.
+func runNew(ctx context.Context, args []string) error {
+	fs := newFlags("new", `"Title"`)
+	dir := fs.String("content", content.Dir, "content directory")
+	section := fs.String("section", "misc", "section to create the post in")
+	slug := fs.String("slug", "", "slug (default: derived from the title)")
+	date := fs.String("date", time.Now().Format(time.DateOnly), "publication date, YYYY-MM-DD")
+	tmpl := fs.String("template", newpost.DefaultTemplate, "front matter template")
+	aliasesPath := fs.String("aliases", tags.DefaultAliases, "tag alias map")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	title := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if title == "" {
+		fs.Usage()
+		return errors.New("new: missing title")
+	}
+	d, err := time.Parse(time.DateOnly, *date)
+	if err != nil {
+		return fmt.Errorf("-date: %w", err)
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	aliases, err := tags.LoadAliases(*aliasesPath)
+	if err != nil {
+		return err
+	}
+	p := newpost.Post{
+		Title:   title,
+		Date:    d,
+		Slug:    *slug,
+		Section: *section,
+		Tags:    newpost.SuggestTags(title, posts, aliases),
+	}
+	if p.Slug == "" {
+		p.Slug = newpost.Slugify(title)
+	}
+	if p.Slug == "" {
+		return fmt.Errorf("can't derive a slug from %q; pass -slug", title)
+	}
+	for _, other := range posts {
+		if other.Slug == p.Slug {
+			return fmt.Errorf("slug %q is taken by %s/%s", p.Slug, *dir, other.Path)
+		}
+	}
+
+	b, err := newpost.Render(*tmpl, p)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(*dir, filepath.FromSlash(p.Path()))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Println(path)
+	if len(p.Tags) == 0 {
+		log.Print("no tags matched the title; add some before publishing")
+	}
+	return nil
+}
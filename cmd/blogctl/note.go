@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/notes"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/syndicate"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+var noteCmd = &command{
+	name:    "note",
+	summary: "write a note, optionally cross-posting it to Bluesky and Mastodon",
+	run:     runNote,
+}
+
+// runNote creates content/notes/<date>-<hhmm>.md from the arguments, or
+// from stdin when the only argument is "-". With -syndicate the note is
+// also posted to the announce targets, text first and then its permalink,
+// and recorded in data/syndication.json; the link works once the site is
+// deployed.
+func runNote(ctx context.Context, args []string) error {
+	fs := newFlags("note", `"text" | -`)
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	tagList := fs.String("tags", "", "comma-separated tags")
+	aliasesPath := fs.String("aliases", tags.DefaultAliases, "tag alias map")
+	draft := fs.Bool("draft", false, "create the note as a draft")
+	syndicateTo := fs.Bool("syndicate", false, "cross-post the note to the announce targets")
+	only := fs.String("targets", "", "comma-separated targets to cross-post to (default: all configured)")
+	data := fs.String("data", syndicate.DefaultPath, "announcement record")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	text := strings.Join(fs.Args(), " ")
+	if text == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+	if strings.TrimSpace(text) == "" {
+		fs.Usage()
+		return errors.New("note: missing text")
+	}
+	if *draft && *syndicateTo {
+		return errors.New("note: a draft can't be cross-posted")
+	}
+
+	aliases, err := tags.LoadAliases(*aliasesPath)
+	if err != nil {
+		return err
+	}
+	var ts []string
+	for _, t := range strings.Split(*tagList, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			ts = append(ts, t)
+		}
+	}
+	n := notes.Note{Date: time.Now(), Tags: aliases.Normalize(ts), Draft: *draft, Body: text}
+	b, err := n.Render()
+	if err != nil {
+		return err
+	}
+	// Check the targets before the note exists, so a typo doesn't leave
+	// a note that was never cross-posted.
+	var targets []syndicate.Target
+	if *syndicateTo {
+		if targets, err = announceTargets(*only); err != nil {
+			return err
+		}
+		if len(targets) == 0 {
+			return errors.New("no targets configured; set the Bluesky or Mastodon credentials")
+		}
+	}
+
+	path := filepath.Join(*dir, filepath.FromSlash(n.Path()))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s exists; a minute holds one note", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Println(path)
+	if !*syndicateTo {
+		return nil
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	p, err := content.Parse(n.Path(), b)
+	if err != nil {
+		return err
+	}
+	store, err := syndicate.Load(*data)
+	if err != nil {
+		return err
+	}
+	// Bluesky cuts the text to fit; Mastodon's limit is 500 with the link
+	// and tags.
+	a := syndicate.Announcement{
+		Title: syndicate.Truncate(notes.Text(p), 400),
+		URL:   cfg.Permalink(p.RelPermalink()),
+		Tags:  p.Tags,
+	}
+	for _, t := range targets {
+		r, err := t.Post(ctx, a)
+		if err != nil {
+			return fmt.Errorf("%s on %s: %w", p.Path, t.Name(), err)
+		}
+		store.Record(p.RelPermalink(), t.Name(), r)
+		if err := store.Save(*data); err != nil {
+			return err
+		}
+		fmt.Printf("%s -> %s\n", a.URL, r.URL)
+	}
+	return nil
+}
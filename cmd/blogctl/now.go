@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/integrations"
+)
+
+var nowCmd = &command{
+	name:    "now",
+	summary: "build the /now page from GitHub, Last.fm, and the books I'm reading",
+	run:     runNow,
+}
+
+// runNow writes the sections the now layout reads as site.Data.now. Sources
+// fetched within the TTL are served from the cache; a source that fails
+// keeps its cached items and is only reported, so an outage never breaks
+// the build.
+func runNow(ctx context.Context, args []string) error {
+	fs := newFlags("now", "")
+	config := fs.String("config", integrations.DefaultConfig, "integrations config file")
+	cachePath := fs.String("cache", integrations.DefaultCache, "file to cache the sources' items in")
+	out := fs.String("out", integrations.DefaultPath, "file to write")
+	refresh := fs.Bool("refresh", false, "call every source, however fresh its cached items")
+	timeout := fs.Duration("timeout", 20*time.Second, "per-request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := integrations.LoadConfig(*config)
+	if err != nil {
+		return err
+	}
+	srcs, err := cfg.Sources()
+	if err != nil {
+		return err
+	}
+	ttl := cfg.TTL
+	if *refresh {
+		ttl = 0
+	}
+	cache := integrations.LoadCache(*cachePath)
+	sections, err := integrations.Gather(ctx, &http.Client{Timeout: *timeout}, srcs, cache, ttl, time.Now())
+	if err != nil {
+		log.Print(err)
+	}
+	if err := cache.Save(*cachePath); err != nil {
+		return err
+	}
+	written, err := integrations.Write(*out, sections)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d of %d source(s) on the page", len(sections), len(srcs))
+	return nil
+}
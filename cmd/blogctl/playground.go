@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/highlight"
+	"github.com/rednafi/rednafi.com/internal/playground"
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+var playgroundCmd = &command{
+	name:    "playground",
+	summary: "share runnable Go snippets on the Go Playground",
+	run:     runPlayground,
+}
+
+// runPlayground uploads every complete Go program in the posts to the
+// Playground and records the share IDs in data/playground.json, keyed by
+// the code's hash. The render-codeblock hook adds a "Run this on the
+// Playground" link under each block it finds there. Snippets that are
+// already shared aren't uploaded again, and entries for code that no
+// longer appears in any post are dropped.
+func runPlayground(ctx context.Context, args []string) error {
+	fs := newFlags("playground", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", playground.DefaultPath, "share ID record")
+	dryRun := fs.Bool("dry-run", false, "list the snippets that would be uploaded")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	old, err := playground.Load(*data)
+	if err != nil {
+		return err
+	}
+
+	shares := playground.Shares{}
+	var (
+		client   playground.Client
+		uploaded int
+		shareErr error
+	)
+	for _, p := range content.Published(posts) {
+		for _, b := range snippet.Extract(p) {
+			if !playground.Shareable(b) {
+				continue
+			}
+			h := highlight.Hash(b.Code)
+			if id, ok := old[h]; ok {
+				shares[h] = id
+				continue
+			}
+			if _, ok := shares[h]; ok || shareErr != nil {
+				continue
+			}
+			if *dryRun {
+				fmt.Printf("%s:%d\n", p.Path, b.Line)
+				continue
+			}
+			id, err := client.Share(ctx, b.Code)
+			if err != nil {
+				// Keep what was shared so far; the rest is retried next run.
+				shareErr = fmt.Errorf("%s:%d: %w", p.Path, b.Line, err)
+				continue
+			}
+			shares[h] = id
+			uploaded++
+			fmt.Printf("%s:%d -> %s\n", p.Path, b.Line, playground.URL(id))
+		}
+	}
+	if *dryRun {
+		return nil
+	}
+	if shareErr != nil {
+		// Don't prune on a partial run.
+		for h, id := range old {
+			if _, ok := shares[h]; !ok {
+				shares[h] = id
+			}
+		}
+	}
+	var dropped int
+	for h := range old {
+		if _, ok := shares[h]; !ok {
+			dropped++
+		}
+	}
+	if err := shares.Save(*data); err != nil {
+		return err
+	}
+	log.Printf("%d snippet(s) shared, %d uploaded, %d dropped", len(shares), uploaded, dropped)
+	return shareErr
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/plugin"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var pluginsCmd = &command{
+	name:    "plugins",
+	summary: "run the build steps data/plugins.toml declares",
+	run: group("blogctl plugins", []*command{
+		pluginsEmitCmd,
+		pluginsListCmd,
+		pluginsTransformCmd,
+	}),
+}
+
+var pluginsListCmd = &command{
+	name:    "list",
+	summary: "list the declared and built-in plugins",
+	run:     runPluginsList,
+}
+
+// runPluginsList lists the plugins -config declares, in the order they
+// run, then the builtins it leaves out.
+func runPluginsList(ctx context.Context, args []string) error {
+	fs := newFlags("plugins list", "")
+	configPath := fs.String("config", plugin.DefaultConfig, "plugins to run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := plugin.Load(*configPath)
+	if err != nil {
+		return err
+	}
+
+	declared := map[string]bool{}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLUGIN\tKIND\tSTATE")
+	for _, s := range cfg.Plugins {
+		declared[s.Name] = true
+		kind, state := "builtin", "enabled"
+		if s.Command != "" {
+			phases := s.Phases
+			if len(phases) == 0 {
+				phases = []string{"emit"}
+			}
+			kind = fmt.Sprintf("command: %s (%s)", s.Command, strings.Join(phases, ", "))
+		}
+		if s.Disabled {
+			state = "disabled"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, kind, state)
+	}
+	for _, name := range slices.Sorted(maps.Keys(plugin.Builtins)) {
+		if !declared[name] {
+			fmt.Fprintf(tw, "%s\tbuiltin\tnot declared\n", name)
+		}
+	}
+	return tw.Flush()
+}
+
+var pluginsEmitCmd = &command{
+	name:    "emit",
+	summary: "write the files the plugins emit, before Hugo runs",
+	run:     runPluginsEmit,
+}
+
+// runPluginsEmit loads the site, has every plugin collect from it, and
+// writes the files they emit, like data/related.json and the Open Graph
+// cards, printing the ones that changed.
+func runPluginsEmit(ctx context.Context, args []string) error {
+	fs := newFlags("plugins emit", "")
+	configPath := fs.String("config", plugin.DefaultConfig, "plugins to run")
+	siteConfig := fs.String("site", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	plugins, s, err := openPlugins(ctx, *configPath, *siteConfig, *dir, "")
+	if err != nil {
+		return err
+	}
+	written, err := plugin.Emit(ctx, plugins, s, ".")
+	for _, path := range written {
+		fmt.Println(path)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%d plugin(s), %d file(s) written", len(plugins), len(written))
+	return nil
+}
+
+var pluginsTransformCmd = &command{
+	name:    "transform",
+	summary: "pass the built pages through the plugins, after Hugo runs",
+	run:     runPluginsTransform,
+}
+
+// runPluginsTransform loads the site, has every plugin collect from it,
+// and rewrites each published post's built page through their transforms,
+// printing the pages that changed.
+func runPluginsTransform(ctx context.Context, args []string) error {
+	fs := newFlags("plugins transform", "")
+	configPath := fs.String("config", plugin.DefaultConfig, "plugins to run")
+	siteConfig := fs.String("site", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	public := fs.String("public", "public", "built site to rewrite")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	plugins, s, err := openPlugins(ctx, *configPath, *siteConfig, *dir, *public)
+	if err != nil {
+		return err
+	}
+	written, err := plugin.Transform(ctx, plugins, s)
+	for _, path := range written {
+		fmt.Println(path)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%d plugin(s), %d page(s) rewritten", len(plugins), len(written))
+	return nil
+}
+
+// openPlugins makes the plugins configPath declares and loads the site
+// they run over, with their collected data.
+func openPlugins(ctx context.Context, configPath, siteConfig, dir, public string) ([]plugin.Named, *plugin.Site, error) {
+	cfg, err := plugin.Load(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	plugins, err := cfg.Open(plugin.Builtins)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc, err := site.Load(siteConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	posts, err := content.Load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := &plugin.Site{Config: sc, Content: dir, Public: public, Posts: posts}
+	if err := plugin.Collect(ctx, plugins, s); err != nil {
+		return nil, nil, err
+	}
+	return plugins, s, nil
+}
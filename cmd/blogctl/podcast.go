@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/podcast"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var podcastCmd = &command{
+	name:    "podcast",
+	summary: "generate the podcast feed from the posts with audio",
+	run:     runPodcast,
+}
+
+// runPodcast writes podcast.xml, an RSS feed with iTunes tags and an
+// enclosure per post with `audio` in its front matter, into -out, and the
+// probed size and duration of each file into data/podcast.json for the
+// audio partial.
+func runPodcast(ctx context.Context, args []string) error {
+	fs := newFlags("podcast", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	static := fs.String("static", "static", "directory root-relative audio paths are under")
+	out := fs.String("out", "static", "directory to write the feed into")
+	data := fs.String("data", podcast.DefaultData, "file to write the episodes' audio to")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout for probing each remote file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	eps, err := podcast.Build(ctx, &http.Client{Timeout: *timeout}, cfg, posts, *static)
+	if err != nil {
+		return err
+	}
+	written, err := podcast.Write(*out, *data, cfg, eps)
+	for _, p := range written {
+		fmt.Println(p)
+	}
+	log.Printf("%d episode(s), %d file(s) updated", len(eps), len(written))
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/postarchive"
+	"github.com/rednafi/rednafi.com/internal/readtime"
+)
+
+var postArchiveCmd = &command{
+	name:    "post-archive",
+	summary: "group the posts by year and month into data/post_archive.json",
+	run:     runPostArchive,
+}
+
+// runPostArchive writes the data the /archives/ page reads as
+// site.Data.post_archive: the articles by year and month, each year's
+// post and word counts, and the sparklines of how often posts went out.
+func runPostArchive(ctx context.Context, args []string) error {
+	fs := newFlags("post-archive", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	pace := fs.String("reading-speed", readtime.DefaultConfig, "reading pace and costs for the reading times")
+	out := fs.String("out", postarchive.DefaultPath, "file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	speed, err := readtime.LoadConfig(*pace)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	a := postarchive.Build(posts, speed)
+	written, err := postarchive.Write(*out, a)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d post(s) over %d year(s)", a.Posts, len(a.Years))
+	return nil
+}
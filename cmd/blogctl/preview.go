@@ -0,0 +1,121 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/deploy"
+	"github.com/rednafi/rednafi.com/internal/r2"
+)
+
+var previewCmd = &command{
+	name:    "preview",
+	summary: "work with the branch previews `blogctl deploy -preview` publishes",
+	run: group("blogctl preview", []*command{
+		previewGCCmd,
+		previewListCmd,
+	}),
+}
+
+var previewListCmd = &command{
+	name:    "list",
+	summary: "list the deployed previews, most recently updated first",
+	run:     runPreviewList,
+}
+
+var previewGCCmd = &command{
+	name:    "gc",
+	summary: "delete previews that haven't been deployed to in N days",
+	run:     runPreviewGC,
+}
+
+// previewClient returns a client for the preview bucket in the settings at
+// envsPath, unless bucket names another, and the settings' preview block.
+func previewClient(envsPath, bucket string) (*r2.Client, deploy.Preview, error) {
+	settings, err := deploy.Load(envsPath)
+	if err != nil {
+		return nil, deploy.Preview{}, err
+	}
+	p := settings.Preview
+	cfg := r2.ConfigFromEnv()
+	cfg.Bucket = cmp.Or(bucket, p.Bucket)
+	if cfg.Bucket == "" {
+		return nil, p, fmt.Errorf("%s: no [preview] bucket", envsPath)
+	}
+	c, err := r2.New(cfg)
+	return c, p, err
+}
+
+func runPreviewList(ctx context.Context, args []string) error {
+	fs := newFlags("preview list", "")
+	envsPath := fs.String("deploys", deploy.DefaultConfig, "deploy settings with the [preview] bucket")
+	bucket := fs.String("bucket", "", "preview bucket (default [preview] bucket)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, p, err := previewClient(*envsPath, *bucket)
+	if err != nil {
+		return err
+	}
+	objects, err := client.List(ctx, deploy.PreviewRoot)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tUPDATED\tFILES")
+	for _, b := range deploy.Previews(objects) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", p.URL(b.Prefix), b.Updated.Local().Format(time.DateTime), len(b.Keys))
+	}
+	return tw.Flush()
+}
+
+// runPreviewGC deletes every object of the previews no branch has deployed
+// to in -days, so merged and abandoned branches don't pile up.
+func runPreviewGC(ctx context.Context, args []string) error {
+	fs := newFlags("preview gc", "")
+	envsPath := fs.String("deploys", deploy.DefaultConfig, "deploy settings with the [preview] bucket")
+	bucket := fs.String("bucket", "", "preview bucket (default [preview] bucket)")
+	days := fs.Int("days", 0, fmt.Sprintf("delete previews older than this (default [preview] days, or %d)", deploy.DefaultPreviewDays))
+	dryRun := fs.Bool("dry-run", false, "print the previews that would be deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, p, err := previewClient(*envsPath, *bucket)
+	if err != nil {
+		return err
+	}
+	if !flagSet(fs, "days") {
+		*days = cmp.Or(p.Days, deploy.DefaultPreviewDays)
+	}
+	objects, err := client.List(ctx, deploy.PreviewRoot)
+	if err != nil {
+		return err
+	}
+	branches := deploy.Previews(objects)
+	old, err := deploy.Expired(branches, time.Now(), *days)
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for _, b := range old {
+		fmt.Printf("%s\tlast deployed %s\n", b.Prefix, b.Updated.Local().Format(time.DateOnly))
+		if *dryRun {
+			continue
+		}
+		for _, key := range b.Keys {
+			if err := client.Delete(ctx, key); err != nil {
+				return err
+			}
+			deleted++
+		}
+	}
+	log.Printf("%d of %d preview(s) older than %d day(s), %d object(s) deleted", len(old), len(branches), *days, deleted)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/github"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var projectsCmd = &command{
+	name:    "projects",
+	summary: "write data/projects.json from my pinned and starred GitHub repos",
+	run:     runProjects,
+}
+
+// runProjects writes the repos the projects layout reads as
+// site.Data.projects. GITHUB_TOKEN, if set, adds the pinned repos and
+// raises the rate limit; the ETag cache keeps repeat runs nearly free
+// either way.
+func runProjects(ctx context.Context, args []string) error {
+	fs := newFlags("projects", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	user := fs.String("user", "", "GitHub user (default the github social icon's)")
+	cachePath := fs.String("cache", github.DefaultCache, "file to cache the API's responses in")
+	out := fs.String("out", github.DefaultPath, "file to write")
+	timeout := fs.Duration("timeout", 20*time.Second, "per-request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *user == "" {
+		cfg, err := site.Load(*config)
+		if err != nil {
+			return err
+		}
+		for _, s := range cfg.Params.SocialIcons {
+			if s.Name == "github" {
+				*user = strings.Trim(strings.TrimPrefix(s.URL, "https://github.com/"), "/")
+			}
+		}
+	}
+	if *user == "" {
+		return errors.New("projects: no -user and no github social icon")
+	}
+	c := &github.Client{
+		HTTP:  &http.Client{Timeout: *timeout},
+		Token: os.Getenv("GITHUB_TOKEN"),
+		Cache: github.LoadCache(*cachePath),
+	}
+	if c.Token == "" {
+		log.Print("GITHUB_TOKEN isn't set; leaving out the pinned repos")
+	}
+	projects, err := github.Projects(ctx, c, *user)
+	if err != nil {
+		return err
+	}
+	if err := c.Save(*cachePath); err != nil {
+		return err
+	}
+	written, err := github.Write(*out, projects)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d project(s); %d of %d request(s) not modified", len(projects), c.NotModified, c.Requests)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/readtime"
+)
+
+var readtimeCmd = &command{
+	name:    "readtime",
+	summary: "estimate reading times and write data/readtime.json",
+	run:     runReadtime,
+}
+
+// runReadtime writes the reading time of every post, with code, tables,
+// and images weighed apart from the prose, for the post_meta partial to
+// show as site.Data.readtime in place of Hugo's .ReadingTime.
+func runReadtime(ctx context.Context, args []string) error {
+	fs := newFlags("readtime", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	config := fs.String("config", readtime.DefaultConfig, "reading pace and costs")
+	out := fs.String("out", readtime.DefaultPath, "file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := readtime.LoadConfig(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	estimates, err := cfg.Posts(posts)
+	if err != nil {
+		return err
+	}
+	written, err := readtime.Write(*out, estimates)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d reading time(s)", len(estimates))
+	return nil
+}
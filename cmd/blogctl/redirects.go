@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/cloudflare"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/redirects"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var redirectsCmd = &command{
+	name:    "redirects",
+	summary: "manage the redirect map in data/redirects.toml",
+	run: group("blogctl redirects", []*command{
+		redirectsSyncCmd,
+	}),
+}
+
+var redirectsSyncCmd = &command{
+	name:    "sync",
+	summary: "validate the redirect map, write Hugo aliases, and push it to Cloudflare",
+	run:     runRedirectsSync,
+}
+
+// runRedirectsSync checks the redirect map, then makes each target post's
+// aliases list exactly the paths redirecting to it, so "hugo server" serves
+// the redirects locally, and replaces the Cloudflare Bulk Redirects list
+// with the map so the edge answers before the request reaches the origin.
+//
+// The map owns the aliases: a post with an alias the map doesn't have is
+// an error, so nothing hand-written is dropped silently.
+func runRedirectsSync(ctx context.Context, args []string) error {
+	fs := newFlags("redirects sync", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", redirects.DefaultPath, "redirect map")
+	list := fs.String("list", "rednafi_redirects", "Cloudflare Bulk Redirects list name")
+	local := fs.Bool("local", false, "only write the aliases; don't push to Cloudflare")
+	dryRun := fs.Bool("dry-run", false, "validate and report without writing or pushing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	rs, err := redirects.Load(*data)
+	if err != nil {
+		return err
+	}
+	pages, err := redirects.Pages(*dir, posts)
+	if err != nil {
+		return err
+	}
+	if errs := redirects.Validate(rs, pages); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Printf("%s: %v\n", *data, err)
+		}
+		return fmt.Errorf("%d redirect problem(s)", len(errs))
+	}
+
+	aliases := redirects.Aliases(rs, posts)
+	var stray []string
+	for _, p := range posts {
+		for _, a := range stringList(p.Params["aliases"]) {
+			if !slices.Contains(aliases[p.Path], a) {
+				stray = append(stray, fmt.Sprintf("%s/%s: alias %s isn't in %s", *dir, p.Path, a, *data))
+			}
+		}
+	}
+	if len(stray) > 0 {
+		for _, s := range stray {
+			fmt.Println(s)
+		}
+		return fmt.Errorf("%d alias(es) to move into %s", len(stray), *data)
+	}
+
+	var written int
+	for _, p := range posts {
+		want := aliases[p.Path]
+		if slices.Equal(want, stringList(p.Params["aliases"])) {
+			continue
+		}
+		path := filepath.Join(*dir, filepath.FromSlash(p.Path))
+		fmt.Printf("%s: aliases %s\n", filepath.ToSlash(path), strings.Join(want, ", "))
+		written++
+		if *dryRun {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out, err := content.SetList(b, "aliases", want)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return err
+		}
+	}
+	log.Printf("%d redirect(s), aliases updated on %d post(s)", len(rs), written)
+	if *local || *dryRun {
+		return nil
+	}
+
+	cf, err := cloudflare.New(cloudflare.ConfigFromEnv(), "account")
+	if err != nil {
+		return err
+	}
+	items := make([]cloudflare.Redirect, len(rs))
+	for i, r := range rs {
+		to := r.To
+		if r.Local() {
+			to = cfg.Permalink(to)
+		}
+		items[i] = cloudflare.Redirect{
+			SourceURL:           strings.TrimPrefix(strings.TrimPrefix(cfg.Permalink(r.From), "https://"), "http://"),
+			TargetURL:           to,
+			StatusCode:          r.Status,
+			PreserveQueryString: true,
+		}
+	}
+	if err := cf.ReplaceRedirects(ctx, *list, items); err != nil {
+		return err
+	}
+	log.Printf("pushed %d redirect(s) to the %s list", len(items), *list)
+	return nil
+}
+
+// stringList reads a front matter list of strings.
+func stringList(v any) []string {
+	vs, _ := v.([]any)
+	out := make([]string, 0, len(vs))
+	for _, v := range vs {
+		out = append(out, fmt.Sprint(v))
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/related"
+)
+
+var relatedCmd = &command{
+	name:    "related",
+	summary: "compute related posts into data/related.json",
+	run:     runRelated,
+}
+
+// runRelated writes the slug → related slugs map the related partial reads
+// as site.Data.related.
+func runRelated(ctx context.Context, args []string) error {
+	fs := newFlags("related", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", related.DefaultPath, "file to write")
+	method := fs.String("method", string(related.TFIDF), "scoring: tfidf or tags")
+	n := fs.Int("n", 5, "related posts per post")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	m, err := related.ParseMethod(*method)
+	if err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	rel := related.Compute(posts, m, *n)
+	written, err := related.Write(*out, rel)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d post(s) scored by %s", len(rel), m)
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/htmlcheck"
+	"github.com/rednafi/rednafi.com/internal/linkcheck"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/readtime"
+	"github.com/rednafi/rednafi.com/internal/review"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+var reviewCmd = &command{
+	name:    "review",
+	summary: "report on a draft before publishing it",
+	run:     runReview,
+}
+
+// runReview prints a pre-publish report on the post with the given slug:
+// its length and reading time, how easily its prose reads, how much of it
+// is code, whether its links work, whether it has a description and an
+// Open Graph image, and the site's tags it mentions but doesn't carry. It
+// fails if a link is broken or the description or image is missing, so
+// it's the last thing to run before setting draft: false.
+func runReview(ctx context.Context, args []string) error {
+	fs := newFlags("review", "<slug>")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	static := fs.String("static", "static", "static files directory")
+	aliasPath := fs.String("aliases", tags.DefaultAliases, "tag alias map")
+	pace := fs.String("reading-speed", readtime.DefaultConfig, "reading pace and costs")
+	cache := fs.String("cache", ".linkcheck.db", "cmd/linkcheck's result cache")
+	external := fs.Bool("external", true, "check external links")
+	timeout := fs.Duration("timeout", 15*time.Second, "per-request timeout")
+	jobs := fs.Int("j", 8, "external links to check at once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("review takes one slug")
+	}
+	slug := fs.Arg(0)
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(posts, func(p *content.Post) bool { return p.Slug == slug })
+	if i < 0 {
+		return fmt.Errorf("no post %q under %s", slug, *dir)
+	}
+	p := posts[i]
+	aliases, err := tags.LoadAliases(*aliasPath)
+	if err != nil {
+		return err
+	}
+	speed, err := readtime.LoadConfig(*pace)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	problem := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	s := review.Measure(p)
+	state := "published"
+	if p.Draft {
+		state = "draft"
+	}
+	fmt.Printf("%s/%s (%s)\n\n", *dir, p.Path, state)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "words\t%d\n", s.Words)
+	fmt.Fprintf(w, "reading time\t%d min\n", speed.Post(p).Minutes)
+	fmt.Fprintf(w, "readability\t%.0f, %s (Flesch reading ease, %.1f words a sentence)\n",
+		s.Readability(), review.Grade(s.Readability()), float64(s.Words)/float64(max(s.Sentences, 1)))
+	fmt.Fprintf(w, "code\t%.0f%% of the words, in %d block(s) of %d line(s)\n", 100*s.CodeShare(), s.CodeBlocks, s.CodeLines)
+
+	// The post is checked as the published page it's about to become.
+	published := *p
+	published.Draft = false
+	all := slices.Clone(posts)
+	all[i] = &published
+	index, err := linkcheck.FromMarkdown(cfg.BaseURL, *dir, all, *static)
+	if err != nil {
+		return err
+	}
+	src := filepath.ToSlash(filepath.Join(*dir, p.Path))
+	broken, ext := index.Check()
+	var internal int
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	for _, l := range doc.Links() {
+		if !linkcheck.IsExternal(index.Host, l.Dest) && !strings.Contains(l.Dest, ":") {
+			internal++
+		}
+	}
+	for _, b := range broken {
+		if b.Source == src {
+			problem("%s:%d: %s: %s", b.Source, b.Line, b.Dest, b.Reason)
+		}
+	}
+	refs := map[string][]linkcheck.Ref{}
+	for u, rs := range ext {
+		for _, r := range rs {
+			if r.Source == src {
+				refs[u] = append(refs[u], r)
+			}
+		}
+	}
+	fmt.Fprintf(w, "links\t%d external, %d internal\n", len(refs), internal)
+	if *external && len(refs) > 0 {
+		c, err := linkcheck.OpenCache(*cache)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		checker := &linkcheck.Checker{
+			Client:  &http.Client{Timeout: *timeout},
+			Cache:   c,
+			TTL:     7 * 24 * time.Hour,
+			FailTTL: 24 * time.Hour,
+			PerHost: time.Second,
+			Retries: 3,
+		}
+		urls := make([]string, 0, len(refs))
+		for u := range refs {
+			urls = append(urls, u)
+		}
+		sort.Strings(urls)
+		results := make([]linkcheck.Result, len(urls))
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, max(*jobs, 1))
+		for i, u := range urls {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i], _, _ = checker.Check(ctx, u)
+			}()
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for i, u := range urls {
+			if results[i].OK {
+				continue
+			}
+			for _, r := range refs[u] {
+				problem("%s:%d: %s: %s", r.Source, r.Line, u, results[i])
+			}
+		}
+	}
+
+	desc := utf8.RuneCountInString(strings.TrimSpace(p.Description))
+	opts := htmlcheck.DefaultOptions
+	switch {
+	case desc == 0:
+		problem("no description; search results and link previews make one up")
+	case desc < opts.MinDescription || desc > opts.MaxDescription:
+		problem("the description is %d characters; keep it to %d to %d", desc, opts.MinDescription, opts.MaxDescription)
+	}
+	fmt.Fprintf(w, "description\t%d characters\n", desc)
+
+	image := ogImage(p, *static)
+	if image == "" {
+		problem("no Open Graph image; set images or cover.image, or run cmd/ogimage once it's published")
+		image = "none"
+	}
+	fmt.Fprintf(w, "og image\t%s\n", image)
+
+	var suggested []string
+	text := []string{p.Title, p.Description}
+	for _, h := range doc.Headings() {
+		text = append(text, h.Text)
+	}
+	for _, t := range newpost.SuggestTags(strings.Join(text, " "), posts, aliases) {
+		if !slices.ContainsFunc(aliases.Normalize(p.Tags), func(have string) bool { return strings.EqualFold(have, t) }) {
+			suggested = append(suggested, t)
+		}
+	}
+	fmt.Fprintf(w, "tags\t%s\n", cmp.Or(strings.Join(p.Tags, ", "), "none"))
+	fmt.Fprintf(w, "suggested tags\t%s\n", cmp.Or(strings.Join(suggested, ", "), "none"))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("\nready to publish")
+		return nil
+	}
+	fmt.Println()
+	for _, pr := range problems {
+		fmt.Println(pr)
+	}
+	return fmt.Errorf("%d problem(s) to fix before publishing", len(problems))
+}
+
+// ogImage returns the Open Graph image the page will get, as the theme
+// and internal/schema pick it: from the images or cover.image front
+// matter, or the card cmd/ogimage rendered. It's "" when the page would
+// fall back to the site's default.
+func ogImage(p *content.Post, static string) string {
+	if list, ok := p.Params["images"].([]any); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok && s != "" {
+				return s
+			}
+		}
+	}
+	if cover, ok := p.Params["cover"].(map[string]any); ok {
+		if s, ok := cover["image"].(string); ok && s != "" {
+			return s
+		}
+	}
+	card := path.Join("/images/og", p.Slug+".png")
+	if _, err := os.Stat(filepath.Join(static, filepath.FromSlash(card))); err == nil {
+		return card
+	}
+	return ""
+}
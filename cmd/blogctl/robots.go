@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/robots"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var robotsCmd = &command{
+	name:    "robots",
+	summary: "generate robots.txt and Cloudflare WAF rules from data/crawlers.toml",
+	run:     runRobots,
+}
+
+// runRobots validates the crawler policy, writes robots.txt to -out, which
+// Hugo copies into the build in place of its own, and writes the WAF rules
+// for the crawlers that ignore it to -waf, as the body to PUT to the
+// zone's http_request_firewall_custom entrypoint.
+func runRobots(ctx context.Context, args []string) error {
+	fs := newFlags("robots", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	data := fs.String("data", robots.DefaultPath, "crawler policy")
+	out := fs.String("out", "static", "directory to write robots.txt into")
+	waf := fs.String("waf", ".cloudflare/waf-crawlers.json", "file to write the WAF ruleset payload to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	policy, err := robots.Load(*data)
+	if err != nil {
+		return err
+	}
+	if errs := policy.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Printf("%s: %v\n", *data, err)
+		}
+		return fmt.Errorf("%d crawler policy problem(s)", len(errs))
+	}
+
+	rules, err := json.MarshalIndent(policy.WAF(), "", "  ")
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		path string
+		b    []byte
+	}{
+		{filepath.Join(*out, "robots.txt"), policy.RobotsTxt(cfg.BaseURL)},
+		{*waf, append(rules, '\n')},
+	}
+	for _, f := range files {
+		wrote, err := fsutil.WriteIfChanged(f.path, f.b)
+		if err != nil {
+			return err
+		}
+		if wrote {
+			fmt.Println(f.path)
+		}
+	}
+	log.Printf("%d crawler(s), %d WAF rule(s)", len(policy.Crawler), len(policy.WAF().Rules))
+	return nil
+}
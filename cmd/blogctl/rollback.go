@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/cloudflare"
+	"github.com/rednafi/rednafi.com/internal/deploy"
+	"github.com/rednafi/rednafi.com/internal/r2"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var rollbackCmd = &command{
+	name:    "rollback",
+	summary: "list an environment's deploys or restore one of them",
+	run:     runRollback,
+}
+
+// runRollback puts an environment's bucket back the way a recorded deploy
+// left it, copying the files that differ from the snapshots bucket and
+// deleting the ones later deploys added, without a rebuild. The rollback
+// is recorded as a deploy of its own, so it can be undone the same way.
+// With no deploy ID, it lists the environment's deploys instead.
+func runRollback(ctx context.Context, args []string) error {
+	r2cfg := r2.ConfigFromEnv()
+	fs := newFlags("rollback", "[deploy-id]")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	envsPath := fs.String("deploys", deploy.DefaultConfig, "deploy environments and snapshots bucket")
+	envName := fs.String("env", deploy.DefaultEnv, "environment to roll back, like prod or staging")
+	fs.StringVar(&r2cfg.Bucket, "bucket", r2cfg.Bucket, "bucket the site is served from")
+	prefix := fs.String("prefix", "", "key prefix inside the bucket")
+	purge := fs.Bool("purge", false, "purge the restored URLs from Cloudflare's cache")
+	dryRun := fs.Bool("dry-run", false, "print what would be restored and deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("rollback takes at most one deploy ID")
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	store, err := environment(fs, *envsPath, *envName, &r2cfg, prefix, purge, cfg)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return fmt.Errorf("%s: no snapshots bucket to roll back from", *envsPath)
+	}
+
+	if fs.NArg() == 0 {
+		return listDeploys(ctx, store, *envName)
+	}
+	target, err := store.Get(ctx, *envName, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	latest, err := store.Latest(ctx, *envName)
+	if err != nil {
+		return err
+	}
+	client, err := r2.New(r2cfg)
+	if err != nil {
+		return err
+	}
+	current, err := client.List(ctx, *prefix)
+	if err != nil {
+		return err
+	}
+	put, del := deploy.Plan(current, latest, target)
+	log.Printf("%s deploy %s: %d file(s) to restore, %d to delete", *envName, target.ID, len(put), len(del))
+
+	now := time.Now()
+	snap := &deploy.Snapshot{
+		ID:       deploy.NewID(now),
+		Env:      *envName,
+		Time:     now.UTC(),
+		Prefix:   *prefix,
+		Rollback: target.ID,
+		Objects:  target.Objects,
+	}
+	diff := deploy.Compare(latest, snap)
+
+	if *dryRun {
+		for _, key := range put {
+			fmt.Println(key)
+		}
+		for _, key := range del {
+			fmt.Println("delete", key)
+		}
+		diff.Print(os.Stdout)
+		return nil
+	}
+
+	var cf *cloudflare.Client
+	if *purge {
+		if cf, err = cloudflare.New(cloudflare.ConfigFromEnv(), "zone"); err != nil {
+			return err
+		}
+	}
+	var urls []string
+	restoreErr := store.Restore(ctx, client, target, put, del, func(key string) {
+		fmt.Println(key)
+		urls = append(urls, purgeURLs(cfg, *prefix, key)...)
+	})
+	if cf != nil && len(urls) > 0 {
+		if err := cf.PurgeFiles(ctx, urls); err != nil {
+			return errors.Join(restoreErr, err)
+		}
+		log.Printf("purged %d URL(s)", len(urls))
+	}
+	if restoreErr != nil {
+		return restoreErr
+	}
+	if err := store.Save(ctx, snap); err != nil {
+		return err
+	}
+	diff.Print(os.Stdout)
+	log.Printf("deploy %s to %s rolls back to %s: %s", snap.ID, *envName, target.ID, diff)
+	return nil
+}
+
+// listDeploys prints env's deploys, newest first.
+func listDeploys(ctx context.Context, store *deploy.Store, env string) error {
+	ids, err := store.List(ctx, env)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		log.Printf("no %s deploys recorded", env)
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tFILES\tROLLBACK OF")
+	for i := len(ids) - 1; i >= 0; i-- {
+		snap, err := store.Get(ctx, env, ids[i])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", snap.ID, snap.Time.Local().Format(time.DateTime), len(snap.Objects), snap.Rollback)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/schema"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var schemaCmd = &command{
+	name:    "schema",
+	summary: "add JSON-LD structured data to the built pages",
+	run:     runSchema,
+}
+
+// runSchema writes the JSON-LD of the home page and each published post
+// into its page under the built site, after Hugo has run. Items that fall
+// short of what rich results need are reported and fail the command once
+// every page has been written.
+func runSchema(ctx context.Context, args []string) error {
+	fs := newFlags("schema", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	public := fs.String("public", "public", "built site to rewrite")
+	static := fs.String("static", "static", "static files, for the posts' Open Graph cards")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	has := func(u string) bool {
+		_, err := os.Stat(filepath.Join(*static, filepath.FromSlash(u)))
+		return err == nil
+	}
+
+	var pages, problems int
+	write := func(rel, name string, items []any) error {
+		for _, msg := range schema.Check(items) {
+			fmt.Printf("%s: %s\n", name, msg)
+			problems++
+		}
+		path := filepath.Join(*public, filepath.FromSlash(rel), "index.html")
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("%s: not built; skipping", name)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out, err := schema.InjectPage(b, items)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if bytes.Equal(out, b) {
+			return nil
+		}
+		pages++
+		return os.WriteFile(path, out, 0o644)
+	}
+	if err := write("/", "home page", schema.Home(cfg)); err != nil {
+		return err
+	}
+	for _, p := range content.Published(posts) {
+		items := schema.Post(cfg, p, schema.Images(cfg, p, has))
+		if err := write(p.RelPermalink(), filepath.Join(*dir, p.Path), items); err != nil {
+			return err
+		}
+	}
+	log.Printf("structured data in %d page(s)", pages)
+	if problems > 0 {
+		return fmt.Errorf("%d structured data problem(s)", problems)
+	}
+	return nil
+}
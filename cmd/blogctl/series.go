@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/series"
+)
+
+var seriesCmd = &command{
+	name:    "series",
+	summary: "check series numbering and write data/series.json",
+	run:     runSeries,
+}
+
+// runSeries writes the series navigation the series partial and the
+// series index page read as site.Data.series. Gaps or duplicates in a
+// series' part numbers fail the command, after the file is written.
+func runSeries(ctx context.Context, args []string) error {
+	fs := newFlags("series", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", series.DefaultPath, "file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	d, problems := series.Build(posts)
+	written, err := series.Write(*out, d)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	for _, p := range problems {
+		p.Path = filepath.Join(*dir, p.Path)
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) in %d series", len(problems), len(d.Series))
+	}
+	log.Printf("%d series, %d post(s)", len(d.Series), len(d.Posts))
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/headers"
+	"github.com/rednafi/rednafi.com/internal/redirects"
+	"github.com/rednafi/rednafi.com/internal/serve"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var serveCmd = &command{
+	name:    "serve",
+	summary: "preview the built site with production's headers, redirects, and 404s",
+	run:     runServe,
+}
+
+// runServe serves -dir as production does, unlike "hugo server": with the
+// headers from its _headers file, written by `blogctl csp`, or else from
+// data/headers.toml, the redirect map answering first, pretty URLs, and
+// the 404 page. It speaks HTTP/2, over cleartext to clients that
+// ask for it and over TLS, with a certificate made up for the run, with
+// -tls, which browsers need.
+//
+// Build with the preview's base URL so links stay local, e.g.
+//
+//	hugo --gc --minify -b http://localhost:8000/ && blogctl serve
+//
+// With -watch it builds the site itself, drafts and future posts
+// included, into a temporary directory unless -dir is given, with its
+// content security policies, rebuilds when a source changes, and reloads the open pages over a WebSocket.
+// -share also opens a Cloudflare quick tunnel, builds for its URL, and
+// prints a link with a token; only readers with the link get in.
+func runServe(ctx context.Context, args []string) error {
+	fs := newFlags("serve", "")
+	addr := fs.String("addr", "localhost:8000", "address to listen on")
+	dir := fs.String("dir", "public", "built site to serve")
+	policyPath := fs.String("headers", headers.DefaultPath, "response header policy")
+	data := fs.String("redirects", redirects.DefaultPath, "redirect map")
+	useTLS := fs.Bool("tls", false, "serve HTTPS with a self-signed certificate for localhost")
+	watch := fs.Bool("watch", false, "build with drafts, rebuild on changes, and live reload")
+	share := fs.Bool("share", false, "build with drafts and share through a tunnel behind a token")
+	hugo := fs.String("hugo", "hugo", "hugo binary to build with")
+	tunnel := fs.String("tunnel", strings.Join(serve.DefaultTunnel, " "), "tunnel command; the local URL is appended")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *share && *useTLS {
+		return errors.New("-share serves the tunnel over HTTPS; drop -tls")
+	}
+
+	policy, err := headers.Load(*policyPath)
+	if err != nil {
+		return err
+	}
+	rs, err := redirects.Load(*data)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if *useTLS {
+		scheme = "https"
+	}
+	host := *addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	base := scheme + "://" + host + "/"
+
+	var token string
+	if *share {
+		if token, err = serve.NewToken(); err != nil {
+			return err
+		}
+		u, err := serve.Tunnel(ctx, strings.Fields(*tunnel), "http://"+host)
+		if err != nil {
+			return err
+		}
+		base = u + "/"
+	}
+
+	building := *watch || *share
+	out := *dir
+	if building && !flagSet(fs, "dir") {
+		// Keep drafts out of public/, where a deploy would pick them up.
+		if out, err = os.MkdirTemp("", "blogctl-preview-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(out)
+	}
+	build := func() error {
+		cmd := exec.CommandContext(ctx, *hugo, "--buildDrafts", "--buildFuture", "--cleanDestinationDir",
+			"--destination", out, "--baseURL", base)
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+		// Previews don't report violations; the console shows them.
+		cfg, err := site.Load(site.ConfigPath)
+		if err != nil {
+			return err
+		}
+		cfg.BaseURL = strings.TrimSuffix(base, "/")
+		_, _, err = writeCSP(cfg, out, *policyPath, "")
+		return err
+	}
+	if building {
+		if err := build(); err != nil {
+			return err
+		}
+	}
+
+	handler := serve.Handler(out, policy, rs)
+	if *watch {
+		rl := serve.NewReloader()
+		handler = serve.LiveReload(handler, rl)
+		go serve.Watch(ctx, serve.Sources("."), 500*time.Millisecond, func() {
+			log.Print("rebuilding")
+			if err := build(); err != nil {
+				log.Printf("build: %v", err)
+				return
+			}
+			rl.Reload()
+		})
+	}
+	if *share {
+		handler = serve.Protect(handler, token)
+	}
+
+	srv := &http.Server{
+		Handler:           logRequests(handler),
+		ReadHeaderTimeout: 5 * time.Second,
+		Protocols:         new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	if *useTLS {
+		cert, err := serve.SelfSigned()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	log.Printf("serving %s on %s://%s", out, scheme, host)
+	if *share {
+		log.Printf("shared at %s?token=%s", base, token)
+	}
+	if *useTLS {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// flagSet reports whether the flag name was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// logRequests logs each request's method, path, protocol, and status.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		log.Printf("%s %s %s %d", r.Proto, r.Method, r.URL.RequestURI(), sw.status)
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack hands the connection to the live reload socket.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/shortlink"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var shortenCmd = &command{
+	name:    "shorten",
+	summary: "mint short links for posts",
+	run:     runShorten,
+}
+
+// runShorten prints the short link of each named post, minting a code for
+// any that has none and recording it in the data file. Commit the file so
+// the links keep working.
+func runShorten(ctx context.Context, args []string) error {
+	fs := newFlags("shorten", "[slug ...]")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", shortlink.DefaultPath, "short codes to read and update")
+	all := fs.Bool("all", false, "mint codes for every published post")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	slugs := fs.Args()
+	if len(slugs) == 0 && !*all {
+		return errors.New("name a post's slug, or pass -all")
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	links, err := shortlink.Load(*data)
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	for _, p := range posts {
+		known[p.Slug] = true
+	}
+	if *all {
+		for _, p := range content.Published(posts) {
+			slugs = append(slugs, p.Slug)
+		}
+	}
+
+	var minted int
+	for _, slug := range slugs {
+		if !known[slug] {
+			return fmt.Errorf("no post has the slug %q", slug)
+		}
+		code, ok := links.Mint(slug)
+		if ok {
+			minted++
+		}
+		if !*all || ok {
+			fmt.Printf("%s\t%s\n", slug, cfg.Permalink(shortlink.Prefix+code))
+		}
+	}
+	if minted > 0 {
+		if err := links.Save(*data); err != nil {
+			return err
+		}
+	}
+	log.Printf("%d new code(s); %d in %s", minted, len(links), *data)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/sidenote"
+)
+
+var sidenotesCmd = &command{
+	name:    "sidenotes",
+	summary: "turn the built posts' footnotes into margin sidenotes",
+	run:     runSidenotes,
+}
+
+// runSidenotes rewrites the footnotes in each published post's page under
+// the built site, after Hugo has run, taking the notes' ids from their
+// labels in the post's markdown.
+func runSidenotes(ctx context.Context, args []string) error {
+	fs := newFlags("sidenotes", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	public := fs.String("public", "public", "built site to rewrite")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	var pages, notes int
+	for _, p := range content.Published(posts) {
+		path := filepath.Join(*public, filepath.FromSlash(p.RelPermalink()), "index.html")
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("%s: not built; skipping", p.Path)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		out, n, err := sidenote.RewritePage(b, sidenote.Labels([]byte(p.Body)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if bytes.Equal(out, b) {
+			continue
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+		pages++
+		notes += n
+	}
+	log.Printf("%d sidenote(s) in %d page(s)", notes, pages)
+	return nil
+}
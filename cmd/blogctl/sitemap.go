@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/gitmeta"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/sitemap"
+	"github.com/rednafi/rednafi.com/internal/views"
+)
+
+var sitemapCmd = &command{
+	name:    "sitemap",
+	summary: "generate sitemap.xml with lastmod from git and priorities from views",
+	run:     runSitemap,
+}
+
+// runSitemap writes sitemap.xml to -out, which Hugo copies into the build
+// in place of its own, and one under -out/<lang>/ for each language with
+// translations. Posts are dated by data/gitmeta.json when `blogctl
+// gitmeta` has run, and ranked by data/views.json when `blogctl views` has.
+func runSitemap(ctx context.Context, args []string) error {
+	fs := newFlags("sitemap", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", "static", "directory to write the sitemap into")
+	history := fs.String("gitmeta", gitmeta.DefaultPath, "post history from blogctl gitmeta")
+	counts := fs.String("views", views.DefaultPath, "view counts from blogctl views")
+	max := fs.Int("max", sitemap.MaxURLs, "most URLs per sitemap file before splitting into an index")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	pages, err := sitemap.Pages(*dir)
+	if err != nil {
+		return err
+	}
+	meta, err := gitmeta.Load(*history)
+	if err != nil {
+		return err
+	}
+	gitmeta.Apply(posts, meta)
+	gitmeta.Apply(pages, meta)
+	v, err := views.Load(*counts)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, code := range cfg.Langs() {
+		lang, dir := code, "/"+code+"/"
+		if code == cfg.DefaultContentLanguage {
+			lang, dir = "", "/"
+		}
+		urls := sitemap.Build(cfg, posts, pages, sitemap.Options{Now: now, Views: v, Lang: lang})
+		if lang != "" && len(urls) == 0 {
+			continue
+		}
+		files, err := sitemap.Files(cfg, dir, urls, *max)
+		if err != nil {
+			return err
+		}
+		written, err := sitemap.Write(filepath.Join(*out, filepath.FromSlash(dir)), files)
+		for _, p := range written {
+			fmt.Println(p)
+		}
+		log.Printf("%s: %d URL(s) in %d file(s), %d updated", code, len(urls), len(files), len(written))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
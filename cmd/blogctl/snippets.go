@@ -0,0 +1,9 @@
+package main
+
+var snippetsCmd = &command{
+	name:    "snippets",
+	summary: "maintain the code that goes with the posts",
+	run: group("blogctl snippets", []*command{
+		snippetsTidyCmd,
+	}),
+}
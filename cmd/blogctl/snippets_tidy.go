@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/rednafi/rednafi.com/internal/bundle"
+	"github.com/rednafi/rednafi.com/internal/postmod"
+)
+
+var snippetsTidyCmd = &command{
+	name:    "tidy",
+	summary: "pin and tidy each post's Go module and report deprecated or vulnerable dependencies",
+	run:     runSnippetsTidy,
+}
+
+// runSnippetsTidy gives every folder under code/ with Go in it a go.mod,
+// runs go mod tidy in them in parallel, and reports the dependencies that
+// are deprecated, have newer versions, or, with govulncheck on $PATH, have
+// known vulnerabilities. Vulnerabilities the code reaches fail the
+// command; the rest are only reported. -upgrade moves every dependency to
+// its latest version before tidying.
+func runSnippetsTidy(ctx context.Context, args []string) error {
+	fs := newFlags("snippets tidy", "[slug ...]")
+	code := fs.String("code", bundle.DefaultDir, "directory of code folders named after the posts' slugs")
+	jobs := fs.Int("j", runtime.NumCPU(), "number of modules to tidy at once")
+	upgrade := fs.Bool("upgrade", false, "upgrade every dependency to its latest version first")
+	vuln := fs.Bool("vuln", true, "scan for known vulnerabilities with govulncheck")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dirs, err := postmod.Dirs(*code)
+	if err != nil {
+		return err
+	}
+	if only := fs.Args(); len(only) > 0 {
+		dirs = slices.DeleteFunc(dirs, func(d postmod.Dir) bool { return !slices.Contains(only, d.Slug) })
+	}
+	opts := postmod.Options{Upgrade: *upgrade}
+	if *vuln {
+		if p, err := exec.LookPath("govulncheck"); err == nil {
+			opts.Govulncheck = p
+		} else {
+			log.Print("govulncheck isn't installed, so vulnerabilities aren't checked; go install golang.org/x/vuln/cmd/govulncheck@latest")
+		}
+	}
+
+	reports := make([]*postmod.Report, len(dirs))
+	errs := make([]error, len(dirs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(*jobs, 1))
+	for i, d := range dirs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			reports[i], errs[i] = postmod.Tidy(ctx, d, opts)
+		}()
+	}
+	wg.Wait()
+
+	var failed, vulnerable int
+	for i, r := range reports {
+		path := dirs[i].Path
+		if errs[i] != nil {
+			failed++
+			fmt.Printf("%s: %v\n", path, errs[i])
+			continue
+		}
+		switch {
+		case r.Created:
+			fmt.Printf("%s: created go.mod\n", path)
+		case r.Changed:
+			fmt.Printf("%s: tidied\n", path)
+		}
+		for _, m := range r.Deprecated {
+			fmt.Printf("%s: %s %s is deprecated: %s\n", path, m.Path, m.Version, m.Deprecated)
+		}
+		for _, m := range r.Updates {
+			fmt.Printf("%s: %s %s has an update to %s\n", path, m.Path, m.Version, m.Update.Version)
+		}
+		called := false
+		for _, v := range r.Vulns {
+			fixed := "no fix yet"
+			if v.Fixed != "" {
+				fixed = "fixed in " + v.Fixed
+			}
+			reach := "required but not called"
+			if v.Called {
+				reach, called = "called", true
+			}
+			fmt.Printf("%s: %s in %s %s, %s, %s: %s\n", path, v.ID, v.Module, v.Version, fixed, reach, v.Summary)
+		}
+		if called {
+			vulnerable++
+		}
+	}
+	log.Printf("%d module(s) tidied", len(dirs)-failed)
+	if failed > 0 || vulnerable > 0 {
+		return fmt.Errorf("%d module(s) failed to tidy, %d call vulnerable code", failed, vulnerable)
+	}
+	return nil
+}
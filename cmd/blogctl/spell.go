@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/spell"
+)
+
+var spellCmd = &command{
+	name:    "spell",
+	summary: "spell-check the posts' prose against hunspell and data/dictionary.txt",
+	run:     runSpell,
+}
+
+// runSpell reports each misspelled word in the posts, or the named ones, as
+// path:line:col, and fails if there are any. With -add it appends them to
+// the dictionary instead, for when the report lists only words to keep.
+func runSpell(ctx context.Context, args []string) error {
+	fs := newFlags("spell", "[post ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	dictPath := fs.String("dict", spell.DefaultDictionary, "project dictionary")
+	hunspell := fs.String("hunspell", strings.Join(spell.DefaultCommand, " "), "spell checker command")
+	drafts := fs.Bool("drafts", false, "check drafts too")
+	add := fs.Bool("add", false, "append the unknown words to the dictionary")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dict, err := spell.LoadDictionary(*dictPath)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	if !*drafts {
+		posts = content.Published(posts)
+	}
+	posts, err = selectPosts(posts, fs.Args(), *dir)
+	if err != nil {
+		return err
+	}
+
+	var all []spell.Word
+	words := make([][]spell.Word, len(posts))
+	for i, p := range posts {
+		words[i] = spell.Words(p)
+		all = append(all, words[i]...)
+	}
+	unknown, err := spell.Unknown(ctx, strings.Fields(*hunspell), dict, all)
+	if err != nil {
+		return err
+	}
+	if *add {
+		n, err := spell.Add(*dictPath, unknown)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d word(s) added to %s", n, *dictPath)
+		return nil
+	}
+
+	bad := map[string]bool{}
+	for _, w := range unknown {
+		bad[w] = true
+	}
+	var n int
+	for i, p := range posts {
+		for _, w := range words[i] {
+			if bad[w.Text] {
+				fmt.Printf("%s/%s:%d:%d: %s\n", *dir, p.Path, w.Line, w.Col, w.Text)
+				n++
+			}
+		}
+	}
+	log.Printf("%d post(s) checked", len(posts))
+	if n > 0 {
+		return fmt.Errorf("%d misspelling(s) of %d word(s); add the ones to keep with -add", n, len(unknown))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/linkcheck"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/stats"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+var statsCmd = &command{
+	name:    "stats",
+	summary: "add up the writing into data/stats.json for the /stats/ page",
+	run:     runStats,
+}
+
+// runStats writes the data the /stats/ page reads as site.Data.stats: the
+// posts and words of each year and tag, the average post length, the
+// longest waits between posts, and the sites linked to most.
+func runStats(ctx context.Context, args []string) error {
+	fs := newFlags("stats", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	aliasPath := fs.String("aliases", tags.DefaultAliases, "tag alias map")
+	gaps := fs.Int("gaps", stats.DefaultOptions.Gaps, "longest gaps between posts to list")
+	domains := fs.Int("domains", stats.DefaultOptions.Domains, "most linked sites to list")
+	out := fs.String("out", stats.DefaultPath, "file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	host, err := linkcheck.HostOf(cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+	aliases, err := tags.LoadAliases(*aliasPath)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	s := stats.Build(posts, aliases, stats.Options{Gaps: *gaps, Domains: *domains, Host: host})
+	written, err := stats.Write(*out, s)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d post(s), %d word(s), %d tag(s)", s.Posts, s.Words, len(s.Tags))
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/suggest"
+)
+
+var suggestLinksCmd = &command{
+	name:    "suggest-links",
+	summary: "propose internal links where a post mentions another post",
+	run:     runSuggestLinks,
+}
+
+// runSuggestLinks reports, as path:line: "phrase" -> URL (title), the
+// places where a post's prose mentions another post's title or keywords
+// without linking to it. With -write the phrases are turned into links in
+// place; review the diff before committing.
+func runSuggestLinks(ctx context.Context, args []string) error {
+	fs := newFlags("suggest-links", "[post ...]")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	perPost := fs.Int("n", 3, "suggestions per post, 0 for no limit")
+	maxPosts := fs.Int("max-posts", 3, "skip title phrases more than this many posts mention")
+	write := fs.Bool("write", false, "insert the links into the posts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	all, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	posts, err := selectPosts(content.Published(all), fs.Args(), *dir)
+	if err != nil {
+		return err
+	}
+	only := map[string]bool{}
+	for _, p := range posts {
+		only[p.Path] = true
+	}
+
+	byPath := map[string][]suggest.Suggestion{}
+	for _, s := range suggest.Suggest(cfg, all, suggest.Options{PerPost: *perPost, MaxPosts: *maxPosts}) {
+		if only[s.Path] {
+			byPath[s.Path] = append(byPath[s.Path], s)
+		}
+	}
+	var n int
+	for _, p := range posts {
+		ss := byPath[p.Path]
+		for _, s := range ss {
+			fmt.Printf("%s/%s:%s\n", *dir, p.Path, s)
+		}
+		n += len(ss)
+		if !*write || len(ss) == 0 {
+			continue
+		}
+		path := filepath.Join(*dir, filepath.FromSlash(p.Path))
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		head, ok := strings.CutSuffix(string(b), p.Body)
+		if !ok {
+			return fmt.Errorf("%s changed while reading it", path)
+		}
+		if err := os.WriteFile(path, []byte(head+suggest.Apply(p.Body, ss)), 0o644); err != nil {
+			return err
+		}
+	}
+	verb := "suggested"
+	if *write {
+		verb = "inserted"
+	}
+	log.Printf("%d post(s), %d link(s) %s", len(posts), n, verb)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/htmlcheck"
+	"github.com/rednafi/rednafi.com/internal/summarize"
+)
+
+var summarizeCmd = &command{
+	name:    "summarize",
+	summary: "draft summaries and meta descriptions for the posts missing them",
+	run:     runSummarize,
+}
+
+// runSummarize has a language model draft a summary and description for
+// each published post that lacks either, and prints them. With -write the
+// missing keys are added to the posts' front matter; a key the post
+// already sets is never touched, so hand-written ones stay as they are.
+// Review the diff before committing.
+//
+// The model is set by SUMMARIZE_BASE_URL, SUMMARIZE_API_KEY (or
+// OPENAI_API_KEY), and SUMMARIZE_MODEL.
+func runSummarize(ctx context.Context, args []string) error {
+	fs := newFlags("summarize", "[post ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	write := fs.Bool("write", false, "add the drafts to the posts' front matter")
+	timeout := fs.Duration("timeout", 2*time.Minute, "timeout per post")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	all, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	posts, err := selectPosts(content.Articles(content.Published(all)), fs.Args(), *dir)
+	if err != nil {
+		return err
+	}
+	client := summarize.ClientFromEnv()
+	minDesc, maxDesc := htmlcheck.DefaultOptions.MinDescription, htmlcheck.DefaultOptions.MaxDescription
+
+	var drafted, failed int
+	for _, p := range posts {
+		if p.Summary != "" && p.Description != "" {
+			continue
+		}
+		pctx, cancel := context.WithTimeout(ctx, *timeout)
+		d, err := client.Summarize(pctx, p, minDesc, maxDesc)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		path := filepath.Join(*dir, filepath.FromSlash(p.Path))
+		set := map[string]string{}
+		if p.Summary == "" {
+			set["summary"] = d.Summary
+			fmt.Printf("%s: summary: %s\n", filepath.ToSlash(path), d.Summary)
+		}
+		if p.Description == "" {
+			if n := utf8.RuneCountInString(d.Description); n < minDesc || n > maxDesc {
+				log.Printf("%s: drafted description is %d characters, not %d to %d; left out: %s", path, n, minDesc, maxDesc, d.Description)
+				failed++
+			} else {
+				set["description"] = d.Description
+				fmt.Printf("%s: description: %s\n", filepath.ToSlash(path), d.Description)
+			}
+		}
+		drafted++
+		if !*write || len(set) == 0 {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{"summary", "description"} {
+			v, ok := set[key]
+			if !ok {
+				continue
+			}
+			if b, err = content.SetString(b, key, v); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			return err
+		}
+	}
+	verb := "drafted"
+	if *write {
+		verb = "written"
+	}
+	log.Printf("%d post(s) %s, %d description(s) out of bounds", drafted, verb, failed)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/sw"
+)
+
+var swCmd = &command{
+	name:    "sw",
+	summary: "generate the service worker that keeps recent posts for offline reading",
+	run:     runSW,
+}
+
+// runSW writes the service worker into the built site, precaching the home
+// page, the -recent newest posts, and what they load. The manifest hashes
+// the files as deployed, so it runs on every build after the commands that
+// rewrite the pages, `blogctl minify` last among them, and before `blogctl
+// csp`.
+func runSW(ctx context.Context, args []string) error {
+	fs := newFlags("sw", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	public := fs.String("public", "public", "built site to write the service worker into")
+	recent := fs.Int("recent", 10, "newest posts to precache")
+	pages := fs.Int("pages", 30, "visited pages to keep for offline reading")
+	assets := fs.Int("assets", 100, "images and fonts of visited pages to keep")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	urls := []string{"/"}
+	for _, p := range content.Published(posts) {
+		if len(urls) > *recent {
+			break
+		}
+		urls = append(urls, p.RelPermalink())
+	}
+	entries, err := sw.Manifest(*public, urls)
+	if err != nil {
+		return err
+	}
+	changed, err := sw.Write(*public, entries, sw.Options{Pages: *pages, Assets: *assets, Offline: "/"})
+	if err != nil {
+		return err
+	}
+	if changed {
+		log.Printf("wrote %s, precaching %d file(s)", sw.File, len(entries))
+	}
+	return nil
+}
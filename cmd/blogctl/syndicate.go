@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/syndicate"
+)
+
+var syndicateCmd = &command{
+	name:    "syndicate",
+	summary: "cross-post articles to dev.to and Hashnode",
+	run:     runSyndicate,
+}
+
+// runSyndicate publishes the posts named by args (content-relative paths
+// like "go/foo.md") to every configured platform, with the canonical URL
+// pointing at rednafi.com. Posts that are already out are updated in place
+// using the IDs in data/syndication.json. Without args, only posts that
+// were syndicated before are refreshed, and only if they changed.
+//
+// Platforms are enabled by DEVTO_API_KEY and by HASHNODE_TOKEN with
+// HASHNODE_PUBLICATION_ID.
+func runSyndicate(ctx context.Context, args []string) error {
+	fs := newFlags("syndicate", "[post ...]")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", syndicate.DefaultPath, "syndication record")
+	only := fs.String("targets", "", "comma-separated platforms (default: all configured)")
+	force := fs.Bool("force", false, "update articles even if the post didn't change")
+	dryRun := fs.Bool("dry-run", false, "print the converted markdown instead of publishing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	store, err := syndicate.Load(*data)
+	if err != nil {
+		return err
+	}
+	pubs, err := publishers(*only)
+	if err != nil {
+		return err
+	}
+	if len(pubs) == 0 {
+		return errors.New("no platforms configured; set DEVTO_API_KEY or the HASHNODE_* variables")
+	}
+
+	named := fs.Args()
+	for _, n := range named {
+		if !slices.ContainsFunc(posts, func(p *content.Post) bool { return p.Path == n }) {
+			return fmt.Errorf("no post %q under %s", n, *dir)
+		}
+	}
+	var created, updated int
+	for _, p := range content.Published(posts) {
+		key := p.RelPermalink()
+		explicit := slices.Contains(named, p.Path)
+		for _, pub := range pubs {
+			prev, exists := store[key][pub.Name()]
+			if !explicit && (len(named) > 0 || !exists) {
+				continue
+			}
+			canonical := cfg.Permalink(key)
+			a := syndicate.Article{
+				Title:        p.Title,
+				Description:  p.Description,
+				Markdown:     syndicate.Markdown(p.Body, canonical, pub.Flavor()),
+				CanonicalURL: canonical,
+				Tags:         p.Tags,
+			}
+			if a.Description == "" {
+				a.Description = p.Summary
+			}
+			h := articleHash(a)
+			if exists && prev.Hash == h && !*force {
+				continue
+			}
+			if *dryRun {
+				fmt.Printf("==> %s on %s\n%s\n", p.Path, pub.Name(), a.Markdown)
+				continue
+			}
+
+			var r syndicate.Result
+			if exists {
+				r, err = pub.Update(ctx, prev.URI, a)
+				r.PostedAt = prev.PostedAt
+			} else {
+				r, err = pub.Create(ctx, a)
+			}
+			if err != nil {
+				return fmt.Errorf("%s on %s: %w", p.Path, pub.Name(), err)
+			}
+			if exists {
+				updated++
+			} else {
+				created++
+			}
+			r.Hash = h
+			store.Record(key, pub.Name(), r)
+			if err := store.Save(*data); err != nil {
+				return err
+			}
+			fmt.Printf("%s -> %s\n", p.Path, r.URL)
+		}
+	}
+	log.Printf("%d created, %d updated", created, updated)
+	return nil
+}
+
+// publishers returns the configured platforms, narrowed to the names in
+// only if it's set.
+func publishers(only string) ([]syndicate.Publisher, error) {
+	var all []syndicate.Publisher
+	if d := syndicate.DevToFromEnv(); d != nil {
+		all = append(all, d)
+	}
+	if h := syndicate.HashnodeFromEnv(); h != nil {
+		all = append(all, h)
+	}
+	if only == "" {
+		return all, nil
+	}
+	var out []syndicate.Publisher
+	for _, name := range strings.Split(only, ",") {
+		i := slices.IndexFunc(all, func(p syndicate.Publisher) bool { return p.Name() == strings.TrimSpace(name) })
+		if i < 0 {
+			return nil, fmt.Errorf("platform %q isn't configured", name)
+		}
+		out = append(out, all[i])
+	}
+	return out, nil
+}
+
+func articleHash(a syndicate.Article) string {
+	h := sha256.New()
+	for _, s := range []string{a.Title, a.Description, a.Markdown, a.CanonicalURL, strings.Join(a.Tags, ",")} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
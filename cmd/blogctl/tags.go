@@ -0,0 +1,9 @@
+package main
+
+var tagsCmd = &command{
+	name:    "tags",
+	summary: "maintain the tag taxonomy",
+	run: group("blogctl tags", []*command{
+		tagsNormalizeCmd,
+	}),
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+var tagsNormalizeCmd = &command{
+	name:    "normalize",
+	summary: "rewrite tag aliases to their canonical spelling and report orphaned tags",
+	run:     runTagsNormalize,
+}
+
+// runTagsNormalize rewrites the tags of every post, drafts included, to
+// their canonical spelling in place, then lists the tags only one post
+// uses; those are usually typos or candidates for an alias.
+func runTagsNormalize(ctx context.Context, args []string) error {
+	fs := newFlags("tags normalize", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	aliasesPath := fs.String("aliases", tags.DefaultAliases, "alias map")
+	dryRun := fs.Bool("dry-run", false, "report the changes without writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	aliases, err := tags.LoadAliases(*aliasesPath)
+	if err != nil {
+		return err
+	}
+	files, err := content.Files(*dir)
+	if err != nil {
+		return err
+	}
+	var (
+		posts   []*content.Post
+		changed int
+	)
+	for _, rel := range files {
+		path := filepath.Join(*dir, filepath.FromSlash(rel))
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		post, err := content.Parse(rel, b)
+		if err != nil {
+			return err
+		}
+		posts = append(posts, post)
+		norm := aliases.Normalize(post.Tags)
+		if slices.Equal(norm, post.Tags) {
+			continue
+		}
+		fmt.Printf("%s: %s -> %s\n", filepath.ToSlash(path), strings.Join(post.Tags, ", "), strings.Join(norm, ", "))
+		post.Tags = norm
+		changed++
+		if *dryRun {
+			continue
+		}
+		out, err := content.SetList(b, "tags", norm)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return err
+		}
+	}
+
+	orphans := tags.Orphans(posts)
+	names := make([]string, 0, len(orphans))
+	for t := range orphans {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		fmt.Printf("\n%d tag(s) used by a single post:\n", len(names))
+	}
+	for _, t := range names {
+		fmt.Printf("  %-24s %s\n", t, filepath.ToSlash(filepath.Join(*dir, orphans[t])))
+	}
+	verb := "rewrote"
+	if *dryRun {
+		verb = "would rewrite"
+	}
+	log.Printf("%d post(s), %s %d", len(posts), verb, changed)
+	return nil
+}
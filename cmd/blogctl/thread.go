@@ -0,0 +1,155 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/highlight"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/syndicate"
+)
+
+var threadCmd = &command{
+	name:    "thread",
+	summary: "split a post into a Bluesky and Mastodon thread",
+	run:     runThread,
+}
+
+// runThread splits the post with the given slug into a numbered thread for
+// each network, within its character limit, and prints the plan, with the
+// code blocks rendered to PNGs under -out to look over. With -post it
+// posts the thread to every configured target it isn't on yet and records
+// it in data/syndication.json.
+//
+// Posting needs the same credentials as `blogctl announce`.
+func runThread(ctx context.Context, args []string) error {
+	fs := newFlags("thread", "<slug>")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", syndicate.DefaultPath, "syndication record")
+	only := fs.String("targets", "", "comma-separated networks (default: all for the plan, all configured to post)")
+	out := fs.String("out", ".thread", "directory to write the code images to, per slug")
+	post := fs.Bool("post", false, "post the threads instead of only planning them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("thread takes one slug")
+	}
+	slug := fs.Arg(0)
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(content.Published(posts), func(p *content.Post) bool { return p.Slug == slug })
+	if i < 0 {
+		return fmt.Errorf("no published post %q under %s", slug, *dir)
+	}
+	p := content.Published(posts)[i]
+	store, err := syndicate.Load(*data)
+	if err != nil {
+		return err
+	}
+
+	var targets []syndicate.Threader
+	var names []string
+	if *post {
+		configured, err := announceTargets(*only)
+		if err != nil {
+			return err
+		}
+		for _, t := range configured {
+			if th, ok := t.(syndicate.Threader); ok {
+				targets = append(targets, th)
+				names = append(names, t.Name())
+			}
+		}
+		if len(targets) == 0 {
+			return errors.New("no targets configured; set the Bluesky or Mastodon credentials")
+		}
+	} else if *only != "" {
+		for _, n := range strings.Split(*only, ",") {
+			names = append(names, strings.TrimSpace(n))
+		}
+	} else {
+		for n := range syndicate.ThreadLimits {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+	}
+
+	imgDir := filepath.Join(*out, slug)
+	pngs := map[string][]byte{}
+	var posted int
+	for ti, name := range names {
+		limit, ok := syndicate.ThreadLimits[name]
+		if !ok {
+			return fmt.Errorf("%s can't take threads", name)
+		}
+		parts, err := syndicate.Thread(p, cfg.Permalink(p.RelPermalink()), limit)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("==> %s: %d posts of at most %d characters\n", name, len(parts), limit)
+		for j, part := range parts {
+			fmt.Printf("--- %d (%d)\n%s\n", j+1, utf8.RuneCountInString(part.Text), part.Text)
+			if part.Code == nil {
+				continue
+			}
+			key := part.Code.Lang + "\x00" + part.Code.Source
+			if pngs[key] == nil {
+				if pngs[key], err = highlight.PNG(part.Code.Lang, part.Code.Source); err != nil {
+					return fmt.Errorf("%s: %w", p.Path, err)
+				}
+			}
+			part.Code.PNG = pngs[key]
+			img := filepath.Join(imgDir, fmt.Sprintf("%s-%02d.png", name, j+1))
+			if err := os.MkdirAll(imgDir, 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(img, part.Code.PNG, 0o644); err != nil {
+				return err
+			}
+			fmt.Printf("[image: %s, %d lines of %s]\n", img, strings.Count(strings.TrimRight(part.Code.Source, "\n"), "\n")+1, cmp.Or(part.Code.Lang, "text"))
+		}
+		fmt.Println()
+
+		if !*post {
+			continue
+		}
+		t := targets[ti]
+		if store.Announced(p.RelPermalink(), syndicate.ThreadName(name)) {
+			log.Printf("%s: already threaded on %s; skipping", p.Path, name)
+			continue
+		}
+		r, err := t.PostThread(ctx, parts)
+		if err != nil {
+			return fmt.Errorf("%s on %s: %w", p.Path, name, err)
+		}
+		store.Record(p.RelPermalink(), syndicate.ThreadName(name), r)
+		if err := store.Save(*data); err != nil {
+			return err
+		}
+		posted++
+		fmt.Printf("%s -> %s\n", p.Path, r.URL)
+	}
+	if *post {
+		log.Printf("%d thread(s) posted", posted)
+	}
+	return nil
+}
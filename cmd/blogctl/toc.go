@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/toc"
+)
+
+var tocCmd = &command{
+	name:    "toc",
+	summary: "check heading anchors and write data/toc.json",
+	run:     runTOC,
+}
+
+// runTOC writes the tables of contents the toc partial reads as
+// site.Data.toc. Headings that share an anchor, or a bad toc front matter
+// key, fail the command, after the file is written.
+func runTOC(ctx context.Context, args []string) error {
+	fs := newFlags("toc", "")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", toc.DefaultPath, "file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	tocs, problems := toc.Posts(posts)
+	written, err := toc.Write(*out, tocs)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	for _, p := range problems {
+		p.Path = filepath.Join(*dir, p.Path)
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d heading problem(s)", len(problems))
+	}
+	log.Printf("%d table(s) of contents", len(tocs))
+	return nil
+}
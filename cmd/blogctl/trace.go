@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/telemetry"
+)
+
+var traceCmd = &command{
+	name:    "trace",
+	summary: "time the build's stages and report the slow ones",
+	run: group("blogctl trace", []*command{
+		traceReportCmd,
+		traceRunCmd,
+	}),
+}
+
+var traceRunCmd = &command{
+	name:    "run",
+	summary: "run a command as a stage of the build trace",
+	run:     runTraceRun,
+}
+
+// runTraceRun runs a build step that isn't a blogctl command, like hugo or
+// cmd/searchindex, timing it as a stage named by the first argument. blogctl
+// commands time themselves; one run inside the step nests under it.
+func runTraceRun(ctx context.Context, args []string) error {
+	fs := newFlags("trace run", "<stage> [--] <command> [args]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rest := fs.Args()
+	if len(rest) > 1 && rest[1] == "--" {
+		rest = append(rest[:1], rest[2:]...)
+	}
+	if len(rest) < 2 {
+		fs.Usage()
+		return errors.New("need a stage name and a command")
+	}
+
+	ctx, timer := telemetry.Start(ctx, rest[0])
+	cmd := exec.CommandContext(ctx, rest[1], rest[2:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), telemetry.FromEnv().Env(timer.Stage(), timer.Depth()+1)...)
+	err := cmd.Run()
+	if terr := timer.End(err); terr != nil {
+		log.Print(terr)
+	}
+	return err
+}
+
+var traceReportCmd = &command{
+	name:    "report",
+	summary: "write the trace for Perfetto and warn about slow stages",
+	run:     runTraceReport,
+}
+
+// runTraceReport lists how long each stage of the traced build took
+// against the median of the last builds in -baseline, warns about the
+// stages more than -threshold slower, and writes the trace in the Chrome
+// format to -out for ui.perfetto.dev to open. The build's times then join
+// the baseline and the trace file is emptied for the next build. Warnings
+// only fail the build with -fail.
+func runTraceReport(ctx context.Context, args []string) error {
+	trace := os.Getenv(telemetry.EnvTrace)
+	if trace == "" {
+		trace = telemetry.DefaultTrace
+	}
+	fs := newFlags("trace report", "")
+	tracePath := fs.String("trace", trace, "trace file the build recorded")
+	out := fs.String("out", "build-trace.json", "Chrome trace to write; empty to skip")
+	baselinePath := fs.String("baseline", telemetry.DefaultBaseline, "stage times of the last builds; empty to skip")
+	runs := fs.Int("runs", telemetry.DefaultRuns, "builds the baseline remembers")
+	threshold := fs.Float64("threshold", 0.25, "fraction slower than usual a stage may get")
+	floor := fs.Duration("min", 2*time.Second, "least slowdown worth a warning")
+	fail := fs.Bool("fail", false, "fail when a stage is slower than usual")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	spans, err := telemetry.Load(*tracePath)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		b, err := telemetry.Chrome(spans)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out, b, 0o644); err != nil {
+			return err
+		}
+	}
+	base := telemetry.Baseline{}
+	if *baselinePath != "" {
+		if base, err = telemetry.LoadBaseline(*baselinePath); err != nil {
+			return err
+		}
+	}
+
+	stages := telemetry.Stages(spans)
+	var total time.Duration
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tTIME\tUSUAL\tCHANGE")
+	for _, s := range stages {
+		total += s.Dur
+		usual, change := "new", ""
+		if u, ok := base.Usual(s.Name); ok {
+			usual = u.Round(time.Millisecond).String()
+			change = fmt.Sprintf("%+.0f%%", 100*(float64(s.Dur)/float64(max(u, time.Millisecond))-1))
+		}
+		if s.Failed {
+			change = strings.TrimSpace(change + " failed")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.Dur.Round(time.Millisecond), usual, change)
+	}
+	fmt.Fprintf(tw, "total\t%s\t\t\n", total.Round(time.Millisecond))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	slow := telemetry.Regressions(stages, base, *threshold, *floor)
+	for _, r := range slow {
+		log.Printf("warning: %s took %s, usually %s", r.Stage, r.Dur.Round(time.Millisecond), r.Usual.Round(time.Millisecond))
+	}
+	if *out != "" {
+		log.Printf("%d stage(s), %d span(s); open %s in ui.perfetto.dev", len(stages), len(spans), *out)
+	}
+	if *baselinePath != "" {
+		base.Add(stages, *runs)
+		if err := base.Save(*baselinePath); err != nil {
+			return err
+		}
+		// The build is in the baseline now; a second report, or the next
+		// build's spans appended to these, would count it again.
+		if err := os.Truncate(*tracePath, 0); err != nil {
+			return err
+		}
+	}
+	if *fail && len(slow) > 0 {
+		return fmt.Errorf("%d stage(s) slower than usual", len(slow))
+	}
+	return nil
+}
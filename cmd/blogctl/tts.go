@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/podcast"
+	"github.com/rednafi/rednafi.com/internal/r2"
+	"github.com/rednafi/rednafi.com/internal/tts"
+)
+
+var ttsCmd = &command{
+	name:    "tts",
+	summary: "record audio versions of the posts with a text-to-speech backend",
+	run:     runTTS,
+}
+
+// runTTS reads each published post aloud with -backend and uploads the MP3
+// to R2 as <prefix><slug>-<hash>.mp3, cached as immutable since a changed
+// script gets a new name. Posts whose script and voice didn't change since
+// the last recording in data/tts.json are skipped, as are notes, posts with
+// their own `audio`, and posts with `tts: false`.
+//
+// R2 credentials are read as for cmd/r2sync; -base is the URL the bucket
+// is public at.
+func runTTS(ctx context.Context, args []string) error {
+	r2cfg := r2.ConfigFromEnv()
+	fs := newFlags("tts", "[slug ...]")
+	dir := fs.String("content", content.Dir, "content directory")
+	data := fs.String("data", tts.DefaultPath, "recordings manifest")
+	backend := fs.String("backend", "openai", "text-to-speech backend: openai or elevenlabs")
+	model := fs.String("model", "", "backend model (default: the backend's)")
+	voice := fs.String("voice", "", "backend voice (default: the backend's; a voice ID for ElevenLabs)")
+	code := fs.String("code", string(tts.CodeSummarize), "what to do with code blocks: skip or summarize")
+	fs.StringVar(&r2cfg.Bucket, "bucket", r2cfg.Bucket, "bucket to store the recordings in")
+	prefix := fs.String("prefix", "tts/", "key prefix inside the bucket")
+	base := fs.String("base", "", "public URL of the bucket, e.g. https://audio.rednafi.com")
+	force := fs.Bool("force", false, "record the posts again even if they didn't change")
+	dryRun := fs.Bool("dry-run", false, "print what would be recorded and how many characters it is")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if c := tts.Code(*code); c != tts.CodeSkip && c != tts.CodeSummarize {
+		return fmt.Errorf("tts: -code must be skip or summarize, not %q", *code)
+	}
+	if *base == "" && !*dryRun {
+		return errors.New("tts: -base is required")
+	}
+
+	b, err := tts.FromEnv(*backend, *model, *voice)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	manifest, err := tts.Load(*data)
+	if err != nil {
+		return err
+	}
+	var client *r2.Client
+	if !*dryRun {
+		if client, err = r2.New(r2cfg); err != nil {
+			return err
+		}
+	}
+
+	only := fs.Args()
+	var recorded, skipped, chars int
+	for _, p := range content.Articles(content.Published(posts)) {
+		if len(only) > 0 && !slices.Contains(only, p.Slug) {
+			continue
+		}
+		if off, ok := p.Params["tts"].(bool); ok && !off {
+			continue
+		}
+		if a, _ := p.Params["audio"].(string); a != "" {
+			continue
+		}
+		script := tts.Script(p, tts.Code(*code))
+		hash := tts.Hash(script, b)
+		prev, ok := manifest[p.Slug]
+		if ok && prev.Hash == hash && !*force {
+			skipped++
+			continue
+		}
+		n := utf8.RuneCountInString(script)
+		chars += n
+		if *dryRun {
+			fmt.Printf("%s: %d characters in %d chunk(s)\n", p.Path, n, len(tts.Chunks(script, b.Limit())))
+			continue
+		}
+
+		mp3, err := tts.Speak(ctx, b, script)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		d, err := podcast.Probe(bytes.NewReader(mp3), int64(len(mp3)), "post.mp3")
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		key := *prefix + p.Slug + "-" + hash[:12] + ".mp3"
+		if err := client.Put(ctx, key, mp3, r2.PutOptions{
+			ContentType:  "audio/mpeg",
+			CacheControl: "public, max-age=31536000, immutable",
+		}); err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		if ok && prev.Key != key {
+			if err := client.Delete(ctx, prev.Key); err != nil {
+				log.Printf("%s: deleting the old recording: %v", p.Path, err)
+			}
+		}
+		secs := int(d.Seconds() + 0.5)
+		manifest[p.Slug] = tts.Recording{
+			Hash:     hash,
+			Key:      key,
+			Src:      strings.TrimSuffix(*base, "/") + "/" + key,
+			Bytes:    len(mp3),
+			Seconds:  secs,
+			Duration: podcast.FormatDuration(secs),
+		}
+		// Save after each post, so a failure later doesn't lose what's
+		// been paid for.
+		if err := manifest.Save(*data); err != nil {
+			return err
+		}
+		recorded++
+		fmt.Println(manifest[p.Slug].Src)
+	}
+	if *dryRun {
+		log.Printf("%d characters to record, %d post(s) unchanged", chars, skipped)
+		return nil
+	}
+	log.Printf("%d post(s) recorded, %d characters, %d unchanged", recorded, chars, skipped)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/views"
+)
+
+var viewsCmd = &command{
+	name:    "views",
+	summary: "bake view counts from viewcountd into data/views.json",
+	run:     runViews,
+}
+
+// runViews writes the slug → views map the views partial reads as
+// site.Data.views, keeping only published posts. Without a viewcountd URL
+// it does nothing, so the build step is harmless until one is deployed.
+func runViews(ctx context.Context, args []string) error {
+	fs := newFlags("views", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	from := fs.String("from", "", "viewcountd base URL (default params.viewcount)")
+	out := fs.String("out", views.DefaultPath, "file to write")
+	timeout := fs.Duration("timeout", 20*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == "" {
+		cfg, err := site.Load(*config)
+		if err != nil {
+			return err
+		}
+		*from = cfg.Params.ViewCount
+	}
+	if *from == "" {
+		log.Print("params.viewcount isn't set; nothing to bake")
+		return nil
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	counts, err := views.Fetch(ctx, &http.Client{Timeout: *timeout}, *from)
+	if err != nil {
+		return err
+	}
+	baked := map[string]int{}
+	for _, p := range content.Published(posts) {
+		if n, ok := counts[p.Slug]; ok {
+			baked[p.Slug] = n
+		}
+	}
+	written, err := views.Write(*out, baked)
+	if err != nil {
+		return err
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d post(s) with views", len(baked))
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/linkcheck"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/webmention"
+)
+
+var webmentionCmd = &command{
+	name:    "webmention",
+	summary: "send webmentions for published posts",
+	run: group("blogctl webmention", []*command{
+		webmentionSendCmd,
+	}),
+}
+
+var webmentionSendCmd = &command{
+	name:    "send",
+	summary: "notify the pages new and updated posts link to",
+	run:     runWebmentionSend,
+}
+
+// runWebmentionSend sends a mention to every outbound link of posts that
+// are new or whose lastmod moved since the last run, as recorded in the
+// sent-log. Run it after the deploy so sources are live when receivers
+// verify them.
+func runWebmentionSend(ctx context.Context, args []string) error {
+	fs := newFlags("webmention send", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	logPath := fs.String("log", webmention.DefaultSentLog, "sent-log to read and update")
+	timeout := fs.Duration("timeout", 20*time.Second, "per-request timeout")
+	dryRun := fs.Bool("dry-run", false, "list the mentions that would be sent")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	host, err := linkcheck.HostOf(cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	sent, err := webmention.LoadSentLog(*logPath)
+	if err != nil {
+		return err
+	}
+
+	sender := &webmention.Sender{HTTP: &http.Client{Timeout: *timeout}}
+	var total, delivered int
+	for _, p := range content.Published(posts) {
+		if ctx.Err() != nil {
+			break
+		}
+		source := cfg.Permalink(p.RelPermalink())
+		links := outboundURLs(host, []*content.Post{p})
+		pending := sent.Pending(source, p.Updated(), links)
+		if len(pending) == 0 {
+			continue
+		}
+		total += len(pending)
+		if *dryRun {
+			for _, t := range pending {
+				fmt.Printf("%s -> %s\n", source, t)
+			}
+			continue
+		}
+
+		complete := true
+		for _, t := range pending {
+			s, err := mention(ctx, sender, source, t)
+			if err != nil {
+				log.Printf("%s -> %s: %v", source, t, err)
+				complete = false
+				continue
+			}
+			sent.Record(source, t, s)
+			if s.Endpoint != "" {
+				delivered++
+				fmt.Printf("%s -> %s\n", source, t)
+			}
+		}
+		if complete {
+			sent.Done(source, p.Updated(), links)
+		}
+	}
+	log.Printf("%d target(s) pending, %d mention(s) delivered", total, delivered)
+	if *dryRun {
+		return nil
+	}
+	return errors.Join(ctx.Err(), sent.Save(*logPath))
+}
+
+// mention discovers target's endpoint and notifies it. Targets without an
+// endpoint are recorded too, so they aren't rediscovered every run.
+func mention(ctx context.Context, s *webmention.Sender, source, target string) (webmention.Sent, error) {
+	now := time.Now().UTC()
+	endpoint, err := s.Discover(ctx, target)
+	if errors.Is(err, webmention.ErrNoEndpoint) {
+		return webmention.Sent{At: now}, nil
+	}
+	if err != nil {
+		return webmention.Sent{}, err
+	}
+	if err := s.Send(ctx, endpoint, source, target); err != nil {
+		return webmention.Sent{}, err
+	}
+	return webmention.Sent{Endpoint: endpoint, At: now}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/gitmeta"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/wellknown"
+)
+
+var wellknownCmd = &command{
+	name:    "wellknown",
+	summary: "generate security.txt, humans.txt, and verification files",
+	run:     runWellknown,
+}
+
+// runWellknown writes the files configured under params.wellknown to -out,
+// which Hugo copies into the build. security.txt's expiry is set from the
+// day it runs, so CI keeps it current, and the file is checked against
+// RFC 9116 before it's written. humans.txt's last update is the newest
+// post's, dated by data/gitmeta.json when `blogctl gitmeta` has run.
+func runWellknown(ctx context.Context, args []string) error {
+	fs := newFlags("wellknown", "")
+	config := fs.String("config", site.ConfigPath, "Hugo config file")
+	dir := fs.String("content", content.Dir, "content directory")
+	out := fs.String("out", "static", "directory to write the files into")
+	history := fs.String("gitmeta", gitmeta.DefaultPath, "post history from blogctl gitmeta")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		return err
+	}
+	meta, err := gitmeta.Load(*history)
+	if err != nil {
+		return err
+	}
+	gitmeta.Apply(posts, meta)
+	var updated time.Time
+	for _, p := range content.Published(posts) {
+		if p.Updated().After(updated) {
+			updated = p.Updated()
+		}
+	}
+
+	files, err := wellknown.Files(cfg, time.Now(), updated)
+	if err != nil {
+		return err
+	}
+	written, err := wellknown.Write(*out, files)
+	for _, p := range written {
+		fmt.Println(p)
+	}
+	log.Printf("%d file(s), %d updated", len(files), len(written))
+	return err
+}
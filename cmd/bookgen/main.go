@@ -0,0 +1,144 @@
+// Command bookgen bundles a set of posts into a book for reading offline:
+// an EPUB for e-readers and a PDF, each with a generated cover, a table of
+// contents, and highlighted code. The posts are either every post with
+// -tag, oldest first, or the slugs listed in -posts, in that order.
+//
+// Images are downloaded and embedded; those that can't be are shown as
+// links to the original. -images=false skips the downloads.
+//
+// Usage:
+//
+//	bookgen -tag go [-title "Notes on Go"] [-out go] [-formats epub,pdf] [-paper A5]
+//	bookgen -posts pathlib,contextmanager,dataclasses -title "Python odds and ends"
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/book"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bookgen: ")
+
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	dir := flag.String("content", content.Dir, "content directory")
+	tag := flag.String("tag", "", "bundle the posts with this tag")
+	list := flag.String("posts", "", "comma-separated slugs to bundle, in order, instead of -tag")
+	title := flag.String("title", "", "book title (defaults to the tag, or the site title)")
+	out := flag.String("out", "", "output path without extension (defaults to the tag, or \"book\")")
+	formats := flag.String("formats", "epub,pdf", "comma-separated formats to write: epub, pdf")
+	paper := flag.String("paper", "A5", "PDF page size: "+strings.Join(book.Papers, ", "))
+	images := flag.Bool("images", true, "download the posts' images to embed them")
+	timeout := flag.Duration("timeout", 30*time.Second, "per-image download timeout")
+	flag.Parse()
+
+	var slugs []string
+	if *list != "" {
+		slugs = strings.Split(*list, ",")
+	}
+	if *tag == "" && len(slugs) == 0 {
+		log.Fatal("-tag or -posts is required")
+	}
+	if !slices.Contains(book.Papers, *paper) {
+		log.Fatalf("-paper %s: want one of %s", *paper, strings.Join(book.Papers, ", "))
+	}
+	var want []string
+	for _, f := range strings.Split(*formats, ",") {
+		if f = strings.TrimSpace(f); f != "epub" && f != "pdf" {
+			log.Fatalf("-formats: unknown format %q", f)
+		}
+		want = append(want, strings.TrimSpace(f))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, *config, *dir, *tag, slugs, *title, *out, want, *paper, *images, *timeout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, config, dir, tag string, slugs []string, title, out string, formats []string, paper string, images bool, timeout time.Duration) error {
+	cfg, err := site.Load(config)
+	if err != nil {
+		return err
+	}
+	posts, err := content.Load(dir)
+	if err != nil {
+		return err
+	}
+	posts, err = book.Select(posts, tag, slugs)
+	if err != nil {
+		return err
+	}
+	switch {
+	case title != "":
+	case len(slugs) == 0:
+		title = tagName(posts, tag)
+	default:
+		title = cfg.Title
+	}
+	if out == "" {
+		out = "book"
+		if len(slugs) == 0 {
+			out = content.TagSlug(tag)
+		}
+	}
+
+	b, err := book.New(cfg, title, posts)
+	if err != nil {
+		return err
+	}
+	if images {
+		for _, err := range b.Fetch(ctx, &http.Client{Timeout: timeout}) {
+			log.Print(err)
+		}
+	}
+
+	for _, f := range formats {
+		var buf bytes.Buffer
+		switch f {
+		case "epub":
+			err = book.WriteEPUB(&buf, b)
+		case "pdf":
+			err = book.WritePDF(&buf, b, paper)
+		}
+		if err != nil {
+			return err
+		}
+		path := out + "." + f
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	log.Printf("%q: %d chapter(s)", title, len(b.Chapters))
+	return nil
+}
+
+// tagName returns tag as the posts spell it, so -tag go titles the book
+// "Go".
+func tagName(posts []*content.Post, tag string) string {
+	for _, p := range posts {
+		for _, t := range p.Tags {
+			if content.TagSlug(t) == content.TagSlug(tag) {
+				return t
+			}
+		}
+	}
+	return tag
+}
@@ -0,0 +1,83 @@
+// Command bookmarks imports the articles I've saved in Readwise Reader or
+// Pocket into data/bookmarks/, one bookmark per URL across both, and
+// regenerates the Reading section from everything kept there: pages of 30
+// bookmarks at /reading/, and the same per tag at /reading/tags/<tag>/,
+// each with its highlights.
+//
+// The imports are saved responses of the services' APIs: Reader's
+// GET /api/v3/list/ and Pocket's GET /v3/get?detailType=complete. Without
+// any, it only regenerates the section.
+//
+// Usage:
+//
+//	bookmarks [-readwise reader.json] [-pocket pocket.json] [-data data/bookmarks] [-per-page 30]
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/rednafi/rednafi.com/internal/bookmarks"
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bookmarks: ")
+
+	readwise := flag.String("readwise", "", "Readwise Reader list API export to import")
+	pocket := flag.String("pocket", "", "Pocket retrieve API export to import")
+	dataDir := flag.String("data", bookmarks.DefaultDir, "directory the bookmarks are kept in")
+	dir := flag.String("content", content.Dir, "content directory to write the section's pages into")
+	out := flag.String("out", bookmarks.DefaultSection, "file to write the section's pages to")
+	perPage := flag.Int("per-page", 30, "bookmarks per page")
+	dryRun := flag.Bool("dry-run", false, "report what an import would add without writing anything")
+	flag.Parse()
+
+	kept, err := bookmarks.Load(*dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var imported []bookmarks.Bookmark
+	for _, src := range []struct {
+		path  string
+		parse func([]byte) ([]bookmarks.Bookmark, error)
+	}{
+		{*readwise, bookmarks.ParseReadwise},
+		{*pocket, bookmarks.ParsePocket},
+	} {
+		if src.path == "" {
+			continue
+		}
+		b, err := os.ReadFile(src.path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		bs, err := src.parse(b)
+		if err != nil {
+			log.Fatalf("%s: %v", src.path, err)
+		}
+		log.Printf("%s: %d bookmark(s)", src.path, len(bs))
+		imported = append(imported, bs...)
+	}
+	all, added, err := bookmarks.Merge(kept, imported)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d bookmark(s), %d new", len(all), added)
+	if *dryRun {
+		return
+	}
+
+	saved, err := bookmarks.Save(*dataDir, all)
+	if err != nil {
+		log.Fatal(err)
+	}
+	section := bookmarks.Layout(all, *perPage)
+	written, err := section.Write(*dir, *out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d page(s), %d tag(s); updated %d file(s)", len(section.Pages), len(section.Tags), saved+written)
+}
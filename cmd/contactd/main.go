@@ -0,0 +1,165 @@
+// Command contactd receives the site's contact form and mails each message
+// to the author over SMTP or the Mailgun API, with the sender in Reply-To.
+// Bots are turned away by a honeypot field and a token bucket per client
+// IP.
+//
+// The mailer is configured from CONTACT_FROM and CONTACT_TO plus, for
+// -via smtp, SMTP_ADDR, SMTP_USERNAME, and SMTP_PASSWORD, or, for
+// -via mailgun, MAILGUN_API_KEY, MAILGUN_DOMAIN, and MAILGUN_ENDPOINT.
+//
+// Usage:
+//
+//	contactd [-addr :8084] [-via smtp|mailgun] [-origin https://rednafi.com] [-thanks /contact/thanks/]
+//
+// Endpoints:
+//
+//	POST /contact   form-encoded name, email, subject, message, and page
+//	GET  /healthz   200 while the server is up
+//
+// Responses are JSON: {"ok": true}, or {"error": "...", "fields": {...}}
+// with the invalid fields and what's wrong with each. A form posted
+// without JavaScript is redirected to -thanks instead, when it's set.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/contact"
+	"github.com/rednafi/rednafi.com/internal/ratelimit"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("contactd: ")
+
+	addr := flag.String("addr", ":8084", "listen address")
+	via := flag.String("via", "smtp", "delivery: smtp or mailgun")
+	origin := flag.String("origin", "https://rednafi.com", "site the form is on; posts from other origins are refused")
+	thanks := flag.String("thanks", "", "URL to redirect forms posted without JavaScript to")
+	ipHeader := flag.String("ip-header", "", "header with the client IP when behind a proxy, e.g. CF-Connecting-IP")
+	every := flag.Duration("every", 10*time.Minute, "after a burst, allow one message per client IP this often")
+	burst := flag.Int("burst", 3, "messages a client IP may send at once")
+	flag.Parse()
+
+	mailer, err := contact.FromEnv(*via)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := &server{
+		mailer:   mailer,
+		limiter:  ratelimit.New(*every, *burst),
+		origin:   strings.TrimSuffix(*origin, "/"),
+		thanks:   *thanks,
+		ipHeader: *ipHeader,
+		every:    *every,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go s.limiter.PruneEvery(ctx, time.Minute)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /contact", s.contact)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("mailing messages via %s; listening on %s", *via, *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	mailer   contact.Mailer
+	limiter  *ratelimit.Limiter
+	origin   string
+	thanks   string
+	ipHeader string
+	every    time.Duration
+}
+
+// reply is the JSON body of every response.
+type reply struct {
+	OK     bool                `json:"ok,omitempty"`
+	Error  string              `json:"error,omitempty"`
+	Fields contact.FieldErrors `json:"fields,omitempty"`
+}
+
+func (s *server) contact(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+	if o := r.Header.Get("Origin"); o != "" && o != s.origin {
+		respond(w, http.StatusForbidden, reply{Error: "the form can only be sent from " + s.origin})
+		return
+	}
+	ip := ratelimit.ClientIP(r, s.ipHeader)
+	if !s.limiter.Allow(ip, time.Now()) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.every.Seconds())))
+		respond(w, http.StatusTooManyRequests, reply{Error: "too many messages; try again later"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		respond(w, http.StatusBadRequest, reply{Error: "couldn't read the form"})
+		return
+	}
+	if contact.Spam(r.PostForm) {
+		// Look like it worked, so the bot doesn't learn anything.
+		log.Printf("%s: honeypot filled; dropped", ip)
+		s.done(w, r)
+		return
+	}
+	m, errs := contact.Parse(r.PostForm, time.Now())
+	if errs != nil {
+		respond(w, http.StatusUnprocessableEntity, reply{Error: "please fix the highlighted fields", Fields: errs})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	if err := s.mailer.Send(ctx, m); err != nil {
+		log.Print(err)
+		respond(w, http.StatusBadGateway, reply{Error: "couldn't send the message; please try again later"})
+		return
+	}
+	log.Printf("%s: mailed message from %s", ip, m.Email)
+	s.done(w, r)
+}
+
+// done answers a message that went through: a redirect for a browser that
+// posted the form itself, JSON for the form's script.
+func (s *server) done(w http.ResponseWriter, r *http.Request) {
+	if s.thanks != "" && !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		http.Redirect(w, r, s.thanks, http.StatusSeeOther)
+		return
+	}
+	respond(w, http.StatusOK, reply{OK: true})
+}
+
+func respond(w http.ResponseWriter, status int, v reply) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,213 @@
+// Command cspreportd collects the Content-Security-Policy violations
+// browsers report for the policies `blogctl csp` builds, and logs each one
+// as a line of JSON, so a page that breaks under its policy shows up in the
+// logs rather than only in a reader's console. Nothing is stored; client
+// IPs are only held in memory for rate limiting.
+//
+// Usage:
+//
+//	cspreportd [-addr :8087] [-origin https://rednafi.com]
+//
+// Endpoints:
+//
+//	POST /report    a report-uri (application/csp-report) or report-to
+//	                (application/reports+json) body; 204 once logged
+//	GET  /healthz   200 while the server is up
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/ratelimit"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("cspreportd: ")
+
+	addr := flag.String("addr", ":8087", "listen address")
+	origin := flag.String("origin", "https://rednafi.com", "allowed CORS origin")
+	ipHeader := flag.String("ip-header", "", "header with the client IP when behind a proxy, e.g. CF-Connecting-IP")
+	every := flag.Duration("every", time.Second, "after a burst, allow one report per client IP this often")
+	burst := flag.Int("burst", 20, "reports a client IP may send at once")
+	flag.Parse()
+
+	s := &server{
+		log:      slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		limiter:  ratelimit.New(*every, *burst),
+		origin:   *origin,
+		ipHeader: *ipHeader,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go s.limiter.PruneEvery(ctx, time.Minute)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /report", s.report)
+	mux.HandleFunc("OPTIONS /report", s.preflight)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("collecting reports on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	log      *slog.Logger
+	limiter  *ratelimit.Limiter
+	origin   string
+	ipHeader string
+}
+
+// violation is what's logged of a report, whichever format it came in.
+type violation struct {
+	Document    string
+	Referrer    string
+	Blocked     string
+	Directive   string
+	Disposition string
+	Source      string
+	Line        int
+	Column      int
+	Sample      string
+	Status      int
+	UserAgent   string
+}
+
+// cspReport is the body report-uri sends.
+type cspReport struct {
+	Report struct {
+		Document    string `json:"document-uri"`
+		Referrer    string `json:"referrer"`
+		Blocked     string `json:"blocked-uri"`
+		Effective   string `json:"effective-directive"`
+		Violated    string `json:"violated-directive"`
+		Disposition string `json:"disposition"`
+		Source      string `json:"source-file"`
+		Line        int    `json:"line-number"`
+		Column      int    `json:"column-number"`
+		Sample      string `json:"script-sample"`
+		Status      int    `json:"status-code"`
+	} `json:"csp-report"`
+}
+
+// report is one of the reports report-to sends; other types than
+// csp-violation are ignored.
+type report struct {
+	Type      string `json:"type"`
+	UserAgent string `json:"user_agent"`
+	Body      struct {
+		Document    string `json:"documentURL"`
+		Referrer    string `json:"referrer"`
+		Blocked     string `json:"blockedURL"`
+		Directive   string `json:"effectiveDirective"`
+		Disposition string `json:"disposition"`
+		Source      string `json:"sourceFile"`
+		Line        int    `json:"lineNumber"`
+		Column      int    `json:"columnNumber"`
+		Sample      string `json:"sample"`
+		Status      int    `json:"statusCode"`
+	} `json:"body"`
+}
+
+func (s *server) cors(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+}
+
+// preflight lets pages send reports with their JSON content types, which
+// the Reporting API may check first.
+func (s *server) preflight(w http.ResponseWriter, r *http.Request) {
+	s.cors(w)
+	w.Header().Set("Access-Control-Allow-Methods", "POST")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Max-Age", "86400")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) report(w http.ResponseWriter, r *http.Request) {
+	s.cors(w)
+	if !s.limiter.Allow(ratelimit.ClientIP(r, s.ipHeader), time.Now()) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many reports, slow down", http.StatusTooManyRequests)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var vs []violation
+	switch ctype {
+	case "application/csp-report", "application/json":
+		var b cspReport
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			http.Error(w, "malformed report", http.StatusBadRequest)
+			return
+		}
+		c := b.Report
+		directive := c.Effective
+		if directive == "" {
+			directive = c.Violated
+		}
+		vs = append(vs, violation{c.Document, c.Referrer, c.Blocked, directive, c.Disposition, c.Source, c.Line, c.Column, c.Sample, c.Status, r.UserAgent()})
+	case "application/reports+json":
+		var b []report
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			http.Error(w, "malformed reports", http.StatusBadRequest)
+			return
+		}
+		for _, rep := range b {
+			if rep.Type != "csp-violation" {
+				continue
+			}
+			ua := rep.UserAgent
+			if ua == "" {
+				ua = r.UserAgent()
+			}
+			c := rep.Body
+			vs = append(vs, violation{c.Document, c.Referrer, c.Blocked, c.Directive, c.Disposition, c.Source, c.Line, c.Column, c.Sample, c.Status, ua})
+		}
+	default:
+		http.Error(w, "want application/csp-report or application/reports+json", http.StatusUnsupportedMediaType)
+		return
+	}
+	for _, v := range vs {
+		s.log.LogAttrs(r.Context(), slog.LevelWarn, "csp violation",
+			slog.String("document", v.Document),
+			slog.String("referrer", v.Referrer),
+			slog.String("blocked", v.Blocked),
+			slog.String("directive", v.Directive),
+			slog.String("disposition", v.Disposition),
+			slog.String("source", v.Source),
+			slog.Int("line", v.Line),
+			slog.Int("column", v.Column),
+			slog.String("sample", v.Sample),
+			slog.Int("status", v.Status),
+			slog.String("user_agent", v.UserAgent),
+		)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+// Command fedicomments fetches the replies to each post's Bluesky and
+// Mastodon announcement, as recorded in data/syndication.json by
+// `blogctl announce`, and writes them to data/comments/<slug>.json for the
+// comments partial to render at build time.
+//
+// A post's file is only rewritten when every one of its threads was fetched,
+// so a flaky API can't wipe out comments that were already collected. With
+// -db, comments from accounts on the domains `blogctl comments
+// block-domain` blocked in cmd/webmentiond's database are left out.
+//
+// Usage:
+//
+//	fedicomments [-content content] [-syndication data/syndication.json] [-out data/comments] [-db webmentions.db]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/comments"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/syndicate"
+	"github.com/rednafi/rednafi.com/internal/webmention"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("fedicomments: ")
+
+	dir := flag.String("content", content.Dir, "content directory")
+	synPath := flag.String("syndication", syndicate.DefaultPath, "announcement record")
+	out := flag.String("out", comments.DefaultDir, "directory to write comment files into")
+	timeout := flag.Duration("timeout", 30*time.Second, "per-request timeout")
+	dbPath := flag.String("db", "", "webmentiond database whose blocked domains to leave out")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := syndicate.Load(*synPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var blocked []string
+	if *dbPath != "" {
+		wm, err := webmention.OpenStore(*dbPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		blocked, err = wm.Blocked(ctx)
+		wm.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	sources := map[string]comments.Source{}
+	for _, s := range []comments.Source{
+		&comments.Mastodon{HTTP: client},
+		&comments.Bluesky{HTTP: client},
+	} {
+		sources[s.Network()] = s
+	}
+
+	var failed, written int
+	for _, p := range content.Published(posts) {
+		announced := store[p.RelPermalink()]
+		if len(announced) == 0 {
+			continue
+		}
+		f, err := collect(ctx, sources, announced)
+		if err != nil {
+			log.Printf("%s: %v", p.Path, err)
+			failed++
+			continue
+		}
+		f.Drop(func(c comments.Comment) bool {
+			return slices.ContainsFunc(c.Author.Hosts(), func(h string) bool { return webmention.OnDomain(h, blocked) })
+		})
+		ok, err := comments.Write(*out, p.Slug, f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ok {
+			written++
+			fmt.Printf("%s: %d comment(s)\n", p.Slug, len(f.Comments))
+		}
+	}
+	log.Printf("%d file(s) updated", written)
+	if failed > 0 {
+		log.Fatalf("%d post(s) failed", failed)
+	}
+}
+
+// collect fetches every thread of one post.
+func collect(
+	ctx context.Context,
+	sources map[string]comments.Source,
+	announced map[string]syndicate.Result,
+) (comments.File, error) {
+	f := comments.File{Threads: map[string]string{}, Comments: []comments.Comment{}}
+	networks := make([]string, 0, len(announced))
+	for n := range announced {
+		networks = append(networks, n)
+	}
+	sort.Strings(networks)
+	for _, n := range networks {
+		src, ok := sources[n]
+		if !ok {
+			continue
+		}
+		r := announced[n]
+		cs, err := src.Replies(ctx, r.URI, r.URL)
+		if err != nil {
+			return f, fmt.Errorf("%s: %w", n, err)
+		}
+		f.Threads[n] = r.URL
+		f.Comments = append(f.Comments, cs...)
+	}
+	comments.Sort(f.Comments)
+	return f, nil
+}
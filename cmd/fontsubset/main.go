@@ -0,0 +1,48 @@
+// Command fontsubset cuts the WOFF2 fonts the built site's @font-face rules
+// load down to the characters its pages use, and adds a unicode-range to
+// each rule so browsers only fetch a font for text it covers. The pages'
+// text, the attributes browsers show, and CSS content strings are
+// scanned; glyphs the fonts substitute for them, like the ligatures of
+// code fonts for -> or !=, are kept too. Fonts with CFF outlines are left
+// alone.
+//
+// Run it on public/ after Hugo and before `blogctl fingerprint`.
+//
+// Usage:
+//
+//	fontsubset [-public public] [-keep chars] [-dry-run]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/fontsubset"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("fontsubset: ")
+
+	public := flag.String("public", "public", "built site")
+	keep := flag.String("keep", fontsubset.DefaultKeep, "characters to keep whether the site uses them or not")
+	dryRun := flag.Bool("dry-run", false, "print what would be subset without writing")
+	flag.Parse()
+
+	fonts, err := fontsubset.Run(*public, fontsubset.Options{Keep: *keep, DryRun: *dryRun})
+	if err != nil {
+		log.Fatal(err)
+	}
+	var before, after int
+	for _, f := range fonts {
+		before += f.Before
+		after += f.After
+		if f.Skipped != nil {
+			fmt.Printf("%s: skipped: %v\n", f.Path, f.Skipped)
+			continue
+		}
+		fmt.Printf("%s: %d -> %d bytes, %d of %d glyphs\n", f.Path, f.Before, f.After, f.Glyphs, f.Total)
+	}
+	log.Printf("%d font(s), %d bytes saved", len(fonts), before-after)
+}
@@ -0,0 +1,102 @@
+// Command gallery builds the Photos section from the JPEGs dropped into
+// photos/: the top-level ones and an album per folder at /photos/ and
+// /photos/<album>/, laid out as justified grids, and a page per photo at
+// /photos/<album>/<photo>/ with the camera, lens, exposure, and date from
+// its EXIF. An album.toml in a folder can title the album, pick its cover,
+// and caption its photos.
+//
+// The variants, in static/gallery/, carry no EXIF, and where the photos
+// were taken isn't published unless -location is set. The originals keep
+// their GPS coordinates, though; -strip-gps removes them in place before
+// the originals are committed. Photos whose bytes didn't change since the
+// last run aren't encoded again.
+//
+// Usage:
+//
+//	gallery [-src photos] [-static static] [-out gallery] [-widths 400,800,1600,2400] [-quality 60] [-location] [-strip-gps] [-j n] [-force]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/gallery"
+	"github.com/rednafi/rednafi.com/internal/imgopt"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gallery: ")
+
+	src := flag.String("src", gallery.DefaultSource, "folder of original photos, one album per subfolder")
+	root := flag.String("static", "static", "static directory")
+	out := flag.String("out", gallery.DefaultDir, "variants, relative to -static")
+	dir := flag.String("content", content.Dir, "content directory to write the section's pages into")
+	data := flag.String("data", gallery.DefaultData, "file to write the section's pages to")
+	widthList := flag.String("widths", joinInts(gallery.DefaultWidths), "comma-separated variant widths")
+	quality := flag.Int("quality", 60, "AVIF and WebP quality, 0-100")
+	location := flag.Bool("location", false, "publish where the photos were taken, to about a kilometre")
+	strip := flag.Bool("strip-gps", false, "remove the GPS coordinates from the originals in -src")
+	jobs := flag.Int("j", runtime.NumCPU(), "photos to encode in parallel")
+	force := flag.Bool("force", false, "re-encode every photo")
+	flag.Parse()
+
+	widths, err := parseInts(*widthList)
+	if err != nil {
+		log.Fatalf("-widths: %v", err)
+	}
+	prev, err := gallery.Load(*data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g, r, err := gallery.Build(*src, prev, gallery.Options{
+		Static:   *root,
+		Dir:      *out,
+		Images:   imgopt.Options{Widths: widths, Quality: *quality},
+		Location: *location,
+		StripGPS: *strip,
+		Force:    *force,
+		Jobs:     *jobs,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	written, err := g.Write(*dir, *data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if written > 0 {
+		fmt.Println(*data)
+	}
+	log.Printf("%d photo(s) in %d album(s), %d encoded, %d removed, %d stripped of GPS", r.Photos, len(g.Albums)-1, r.Encoded, r.Removed, r.Stripped)
+}
+
+func parseInts(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("width %d must be positive", n)
+		}
+		out = append(out, n)
+	}
+	sort.Ints(out)
+	return out, nil
+}
+
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,206 @@
+// Command hookd rebuilds and deploys the site when a webhook says it
+// should: a push to the default branch on GitHub, a Buttondown subscriber
+// event, or an IFTTT applet. Each sender's webhooks are verified with its
+// own secret, from HOOKD_GITHUB_SECRET, HOOKD_BUTTONDOWN_SECRET, and
+// HOOKD_IFTTT_TOKEN; a sender without one is refused. Only the events on
+// the allowlist start a build, and webhooks that arrive while one runs
+// queue a single follow-up build between them. Every webhook, accepted or
+// not, and every build is logged as a line of JSON.
+//
+// Usage:
+//
+//	hookd [-addr :8088] -run "hugo --gc --minify && blogctl deploy" [-events github:push,ifttt:rebuild] [-branch main]
+//
+// Endpoints:
+//
+//	POST /hooks/<source>   a webhook from github, buttondown, or ifttt;
+//	                       202 if it starts a build, 200 if it's ignored
+//	GET  /healthz          200 while the server is up
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/ratelimit"
+	"github.com/rednafi/rednafi.com/internal/webhook"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("hookd: ")
+
+	addr := flag.String("addr", ":8088", "listen address")
+	run := flag.String("run", "", "shell command that rebuilds and deploys the site")
+	events := flag.String("events", "github:push,buttondown:subscriber.confirmed,ifttt:rebuild", "comma-separated source:event pairs that trigger a build")
+	branch := flag.String("branch", "main", "branch whose GitHub pushes trigger a build")
+	timeout := flag.Duration("timeout", 30*time.Minute, "longest a build may run")
+	ipHeader := flag.String("ip-header", "", "header with the client IP when behind a proxy, e.g. CF-Connecting-IP")
+	every := flag.Duration("every", 10*time.Second, "after a burst, allow one webhook per client IP this often")
+	burst := flag.Int("burst", 10, "webhooks a client IP may send at once")
+	flag.Parse()
+
+	if *run == "" {
+		log.Fatal("-run is required")
+	}
+	allow, err := webhook.ParseAllowlist(*events)
+	if err != nil {
+		log.Fatal(err)
+	}
+	secrets := map[string]string{}
+	for name, src := range webhook.Sources {
+		if secrets[name] = os.Getenv(src.SecretEnv); secrets[name] == "" {
+			log.Printf("%s isn't set; refusing %s webhooks", src.SecretEnv, name)
+		}
+	}
+
+	s := &server{
+		log:      slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		limiter:  ratelimit.New(*every, *burst),
+		allow:    allow,
+		secrets:  secrets,
+		ref:      "refs/heads/" + *branch,
+		ipHeader: *ipHeader,
+		queue:    make(chan webhook.Event, 1),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go s.limiter.PruneEvery(ctx, time.Minute)
+	go s.build(ctx, *run, *timeout)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/{source}", s.hook)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("listening on %s for %s", *addr, allow)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	log      *slog.Logger
+	limiter  *ratelimit.Limiter
+	allow    webhook.Allowlist
+	secrets  map[string]string
+	ref      string
+	ipHeader string
+	// queue holds the one build waiting for the running one to finish.
+	queue chan webhook.Event
+}
+
+func (s *server) hook(w http.ResponseWriter, r *http.Request) {
+	ip := ratelimit.ClientIP(r, s.ipHeader)
+	name := r.PathValue("source")
+	audit := func(level slog.Level, outcome string, e webhook.Event, attrs ...slog.Attr) {
+		s.log.LogAttrs(r.Context(), level, "webhook", append([]slog.Attr{
+			slog.String("outcome", outcome),
+			slog.String("source", name),
+			slog.String("event", e.Name),
+			slog.String("delivery", e.Delivery),
+			slog.String("ip", ip),
+			slog.String("user_agent", r.UserAgent()),
+		}, attrs...)...)
+	}
+
+	if !s.limiter.Allow(ip, time.Now()) {
+		audit(slog.LevelWarn, "rate_limited", webhook.Event{})
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many webhooks, slow down", http.StatusTooManyRequests)
+		return
+	}
+	src, ok := webhook.Sources[name]
+	if !ok {
+		audit(slog.LevelWarn, "unknown_source", webhook.Event{})
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		audit(slog.LevelWarn, "unreadable", webhook.Event{}, slog.String("error", err.Error()))
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	e, err := src.Read(r.Header, body, s.secrets[name])
+	if errors.Is(err, webhook.ErrSignature) {
+		audit(slog.LevelWarn, "bad_signature", e)
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		audit(slog.LevelWarn, "malformed", e, slog.String("error", err.Error()))
+		http.Error(w, "malformed webhook", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case !s.allow.Allows(e):
+		audit(slog.LevelInfo, "ignored", e)
+	case e.Source == "github" && e.Name == "push" && e.Ref != s.ref:
+		audit(slog.LevelInfo, "ignored", e, slog.String("ref", e.Ref))
+	default:
+		select {
+		case s.queue <- e:
+			audit(slog.LevelInfo, "queued", e)
+		default:
+			// The queued build will pick up whatever this one is about.
+			audit(slog.LevelInfo, "coalesced", e)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// build runs command once per queued event until ctx is done, logging how
+// each run went.
+func (s *server) build(ctx context.Context, command string, timeout time.Duration) {
+	for {
+		var e webhook.Event
+		select {
+		case <-ctx.Done():
+			return
+		case e = <-s.queue:
+		}
+		start := time.Now()
+		bctx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(bctx, "sh", "-c", command)
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		err := cmd.Run()
+		cancel()
+		attrs := []slog.Attr{
+			slog.String("source", e.Source),
+			slog.String("event", e.Name),
+			slog.String("delivery", e.Delivery),
+			slog.String("duration", time.Since(start).Round(time.Millisecond).String()),
+		}
+		if err != nil {
+			s.log.LogAttrs(ctx, slog.LevelError, "build failed", append(attrs, slog.String("error", err.Error()))...)
+			continue
+		}
+		s.log.LogAttrs(ctx, slog.LevelInfo, "build succeeded", attrs...)
+	}
+}
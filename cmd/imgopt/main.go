@@ -0,0 +1,255 @@
+// Command imgopt generates responsive variants of the images under
+// static/images/: AVIF and WebP at several widths plus a resized fallback in
+// the original format, all stripped of EXIF. It records each image's
+// dimensions, variants, and a blurred placeholder in data/images.json, which
+// the img shortcode turns into a <picture> that doesn't shift the layout.
+//
+// Images whose bytes didn't change since the last run are skipped. Variants
+// of deleted images are removed.
+//
+// An image named like cover.dark.png is the dark variant of cover.png; the
+// manifest links the two, and `{{< img src="/images/cover.png" dark=true >}}`
+// shows it to readers who prefer a dark color scheme. imgopt fails when a
+// post declares a dark variant that doesn't exist, or a dark variant has no
+// light image.
+//
+// Usage:
+//
+//	imgopt [-static static] [-in images] [-out images/opt] [-content content] [-widths 480,960,1600] [-quality 60] [-j n] [-force]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/imgopt"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("imgopt: ")
+
+	root := flag.String("static", "static", "static directory")
+	in := flag.String("in", "images", "source images, relative to -static")
+	out := flag.String("out", "images/opt", "variants, relative to -static")
+	skip := flag.String("skip", "og", "comma-separated directories under -in to leave alone")
+	manifestPath := flag.String("manifest", imgopt.DefaultManifest, "manifest to write")
+	posts := flag.String("content", content.Dir, "content directory whose img shortcodes are checked for dark variants")
+	widthList := flag.String("widths", joinInts(imgopt.DefaultWidths), "comma-separated variant widths")
+	quality := flag.Int("quality", 60, "AVIF and WebP quality, 0-100")
+	jobs := flag.Int("j", runtime.NumCPU(), "images to encode in parallel")
+	force := flag.Bool("force", false, "re-encode every image")
+	flag.Parse()
+
+	widths, err := parseInts(*widthList)
+	if err != nil {
+		log.Fatalf("-widths: %v", err)
+	}
+	o := imgopt.Options{Widths: widths, Quality: *quality}
+
+	if err := run(*root, *in, *out, strings.Split(*skip, ","), *manifestPath, *posts, o, *jobs, *force); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type source struct {
+	name string // path relative to the images directory
+	key  string // URL path, the manifest key
+	data []byte
+}
+
+func run(root, in, out string, skip []string, manifestPath, posts string, o imgopt.Options, jobs int, force bool) error {
+	manifest, err := imgopt.Load(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	var (
+		sources []source
+		// all lists every file's URL path, encodable or not, for the dark
+		// variant checks.
+		all []string
+	)
+	dir := filepath.Join(root, filepath.FromSlash(in))
+	outDir := filepath.Join(root, filepath.FromSlash(out))
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if p == outDir || slices.Contains(skip, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		all = append(all, "/"+path.Join(in, rel))
+		if !imgopt.Supported(p) {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, source{name: rel, key: "/" + path.Join(in, rel), data: b})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		encoded  int
+		sem      = make(chan struct{}, max(jobs, 1))
+		seen     = make(map[string]bool, len(sources))
+	)
+	for _, s := range sources {
+		seen[s.key] = true
+		if prev, ok := manifest[s.key]; ok && !force && prev.Hash == imgopt.Hash(s.data, o) && exists(root, prev.Files()) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			img, err := imgopt.Process(s.data, s.name, root, out, o)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Print(err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			// Widths that are no longer generated leave files behind.
+			remove(root, prev(manifest, s.key), img.Files())
+			manifest[s.key] = img
+			encoded++
+			fmt.Println(s.key)
+		}()
+	}
+	wg.Wait()
+
+	for key, img := range manifest {
+		img.Dark = ""
+		if d := imgopt.DarkSrc(key); seen[d] {
+			img.Dark = d
+		}
+		manifest[key] = img
+	}
+
+	var removed int
+	for key, img := range manifest {
+		if !seen[key] {
+			remove(root, img.Files(), nil)
+			delete(manifest, key)
+			removed++
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0o755); err != nil {
+		return err
+	}
+	if err := manifest.Save(manifestPath); err != nil {
+		return err
+	}
+	log.Printf("%d image(s), %d encoded, %d removed", len(sources), encoded, removed)
+	if firstErr != nil {
+		return firstErr
+	}
+	return checkPairs(posts, all)
+}
+
+// checkPairs reports the dark variants declared by the posts under dir
+// that don't exist, and those that have no light image.
+func checkPairs(dir string, srcs []string) error {
+	var refs []imgopt.Ref
+	if dir != "" {
+		posts, err := content.Load(dir)
+		if err != nil {
+			return err
+		}
+		for _, p := range posts {
+			refs = append(refs, imgopt.Refs(p)...)
+		}
+	}
+	problems := imgopt.CheckPairs(refs, srcs)
+	for _, p := range problems {
+		log.Print(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d dark variant problem(s)", len(problems))
+	}
+	return nil
+}
+
+func prev(m imgopt.Manifest, key string) []string {
+	if img, ok := m[key]; ok {
+		return img.Files()
+	}
+	return nil
+}
+
+// exists reports whether every URL path in files is on disk under root.
+func exists(root string, files []string) bool {
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(f))); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// remove deletes the files under root that aren't in keep.
+func remove(root string, files, keep []string) {
+	for _, f := range files {
+		if slices.Contains(keep, f) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(root, filepath.FromSlash(f))); err != nil && !os.IsNotExist(err) {
+			log.Print(err)
+		}
+	}
+}
+
+func parseInts(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("width %d must be positive", n)
+		}
+		out = append(out, n)
+	}
+	sort.Ints(out)
+	return out, nil
+}
+
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,165 @@
+// Command kudosd lets readers heart a post, once per device. The page
+// sends a random device ID it keeps in localStorage; there are no cookies,
+// and client IPs are only held in memory for rate limiting. Hearts are
+// kept in SQLite.
+//
+// Usage:
+//
+//	kudosd [-addr :8083] [-db kudos.db] [-content content] [-origin https://rednafi.com]
+//
+// Endpoints:
+//
+//	POST /kudos/<slug>                 form-encoded device; heart the post
+//	GET  /kudos/<slug>[?device=<id>]   the post's hearts, and whether device gave one
+//	GET  /kudos                        every post's hearts as JSON, for `blogctl kudos export`
+//	GET  /healthz                      200 while the server is up
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/kudos"
+	"github.com/rednafi/rednafi.com/internal/ratelimit"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("kudosd: ")
+
+	addr := flag.String("addr", ":8083", "listen address")
+	dbPath := flag.String("db", "kudos.db", "SQLite database")
+	dir := flag.String("content", content.Dir, "content directory; only its posts take hearts")
+	origin := flag.String("origin", "https://rednafi.com", "allowed CORS origin")
+	ipHeader := flag.String("ip-header", "", "header with the client IP when behind a proxy, e.g. CF-Connecting-IP")
+	every := flag.Duration("every", 10*time.Second, "after a burst, allow one heart per client IP this often")
+	burst := flag.Int("burst", 10, "hearts a client IP may give at once")
+	flag.Parse()
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := kudos.OpenStore(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	s := &server{
+		store:    store,
+		limiter:  ratelimit.New(*every, *burst),
+		slugs:    map[string]bool{},
+		origin:   *origin,
+		ipHeader: *ipHeader,
+	}
+	for _, p := range content.Published(posts) {
+		s.slugs[p.Slug] = true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go s.limiter.PruneEvery(ctx, time.Minute)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /kudos/{slug}", s.heart)
+	mux.HandleFunc("GET /kudos/{slug}", s.count)
+	mux.HandleFunc("GET /kudos", s.all)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("taking kudos for %d post(s) on %s", len(s.slugs), *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	store    *kudos.Store
+	limiter  *ratelimit.Limiter
+	slugs    map[string]bool
+	origin   string
+	ipHeader string
+}
+
+type count struct {
+	Slug    string `json:"slug"`
+	Kudos   int    `json:"kudos"`
+	Hearted bool   `json:"hearted"`
+}
+
+func (s *server) heart(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+	slug := r.PathValue("slug")
+	if !s.slugs[slug] {
+		http.NotFound(w, r)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+	device := r.PostFormValue("device")
+	if !kudos.ValidDevice(device) {
+		http.Error(w, "missing or malformed device", http.StatusBadRequest)
+		return
+	}
+	if !s.limiter.Allow(ratelimit.ClientIP(r, s.ipHeader), time.Now()) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many hearts, slow down", http.StatusTooManyRequests)
+		return
+	}
+	n, err := s.store.Heart(r.Context(), slug, device, time.Now())
+	writeJSON(w, count{slug, n, true}, err)
+}
+
+func (s *server) count(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+	slug := r.PathValue("slug")
+	if !s.slugs[slug] {
+		http.NotFound(w, r)
+		return
+	}
+	device := r.URL.Query().Get("device")
+	if device != "" && !kudos.ValidDevice(device) {
+		http.Error(w, "malformed device", http.StatusBadRequest)
+		return
+	}
+	n, hearted, err := s.store.Count(r.Context(), slug, device)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	writeJSON(w, count{slug, n, hearted}, err)
+}
+
+func (s *server) all(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.store.All(r.Context())
+	writeJSON(w, counts, err)
+}
+
+func writeJSON(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,175 @@
+// Command linkcheck reports broken links across the site.
+//
+// By default it reads the markdown under content/; pass -html public to check
+// Hugo's rendered output instead, which also covers links coming from the
+// theme. Internal links and #anchors are resolved against the site's own
+// pages. External URLs are checked over HTTP, at most one request per host
+// per -per-host interval, with retries and backoff on 429s and 5xxs.
+//
+// External results are cached in a bbolt file so that repeated runs only
+// re-check entries older than -ttl (or -fail-ttl for failures). The command
+// exits non-zero if any internal link is broken or an external link regressed,
+// meaning it's new or it worked on the previous run and doesn't now. Links
+// that were already broken last time are reported but don't fail the run
+// unless -strict is set.
+//
+// Usage:
+//
+//	linkcheck [-config config.yml] [-content content | -html public] [-cache .linkcheck.db] [-strict]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/linkcheck"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+type options struct {
+	config   string
+	content  string
+	static   string
+	html     string
+	cache    string
+	external bool
+	strict   bool
+	jobs     int
+	checker  *linkcheck.Checker
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("linkcheck: ")
+
+	var (
+		opts    options
+		timeout time.Duration
+		checker linkcheck.Checker
+	)
+	flag.StringVar(&opts.config, "config", site.ConfigPath, "Hugo config file, for the site's host")
+	flag.StringVar(&opts.content, "content", content.Dir, "content directory")
+	flag.StringVar(&opts.static, "static", "static", "static files directory")
+	flag.StringVar(&opts.html, "html", "", "check rendered HTML under this directory instead of markdown")
+	flag.StringVar(&opts.cache, "cache", ".linkcheck.db", "result cache file")
+	flag.BoolVar(&opts.external, "external", true, "check external links")
+	flag.BoolVar(&opts.strict, "strict", false, "fail on external links that were already broken")
+	flag.IntVar(&opts.jobs, "j", 8, "number of external checks in flight")
+	flag.DurationVar(&checker.TTL, "ttl", 7*24*time.Hour, "how long a passing result is cached")
+	flag.DurationVar(&checker.FailTTL, "fail-ttl", 24*time.Hour, "how long a failing result is cached")
+	flag.DurationVar(&checker.PerHost, "per-host", time.Second, "minimum gap between requests to one host")
+	flag.IntVar(&checker.Retries, "retries", 3, "retries for transient failures")
+	flag.DurationVar(&timeout, "timeout", 15*time.Second, "per-request timeout")
+	flag.Parse()
+	checker.Client = &http.Client{Timeout: timeout}
+	opts.checker = &checker
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	failed, err := run(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if failed > 0 {
+		log.Fatalf("%d broken link(s)", failed)
+	}
+}
+
+func run(ctx context.Context, opts options) (int, error) {
+	cfg, err := site.Load(opts.config)
+	if err != nil {
+		return 0, err
+	}
+	var s *linkcheck.Site
+	if opts.html != "" {
+		s, err = linkcheck.FromHTML(cfg.BaseURL, opts.html)
+	} else {
+		var posts []*content.Post
+		if posts, err = content.Load(opts.content); err != nil {
+			return 0, err
+		}
+		s, err = linkcheck.FromMarkdown(cfg.BaseURL, opts.content, posts, opts.static)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	problems, external := s.Check()
+	for _, p := range problems {
+		fmt.Printf("%s:%d: %s: %s\n", p.Source, p.Line, p.Dest, p.Reason)
+	}
+	failed := len(problems)
+	if !opts.external {
+		return failed, nil
+	}
+
+	cache, err := linkcheck.OpenCache(opts.cache)
+	if err != nil {
+		return failed, err
+	}
+	defer cache.Close()
+	opts.checker.Cache = cache
+
+	urls := make([]string, 0, len(external))
+	for u := range external {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	log.Printf("%d internal problem(s); checking %d external URL(s)", failed, len(urls))
+
+	type outcome struct {
+		cur, prev linkcheck.Result
+		hadPrev   bool
+	}
+	outcomes := make([]outcome, len(urls))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(opts.jobs, 1))
+	for i, u := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			cur, prev, ok := opts.checker.Check(ctx, u)
+			outcomes[i] = outcome{cur, prev, ok}
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return failed, ctx.Err()
+	}
+
+	for i, u := range urls {
+		o := outcomes[i]
+		if o.cur.OK {
+			continue
+		}
+		// A URL that worked last time, or that we've never seen, is a
+		// regression. One that was broken last time too is known.
+		regression := !o.hadPrev || o.prev.OK
+		label := "regression"
+		if !regression {
+			label = "known"
+			if !o.cur.LastOK.IsZero() {
+				label += ", last ok " + o.cur.LastOK.Format(time.DateOnly)
+			}
+		}
+		if regression || opts.strict {
+			failed++
+		}
+		for _, ref := range external[u] {
+			fmt.Printf("%s:%d: %s: %s [%s]\n", ref.Source, ref.Line, u, o.cur, label)
+		}
+	}
+	return failed, nil
+}
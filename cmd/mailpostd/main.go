@@ -0,0 +1,234 @@
+// Command mailpostd posts to the site by email. A Mailgun route forwards
+// mail for the posting address to POST /mail; each message is checked
+// against MAILGUN_SIGNING_KEY, the -allow list of senders, and Mailgun's
+// SPF and DKIM results, then committed through the GitHub API with
+// MAILPOSTD_GITHUB_TOKEN, a token that can write the repo's contents and
+// run its workflows.
+//
+// A message without a subject, or with the subject "note", becomes a note
+// and starts a build of the site; any other subject is the title of a
+// draft post, which waits in the repo for editing. Hashtags in the subject
+// become tags. Every message, accepted or not, is logged as a line of JSON.
+//
+// Usage:
+//
+//	mailpostd [-addr :8089] -allow me@example.com [-repo rednafi/rednafi.com] [-branch main] [-workflow hugo.yml]
+//
+// Endpoints:
+//
+//	POST /mail      a message forwarded by a Mailgun route; 200 if it was
+//	                committed, 406 if it was refused, which Mailgun
+//	                doesn't retry
+//	GET  /healthz   200 while the server is up
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/github"
+	"github.com/rednafi/rednafi.com/internal/mailpost"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/ratelimit"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mailpostd: ")
+
+	addr := flag.String("addr", ":8089", "listen address")
+	allow := flag.String("allow", "", "comma-separated sender addresses allowed to post")
+	repo := flag.String("repo", "rednafi/rednafi.com", "GitHub repo to commit to, owner/name")
+	branch := flag.String("branch", "main", "branch to commit to")
+	api := flag.String("github-api", "https://api.github.com", "GitHub API base URL")
+	workflow := flag.String("workflow", "hugo.yml", "workflow to run after committing a note (empty to leave it to the push)")
+	section := flag.String("section", "misc", "section draft posts are created in")
+	tmpl := flag.String("template", newpost.DefaultTemplate, "front matter template for draft posts")
+	aliasesPath := flag.String("aliases", tags.DefaultAliases, "tag alias map")
+	requireAuth := flag.Bool("require-auth", true, "refuse messages that failed both SPF and DKIM")
+	maxAge := flag.Duration("max-age", 5*time.Minute, "oldest Mailgun signature accepted")
+	ipHeader := flag.String("ip-header", "", "header with the client IP when behind a proxy, e.g. CF-Connecting-IP")
+	every := flag.Duration("every", 10*time.Second, "after a burst, allow one message per client IP this often")
+	burst := flag.Int("burst", 5, "messages a client IP may send at once")
+	flag.Parse()
+
+	if *allow == "" {
+		log.Fatal("-allow is required")
+	}
+	key := os.Getenv("MAILGUN_SIGNING_KEY")
+	if key == "" {
+		log.Fatal("MAILGUN_SIGNING_KEY isn't set")
+	}
+	token := os.Getenv("MAILPOSTD_GITHUB_TOKEN")
+	if token == "" {
+		log.Fatal("MAILPOSTD_GITHUB_TOKEN isn't set")
+	}
+	aliases, err := tags.LoadAliases(*aliasesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Fail now rather than on the first draft.
+	if _, err := os.Stat(*tmpl); err != nil {
+		log.Fatal(err)
+	}
+
+	s := &server{
+		log:         slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		limiter:     ratelimit.New(*every, *burst),
+		gh:          &github.Client{HTTP: &http.Client{Timeout: 30 * time.Second}, Token: token, BaseURL: *api},
+		key:         key,
+		allow:       strings.Split(*allow, ","),
+		requireAuth: *requireAuth,
+		maxAge:      *maxAge,
+		repo:        *repo,
+		branch:      *branch,
+		workflow:    *workflow,
+		opts:        mailpost.Options{Section: *section, Template: *tmpl, Aliases: aliases},
+		ipHeader:    *ipHeader,
+		seen:        mailpost.Seen{},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go s.limiter.PruneEvery(ctx, time.Minute)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /mail", s.mail)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("listening on %s, committing to %s@%s", *addr, *repo, *branch)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	log         *slog.Logger
+	limiter     *ratelimit.Limiter
+	gh          *github.Client
+	key         string
+	allow       []string
+	requireAuth bool
+	maxAge      time.Duration
+	repo        string
+	branch      string
+	workflow    string
+	opts        mailpost.Options
+	ipHeader    string
+
+	// mu guards seen, and serializes commits so two messages in the same
+	// minute don't race for a note's path.
+	mu   sync.Mutex
+	seen mailpost.Seen
+}
+
+func (s *server) mail(w http.ResponseWriter, r *http.Request) {
+	ip := ratelimit.ClientIP(r, s.ipHeader)
+	var m mailpost.Message
+	audit := func(level slog.Level, outcome string, attrs ...slog.Attr) {
+		s.log.LogAttrs(r.Context(), level, "mail", append([]slog.Attr{
+			slog.String("outcome", outcome),
+			slog.String("from", m.From),
+			slog.String("subject", m.Subject),
+			slog.String("ip", ip),
+		}, attrs...)...)
+	}
+	// Mailgun retries on anything but 200 and 406; refusals shouldn't be.
+	refuse := func(outcome, msg string, attrs ...slog.Attr) {
+		audit(slog.LevelWarn, outcome, attrs...)
+		http.Error(w, msg, http.StatusNotAcceptable)
+	}
+
+	if !s.limiter.Allow(ip, time.Now()) {
+		audit(slog.LevelWarn, "rate_limited")
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many messages, slow down", http.StatusTooManyRequests)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 25<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		refuse("unreadable", "unreadable message", slog.String("error", err.Error()))
+		return
+	}
+	m, err := mailpost.FromForm(r.Form)
+	if err != nil {
+		refuse("malformed", "malformed message", slog.String("error", err.Error()))
+		return
+	}
+	now := time.Now()
+	if err := m.Verify(s.key, now, s.maxAge); err != nil {
+		refuse("bad_signature", "bad signature", slog.String("error", err.Error()))
+		return
+	}
+	if err := m.Allowed(s.allow, s.requireAuth); err != nil {
+		refuse("not_allowed", "sender not allowed", slog.String("error", err.Error()))
+		return
+	}
+	f, err := m.Convert(s.opts, now)
+	if err != nil {
+		refuse("unconvertible", "can't make a post of it", slog.String("error", err.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.seen.Add(m.Token, now, s.maxAge) {
+		refuse("replayed", "already posted")
+		return
+	}
+	msg := "Add note by email"
+	if !f.Note {
+		msg = "Add draft \"" + f.Title + "\" by email"
+	}
+	if !f.Note || s.workflow != "" {
+		// A draft doesn't change the site, and a note is built by the
+		// dispatch below; the push shouldn't start another build.
+		msg += " [skip ci]"
+	}
+	path := content.Dir + "/" + f.Path
+	commit, err := s.gh.CreateFile(r.Context(), s.repo, s.branch, path, msg, f.Body)
+	if errors.Is(err, github.ErrExists) {
+		refuse("exists", "a post is already at "+path, slog.String("path", path))
+		return
+	}
+	if err != nil {
+		// Let Mailgun retry; the token has to be usable again for that.
+		delete(s.seen, m.Token)
+		audit(slog.LevelError, "commit_failed", slog.String("path", path), slog.String("error", err.Error()))
+		http.Error(w, "couldn't commit", http.StatusBadGateway)
+		return
+	}
+	attrs := []slog.Attr{slog.String("path", path), slog.String("commit", commit)}
+	if f.Note && s.workflow != "" {
+		if err := s.gh.Dispatch(r.Context(), s.repo, s.workflow, s.branch); err != nil {
+			// The note is in; only the build has to be started by hand.
+			attrs = append(attrs, slog.String("dispatch_error", err.Error()))
+		}
+	}
+	audit(slog.LevelInfo, "committed", attrs...)
+	w.WriteHeader(http.StatusOK)
+}
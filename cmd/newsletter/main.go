@@ -0,0 +1,108 @@
+// Command newsletter sends a digest of the posts published since the last
+// issue. The watermark lives in data/newsletter.json and only moves once
+// the issue was handed off, so a failed run can simply be repeated.
+//
+// Issues go to Buttondown as drafts (BUTTONDOWN_API_KEY) or straight out
+// over SMTP (SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM, SMTP_TO).
+//
+// Usage:
+//
+//	newsletter [-via buttondown|smtp] [-since 2024-01-01] [-intro text] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/newsletter"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("newsletter: ")
+
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	dir := flag.String("content", content.Dir, "content directory")
+	statePath := flag.String("state", newsletter.DefaultStatePath, "watermark file")
+	via := flag.String("via", "buttondown", "delivery: buttondown or smtp")
+	tmpl := flag.String("template", "", "HTML template (default: the built-in digest)")
+	intro := flag.String("intro", "", "paragraph to open the issue with")
+	sinceFlag := flag.String("since", "", "cover posts after this date (YYYY-MM-DD) instead of the watermark")
+	dryRun := flag.Bool("dry-run", false, "print the HTML instead of sending it")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	state, err := newsletter.LoadState(*statePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	since := state.LastPost
+	if *sinceFlag != "" {
+		if since, err = time.Parse(time.DateOnly, *sinceFlag); err != nil {
+			log.Fatalf("-since: %v", err)
+		}
+	}
+	if since.IsZero() {
+		log.Fatalf("%s has no watermark yet; pass -since for the first issue", *statePath)
+	}
+
+	d := newsletter.Collect(cfg, posts, since)
+	if len(d.Posts) == 0 {
+		log.Printf("nothing published since %s", since.Format(time.DateOnly))
+		return
+	}
+	d.Intro = *intro
+	t, err := newsletter.Template(*tmpl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	html, err := newsletter.Render(t, d)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dryRun {
+		fmt.Print(html)
+		log.Printf("%q: %d post(s)", d.Subject, len(d.Posts))
+		return
+	}
+
+	var sender newsletter.Sender
+	switch *via {
+	case "buttondown":
+		sender, err = newsletter.ButtondownFromEnv()
+	case "smtp":
+		sender, err = newsletter.SMTPFromEnv()
+	default:
+		log.Fatalf("unknown -via %q", *via)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	where, err := sender.Send(ctx, d.Subject, html, newsletter.PlainText(d))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	state = newsletter.State{LastPost: d.Newest(), LastIssue: time.Now().UTC(), Subject: d.Subject}
+	if err := state.Save(*statePath); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%q: %d post(s), %s", d.Subject, len(d.Posts), where)
+}
@@ -0,0 +1,70 @@
+// Command ogimage renders an Open Graph card for every published post and
+// writes it to static/images/og/<slug>.png. Files whose rendered bytes didn't
+// change are left alone so the output stays stable between runs.
+//
+// Usage:
+//
+//	ogimage [-content content] [-out static/images/og] [-template card.json]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/ogimage"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ogimage: ")
+
+	dir := flag.String("content", content.Dir, "content directory")
+	out := flag.String("out", filepath.Join("static", "images", "og"), "output directory")
+	tmpl := flag.String("template", "", "JSON card template (defaults to the built-in one)")
+	flag.Parse()
+
+	if err := run(*dir, *out, *tmpl); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(dir, out, tmplPath string) error {
+	t := ogimage.DefaultTemplate
+	if tmplPath != "" {
+		var err error
+		if t, err = ogimage.LoadTemplate(tmplPath); err != nil {
+			return err
+		}
+	}
+
+	posts, err := content.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	var written int
+	for _, p := range content.Articles(content.Published(posts)) {
+		var buf bytes.Buffer
+		card := ogimage.Card{Title: p.Title, Date: p.Date, Tags: p.Tags}
+		if err := ogimage.Render(&buf, t, card); err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		dst := filepath.Join(out, p.Slug+".png")
+		wrote, err := fsutil.WriteIfChanged(dst, buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if !wrote {
+			continue
+		}
+		fmt.Println(dst)
+		written++
+	}
+	log.Printf("%d cards written", written)
+	return nil
+}
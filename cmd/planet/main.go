@@ -0,0 +1,101 @@
+// Command planet builds the "What I'm reading" page from the blogs in
+// data/blogroll.opml: it fetches their feeds, RSS, Atom, or JSON Feed, a
+// few at a time, with conditional GETs against what .planet-cache.json
+// kept from the last run, and writes the recent posts to data/planet.json
+// for the planet layout. The blogroll itself is exported to
+// static/blogroll.opml, cleaned up and grouped by category, for readers to
+// import.
+//
+// A feed that fails keeps its cached posts and is only reported; planet
+// fails only if every feed does.
+//
+// Usage:
+//
+//	planet [-blogroll data/blogroll.opml] [-days 30] [-per-blog 3] [-limit 50] [-j 8]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/planet"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("planet: ")
+
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	blogroll := flag.String("blogroll", planet.DefaultBlogroll, "OPML file listing the blogs")
+	cachePath := flag.String("cache", planet.DefaultCache, "feed cache")
+	out := flag.String("out", "data/planet.json", "file to write the recent posts to")
+	opmlOut := flag.String("opml", "static/blogroll.opml", "file to export the blogroll to")
+	days := flag.Int("days", 30, "show posts from this many days back")
+	perBlog := flag.Int("per-blog", 3, "show at most this many posts from one blog")
+	limit := flag.Int("limit", 50, "show at most this many posts")
+	jobs := flag.Int("j", 8, "number of feeds to fetch at once")
+	timeout := flag.Duration("timeout", 20*time.Second, "per-feed timeout")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	blogs, err := planet.LoadOPML(*blogroll)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cache := planet.LoadCache(*cachePath)
+	now := time.Now()
+	results := planet.Fetch(ctx, &http.Client{Timeout: *timeout}, blogs, cache, *jobs)
+	failed, unchanged := 0, 0
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			log.Print(r.Err)
+		case r.NotModified:
+			unchanged++
+		}
+	}
+	log.Printf("%d feed(s): %d updated, %d unchanged, %d failed", len(blogs), len(blogs)-unchanged-failed, unchanged, failed)
+	if err := cache.Save(*cachePath, blogs); err != nil {
+		log.Fatal(err)
+	}
+
+	entries := planet.Recent(blogs, cache, now, *days, *perBlog, *limit)
+	page, err := json.MarshalIndent(struct {
+		Blogs   int            `json:"blogs"`
+		OPML    string         `json:"opml"`
+		Entries []planet.Entry `json:"entries"`
+	}{len(blogs), "/" + filepath.Base(*opmlOut), entries}, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	opml, err := planet.ExportOPML(blogs, cfg.Title+" blogroll", cfg.Params.Author)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for path, b := range map[string][]byte{*out: append(page, '\n'), *opmlOut: opml} {
+		if _, err := fsutil.WriteIfChanged(path, b); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("%d recent post(s) from %d blog(s)", len(entries), len(blogs))
+	if failed == len(blogs) {
+		log.Fatal(errors.New("every feed failed"))
+	}
+}
@@ -0,0 +1,117 @@
+// Command popular ranks the posts by page views over the last 30, 90, and
+// 365 days, from Cloudflare's GraphQL Analytics API, and writes the top
+// posts per window to data/popular.json for the "Most read" lists.
+//
+// Views are cached per day in -cache, so a run only queries the days it
+// hasn't seen. Without CLOUDFLARE_API_TOKEN and CLOUDFLARE_ZONE_ID, or if
+// the API fails, it ranks from the cache alone.
+//
+// Usage:
+//
+//	popular [-content content] [-out data/popular.json] [-windows 30,90,365] [-n 10]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/cloudflare"
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/popular"
+	"github.com/rednafi/rednafi.com/internal/redirects"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("popular: ")
+
+	dir := flag.String("content", content.Dir, "content directory")
+	out := flag.String("out", popular.DefaultPath, "rankings file to write")
+	cachePath := flag.String("cache", popular.DefaultCache, "per-day views cache")
+	data := flag.String("data", redirects.DefaultPath, "redirect map; views of old URLs count for their targets")
+	windowsFlag := flag.String("windows", "30,90,365", "comma-separated windows, in days, to rank over")
+	n := flag.Int("n", 10, "posts to keep per window")
+	limit := flag.Int("limit", 1000, "distinct paths to fetch per day")
+	flag.Parse()
+
+	windows, err := parseWindows(*windowsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rs, err := redirects.Load(*data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	now := time.Now()
+	span := slices.Max(windows)
+	cache := popular.LoadCache(*cachePath)
+	cache.Prune(now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -span))
+	fetched := fetch(cache, now, span, *limit)
+	if err := cache.Save(*cachePath); err != nil {
+		log.Fatal(err)
+	}
+
+	ranks := popular.Rank(cache, posts, rs, windows, now, *n)
+	written, err := popular.Write(*out, ranks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	log.Printf("%d day(s) cached, %d fetched", len(cache), fetched)
+}
+
+// fetch adds the missing days in the last span to the cache and returns
+// how many it got. It stops at the first failure, keeping what it has; a
+// stale ranking beats a failed build.
+func fetch(cache popular.Cache, now time.Time, span, limit int) int {
+	missing := cache.Missing(now, span)
+	if len(missing) == 0 {
+		return 0
+	}
+	cf, err := cloudflare.New(cloudflare.ConfigFromEnv(), "zone")
+	if err != nil {
+		log.Printf("%v; ranking from the cache", err)
+		return 0
+	}
+	ctx := context.Background()
+	var fetched int
+	for _, day := range missing {
+		pcs, err := cf.Paths(ctx, day, cloudflare.PageViews, limit)
+		if err != nil {
+			log.Printf("%s: %v; ranking from the cache", day.Format(time.DateOnly), err)
+			break
+		}
+		d := make(popular.Day, len(pcs))
+		for _, pc := range pcs {
+			d[pc.Path] += pc.Count
+		}
+		cache[day.Format(time.DateOnly)] = d
+		fetched++
+	}
+	return fetched
+}
+
+func parseWindows(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("-windows: %q isn't a number of days", f)
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+// Command r2sync uploads the files under static/ to a Cloudflare R2 bucket.
+//
+// It hashes every local file, compares the hash against the ETag R2 reports
+// for the matching object, and only uploads files that are new or changed.
+// Uploaded objects get the Cache-Control and Content-Type the header policy
+// in data/headers.toml gives their path on the site, which static/ is
+// served at; with -headers "" they're all immutable for -max-age instead.
+// Objects keep the metadata they were uploaded with, so after a policy
+// change, -restamp uploads the unchanged ones again too.
+//
+// Credentials are read from R2_ACCOUNT_ID, R2_ACCESS_KEY_ID,
+// R2_SECRET_ACCESS_KEY. The bucket comes from -bucket or R2_BUCKET.
+//
+// Usage:
+//
+//	r2sync [-dir static] [-bucket name] [-prefix p] [-headers data/headers.toml] [-max-age s] [-restamp] [-j n] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/headers"
+	"github.com/rednafi/rednafi.com/internal/r2"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("r2sync: ")
+
+	cfg := r2.ConfigFromEnv()
+	dir := flag.String("dir", "static", "directory to upload")
+	flag.StringVar(&cfg.Bucket, "bucket", cfg.Bucket, "destination bucket")
+	prefix := flag.String("prefix", "", "key prefix inside the bucket")
+	policyPath := flag.String("headers", headers.DefaultPath, "response header policy, for each file's metadata; empty for -max-age")
+	maxAge := flag.Int("max-age", 31536000, "immutable cache-control max-age in seconds, without -headers")
+	restamp := flag.Bool("restamp", false, "upload unchanged files too, bringing their metadata up to date")
+	jobs := flag.Int("j", 8, "number of parallel uploads")
+	dryRun := flag.Bool("dry-run", false, "print what would be uploaded without uploading")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, cfg, *dir, *prefix, *policyPath, *maxAge, *jobs, *restamp, *dryRun); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(
+	ctx context.Context,
+	cfg r2.Config,
+	dir, prefix, policyPath string,
+	maxAge, jobs int,
+	restamp, dryRun bool,
+) error {
+	client, err := r2.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	local, err := r2.Walk(dir, prefix)
+	if err != nil {
+		return err
+	}
+	if policyPath != "" {
+		policy, err := headers.Load(policyPath)
+		if err != nil {
+			return err
+		}
+		policy.SetMetadata(local, func(f r2.File) string {
+			return "/" + strings.TrimPrefix(strings.TrimPrefix(f.Key, prefix), "/")
+		})
+	}
+	pending, remote, err := client.Changed(ctx, local, prefix)
+	if err != nil {
+		return err
+	}
+	if restamp {
+		pending = local
+	}
+	log.Printf(
+		"%d local files, %d remote objects, %d to upload",
+		len(local), remote, len(pending),
+	)
+
+	if dryRun {
+		for _, f := range pending {
+			fmt.Println(f.Key)
+		}
+		return nil
+	}
+
+	cacheControl := fmt.Sprintf("public, max-age=%d, immutable", maxAge)
+	return client.Upload(ctx, pending, cacheControl, jobs, func(f r2.File) {
+		fmt.Println(f.Key)
+	})
+}
@@ -0,0 +1,185 @@
+// Command rss2email watches the site's JSON Feed and mails each new post,
+// whole, to the subscribers in data/subscribers.txt, one address a line.
+// The posts already mailed are recorded in data/rss2email.json one at a
+// time, so a failed run can simply be repeated. The first run only records
+// the feed, mailing the newest -backfill posts.
+//
+// Mail goes out over SMTP (SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD,
+// SMTP_FROM), every subscriber blind-copied.
+//
+// Usage:
+//
+//	rss2email [-every 15m] [-backfill 0] [-unsubscribe url] [-dry-run]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/newsletter"
+	"github.com/rednafi/rednafi.com/internal/rss2email"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("rss2email: ")
+
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	feedURL := flag.String("feed", "", "JSON Feed to watch (default: the site's /feed.json)")
+	statePath := flag.String("state", rss2email.DefaultStatePath, "posts already mailed")
+	subsPath := flag.String("subscribers", rss2email.DefaultSubscribers, "addresses to mail, one a line")
+	tmpl := flag.String("template", "", "HTML template (default: the built-in one)")
+	unsubscribe := flag.String("unsubscribe", "", "URL or mailto: the footer links to unsubscribe")
+	every := flag.Duration("every", 0, "check the feed this often (default: once)")
+	backfill := flag.Int("backfill", 0, "newest posts to mail on the first run")
+	dryRun := flag.Bool("dry-run", false, "print the HTML instead of sending it")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *feedURL == "" {
+		*feedURL = cfg.Permalink("/feed.json")
+	}
+	t, err := rss2email.Template(*tmpl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var sender newsletter.Sender
+	if !*dryRun {
+		if sender, err = smtpSender(*subsPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	w := &watcher{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		feed:        *feedURL,
+		statePath:   *statePath,
+		template:    t,
+		unsubscribe: *unsubscribe,
+		backfill:    *backfill,
+		sender:      sender,
+	}
+	if err := w.check(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if *every <= 0 {
+		return
+	}
+	tick := time.NewTicker(*every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			// A failed check is retried on the next tick.
+			if err := w.check(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Print(err)
+			}
+		}
+	}
+}
+
+// smtpSender mails from the SMTP_* settings to the addresses at path.
+func smtpSender(path string) (*newsletter.SMTP, error) {
+	to, err := rss2email.LoadSubscribers(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("no subscribers in %s", path)
+	}
+	s := &newsletter.SMTP{
+		Addr:     os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		To:       to,
+	}
+	if s.Addr == "" || s.From == "" {
+		return nil, errors.New("SMTP_ADDR and SMTP_FROM must be set")
+	}
+	return s, nil
+}
+
+type watcher struct {
+	client      *http.Client
+	feed        string
+	statePath   string
+	template    *template.Template
+	unsubscribe string
+	backfill    int
+	// sender is nil on a dry run.
+	sender newsletter.Sender
+}
+
+// check mails the posts in the feed that haven't been, oldest first,
+// saving the state after each so a failure doesn't mail one twice.
+func (w *watcher) check(ctx context.Context) error {
+	state, err := rss2email.LoadState(w.statePath)
+	if err != nil {
+		return err
+	}
+	doc, etag, err := rss2email.Fetch(ctx, w.client, w.feed, state.ETag)
+	if err != nil {
+		return err
+	}
+	state.LastCheck = time.Now().UTC()
+	if doc == nil {
+		return w.save(state)
+	}
+	state.ETag = etag
+	if state.Sent == nil {
+		state.Seed(doc, w.backfill, state.LastCheck)
+		log.Printf("first run: %d post(s) recorded as already sent", len(state.Sent))
+	}
+
+	for _, it := range rss2email.Unsent(doc, state) {
+		e, err := rss2email.NewEmail(doc, it, w.unsubscribe)
+		if err != nil {
+			return err
+		}
+		html, err := rss2email.Render(w.template, e)
+		if err != nil {
+			return err
+		}
+		if w.sender == nil {
+			fmt.Print(html)
+			log.Printf("%q: not sent (dry run)", e.Title)
+			continue
+		}
+		where, err := w.sender.Send(ctx, e.Title, html, rss2email.PlainText(e))
+		if err != nil {
+			return err
+		}
+		state.Sent[it.ID] = time.Now().UTC()
+		if err := w.save(state); err != nil {
+			return err
+		}
+		log.Printf("%q: %s", e.Title, where)
+	}
+	return w.save(state)
+}
+
+// save records state, except on a dry run, which leaves no trace.
+func (w *watcher) save(state rss2email.State) error {
+	if w.sender == nil {
+		return nil
+	}
+	return state.Save(w.statePath)
+}
@@ -0,0 +1,160 @@
+// Command scheduler publishes scheduled posts: drafts whose publishDate (in
+// the front matter, as Hugo spells it) has passed get draft: false, and the
+// site is then committed, rebuilt, and deployed with the given commands.
+// That makes "write now, publish Tuesday 9am" a matter of setting
+// publishDate: 2024-03-05T09:00:00-05:00 on a draft.
+//
+// By default it checks once and exits, which suits a cron-triggered
+// workflow; with -every it keeps checking, as a long-running process.
+//
+// Usage:
+//
+//	scheduler [-content content] [-every 0] [-commit] [-build cmd] [-deploy cmd] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/schedule"
+)
+
+type config struct {
+	dir    string
+	commit bool
+	build  string
+	deploy string
+	dryRun bool
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("scheduler: ")
+
+	var c config
+	flag.StringVar(&c.dir, "content", content.Dir, "content directory")
+	every := flag.Duration("every", 0, "check this often instead of once")
+	flag.BoolVar(&c.commit, "commit", false, "pull first, then commit and push the published posts")
+	flag.StringVar(&c.build, "build", "", "shell command that rebuilds the site, e.g. \"hugo --gc --minify\"")
+	flag.StringVar(&c.deploy, "deploy", "", "shell command that deploys the build")
+	flag.BoolVar(&c.dryRun, "dry-run", false, "list the posts that are due without publishing them")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *every <= 0 {
+		if err := c.run(ctx, time.Now()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	log.Printf("checking %s every %s", c.dir, *every)
+	t := time.NewTicker(*every)
+	defer t.Stop()
+	for {
+		// A failed run is retried on the next tick rather than ending the
+		// process.
+		if err := c.run(ctx, time.Now()); err != nil {
+			log.Print(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// run publishes the posts due at now and, if there were any, commits,
+// builds, and deploys.
+func (c config) run(ctx context.Context, now time.Time) error {
+	if c.commit && !c.dryRun {
+		if err := sh(ctx, "git pull --ff-only"); err != nil {
+			return err
+		}
+	}
+	posts, err := content.Load(c.dir)
+	if err != nil {
+		return err
+	}
+	due := schedule.Due(posts, now)
+	var paths, titles []string
+	for _, p := range due {
+		path := filepath.Join(c.dir, filepath.FromSlash(p.Path))
+		fmt.Printf("%s (%s)\n", path, p.PublishDate.Format(time.RFC3339))
+		if c.dryRun {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out, err := schedule.Publish(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		titles = append(titles, p.Title)
+	}
+	if len(paths) == 0 {
+		if !c.dryRun {
+			log.Print("nothing due")
+		}
+		return nil
+	}
+
+	if c.commit {
+		msg := "Publish " + strings.Join(titles, ", ")
+		if err := git(ctx, append([]string{"add", "--"}, paths...)...); err != nil {
+			return err
+		}
+		if err := git(ctx, "commit", "-m", msg); err != nil {
+			return err
+		}
+		if err := git(ctx, "push"); err != nil {
+			return err
+		}
+	}
+	if c.build != "" {
+		if err := sh(ctx, c.build); err != nil {
+			return err
+		}
+	}
+	if c.deploy != "" {
+		if err := sh(ctx, c.deploy); err != nil {
+			return err
+		}
+	}
+	log.Printf("published %d post(s)", len(paths))
+	return nil
+}
+
+func sh(ctx context.Context, command string) error {
+	return runCmd(exec.CommandContext(ctx, "sh", "-c", command))
+}
+
+func git(ctx context.Context, args ...string) error {
+	return runCmd(exec.CommandContext(ctx, "git", args...))
+}
+
+func runCmd(cmd *exec.Cmd) error {
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(cmd.Args, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Command searchindex builds the client-side search index from the posts'
+// titles, tags, and bodies and writes it to static/search/index.json.
+//
+// Per-post terms are cached in -cache so that a rebuild only re-tokenizes
+// posts that changed. Changing -boost invalidates the cache.
+//
+// Usage:
+//
+//	searchindex [-content content] [-out static/search/index.json] [-boost title=3,tags=2,body=1]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/search"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("searchindex: ")
+
+	dir := flag.String("content", content.Dir, "content directory")
+	out := flag.String("out", "static/search/index.json", "index file to write")
+	cachePath := flag.String("cache", ".searchindex.json", "build cache; empty to disable")
+	boost := flag.String("boost", search.DefaultBoosts.String(), "field boosts as field=weight pairs")
+	full := flag.Bool("full", false, "ignore the cache and re-tokenize every post")
+	flag.Parse()
+
+	boosts, err := search.ParseBoosts(*boost)
+	if err != nil {
+		log.Fatal(err)
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var cache *search.Cache
+	if *cachePath != "" && !*full {
+		cache = search.LoadCache(*cachePath)
+	} else {
+		cache = &search.Cache{}
+	}
+	idx, st := search.Build(posts, boosts, cache)
+
+	written, err := search.Write(*out, idx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if written {
+		fmt.Println(*out)
+	}
+	if *cachePath != "" {
+		if err := cache.Save(*cachePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("%d post(s), %d term(s); %d indexed, %d from cache",
+		st.Docs, len(idx.Terms), st.Indexed, st.Cached)
+}
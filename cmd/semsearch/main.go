@@ -0,0 +1,129 @@
+// Command semsearch serves semantic search over the posts. It loads the
+// embeddings written by `blogctl embed`, embeds each query with the same
+// model, and ranks posts by their closest passage.
+//
+// The endpoint, key, and model are read from EMBED_BASE_URL, EMBED_API_KEY,
+// and EMBED_MODEL, and must match what the index was built with.
+//
+// Usage:
+//
+//	semsearch [-addr :8080] [-index embeddings.json] [-origin https://rednafi.com]
+//
+// Endpoints:
+//
+//	GET /search?q=<query>[&n=10]   ranked hits as JSON
+//	GET /healthz                   200 once the index is loaded
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/embed"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("semsearch: ")
+
+	addr := flag.String("addr", ":8080", "listen address")
+	path := flag.String("index", embed.DefaultPath, "embeddings index")
+	origin := flag.String("origin", "https://rednafi.com", "allowed CORS origin")
+	maxN := flag.Int("max", 20, "maximum results per query")
+	flag.Parse()
+
+	idx, err := embed.Load(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := embed.ClientFromEnv()
+	if idx.Model != c.Model {
+		log.Fatalf("index was built with %q but EMBED_MODEL is %q", idx.Model, c.Model)
+	}
+	log.Printf("loaded %d post(s) from %s", len(idx.Posts), *path)
+
+	s := &server{idx: idx, client: c, origin: *origin, maxN: *maxN}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", s.search)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("listening on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	idx    *embed.Index
+	client *embed.Client
+	origin string
+	maxN   int
+}
+
+// maxQueryLen bounds the query sent to the embeddings API.
+const maxQueryLen = 256
+
+func (s *server) search(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	if len(q) > maxQueryLen {
+		http.Error(w, "query too long", http.StatusBadRequest)
+		return
+	}
+	n := 10
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	n = min(n, s.maxN)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	vecs, err := s.client.Embed(ctx, []string{q})
+	if err != nil {
+		log.Printf("embed %q: %v", q, err)
+		http.Error(w, "search unavailable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(struct {
+		Query string      `json:"query"`
+		Hits  []embed.Hit `json:"hits"`
+	}{q, s.idx.Search(vecs[0], n)})
+}
@@ -0,0 +1,146 @@
+// Command shortlinkd serves the posts' short links: /s/<code> redirects
+// permanently to the post the code was minted for by `blogctl shorten`,
+// and each redirect is counted in SQLite.
+//
+// Route rednafi.com/s/* to it at the CDN; everything else stays static.
+//
+// Usage:
+//
+//	shortlinkd [-addr :8085] [-db shortlinks.db] [-data data/shortlinks.json] [-content content]
+//
+// Endpoints:
+//
+//	GET /s/<code>   301 to the post
+//	GET /clicks     clicks per slug as JSON
+//	GET /healthz    200 while the server is up
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/shortlink"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("shortlinkd: ")
+
+	addr := flag.String("addr", ":8085", "listen address")
+	dbPath := flag.String("db", "shortlinks.db", "SQLite database of clicks")
+	data := flag.String("data", shortlink.DefaultPath, "short codes")
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	dir := flag.String("content", content.Dir, "content directory")
+	flag.Parse()
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	links, err := shortlink.Load(*data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	codes, err := links.Codes()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := shortlink.OpenStore(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	s := &server{store: store, targets: map[string]string{}, slugs: codes}
+	bySlug := map[string]*content.Post{}
+	for _, p := range content.Published(posts) {
+		bySlug[p.Slug] = p
+	}
+	for code, slug := range codes {
+		if p, ok := bySlug[slug]; ok {
+			s.targets[code] = cfg.Permalink(p.RelPermalink())
+		} else {
+			log.Printf("%s%s: no published post %q; skipping", shortlink.Prefix, code, slug)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+shortlink.Prefix+"{code}", s.redirect)
+	mux.HandleFunc("GET /clicks", s.clicks)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("serving %d short link(s) on %s", len(s.targets), *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	store *shortlink.Store
+	// targets maps a code to the post's permalink, slugs to its slug.
+	targets map[string]string
+	slugs   map[string]string
+}
+
+func (s *server) redirect(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	target, ok := s.targets[code]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// HEAD requests are link previews and crawlers, not clicks.
+	if r.Method == http.MethodGet {
+		if err := s.store.Click(r.Context(), code, time.Now()); err != nil {
+			log.Printf("%s: %v", code, err)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+func (s *server) clicks(w http.ResponseWriter, r *http.Request) {
+	byCode, err := s.store.Clicks(r.Context())
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	out := map[string]int{}
+	for code, n := range byCode {
+		if slug, ok := s.slugs[code]; ok {
+			out[slug] += n
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,417 @@
+// Command snippetcheck compiles, vets, and tests the Go code blocks in every
+// post. Each self-contained block (or group of blocks naming their files,
+// like // main.go and // main_test.go) is written to a temporary module and
+// checked with go vet and go test. Failures are reported against the post
+// and line the code came from.
+//
+// Blocks without a package clause are treated as fragments and skipped. Add
+// {check=false} to a fence's info string to opt a block out explicitly.
+//
+// Blocks in other languages are checked one at a time: Python compiles,
+// with ruff or else python3, shell passes shellcheck, or else sh -n, and
+// JSON, YAML, and TOML parse. Python REPL sessions and shell sessions with
+// $ prompts are left alone, and a checker whose tools aren't installed is
+// skipped with a note. -lang limits the check to some fence languages.
+//
+// With -exec, blocks marked {run=true} are executed instead and their stdout
+// is compared against the trailing "// Output:" (or "# Output:") comment in
+// the block, like a Go example test. -write updates those comments in place
+// rather than reporting a diff.
+//
+// -go checks or runs every Go block with each of a list of toolchains,
+// golang.org/dl wrappers like go1.22.12 that -install installs if they're
+// missing, and reports the blocks that pass with some and not others: the
+// posts that rely on version-specific behavior, like per-iteration loop
+// variables. A block that's about such a change declares the version it
+// needs with {go=1.22}, and older toolchains skip it.
+//
+// Usage:
+//
+//	snippetcheck [-content content] [-j n] [-lang go,python] [-go go1.22.12,go1.23.8 [-install]] [-exec [-write]] [post.md ...]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("snippetcheck: ")
+
+	dir := flag.String("content", content.Dir, "content directory")
+	jobs := flag.Int("j", runtime.NumCPU(), "number of snippets to check in parallel")
+	execMode := flag.Bool("exec", false, "run {run=true} blocks and compare their output")
+	write := flag.Bool("write", false, "with -exec, rewrite output comments instead of diffing")
+	timeout := flag.Duration("timeout", 30*time.Second, "with -exec, time limit per block")
+	versions := flag.String("go", "", "comma-separated toolchains to check Go blocks with, like go1.22.12,go1.23.8")
+	install := flag.Bool("install", false, "with -go, install the toolchains that are missing")
+	only := flag.String("lang", "", "comma-separated fence languages to check, like go,python; all by default")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	toolchains := []snippet.Toolchain{{Name: "go", Go: "go"}}
+	if *versions != "" {
+		if *write {
+			log.Fatal("-write can't rewrite output comments for several toolchains; drop -go")
+		}
+		toolchains = toolchains[:0]
+		for _, name := range strings.Split(*versions, ",") {
+			t, err := snippet.FindToolchain(ctx, strings.TrimSpace(name), *install)
+			if err != nil {
+				log.Fatal(err)
+			}
+			toolchains = append(toolchains, t)
+		}
+	}
+
+	var langs []string
+	if *only != "" {
+		langs = strings.Split(*only, ",")
+	}
+
+	posts, err := load(*dir, flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var failed int
+	if *execMode {
+		failed, err = runExec(ctx, *dir, posts, *jobs, snippet.Runner{Timeout: *timeout}, toolchains, *write)
+	} else {
+		failed = runCheck(ctx, posts, *jobs, toolchains, langs)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if failed > 0 {
+		log.Fatalf("%d snippet(s) failed", failed)
+	}
+}
+
+// load returns the posts under dir, limited to the paths in only if any are
+// given.
+func load(dir string, only []string) ([]*content.Post, error) {
+	posts, err := content.Load(dir)
+	if err != nil || len(only) == 0 {
+		return posts, err
+	}
+	var out []*content.Post
+	for _, p := range posts {
+		if slices.Contains(only, p.Path) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func runCheck(ctx context.Context, posts []*content.Post, jobs int, toolchains []snippet.Toolchain, langs []string) int {
+	var units []snippet.Unit
+	var goUnits int
+	for _, p := range posts {
+		blocks := snippet.Extract(p)
+		var us []snippet.Unit
+		for _, u := range append(snippet.GoUnits(blocks), snippet.BlockUnits(blocks)...) {
+			if len(langs) == 0 || slices.Contains(langs, lang(u)) {
+				us = append(us, u)
+			}
+		}
+		slices.SortFunc(us, func(a, b snippet.Unit) int { return a.Line() - b.Line() })
+		units = append(units, us...)
+	}
+	for _, u := range units {
+		if lang(u) == "go" {
+			goUnits++
+		}
+	}
+	log.Printf("checking %d snippet(s), %d in Go%s", len(units), goUnits, with(toolchains))
+
+	// Only Go units are checked once per toolchain; the rest once.
+	n := len(toolchains)
+	results := make([]*snippet.Result, len(units)*n)
+	parallel(len(results), jobs, func(i int) {
+		u, t := units[i/n], toolchains[i%n]
+		if (lang(u) != "go" && i%n > 0) || (lang(u) == "go" && !t.SupportsUnit(u)) {
+			return
+		}
+		r := snippet.CheckerFor(u, t.Go).Check(ctx, u)
+		results[i] = &r
+	})
+
+	var failed int
+	var varying []string
+	missing := map[string]int{} // checker error -> blocks skipped
+	for i, u := range units {
+		m := matrix{toolchains: toolchains}
+		if lang(u) != "go" {
+			m.toolchains = nil
+			if r := results[i*n]; errors.Is(r.Err, snippet.ErrNoTool) {
+				missing[fmt.Sprintf("%s: %v", lang(u), r.Err)]++
+				continue
+			}
+		}
+		for j, r := range results[i*n : (i+1)*n] {
+			switch {
+			case r == nil:
+				if lang(u) == "go" {
+					m.skip(j)
+				}
+			case r.Err == nil:
+				m.pass(j)
+			default:
+				m.fail(j, fmt.Sprintf("%v\n%s", r.Err, r.Output))
+			}
+		}
+		where := fmt.Sprintf("%s:%d", u.Post, u.Line())
+		if m.report(where) {
+			failed++
+		}
+		if m.varies() {
+			varying = append(varying, where)
+		}
+	}
+	reportVarying(varying)
+	for msg, n := range missing {
+		log.Printf("%s; skipped %d snippet(s)", msg, n)
+	}
+	return failed
+}
+
+// lang returns the fence language of u's blocks.
+func lang(u snippet.Unit) string {
+	for _, b := range u.Files {
+		return b.Lang
+	}
+	return ""
+}
+
+type execResult struct {
+	got string
+	err error
+}
+
+func runExec(
+	ctx context.Context,
+	dir string,
+	posts []*content.Post,
+	jobs int,
+	runner snippet.Runner,
+	toolchains []snippet.Toolchain,
+	write bool,
+) (int, error) {
+	var blocks []snippet.Block
+	for _, p := range posts {
+		for _, b := range snippet.Extract(p) {
+			if snippet.Runnable(b) {
+				blocks = append(blocks, b)
+			}
+		}
+	}
+	log.Printf("executing %d snippet(s)%s", len(blocks), with(toolchains))
+
+	// Only Go blocks run once per toolchain; the rest run once.
+	n := len(toolchains)
+	results := make([]*execResult, len(blocks)*n)
+	parallel(len(results), jobs, func(i int) {
+		b, t := blocks[i/n], toolchains[i%n]
+		if (b.Lang != "go" && i%n > 0) || (b.Lang == "go" && !t.Supports(b)) {
+			return
+		}
+		r := runner
+		r.Go = t.Go
+		got, err := r.Run(ctx, b)
+		results[i] = &execResult{got: got, err: err}
+	})
+
+	var failed int
+	var varying []string
+	updates := map[string]map[int]string{} // post -> fence line -> new code
+	for i, b := range blocks {
+		want, ok := snippet.ExpectedOutput(b)
+		m := matrix{toolchains: toolchains}
+		if b.Lang != "go" {
+			m.toolchains = nil
+		}
+		for j, r := range results[i*n : (i+1)*n] {
+			switch {
+			case r == nil:
+				if b.Lang == "go" {
+					m.skip(j)
+				}
+			case r.err != nil:
+				m.fail(j, r.err.Error())
+			case ok && snippet.SameOutput(r.got, want):
+				m.pass(j)
+			case write:
+				if updates[b.Post] == nil {
+					updates[b.Post] = map[int]string{}
+				}
+				updates[b.Post][b.Line] = snippet.WithOutput(b, r.got)
+				fmt.Printf("fix  %s:%d\n", b.Post, b.Line)
+				m.fixed = true
+			case !ok:
+				m.fail(j, fmt.Sprintf("no Output comment; got:\n%s", r.got))
+			default:
+				m.fail(j, fmt.Sprintf("output mismatch\n--- want\n%s\n+++ got\n%s", want, r.got))
+			}
+		}
+		if m.fixed {
+			continue
+		}
+		where := fmt.Sprintf("%s:%d", b.Post, b.Line)
+		if m.report(where) {
+			failed++
+		}
+		if m.varies() {
+			varying = append(varying, where)
+		}
+	}
+	reportVarying(varying)
+
+	for post, code := range updates {
+		if err := rewrite(filepath.Join(dir, filepath.FromSlash(post)), code); err != nil {
+			return failed, err
+		}
+	}
+	return failed, nil
+}
+
+// matrix collects a snippet's results with each toolchain. Without
+// toolchains, or with just the default one, it reports as a single run.
+type matrix struct {
+	toolchains              []snippet.Toolchain
+	passed, failed, skipped []string
+	failures                []string
+	// fixed is set when -write fixed the snippet's output comment.
+	fixed bool
+}
+
+func (m *matrix) name(i int) string {
+	if len(m.toolchains) == 0 {
+		return ""
+	}
+	return m.toolchains[i].Version
+}
+
+func (m *matrix) pass(i int) { m.passed = append(m.passed, m.name(i)) }
+func (m *matrix) skip(i int) { m.skipped = append(m.skipped, m.name(i)) }
+
+func (m *matrix) fail(i int, msg string) {
+	m.failed = append(m.failed, m.name(i))
+	m.failures = append(m.failures, msg)
+}
+
+// single reports whether the snippet ran once, rather than with a list
+// of toolchains.
+func (m *matrix) single() bool {
+	return len(m.toolchains) == 0 || (len(m.toolchains) == 1 && m.toolchains[0].Name == "go" && m.toolchains[0].Version == "")
+}
+
+// varies reports whether the snippet passed with some toolchains and
+// failed with others.
+func (m *matrix) varies() bool {
+	return len(m.passed) > 0 && len(m.failed) > 0
+}
+
+// report prints the snippet's results and reports whether it failed.
+func (m *matrix) report(where string) bool {
+	if m.single() {
+		if len(m.failed) == 0 {
+			fmt.Printf("ok   %s\n", where)
+			return false
+		}
+		fmt.Printf("FAIL %s: %s\n", where, m.failures[0])
+		return true
+	}
+	var notes []string
+	if len(m.skipped) > 0 {
+		notes = append(notes, "skipped with "+strings.Join(m.skipped, ", "))
+	}
+	if len(m.failed) == 0 {
+		if len(m.passed) == 0 {
+			fmt.Printf("skip %s: %s\n", where, strings.Join(notes, "; "))
+			return false
+		}
+		fmt.Printf("ok   %s (%s)\n", where, strings.Join(append([]string{strings.Join(m.passed, ", ")}, notes...), "; "))
+		return false
+	}
+	notes = append([]string{"fails with " + strings.Join(m.failed, ", ")}, notes...)
+	if len(m.passed) > 0 {
+		notes = append(notes, "passes with "+strings.Join(m.passed, ", "))
+	}
+	fmt.Printf("FAIL %s: %s\n", where, strings.Join(notes, "; "))
+	for i, v := range m.failed {
+		fmt.Printf("--- %s\n%s\n", v, m.failures[i])
+	}
+	return true
+}
+
+// with describes the toolchains for the log, if they aren't just the
+// default one.
+func with(toolchains []snippet.Toolchain) string {
+	if len(toolchains) == 1 && toolchains[0].Version == "" {
+		return ""
+	}
+	vs := make([]string, len(toolchains))
+	for i, t := range toolchains {
+		vs[i] = t.Version
+	}
+	return " with " + strings.Join(vs, ", ")
+}
+
+// reportVarying lists the snippets whose result depends on the toolchain.
+func reportVarying(where []string) {
+	if len(where) == 0 {
+		return
+	}
+	log.Printf("%d snippet(s) depend on the Go version; mark the ones about a change with {go=1.xx}:", len(where))
+	for _, w := range where {
+		log.Printf("  %s", w)
+	}
+}
+
+// rewrite replaces the code of the blocks keyed by fence line in the file at
+// path.
+func rewrite(path string, code map[int]string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p, err := content.Parse(filepath.Base(filepath.Dir(path))+"/"+filepath.Base(path), src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, snippet.Rewrite(src, snippet.Extract(p), code), 0o644)
+}
+
+// parallel calls fn for every index in [0, n) using at most jobs goroutines.
+func parallel(n, jobs int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(jobs, 1))
+	for i := range n {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
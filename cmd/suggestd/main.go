@@ -0,0 +1,134 @@
+// Command suggestd answers the site's quick-nav as visitors type, with
+// the posts, tags, and headings whose words start with the query, so the
+// page needn't download the full search index. The completions come from
+// a trie built in memory from the content directory at start, and again
+// on SIGHUP after a deploy; see internal/complete.
+//
+// Usage:
+//
+//	suggestd [-addr :8092] [-content content] [-origin https://rednafi.com]
+//
+// Endpoints:
+//
+//	GET /suggest?q=<query>[&n=<count>]   up to n completions of q, best first, as JSON
+//	GET /healthz                         200 while the server is up
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/complete"
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// maxQuery caps the query, in bytes; no title is longer.
+const maxQuery = 200
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("suggestd: ")
+
+	addr := flag.String("addr", ":8092", "listen address")
+	dir := flag.String("content", content.Dir, "content directory")
+	origin := flag.String("origin", "https://rednafi.com", "allowed CORS origin")
+	n := flag.Int("n", 8, "completions to return when the request doesn't say")
+	maxAge := flag.Duration("max-age", 5*time.Minute, "how long caches may keep an answer")
+	flag.Parse()
+
+	s := &server{origin: *origin, n: min(*n, complete.DefaultTop), maxAge: *maxAge}
+	if err := s.load(*dir); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			// A failed reload keeps serving the old trie.
+			if err := s.load(*dir); err != nil {
+				log.Print(err)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /suggest", s.suggest)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("suggesting on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	index  atomic.Pointer[complete.Index]
+	origin string
+	n      int
+	maxAge time.Duration
+}
+
+// load builds the trie from the posts in dir and swaps it in.
+func (s *server) load(dir string) error {
+	start := time.Now()
+	posts, err := content.Load(dir)
+	if err != nil {
+		return err
+	}
+	x := complete.Build(posts, complete.DefaultTop)
+	s.index.Store(x)
+	log.Printf("indexed %d phrase(s) in %s", x.Len(), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (s *server) suggest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+	q := r.URL.Query().Get("q")
+	if len(q) > maxQuery {
+		http.Error(w, "query too long", http.StatusBadRequest)
+		return
+	}
+	n := s.n
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 || n > complete.DefaultTop {
+			http.Error(w, "n must be a number from 1 to "+strconv.Itoa(complete.DefaultTop), http.StatusBadRequest)
+			return
+		}
+	}
+	out := s.index.Load().Lookup(q, n)
+	if out == nil {
+		out = []complete.Completion{}
+	}
+	// The same query gets the same answer until the next deploy, so
+	// Cloudflare can answer the common prefixes.
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(s.maxAge.Seconds())))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,224 @@
+// Command uptimed watches the site: every -every it fetches the home page,
+// the feeds, the search index, the sitemap, and the /healthz of each
+// service config.yml names, records the results in SQLite, and renders the
+// last 30 days as a static status page. It serves the page at /status/ and,
+// with -out, writes it to a file for the web server to serve.
+//
+// A target that fails -failures checks in a row, comes back, or whose TLS
+// certificate expires within -cert-warn raises an alert, published to an
+// ntfy topic with -ntfy (NTFY_TOKEN for a protected one) and posted as
+// JSON to -webhook.
+//
+// Usage:
+//
+//	uptimed [-addr :8091] [-db uptime.db] [-every 1m] [-out public/status/index.html] [-ntfy url] [-webhook url]
+//
+// Endpoints:
+//
+//	GET  /status/    the status page
+//	GET  /healthz    200 while the server is up
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/uptime"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("uptimed: ")
+
+	addr := flag.String("addr", ":8091", "listen address")
+	dbPath := flag.String("db", uptime.DefaultDB, "SQLite database")
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	extra := flag.String("extra", "", "more comma-separated name=url targets")
+	every := flag.Duration("every", time.Minute, "how often to check")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-probe timeout")
+	failures := flag.Int("failures", 2, "failed checks in a row before a target is down")
+	certWarn := flag.Duration("cert-warn", 14*24*time.Hour, "alert when a certificate expires sooner than this")
+	keep := flag.Duration("keep", 90*24*time.Hour, "how long to keep checks")
+	out := flag.String("out", "", "also write the status page here, e.g. public/status/index.html")
+	ntfy := flag.String("ntfy", "", "ntfy topic URL to publish alerts to")
+	hook := flag.String("webhook", "", "URL to post alerts to as JSON")
+	flag.Parse()
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	targets := uptime.Targets(cfg)
+	more, err := uptime.ParseTargets(*extra)
+	if err != nil {
+		log.Fatal(err)
+	}
+	targets = append(targets, more...)
+	store, err := uptime.OpenStore(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	notifyClient := &http.Client{Timeout: 30 * time.Second}
+	var notifiers []uptime.Notifier
+	if *ntfy != "" {
+		notifiers = append(notifiers, &uptime.Ntfy{HTTP: notifyClient, URL: *ntfy, Token: os.Getenv("NTFY_TOKEN")})
+	}
+	if *hook != "" {
+		notifiers = append(notifiers, &uptime.Webhook{HTTP: notifyClient, URL: *hook})
+	}
+
+	m := &monitor{
+		cfg:       cfg,
+		targets:   targets,
+		store:     store,
+		client:    &http.Client{Timeout: *timeout},
+		watch:     &uptime.Watch{Failures: *failures, CertWarn: *certWarn},
+		notifiers: notifiers,
+		keep:      *keep,
+		out:       *out,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := m.prime(ctx); err != nil {
+		log.Fatal(err)
+	}
+	go m.run(ctx, *every)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status/{$}", m.page)
+	mux.Handle("GET /status", http.RedirectHandler("/status/", http.StatusMovedPermanently))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("watching %d target(s) every %s on %s", len(targets), *every, *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type monitor struct {
+	cfg       *site.Config
+	targets   []uptime.Target
+	store     *uptime.Store
+	client    *http.Client
+	watch     *uptime.Watch
+	notifiers []uptime.Notifier
+	keep      time.Duration
+	out       string
+
+	mu   sync.RWMutex
+	html []byte
+}
+
+// prime replays the stored checks through the watch, so a restart picks up
+// where the last run left off instead of alerting again, and renders the
+// page from them.
+func (m *monitor) prime(ctx context.Context) error {
+	checks, err := m.store.Since(ctx, time.Now().AddDate(0, 0, -uptime.Days))
+	if err != nil {
+		return err
+	}
+	m.watch.Prime(checks)
+	return m.render(checks, time.Now())
+}
+
+func (m *monitor) run(ctx context.Context, every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		if err := m.check(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Print(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// check probes every target at once, records and alerts on the results,
+// and renders the page again.
+func (m *monitor) check(ctx context.Context) error {
+	now := time.Now()
+	results := make([]uptime.Check, len(m.targets))
+	var wg sync.WaitGroup
+	for i, t := range m.targets {
+		wg.Go(func() { results[i] = uptime.Probe(ctx, m.client, t, now) })
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	for _, c := range results {
+		if err := m.store.Record(ctx, c); err != nil {
+			return err
+		}
+		if !c.OK() {
+			log.Printf("%s: %s", c.URL, c.Err)
+		}
+		for _, a := range m.watch.Alerts(c) {
+			log.Printf("alert: %s: %s", a.Title, a.Message)
+			for _, n := range m.notifiers {
+				if err := n.Notify(ctx, a); err != nil {
+					log.Print(err)
+				}
+			}
+		}
+	}
+	if _, err := m.store.Prune(ctx, now.Add(-m.keep)); err != nil {
+		return err
+	}
+	checks, err := m.store.Since(ctx, now.AddDate(0, 0, -uptime.Days))
+	if err != nil {
+		return err
+	}
+	return m.render(checks, now)
+}
+
+func (m *monitor) render(checks []uptime.Check, now time.Time) error {
+	html, err := uptime.Render(uptime.BuildPage(m.cfg.Title, m.cfg.Permalink("/"), m.targets, checks, now))
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.html = html
+	m.mu.Unlock()
+	if m.out == "" {
+		return nil
+	}
+	return uptime.WritePage(m.out, html)
+}
+
+func (m *monitor) page(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	html := m.html
+	m.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(html)
+}
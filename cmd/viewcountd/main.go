@@ -0,0 +1,164 @@
+// Command viewcountd counts post views without cookies. Each hit is
+// deduplicated per visitor and day by a salted hash of the IP address and
+// user agent; the salt rotates daily and is never written down, and the
+// addresses themselves aren't stored. Counts are kept in SQLite.
+//
+// Usage:
+//
+//	viewcountd [-addr :8082] [-db views.db] [-content content] [-origin https://rednafi.com]
+//
+// Endpoints:
+//
+//	POST /hit/<slug>     count a view; the slug's views as JSON
+//	GET  /count/<slug>   the slug's views as JSON
+//	GET  /counts         every slug's views as JSON, for `blogctl views`
+//	GET  /healthz        200 while the server is up
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/ratelimit"
+	"github.com/rednafi/rednafi.com/internal/views"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("viewcountd: ")
+
+	addr := flag.String("addr", ":8082", "listen address")
+	dbPath := flag.String("db", "views.db", "SQLite database")
+	dir := flag.String("content", content.Dir, "content directory; only its posts are counted")
+	origin := flag.String("origin", "https://rednafi.com", "allowed CORS origin")
+	ipHeader := flag.String("ip-header", "", "header with the client IP when behind a proxy, e.g. CF-Connecting-IP")
+	flag.Parse()
+
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := views.OpenStore(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	s := &server{
+		store:    store,
+		hasher:   &views.Hasher{},
+		slugs:    map[string]bool{},
+		origin:   *origin,
+		ipHeader: *ipHeader,
+	}
+	for _, p := range content.Published(posts) {
+		s.slugs[p.Slug] = true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go s.forget(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hit/{slug}", s.hit)
+	mux.HandleFunc("GET /count/{slug}", s.count)
+	mux.HandleFunc("GET /counts", s.all)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("counting views of %d post(s) on %s", len(s.slugs), *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+type server struct {
+	store    *views.Store
+	hasher   *views.Hasher
+	slugs    map[string]bool
+	origin   string
+	ipHeader string
+}
+
+type count struct {
+	Slug  string `json:"slug"`
+	Views int    `json:"views"`
+}
+
+func (s *server) hit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+	slug := r.PathValue("slug")
+	if !s.slugs[slug] {
+		http.NotFound(w, r)
+		return
+	}
+	now := time.Now()
+	n, err := s.store.Hit(r.Context(), slug, s.hasher.Visitor(ratelimit.ClientIP(r, s.ipHeader), r.UserAgent(), now), now)
+	writeJSON(w, count{slug, n}, err)
+}
+
+func (s *server) count(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", s.origin)
+	w.Header().Set("Vary", "Origin")
+	slug := r.PathValue("slug")
+	if !s.slugs[slug] {
+		http.NotFound(w, r)
+		return
+	}
+	n, err := s.store.Count(r.Context(), slug)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	writeJSON(w, count{slug, n}, err)
+}
+
+func (s *server) all(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.store.All(r.Context())
+	writeJSON(w, counts, err)
+}
+
+// forget drops the previous days' visitor hashes every hour until ctx is
+// done.
+func (s *server) forget(ctx context.Context) {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for {
+		if err := s.store.Forget(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Print(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,242 @@
+// Command webmentiond receives Webmentions for the site's posts. Incoming
+// mentions are verified in the background by fetching the source and
+// checking it links to the post, then stored in SQLite as pending until
+// `blogctl comments approve` approves them. Mentions whose source is
+// deleted or no longer links are removed, and those from a domain
+// `blogctl comments block-domain` blocked are turned away.
+//
+// Usage:
+//
+//	webmentiond [-addr :8081] [-db webmentions.db] [-content content]
+//
+// Endpoints:
+//
+//	POST /webmention          form-encoded source and target (202 Accepted)
+//	GET  /mentions            approved mentions as JSON, keyed by target URL
+//	GET  /mentions/<path>     approved mentions of one post, e.g. /mentions/go/foo/
+//	GET  /healthz             200 while the server is up
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/webmention"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("webmentiond: ")
+
+	addr := flag.String("addr", ":8081", "listen address")
+	dbPath := flag.String("db", webmention.DefaultDB, "SQLite database")
+	config := flag.String("config", site.ConfigPath, "Hugo config file")
+	dir := flag.String("content", content.Dir, "content directory; only its posts accept mentions")
+	workers := flag.Int("j", 4, "concurrent source verifications")
+	queue := flag.Int("queue", 256, "pending verifications before new ones are refused")
+	flag.Parse()
+
+	cfg, err := site.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	posts, err := content.Load(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := webmention.OpenStore(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := &server{
+		cfg:      cfg,
+		host:     strings.TrimPrefix(base.Host, "www."),
+		posts:    map[string]bool{},
+		store:    store,
+		verifier: &webmention.Verifier{},
+		jobs:     make(chan job, *queue),
+		pending:  map[job]bool{},
+	}
+	for _, p := range content.Published(posts) {
+		s.posts[p.RelPermalink()] = true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var wg sync.WaitGroup
+	for range *workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webmention", s.receive)
+	mux.HandleFunc("GET /mentions", s.all)
+	mux.HandleFunc("GET /mentions/{path...}", s.forPost)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	log.Printf("accepting mentions for %d post(s) on %s", len(s.posts), *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	wg.Wait()
+}
+
+type job struct {
+	source, target string
+}
+
+type server struct {
+	cfg      *site.Config
+	host     string
+	posts    map[string]bool
+	store    *webmention.Store
+	verifier *webmention.Verifier
+	jobs     chan job
+
+	mu      sync.Mutex
+	pending map[job]bool
+}
+
+// accept maps a target on this site to the canonical permalink of a post.
+func (s *server) accept(u *url.URL) (*url.URL, bool) {
+	if strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") != s.host {
+		return nil, false
+	}
+	p := strings.ToLower(u.Path)
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	if !s.posts[p] {
+		return nil, false
+	}
+	c, err := url.Parse(s.cfg.Permalink(p))
+	return c, err == nil
+}
+
+func (s *server) receive(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 16<<10)
+	src, tgt, err := webmention.ParseRequest(r.PostFormValue("source"), r.PostFormValue("target"), s.accept)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	j := job{src.String(), tgt.String()}
+
+	s.mu.Lock()
+	queued := s.pending[j]
+	if !queued {
+		select {
+		case s.jobs <- j:
+			s.pending[j] = true
+			queued = true
+		default:
+		}
+	}
+	s.mu.Unlock()
+	if !queued {
+		http.Error(w, "too many pending mentions, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// work verifies queued mentions until ctx is done.
+func (s *server) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-s.jobs:
+			s.verify(ctx, j)
+			s.mu.Lock()
+			delete(s.pending, j)
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *server) verify(ctx context.Context, j job) {
+	src, _ := url.Parse(j.source)
+	tgt, _ := url.Parse(j.target)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	m, err := s.verifier.Verify(ctx, src, tgt)
+	switch {
+	case errors.Is(err, webmention.ErrNoLink), errors.Is(err, webmention.ErrGone):
+		log.Printf("%s -> %s: %v; removing", j.source, j.target, err)
+		err = s.store.Delete(ctx, j.source, j.target)
+	case err == nil:
+		if err = s.store.Put(ctx, m); err == nil {
+			log.Printf("%s -> %s: verified, pending approval", j.source, j.target)
+		}
+	}
+	if err != nil {
+		log.Printf("%s -> %s: %v", j.source, j.target, err)
+	}
+}
+
+func (s *server) all(w http.ResponseWriter, r *http.Request) {
+	ms, err := s.store.All(r.Context())
+	writeJSON(w, ms, err)
+}
+
+func (s *server) forPost(w http.ResponseWriter, r *http.Request) {
+	u, err := url.Parse(s.cfg.Permalink(r.PathValue("path")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tgt, ok := s.accept(u)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	ms, err := s.store.ForTarget(r.Context(), tgt.String())
+	writeJSON(w, ms, err)
+}
+
+func writeJSON(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,190 @@
+// Package a11y checks the HTML a post renders to for common accessibility
+// mistakes: images without alt text, skipped heading levels, links whose
+// text says nothing out of context, and inline colors with too little
+// contrast.
+package a11y
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	goldhtml "github.com/yuin/goldmark/renderer/html"
+	"golang.org/x/net/html"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Rules reported in Problem.Rule.
+const (
+	RuleImgAlt   = "img-alt"
+	RuleHeading  = "heading-order"
+	RuleLinkText = "link-text"
+	RuleContrast = "contrast"
+)
+
+// Problem is an accessibility issue at a line of a post's file.
+type Problem struct {
+	Line int
+	Rule string
+	Msg  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d: %s: %s", p.Line, p.Rule, p.Msg)
+}
+
+// vagueLinkText is link text that doesn't say where the link goes.
+var vagueLinkText = map[string]bool{
+	"here":       true,
+	"click here": true,
+	"this":       true,
+	"this link":  true,
+	"link":       true,
+	"read more":  true,
+	"more":       true,
+}
+
+// defaultText is the light theme's text color, used for styles that only
+// set a background.
+var defaultText = rgb{30.0 / 255, 30.0 / 255, 30.0 / 255}
+
+// Checker runs the rules over a post's HTML, one fragment at a time, so
+// state like the last heading level carries across fragments.
+type Checker struct {
+	// level is the last heading level seen. The page title is the h1, so
+	// a post's headings may start at h2.
+	level    int
+	problems []Problem
+}
+
+// NewChecker returns a Checker for a single page.
+func NewChecker() *Checker { return &Checker{level: 1} }
+
+// Problems returns what the checker found so far.
+func (c *Checker) Problems() []Problem { return c.problems }
+
+// Check tokenizes an HTML fragment whose first line is line in the post's
+// file and records the problems in it.
+func (c *Checker) Check(r io.Reader, line int) error {
+	z := html.NewTokenizer(r)
+	var (
+		// link is the text of the <a> being read, or nil outside one.
+		link     *strings.Builder
+		linkLine int
+	)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return nil
+			}
+			return z.Err()
+		}
+		raw := z.Raw()
+		tokLine := line
+		line += bytes.Count(raw, []byte{'\n'})
+		tok := z.Token()
+
+		switch tt {
+		case html.TextToken:
+			if link != nil {
+				link.WriteString(tok.Data)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if style, ok := attr(tok, "style"); ok {
+				c.checkContrast(style, tokLine)
+			}
+			switch tok.Data {
+			case "img":
+				alt, _ := attr(tok, "alt")
+				if link != nil {
+					link.WriteString(alt)
+				}
+				if strings.TrimSpace(alt) == "" && !decorative(tok) {
+					src, _ := attr(tok, "src")
+					c.add(tokLine, RuleImgAlt, "image %s has no alt text", src)
+				}
+			case "a":
+				if _, ok := attr(tok, "href"); ok && tt == html.StartTagToken {
+					link, linkLine = &strings.Builder{}, tokLine
+				}
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				n, _ := strconv.Atoi(tok.Data[1:])
+				if n > c.level+1 {
+					c.add(tokLine, RuleHeading, "h%d follows h%d; use h%d", n, c.level, c.level+1)
+				}
+				c.level = n
+			}
+		case html.EndTagToken:
+			if tok.Data == "a" && link != nil {
+				text := strings.Trim(strings.ToLower(strings.Join(strings.Fields(link.String()), " ")), ".,:;!?")
+				switch {
+				case text == "":
+					c.add(linkLine, RuleLinkText, "link has no text")
+				case vagueLinkText[text]:
+					c.add(linkLine, RuleLinkText, "link text %q doesn't describe the destination", text)
+				}
+				link = nil
+			}
+		}
+	}
+}
+
+func (c *Checker) checkContrast(style string, line int) {
+	fg, bg, hasFG, hasBG := styleColors(style)
+	if !hasFG && !hasBG {
+		return
+	}
+	if !hasFG {
+		fg = defaultText
+	}
+	if !hasBG {
+		bg = pageBackground
+	}
+	if r := contrast(fg, bg); r < MinContrast {
+		c.add(line, RuleContrast, "contrast %.2f:1 is below %.1f:1 in style %q", r, MinContrast, style)
+	}
+}
+
+func (c *Checker) add(line int, rule, format string, args ...any) {
+	c.problems = append(c.problems, Problem{Line: line, Rule: rule, Msg: fmt.Sprintf(format, args...)})
+}
+
+func attr(t html.Token, key string) (string, bool) {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// decorative reports whether an image is marked as not conveying content.
+func decorative(t html.Token) bool {
+	role, _ := attr(t, "role")
+	hidden, _ := attr(t, "aria-hidden")
+	return role == "presentation" || role == "none" || hidden == "true"
+}
+
+// Post renders p the way Hugo does and checks the result. Each top-level
+// block is rendered on its own so problems point at the post's lines.
+func Post(p *content.Post) ([]Problem, error) {
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	r := markdown.New(goldmark.WithRendererOptions(goldhtml.WithUnsafe())).Renderer()
+	c := NewChecker()
+	for n := doc.Root.FirstChild(); n != nil; n = n.NextSibling() {
+		var buf bytes.Buffer
+		if err := r.Render(&buf, doc.Source, n); err != nil {
+			return nil, fmt.Errorf("a11y: %s: %w", p.Path, err)
+		}
+		if err := c.Check(&buf, doc.NodeLine(n)); err != nil {
+			return nil, fmt.Errorf("a11y: %s: %w", p.Path, err)
+		}
+	}
+	return c.Problems(), nil
+}
@@ -0,0 +1,125 @@
+package a11y
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MinContrast is the WCAG AA contrast ratio for body text.
+const MinContrast = 4.5
+
+// rgb is a color with components in [0, 1].
+type rgb struct{ r, g, b float64 }
+
+// pageBackground is what text sits on when a style doesn't set a
+// background: the light theme's white.
+var pageBackground = rgb{1, 1, 1}
+
+var named = map[string]rgb{
+	"black":  {0, 0, 0},
+	"white":  {1, 1, 1},
+	"gray":   {0.5, 0.5, 0.5},
+	"grey":   {0.5, 0.5, 0.5},
+	"silver": {0.75, 0.75, 0.75},
+	"red":    {1, 0, 0},
+	"green":  {0, 0.5, 0},
+	"lime":   {0, 1, 0},
+	"blue":   {0, 0, 1},
+	"yellow": {1, 1, 0},
+	"orange": {1, 0.65, 0},
+	"cyan":   {0, 1, 1},
+	"aqua":   {0, 1, 1},
+	"pink":   {1, 0.75, 0.8},
+}
+
+// parseColor reads a CSS color in hex, rgb()/rgba(), or one of the common
+// named forms. Colors it can't read, like var() or currentColor, report
+// false and aren't checked.
+func parseColor(s string) (rgb, bool) {
+	s = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "!important")))
+	if c, ok := named[s]; ok {
+		return c, true
+	}
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		switch len(hex) {
+		case 3, 4:
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		case 6, 8:
+			hex = hex[:6]
+		default:
+			return rgb{}, false
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return rgb{}, false
+		}
+		return rgb{float64(n>>16&0xff) / 255, float64(n>>8&0xff) / 255, float64(n&0xff) / 255}, true
+	}
+	for _, fn := range []string{"rgb(", "rgba("} {
+		args, ok := strings.CutPrefix(s, fn)
+		if !ok || !strings.HasSuffix(args, ")") {
+			continue
+		}
+		parts := strings.FieldsFunc(strings.TrimSuffix(args, ")"), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '/'
+		})
+		if len(parts) < 3 {
+			return rgb{}, false
+		}
+		var c [3]float64
+		for i := range c {
+			v, pct := strings.CutSuffix(parts[i], "%")
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return rgb{}, false
+			}
+			if pct {
+				c[i] = f / 100
+			} else {
+				c[i] = f / 255
+			}
+		}
+		return rgb{c[0], c[1], c[2]}, true
+	}
+	return rgb{}, false
+}
+
+// luminance is the WCAG relative luminance of c.
+func luminance(c rgb) float64 {
+	lin := func(v float64) float64 {
+		v = math.Min(math.Max(v, 0), 1)
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*lin(c.r) + 0.7152*lin(c.g) + 0.0722*lin(c.b)
+}
+
+// contrast is the WCAG contrast ratio of two colors, from 1 to 21.
+func contrast(a, b rgb) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// styleColors returns the foreground and background colors an inline style
+// sets, if it sets them in a form parseColor reads.
+func styleColors(style string) (fg, bg rgb, hasFG, hasBG bool) {
+	for _, decl := range strings.Split(style, ";") {
+		prop, val, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(prop)) {
+		case "color":
+			fg, hasFG = parseColor(val)
+		case "background-color", "background":
+			bg, hasBG = parseColor(val)
+		}
+	}
+	return fg, bg, hasFG, hasBG
+}
@@ -0,0 +1,147 @@
+// Package abtest runs title experiments. A post lists alternates to its
+// title, its description, or both in its front matter:
+//
+//	ab_titles:
+//	    - "errgroup in one page"
+//	ab_descriptions:
+//	    - "Everything errgroup does, with the code."
+//
+// Handler shows each visitor one variant of the post, the same on every
+// page and every visit, and tags the links to the post with it, as
+// /go/errgroup/?ab=1, so the analytics count the clicks per variant.
+// `blogctl ab report` tallies those, picks the variant that gets clicked
+// most once the difference is unlikely to be chance, and writes it back
+// as the post's title and description, ending the experiment.
+package abtest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// Front matter keys for the alternates.
+const (
+	TitlesKey       = "ab_titles"
+	DescriptionsKey = "ab_descriptions"
+)
+
+// Param is the query parameter Handler tags links to a post with.
+const Param = "ab"
+
+// Variant is a title and description a post can be shown with.
+type Variant struct {
+	Title       string
+	Description string
+}
+
+// Experiment is a post's title experiment.
+type Experiment struct {
+	Slug string
+	// URL is the post's path on the site, and Path its file relative to
+	// the content directory.
+	URL, Path string
+	// Variants[0] is the post's own title and description, the control;
+	// the rest pair the alternates up in order, filling in the control's
+	// where one list is shorter than the other.
+	Variants []Variant
+}
+
+// Experiments returns the experiments of the published posts that have
+// alternates.
+func Experiments(posts []*content.Post) ([]Experiment, error) {
+	var exps []Experiment
+	for _, p := range content.Published(posts) {
+		titles, err := stringList(p, TitlesKey)
+		if err != nil {
+			return nil, err
+		}
+		descs, err := stringList(p, DescriptionsKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(titles) == 0 && len(descs) == 0 {
+			continue
+		}
+		control := Variant{Title: p.Title, Description: p.Description}
+		if len(descs) > 0 && control.Description == "" {
+			return nil, fmt.Errorf("%s: %s needs a description to test against", p.Path, DescriptionsKey)
+		}
+		e := Experiment{Slug: p.Slug, URL: p.RelPermalink(), Path: p.Path, Variants: []Variant{control}}
+		for i := range max(len(titles), len(descs)) {
+			v := control
+			if i < len(titles) {
+				v.Title = titles[i]
+			}
+			if i < len(descs) {
+				v.Description = descs[i]
+			}
+			if slices.Contains(e.Variants, v) {
+				return nil, fmt.Errorf("%s: alternate %d is the same as an earlier variant", p.Path, i+1)
+			}
+			e.Variants = append(e.Variants, v)
+		}
+		exps = append(exps, e)
+	}
+	return exps, nil
+}
+
+// stringList returns the list of strings at key in p's front matter.
+func stringList(p *content.Post, key string) ([]string, error) {
+	v, ok := p.Params[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s must be a list", p.Path, key)
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			return nil, fmt.Errorf("%s: %s: item %d isn't a non-empty string", p.Path, key, i+1)
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+// Assign returns the variant visitor sees: a hash of the visitor and the
+// post, so it's stable for the visitor and the visitors split evenly.
+func (e Experiment) Assign(visitor string) int {
+	h := fnv.New32a()
+	h.Write([]byte(e.Slug))
+	h.Write([]byte{0})
+	h.Write([]byte(visitor))
+	return int(h.Sum32() % uint32(len(e.Variants)))
+}
+
+// Apply makes variant v the title and description of the post file src
+// and drops the alternates, ending the experiment.
+func Apply(src []byte, e Experiment, v int) ([]byte, error) {
+	if v < 0 || v >= len(e.Variants) {
+		return nil, fmt.Errorf("abtest: %s has no variant %d", e.Slug, v)
+	}
+	out, win, control := src, e.Variants[v], e.Variants[0]
+	var err error
+	if win.Title != control.Title {
+		if out, err = content.SetString(out, "title", win.Title); err != nil {
+			return nil, err
+		}
+	}
+	if win.Description != control.Description {
+		if out, err = content.SetString(out, "description", win.Description); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range []string{TitlesKey, DescriptionsKey} {
+		if out, err = content.SetList(out, key, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
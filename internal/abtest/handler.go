@@ -0,0 +1,125 @@
+package abtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/ratelimit"
+)
+
+// Handler serves Next's pages with the experiments' variants swapped in.
+// Next is the site: a reverse proxy to the origin, or a file server of
+// public/. Hugo renders every page with the control's title and
+// description, so Handler replaces them, wherever they appear on a page,
+// with the visitor's variant's, and tags links to the post from other
+// pages with the variant. The rewritten pages differ per visitor and are
+// marked private so that no shared cache keeps one.
+//
+// There's no cookie: a visitor is their address and user agent, hashed,
+// which is as stable as a visitor needs to be and kept nowhere.
+type Handler struct {
+	Next        http.Handler
+	Experiments []Experiment
+	// BaseURL is the site's, for links that are absolute.
+	BaseURL string
+	// IPHeader is the header with the client IP when behind a proxy, like
+	// CF-Connecting-IP.
+	IPHeader string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(h.Experiments) == 0 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		h.Next.ServeHTTP(w, r)
+		return
+	}
+	sum := sha256.Sum256([]byte(ratelimit.ClientIP(r, h.IPHeader) + "\x00" + r.UserAgent()))
+	visitor := hex.EncodeToString(sum[:])
+
+	// The page has to come back uncompressed to be rewritten.
+	r = r.Clone(r.Context())
+	r.Header.Del("Accept-Encoding")
+	rec := &recorder{w: w}
+	h.Next.ServeHTTP(rec, r)
+	if !rec.buffer {
+		rec.WriteHeader(http.StatusOK)
+		return
+	}
+	body := rec.body.Bytes()
+	if out, changed := h.rewrite(body, r.URL.Path, visitor); changed {
+		body = out
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(rec.status)
+	w.Write(body)
+}
+
+// rewrite returns page, the HTML at path, as visitor sees it, and whether
+// that's any different.
+func (h *Handler) rewrite(page []byte, path, visitor string) ([]byte, bool) {
+	out := page
+	for _, e := range h.Experiments {
+		v := e.Assign(visitor)
+		control, shown := e.Variants[0], e.Variants[v]
+		if v > 0 {
+			out = replace(out, control.Title, shown.Title)
+			out = replace(out, control.Description, shown.Description)
+		}
+		if path == e.URL {
+			continue
+		}
+		tagged := e.URL + "?" + Param + "=" + strconv.Itoa(v)
+		for _, u := range []string{e.URL, h.BaseURL + e.URL} {
+			out = bytes.ReplaceAll(out, []byte(`href="`+u+`"`), []byte(`href="`+h.BaseURL+tagged+`"`))
+		}
+	}
+	return out, !bytes.Equal(out, page)
+}
+
+// replace replaces old with new in page, the way templates escape them.
+func replace(page []byte, old, new string) []byte {
+	if old == "" || old == new {
+		return page
+	}
+	return bytes.ReplaceAll(page, []byte(template.HTMLEscapeString(old)), []byte(template.HTMLEscapeString(new)))
+}
+
+// recorder passes Next's response through, except for the HTML pages
+// that can be rewritten, which it buffers.
+type recorder struct {
+	w      http.ResponseWriter
+	status int
+	wrote  bool
+	// buffer is decided by the headers, when Next writes them.
+	buffer bool
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.w.Header() }
+
+func (r *recorder) WriteHeader(status int) {
+	if r.wrote {
+		return
+	}
+	r.status, r.wrote = status, true
+	h := r.w.Header()
+	r.buffer = status == http.StatusOK && strings.HasPrefix(h.Get("Content-Type"), "text/html") && h.Get("Content-Encoding") == ""
+	if !r.buffer {
+		r.w.WriteHeader(status)
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if !r.buffer {
+		return r.w.Write(b)
+	}
+	return r.body.Write(b)
+}
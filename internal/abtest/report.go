@@ -0,0 +1,127 @@
+package abtest
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/cloudflare"
+)
+
+// Tally is an experiment's counts over a report's days.
+type Tally struct {
+	Experiment
+	// Clicks counts the views of the post, per variant, from the links
+	// Handler tagged.
+	Clicks []int
+	// Exposure is the page views of every other page, since any of them
+	// can show the post's title. Visitors are split evenly, so each
+	// variant is shown on an even share of them.
+	Exposure int
+}
+
+// Impressions estimates the page views each variant was shown on.
+func (t *Tally) Impressions() float64 {
+	return float64(t.Exposure) / float64(len(t.Variants))
+}
+
+// CTR is the rate variant v is clicked at, per impression.
+func (t *Tally) CTR(v int) float64 {
+	n := t.Impressions()
+	if n == 0 {
+		return 0
+	}
+	return float64(t.Clicks[v]) / n
+}
+
+// Total is the clicks on every variant.
+func (t *Tally) Total() int {
+	var n int
+	for _, c := range t.Clicks {
+		n += c
+	}
+	return n
+}
+
+// Winner returns the most clicked variant and the chance the lead over
+// the runner-up is noise: the p-value of a two-proportion z-test, two
+// sided, between the two.
+func (t *Tally) Winner() (v int, p float64) {
+	best, second := 0, -1
+	for i := 1; i < len(t.Clicks); i++ {
+		switch {
+		case t.Clicks[i] > t.Clicks[best]:
+			best, second = i, best
+		case second < 0 || t.Clicks[i] > t.Clicks[second]:
+			second = i
+		}
+	}
+	n := t.Impressions()
+	if second < 0 || n == 0 {
+		return best, 1
+	}
+	p1, p2 := float64(t.Clicks[best])/n, float64(t.Clicks[second])/n
+	pooled := (p1 + p2) / 2
+	se := math.Sqrt(pooled * (1 - pooled) * 2 / n)
+	if se == 0 || math.IsNaN(se) {
+		return best, 1
+	}
+	z := (p1 - p2) / se
+	return best, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// Collect tallies exps from Cloudflare's analytics for the UTC days from
+// since to until. limit caps the distinct paths fetched per day.
+func Collect(ctx context.Context, cf *cloudflare.Client, exps []Experiment, since, until time.Time, limit int) ([]*Tally, error) {
+	tallies := make([]*Tally, len(exps))
+	byURL := map[string]*Tally{}
+	for i, e := range exps {
+		tallies[i] = &Tally{Experiment: e, Clicks: make([]int, len(e.Variants))}
+		byURL[e.URL] = tallies[i]
+	}
+	tagged := map[string]any{}
+	for k, v := range cloudflare.PageViews {
+		tagged[k] = v
+	}
+	tagged["clientRequestQuery_like"] = "%" + Param + "=%"
+
+	for day := since; day.Before(until); day = day.Add(24 * time.Hour) {
+		views, err := cf.Paths(ctx, day, cloudflare.PageViews, limit)
+		if err != nil {
+			return nil, err
+		}
+		var total int
+		own := map[string]int{}
+		for _, pc := range views {
+			total += pc.Count
+			own[pc.Path] += pc.Count
+		}
+		for _, t := range tallies {
+			t.Exposure += total - own[t.URL]
+		}
+
+		clicks, err := cf.Queries(ctx, day, tagged, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, qc := range clicks {
+			t, ok := byURL[qc.Path]
+			if !ok {
+				continue
+			}
+			q, err := url.ParseQuery(strings.TrimPrefix(qc.Query, "?"))
+			if err != nil {
+				continue
+			}
+			v, err := strconv.Atoi(q.Get(Param))
+			if err != nil || v < 0 || v >= len(t.Clicks) {
+				continue
+			}
+			t.Clicks[v] += qc.Count
+		}
+	}
+	return tallies, nil
+}
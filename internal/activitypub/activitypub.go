@@ -0,0 +1,313 @@
+// Package activitypub makes the blog followable from Mastodon and other
+// ActivityPub servers as @blog@rednafi.com: the actor and its WebFinger
+// record, the Notes new posts are published as, signed delivery to
+// followers' inboxes, and verification of the activities they send back.
+//
+// cmd/apd serves the actor, inbox, and outbox; `blogctl ap publish` hands
+// it new posts after a deploy.
+package activitypub
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// ContentType is the media type of ActivityPub documents.
+const ContentType = "application/activity+json"
+
+// Public addresses an activity to everyone.
+const Public = "https://www.w3.org/ns/activitystreams#Public"
+
+// DefaultUser is the blog's handle, as in @blog@rednafi.com.
+const DefaultUser = "blog"
+
+var contexts = []any{
+	"https://www.w3.org/ns/activitystreams",
+	"https://w3id.org/security/v1",
+}
+
+// Blog is the actor the site federates as.
+type Blog struct {
+	// BaseURL is the site's, with no trailing slash; the actor's URLs and
+	// its handle's domain derive from it.
+	BaseURL string
+	User    string
+	Name    string
+	Summary string
+	Icon    string
+}
+
+// FromSite describes the blog as user from the Hugo config.
+func FromSite(cfg *site.Config, user string) Blog {
+	b := Blog{BaseURL: cfg.BaseURL, User: user, Name: cfg.Title, Summary: cfg.Params.Description}
+	if len(cfg.Params.Images) > 0 {
+		b.Icon = cfg.Params.Images[0]
+	}
+	return b
+}
+
+// Host is the handle's domain.
+func (b Blog) Host() string {
+	u, err := url.Parse(b.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// Handle is the address people follow, as in blog@rednafi.com.
+func (b Blog) Handle() string { return b.User + "@" + b.Host() }
+
+// ActorID is the actor's URL, which the other URLs hang off.
+func (b Blog) ActorID() string { return b.BaseURL + "/ap/" + b.User }
+
+// KeyID names the actor's public key in signatures.
+func (b Blog) KeyID() string { return b.ActorID() + "#main-key" }
+
+func (b Blog) Inbox() string     { return b.ActorID() + "/inbox" }
+func (b Blog) Outbox() string    { return b.ActorID() + "/outbox" }
+func (b Blog) Followers() string { return b.ActorID() + "/followers" }
+
+// NoteID is the URL of the Note for the post with slug.
+func (b Blog) NoteID(slug string) string { return b.ActorID() + "/notes/" + slug }
+
+// Actor is an ActivityPub actor, ours or a follower's. Only the fields the
+// blog needs are decoded from others.
+type Actor struct {
+	Context           any    `json:"@context,omitempty"`
+	ID                string `json:"id"`
+	Type              string `json:"type"`
+	PreferredUsername string `json:"preferredUsername,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Summary           string `json:"summary,omitempty"`
+	URL               string `json:"url,omitempty"`
+	Icon              *Image `json:"icon,omitempty"`
+	Inbox             string `json:"inbox"`
+	Outbox            string `json:"outbox,omitempty"`
+	Followers         string `json:"followers,omitempty"`
+	Endpoints         *struct {
+		SharedInbox string `json:"sharedInbox,omitempty"`
+	} `json:"endpoints,omitempty"`
+	PublicKey PublicKey `json:"publicKey"`
+}
+
+// SharedInbox returns the actor's shared inbox, or its own if it has none.
+func (a *Actor) SharedInbox() string {
+	if a.Endpoints != nil && a.Endpoints.SharedInbox != "" {
+		return a.Endpoints.SharedInbox
+	}
+	return a.Inbox
+}
+
+// Image is an actor's icon.
+type Image struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// PublicKey is the key an actor signs its requests with.
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// Actor returns the blog's actor document with the public key publicPEM.
+func (b Blog) Actor(publicPEM string) Actor {
+	a := Actor{
+		Context:           contexts,
+		ID:                b.ActorID(),
+		Type:              "Service",
+		PreferredUsername: b.User,
+		Name:              b.Name,
+		Summary:           "<p>" + html.EscapeString(b.Summary) + "</p>",
+		URL:               b.BaseURL + "/",
+		Inbox:             b.Inbox(),
+		Outbox:            b.Outbox(),
+		Followers:         b.Followers(),
+		PublicKey:         PublicKey{ID: b.KeyID(), Owner: b.ActorID(), PublicKeyPem: publicPEM},
+	}
+	if b.Icon != "" {
+		a.Icon = &Image{Type: "Image", URL: b.Icon}
+	}
+	return a
+}
+
+// JRD is a WebFinger response.
+type JRD struct {
+	Subject string   `json:"subject"`
+	Aliases []string `json:"aliases,omitempty"`
+	Links   []Link   `json:"links"`
+}
+
+// Link is a link in a JRD.
+type Link struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+// WebFinger answers a lookup of resource, which may be the acct: URI of the
+// handle or the actor's URL. It reports false for anyone else.
+func (b Blog) WebFinger(resource string) (JRD, bool) {
+	acct := "acct:" + b.Handle()
+	if !strings.EqualFold(resource, acct) && resource != b.ActorID() {
+		return JRD{}, false
+	}
+	return JRD{
+		Subject: acct,
+		Aliases: []string{b.ActorID()},
+		Links: []Link{
+			{Rel: "self", Type: ContentType, Href: b.ActorID()},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: b.BaseURL + "/"},
+		},
+	}, true
+}
+
+// Activity is an activity sent or received. Object is left raw since it's
+// a URL in some activities and an embedded object in others.
+type Activity struct {
+	Context   any             `json:"@context,omitempty"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Object    json.RawMessage `json:"object,omitempty"`
+	Published *time.Time      `json:"published,omitempty"`
+	To        []string        `json:"to,omitempty"`
+	CC        []string        `json:"cc,omitempty"`
+}
+
+// ObjectID returns the ID of the activity's object, whether it's a URL or
+// embedded.
+func (a *Activity) ObjectID() string {
+	var id string
+	if json.Unmarshal(a.Object, &id) == nil {
+		return id
+	}
+	var obj struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(a.Object, &obj)
+	return obj.ID
+}
+
+// Inner decodes an embedded object that is itself an activity, as in the
+// Follow an Undo takes back.
+func (a *Activity) Inner() (*Activity, error) {
+	var in Activity
+	if err := json.Unmarshal(a.Object, &in); err != nil {
+		return nil, fmt.Errorf("activitypub: %s object: %w", a.Type, err)
+	}
+	return &in, nil
+}
+
+// Note is a post as it appears in followers' timelines. It carries its
+// own @context so it can be served on its own at its ID.
+type Note struct {
+	Context      any       `json:"@context,omitempty"`
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	AttributedTo string    `json:"attributedTo"`
+	Name         string    `json:"name,omitempty"`
+	Content      string    `json:"content"`
+	URL          string    `json:"url"`
+	Published    time.Time `json:"published"`
+	To           []string  `json:"to"`
+	CC           []string  `json:"cc"`
+	Tag          []Tag     `json:"tag,omitempty"`
+}
+
+// Tag is a hashtag on a Note.
+type Tag struct {
+	Type string `json:"type"`
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+// Create returns the activity that publishes p as a Note: its title linked
+// to the post, its summary, and its tags as hashtags linking to the tag
+// pages.
+func (b Blog) Create(cfg *site.Config, p *content.Post) Activity {
+	link := cfg.Permalink(p.RelPermalink())
+	summary := p.Description
+	if summary == "" {
+		summary = p.Summary
+	}
+	var c strings.Builder
+	fmt.Fprintf(&c, `<p><a href="%s">%s</a></p>`, html.EscapeString(link), html.EscapeString(p.Title))
+	if summary != "" {
+		fmt.Fprintf(&c, "<p>%s</p>", html.EscapeString(summary))
+	}
+	n := Note{
+		Context:      contexts[0],
+		ID:           b.NoteID(p.Slug),
+		Type:         "Note",
+		AttributedTo: b.ActorID(),
+		URL:          link,
+		Published:    p.Date.UTC(),
+		To:           []string{Public},
+		CC:           []string{b.Followers()},
+	}
+	var tags []string
+	for _, t := range p.Tags {
+		name := hashtag(t)
+		if name == "" {
+			continue
+		}
+		href := cfg.Permalink("/tags/" + content.TagSlug(t) + "/")
+		n.Tag = append(n.Tag, Tag{Type: "Hashtag", Href: href, Name: "#" + name})
+		tags = append(tags, fmt.Sprintf(`<a href="%s" class="mention hashtag" rel="tag">#<span>%s</span></a>`,
+			html.EscapeString(href), html.EscapeString(name)))
+	}
+	if len(tags) > 0 {
+		fmt.Fprintf(&c, "<p>%s</p>", strings.Join(tags, " "))
+	}
+	n.Content = c.String()
+
+	obj, _ := json.Marshal(n)
+	published := n.Published
+	return Activity{
+		Context:   contexts[0],
+		ID:        n.ID + "#create",
+		Type:      "Create",
+		Actor:     b.ActorID(),
+		Object:    obj,
+		Published: &published,
+		To:        n.To,
+		CC:        n.CC,
+	}
+}
+
+// hashtag drops the characters a hashtag can't hold.
+func hashtag(tag string) string {
+	var b strings.Builder
+	for _, r := range tag {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Collection is an OrderedCollection, such as the outbox or the follower
+// count.
+type Collection struct {
+	Context      any               `json:"@context"`
+	ID           string            `json:"id"`
+	Type         string            `json:"type"`
+	TotalItems   int               `json:"totalItems"`
+	OrderedItems []json.RawMessage `json:"orderedItems,omitempty"`
+}
+
+// NewCollection returns the collection id of total items, listing items.
+func NewCollection(id string, total int, items []json.RawMessage) Collection {
+	return Collection{Context: contexts[0], ID: id, Type: "OrderedCollection", TotalItems: total, OrderedItems: items}
+}
@@ -0,0 +1,113 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/publicnet"
+)
+
+// Client talks to other servers as the blog, signing every request.
+type Client struct {
+	// HTTP makes the requests. The actors, keys, and inboxes it's sent to
+	// come from whoever posts to the inbox, so nil is a client that only
+	// connects to public addresses.
+	HTTP  *http.Client
+	KeyID string
+	Key   *rsa.PrivateKey
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return publicnet.Client(20 * time.Second)
+}
+
+// ErrGone is the error FetchActor wraps when the actor was deleted: its
+// server answers 404 or 410, or with a Tombstone in its place.
+var ErrGone = errors.New("actor is gone")
+
+// FetchActor fetches the actor at id. Servers in authorized fetch mode
+// want even GETs signed.
+func (c *Client) FetchActor(ctx context.Context, id string) (*Actor, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentType)
+	if err := Sign(req, nil, c.KeyID, c.Key); err != nil {
+		return nil, err
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("activitypub: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("activitypub: GET %s: %s: %w", id, resp.Status, ErrGone)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("activitypub: GET %s: %s", id, resp.Status)
+	}
+	var a Actor
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&a); err != nil {
+		return nil, fmt.Errorf("activitypub: GET %s: %w", id, err)
+	}
+	if a.Type == "Tombstone" {
+		return nil, fmt.Errorf("activitypub: GET %s: %w", id, ErrGone)
+	}
+	if a.ID != id || a.Inbox == "" {
+		return nil, fmt.Errorf("activitypub: GET %s: not an actor", id)
+	}
+	return &a, nil
+}
+
+// PublicKey is a KeyFetcher that fetches the key's actor. The key ID is
+// the actor's URL with a fragment, by convention.
+func (c *Client) PublicKey(ctx context.Context, keyID string) (*rsa.PublicKey, string, error) {
+	id, _, _ := strings.Cut(keyID, "#")
+	a, err := c.FetchActor(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if a.PublicKey.ID != keyID {
+		return nil, "", fmt.Errorf("activitypub: %s doesn't have key %s", id, keyID)
+	}
+	key, err := ParsePublicKeyPEM(a.PublicKey.PublicKeyPem)
+	return key, a.ID, err
+}
+
+// Deliver posts activity to inbox.
+func (c *Client) Deliver(ctx context.Context, inbox string, activity any) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	if err := Sign(req, body, c.KeyID, c.Key); err != nil {
+		return err
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("activitypub: deliver to %s: %w", inbox, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("activitypub: deliver to %s: %s: %s", inbox, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
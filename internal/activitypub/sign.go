@@ -0,0 +1,145 @@
+package activitypub
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MaxClockSkew is how far a signed request's Date may be from now.
+const MaxClockSkew = 12 * time.Hour
+
+// Sign adds an HTTP Signature (draft-cavage-http-signatures, as Mastodon
+// uses it) to r, covering the request target, Host, Date, and, when there
+// is a body, its Digest.
+func Sign(r *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	if r.Header.Get("Date") == "" {
+		r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		r.Header.Set("Digest", digest(body))
+		headers = append(headers, "digest")
+	}
+	sum := sha256.Sum256([]byte(signingString(r, headers)))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// KeyFetcher returns the public key keyID names and the actor that owns
+// it.
+type KeyFetcher func(ctx context.Context, keyID string) (key *rsa.PublicKey, owner string, err error)
+
+// Verify checks the HTTP Signature on r, whose body was body, and returns
+// the actor that signed it. A POST must sign its Digest, and the Date must
+// be within MaxClockSkew.
+func Verify(ctx context.Context, r *http.Request, body []byte, fetch KeyFetcher) (string, error) {
+	params, err := parseSignature(r.Header.Get("Signature"))
+	if err != nil {
+		return "", err
+	}
+	headers := strings.Fields(params["headers"])
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	signed := map[string]bool{}
+	for _, h := range headers {
+		signed[strings.ToLower(h)] = true
+	}
+	for _, h := range []string{"(request-target)", "host", "date"} {
+		if !signed[h] {
+			return "", fmt.Errorf("activitypub: signature doesn't cover %s", h)
+		}
+	}
+	if r.Method == http.MethodPost {
+		if !signed["digest"] {
+			return "", errors.New("activitypub: signature doesn't cover the digest")
+		}
+		if r.Header.Get("Digest") != digest(body) {
+			return "", errors.New("activitypub: digest doesn't match the body")
+		}
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return "", fmt.Errorf("activitypub: date: %w", err)
+	}
+	if d := time.Since(date); d > MaxClockSkew || d < -MaxClockSkew {
+		return "", fmt.Errorf("activitypub: date %s is too far off", r.Header.Get("Date"))
+	}
+	sig, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return "", fmt.Errorf("activitypub: signature: %w", err)
+	}
+
+	key, owner, err := fetch(ctx, params["keyId"])
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(signingString(r, headers)))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		return "", errors.New("activitypub: bad signature")
+	}
+	return owner, nil
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func signingString(r *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		h = strings.ToLower(h)
+		var v string
+		switch h {
+		case "(request-target)":
+			v = strings.ToLower(r.Method) + " " + r.URL.RequestURI()
+		case "host":
+			v = r.Host
+		default:
+			v = strings.Join(r.Header.Values(h), ", ")
+		}
+		lines = append(lines, h+": "+v)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSignature splits a Signature header into its parameters.
+func parseSignature(h string) (map[string]string, error) {
+	if h == "" {
+		return nil, errors.New("activitypub: request isn't signed")
+	}
+	params := map[string]string{}
+	for h != "" {
+		k, rest, ok := strings.Cut(h, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return nil, errors.New("activitypub: malformed signature header")
+		}
+		v, after, ok := strings.Cut(rest[1:], `"`)
+		if !ok {
+			return nil, errors.New("activitypub: malformed signature header")
+		}
+		params[strings.TrimSpace(k)] = v
+		h = strings.TrimPrefix(strings.TrimSpace(after), ",")
+	}
+	if params["keyId"] == "" || params["signature"] == "" {
+		return nil, errors.New("activitypub: signature lacks keyId or signature")
+	}
+	return params, nil
+}
@@ -0,0 +1,153 @@
+package activitypub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Store keeps the blog's followers and the activities it published in
+// SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS followers (
+	actor        TEXT PRIMARY KEY,
+	inbox        TEXT NOT NULL,
+	shared_inbox TEXT NOT NULL,
+	followed     INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS outbox (
+	id        TEXT PRIMARY KEY,
+	object    TEXT NOT NULL,
+	published INTEGER NOT NULL,
+	activity  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS outbox_object ON outbox (object);
+`
+
+// OpenStore opens (or creates) the database at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("activitypub: init %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error { return s.db.Close() }
+
+// Follow records a as a follower, or refreshes its inboxes.
+func (s *Store) Follow(ctx context.Context, a *Actor, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO followers (actor, inbox, shared_inbox, followed) VALUES (?, ?, ?, ?)
+		ON CONFLICT (actor) DO UPDATE SET inbox = excluded.inbox, shared_inbox = excluded.shared_inbox`,
+		a.ID, a.Inbox, a.SharedInbox(), now.Unix())
+	return err
+}
+
+// Unfollow removes actor from the followers, if it's one.
+func (s *Store) Unfollow(ctx context.Context, actor string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM followers WHERE actor = ?`, actor)
+	return err
+}
+
+// FollowerCount returns how many actors follow the blog.
+func (s *Store) FollowerCount(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM followers`).Scan(&n)
+	return n, err
+}
+
+// Inboxes returns the inboxes to deliver to so every follower gets an
+// activity once: each server's shared inbox, or the follower's own.
+func (s *Store) Inboxes(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT shared_inbox FROM followers ORDER BY shared_inbox`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var inbox string
+		if err := rows.Scan(&inbox); err != nil {
+			return nil, err
+		}
+		out = append(out, inbox)
+	}
+	return out, rows.Err()
+}
+
+// Publish adds a Create to the outbox. It reports false if the activity
+// was already there.
+func (s *Store) Publish(ctx context.Context, a Activity) (bool, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	published := time.Now()
+	if a.Published != nil {
+		published = *a.Published
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO outbox (id, object, published, activity) VALUES (?, ?, ?, ?)`,
+		a.ID, a.ObjectID(), published.Unix(), string(b))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Outbox returns the total number of published activities and the newest
+// limit of them.
+func (s *Store) Outbox(ctx context.Context, limit int) (int, []json.RawMessage, error) {
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM outbox`).Scan(&total); err != nil {
+		return 0, nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT activity FROM outbox ORDER BY published DESC, id LIMIT ?`, limit)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	var out []json.RawMessage
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			return 0, nil, err
+		}
+		out = append(out, json.RawMessage(a))
+	}
+	return total, out, rows.Err()
+}
+
+// Object returns the published object with id, such as a Note, or nil if
+// there's none.
+func (s *Store) Object(ctx context.Context, id string) (json.RawMessage, error) {
+	var a string
+	err := s.db.QueryRowContext(ctx, `SELECT activity FROM outbox WHERE object = ?`, id).Scan(&a)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var act Activity
+	if err := json.Unmarshal([]byte(a), &act); err != nil {
+		return nil, err
+	}
+	return act.Object, nil
+}
@@ -0,0 +1,250 @@
+// Package api builds a static, read-only JSON API of the posts for small
+// clients and experiments that would otherwise scrape the HTML:
+//
+//	/api/posts/index.json          the newest posts, PerPage at a time
+//	/api/posts/page/<n>.json       the following pages
+//	/api/posts/<slug>.json         a post's metadata, markdown, and HTML
+//	/api/posts/<lang>/<slug>.json  the same of a translation
+//	/api/tags/index.json           every tag with its post count
+//	/api/tags/<tag>.json           a tag's posts
+//
+// URLs in the documents are absolute, so a client can follow them from
+// any one of them.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/readtime"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// Root is the site path the API is served under.
+const Root = "/api/"
+
+// DefaultPerPage is how many posts a page of /api/posts/ lists.
+const DefaultPerPage = 20
+
+// Summary is a post as it's listed in pages and tags.
+type Summary struct {
+	Slug    string    `json:"slug"`
+	Lang    string    `json:"lang"`
+	Title   string    `json:"title"`
+	URL     string    `json:"url"`
+	API     string    `json:"api_url"`
+	Section string    `json:"section"`
+	Summary string    `json:"summary,omitempty"`
+	Date    time.Time `json:"date"`
+	Updated time.Time `json:"updated"`
+	Tags    []string  `json:"tags"`
+}
+
+// Post is a post's full document.
+type Post struct {
+	Summary
+	WordCount   int       `json:"word_count"`
+	ReadingTime int       `json:"reading_time"`
+	Headings    []Heading `json:"headings"`
+	Markdown    string    `json:"content_markdown"`
+	HTML        string    `json:"content_html"`
+}
+
+// Heading is an entry of a post's table of contents.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	URL   string `json:"url"`
+}
+
+// Page is one page of the post listing, newest first.
+type Page struct {
+	Page       int       `json:"page"`
+	TotalPages int       `json:"total_pages"`
+	TotalPosts int       `json:"total_posts"`
+	Prev       string    `json:"prev,omitempty"`
+	Next       string    `json:"next,omitempty"`
+	Posts      []Summary `json:"posts"`
+}
+
+// Tag is a tag's document.
+type Tag struct {
+	Name  string    `json:"name"`
+	Slug  string    `json:"slug"`
+	URL   string    `json:"url"`
+	API   string    `json:"api_url"`
+	Count int       `json:"count"`
+	Posts []Summary `json:"posts,omitempty"`
+}
+
+// File is a document to write, at a path relative to the site root.
+type File struct {
+	Path string
+	Doc  any
+}
+
+// Build returns every document of the API for the published posts, with
+// reading times at speed's pace.
+func Build(cfg *site.Config, posts []*content.Post, perPage int, speed readtime.Config) ([]File, error) {
+	if perPage < 1 {
+		perPage = DefaultPerPage
+	}
+	posts = content.Published(posts)
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Date.After(posts[j].Date) })
+
+	var (
+		files     []File
+		summaries = make([]Summary, 0, len(posts))
+		tags      = map[string]*Tag{}
+	)
+	for _, p := range posts {
+		doc, err := newPost(cfg, p, speed)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{postPath(p.DataKey()), doc})
+		summaries = append(summaries, doc.Summary)
+		for _, name := range p.Tags {
+			slug := content.TagSlug(name)
+			t, ok := tags[slug]
+			if !ok {
+				t = &Tag{
+					Name: name,
+					Slug: slug,
+					URL:  cfg.Permalink("/tags/" + slug + "/"),
+					API:  cfg.Permalink(tagPath(slug)),
+				}
+				tags[slug] = t
+			}
+			t.Posts = append(t.Posts, doc.Summary)
+			t.Count++
+		}
+	}
+
+	pages := max(1, int(math.Ceil(float64(len(summaries))/float64(perPage))))
+	for n := 1; n <= pages; n++ {
+		pg := Page{
+			Page:       n,
+			TotalPages: pages,
+			TotalPosts: len(summaries),
+			Posts:      summaries[min((n-1)*perPage, len(summaries)):min(n*perPage, len(summaries))],
+		}
+		if n > 1 {
+			pg.Prev = cfg.Permalink(pagePath(n - 1))
+		}
+		if n < pages {
+			pg.Next = cfg.Permalink(pagePath(n + 1))
+		}
+		files = append(files, File{pagePath(n), pg})
+	}
+
+	slugs := make([]string, 0, len(tags))
+	for s := range tags {
+		slugs = append(slugs, s)
+	}
+	sort.Strings(slugs)
+	index := make([]Tag, 0, len(slugs))
+	for _, s := range slugs {
+		t := *tags[s]
+		files = append(files, File{tagPath(s), t})
+		t.Posts = nil
+		index = append(index, t)
+	}
+	files = append(files, File{path.Join(Root, "tags", "index.json"), index})
+	return files, nil
+}
+
+func newPost(cfg *site.Config, p *content.Post, speed readtime.Config) (Post, error) {
+	body, err := markdown.Render([]byte(p.Body))
+	if err != nil {
+		return Post{}, fmt.Errorf("api: %s: %w", p.Path, err)
+	}
+	summary := p.Description
+	if summary == "" {
+		summary = p.Summary
+	}
+	link := cfg.Permalink(p.RelPermalink())
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	words := len(strings.Fields(doc.PlainText(false)))
+	headings := []Heading{}
+	for _, h := range doc.Headings() {
+		headings = append(headings, Heading{Level: h.Level, Text: h.Text, URL: link + "#" + h.ID})
+	}
+	tags := p.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return Post{
+		Summary: Summary{
+			Slug:    p.Slug,
+			Lang:    p.LangOrDefault(),
+			Title:   p.Title,
+			URL:     link,
+			API:     cfg.Permalink(postPath(p.DataKey())),
+			Section: p.Section,
+			Summary: summary,
+			Date:    p.Date,
+			Updated: p.Updated(),
+			Tags:    tags,
+		},
+		WordCount:   words,
+		ReadingTime: speed.Post(p).Minutes,
+		Headings:    headings,
+		Markdown:    p.Body,
+		HTML:        string(markdown.Absolutize(body, cfg.BaseURL)),
+	}, nil
+}
+
+func postPath(key string) string { return path.Join(Root, "posts", key+".json") }
+func tagPath(slug string) string { return path.Join(Root, "tags", slug+".json") }
+
+func pagePath(n int) string {
+	if n == 1 {
+		return path.Join(Root, "posts", "index.json")
+	}
+	return path.Join(Root, "posts", "page", fmt.Sprintf("%d.json", n))
+}
+
+// Write encodes files under dir, typically static/, leaving unchanged ones
+// alone, and removes the files under dir's api/ that are no longer part of
+// the API, such as a renamed post's. It returns the paths written and
+// removed.
+func Write(dir string, files []File) (written, removed []string, err error) {
+	keep := map[string]bool{}
+	for _, f := range files {
+		b, err := json.MarshalIndent(f.Doc, "", "  ")
+		if err != nil {
+			return written, removed, fmt.Errorf("api: %s: %w", f.Path, err)
+		}
+		b = append(b, '\n')
+		dst := filepath.Join(dir, filepath.FromSlash(f.Path))
+		keep[dst] = true
+		wrote, err := fsutil.WriteIfChanged(dst, b)
+		if err != nil {
+			return written, removed, err
+		}
+		if wrote {
+			written = append(written, dst)
+		}
+	}
+
+	err = filepath.WalkDir(filepath.Join(dir, filepath.FromSlash(Root)), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || keep[p] || filepath.Ext(p) != ".json" {
+			return err
+		}
+		removed = append(removed, p)
+		return os.Remove(p)
+	})
+	return written, removed, err
+}
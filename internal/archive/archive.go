@@ -0,0 +1,164 @@
+// Package archive submits outbound links to the Internet Archive's Wayback
+// Machine and keeps track of the snapshots in data/archives.json, which the
+// link render hook reads to swap dead links for their archived copies.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultPath is where the snapshot map lives, relative to the repo root.
+const DefaultPath = "data/archives.json"
+
+// Entry records the snapshot for one outbound URL.
+type Entry struct {
+	Snapshot   string    `json:"snapshot"`
+	ArchivedAt time.Time `json:"archived_at"`
+	// Dead marks links that no longer resolve. The render hook points
+	// these at Snapshot instead of the original URL.
+	Dead bool `json:"dead,omitempty"`
+}
+
+// Store maps outbound URLs to their snapshots.
+type Store map[string]Entry
+
+// Load reads the store at path. A missing file yields an empty store.
+func Load(path string) (Store, error) {
+	s := Store{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("archive: parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the store to path. Keys are sorted by encoding/json, so the
+// file diffs cleanly.
+func (s Store) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Client talks to the Wayback Machine's availability and Save Page Now APIs.
+type Client struct {
+	HTTP *http.Client
+	// AccessKey and SecretKey authenticate Save Page Now requests, which
+	// raises the rate limit. Both are optional.
+	AccessKey string
+	SecretKey string
+}
+
+const (
+	availabilityURL = "https://archive.org/wayback/available"
+	saveURL         = "https://web.archive.org/save/"
+	snapshotPrefix  = "https://web.archive.org/web/"
+)
+
+// Latest returns the most recent existing snapshot of u, if there is one.
+func (c *Client) Latest(ctx context.Context, u string) (Entry, bool, error) {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, availabilityURL+"?url="+url.QueryEscape(u), nil,
+	)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		ArchivedSnapshots struct {
+			Closest struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+				Timestamp string `json:"timestamp"`
+				Status    string `json:"status"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Entry{}, false, fmt.Errorf("archive: decode availability: %w", err)
+	}
+	closest := body.ArchivedSnapshots.Closest
+	if !closest.Available || !strings.HasPrefix(closest.Status, "2") {
+		return Entry{}, false, nil
+	}
+	at, _ := time.Parse("20060102150405", closest.Timestamp)
+	return Entry{Snapshot: httpsURL(closest.URL), ArchivedAt: at}, true, nil
+}
+
+// Save asks the Wayback Machine to capture u now and returns the snapshot.
+func (c *Client) Save(ctx context.Context, u string) (Entry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, saveURL+u, nil)
+	if err != nil {
+		return Entry{}, err
+	}
+	if c.AccessKey != "" {
+		req.Header.Set("Authorization", "LOW "+c.AccessKey+":"+c.SecretKey)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	// The capture's path comes back in Content-Location; if the client
+	// followed a redirect instead, the final URL is the snapshot.
+	snap := resp.Header.Get("Content-Location")
+	switch {
+	case snap != "":
+		snap = "https://web.archive.org" + snap
+	case strings.HasPrefix(resp.Request.URL.String(), snapshotPrefix):
+		snap = resp.Request.URL.String()
+	default:
+		return Entry{}, fmt.Errorf("archive: save %s: no snapshot location in response", u)
+	}
+	return Entry{Snapshot: snap, ArchivedAt: time.Now().UTC()}, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", "rednafi.com-archiver (+https://rednafi.com)")
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("archive: %s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return resp, nil
+}
+
+// IsSnapshot reports whether u already points into the Wayback Machine.
+func IsSnapshot(u string) bool {
+	return strings.HasPrefix(httpsURL(u), snapshotPrefix)
+}
+
+func httpsURL(u string) string {
+	return strings.Replace(u, "http://", "https://", 1)
+}
@@ -0,0 +1,197 @@
+// Package ask answers readers' questions from the posts: it retrieves the
+// sections closest to a question from an index of embedded passages and
+// has a language model answer from those alone, citing the posts and
+// sections it used.
+//
+// Embeddings come from internal/embed's client, with its EMBED_*
+// variables, and answers from any OpenAI-compatible /chat/completions
+// endpoint. `blogctl index` builds the index offline, cmd/askd serves
+// answers from it, and Eval scores both against golden questions.
+package ask
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/embed"
+)
+
+// Default chat endpoint and model.
+const (
+	DefaultBaseURL = "https://api.openai.com/v1"
+	DefaultModel   = "gpt-4o-mini"
+)
+
+// Chat requests completions from an OpenAI-compatible API.
+type Chat struct {
+	HTTP *http.Client
+	// BaseURL is the API root, e.g. "https://api.openai.com/v1".
+	BaseURL string
+	APIKey  string
+	Model   string
+}
+
+// ChatFromEnv returns a client configured by ASK_BASE_URL, ASK_API_KEY,
+// and ASK_MODEL, falling back to the defaults for unset values and to
+// OPENAI_API_KEY for the key.
+func ChatFromEnv() *Chat {
+	c := &Chat{
+		BaseURL: os.Getenv("ASK_BASE_URL"),
+		APIKey:  os.Getenv("ASK_API_KEY"),
+		Model:   os.Getenv("ASK_MODEL"),
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	if c.APIKey == "" {
+		c.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if c.Model == "" {
+		c.Model = DefaultModel
+	}
+	return c
+}
+
+// Complete returns the model's reply to the system and user messages.
+func (c *Chat) Complete(ctx context.Context, system, user string) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"model": c.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
+		},
+		"temperature": 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+"/chat/completions", bytes.NewReader(body),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("ask: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("ask: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("ask: decode response: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("ask: no reply")
+	}
+	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+}
+
+// NotFound is the answer to a question the posts don't cover.
+const NotFound = "I couldn't find that in the blog's posts."
+
+const system = `You answer readers' questions about a personal software blog, using only the numbered sources from its posts below.
+Cite every claim with the number of its source in square brackets, like [2]; cite only sources that say it.
+Keep answers short: a paragraph or two, with a code snippet only if a source has one.
+If the sources don't answer the question, reply with exactly: ` + NotFound
+
+// Asker answers questions from an index.
+type Asker struct {
+	Index *Index
+	Embed *embed.Client
+	Chat  *Chat
+	// K is how many passages the model is given, and PerPost the most
+	// of them from a single post.
+	K, PerPost int
+	// MinScore is the similarity below which a passage isn't relevant.
+	// When no passage reaches it, the question isn't sent to the model.
+	MinScore float64
+}
+
+// Answer is the reply to a question.
+type Answer struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	// Citations are the sources the answer cites, in the order of their
+	// numbers.
+	Citations []Source `json:"citations"`
+	// Retrieved are all the sources the model was given; see Eval.
+	Retrieved []Source `json:"-"`
+}
+
+// Ask retrieves the passages for q and has the model answer from them.
+func (a *Asker) Ask(ctx context.Context, q string) (Answer, error) {
+	vecs, err := a.Embed.Embed(ctx, []string{q})
+	if err != nil {
+		return Answer{}, err
+	}
+	sources := a.Index.Retrieve(vecs[0], a.K, a.PerPost)
+	for len(sources) > 0 && sources[len(sources)-1].Score < a.MinScore {
+		sources = sources[:len(sources)-1]
+	}
+	ans := Answer{Question: q, Answer: NotFound, Citations: []Source{}, Retrieved: sources}
+	if len(sources) == 0 {
+		return ans, nil
+	}
+
+	var b strings.Builder
+	for _, s := range sources {
+		fmt.Fprintf(&b, "[%d] %s\n%s\n\n", s.N, s.URL, s.Text)
+	}
+	b.WriteString("Question: " + q)
+	reply, err := a.Chat.Complete(ctx, system, b.String())
+	if err != nil {
+		return Answer{}, err
+	}
+	ans.Answer = reply
+	ans.Citations = cited(reply, sources)
+	return ans, nil
+}
+
+// citeRe matches a citation, including grouped ones like [1, 3].
+var citeRe = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// cited returns the sources reply cites, ignoring numbers it made up.
+func cited(reply string, sources []Source) []Source {
+	var ns []int
+	for _, m := range citeRe.FindAllStringSubmatch(reply, -1) {
+		for _, f := range strings.Split(m[1], ",") {
+			n, _ := strconv.Atoi(strings.TrimSpace(f))
+			if n >= 1 && n <= len(sources) && !slices.Contains(ns, n) {
+				ns = append(ns, n)
+			}
+		}
+	}
+	slices.Sort(ns)
+	out := []Source{}
+	for _, n := range ns {
+		out = append(out, sources[n-1])
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package ask
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultGolden is where the golden questions for Eval are kept.
+const DefaultGolden = "data/ask_eval.toml"
+
+// Golden is a question and what a good answer to it has.
+type Golden struct {
+	Question string `toml:"question"`
+	// URLs are the posts, as their paths, that answer the question; a
+	// good answer retrieves and cites at least one of them.
+	URLs []string `toml:"urls"`
+	// Phrases must all appear in the answer, ignoring case.
+	Phrases []string `toml:"phrases"`
+	// Unanswerable marks a question the posts don't cover, which should
+	// get NotFound.
+	Unanswerable bool `toml:"unanswerable"`
+}
+
+// LoadGolden reads the golden questions at path, a TOML file of [[pair]]
+// tables.
+func LoadGolden(path string) ([]Golden, error) {
+	var f struct {
+		Pair []Golden `toml:"pair"`
+	}
+	if _, err := toml.DecodeFile(path, &f); err != nil {
+		return nil, fmt.Errorf("ask: %w", err)
+	}
+	for i, g := range f.Pair {
+		if g.Question == "" {
+			return nil, fmt.Errorf("ask: %s: pair %d has no question", path, i+1)
+		}
+		if len(g.URLs) == 0 && !g.Unanswerable {
+			return nil, fmt.Errorf("ask: %s: %q has no urls and isn't unanswerable", path, g.Question)
+		}
+	}
+	return f.Pair, nil
+}
+
+// Result is how an answer fared against its golden question.
+type Result struct {
+	Golden Golden
+	Answer Answer
+	// Retrieved and Cited report whether one of the golden URLs was among
+	// the sources and the citations; Missing lists the phrases the answer
+	// lacks.
+	Retrieved, Cited bool
+	Missing          []string
+	Pass             bool
+}
+
+// Eval asks each golden question and scores the answers. With
+// retrievalOnly the model isn't asked, and a question passes when one of
+// its URLs is retrieved, or, if it's unanswerable, when none is relevant.
+func Eval(ctx context.Context, a *Asker, golden []Golden, retrievalOnly bool) ([]Result, error) {
+	var out []Result
+	for _, g := range golden {
+		var ans Answer
+		if retrievalOnly {
+			vecs, err := a.Embed.Embed(ctx, []string{g.Question})
+			if err != nil {
+				return nil, err
+			}
+			ans = Answer{Question: g.Question}
+			for _, s := range a.Index.Retrieve(vecs[0], a.K, a.PerPost) {
+				if s.Score >= a.MinScore {
+					ans.Retrieved = append(ans.Retrieved, s)
+				}
+			}
+		} else {
+			var err error
+			if ans, err = a.Ask(ctx, g.Question); err != nil {
+				return nil, fmt.Errorf("%q: %w", g.Question, err)
+			}
+		}
+
+		r := Result{Golden: g, Answer: ans}
+		r.Retrieved = anyURL(ans.Retrieved, g.URLs)
+		r.Cited = anyURL(ans.Citations, g.URLs)
+		lower := strings.ToLower(ans.Answer)
+		for _, p := range g.Phrases {
+			if !strings.Contains(lower, strings.ToLower(p)) {
+				r.Missing = append(r.Missing, p)
+			}
+		}
+		switch {
+		case g.Unanswerable && retrievalOnly:
+			r.Pass = len(ans.Retrieved) == 0
+		case g.Unanswerable:
+			r.Pass = ans.Answer == NotFound
+		case retrievalOnly:
+			r.Pass = r.Retrieved
+		default:
+			r.Pass = r.Retrieved && r.Cited && len(r.Missing) == 0
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// anyURL reports whether a source is one of the posts at urls, whichever
+// section of it the source is.
+func anyURL(sources []Source, urls []string) bool {
+	return slices.ContainsFunc(sources, func(s Source) bool {
+		u, _, _ := strings.Cut(s.URL, "#")
+		return slices.Contains(urls, u)
+	})
+}
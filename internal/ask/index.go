@@ -0,0 +1,219 @@
+package ask
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/embed"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// DefaultPath is where `blogctl index` writes the index and askd reads it.
+// Like embed.DefaultPath, it's kept out of data/ so Hugo doesn't load it.
+const DefaultPath = "ask-index.json"
+
+// Chunk is a passage of a post's section and its embedding.
+type Chunk struct {
+	// Section is the heading the passage is under, and Anchor its ID,
+	// both empty for the text before the first heading.
+	Section string       `json:"section,omitempty"`
+	Anchor  string       `json:"anchor,omitempty"`
+	Text    string       `json:"text"`
+	Vector  embed.Vector `json:"vector"`
+}
+
+// Post is a post's entry in the index.
+type Post struct {
+	Slug  string `json:"slug"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// Hash identifies the passages that were embedded, so unchanged posts
+	// aren't embedded again.
+	Hash   string  `json:"hash"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Index is the set of embedded posts, split by section.
+type Index struct {
+	Model string `json:"model"`
+	Posts []Post `json:"posts"`
+}
+
+// Load reads the index at path. A missing file yields an empty index.
+func Load(path string) (*Index, error) {
+	idx := &Index{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("ask: parse %s: %w", path, err)
+	}
+	return idx, nil
+}
+
+// Save writes the index to path.
+func (idx *Index) Save(path string) error {
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Chunks splits a post's prose into passages of up to embed.ChunkSize
+// bytes that don't cross a heading, so each can be cited by its section.
+// The text that's embedded starts with the post's title and the section's
+// heading, which carry the topic the passage itself may not name.
+func Chunks(p *content.Post) []Chunk {
+	var out []Chunk
+	for _, s := range markdown.Parse([]byte(p.Body), p.BodyLine).Sections() {
+		c := Chunk{}
+		if s.Heading != nil {
+			c.Section, c.Anchor = s.Heading.Text, s.Heading.ID
+		}
+		head := p.Title
+		if c.Section != "" {
+			head += " — " + c.Section
+		}
+		cur := head
+		for _, para := range strings.Split(s.Text, "\n") {
+			if para = strings.TrimSpace(para); para == "" {
+				continue
+			}
+			if len(cur)+len(para) > embed.ChunkSize && cur != head {
+				c.Text = cur
+				out = append(out, c)
+				cur = head
+			}
+			cur += "\n" + para
+		}
+		if cur != head {
+			c.Text = cur
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Stats reports what an Update did.
+type Stats struct {
+	Embedded int
+	Reused   int
+}
+
+// Update embeds every published article that's new or changed since idx
+// was built and drops posts that are gone, as embed.Index.Update does.
+// Notes are left out; they're too short to answer much.
+func (idx *Index) Update(ctx context.Context, c *embed.Client, posts []*content.Post, batch int) (Stats, error) {
+	if batch <= 0 {
+		batch = 64
+	}
+	prev := map[string]Post{}
+	if idx.Model == c.Model {
+		for _, p := range idx.Posts {
+			prev[p.Slug] = p
+		}
+	}
+
+	var st Stats
+	var next []Post
+	for _, p := range content.Articles(content.Published(posts)) {
+		chunks := Chunks(p)
+		h := hash(chunks)
+		if old, ok := prev[p.Slug]; ok && old.Hash == h {
+			old.URL, old.Title = p.RelPermalink(), p.Title
+			next = append(next, old)
+			st.Reused++
+			continue
+		}
+		for i := 0; i < len(chunks); i += batch {
+			part := chunks[i:min(i+batch, len(chunks))]
+			texts := make([]string, len(part))
+			for j, c := range part {
+				texts[j] = c.Text
+			}
+			vecs, err := c.Embed(ctx, texts)
+			if err != nil {
+				return st, fmt.Errorf("%s: %w", p.Path, err)
+			}
+			for j, v := range vecs {
+				part[j].Vector = v
+			}
+		}
+		next = append(next, Post{Slug: p.Slug, URL: p.RelPermalink(), Title: p.Title, Hash: h, Chunks: chunks})
+		st.Embedded++
+	}
+	idx.Model = c.Model
+	idx.Posts = next
+	return st, nil
+}
+
+func hash(chunks []Chunk) string {
+	h := sha256.New()
+	for _, c := range chunks {
+		h.Write([]byte(c.Anchor))
+		h.Write([]byte{0})
+		h.Write([]byte(c.Text))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Source is a passage retrieved for a question.
+type Source struct {
+	// N numbers the source as the model is told to cite it, from 1.
+	N     int    `json:"n"`
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+	// Section is the heading the passage is under, if any, and URL links
+	// to it.
+	Section string  `json:"section,omitempty"`
+	URL     string  `json:"url"`
+	Score   float64 `json:"score"`
+	Text    string  `json:"-"`
+}
+
+// Retrieve returns the k passages closest to q, best first, taking at most
+// perPost from any one post so a long post doesn't crowd out the rest.
+func (idx *Index) Retrieve(q embed.Vector, k, perPost int) []Source {
+	var all []Source
+	for _, p := range idx.Posts {
+		for _, c := range p.Chunks {
+			u := p.URL
+			if c.Anchor != "" {
+				u += "#" + c.Anchor
+			}
+			all = append(all, Source{
+				Slug: p.Slug, Title: p.Title, Section: c.Section, URL: u,
+				Score: q.Dot(c.Vector), Text: c.Text,
+			})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	var out []Source
+	taken := map[string]int{}
+	for _, s := range all {
+		if len(out) == k {
+			break
+		}
+		if perPost > 0 && taken[s.Slug] == perPost {
+			continue
+		}
+		taken[s.Slug]++
+		s.N = len(out) + 1
+		out = append(out, s)
+	}
+	return out
+}
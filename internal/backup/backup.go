@@ -0,0 +1,516 @@
+// Package backup keeps encrypted snapshots of the site's sources in an R2
+// bucket of their own, away from the ones it's served from. Every file is
+// encrypted with age to the recipients in data/backup.toml and stored
+// once, under blobs/<sha256>, however many snapshots have it. A snapshot
+// is the list of paths and the blobs they had, also encrypted, so taking
+// one and pruning old ones only takes the public keys, while restoring
+// takes an identity.
+//
+// The settings live in data/backup.toml:
+//
+//	bucket = "rednafi-backups"
+//	dirs = ["content", "data", "static"]
+//	recipients = ["age1..."]
+//
+//	[keep]
+//	last = 7
+//	daily = 14
+//	weekly = 8
+//	monthly = 12
+//	yearly = 5
+//
+// Blobs are named after the SHA-256 of what they hold, which tells anyone
+// who can list the bucket whether it holds a file they already have. The
+// sources are a public repository's, so that's no secret; don't back up
+// anything that is with this.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/r2"
+)
+
+// DefaultConfig is where the settings live.
+const DefaultConfig = "data/backup.toml"
+
+// Config is the backup settings file.
+type Config struct {
+	// Bucket is where the snapshots go. An empty bucket leaves it to
+	// R2_BUCKET.
+	Bucket string `toml:"bucket"`
+	// Dirs are the directories backed up, relative to the repo root.
+	Dirs []string `toml:"dirs"`
+	// Recipients are the age public keys the snapshots are encrypted to,
+	// as age-keygen prints them.
+	Recipients []string `toml:"recipients"`
+	Keep       Policy   `toml:"keep"`
+}
+
+// Load reads the settings at path.
+func Load(path string) (Config, error) {
+	c := Config{Dirs: []string{"content", "data", "static"}}
+	if _, err := toml.DecodeFile(path, &c); err != nil {
+		return c, fmt.Errorf("backup: %w", err)
+	}
+	return c, nil
+}
+
+// ParseRecipients parses c.Recipients.
+func (c Config) ParseRecipients() ([]age.Recipient, error) {
+	if len(c.Recipients) == 0 {
+		return nil, errors.New("backup: no recipients; add the public key from `age-keygen -o backup.key` to recipients")
+	}
+	rs, err := age.ParseRecipients(strings.NewReader(strings.Join(c.Recipients, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("backup: recipients: %w", err)
+	}
+	return rs, nil
+}
+
+// ReadIdentities reads the age identities in the file at path, such as
+// the one age-keygen writes.
+func ReadIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("backup: %s: %w", path, err)
+	}
+	return ids, nil
+}
+
+// Entry is a file in a snapshot.
+type Entry struct {
+	// Hash is the hex SHA-256 of the file's contents, and its blob's name.
+	Hash string      `json:"hash"`
+	Size int64       `json:"size"`
+	Mode fs.FileMode `json:"mode"`
+}
+
+// Snapshot is the state of the backed up directories at a time.
+type Snapshot struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Files are by path relative to the repo root, with forward slashes.
+	Files map[string]Entry `json:"files"`
+}
+
+// NewID returns the ID of a snapshot taken at t. IDs sort by time.
+func NewID(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// ParseID returns the time of the snapshot id.
+func ParseID(id string) (time.Time, error) {
+	t, err := time.Parse("20060102T150405Z", id)
+	if err != nil {
+		return t, fmt.Errorf("backup: %q isn't a snapshot ID", id)
+	}
+	return t, nil
+}
+
+// Size returns the total size of the snapshot's files.
+func (s *Snapshot) Size() int64 {
+	var n int64
+	for _, e := range s.Files {
+		n += e.Size
+	}
+	return n
+}
+
+// Take hashes every file under dirs, relative to root, into a snapshot
+// taken at t.
+func Take(root string, dirs []string, t time.Time) (*Snapshot, error) {
+	s := &Snapshot{ID: NewID(t), Time: t.UTC(), Files: map[string]Entry{}}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(filepath.Join(root, dir), func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			h := sha256.New()
+			n, err := io.Copy(h, f)
+			if err != nil {
+				return err
+			}
+			s.Files[filepath.ToSlash(rel)] = Entry{Hash: hex.EncodeToString(h.Sum(nil)), Size: n, Mode: info.Mode().Perm()}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("backup: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Store keeps snapshots in a bucket: the encrypted snapshot under
+// snapshots/<id>.age, the hashes of its blobs, in the clear so that
+// pruning needs no identity, under snapshots/<id>.blobs, and the
+// encrypted blobs under blobs/<hash>.
+type Store struct {
+	c          *r2.Client
+	recipients []age.Recipient
+}
+
+// NewStore returns a store in c's bucket that encrypts to recipients.
+func NewStore(c *r2.Client, recipients []age.Recipient) *Store {
+	return &Store{c: c, recipients: recipients}
+}
+
+const (
+	snapshotsPrefix = "snapshots/"
+	blobsPrefix     = "blobs/"
+)
+
+// Missing returns the hashes of the blobs in s the store doesn't have,
+// in order.
+func (st *Store) Missing(ctx context.Context, s *Snapshot) ([]string, error) {
+	have, err := st.blobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, e := range s.Files {
+		if !have[e.Hash] {
+			have[e.Hash] = true
+			missing = append(missing, e.Hash)
+		}
+	}
+	slices.Sort(missing)
+	return missing, nil
+}
+
+func (st *Store) blobs(ctx context.Context) (map[string]bool, error) {
+	objects, err := st.c.List(ctx, blobsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool, len(objects))
+	for _, o := range objects {
+		have[strings.TrimPrefix(o.Key, blobsPrefix)] = true
+	}
+	return have, nil
+}
+
+// Save uploads the blobs in missing, reading each from the first file in
+// s under root that has it, with up to jobs uploads at a time, and then
+// s itself, calling done after each blob.
+func (st *Store) Save(ctx context.Context, root string, s *Snapshot, missing []string, jobs int, done func(hash string)) error {
+	paths := map[string]string{}
+	for _, p := range slices.Sorted(maps.Keys(s.Files)) {
+		if h := s.Files[p].Hash; paths[h] == "" {
+			paths[h] = p
+		}
+	}
+	err := parallel(missing, jobs, func(hash string) error {
+		p := paths[hash]
+		b, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(p)))
+		if err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != hash {
+			return fmt.Errorf("backup: %s changed while it was backed up; try again", p)
+		}
+		enc, err := st.encrypt(b)
+		if err != nil {
+			return err
+		}
+		if err := st.c.Put(ctx, blobsPrefix+hash, enc, r2.PutOptions{ContentType: "application/octet-stream"}); err != nil {
+			return err
+		}
+		done(hash)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The blob list goes first: a snapshot without one would have its
+	// blobs collected by the next prune.
+	var hashes []string
+	for _, e := range s.Files {
+		hashes = append(hashes, e.Hash)
+	}
+	slices.Sort(hashes)
+	hashes = slices.Compact(hashes)
+	list := []byte(strings.Join(hashes, "\n") + "\n")
+	if err := st.c.Put(ctx, snapshotsPrefix+s.ID+".blobs", list, r2.PutOptions{ContentType: "text/plain"}); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	enc, err := st.encrypt(b)
+	if err != nil {
+		return err
+	}
+	return st.c.Put(ctx, snapshotsPrefix+s.ID+".age", enc, r2.PutOptions{ContentType: "application/octet-stream"})
+}
+
+func (st *Store) encrypt(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, st.recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Listed is a stored snapshot as listing the bucket shows it.
+type Listed struct {
+	ID   string
+	Time time.Time
+	// Size is the encrypted snapshot's, which grows with its number of
+	// files.
+	Size int64
+}
+
+// List returns the stored snapshots, oldest first.
+func (st *Store) List(ctx context.Context) ([]Listed, error) {
+	objects, err := st.c.List(ctx, snapshotsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var out []Listed
+	for _, o := range objects {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(o.Key, snapshotsPrefix), ".age")
+		if !ok {
+			continue
+		}
+		t, err := ParseID(id)
+		if err != nil {
+			continue
+		}
+		out = append(out, Listed{ID: id, Time: t, Size: o.Size})
+	}
+	slices.SortFunc(out, func(a, b Listed) int { return strings.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+// Get decrypts the snapshot id with identities.
+func (st *Store) Get(ctx context.Context, id string, identities []age.Identity) (*Snapshot, error) {
+	b, err := st.c.Get(ctx, snapshotsPrefix+id+".age")
+	if errors.Is(err, r2.ErrNotFound) {
+		return nil, fmt.Errorf("backup: no snapshot %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b, err = decrypt(b, identities); err != nil {
+		return nil, fmt.Errorf("backup: snapshot %s: %w", id, err)
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("backup: snapshot %s: %w", id, err)
+	}
+	return s, nil
+}
+
+func decrypt(b []byte, identities []age.Identity) ([]byte, error) {
+	r, err := age.Decrypt(bytes.NewReader(b), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// Restore writes the files in s whose paths are, or are under, one of
+// paths, or all of them without paths, into dir, with up to jobs
+// downloads at a time, calling done after each file. Files that are
+// already there with the right contents are skipped.
+func (st *Store) Restore(ctx context.Context, s *Snapshot, identities []age.Identity, dir string, paths []string, jobs int, done func(path string)) (int, error) {
+	var matched, todo []string
+	for _, p := range slices.Sorted(maps.Keys(s.Files)) {
+		if len(paths) > 0 && !slices.ContainsFunc(paths, func(q string) bool {
+			q = strings.Trim(filepath.ToSlash(q), "/")
+			return p == q || strings.HasPrefix(p, q+"/")
+		}) {
+			continue
+		}
+		matched = append(matched, p)
+		if !same(filepath.Join(dir, filepath.FromSlash(p)), s.Files[p].Hash) {
+			todo = append(todo, p)
+		}
+	}
+	if len(paths) > 0 && len(matched) == 0 {
+		return 0, fmt.Errorf("backup: snapshot %s has nothing under %s", s.ID, strings.Join(paths, ", "))
+	}
+	err := parallel(todo, jobs, func(p string) error {
+		e := s.Files[p]
+		b, err := st.c.Get(ctx, blobsPrefix+e.Hash)
+		if err != nil {
+			return fmt.Errorf("backup: %s: %w", p, err)
+		}
+		if b, err = decrypt(b, identities); err != nil {
+			return fmt.Errorf("backup: %s: %w", p, err)
+		}
+		if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != e.Hash {
+			return fmt.Errorf("backup: %s: blob %s is corrupt", p, e.Hash)
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dest, b, e.Mode|0o200); err != nil {
+			return err
+		}
+		done(p)
+		return nil
+	})
+	return len(todo), err
+}
+
+// same reports whether the file at p has the contents hash names.
+func same(p, hash string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	return hex.EncodeToString(h.Sum(nil)) == hash
+}
+
+// Forget deletes the snapshots ids, each one's blob list last, so an
+// interrupted prune leaves no snapshot whose blobs might be collected.
+func (st *Store) Forget(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		for _, ext := range []string{".age", ".blobs"} {
+			if err := st.c.Delete(ctx, snapshotsPrefix+id+ext); err != nil && !errors.Is(err, r2.ErrNotFound) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Unused returns the blobs that no snapshot's blob list names and that are
+// older than the newest snapshot, so that a snapshot being taken meanwhile
+// doesn't lose the blobs it has uploaded but not listed yet. Two pruning
+// runs, or a prune and a snapshot started before it, shouldn't overlap.
+func (st *Store) Unused(ctx context.Context) ([]string, error) {
+	objects, err := st.c.List(ctx, snapshotsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	var newest time.Time
+	for _, o := range objects {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(o.Key, snapshotsPrefix), ".blobs")
+		if !ok {
+			continue
+		}
+		if t, err := ParseID(id); err == nil && t.After(newest) {
+			newest = t
+		}
+		b, err := st.c.Get(ctx, o.Key)
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for sc.Scan() {
+			used[strings.TrimSpace(sc.Text())] = true
+		}
+	}
+	blobs, err := st.c.List(ctx, blobsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var unused []string
+	for _, o := range blobs {
+		hash := strings.TrimPrefix(o.Key, blobsPrefix)
+		if !used[hash] && o.LastModified.Before(newest) {
+			unused = append(unused, hash)
+		}
+	}
+	slices.Sort(unused)
+	return unused, nil
+}
+
+// Collect deletes the blobs hashes.
+func (st *Store) Collect(ctx context.Context, hashes []string, jobs int) error {
+	return parallel(hashes, jobs, func(hash string) error {
+		err := st.c.Delete(ctx, path.Join(blobsPrefix, hash))
+		if errors.Is(err, r2.ErrNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+// parallel calls f on each item with up to jobs calls at a time, and
+// returns the first error once they're done.
+func parallel(items []string, jobs int, f func(string) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, jobs)
+	)
+	for _, it := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := f(it); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
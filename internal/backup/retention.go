@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Policy says which snapshots pruning keeps: the Last most recent ones,
+// and the most recent one of each of the last Daily days, Weekly ISO
+// weeks, Monthly months, and Yearly years that have one, all in UTC. A
+// snapshot kept by one rule counts toward the others too. The newest
+// snapshot is always kept.
+type Policy struct {
+	Last    int `toml:"last"`
+	Daily   int `toml:"daily"`
+	Weekly  int `toml:"weekly"`
+	Monthly int `toml:"monthly"`
+	Yearly  int `toml:"yearly"`
+}
+
+// IsZero reports whether p keeps everything, because it sets no rules.
+func (p Policy) IsZero() bool {
+	return p == Policy{}
+}
+
+// Apply splits the snapshots at times, by ID, into those p keeps and
+// those it doesn't, both newest first.
+func (p Policy) Apply(snaps []Listed) (keep, forget []Listed) {
+	snaps = slices.Clone(snaps)
+	slices.SortFunc(snaps, func(a, b Listed) int { return b.Time.Compare(a.Time) })
+	if p.IsZero() {
+		return snaps, nil
+	}
+	rules := []struct {
+		n      int
+		period func(time.Time) string
+	}{
+		{p.Last, func(t time.Time) string { return t.String() }},
+		{p.Daily, func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{p.Weekly, func(t time.Time) string { y, w := t.ISOWeek(); return fmt.Sprintf("%d-W%02d", y, w) }},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	kept := make([]bool, len(snaps))
+	for _, r := range rules {
+		seen := map[string]bool{}
+		for i, s := range snaps {
+			if len(seen) == r.n {
+				break
+			}
+			k := r.period(s.Time.UTC())
+			if !seen[k] {
+				seen[k] = true
+				kept[i] = true
+			}
+		}
+	}
+	if len(snaps) > 0 {
+		kept[0] = true
+	}
+	for i, s := range snaps {
+		if kept[i] {
+			keep = append(keep, s)
+		} else {
+			forget = append(forget, s)
+		}
+	}
+	return keep, forget
+}
@@ -0,0 +1,234 @@
+// Package bench runs the Go benchmarks that go with a post, the Benchmark
+// functions in the _test.go files under code/<slug>/, and writes their
+// results into the post as a table between marker comments:
+//
+//	<!-- bench -->
+//	<!-- /bench -->
+//
+// Whatever is between the markers is replaced. A marker can name a
+// regular expression, as in <!-- bench Sort -->, to show only the
+// benchmarks it matches, so a post can have a table per comparison. The
+// table gives the median of the runs per metric with the largest
+// deviation from it, and is followed by the environment the numbers come
+// from.
+package bench
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultCount is how many times each benchmark runs by default, enough
+// for benchstat to say something about the spread.
+const DefaultCount = 10
+
+// Find returns the names of the Benchmark functions in the _test.go files
+// under dir, sorted. A missing dir has none.
+func Find(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return fs.SkipAll
+		}
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return fmt.Errorf("bench: %w", err)
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && isBenchmark(fn) {
+				names = append(names, fn.Name.Name)
+			}
+		}
+		return nil
+	})
+	slices.Sort(names)
+	return names, err
+}
+
+// isBenchmark reports whether fn has the shape go test runs as a
+// benchmark: BenchmarkXxx(b *testing.B).
+func isBenchmark(fn *ast.FuncDecl) bool {
+	name, ok := strings.CutPrefix(fn.Name.Name, "Benchmark")
+	if r, _ := utf8.DecodeRuneInString(name); !ok || unicode.IsLower(r) {
+		return false
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "B"
+}
+
+// Options says how to run the benchmarks.
+type Options struct {
+	// Count is how many times each benchmark runs. Defaults to
+	// DefaultCount.
+	Count int
+	// Benchtime is go test's -benchtime, like 1s or 1000x. Defaults to
+	// go test's own.
+	Benchtime string
+	// Go is the go command to run. Defaults to "go".
+	Go string
+}
+
+// Env is the environment the benchmarks ran in.
+type Env struct {
+	Go, GOOS, GOARCH, CPU string
+	Procs                 int
+	Count                 int
+	Time                  time.Time
+}
+
+// Benchmark is a benchmark's runs.
+type Benchmark struct {
+	// Name is without the Benchmark prefix and the -N GOMAXPROCS suffix,
+	// as benchstat shows it: "Sort/n=100".
+	Name string
+	// Metrics maps a unit, like "ns/op", to its value in each run.
+	Metrics map[string][]float64
+	// Units are Metrics' keys in the order go test printed them.
+	Units []string
+}
+
+// Results are a post's benchmarks.
+type Results struct {
+	Env        Env
+	Benchmarks []*Benchmark
+}
+
+// Run runs every benchmark under dir with -benchmem. A dir without a
+// go.mod is copied to a module of its own first.
+func Run(ctx context.Context, dir string, opts Options) (*Results, error) {
+	if opts.Count <= 0 {
+		opts.Count = DefaultCount
+	}
+	if opts.Go == "" {
+		opts.Go = "go"
+	}
+	env := os.Environ()
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); errors.Is(err, fs.ErrNotExist) {
+		tmp, err := os.MkdirTemp("", "bench-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		if err := os.CopyFS(tmp, os.DirFS(dir)); err != nil {
+			return nil, fmt.Errorf("bench: %w", err)
+		}
+		// As for the snippet runner, go mod init stamps the module with
+		// the toolchain's language version, so benchmarks can use what
+		// it has, like b.Loop.
+		initCmd := exec.CommandContext(ctx, opts.Go, "mod", "init", filepath.Base(dir))
+		initCmd.Dir = tmp
+		if out, err := initCmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("bench: go mod init: %w\n%s", err, out)
+		}
+		// Without a go.sum, imports outside the standard library are
+		// resolved as the tests build.
+		dir, env = tmp, append(env, "GOFLAGS=-mod=mod")
+	}
+
+	version, err := exec.CommandContext(ctx, opts.Go, "env", "GOVERSION").Output()
+	if err != nil {
+		return nil, fmt.Errorf("bench: go env: %w", err)
+	}
+	args := []string{"test", "-run", "^$", "-bench", ".", "-benchmem", "-count", strconv.Itoa(opts.Count)}
+	if opts.Benchtime != "" {
+		args = append(args, "-benchtime", opts.Benchtime)
+	}
+	cmd := exec.CommandContext(ctx, opts.Go, append(args, "./...")...)
+	cmd.Dir = dir
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("bench: go test: %w\n%s", err, out)
+	}
+	r, err := Parse(string(out))
+	if err != nil {
+		return nil, err
+	}
+	r.Env.Go = strings.TrimSpace(string(version))
+	r.Env.Count = opts.Count
+	r.Env.Time = time.Now()
+	return r, nil
+}
+
+// Parse reads go test -bench output.
+func Parse(out string) (*Results, error) {
+	r := &Results{}
+	byName := map[string]*Benchmark{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if k, v, ok := strings.Cut(line, ": "); ok {
+			switch k {
+			case "goos":
+				r.Env.GOOS = v
+			case "goarch":
+				r.Env.GOARCH = v
+			case "cpu":
+				r.Env.CPU = v
+			}
+			continue
+		}
+		f := strings.Fields(line)
+		// BenchmarkX-8  1000  123 ns/op  16 B/op: a name, the iterations,
+		// then value and unit pairs.
+		if len(f) < 4 || len(f)%2 != 0 || !strings.HasPrefix(f[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(f[1]); err != nil {
+			continue
+		}
+		name := strings.TrimPrefix(f[0], "Benchmark")
+		if i := strings.LastIndexByte(name, '-'); i >= 0 {
+			if n, err := strconv.Atoi(name[i+1:]); err == nil {
+				name, r.Env.Procs = name[:i], n
+			}
+		}
+		b := byName[name]
+		if b == nil {
+			b = &Benchmark{Name: name, Metrics: map[string][]float64{}}
+			byName[name] = b
+			r.Benchmarks = append(r.Benchmarks, b)
+		}
+		for i := 2; i < len(f); i += 2 {
+			v, err := strconv.ParseFloat(f[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bench: %q: %w", line, err)
+			}
+			unit := f[i+1]
+			if _, ok := b.Metrics[unit]; !ok {
+				b.Units = append(b.Units, unit)
+			}
+			b.Metrics[unit] = append(b.Metrics[unit], v)
+		}
+	}
+	if len(r.Benchmarks) == 0 {
+		return nil, errors.New("bench: go test ran no benchmarks")
+	}
+	return r, nil
+}
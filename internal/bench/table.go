@@ -0,0 +1,196 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	openMarker  = "<!-- bench"
+	closeMarker = "<!-- /bench -->"
+)
+
+// Marker is a pair of bench comments in a post.
+type Marker struct {
+	// Pattern is the marker's regular expression, or "" for every
+	// benchmark.
+	Pattern string
+	// Line is the 1-based line of the opening comment.
+	Line int
+	// start and end are the lines, 0-based, of the two comments.
+	start, end int
+}
+
+// Markers returns the bench comments in src, a post's file.
+func Markers(src []byte) ([]Marker, error) {
+	lines := strings.Split(string(src), "\n")
+	var ms []Marker
+	for i := 0; i < len(lines); i++ {
+		l := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(l, openMarker+" ") || !strings.HasSuffix(l, "-->") || l == closeMarker {
+			continue
+		}
+		m := Marker{
+			Pattern: strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(l, openMarker), "-->")),
+			Line:    i + 1,
+			start:   i,
+			end:     -1,
+		}
+		if _, err := regexp.Compile(m.Pattern); err != nil {
+			return nil, fmt.Errorf("line %d: %w", m.Line, err)
+		}
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == closeMarker {
+				m.end = j
+				break
+			}
+		}
+		if m.end < 0 {
+			return nil, fmt.Errorf("line %d: %s without %s", m.Line, l, closeMarker)
+		}
+		ms = append(ms, m)
+		i = m.end
+	}
+	return ms, nil
+}
+
+// Inject replaces what's between each of the markers in src, found by
+// Markers, with its table of r.
+func Inject(src []byte, markers []Marker, r *Results) ([]byte, error) {
+	lines := strings.Split(string(src), "\n")
+	// Walk the markers bottom-up so earlier line numbers stay valid.
+	for _, m := range slices.Backward(markers) {
+		table, err := Table(r, m.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", m.Line, err)
+		}
+		repl := append([]string{lines[m.start], ""}, strings.Split(table, "\n")...)
+		lines = slices.Replace(lines, m.start, m.end, repl...)
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// Table formats the benchmarks in r that pattern matches as a markdown
+// table, a row per benchmark and a column per unit, followed by the
+// environment they ran in.
+func Table(r *Results, pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	var benchmarks []*Benchmark
+	var units []string
+	for _, b := range r.Benchmarks {
+		if !re.MatchString(b.Name) {
+			continue
+		}
+		benchmarks = append(benchmarks, b)
+		for _, u := range b.Units {
+			if !slices.Contains(units, u) {
+				units = append(units, u)
+			}
+		}
+	}
+	if len(benchmarks) == 0 {
+		return "", fmt.Errorf("no benchmark matches %q", pattern)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("| Benchmark |")
+	for _, u := range units {
+		fmt.Fprintf(&sb, " %s |", u)
+	}
+	sb.WriteString("\n| --- |")
+	for range units {
+		sb.WriteString(" ---: |")
+	}
+	sb.WriteString("\n")
+	for _, b := range benchmarks {
+		fmt.Fprintf(&sb, "| %s |", b.Name)
+		for _, u := range units {
+			vs, ok := b.Metrics[u]
+			if !ok {
+				sb.WriteString(" |")
+				continue
+			}
+			m, spread := summarize(vs)
+			fmt.Fprintf(&sb, " %s ± %.0f%% |", format(m, u), spread)
+		}
+		sb.WriteString("\n")
+	}
+
+	e := r.Env
+	env := []string{e.Go, e.GOOS + "/" + e.GOARCH}
+	if e.CPU != "" {
+		env = append(env, e.CPU)
+	}
+	if e.Procs > 0 {
+		env = append(env, fmt.Sprintf("GOMAXPROCS=%d", e.Procs))
+	}
+	fmt.Fprintf(&sb, "\n*Median of %d runs with %s, measured on %s.*\n",
+		e.Count, strings.Join(env, ", "), e.Time.Format("January 2, 2006"))
+	return sb.String(), nil
+}
+
+// summarize returns the median of vs and the largest deviation from it, as
+// a percentage of it.
+func summarize(vs []float64) (median, spread float64) {
+	s := slices.Sorted(slices.Values(vs))
+	n := len(s)
+	median = s[n/2]
+	if n%2 == 0 {
+		median = (s[n/2-1] + s[n/2]) / 2
+	}
+	if median == 0 {
+		return 0, 0
+	}
+	d := math.Max(median-s[0], s[n-1]-median)
+	return median, 100 * d / median
+}
+
+// format prints v in unit with three significant digits, scaling times and
+// sizes the way benchstat does: 1.23µs, 4.50KiB.
+func format(v float64, unit string) string {
+	switch unit {
+	case "ns/op":
+		for _, s := range []struct {
+			div    float64
+			suffix string
+		}{{1e9, "s"}, {1e6, "ms"}, {1e3, "µs"}} {
+			if v >= s.div {
+				return sig(v/s.div) + s.suffix
+			}
+		}
+		return sig(v) + "ns"
+	case "B/op":
+		for _, s := range []struct {
+			div    float64
+			suffix string
+		}{{1 << 30, "GiB"}, {1 << 20, "MiB"}, {1 << 10, "KiB"}} {
+			if v >= s.div {
+				return sig(v/s.div) + s.suffix
+			}
+		}
+		return sig(v) + "B"
+	default:
+		return sig(v)
+	}
+}
+
+// sig formats v with three significant digits, without an exponent.
+func sig(v float64) string {
+	if v == math.Trunc(v) && v < 1000 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	switch {
+	case v >= 100:
+		return fmt.Sprintf("%.0f", v)
+	case v >= 10:
+		return fmt.Sprintf("%.1f", v)
+	default:
+		return fmt.Sprintf("%.2f", v)
+	}
+}
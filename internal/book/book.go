@@ -0,0 +1,371 @@
+// Package book bundles a set of posts into a book for reading offline, as
+// an EPUB for e-readers and a PDF, each with a generated cover, a table of
+// contents, and the code blocks highlighted the way the site does it.
+//
+// Posts are rendered once into an HTML tree per chapter; the EPUB writer
+// serializes the trees and the PDF writer lays them out directly.
+package book
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	goldhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/highlight"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/ogimage"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+// CoverTemplate is the card the cover is drawn from: the social card's
+// look on a 2:3 page.
+var CoverTemplate = func() ogimage.Template {
+	t := ogimage.DefaultTemplate
+	t.Width, t.Height, t.Padding = 1600, 2400, 160
+	t.TitleSize, t.MetaSize, t.MaxTitleLines = 128, 44, 8
+	return t
+}()
+
+// MaxImageSize caps the bytes read for one image.
+const MaxImageSize = 10 << 20
+
+// Book is a set of posts, in reading order.
+type Book struct {
+	Title    string
+	Author   string
+	Language string
+	// URL is the site the posts come from.
+	URL string
+	// Modified is the last time any of the posts changed.
+	Modified time.Time
+	Chapters []*Chapter
+	// Images are the images the chapters show, by their src.
+	Images map[string]*Image
+	// Cover is the cover as PNG.
+	Cover []byte
+}
+
+// Chapter is a post in a book.
+type Chapter struct {
+	Post *content.Post
+	// ID names the chapter's file in the EPUB and its anchor in the PDF.
+	ID string
+	// URL is where the post lives on the site.
+	URL string
+	// Body is the post's rendered HTML under a <body> element, with links
+	// made absolute.
+	Body *html.Node
+}
+
+// Image is an image shown in a chapter. Data is nil until Fetch gets it,
+// and the writers show a link to the image in its place until then.
+type Image struct {
+	Src  string
+	Name string
+	Type string
+	Data []byte
+}
+
+// Select returns the published posts to bundle: those listed in slugs, in
+// that order, or else those tagged tag, oldest first. A listed slug with no
+// published post is an error.
+func Select(posts []*content.Post, tag string, slugs []string) ([]*content.Post, error) {
+	posts = content.Published(posts)
+	if len(slugs) > 0 {
+		bySlug := map[string]*content.Post{}
+		for _, p := range posts {
+			bySlug[p.Slug] = p
+		}
+		out := make([]*content.Post, 0, len(slugs))
+		for _, s := range slugs {
+			p, ok := bySlug[s]
+			if !ok {
+				return nil, fmt.Errorf("book: no published post %q", s)
+			}
+			out = append(out, p)
+		}
+		return out, nil
+	}
+	var out []*content.Post
+	for _, p := range posts {
+		if slices.ContainsFunc(p.Tags, func(t string) bool { return content.TagSlug(t) == content.TagSlug(tag) }) {
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("book: no published posts tagged %q", tag)
+	}
+	slices.SortStableFunc(out, func(a, b *content.Post) int { return a.Date.Compare(b.Date) })
+	return out, nil
+}
+
+// New renders posts as the chapters of a book called title and draws its
+// cover.
+func New(cfg *site.Config, title string, posts []*content.Post) (*Book, error) {
+	b := &Book{
+		Title:    title,
+		Author:   cfg.Params.Author,
+		Language: cfg.LanguageCode,
+		URL:      cfg.BaseURL,
+		Images:   map[string]*Image{},
+	}
+	chapters := map[string]string{}
+	for i, p := range posts {
+		id := fmt.Sprintf("ch%02d", i+1)
+		chapters[p.RelPermalink()] = id
+		b.Chapters = append(b.Chapters, &Chapter{Post: p, ID: id, URL: cfg.Permalink(p.RelPermalink())})
+		if p.Updated().After(b.Modified) {
+			b.Modified = p.Updated()
+		}
+	}
+	for _, c := range b.Chapters {
+		body, err := render(c.Post)
+		if err != nil {
+			return nil, err
+		}
+		b.rewrite(cfg, c, chapters, body)
+		c.Body = body
+	}
+
+	var tags []string
+	for _, c := range b.Chapters {
+		for _, t := range c.Post.Tags {
+			if !slices.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+	}
+	t := CoverTemplate
+	t.SiteName = cfg.Title
+	var buf bytes.Buffer
+	img, err := ogimage.Draw(t, ogimage.Card{Title: title, Date: b.Modified, Tags: tags})
+	if err != nil {
+		return nil, err
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	b.Cover = buf.Bytes()
+	return b, nil
+}
+
+// render converts p's markdown the way the site does, with the code blocks
+// highlighted by package highlight. Line numbers are left out; they don't
+// survive reflowing on a small screen.
+func render(p *content.Post) (*html.Node, error) {
+	md := markdown.New(goldmark.WithRendererOptions(
+		goldhtml.WithUnsafe(),
+		goldhtml.WithXHTML(),
+		renderer.WithNodeRenderers(util.Prioritized(codeRenderer{}, 100)),
+	))
+	var buf bytes.Buffer
+	ctx := parser.NewContext(parser.WithIDs(markdown.NewIDs()))
+	if err := md.Convert([]byte(p.Body), &buf, parser.WithContext(ctx)); err != nil {
+		return nil, fmt.Errorf("book: %s: %w", p.Path, err)
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(&buf, body)
+	if err != nil {
+		return nil, fmt.Errorf("book: %s: %w", p.Path, err)
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	return body, nil
+}
+
+type codeRenderer struct{}
+
+func (codeRenderer) RegisterFuncs(r renderer.NodeRendererFuncRegisterer) {
+	r.Register(ast.KindFencedCodeBlock, renderCode)
+}
+
+func renderCode(w util.BufWriter, src []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	fc := n.(*ast.FencedCodeBlock)
+	var info string
+	if fc.Info != nil {
+		info = string(fc.Info.Segment.Value(src))
+	}
+	lang, attrs := snippet.ParseInfo(info)
+	var code strings.Builder
+	lines := fc.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		code.Write(seg.Value(src))
+	}
+	o, err := highlight.ParseOptions(attrs)
+	if err != nil {
+		o = highlight.Options{}
+	}
+	o.LineNos = ""
+	out, err := highlight.Render(lang, code.String(), o)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	_, err = w.WriteString(out)
+	return ast.WalkSkipChildren, err
+}
+
+// rewrite makes n fit for reading offline: links to other chapters point
+// at them, other site links are made absolute, images are recorded for
+// Fetch, and scripts and embedded media are replaced by a link to the post.
+func (b *Book) rewrite(cfg *site.Config, c *Chapter, chapters map[string]string, n *html.Node) {
+	if n.Type == html.ElementNode {
+		switch n.DataAtom {
+		case atom.Script, atom.Style:
+			n.Parent.RemoveChild(n)
+			return
+		case atom.Video, atom.Audio, atom.Iframe, atom.Object, atom.Embed:
+			a := &html.Node{Type: html.ElementNode, Data: "a", DataAtom: atom.A,
+				Attr: []html.Attribute{{Key: "href", Val: c.URL}}}
+			a.AppendChild(&html.Node{Type: html.TextNode, Data: "This part is interactive; see it on the site."})
+			n.Parent.InsertBefore(a, n)
+			n.Parent.RemoveChild(n)
+			return
+		case atom.A:
+			if i := attrIndex(n, "href"); i >= 0 {
+				n.Attr[i].Val = link(cfg, chapters, n.Attr[i].Val)
+			}
+		case atom.Img:
+			if i := attrIndex(n, "src"); i >= 0 {
+				src := n.Attr[i].Val
+				if strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//") {
+					src = cfg.Permalink(src)
+					n.Attr[i].Val = src
+				}
+				if _, ok := b.Images[src]; !ok {
+					b.Images[src] = &Image{Src: src}
+				}
+			}
+		}
+	}
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		b.rewrite(cfg, c, chapters, child)
+		child = next
+	}
+}
+
+// link resolves href as found in a post.
+func link(cfg *site.Config, chapters map[string]string, href string) string {
+	if !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+		return href
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return cfg.Permalink(href)
+	}
+	p := "/" + strings.Trim(u.Path, "/") + "/"
+	if id, ok := chapters[p]; ok {
+		if u.Fragment != "" {
+			return id + ".xhtml#" + u.Fragment
+		}
+		return id + ".xhtml"
+	}
+	return cfg.Permalink(href)
+}
+
+func attrIndex(n *html.Node, key string) int {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// attr returns n's attribute key, or "".
+func attr(n *html.Node, key string) string {
+	if i := attrIndex(n, key); i >= 0 {
+		return n.Attr[i].Val
+	}
+	return ""
+}
+
+// imageTypes are the image types both writers can embed.
+var imageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+// Fetch downloads the book's images. Failures are returned, not fatal:
+// the images that couldn't be fetched, or are of a type not listed in
+// imageTypes, are shown as links.
+func (b *Book) Fetch(ctx context.Context, client *http.Client) []error {
+	var errs []error
+	for _, src := range b.imageSrcs() {
+		img := b.Images[src]
+		if err := img.fetch(ctx, client); err != nil {
+			errs = append(errs, fmt.Errorf("book: %s: %w", src, err))
+		}
+	}
+	return errs
+}
+
+func (b *Book) imageSrcs() []string {
+	srcs := make([]string, 0, len(b.Images))
+	for src := range b.Images {
+		srcs = append(srcs, src)
+	}
+	slices.Sort(srcs)
+	return srcs
+}
+
+func (img *Image) fetch(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, img.Src, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxImageSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxImageSize {
+		return fmt.Errorf("larger than %d bytes", MaxImageSize)
+	}
+	typ := http.DetectContentType(data)
+	if t, _, err := mime.ParseMediaType(typ); err == nil {
+		typ = t
+	}
+	ext, ok := imageTypes[typ]
+	if !ok {
+		return fmt.Errorf("%s images can't be embedded", typ)
+	}
+	sum := sha256.Sum256([]byte(img.Src))
+	img.Name = path.Join("images", fmt.Sprintf("%x%s", sum[:8], ext))
+	img.Type, img.Data = typ, data
+	return nil
+}
@@ -0,0 +1,360 @@
+package book
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/rednafi/rednafi.com/internal/highlight"
+)
+
+// WriteEPUB writes b as an EPUB 3 file, with an EPUB 2 table of contents
+// alongside for older readers. The output only depends on b, so an
+// unchanged book writes the same bytes.
+func WriteEPUB(w io.Writer, b *Book) error {
+	css, err := highlight.CSS(highlight.DefaultStyle)
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(w)
+	add := func(name string, method uint16, data []byte) error {
+		f, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: b.Modified})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+	execute := func(name, tmpl string, data any) error {
+		// html/template would escape the XML declaration.
+		buf := bytes.NewBufferString(xmlHeader)
+		if err := epubTemplates.ExecuteTemplate(buf, tmpl, data); err != nil {
+			return fmt.Errorf("book: %s: %w", name, err)
+		}
+		return add(name, zip.Deflate, buf.Bytes())
+	}
+
+	// The mimetype has to come first, uncompressed, so readers can sniff it.
+	if err := add("mimetype", zip.Store, []byte("application/epub+zip")); err != nil {
+		return err
+	}
+	if err := add("META-INF/container.xml", zip.Deflate, []byte(container)); err != nil {
+		return err
+	}
+	if err := add("OEBPS/style.css", zip.Deflate, []byte(bookCSS+css)); err != nil {
+		return err
+	}
+	if err := add("OEBPS/cover.png", zip.Store, b.Cover); err != nil {
+		return err
+	}
+	var images []*Image
+	for _, src := range b.imageSrcs() {
+		if img := b.Images[src]; img.Data != nil {
+			images = append(images, img)
+			if err := add("OEBPS/"+img.Name, zip.Store, img.Data); err != nil {
+				return err
+			}
+		}
+	}
+
+	pkg := epubPackage{Book: b, ID: b.id(), Images: images}
+	for _, c := range b.Chapters {
+		body, err := b.xhtml(c)
+		if err != nil {
+			return err
+		}
+		pkg.Chapters = append(pkg.Chapters, epubChapter{Chapter: c, Body: body, Sections: sections(c)})
+	}
+	for _, f := range [][2]string{
+		{"OEBPS/content.opf", "opf"},
+		{"OEBPS/toc.ncx", "ncx"},
+		{"OEBPS/nav.xhtml", "nav"},
+		{"OEBPS/cover.xhtml", "cover"},
+		{"OEBPS/title.xhtml", "title"},
+	} {
+		if err := execute(f[0], f[1], pkg); err != nil {
+			return err
+		}
+	}
+	for _, c := range pkg.Chapters {
+		page := epubPage{Language: b.Language, Title: c.Post.Title, Chapter: c}
+		if err := execute("OEBPS/"+c.ID+".xhtml", "chapter", page); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// id returns a UUID derived from the book's title and chapters, so
+// regenerating a book doesn't make readers treat it as a new one.
+func (b *Book) id() string {
+	h := sha256.New()
+	io.WriteString(h, b.Title)
+	for _, c := range b.Chapters {
+		io.WriteString(h, "\n"+c.URL)
+	}
+	s := h.Sum(nil)
+	s[6] = s[6]&0x0f | 0x50
+	s[8] = s[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", s[0:4], s[4:6], s[6:8], s[8:10], s[10:16])
+}
+
+// xhtml serializes c's body for the EPUB, pointing images at their copy in
+// the book and replacing those that weren't fetched with a link.
+func (b *Book) xhtml(c *Chapter) (template.HTML, error) {
+	var buf bytes.Buffer
+	for n := c.Body.FirstChild; n != nil; n = n.NextSibling {
+		m := clone(n)
+		b.localImages(m)
+		if err := html.Render(&buf, m); err != nil {
+			return "", fmt.Errorf("book: %s: %w", c.Post.Path, err)
+		}
+	}
+	return template.HTML(buf.String()), nil
+}
+
+func (b *Book) localImages(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.localImages(child)
+	}
+	if n.Type != html.ElementNode || n.DataAtom != atom.Img {
+		return
+	}
+	src := attr(n, "src")
+	if img := b.Images[src]; img != nil && img.Data != nil {
+		n.Attr[attrIndex(n, "src")].Val = img.Name
+		if attrIndex(n, "alt") < 0 {
+			n.Attr = append(n.Attr, html.Attribute{Key: "alt", Val: ""})
+		}
+		return
+	}
+	alt := attr(n, "alt")
+	if alt == "" {
+		alt = "Image"
+	}
+	n.Data, n.DataAtom = "a", atom.A
+	n.Attr = []html.Attribute{{Key: "href", Val: src}}
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: "[" + alt + "]"})
+}
+
+// clone returns a deep copy of n, detached from its tree.
+func clone(n *html.Node) *html.Node {
+	m := &html.Node{Type: n.Type, Data: n.Data, DataAtom: n.DataAtom, Namespace: n.Namespace,
+		Attr: append([]html.Attribute(nil), n.Attr...)}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		m.AppendChild(clone(c))
+	}
+	return m
+}
+
+// Section is a second-level heading of a chapter, listed under it in the
+// table of contents.
+type Section struct {
+	ID   string
+	Text string
+}
+
+// sections returns the h2 headings of c.
+func sections(c *Chapter) []Section {
+	var out []Section
+	for n := c.Body.FirstChild; n != nil; n = n.NextSibling {
+		if n.DataAtom == atom.H2 && attr(n, "id") != "" {
+			out = append(out, Section{ID: attr(n, "id"), Text: strings.TrimSpace(textContent(n))})
+		}
+	}
+	return out
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+type epubPackage struct {
+	*Book
+	ID       string
+	Images   []*Image
+	Chapters []epubChapter
+}
+
+type epubChapter struct {
+	*Chapter
+	Body     template.HTML
+	Sections []Section
+}
+
+// epubPage is what the chapter template is executed with.
+type epubPage struct {
+	Language string
+	Title    string
+	Chapter  epubChapter
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="utf-8"?>
+`
+
+const container = xmlHeader + `<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const bookCSS = `body { font-family: serif; line-height: 1.5 }
+h1 { font-size: 1.6em; line-height: 1.25; margin-bottom: .25em }
+h2, h3, h4 { line-height: 1.25 }
+.meta { color: #6c6c6c; font-size: .85em; margin-top: 0 }
+.meta a { color: inherit }
+code, pre { font-family: monospace }
+pre { font-size: .8em; line-height: 1.4; white-space: pre-wrap; overflow-wrap: anywhere; padding: .6em; background-color: #f6f8fa }
+blockquote { margin-left: 0; padding-left: 1em; border-left: 3px solid #ddd; color: #555 }
+img { max-width: 100% }
+table { border-collapse: collapse }
+th, td { border: 1px solid #ddd; padding: .2em .5em }
+.cover { margin: 0; padding: 0; text-align: center }
+.cover img { max-width: 100%; max-height: 100% }
+.title { text-align: center; margin-top: 30% }
+.toc ol { list-style: none; padding-left: 0 }
+.toc ol ol { padding-left: 1.5em; font-size: .9em }
+`
+
+var epubTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"date": func(b *Book) string { return b.Modified.UTC().Format("2006-01-02T15:04:05Z") },
+}).Parse(`
+{{- define "head" -}}
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{ .Language }}" lang="{{ .Language }}">
+<head>
+  <meta charset="utf-8"/>
+  <title>{{ .Title }}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+{{- end -}}
+
+{{- define "opf" -}}
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id" xml:lang="{{ .Language }}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">urn:uuid:{{ .ID }}</dc:identifier>
+    <dc:title>{{ .Title }}</dc:title>
+    <dc:creator>{{ .Author }}</dc:creator>
+    <dc:language>{{ .Language }}</dc:language>
+    <dc:source>{{ .URL }}</dc:source>
+    <meta property="dcterms:modified">{{ date .Book }}</meta>
+    <meta name="cover" content="cover-image"/>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+    <item id="cover-image" href="cover.png" media-type="image/png" properties="cover-image"/>
+    <item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
+    <item id="title" href="title.xhtml" media-type="application/xhtml+xml"/>
+    {{- range $i, $img := .Images }}
+    <item id="img{{ $i }}" href="{{ $img.Name }}" media-type="{{ $img.Type }}"/>
+    {{- end }}
+    {{- range .Chapters }}
+    <item id="{{ .ID }}" href="{{ .ID }}.xhtml" media-type="application/xhtml+xml"/>
+    {{- end }}
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="cover" linear="no"/>
+    <itemref idref="title"/>
+    <itemref idref="nav"/>
+    {{- range .Chapters }}
+    <itemref idref="{{ .ID }}"/>
+    {{- end }}
+  </spine>
+  <guide>
+    <reference type="cover" title="Cover" href="cover.xhtml"/>
+    <reference type="toc" title="Contents" href="nav.xhtml"/>
+  </guide>
+</package>
+{{ end -}}
+
+{{- define "ncx" -}}
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1" xml:lang="{{ .Language }}">
+  <head>
+    <meta name="dtb:uid" content="urn:uuid:{{ .ID }}"/>
+  </head>
+  <docTitle><text>{{ .Title }}</text></docTitle>
+  <navMap>
+    {{- range $i, $c := .Chapters }}
+    <navPoint id="{{ $c.ID }}" playOrder="{{ $i }}">
+      <navLabel><text>{{ $c.Post.Title }}</text></navLabel>
+      <content src="{{ $c.ID }}.xhtml"/>
+    </navPoint>
+    {{- end }}
+  </navMap>
+</ncx>
+{{ end -}}
+
+{{- define "cover" -}}
+{{ template "head" . }}
+<body class="cover">
+  <img src="cover.png" alt="{{ .Title }}"/>
+</body>
+</html>
+{{ end -}}
+
+{{- define "title" -}}
+{{ template "head" . }}
+<body>
+  <section class="title" epub:type="titlepage">
+    <h1>{{ .Title }}</h1>
+    <p>{{ .Author }}</p>
+    <p class="meta"><a href="{{ .URL }}">{{ .URL }}</a></p>
+  </section>
+</body>
+</html>
+{{ end -}}
+
+{{- define "nav" -}}
+{{ template "head" . }}
+<body>
+  <nav class="toc" epub:type="toc" id="toc">
+    <h1>Contents</h1>
+    <ol>
+      {{- range $c := .Chapters }}
+      <li><a href="{{ $c.ID }}.xhtml">{{ $c.Post.Title }}</a>
+        {{- with $c.Sections }}
+        <ol>
+          {{- range . }}
+          <li><a href="{{ $c.ID }}.xhtml#{{ .ID }}">{{ .Text }}</a></li>
+          {{- end }}
+        </ol>
+        {{- end }}
+      </li>
+      {{- end }}
+    </ol>
+  </nav>
+</body>
+</html>
+{{ end -}}
+
+{{- define "chapter" -}}
+{{ template "head" . }}
+<body>
+  {{- with .Chapter }}
+  <section epub:type="chapter" id="{{ .ID }}">
+    <h1>{{ .Post.Title }}</h1>
+    <p class="meta">{{ .Post.Date.Format "January 2, 2006" }}{{ range .Post.Tags }} · {{ . }}{{ end }} · <a href="{{ .URL }}">Read online</a></p>
+    {{ .Body }}
+  {{- end }}
+  </section>
+</body>
+</html>
+{{ end -}}
+`))
@@ -0,0 +1,800 @@
+package book
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/rednafi/rednafi.com/internal/highlight"
+)
+
+// Papers are the page sizes WritePDF accepts.
+var Papers = []string{"A4", "A5", "Letter"}
+
+// Sizes in points, and colors, of the PDF's text.
+const (
+	textSize  = 10.0
+	codeSize  = 8.0
+	titleSize = 18.0
+	metaSize  = 8.0
+	// leading is the line height as a multiple of the font size.
+	leading = 1.45
+)
+
+var (
+	textColor   = rgb{30, 30, 30}
+	mutedColor  = rgb{108, 108, 108}
+	linkColor   = rgb{211, 84, 0}
+	codeBG      = rgb{246, 248, 250}
+	ruleColor   = rgb{221, 221, 221}
+	lineFills   = map[string]rgb{"hl": {255, 248, 197}, "diff-add": {218, 251, 225}, "diff-del": {255, 235, 233}}
+	imageFormat = map[string]string{"image/png": "PNG", "image/jpeg": "JPG", "image/gif": "GIF"}
+)
+
+type rgb struct{ r, g, b int }
+
+// WritePDF lays b out as a PDF on paper, one of Papers: the cover, a table
+// of contents with page numbers, and a chapter per post, with an outline
+// for the reader's sidebar. The layout is done twice, the first time only
+// to learn the page each chapter starts on.
+func WritePDF(w io.Writer, b *Book, paper string) error {
+	first := newPDFWriter(b, paper, nil)
+	if err := first.layout(); err != nil {
+		return err
+	}
+	second := newPDFWriter(b, paper, first.starts)
+	if err := second.layout(); err != nil {
+		return err
+	}
+	return second.pdf.Output(w)
+}
+
+type pdfWriter struct {
+	pdf *fpdf.Fpdf
+	b   *Book
+	// pages is the page each chapter starts on, from the first pass;
+	// starts records the same for this one.
+	pages, starts map[string]int
+	links         map[string]int
+	code          map[string]chroma.StyleEntry
+
+	// The state of the text being written.
+	family    string
+	style     string
+	size      float64
+	color     rgb
+	href      string
+	lineStart bool
+}
+
+func newPDFWriter(b *Book, paper string, pages map[string]int) *pdfWriter {
+	pdf := fpdf.New("P", "mm", paper, "")
+	for _, f := range []struct {
+		family, style string
+		ttf           []byte
+	}{
+		{"go", "", goregular.TTF},
+		{"go", "B", gobold.TTF},
+		{"go", "I", goitalic.TTF},
+		{"go", "BI", gobolditalic.TTF},
+		{"mono", "", gomono.TTF},
+		{"mono", "B", gomonobold.TTF},
+		{"mono", "I", gomonoitalic.TTF},
+		{"mono", "BI", gomonobolditalic.TTF},
+	} {
+		pdf.AddUTF8FontFromBytes(f.family, f.style, f.ttf)
+	}
+	pdf.SetMargins(16, 16, 16)
+	pdf.SetAutoPageBreak(true, 18)
+	pdf.SetTitle(b.Title, true)
+	pdf.SetAuthor(b.Author, true)
+	pdf.SetCreator(b.URL, true)
+	pdf.SetCreationDate(b.Modified)
+	pdf.SetModificationDate(b.Modified)
+	pdf.SetCatalogSort(true)
+	pdf.SetFooterFunc(func() {
+		if pdf.PageNo() == 1 {
+			return
+		}
+		pdf.SetY(-12)
+		pdf.SetFont("go", "", metaSize)
+		pdf.SetTextColor(mutedColor.r, mutedColor.g, mutedColor.b)
+		pdf.CellFormat(0, 4, strconv.Itoa(pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	code := map[string]chroma.StyleEntry{}
+	style := styles.Get(highlight.DefaultStyle)
+	for tt, class := range chroma.StandardTypes {
+		code[class] = style.Get(tt)
+	}
+	return &pdfWriter{
+		pdf: pdf, b: b, pages: pages,
+		starts: map[string]int{}, links: map[string]int{}, code: code,
+	}
+}
+
+func (w *pdfWriter) layout() error {
+	for _, c := range w.b.Chapters {
+		w.links[c.ID] = w.pdf.AddLink()
+	}
+	w.cover()
+	w.contents()
+	for _, c := range w.b.Chapters {
+		w.chapter(c)
+	}
+	if err := w.pdf.Error(); err != nil {
+		return fmt.Errorf("book: pdf: %w", err)
+	}
+	return nil
+}
+
+func (w *pdfWriter) cover() {
+	w.pdf.AddPage()
+	pw, ph := w.pdf.GetPageSize()
+	info := w.pdf.RegisterImageOptionsReader("cover", fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(w.b.Cover))
+	if info == nil {
+		return
+	}
+	iw, ih := info.Extent()
+	scale := min(pw/iw, ph/ih)
+	w.pdf.ImageOptions("cover", (pw-iw*scale)/2, (ph-ih*scale)/2, iw*scale, ih*scale, false, fpdf.ImageOptions{}, 0, "")
+}
+
+func (w *pdfWriter) contents() {
+	w.pdf.AddPage()
+	w.pdf.Bookmark("Contents", 0, -1)
+	w.setFont("go", "B", titleSize, textColor)
+	w.pdf.CellFormat(0, w.lineHeight(), "Contents", "", 1, "L", false, 0, "")
+	w.pdf.Ln(w.lineHeight() / 2)
+
+	w.setFont("go", "", textSize, textColor)
+	lh := w.lineHeight()
+	avail := w.width()
+	for _, c := range w.b.Chapters {
+		page := ""
+		if n := w.pages[c.ID]; n > 0 {
+			page = strconv.Itoa(n)
+		}
+		lines := w.pdf.SplitText(bmp(c.Post.Title), avail-12)
+		for i, l := range lines {
+			ln := 2
+			if i == len(lines)-1 {
+				ln = 0
+			}
+			w.pdf.CellFormat(avail-12, lh, l, "", ln, "L", false, w.links[c.ID], "")
+		}
+		w.pdf.CellFormat(12, lh, page, "", 1, "R", false, w.links[c.ID], "")
+		w.pdf.Ln(lh / 4)
+	}
+}
+
+func (w *pdfWriter) chapter(c *Chapter) {
+	w.pdf.AddPage()
+	w.starts[c.ID] = w.pdf.PageNo()
+	w.pdf.SetLink(w.links[c.ID], 0, -1)
+	w.pdf.Bookmark(bmp(c.Post.Title), 0, -1)
+
+	w.setFont("go", "B", titleSize, textColor)
+	w.pdf.MultiCell(0, w.lineHeight(), bmp(c.Post.Title), "", "L", false)
+	w.setFont("go", "", metaSize, mutedColor)
+	meta := c.Post.Date.Format("January 2, 2006")
+	for _, t := range c.Post.Tags {
+		meta += " · " + t
+	}
+	w.pdf.Write(w.lineHeight(), meta+" · ")
+	w.pdf.WriteLinkString(w.lineHeight(), "Read online", c.URL)
+	w.pdf.Ln(w.lineHeight() * 2)
+
+	w.setFont("go", "", textSize, textColor)
+	w.blocks(c.Body)
+}
+
+func (w *pdfWriter) setFont(family, style string, size float64, color rgb) {
+	w.family, w.style, w.size, w.color = family, style, size, color
+	w.apply()
+}
+
+func (w *pdfWriter) apply() {
+	w.pdf.SetFont(w.family, w.style, w.size)
+	w.pdf.SetTextColor(w.color.r, w.color.g, w.color.b)
+}
+
+// lineHeight is the height of a line of the current font, in mm.
+func (w *pdfWriter) lineHeight() float64 { return w.pdf.PointConvert(w.size * leading) }
+
+// width is the width of the text column at the current indent.
+func (w *pdfWriter) width() float64 {
+	pw, _ := w.pdf.GetPageSize()
+	l, _, r, _ := w.pdf.GetMargins()
+	return pw - l - r
+}
+
+// ensure starts a new page unless h more mm fit on this one.
+func (w *pdfWriter) ensure(h float64) {
+	_, ph := w.pdf.GetPageSize()
+	_, bottom := w.pdf.GetAutoPageBreak()
+	if w.pdf.GetY()+h > ph-bottom {
+		w.pdf.AddPage()
+		w.apply()
+	}
+}
+
+// newline ends the current line, if anything was written on it.
+func (w *pdfWriter) newline() {
+	if !w.lineStart {
+		w.pdf.Ln(w.lineHeight())
+		w.lineStart = true
+	}
+}
+
+// gap leaves space between blocks.
+func (w *pdfWriter) gap() { w.pdf.Ln(w.lineHeight() / 2) }
+
+// inlineAtoms are the elements laid out within a line of text.
+var inlineAtoms = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.B: true, atom.Br: true, atom.Cite: true,
+	atom.Code: true, atom.Del: true, atom.Em: true, atom.I: true, atom.Input: true,
+	atom.Kbd: true, atom.Mark: true, atom.Q: true, atom.S: true, atom.Samp: true,
+	atom.Small: true, atom.Span: true, atom.Strong: true, atom.Sub: true,
+	atom.Sup: true, atom.U: true, atom.Var: true,
+}
+
+func isInline(n *html.Node) bool {
+	return n.Type == html.TextNode || n.Type == html.ElementNode && inlineAtoms[n.DataAtom]
+}
+
+// blocks lays out n's children, running consecutive inline ones together
+// as a paragraph.
+func (w *pdfWriter) blocks(n *html.Node) {
+	w.lineStart = true
+	var run []*html.Node
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		for _, c := range run {
+			w.inline(c)
+		}
+		if !w.lineStart {
+			w.newline()
+			w.gap()
+		}
+		run = nil
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isInline(c) {
+			run = append(run, c)
+			continue
+		}
+		flush()
+		w.block(c)
+	}
+	flush()
+}
+
+func (w *pdfWriter) block(n *html.Node) {
+	if n.Type != html.ElementNode {
+		return
+	}
+	switch n.DataAtom {
+	case atom.P:
+		w.blocks(n)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.heading(n)
+	case atom.Pre:
+		w.codeBlock(n, "")
+	case atom.Div:
+		if hasClass(n, "highlight") {
+			w.highlighted(n)
+			return
+		}
+		w.blocks(n)
+	case atom.Ul, atom.Ol:
+		w.list(n)
+	case atom.Blockquote:
+		w.indented(6, func() {
+			saved := w.color
+			w.color = mutedColor
+			w.apply()
+			w.blocks(n)
+			w.color = saved
+			w.apply()
+		})
+	case atom.Dd:
+		w.indented(6, func() { w.blocks(n) })
+	case atom.Dt:
+		saved := w.style
+		w.style = "B"
+		w.apply()
+		w.blocks(n)
+		w.style = saved
+		w.apply()
+	case atom.Table:
+		w.table(n)
+	case atom.Hr:
+		w.ensure(w.lineHeight())
+		l, _, _, _ := w.pdf.GetMargins()
+		y := w.pdf.GetY() + w.lineHeight()/2
+		w.pdf.SetDrawColor(ruleColor.r, ruleColor.g, ruleColor.b)
+		w.pdf.Line(l, y, l+w.width(), y)
+		w.pdf.Ln(w.lineHeight())
+	case atom.Img:
+		w.image(n)
+	default:
+		w.blocks(n)
+	}
+}
+
+func (w *pdfWriter) heading(n *html.Node) {
+	size := map[atom.Atom]float64{atom.H1: 16, atom.H2: 14, atom.H3: 12}[n.DataAtom]
+	if size == 0 {
+		size = 11
+	}
+	saved := w.size
+	w.setFont("go", "B", size, textColor)
+	w.ensure(w.lineHeight() * 3)
+	w.pdf.Ln(w.lineHeight() / 3)
+	switch n.DataAtom {
+	case atom.H2:
+		w.pdf.Bookmark(bmp(strings.TrimSpace(textContent(n))), 1, -1)
+	case atom.H3:
+		w.pdf.Bookmark(bmp(strings.TrimSpace(textContent(n))), 2, -1)
+	}
+	w.blocks(n)
+	w.setFont("go", "", saved, textColor)
+}
+
+// indented runs f with the left margin moved right by mm.
+func (w *pdfWriter) indented(mm float64, f func()) {
+	l, _, _, _ := w.pdf.GetMargins()
+	w.pdf.SetLeftMargin(l + mm)
+	w.pdf.SetX(l + mm)
+	f()
+	w.pdf.SetLeftMargin(l)
+	w.pdf.SetX(l)
+}
+
+func (w *pdfWriter) list(n *html.Node) {
+	i := 1
+	if s, err := strconv.Atoi(attr(n, "start")); err == nil {
+		i = s
+	}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.DataAtom != atom.Li {
+			continue
+		}
+		marker := "•"
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(i) + "."
+			i++
+		}
+		w.ensure(w.lineHeight())
+		l, _, _, _ := w.pdf.GetMargins()
+		w.pdf.SetX(l)
+		w.pdf.CellFormat(6, w.lineHeight(), marker, "", 0, "L", false, 0, "")
+		w.indented(6, func() {
+			w.pdf.SetX(l + 6)
+			w.blocks(li)
+		})
+	}
+	w.gap()
+}
+
+func (w *pdfWriter) inline(n *html.Node) {
+	if n.Type == html.TextNode {
+		w.text(n.Data)
+		return
+	}
+	if n.Type != html.ElementNode {
+		return
+	}
+	family, style, size, color, href := w.family, w.style, w.size, w.color, w.href
+	switch n.DataAtom {
+	case atom.Br:
+		w.pdf.Ln(w.lineHeight())
+		w.lineStart = true
+		return
+	case atom.Img:
+		w.newline()
+		w.image(n)
+		return
+	case atom.Input:
+		if attr(n, "type") == "checkbox" {
+			if attrIndex(n, "checked") >= 0 {
+				w.text("[x]")
+			} else {
+				w.text("[ ]")
+			}
+		}
+		return
+	case atom.Em, atom.I, atom.Cite, atom.Var:
+		w.addStyle("I")
+	case atom.Strong, atom.B:
+		w.addStyle("B")
+	case atom.Del, atom.S:
+		w.addStyle("S")
+	case atom.U:
+		w.addStyle("U")
+	case atom.Code, atom.Kbd, atom.Samp:
+		w.family = "mono"
+		w.size = size * 0.9
+	case atom.Small:
+		w.size = size * 0.85
+	case atom.Sup:
+		if a := n.FirstChild; a != nil && a.DataAtom == atom.A && a.NextSibling == nil {
+			// A footnote reference: the number alone, raised.
+			w.pdf.SubWrite(w.lineHeight(), bmp(textContent(n)), w.size*0.7, w.size*0.4, 0, "")
+			w.lineStart = false
+			return
+		}
+	case atom.A:
+		if hasClass(n, "footnote-backref") {
+			return
+		}
+		if href := attr(n, "href"); !strings.HasPrefix(href, "#") {
+			w.href = href
+			w.color = linkColor
+		}
+	}
+	w.apply()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.inline(c)
+	}
+	w.family, w.style, w.size, w.color, w.href = family, style, size, color, href
+	w.apply()
+}
+
+func (w *pdfWriter) addStyle(s string) {
+	if !strings.Contains(w.style, s) {
+		w.style += s
+	}
+}
+
+// text writes s at the current position, collapsing its whitespace as a
+// browser would.
+func (w *pdfWriter) text(s string) {
+	s = bmp(s)
+	lead := strings.TrimLeft(s, " \t\n\r") != s
+	trail := strings.TrimRight(s, " \t\n\r") != s
+	s = strings.Join(strings.Fields(s), " ")
+	if lead && !w.lineStart {
+		s = " " + s
+	}
+	if trail && strings.TrimSpace(s) != "" {
+		s += " "
+	}
+	if s == "" {
+		return
+	}
+	// Inline code is smaller than the text around it but shares its lines.
+	lh := w.pdf.PointConvert(max(w.size, textSize) * leading)
+	id, internal := w.chapterLink(w.href)
+	switch {
+	case internal:
+		w.pdf.WriteLinkID(lh, s, id)
+	case w.href != "":
+		w.pdf.WriteLinkString(lh, s, w.href)
+	default:
+		w.pdf.Write(lh, s)
+	}
+	w.lineStart = false
+}
+
+// chapterLink returns the link to the chapter href points at, if it's one
+// rewritten by Book.rewrite.
+func (w *pdfWriter) chapterLink(href string) (int, bool) {
+	file, _, _ := strings.Cut(href, "#")
+	id, ok := strings.CutSuffix(file, ".xhtml")
+	if !ok {
+		return 0, false
+	}
+	link, ok := w.links[id]
+	return link, ok
+}
+
+// image places an image on its own lines, scaled to the column, or a link
+// to it if it wasn't fetched.
+func (w *pdfWriter) image(n *html.Node) {
+	src := attr(n, "src")
+	img := w.b.Images[src]
+	if img == nil || img.Data == nil || imageFormat[img.Type] == "" {
+		alt := attr(n, "alt")
+		if alt == "" {
+			alt = "Image"
+		}
+		saved := w.color
+		w.color = linkColor
+		w.apply()
+		w.pdf.WriteLinkString(w.lineHeight(), "["+bmp(alt)+"]", src)
+		w.color = saved
+		w.apply()
+		w.lineStart = false
+		w.newline()
+		return
+	}
+	info := w.pdf.RegisterImageOptionsReader(img.Name, fpdf.ImageOptions{ImageType: imageFormat[img.Type]}, bytes.NewReader(img.Data))
+	if info == nil {
+		return
+	}
+	_, ph := w.pdf.GetPageSize()
+	iw, ih := info.Extent()
+	scale := min(1, w.width()/iw, ph*0.6/ih)
+	iw, ih = iw*scale, ih*scale
+	w.ensure(ih)
+	l, _, _, _ := w.pdf.GetMargins()
+	y := w.pdf.GetY()
+	w.pdf.ImageOptions(img.Name, l, y, iw, ih, false, fpdf.ImageOptions{}, 0, src)
+	w.pdf.SetY(y + ih)
+	w.gap()
+	w.lineStart = true
+}
+
+// highlighted lays out a block rendered by package highlight: the code,
+// with the language badge above it.
+func (w *pdfWriter) highlighted(n *html.Node) {
+	var lang string
+	var pre *html.Node
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		for c := n.FirstChild; c != nil && pre == nil; c = c.NextSibling {
+			switch {
+			case c.DataAtom == atom.Span && hasClass(c, "lang-badge"):
+				lang = textContent(c)
+			case c.DataAtom == atom.Pre:
+				pre = c
+			default:
+				find(c)
+			}
+		}
+	}
+	find(n)
+	if pre != nil {
+		w.codeBlock(pre, lang)
+	}
+}
+
+// token is a run of code in one style.
+type token struct {
+	text  string
+	class string
+}
+
+// codeLine is a line of code and the class of its line span, such as
+// "hl" or "diff-add".
+type codeLine struct {
+	tokens []token
+	class  string
+}
+
+// codeLines splits the Chroma markup in pre into lines of tokens.
+func codeLines(pre *html.Node) []codeLine {
+	lines := []codeLine{{}}
+	var walk func(n *html.Node, class, line string)
+	walk = func(n *html.Node, class, line string) {
+		if n.Type == html.TextNode {
+			for i, part := range strings.Split(n.Data, "\n") {
+				if i > 0 {
+					lines = append(lines, codeLine{})
+				}
+				if part == "" {
+					continue
+				}
+				cur := &lines[len(lines)-1]
+				if cur.class == "" {
+					cur.class = line
+				}
+				cur.tokens = append(cur.tokens, token{bmp(strings.ReplaceAll(part, "\t", "    ")), class})
+			}
+			return
+		}
+		if n.DataAtom == atom.Span {
+			cls := attr(n, "class")
+			if rest, ok := strings.CutPrefix(cls, "line"); ok && (rest == "" || rest[0] == ' ') {
+				line = strings.TrimSpace(rest)
+			} else if cls != "cl" && cls != "" {
+				class = cls
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, class, line)
+		}
+	}
+	walk(pre, "", "")
+	if last := lines[len(lines)-1]; len(last.tokens) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// codeBlock lays out pre on a shaded background, a line at a time, in the
+// colors of the site's Chroma style. Lines too long for the column wrap.
+func (w *pdfWriter) codeBlock(pre *html.Node, lang string) {
+	w.newline()
+	savedFamily, savedStyle, savedSize, savedColor := w.family, w.style, w.size, w.color
+	w.setFont("mono", "", codeSize, textColor)
+	lh := w.lineHeight()
+	l, _, _, _ := w.pdf.GetMargins()
+	width := w.width()
+	cols := max(1, int((width-4)/w.pdf.GetStringWidth("m")))
+	pad := lh / 2
+
+	fill := func(y, h float64, c rgb) {
+		w.pdf.SetFillColor(c.r, c.g, c.b)
+		w.pdf.Rect(l, y, width, h, "F")
+	}
+	w.ensure(pad + lh)
+	fill(w.pdf.GetY(), pad, codeBG)
+	if lang != "" {
+		w.setFont("mono", "", metaSize*0.9, mutedColor)
+		w.pdf.SetXY(l, w.pdf.GetY())
+		w.pdf.CellFormat(width-2, pad, strings.TrimSpace(lang), "", 0, "R", false, 0, "")
+		w.setFont("mono", "", codeSize, textColor)
+	}
+	w.pdf.SetY(w.pdf.GetY() + pad)
+
+	emit := func(line codeLine, tokens []token) {
+		w.ensure(lh)
+		y := w.pdf.GetY()
+		bg := codeBG
+		for _, cls := range strings.Fields(line.class) {
+			if c, ok := lineFills[cls]; ok {
+				bg = c
+			}
+		}
+		fill(y, lh, bg)
+		w.pdf.SetXY(l+2, y)
+		for _, t := range tokens {
+			e := w.code[t.class]
+			style := ""
+			if e.Bold == chroma.Yes {
+				style += "B"
+			}
+			if e.Italic == chroma.Yes {
+				style += "I"
+			}
+			c := textColor
+			if e.Colour.IsSet() {
+				c = rgb{int(e.Colour.Red()), int(e.Colour.Green()), int(e.Colour.Blue())}
+			}
+			w.pdf.SetFont("mono", style, codeSize)
+			w.pdf.SetTextColor(c.r, c.g, c.b)
+			w.pdf.CellFormat(w.pdf.GetStringWidth(t.text), lh, t.text, "", 0, "L", false, 0, "")
+		}
+		w.pdf.SetXY(l, y+lh)
+	}
+	for _, line := range codeLines(pre) {
+		var (
+			tokens []token
+			n      int
+		)
+		for _, t := range line.tokens {
+			rs := []rune(t.text)
+			for len(rs) > 0 {
+				take := min(len(rs), cols-n)
+				tokens = append(tokens, token{string(rs[:take]), t.class})
+				rs, n = rs[take:], n+take
+				if n == cols {
+					emit(line, tokens)
+					tokens, n = nil, 0
+				}
+			}
+		}
+		if len(tokens) > 0 || n == 0 && len(line.tokens) == 0 {
+			emit(line, tokens)
+		}
+	}
+	w.ensure(pad)
+	fill(w.pdf.GetY(), pad, codeBG)
+	w.pdf.SetY(w.pdf.GetY() + pad)
+	w.setFont(savedFamily, savedStyle, savedSize, savedColor)
+	w.gap()
+	w.lineStart = true
+}
+
+// table lays out a table as a grid of equal columns, header rows in bold.
+func (w *pdfWriter) table(n *html.Node) {
+	var rows [][]*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Tr {
+				var cells []*html.Node
+				for td := c.FirstChild; td != nil; td = td.NextSibling {
+					if td.DataAtom == atom.Td || td.DataAtom == atom.Th {
+						cells = append(cells, td)
+					}
+				}
+				rows = append(rows, cells)
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	if cols == 0 {
+		return
+	}
+	w.newline()
+	savedSize := w.size
+	w.setFont("go", "", metaSize+1, textColor)
+	lh := w.lineHeight()
+	l, _, _, _ := w.pdf.GetMargins()
+	cw := w.width() / float64(cols)
+	w.pdf.SetDrawColor(ruleColor.r, ruleColor.g, ruleColor.b)
+	for _, r := range rows {
+		texts := make([][]string, len(r))
+		height := 1
+		for i, cell := range r {
+			style := ""
+			if cell.DataAtom == atom.Th {
+				style = "B"
+			}
+			w.pdf.SetFont("go", style, w.size)
+			texts[i] = w.pdf.SplitText(bmp(strings.Join(strings.Fields(textContent(cell)), " ")), cw-2)
+			height = max(height, len(texts[i]))
+		}
+		h := float64(height)*lh + 1
+		w.ensure(h)
+		y := w.pdf.GetY()
+		for i := range cols {
+			x := l + float64(i)*cw
+			w.pdf.Rect(x, y, cw, h, "D")
+			if i >= len(r) {
+				continue
+			}
+			style := ""
+			if r[i].DataAtom == atom.Th {
+				style = "B"
+			}
+			w.pdf.SetFont("go", style, w.size)
+			for j, line := range texts[i] {
+				w.pdf.SetXY(x+1, y+0.5+float64(j)*lh)
+				w.pdf.CellFormat(cw-2, lh, line, "", 0, "L", false, 0, "")
+			}
+		}
+		w.pdf.SetXY(l, y+h)
+	}
+	w.setFont("go", "", savedSize, textColor)
+	w.gap()
+	w.lineStart = true
+}
+
+// bmp drops the runes outside the Basic Multilingual Plane, emoji mostly,
+// which fpdf can't map and the Go fonts have no glyphs for anyway.
+func bmp(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0xffff {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+// Package bookmarks keeps the articles I've saved in Readwise Reader and
+// Pocket, with my highlights, as data/bookmarks/<year>.json, and lays
+// them out as the paginated Reading section. Imports from either service
+// are merged into what's already kept, one bookmark per URL, so exports can
+// be re-imported and overlap freely.
+package bookmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultDir is where the bookmarks are kept, a file per year saved.
+const DefaultDir = "data/bookmarks"
+
+// Bookmark is a saved article.
+type Bookmark struct {
+	URL    string `json:"url"`
+	Title  string `json:"title"`
+	Author string `json:"author,omitempty"`
+	// Site is the publication or domain it's from.
+	Site       string      `json:"site,omitempty"`
+	Tags       []string    `json:"tags,omitempty"`
+	Saved      time.Time   `json:"saved"`
+	Note       string      `json:"note,omitempty"`
+	Highlights []Highlight `json:"highlights,omitempty"`
+	// Sources are the services it was imported from.
+	Sources []string `json:"sources"`
+}
+
+// Highlight is a passage I highlighted, with the note I left on it.
+type Highlight struct {
+	Text string `json:"text"`
+	Note string `json:"note,omitempty"`
+}
+
+// tracking are the query parameters that only say where a link was shared,
+// so the same article saved from two places isn't kept twice.
+var tracking = []string{"fbclid", "gclid", "igshid", "mc_cid", "mc_eid", "ref", "ref_src", "source"}
+
+// Key returns the URL that identifies a bookmark: raw without its
+// fragment, tracking parameters, default port, or trailing slash, and with
+// its scheme and host lowercased.
+func Key(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("bookmarks: %q isn't a web URL", raw)
+	}
+	clean(u)
+	u.Scheme = "https"
+	u.Host = strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(u.Host, ":80"), ":443"))
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// Merge adds bs to kept, folding bookmarks with the same Key into one: the
+// earliest save wins, titles and notes fill in where one is missing, and
+// tags, highlights, and sources are combined. It returns the bookmarks
+// newest first and how many were new.
+func Merge(kept, bs []Bookmark) ([]Bookmark, int, error) {
+	byKey := map[string]*Bookmark{}
+	var order []string
+	added := 0
+	add := func(b Bookmark, isNew bool) error {
+		key, err := Key(b.URL)
+		if err != nil {
+			return err
+		}
+		old, ok := byKey[key]
+		if !ok {
+			if u, err := url.Parse(strings.TrimSpace(b.URL)); err == nil {
+				clean(u)
+				b.URL = u.String()
+			}
+			byKey[key] = &b
+			order = append(order, key)
+			if isNew {
+				added++
+			}
+			return nil
+		}
+		if !b.Saved.IsZero() && (old.Saved.IsZero() || b.Saved.Before(old.Saved)) {
+			old.Saved = b.Saved
+		}
+		old.Title = fill(old.Title, b.Title)
+		old.Author = fill(old.Author, b.Author)
+		old.Site = fill(old.Site, b.Site)
+		old.Note = fill(old.Note, b.Note)
+		for _, t := range b.Tags {
+			if !slices.ContainsFunc(old.Tags, func(o string) bool { return strings.EqualFold(o, t) }) {
+				old.Tags = append(old.Tags, t)
+			}
+		}
+		for _, h := range b.Highlights {
+			if !slices.ContainsFunc(old.Highlights, func(o Highlight) bool { return o.Text == h.Text }) {
+				old.Highlights = append(old.Highlights, h)
+			}
+		}
+		for _, s := range b.Sources {
+			if !slices.Contains(old.Sources, s) {
+				old.Sources = append(old.Sources, s)
+			}
+		}
+		return nil
+	}
+	for _, b := range kept {
+		if err := add(b, false); err != nil {
+			return nil, 0, err
+		}
+	}
+	for _, b := range bs {
+		if err := add(b, true); err != nil {
+			return nil, 0, err
+		}
+	}
+	out := make([]Bookmark, 0, len(order))
+	for _, key := range order {
+		b := byKey[key]
+		sort.Strings(b.Sources)
+		out = append(out, *b)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].Saved.Equal(out[j].Saved) {
+			return out[i].Saved.After(out[j].Saved)
+		}
+		return out[i].URL < out[j].URL
+	})
+	return out, added, nil
+}
+
+// fill returns a unless it's blank, and b then.
+func fill(a, b string) string {
+	if strings.TrimSpace(a) != "" {
+		return a
+	}
+	return strings.TrimSpace(b)
+}
+
+// clean drops u's fragment and tracking parameters.
+func clean(u *url.URL) {
+	u.Fragment = ""
+	q := u.Query()
+	for k := range q {
+		if strings.HasPrefix(k, "utm_") || slices.Contains(tracking, k) {
+			q.Del(k)
+		}
+	}
+	u.RawQuery = q.Encode()
+}
+
+// Load reads the bookmarks kept in dir, newest first. A missing dir has
+// none.
+func Load(dir string) ([]Bookmark, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var all []Bookmark
+	for _, p := range files {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var bs []Bookmark
+		if err := json.Unmarshal(b, &bs); err != nil {
+			return nil, fmt.Errorf("bookmarks: %s: %w", p, err)
+		}
+		all = append(all, bs...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Saved.After(all[j].Saved) })
+	return all, nil
+}
+
+// Save writes bs into dir as a file per year saved, skipping files whose
+// contents are unchanged and removing years with none left, and returns
+// the number of files written or removed.
+func Save(dir string, bs []Bookmark) (int, error) {
+	byYear := map[string][]Bookmark{}
+	for _, b := range bs {
+		year := "undated"
+		if !b.Saved.IsZero() {
+			year = strconv.Itoa(b.Saved.Year())
+		}
+		byYear[year] = append(byYear[year], b)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	n := 0
+	for year, list := range byYear {
+		wrote, err := fsutil.WriteJSONIfChanged(filepath.Join(dir, year+".json"), list)
+		if err != nil {
+			return n, err
+		}
+		if wrote {
+			n++
+		}
+	}
+	// A year whose bookmarks all moved to an earlier save is left empty.
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return n, err
+	}
+	for _, p := range files {
+		if _, ok := byYear[strings.TrimSuffix(filepath.Base(p), ".json")]; !ok {
+			if err := os.Remove(p); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
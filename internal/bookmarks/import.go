@@ -0,0 +1,183 @@
+package bookmarks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Readwise and Pocket are the sources, as recorded in Bookmark.Sources.
+const (
+	Readwise = "readwise"
+	Pocket   = "pocket"
+)
+
+// readerDoc is a document from Readwise Reader's list API: an article, or a
+// highlight or note whose parent is one.
+type readerDoc struct {
+	ID        string `json:"id"`
+	SourceURL string `json:"source_url"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	SiteName  string `json:"site_name"`
+	Category  string `json:"category"`
+	Content   string `json:"content"`
+	Notes     string `json:"notes"`
+	ParentID  string `json:"parent_id"`
+	SavedAt   string `json:"saved_at"`
+	CreatedAt string `json:"created_at"`
+	// Tags are keyed by name; the values aren't needed.
+	Tags map[string]json.RawMessage `json:"tags"`
+}
+
+// ParseReadwise reads an export of Readwise Reader's list API
+// (GET /api/v3/list/): one response, with its documents under "results",
+// or the results of every page concatenated into one array. Highlights and
+// notes are attached to the documents they were made on; documents
+// without a web URL, like uploaded PDFs, are skipped.
+func ParseReadwise(b []byte) ([]Bookmark, error) {
+	var docs []readerDoc
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		if err := json.Unmarshal(b, &docs); err != nil {
+			return nil, fmt.Errorf("bookmarks: readwise: %w", err)
+		}
+	} else {
+		var page struct {
+			Results []readerDoc `json:"results"`
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return nil, fmt.Errorf("bookmarks: readwise: %w", err)
+		}
+		docs = page.Results
+	}
+
+	highlights := map[string][]Highlight{}
+	for _, d := range docs {
+		if d.ParentID != "" && d.Category == "highlight" && strings.TrimSpace(d.Content) != "" {
+			highlights[d.ParentID] = append(highlights[d.ParentID], Highlight{
+				Text: strings.TrimSpace(d.Content),
+				Note: strings.TrimSpace(d.Notes),
+			})
+		}
+	}
+	var bs []Bookmark
+	for _, d := range docs {
+		if d.ParentID != "" || d.SourceURL == "" {
+			continue
+		}
+		if _, err := Key(d.SourceURL); err != nil {
+			continue
+		}
+		saved, err := parseTime(fill(d.SavedAt, d.CreatedAt))
+		if err != nil {
+			return nil, fmt.Errorf("bookmarks: readwise: %s: %w", d.SourceURL, err)
+		}
+		tags := make([]string, 0, len(d.Tags))
+		for t := range d.Tags {
+			tags = append(tags, t)
+		}
+		sort.Strings(tags)
+		bs = append(bs, Bookmark{
+			URL:        d.SourceURL,
+			Title:      strings.TrimSpace(d.Title),
+			Author:     strings.TrimSpace(d.Author),
+			Site:       strings.TrimSpace(d.SiteName),
+			Tags:       tags,
+			Saved:      saved,
+			Note:       strings.TrimSpace(d.Notes),
+			Highlights: highlights[d.ID],
+			Sources:    []string{Readwise},
+		})
+	}
+	return bs, nil
+}
+
+// pocketItem is an item from Pocket's retrieve API, as returned with
+// detailType=complete.
+type pocketItem struct {
+	GivenURL      string                     `json:"given_url"`
+	ResolvedURL   string                     `json:"resolved_url"`
+	GivenTitle    string                     `json:"given_title"`
+	ResolvedTitle string                     `json:"resolved_title"`
+	TimeAdded     string                     `json:"time_added"`
+	Tags          map[string]json.RawMessage `json:"tags"`
+	Authors       map[string]struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Domain struct {
+		Name string `json:"name"`
+	} `json:"domain_metadata"`
+	Annotations []struct {
+		Quote string `json:"quote"`
+	} `json:"annotations"`
+}
+
+// ParsePocket reads an export of Pocket's retrieve API (GET /v3/get with
+// detailType=complete), whose items are keyed by ID under "list".
+func ParsePocket(b []byte) ([]Bookmark, error) {
+	var resp struct {
+		// An empty list comes back as [], not {}.
+		List json.RawMessage `json:"list"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("bookmarks: pocket: %w", err)
+	}
+	items := map[string]pocketItem{}
+	if l := bytes.TrimSpace(resp.List); len(l) > 0 && l[0] == '{' {
+		if err := json.Unmarshal(l, &items); err != nil {
+			return nil, fmt.Errorf("bookmarks: pocket: %w", err)
+		}
+	}
+	var bs []Bookmark
+	for _, it := range items {
+		u := fill(it.ResolvedURL, it.GivenURL)
+		if _, err := Key(u); err != nil {
+			continue
+		}
+		secs, err := strconv.ParseInt(it.TimeAdded, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bookmarks: pocket: %s: time_added %q: %w", u, it.TimeAdded, err)
+		}
+		var tags, authors []string
+		for t := range it.Tags {
+			tags = append(tags, t)
+		}
+		for _, a := range it.Authors {
+			authors = append(authors, a.Name)
+		}
+		sort.Strings(tags)
+		sort.Strings(authors)
+		var highlights []Highlight
+		for _, a := range it.Annotations {
+			if q := strings.TrimSpace(a.Quote); q != "" {
+				highlights = append(highlights, Highlight{Text: q})
+			}
+		}
+		bs = append(bs, Bookmark{
+			URL:        u,
+			Title:      fill(it.ResolvedTitle, it.GivenTitle),
+			Author:     strings.Join(authors, ", "),
+			Site:       it.Domain.Name,
+			Tags:       tags,
+			Saved:      time.Unix(secs, 0).UTC(),
+			Highlights: highlights,
+			Sources:    []string{Pocket},
+		})
+	}
+	return bs, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,221 @@
+package bookmarks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultSection is where the Reading section's pages are written for the
+// reading layout to read as site.Data.reading.
+const DefaultSection = "data/reading.json"
+
+// Root is the Reading section's URL.
+const Root = "/reading/"
+
+// marker starts the front matter of the page stubs Write generates, so it
+// only ever deletes its own.
+const marker = "# Generated by `bookmarks`; don't edit."
+
+// Tag is a tag's page in the Reading section and how many bookmarks it has.
+type Tag struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Count int    `json:"count,omitempty"`
+}
+
+// Entry is a bookmark as the reading layout shows it.
+type Entry struct {
+	URL        string      `json:"url"`
+	Title      string      `json:"title"`
+	Author     string      `json:"author,omitempty"`
+	Site       string      `json:"site,omitempty"`
+	Saved      string      `json:"saved,omitempty"`
+	Tags       []Tag       `json:"tags,omitempty"`
+	Note       string      `json:"note,omitempty"`
+	Highlights []Highlight `json:"highlights,omitempty"`
+}
+
+// Page is one page of the section, or of a tag's bookmarks in it.
+type Page struct {
+	Title string `json:"title"`
+	// Tag is the tag the page lists, if it lists one.
+	Tag     string  `json:"tag,omitempty"`
+	Number  int     `json:"number"`
+	Total   int     `json:"total"`
+	Prev    string  `json:"prev,omitempty"`
+	Next    string  `json:"next,omitempty"`
+	Entries []Entry `json:"entries"`
+}
+
+// Section is the Reading section: its tags, most used first, and its pages
+// by URL.
+type Section struct {
+	Tags  []Tag           `json:"tags"`
+	Pages map[string]Page `json:"pages"`
+}
+
+// Layout paginates bs, newest first, perPage to a page, under Root and
+// under Root/tags/<tag>/ for each tag.
+func Layout(bs []Bookmark, perPage int) Section {
+	if perPage <= 0 {
+		perPage = len(bs)
+	}
+	tagURL := func(name string) string { return Root + "tags/" + content.TagSlug(name) + "/" }
+	s := Section{Pages: map[string]Page{}}
+
+	counts := map[string]int{}
+	names := map[string]string{}
+	byTag := map[string][]Entry{}
+	var all []Entry
+	for _, b := range bs {
+		e := Entry{
+			URL:        b.URL,
+			Title:      fill(b.Title, b.URL),
+			Author:     b.Author,
+			Site:       b.Site,
+			Note:       b.Note,
+			Highlights: b.Highlights,
+		}
+		if !b.Saved.IsZero() {
+			e.Saved = b.Saved.Format("2006-01-02")
+		}
+		for _, t := range b.Tags {
+			u := tagURL(t)
+			if _, ok := names[u]; !ok {
+				names[u] = t
+			}
+			e.Tags = append(e.Tags, Tag{Name: names[u], URL: u})
+		}
+		all = append(all, e)
+		for _, t := range e.Tags {
+			counts[t.URL]++
+			byTag[t.URL] = append(byTag[t.URL], e)
+		}
+	}
+
+	paginate := func(base, title, tag string, entries []Entry) {
+		total := max((len(entries)+perPage-1)/perPage, 1)
+		url := func(n int) string {
+			if n == 1 {
+				return base
+			}
+			return base + "page/" + strconv.Itoa(n) + "/"
+		}
+		for n := 1; n <= total; n++ {
+			p := Page{Title: title, Tag: tag, Number: n, Total: total, Entries: []Entry{}}
+			if n > 1 {
+				p.Prev = url(n - 1)
+			}
+			if n < total {
+				p.Next = url(n + 1)
+			}
+			lo, hi := (n-1)*perPage, min(n*perPage, len(entries))
+			if lo < hi {
+				p.Entries = entries[lo:hi]
+			}
+			s.Pages[url(n)] = p
+		}
+	}
+	paginate(Root, "Reading", "", all)
+	for u, entries := range byTag {
+		name := names[u]
+		s.Tags = append(s.Tags, Tag{Name: name, URL: u, Count: counts[u]})
+		paginate(u, "Reading: "+name, name, entries)
+	}
+	sort.Slice(s.Tags, func(i, j int) bool {
+		if s.Tags[i].Count != s.Tags[j].Count {
+			return s.Tags[i].Count > s.Tags[j].Count
+		}
+		return s.Tags[i].Name < s.Tags[j].Name
+	})
+	return s
+}
+
+// stub returns the name, under the content directory, of the page served
+// at url, and its contents. The stubs sit at the content root, which the
+// tooling reads as standalone pages rather than posts.
+func stub(url string, p Page) (string, []byte) {
+	name := "reading" + strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(url, "/reading"), "/"), "/", "-") + ".md"
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "---\n%s\ntitle: %q\nlayout: \"reading\"\nurl: %q\nsummary: reading\n", marker, p.Title, url)
+	if url == Root {
+		b.WriteString("description: \"Articles I've saved, with my highlights.\"\n")
+	}
+	b.WriteString("---\n")
+	return name, b.Bytes()
+}
+
+// Write writes s to dataPath and a page stub for each of its pages into
+// contentDir, deleting the stubs of pages it no longer has and skipping
+// files whose contents are unchanged, and returns the number of files
+// written or deleted.
+func (s Section) Write(contentDir, dataPath string) (int, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	files := map[string][]byte{dataPath: append(data, '\n')}
+	for url, p := range s.Pages {
+		name, b := stub(url, p)
+		files[filepath.Join(contentDir, name)] = b
+	}
+
+	n := 0
+	old, err := filepath.Glob(filepath.Join(contentDir, "reading*.md"))
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range old {
+		if _, ok := files[p]; ok {
+			continue
+		}
+		if mine, err := generated(p); err != nil {
+			return n, err
+		} else if mine {
+			if err := os.Remove(p); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	for p, b := range files {
+		wrote, err := fsutil.WriteIfChanged(p, b)
+		if err != nil {
+			return n, err
+		}
+		if wrote {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// generated reports whether the file at p is a stub Write made.
+func generated(p string) (bool, error) {
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for i := 0; i < 2 && sc.Scan(); i++ {
+		if sc.Text() == marker {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
@@ -0,0 +1,383 @@
+// Package budget measures what each built page costs to load, its HTML,
+// the CSS and JavaScript it pulls in, its number of requests, and its
+// largest image, and checks it against the budgets in data/budgets.toml:
+//
+//	[default]
+//	html = 150_000
+//	requests = 40
+//
+//	[[page]]
+//	match = "/search/"
+//	js = 120_000
+//
+// The measurements are saved as a baseline, so a page over budget is
+// reported with how much it grew since the last build.
+package budget
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/net/html"
+)
+
+// DefaultConfig is where the budgets live.
+const DefaultConfig = "data/budgets.toml"
+
+// DefaultBaseline is where the last build's measurements are kept.
+const DefaultBaseline = ".budget-baseline.json"
+
+// Metrics names the measurements, in the order they're reported.
+var Metrics = []string{"html", "css", "js", "requests", "image"}
+
+// Budget caps a page's measurements, in bytes except for Requests. In a
+// page rule, zero keeps the default's cap and a negative value lifts it.
+type Budget struct {
+	HTML     int64 `toml:"html"`
+	CSS      int64 `toml:"css"`
+	JS       int64 `toml:"js"`
+	Requests int64 `toml:"requests"`
+	Image    int64 `toml:"image"`
+}
+
+// Rule is a budget for the pages whose URL paths match Match, exactly or,
+// ending in *, by prefix.
+type Rule struct {
+	Match string `toml:"match"`
+	Budget
+}
+
+// Config is the budgets file: the budget every page gets and the rules
+// that adjust it, applied in order.
+type Config struct {
+	Default Budget `toml:"default"`
+	Pages   []Rule `toml:"page"`
+}
+
+// Load reads the budgets at path. A missing file has no budgets.
+func Load(path string) (Config, error) {
+	var c Config
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := toml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("budget: %s: %w", path, err)
+	}
+	for i, r := range c.Pages {
+		if r.Match == "" {
+			return c, fmt.Errorf("budget: %s: page rule %d has no match", path, i+1)
+		}
+	}
+	return c, nil
+}
+
+// For returns the budget of the page at urlPath.
+func (c Config) For(urlPath string) Budget {
+	b := c.Default
+	for _, r := range c.Pages {
+		prefix, ok := strings.CutSuffix(r.Match, "*")
+		if !(ok && strings.HasPrefix(urlPath, prefix) || urlPath == r.Match) {
+			continue
+		}
+		for _, m := range Metrics {
+			if v := r.get(m); v != 0 {
+				b.set(m, v)
+			}
+		}
+	}
+	return b
+}
+
+func (b Budget) get(metric string) int64 {
+	switch metric {
+	case "html":
+		return b.HTML
+	case "css":
+		return b.CSS
+	case "js":
+		return b.JS
+	case "requests":
+		return b.Requests
+	case "image":
+		return b.Image
+	}
+	return 0
+}
+
+func (b *Budget) set(metric string, v int64) {
+	switch metric {
+	case "html":
+		b.HTML = v
+	case "css":
+		b.CSS = v
+	case "js":
+		b.JS = v
+	case "requests":
+		b.Requests = v
+	case "image":
+		b.Image = v
+	}
+}
+
+// Page is what a page costs to load. CSS and JS count inline code and the
+// files in the build that the page loads; Requests counts the page and
+// every distinct subresource, the site's or not; Image is the largest of
+// the site's images it can load, the largest candidate of a srcset.
+type Page struct {
+	HTML     int64 `json:"html"`
+	CSS      int64 `json:"css"`
+	JS       int64 `json:"js"`
+	Requests int64 `json:"requests"`
+	Image    int64 `json:"image"`
+}
+
+// Get returns the measurement named metric.
+func (p Page) Get(metric string) int64 {
+	return Budget(p).get(metric)
+}
+
+// Measure measures the pages of the built site in dir, by URL path.
+func Measure(dir string) (map[string]Page, error) {
+	m := &measurer{dir: dir, sizes: map[string]int64{}}
+	pages := map[string]Page{}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.ToLower(filepath.Ext(p)) != ".html" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		file := "/" + filepath.ToSlash(rel)
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		page, err := m.page(file, b)
+		if err != nil {
+			return fmt.Errorf("budget: %s: %w", file, err)
+		}
+		key := file
+		if path.Base(file) == "index.html" {
+			key = strings.TrimSuffix(file, "index.html")
+		}
+		pages[key] = page
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+type measurer struct {
+	dir string
+	// sizes caches the sizes of the site's files, -1 for a missing one.
+	sizes map[string]int64
+}
+
+func (m *measurer) size(urlPath string) int64 {
+	if n, ok := m.sizes[urlPath]; ok {
+		return n
+	}
+	n := int64(-1)
+	if fi, err := os.Stat(filepath.Join(m.dir, filepath.FromSlash(urlPath))); err == nil && !fi.IsDir() {
+		n = fi.Size()
+	}
+	m.sizes[urlPath] = n
+	return n
+}
+
+func (m *measurer) page(file string, b []byte) (Page, error) {
+	doc, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return Page{}, err
+	}
+	p := Page{HTML: int64(len(b)), Requests: 1}
+	self := &url.URL{Path: file}
+	seen := map[string]bool{}
+	// load counts a subresource's request and returns its size in the
+	// build the first time the page loads it; 0 for the rest.
+	load := func(ref string) int64 {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "#") {
+			return 0
+		}
+		u, err := self.Parse(ref)
+		if err != nil || seen[u.Host+u.Path] {
+			return 0
+		}
+		seen[u.Host+u.Path] = true
+		p.Requests++
+		if u.Host != "" {
+			return 0
+		}
+		return max(m.size(u.Path), 0)
+	}
+	// image weighs the candidates of an image, of which a browser fetches
+	// one.
+	image := func(refs []string) {
+		for _, ref := range refs {
+			if u, err := self.Parse(ref); err == nil && u.Host == "" && !strings.HasPrefix(ref, "data:") {
+				p.Image = max(p.Image, m.size(u.Path))
+			}
+		}
+		if len(refs) > 0 {
+			load(refs[0])
+		}
+	}
+	walk(doc, func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode && n.Parent != nil && n.Parent.Data == "style":
+			p.CSS += int64(len(n.Data))
+		case n.Type == html.TextNode && n.Parent != nil && n.Parent.Data == "script" && isJS(n.Parent):
+			p.JS += int64(len(n.Data))
+		case n.Type != html.ElementNode:
+		case n.Data == "link":
+			rel := strings.Fields(strings.ToLower(attr(n, "rel")))
+			as := strings.ToLower(attr(n, "as"))
+			switch {
+			case slices.Contains(rel, "stylesheet") || slices.Contains(rel, "preload") && as == "style":
+				p.CSS += load(attr(n, "href"))
+			case slices.Contains(rel, "modulepreload") || slices.Contains(rel, "preload") && as == "script":
+				p.JS += load(attr(n, "href"))
+			case slices.Contains(rel, "preload") || slices.Contains(rel, "icon"):
+				load(attr(n, "href"))
+			}
+		case n.Data == "script":
+			p.JS += load(attr(n, "src"))
+		case n.Data == "img":
+			refs := candidates(attr(n, "src"), attr(n, "srcset"))
+			if n.Parent != nil && n.Parent.Data == "picture" {
+				for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
+					if c.Type == html.ElementNode && c.Data == "source" {
+						refs = append(refs, candidates("", attr(c, "srcset"))...)
+					}
+				}
+			}
+			image(refs)
+		case n.Data == "video":
+			image(candidates(attr(n, "poster"), ""))
+			load(attr(n, "src"))
+		case n.Data == "audio" || n.Data == "iframe" || n.Data == "embed":
+			load(attr(n, "src"))
+		case n.Data == "source" && n.Parent != nil && n.Parent.Data != "picture":
+			load(attr(n, "src"))
+		}
+	})
+	return p, nil
+}
+
+// isJS reports whether the script element n holds JavaScript rather than
+// data like JSON-LD.
+func isJS(n *html.Node) bool {
+	switch strings.ToLower(attr(n, "type")) {
+	case "", "module", "text/javascript", "application/javascript":
+		return true
+	}
+	return false
+}
+
+// candidates returns the URLs of an image's src and srcset.
+func candidates(src, srcset string) []string {
+	var refs []string
+	if s := strings.TrimSpace(src); s != "" {
+		refs = append(refs, s)
+	}
+	for _, c := range strings.Split(srcset, ",") {
+		if f := strings.Fields(c); len(f) > 0 {
+			refs = append(refs, f[0])
+		}
+	}
+	return refs
+}
+
+// Violation is a measurement of a page over its budget.
+type Violation struct {
+	Page, Metric string
+	Value, Limit int64
+	// Baseline is the measurement in the last build, -1 if the page is new.
+	Baseline int64
+}
+
+// Check returns the measurements of pages over their budgets in c, with
+// their baselines from prev, ordered by page and metric.
+func Check(c Config, pages, prev map[string]Page) []Violation {
+	keys := make([]string, 0, len(pages))
+	for k := range pages {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var out []Violation
+	for _, k := range keys {
+		b := c.For(k)
+		for _, m := range Metrics {
+			limit, v := b.get(m), pages[k].Get(m)
+			if limit <= 0 || v <= limit {
+				continue
+			}
+			base := int64(-1)
+			if old, ok := prev[k]; ok {
+				base = old.Get(m)
+			}
+			out = append(out, Violation{Page: k, Metric: m, Value: v, Limit: limit, Baseline: base})
+		}
+	}
+	return out
+}
+
+// LoadBaseline reads measurements saved by SaveBaseline. A missing file
+// has none.
+func LoadBaseline(path string) (map[string]Page, error) {
+	pages := map[string]Page{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pages, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &pages); err != nil {
+		return nil, fmt.Errorf("budget: %s: %w", path, err)
+	}
+	return pages, nil
+}
+
+// SaveBaseline writes pages to path, for the next build to compare with.
+func SaveBaseline(path string, pages map[string]Page) error {
+	b, err := json.MarshalIndent(pages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+// Package bundle zips the code that goes with a post, for the bundle
+// partial's "Download the code" link: the files under code/<slug>/ when
+// the post has that folder, or else the code blocks that declare a file
+// name in a leading comment, like "# server.py". A README pointing back at
+// the post, and a go.mod when there's Go without one, are generated. The
+// zips are stored in R2 under names that change with their contents and
+// recorded in data/bundles.json.
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+// DefaultPath is where the bundle partial reads the bundles from, as
+// site.Data.bundles.
+const DefaultPath = "data/bundles.json"
+
+// DefaultDir holds a folder of code per post, named after its slug.
+const DefaultDir = "code"
+
+// GoVersion is the go directive of the generated go.mod: old enough for
+// the posts' code, and new enough that loop variables are per iteration.
+const GoVersion = "1.22"
+
+// File is a file in a bundle.
+type File struct {
+	// Name is the file's path in the bundle, with forward slashes.
+	Name string
+	Data []byte
+}
+
+// Files returns the code that goes with p: the files under dir/<slug>/
+// if there's such a folder, or else the blocks in p that declare a file
+// name. A name declared again, as in a before and after, gets a number:
+// src.py, then src_2.py. A post without either has no files.
+func Files(p *content.Post, dir string) ([]File, error) {
+	root := filepath.Join(dir, p.Slug)
+	if fi, err := os.Stat(root); err == nil && fi.IsDir() {
+		var files []File
+		err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, name)
+			if err != nil {
+				return err
+			}
+			b, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			files = append(files, File{Name: filepath.ToSlash(rel), Data: b})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("bundle: %w", err)
+		}
+		return files, nil
+	}
+
+	var files []File
+	seen := map[string]int{}
+	for _, b := range snippet.Extract(p) {
+		name := b.Filename()
+		if name == "" || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "../") {
+			continue
+		}
+		if seen[name]++; seen[name] > 1 {
+			ext := path.Ext(name)
+			name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), seen[name], ext)
+		}
+		files = append(files, File{Name: name, Data: []byte(strings.TrimRight(b.Code, "\n") + "\n")})
+	}
+	return files, nil
+}
+
+var readme = template.Must(template.New("README.md").Parse(`# {{.Title}}
+
+The code from [{{.Title}}]({{.URL}}).
+
+{{range .Files}}- ` + "`{{.}}`" + `
+{{end}}{{if .Go}}
+Build it with Go {{.GoVersion}} or newer. Run ` + "`go mod tidy`" + ` first if it
+imports anything outside the standard library.
+{{end}}`))
+
+// Zip bundles files into a zip under a <slug>/ folder, with a README that
+// links to the post at url and, for Go without a go.mod, a go.mod. The
+// zip is the same for the same files, so its hash says whether they
+// changed.
+func Zip(p *content.Post, url string, files []File) ([]byte, error) {
+	files = slices.Clone(files)
+	names := make([]string, len(files))
+	hasGo, hasMod, hasReadme := false, false, false
+	for i, f := range files {
+		names[i] = f.Name
+		hasGo = hasGo || path.Ext(f.Name) == ".go"
+		hasMod = hasMod || f.Name == "go.mod"
+		hasReadme = hasReadme || strings.EqualFold(f.Name, "README.md")
+	}
+	if hasGo && !hasMod {
+		mod := fmt.Sprintf("module %s\n\ngo %s\n", p.Slug, GoVersion)
+		files = append(files, File{Name: "go.mod", Data: []byte(mod)})
+	}
+	if !hasReadme {
+		var b bytes.Buffer
+		err := readme.Execute(&b, map[string]any{
+			"Title": p.Title, "URL": url, "Files": names,
+			"Go": hasGo, "GoVersion": GoVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: "README.md", Data: b.Bytes()})
+	}
+	slices.SortFunc(files, func(a, b File) int { return strings.Compare(a.Name, b.Name) })
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		// Dates are left out so the same files make the same zip.
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: path.Join(p.Slug, f.Name), Method: zip.Deflate})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Hash identifies a bundle's contents.
+func Hash(zip []byte) string {
+	sum := sha256.Sum256(zip)
+	return hex.EncodeToString(sum[:])
+}
+
+// Bundle is a post's zip as the bundle partial links to it.
+type Bundle struct {
+	// Hash is the zip's; see Hash.
+	Hash string `json:"hash"`
+	// Key is the object's in the bucket, and Src its public URL.
+	Key   string `json:"key"`
+	Src   string `json:"src"`
+	Bytes int    `json:"bytes"`
+	// Files are the post's, without the generated ones.
+	Files []string `json:"files"`
+}
+
+// Manifest maps each post's slug to its bundle.
+type Manifest map[string]Bundle
+
+// Load reads the manifest at path. A missing file yields an empty manifest.
+func Load(path string) (Manifest, error) {
+	m := Manifest{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("bundle: parse %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Save writes the manifest to path.
+func (m Manifest) Save(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
@@ -0,0 +1,290 @@
+// Package cite numbers the references posts cite with the cite shortcode,
+// {{< cite key >}} or {{< cite key1 key2 >}}, and formats the
+// bibliography the references partial lists at the end of the post.
+//
+// References live in TOML files under data/references/, a table per key:
+//
+//	[kernighan1988]
+//	type = "book"
+//	authors = ["Brian W. Kernighan", "Dennis M. Ritchie"]
+//	title = "The C Programming Language"
+//	edition = "2nd"
+//	publisher = "Prentice Hall"
+//	year = 1988
+//
+// The type is article, book, paper, talk, or web, and decides which of
+// the other fields are shown and how; see Reference. A post's references
+// are numbered in the order it first cites them, and a key that's in no
+// file is an error, here and in the shortcode.
+package cite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultDir holds the reference files.
+const DefaultDir = "data/references"
+
+// DefaultPath is where the shortcode and partial read the numbered
+// references from, as site.Data.cite.
+const DefaultPath = "data/cite.json"
+
+// Reference is a work a post can cite.
+type Reference struct {
+	// Type is article, book, paper, talk, or web.
+	Type string `toml:"type"`
+	// Authors are full names, first name first, shortened to initials
+	// when shown. Wrap one in braces, as in "{The Go Team}", to show it
+	// as it is.
+	Authors []string `toml:"authors"`
+	Title   string   `toml:"title"`
+	Year    int      `toml:"year"`
+
+	// Journal, Volume, Issue, and Pages are an article's.
+	Journal string `toml:"journal"`
+	Volume  string `toml:"volume"`
+	Issue   string `toml:"issue"`
+	Pages   string `toml:"pages"`
+	// Publisher and Edition are a book's.
+	Publisher string `toml:"publisher"`
+	Edition   string `toml:"edition"`
+	// Venue is the conference or event a paper or talk was given at.
+	Venue string `toml:"venue"`
+	// Site is the website a web page is on, and Accessed the date it was
+	// read, like 2024-05-01.
+	Site     string `toml:"site"`
+	Accessed string `toml:"accessed"`
+
+	// DOI links the reference when it has one, and URL otherwise.
+	DOI string `toml:"doi"`
+	URL string `toml:"url"`
+}
+
+var types = []string{"article", "book", "paper", "talk", "web"}
+
+var keyRe = regexp.MustCompile(`^[\w.:-]+$`)
+
+// Load reads every .toml file in dir. A key in two files is an error, as
+// is a reference without a known type or a title.
+func Load(dir string) (map[string]Reference, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]Reference{}
+	from := map[string]string{}
+	for _, f := range files {
+		var m map[string]Reference
+		md, err := toml.DecodeFile(f, &m)
+		if err != nil {
+			return nil, fmt.Errorf("cite: %w", err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("cite: %s: unknown field %s", f, undecoded[0])
+		}
+		for key, r := range m {
+			switch {
+			case !keyRe.MatchString(key):
+				return nil, fmt.Errorf("cite: %s: key %q: use letters, digits, and . : _ -", f, key)
+			case from[key] != "":
+				return nil, fmt.Errorf("cite: %s: %s is also in %s", f, key, from[key])
+			case !slices.Contains(types, r.Type):
+				return nil, fmt.Errorf("cite: %s: %s: type %q isn't one of %s", f, key, r.Type, strings.Join(types, ", "))
+			case r.Title == "":
+				return nil, fmt.Errorf("cite: %s: %s has no title", f, key)
+			}
+			refs[key], from[key] = r, f
+		}
+	}
+	return refs, nil
+}
+
+// Entry is a reference as a post numbers it.
+type Entry struct {
+	Key string `json:"key"`
+	N   int    `json:"n"`
+	// HTML is the formatted reference.
+	HTML string `json:"html"`
+}
+
+// Problem is a cite of an unknown key, at a line of a post.
+type Problem struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.Path, p.Line, p.Msg)
+}
+
+var shortcodeRe = regexp.MustCompile(`\{\{<\s*cite\s+([^>]*?)\s*>\}\}`)
+
+// Posts returns the references each post cites, numbered, keyed by
+// content.Post.DataKey, and the cites of keys that aren't in refs.
+func Posts(posts []*content.Post, refs map[string]Reference) (map[string][]Entry, []Problem) {
+	out := map[string][]Entry{}
+	var problems []Problem
+	for _, p := range posts {
+		var entries []Entry
+		for _, m := range shortcodeRe.FindAllStringSubmatchIndex(p.Body, -1) {
+			line := p.BodyLine + strings.Count(p.Body[:m[0]], "\n")
+			for _, key := range strings.Fields(p.Body[m[2]:m[3]]) {
+				key = strings.Trim(key, `"`)
+				r, ok := refs[key]
+				if !ok {
+					problems = append(problems, Problem{p.Path, line, fmt.Sprintf("unknown reference %q; add it to a file in %s", key, DefaultDir)})
+					continue
+				}
+				if slices.ContainsFunc(entries, func(e Entry) bool { return e.Key == key }) {
+					continue
+				}
+				entries = append(entries, Entry{Key: key, N: len(entries) + 1, HTML: Format(r)})
+			}
+		}
+		if len(entries) > 0 {
+			out[p.DataKey()] = entries
+		}
+	}
+	return out, problems
+}
+
+// Format renders r in the site's one style: the authors and year, the
+// title, where it appeared, and a link.
+//
+//	Kernighan, B. W. and Ritchie, D. M. (1988). The C Programming Language, 2nd ed. Prentice Hall.
+func Format(r Reference) string {
+	esc := html.EscapeString
+	var parts []string
+	lead := esc(authors(r.Authors))
+	if r.Year > 0 {
+		lead = strings.TrimSpace(fmt.Sprintf("%s (%d)", lead, r.Year))
+	}
+	if lead != "" {
+		parts = append(parts, lead)
+	}
+
+	switch r.Type {
+	case "book":
+		title := "<cite>" + esc(r.Title) + "</cite>"
+		if r.Edition != "" {
+			title += ", " + esc(r.Edition) + " ed"
+		}
+		parts = append(parts, title, esc(r.Publisher))
+	case "article":
+		where := "<cite>" + esc(r.Journal) + "</cite>"
+		if r.Journal == "" {
+			where = ""
+		}
+		if r.Volume != "" {
+			where += ", " + esc(r.Volume)
+			if r.Issue != "" {
+				where += "(" + esc(r.Issue) + ")"
+			}
+		}
+		if r.Pages != "" {
+			where += ", " + esc(r.Pages)
+		}
+		parts = append(parts, esc(r.Title), strings.TrimPrefix(where, ", "))
+	case "paper", "talk":
+		where := ""
+		if r.Venue != "" {
+			where = "In <cite>" + esc(r.Venue) + "</cite>"
+			if r.Type == "talk" {
+				where = "Talk at <cite>" + esc(r.Venue) + "</cite>"
+			}
+		}
+		parts = append(parts, esc(r.Title), where)
+	case "web":
+		where := esc(r.Site)
+		if r.Accessed != "" {
+			where = strings.TrimPrefix(where+". Retrieved "+esc(r.Accessed), ". ")
+		}
+		parts = append(parts, "<cite>"+esc(r.Title)+"</cite>", where)
+	}
+
+	var b strings.Builder
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		b.WriteString(p)
+		if !strings.HasSuffix(p, ".") {
+			b.WriteString(".")
+		}
+		b.WriteString(" ")
+	}
+	link := r.URL
+	if r.DOI != "" {
+		link = "https://doi.org/" + r.DOI
+	}
+	if link != "" {
+		fmt.Fprintf(&b, `<a href="%s">%s</a>`, esc(link), esc(link))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// authors lists names as "Last, F. M.", joined with commas and a final
+// "and"; past three, the first is followed by "et al.".
+func authors(names []string) string {
+	short := make([]string, len(names))
+	for i, n := range names {
+		short[i] = initials(n)
+	}
+	switch len(short) {
+	case 0:
+		return ""
+	case 1:
+		return short[0]
+	case 2, 3:
+		return strings.Join(short[:len(short)-1], ", ") + " and " + short[len(short)-1]
+	default:
+		return short[0] + " et al."
+	}
+}
+
+// initials turns "Brian W. Kernighan" into "Kernighan, B. W.". A name
+// that's one word, or in braces, is kept as it is.
+func initials(name string) string {
+	if s, ok := strings.CutPrefix(name, "{"); ok && strings.HasSuffix(s, "}") {
+		return strings.TrimSuffix(s, "}")
+	}
+	f := strings.Fields(name)
+	if len(f) < 2 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(f[len(f)-1] + ",")
+	for _, given := range f[:len(f)-1] {
+		r := []rune(strings.TrimSuffix(given, "."))
+		if len(r) > 0 {
+			b.WriteString(" " + string(r[0]) + ".")
+		}
+	}
+	return b.String()
+}
+
+// Write saves the numbered references to path if they differ from what's
+// there, and reports whether it wrote.
+func Write(path string, cites map[string][]Entry) (bool, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cites); err != nil {
+		return false, err
+	}
+	return fsutil.WriteIfChanged(path, buf.Bytes())
+}
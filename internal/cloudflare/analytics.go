@@ -0,0 +1,196 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PathCount is how many requests a path got.
+type PathCount struct {
+	Path  string
+	Count int
+}
+
+const pathsQuery = `query ($zone: String!, $filter: ZoneHttpRequestsAdaptiveGroupsFilter_InputObject!, $limit: Int!) {
+  viewer {
+    zones(filter: {zoneTag: $zone}) {
+      httpRequestsAdaptiveGroups(limit: $limit, filter: $filter, orderBy: [count_DESC]) {
+        count
+        dimensions { clientRequestPath }
+      }
+    }
+  }
+}`
+
+// PageViews filters Paths to what people load as pages: successful GETs
+// of HTML from browsers rather than Cloudflare's own or other bots'
+// requests.
+var PageViews = map[string]any{
+	"edgeResponseStatus":          200,
+	"requestSource":               "eyeball",
+	"clientRequestHTTPMethodName": "GET",
+	"edgeResponseContentTypeName": "html",
+}
+
+// Paths returns the requests per path on the UTC day starting at day that
+// match filter, a httpRequestsAdaptiveGroups filter like PageViews, most
+// requested first and at most limit of them. The Analytics API caps a
+// query at a day, hence the granularity.
+func (c *Client) Paths(ctx context.Context, day time.Time, filter map[string]any, limit int) ([]PathCount, error) {
+	f := map[string]any{
+		"datetime_geq": day.UTC().Format(time.RFC3339),
+		"datetime_lt":  day.Add(24 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	for k, v := range filter {
+		f[k] = v
+	}
+	var data struct {
+		Viewer struct {
+			Zones []struct {
+				Groups []struct {
+					Count      int `json:"count"`
+					Dimensions struct {
+						Path string `json:"clientRequestPath"`
+					} `json:"dimensions"`
+				} `json:"httpRequestsAdaptiveGroups"`
+			} `json:"zones"`
+		} `json:"viewer"`
+	}
+	vars := map[string]any{"zone": c.cfg.ZoneID, "filter": f, "limit": limit}
+	if err := c.graphql(ctx, pathsQuery, vars, &data); err != nil {
+		return nil, fmt.Errorf("cloudflare: analytics: %w", err)
+	}
+	var out []PathCount
+	for _, z := range data.Viewer.Zones {
+		for _, g := range z.Groups {
+			out = append(out, PathCount{g.Dimensions.Path, g.Count})
+		}
+	}
+	return out, nil
+}
+
+const queriesQuery = `query ($zone: String!, $filter: ZoneHttpRequestsAdaptiveGroupsFilter_InputObject!, $limit: Int!) {
+  viewer {
+    zones(filter: {zoneTag: $zone}) {
+      httpRequestsAdaptiveGroups(limit: $limit, filter: $filter, orderBy: [count_DESC]) {
+        count
+        dimensions { clientRequestPath clientRequestQuery }
+      }
+    }
+  }
+}`
+
+// QueryCount is how many requests a path got with a query string.
+type QueryCount struct {
+	Path string
+	// Query is the query string, with its leading "?".
+	Query string
+	Count int
+}
+
+// Queries is Paths grouped by query string as well as path. Filter on
+// clientRequestQuery_like to keep the groups to the queries of interest.
+func (c *Client) Queries(ctx context.Context, day time.Time, filter map[string]any, limit int) ([]QueryCount, error) {
+	f := map[string]any{
+		"datetime_geq": day.UTC().Format(time.RFC3339),
+		"datetime_lt":  day.Add(24 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	for k, v := range filter {
+		f[k] = v
+	}
+	var data struct {
+		Viewer struct {
+			Zones []struct {
+				Groups []struct {
+					Count      int `json:"count"`
+					Dimensions struct {
+						Path  string `json:"clientRequestPath"`
+						Query string `json:"clientRequestQuery"`
+					} `json:"dimensions"`
+				} `json:"httpRequestsAdaptiveGroups"`
+			} `json:"zones"`
+		} `json:"viewer"`
+	}
+	vars := map[string]any{"zone": c.cfg.ZoneID, "filter": f, "limit": limit}
+	if err := c.graphql(ctx, queriesQuery, vars, &data); err != nil {
+		return nil, fmt.Errorf("cloudflare: analytics: %w", err)
+	}
+	var out []QueryCount
+	for _, z := range data.Viewer.Zones {
+		for _, g := range z.Groups {
+			out = append(out, QueryCount{g.Dimensions.Path, g.Dimensions.Query, g.Count})
+		}
+	}
+	return out, nil
+}
+
+// NotFound returns the paths that got a 404 between since and until, most
+// requested first, at most limit per day, summed over the days.
+func (c *Client) NotFound(ctx context.Context, since, until time.Time, limit int) ([]PathCount, error) {
+	counts := map[string]int{}
+	for day := since; day.Before(until); day = day.Add(24 * time.Hour) {
+		pcs, err := c.Paths(ctx, day, map[string]any{"edgeResponseStatus": 404}, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, pc := range pcs {
+			counts[pc.Path] += pc.Count
+		}
+	}
+	out := make([]PathCount, 0, len(counts))
+	for p, n := range counts {
+		out = append(out, PathCount{p, n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out, nil
+}
+
+// graphql runs query against the GraphQL Analytics API, which reports
+// errors in its own envelope rather than the REST API's.
+func (c *Client) graphql(ctx context.Context, query string, vars map[string]any, out any) error {
+	b, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimSuffix(c.cfg.Endpoint, "/") + "/graphql"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.cfg.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if len(res.Errors) > 0 || resp.StatusCode != http.StatusOK {
+		msgs := make([]string, 0, len(res.Errors))
+		for _, e := range res.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.Join(msgs, "; "))
+	}
+	return json.Unmarshal(res.Data, out)
+}
@@ -0,0 +1,139 @@
+// Package cloudflare is a minimal client for the Cloudflare API. It covers
+// purging cached URLs, so a deploy can drop the pages that changed instead
+// of the whole zone's cache, and replacing a Bulk Redirects list.
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultEndpoint is the Cloudflare API's base URL.
+const DefaultEndpoint = "https://api.cloudflare.com/client/v4"
+
+// MaxPurgeFiles is how many URLs a single purge request may carry on every
+// plan. Longer lists are split across requests.
+const MaxPurgeFiles = 30
+
+// Config holds the API token, the zone the site is served from, and the
+// account that owns it. Purging needs ZoneID and a token with the Cache
+// Purge permission; redirect lists need AccountID and the Account Filter
+// Lists Edit permission.
+type Config struct {
+	APIToken  string
+	ZoneID    string
+	AccountID string
+
+	// Endpoint overrides DefaultEndpoint, for pointing the client at a
+	// local server.
+	Endpoint string
+}
+
+// ConfigFromEnv reads CLOUDFLARE_API_TOKEN, CLOUDFLARE_ZONE_ID,
+// CLOUDFLARE_ACCOUNT_ID, and CLOUDFLARE_ENDPOINT from the environment.
+func ConfigFromEnv() Config {
+	return Config{
+		APIToken:  os.Getenv("CLOUDFLARE_API_TOKEN"),
+		ZoneID:    os.Getenv("CLOUDFLARE_ZONE_ID"),
+		AccountID: os.Getenv("CLOUDFLARE_ACCOUNT_ID"),
+		Endpoint:  os.Getenv("CLOUDFLARE_ENDPOINT"),
+	}
+}
+
+// Client talks to a single zone.
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// New validates cfg and returns a client. need lists the IDs the caller's
+// requests use, "zone" or "account", so a missing one is reported before
+// any work is done.
+func New(cfg Config, need ...string) (*Client, error) {
+	if cfg.APIToken == "" {
+		return nil, errors.New("cloudflare: missing API token")
+	}
+	for _, n := range need {
+		if n == "zone" && cfg.ZoneID == "" || n == "account" && cfg.AccountID == "" {
+			return nil, fmt.Errorf("cloudflare: missing %s id", n)
+		}
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultEndpoint
+	}
+	return &Client{cfg: cfg, http: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+type response struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// PurgeFiles drops urls from Cloudflare's cache, MaxPurgeFiles at a time.
+// URLs must be absolute and match what visitors request, scheme included.
+func (c *Client) PurgeFiles(ctx context.Context, urls []string) error {
+	for len(urls) > 0 {
+		n := min(len(urls), MaxPurgeFiles)
+		body := map[string][]string{"files": urls[:n]}
+		if err := c.do(ctx, http.MethodPost, "/zones/"+c.cfg.ZoneID+"/purge_cache", body, nil); err != nil {
+			return fmt.Errorf("cloudflare: purge: %w", err)
+		}
+		urls = urls[n:]
+	}
+	return nil
+}
+
+// do sends body as JSON to the API path and decodes the response's result
+// into out, if it's not nil.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	endpoint := strings.TrimSuffix(c.cfg.Endpoint, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.cfg.APIToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if !res.Success || resp.StatusCode != http.StatusOK {
+		msgs := make([]string, 0, len(res.Errors))
+		for _, e := range res.Errors {
+			msgs = append(msgs, fmt.Sprintf("%s (%d)", e.Message, e.Code))
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.Join(msgs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(res.Result, out)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Redirect is an item of a Bulk Redirects list. SourceURL has no scheme,
+// as in "rednafi.com/old/path/".
+type Redirect struct {
+	SourceURL           string `json:"source_url"`
+	TargetURL           string `json:"target_url"`
+	StatusCode          int    `json:"status_code"`
+	PreserveQueryString bool   `json:"preserve_query_string"`
+}
+
+type list struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// ReplaceRedirects makes the account's redirect list named name hold
+// exactly redirects, creating the list if it doesn't exist, and waits for
+// Cloudflare to apply the change. A Bulk Redirect Rule has to reference
+// the list for it to take effect; that's set up once in the dashboard.
+func (c *Client) ReplaceRedirects(ctx context.Context, name string, redirects []Redirect) error {
+	id, err := c.redirectList(ctx, name)
+	if err != nil {
+		return fmt.Errorf("cloudflare: redirects: %w", err)
+	}
+	items := make([]map[string]Redirect, len(redirects))
+	for i, r := range redirects {
+		items[i] = map[string]Redirect{"redirect": r}
+	}
+	var op struct {
+		ID string `json:"operation_id"`
+	}
+	base := "/accounts/" + c.cfg.AccountID + "/rules/lists/"
+	if err := c.do(ctx, http.MethodPut, base+id+"/items", items, &op); err != nil {
+		return fmt.Errorf("cloudflare: redirects: %w", err)
+	}
+	// Replacing the items is asynchronous.
+	for {
+		var status struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := c.do(ctx, http.MethodGet, base+"bulk_operations/"+op.ID, nil, &status); err != nil {
+			return fmt.Errorf("cloudflare: redirects: %w", err)
+		}
+		switch status.Status {
+		case "completed":
+			return nil
+		case "failed":
+			return fmt.Errorf("cloudflare: redirects: %s", status.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// redirectList returns the ID of the list named name, creating it if
+// needed.
+func (c *Client) redirectList(ctx context.Context, name string) (string, error) {
+	base := "/accounts/" + c.cfg.AccountID + "/rules/lists"
+	var lists []list
+	if err := c.do(ctx, http.MethodGet, base, nil, &lists); err != nil {
+		return "", err
+	}
+	for _, l := range lists {
+		if l.Name == name {
+			if l.Kind != "redirect" {
+				return "", fmt.Errorf("list %q is a %s list, not a redirect list", name, l.Kind)
+			}
+			return l.ID, nil
+		}
+	}
+	var l list
+	body := map[string]string{
+		"name":        name,
+		"kind":        "redirect",
+		"description": "Managed by blogctl redirects sync from data/redirects.toml",
+	}
+	if err := c.do(ctx, http.MethodPost, base, body, &l); err != nil {
+		return "", err
+	}
+	return l.ID, nil
+}
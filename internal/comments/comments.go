@@ -0,0 +1,139 @@
+// Package comments collects the fediverse replies to a post's announcement
+// and stores them as sanitized JSON under data/comments/, so the site can
+// render comments statically instead of calling third-party APIs from the
+// reader's browser.
+package comments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultDir is where comment files are written, one per post slug, which
+// templates read as site.Data.comments.
+const DefaultDir = "data/comments"
+
+// Author is who wrote a comment.
+type Author struct {
+	Name   string `json:"name"`
+	Handle string `json:"handle"`
+	URL    string `json:"url"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// Hosts returns the domains a's account lives on: its profile's and its
+// handle's, which is a Mastodon account's instance or a Bluesky handle
+// itself.
+func (a Author) Hosts() []string {
+	var hosts []string
+	if u, err := url.Parse(a.URL); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+	if _, h, ok := strings.Cut(strings.TrimPrefix(a.Handle, "@"), "@"); ok {
+		hosts = append(hosts, h)
+	} else if strings.Contains(a.Handle, ".") {
+		hosts = append(hosts, a.Handle)
+	}
+	return hosts
+}
+
+// Comment is one reply. ContentHTML is always sanitized.
+type Comment struct {
+	ID          string    `json:"id"`
+	Network     string    `json:"network"`
+	URL         string    `json:"url"`
+	Author      Author    `json:"author"`
+	Published   time.Time `json:"published"`
+	ContentHTML string    `json:"content_html"`
+	// InReplyTo is the ID of the parent comment, or empty for direct
+	// replies to the announcement.
+	InReplyTo string `json:"in_reply_to,omitempty"`
+}
+
+// Source fetches the replies to an announcement.
+type Source interface {
+	// Network names the network, matching the syndication record's key.
+	Network() string
+	Replies(ctx context.Context, uri, url string) ([]Comment, error)
+}
+
+// File is the JSON written for a post.
+type File struct {
+	// Threads links to the announcements, so readers can reply there.
+	Threads  map[string]string `json:"threads"`
+	Comments []Comment         `json:"comments"`
+}
+
+// Sort orders comments oldest first.
+func Sort(cs []Comment) {
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].Published.Before(cs[j].Published) })
+}
+
+// Write stores f as dir/<slug>.json, leaving the file alone if it's
+// unchanged. It reports whether the file was written.
+func Write(dir, slug string, f File) (bool, error) {
+	return fsutil.WriteJSONIfChanged(filepath.Join(dir, slug+".json"), f)
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "rednafi.com-comments (+https://rednafi.com)")
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("comments: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("comments: GET %s: %s", u, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("comments: decode %s: %w", u, err)
+	}
+	return nil
+}
+
+// Load reads a comment file written by Write.
+func Load(path string) (File, error) {
+	var f File
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return f, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Drop removes the comments drop reports, along with the replies to them,
+// and returns how many it removed. The comments must be sorted.
+func (f *File) Drop(drop func(Comment) bool) int {
+	gone := map[string]bool{}
+	kept := f.Comments[:0]
+	for _, c := range f.Comments {
+		if drop(c) || (c.InReplyTo != "" && gone[c.InReplyTo]) {
+			gone[c.ID] = true
+			continue
+		}
+		kept = append(kept, c)
+	}
+	f.Comments = kept
+	return len(gone)
+}
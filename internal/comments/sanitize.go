@@ -0,0 +1,145 @@
+package comments
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowed lists the tags kept in comment HTML. Everything else is dropped,
+// though the text inside is kept, except for the contents of dropTags.
+var allowed = map[string]bool{
+	"p": true, "br": true, "a": true, "strong": true, "b": true, "em": true,
+	"i": true, "code": true, "pre": true, "blockquote": true, "ul": true,
+	"ol": true, "li": true,
+}
+
+var dropTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true,
+	"embed": true, "template": true, "svg": true, "math": true,
+}
+
+// Sanitize reduces untrusted HTML to a small set of formatting tags. Links
+// keep only http(s) hrefs and get rel="nofollow noopener ugc"; all other
+// attributes are removed.
+func Sanitize(s string) string {
+	var b bytes.Buffer
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0 // depth inside a dropped element
+	var open []string
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if !errors.Is(z.Err(), io.EOF) {
+				return ""
+			}
+			break
+		}
+		tok := z.Token()
+		name := tok.Data
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if dropTags[name] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip > 0 || !allowed[name] {
+				continue
+			}
+			if name == "br" {
+				b.WriteString("<br>")
+				continue
+			}
+			b.WriteString("<" + name)
+			if name == "a" {
+				if href := safeHref(attr(tok, "href")); href != "" {
+					b.WriteString(` href="` + html.EscapeString(href) + `"`)
+				}
+				b.WriteString(` rel="nofollow noopener ugc"`)
+			}
+			b.WriteString(">")
+			if tt == html.SelfClosingTagToken {
+				b.WriteString("</" + name + ">")
+			} else {
+				open = append(open, name)
+			}
+		case html.EndTagToken:
+			if dropTags[name] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 || !allowed[name] || name == "br" {
+				continue
+			}
+			// Close only what's open, innermost first, so the output is
+			// always balanced.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					for _, n := range reverse(open[i:]) {
+						b.WriteString("</" + n + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(tok.Data))
+			}
+		}
+	}
+	for _, n := range reverse(open) {
+		b.WriteString("</" + n + ">")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// TextToHTML turns plain text into paragraphs, escaping it and linking
+// nothing; Bluesky replies are plain text.
+func TextToHTML(s string) string {
+	var b strings.Builder
+	for _, para := range strings.Split(strings.TrimSpace(s), "\n\n") {
+		if para = strings.TrimSpace(para); para == "" {
+			continue
+		}
+		lines := strings.Split(para, "\n")
+		for i, l := range lines {
+			lines[i] = html.EscapeString(l)
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>") + "</p>")
+	}
+	return b.String()
+}
+
+func attr(t html.Token, key string) string {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func safeHref(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func reverse(s []string) []string {
+	out := make([]string, len(s))
+	for i, v := range s {
+		out[len(s)-1-i] = v
+	}
+	return out
+}
@@ -0,0 +1,157 @@
+package comments
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// Mastodon reads replies through the public Mastodon API of the instance
+// the announcement lives on. No token is needed for public statuses.
+type Mastodon struct {
+	HTTP *http.Client
+}
+
+// Network implements Source.
+func (m *Mastodon) Network() string { return "mastodon" }
+
+// Replies implements Source. statusURL is the announcement's web URL, e.g.
+// https://fosstodon.org/@rednafi/110000000000000000, whose last segment is
+// the status ID on that instance.
+func (m *Mastodon) Replies(ctx context.Context, _, statusURL string) ([]Comment, error) {
+	u, err := url.Parse(statusURL)
+	if err != nil {
+		return nil, err
+	}
+	root := path.Base(u.Path)
+	api := u.Scheme + "://" + u.Host + "/api/v1/statuses/" + url.PathEscape(root) + "/context"
+
+	var thread struct {
+		Descendants []struct {
+			ID          string    `json:"id"`
+			InReplyToID string    `json:"in_reply_to_id"`
+			CreatedAt   time.Time `json:"created_at"`
+			URL         string    `json:"url"`
+			Content     string    `json:"content"`
+			Visibility  string    `json:"visibility"`
+			Account     struct {
+				Acct        string `json:"acct"`
+				DisplayName string `json:"display_name"`
+				URL         string `json:"url"`
+				Avatar      string `json:"avatar_static"`
+			} `json:"account"`
+		} `json:"descendants"`
+	}
+	if err := getJSON(ctx, m.HTTP, api, &thread); err != nil {
+		return nil, err
+	}
+	var out []Comment
+	for _, s := range thread.Descendants {
+		if s.Visibility != "public" && s.Visibility != "unlisted" {
+			continue
+		}
+		c := Comment{
+			ID:      "mastodon:" + s.ID,
+			Network: m.Network(),
+			URL:     s.URL,
+			Author: Author{
+				Name:   s.Account.DisplayName,
+				Handle: "@" + s.Account.Acct,
+				URL:    s.Account.URL,
+				Avatar: s.Account.Avatar,
+			},
+			Published:   s.CreatedAt,
+			ContentHTML: Sanitize(s.Content),
+		}
+		if s.InReplyToID != root {
+			c.InReplyTo = "mastodon:" + s.InReplyToID
+		}
+		if c.Author.Name == "" {
+			c.Author.Name = s.Account.Acct
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// Bluesky reads reply threads from the public Bluesky AppView.
+type Bluesky struct {
+	HTTP *http.Client
+	// AppView defaults to https://public.api.bsky.app.
+	AppView string
+}
+
+// Network implements Source.
+func (b *Bluesky) Network() string { return "bluesky" }
+
+type bskyThread struct {
+	Post struct {
+		URI    string `json:"uri"`
+		Author struct {
+			Handle      string `json:"handle"`
+			DisplayName string `json:"displayName"`
+			Avatar      string `json:"avatar"`
+		} `json:"author"`
+		Record struct {
+			Text      string    `json:"text"`
+			CreatedAt time.Time `json:"createdAt"`
+		} `json:"record"`
+	} `json:"post"`
+	Replies []bskyThread `json:"replies"`
+}
+
+// Replies implements Source. uri is the announcement's at:// URI.
+func (b *Bluesky) Replies(ctx context.Context, uri, _ string) ([]Comment, error) {
+	appView := b.AppView
+	if appView == "" {
+		appView = "https://public.api.bsky.app"
+	}
+	q := url.Values{"uri": {uri}, "depth": {"20"}, "parentHeight": {"0"}}
+	var resp struct {
+		Thread bskyThread `json:"thread"`
+	}
+	if err := getJSON(ctx, b.HTTP, appView+"/xrpc/app.bsky.feed.getPostThread?"+q.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	var out []Comment
+	var walk func(t bskyThread, parent string)
+	walk = func(t bskyThread, parent string) {
+		for _, r := range t.Replies {
+			// Blocked and deleted replies come back without a post.
+			if r.Post.URI == "" {
+				continue
+			}
+			p := r.Post
+			c := Comment{
+				ID:      "bluesky:" + p.URI,
+				Network: b.Network(),
+				URL:     bskyWebURL(p.Author.Handle, p.URI),
+				Author: Author{
+					Name:   p.Author.DisplayName,
+					Handle: "@" + p.Author.Handle,
+					URL:    "https://bsky.app/profile/" + p.Author.Handle,
+					Avatar: p.Author.Avatar,
+				},
+				Published:   p.Record.CreatedAt,
+				ContentHTML: TextToHTML(p.Record.Text),
+				InReplyTo:   parent,
+			}
+			if c.Author.Name == "" {
+				c.Author.Name = p.Author.Handle
+			}
+			out = append(out, c)
+			walk(r, c.ID)
+		}
+	}
+	walk(resp.Thread, "")
+	return out, nil
+}
+
+// bskyWebURL turns at://<did>/app.bsky.feed.post/<rkey> into the post's
+// bsky.app page.
+func bskyWebURL(handle, uri string) string {
+	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", handle, path.Base(uri))
+}
@@ -0,0 +1,229 @@
+// Package complete answers the site's search-as-you-type quick-nav from a
+// trie of the posts' titles, tags, and headings, built in memory once, so
+// visitors get a few ranked links without loading the full search index.
+//
+// Every phrase is keyed from each of its words, so a query matches a
+// prefix of any word and the ones after it: "cancel" finds "Go context
+// cancellation". Each node of the trie keeps its best completions, ranked
+// when it's built, so a lookup walks the query's characters and copies a
+// short list, however many phrases share the prefix.
+package complete
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/toc"
+)
+
+// DefaultTop is how many completions each node keeps, and so the most a
+// lookup returns.
+const DefaultTop = 10
+
+// Kind is what a completion links to.
+type Kind string
+
+const (
+	Post    Kind = "post"
+	Tag     Kind = "tag"
+	Heading Kind = "heading"
+)
+
+// kindRank ranks tags, which gather posts, above posts above headings.
+var kindRank = map[Kind]int{Tag: 0, Post: 1, Heading: 2}
+
+// midRank is added to the rank of a phrase the query matches from a word
+// other than its first, so that a match from the start goes one kind up.
+const midRank = 2
+
+// Completion is a phrase a query may complete to.
+type Completion struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+	Kind Kind   `json:"kind"`
+	// Post is the title of the post a heading is in.
+	Post string `json:"post,omitempty"`
+
+	// posts is a tag's number of posts, and date a post's or heading's
+	// post's date, to rank it among its kind.
+	posts int
+	date  time.Time
+}
+
+// Index is the trie. It's read-only once built, so any number of lookups
+// may run at once.
+type Index struct {
+	all  []Completion
+	root *node
+	top  int
+}
+
+type node struct {
+	// next is sorted by rune.
+	next []edge
+	// hits are the phrases keyed exactly to this node, and top the best
+	// completions under it.
+	hits []hit
+	top  []hit
+}
+
+type edge struct {
+	r rune
+	n *node
+}
+
+type hit struct {
+	i     int32
+	start bool
+}
+
+// Build indexes the published posts' titles, the tags they use, and the
+// headings each lists in its table of contents. Notes have no title and
+// are left out. top is how many completions each node keeps.
+func Build(posts []*content.Post, top int) *Index {
+	x := &Index{root: &node{}, top: max(top, 1)}
+	tags := map[string]int{}
+	var order []string
+	for _, p := range content.Published(posts) {
+		if p.IsNote() || p.Title == "" {
+			continue
+		}
+		u := p.RelPermalink()
+		x.add(Completion{Text: p.Title, URL: u, Kind: Post, date: p.Date})
+		for _, t := range p.Tags {
+			if _, ok := tags[t]; !ok {
+				order = append(order, t)
+			}
+			tags[t]++
+		}
+		d, err := toc.DepthOf(p)
+		if err != nil {
+			d = toc.Depth{Min: toc.DefaultMin, Max: toc.DefaultMax}
+		}
+		for _, h := range markdown.Parse([]byte(p.Body), p.BodyLine).Headings() {
+			if h.ID == "" || h.Level < d.Min || h.Level > d.Max {
+				continue
+			}
+			x.add(Completion{Text: h.Text, URL: u + "#" + h.ID, Kind: Heading, Post: p.Title, date: p.Date})
+		}
+	}
+	for _, t := range order {
+		x.add(Completion{Text: t, URL: "/tags/" + content.TagSlug(t) + "/", Kind: Tag, posts: tags[t]})
+	}
+	x.rank(x.root)
+	return x
+}
+
+// Len returns the number of phrases indexed.
+func (x *Index) Len() int { return len(x.all) }
+
+// add keys c from each of its words.
+func (x *Index) add(c Completion) {
+	words := Normalize(c.Text)
+	if len(words) == 0 {
+		return
+	}
+	i := int32(len(x.all))
+	x.all = append(x.all, c)
+	for off := 0; ; {
+		n := x.root
+		for _, r := range words[off:] {
+			n = n.child(r)
+		}
+		n.hits = append(n.hits, hit{i, off == 0})
+		next := strings.IndexByte(words[off:], ' ')
+		if next < 0 {
+			return
+		}
+		off += next + 1
+	}
+}
+
+func (n *node) child(r rune) *node {
+	i, ok := slices.BinarySearchFunc(n.next, r, byRune)
+	if !ok {
+		n.next = slices.Insert(n.next, i, edge{r, &node{}})
+	}
+	return n.next[i].n
+}
+
+func byRune(e edge, r rune) int { return cmp.Compare(e.r, r) }
+
+// rank fills in the top completions of n and every node under it. The
+// best of a subtree are among its own hits and its children's best, so
+// each node merges just those.
+func (x *Index) rank(n *node) []hit {
+	best := map[int32]bool{}
+	for _, h := range n.hits {
+		best[h.i] = best[h.i] || h.start
+	}
+	for _, e := range n.next {
+		for _, h := range x.rank(e.n) {
+			best[h.i] = best[h.i] || h.start
+		}
+	}
+	n.top = make([]hit, 0, len(best))
+	for i, start := range best {
+		n.top = append(n.top, hit{i, start})
+	}
+	slices.SortFunc(n.top, x.compare)
+	n.top = slices.Clip(n.top[:min(len(n.top), x.top)])
+	n.hits = nil
+	return n.top
+}
+
+// compare orders better completions first: by kind and whether they're
+// matched from the start, then more posts for a tag, then newer, then
+// shorter.
+func (x *Index) compare(a, b hit) int {
+	ca, cb := &x.all[a.i], &x.all[b.i]
+	rank := func(h hit, c *Completion) int {
+		if h.start {
+			return kindRank[c.Kind]
+		}
+		return kindRank[c.Kind] + midRank
+	}
+	return cmp.Or(
+		cmp.Compare(rank(a, ca), rank(b, cb)),
+		cmp.Compare(cb.posts, ca.posts),
+		cb.date.Compare(ca.date),
+		cmp.Compare(len(ca.Text), len(cb.Text)),
+		cmp.Compare(ca.Text, cb.Text),
+		cmp.Compare(a.i, b.i),
+	)
+}
+
+// Lookup returns up to n completions of q, best first.
+func (x *Index) Lookup(q string, n int) []Completion {
+	q = Normalize(q)
+	if q == "" || n <= 0 {
+		return nil
+	}
+	at := x.root
+	for _, r := range q {
+		i, ok := slices.BinarySearchFunc(at.next, r, byRune)
+		if !ok {
+			return nil
+		}
+		at = at.next[i].n
+	}
+	top := at.top[:min(n, len(at.top))]
+	out := make([]Completion, 0, len(top))
+	for _, h := range top {
+		out = append(out, x.all[h.i])
+	}
+	return out
+}
+
+// Normalize lowercases s and reduces everything but letters and digits to
+// single spaces between words, the way phrases are keyed.
+func Normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
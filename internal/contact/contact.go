@@ -0,0 +1,128 @@
+// Package contact validates the site's contact form and mails the messages
+// to the author over SMTP or the Mailgun API.
+package contact
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Honeypot is the form field that stays empty for people. It is hidden
+// from them, but bots filling in every field set it.
+const Honeypot = "website"
+
+// Limits on the form's fields, in characters.
+const (
+	MaxName    = 100
+	MaxSubject = 200
+	MinBody    = 10
+	MaxBody    = 5000
+)
+
+// Message is a validated contact form submission.
+type Message struct {
+	Name    string
+	Email   string
+	Subject string
+	Body    string
+	// Page is where the form was sent from, if the form says.
+	Page string
+	Sent time.Time
+}
+
+// FieldErrors maps a form field to what's wrong with it, for the form to
+// show next to the field.
+type FieldErrors map[string]string
+
+// Parse validates a submitted form. The honeypot isn't checked here; see
+// Spam.
+func Parse(form url.Values, now time.Time) (Message, FieldErrors) {
+	m := Message{
+		Name:    clean(form.Get("name")),
+		Email:   strings.TrimSpace(form.Get("email")),
+		Subject: clean(form.Get("subject")),
+		Body:    strings.TrimSpace(strings.ReplaceAll(form.Get("message"), "\r\n", "\n")),
+		Page:    strings.TrimSpace(form.Get("page")),
+		Sent:    now,
+	}
+	errs := FieldErrors{}
+	switch n := utf8.RuneCountInString(m.Name); {
+	case n == 0:
+		errs["name"] = "is required"
+	case n > MaxName:
+		errs["name"] = "is too long"
+	}
+	if m.Email == "" {
+		errs["email"] = "is required"
+	} else if a, err := mail.ParseAddress(m.Email); err != nil || a.Address != m.Email || strings.ContainsAny(m.Email, "\r\n") {
+		errs["email"] = "isn't an email address"
+	}
+	if utf8.RuneCountInString(m.Subject) > MaxSubject {
+		errs["subject"] = "is too long"
+	}
+	switch n := utf8.RuneCountInString(m.Body); {
+	case n == 0:
+		errs["message"] = "is required"
+	case n < MinBody:
+		errs["message"] = "is too short"
+	case n > MaxBody:
+		errs["message"] = "is too long"
+	}
+	if m.Page != "" {
+		if u, err := url.Parse(m.Page); err != nil || u.Scheme != "https" && u.Scheme != "http" {
+			m.Page = ""
+		}
+	}
+	if len(errs) > 0 {
+		return m, errs
+	}
+	return m, nil
+}
+
+// Spam reports whether the form filled the honeypot.
+func Spam(form url.Values) bool { return form.Get(Honeypot) != "" }
+
+// clean trims s and folds its whitespace, newlines included, so it can go
+// in a mail header.
+func clean(s string) string { return strings.Join(strings.Fields(s), " ") }
+
+// MailSubject is the subject line the author receives.
+func (m Message) MailSubject() string {
+	if m.Subject == "" {
+		return "Contact form: message from " + m.Name
+	}
+	return "Contact form: " + m.Subject
+}
+
+//go:embed message.html
+var messageHTML string
+
+var messageTmpl = template.Must(template.New("message").Parse(messageHTML))
+
+// HTML renders the message as the email's HTML part.
+func (m Message) HTML() (string, error) {
+	var b bytes.Buffer
+	if err := messageTmpl.Execute(&b, m); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Text renders the message as the email's plain text part.
+func (m Message) Text() string {
+	var b strings.Builder
+	b.WriteString("From: " + m.Name + " <" + m.Email + ">\n")
+	if m.Page != "" {
+		b.WriteString("Page: " + m.Page + "\n")
+	}
+	b.WriteString("Sent: " + m.Sent.UTC().Format(time.RFC1123) + "\n\n")
+	b.WriteString(m.Body)
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,203 @@
+package contact
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Mailer delivers a message to the author. The sender's address goes in
+// Reply-To, so replying answers them; it's never the From, which the
+// mail provider has to vouch for.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// FromEnv configures the Mailer named by via, "smtp" or "mailgun", from the
+// environment. Both read CONTACT_FROM, the address messages come from, and
+// CONTACT_TO, the author's.
+func FromEnv(via string) (Mailer, error) {
+	from, to := os.Getenv("CONTACT_FROM"), os.Getenv("CONTACT_TO")
+	if from == "" || to == "" {
+		return nil, errors.New("contact: CONTACT_FROM and CONTACT_TO must be set")
+	}
+	switch via {
+	case "smtp":
+		s := &SMTP{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+			To:       to,
+		}
+		if s.Addr == "" {
+			return nil, errors.New("contact: SMTP_ADDR must be set")
+		}
+		return s, nil
+	case "mailgun":
+		mg := &Mailgun{
+			APIKey:   os.Getenv("MAILGUN_API_KEY"),
+			Domain:   os.Getenv("MAILGUN_DOMAIN"),
+			Endpoint: os.Getenv("MAILGUN_ENDPOINT"),
+			From:     from,
+			To:       to,
+		}
+		if mg.APIKey == "" || mg.Domain == "" {
+			return nil, errors.New("contact: MAILGUN_API_KEY and MAILGUN_DOMAIN must be set")
+		}
+		return mg, nil
+	default:
+		return nil, fmt.Errorf("contact: unknown mailer %q", via)
+	}
+}
+
+// SMTP mails messages as multipart/alternative HTML and plain text.
+type SMTP struct {
+	// Addr is host:port. STARTTLS is used when the server offers it.
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       string
+}
+
+// Send implements Mailer.
+func (s *SMTP) Send(_ context.Context, m Message) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("contact: smtp: %w", err)
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	msg, err := s.message(m)
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{s.To}, msg); err != nil {
+		return fmt.Errorf("contact: smtp: %w", err)
+	}
+	return nil
+}
+
+func (s *SMTP) message(m Message) ([]byte, error) {
+	html, err := m.HTML()
+	if err != nil {
+		return nil, err
+	}
+	var rnd [12]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return nil, err
+	}
+	boundary := "contact-" + hex.EncodeToString(rnd[:])
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", s.To)
+	fmt.Fprintf(&b, "Reply-To: %s\r\n", replyTo(m))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.MailSubject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", m.Sent.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ typ, body string }{
+		{"text/plain", m.Text()},
+		{"text/html", html},
+	} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=utf-8\r\n", part.typ)
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		w := quotedprintable.NewWriter(&b)
+		if _, err := w.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// replyTo formats the sender as an address header, encoding the name.
+func replyTo(m Message) string {
+	return (&mail.Address{Name: m.Name, Address: m.Email}).String()
+}
+
+// Mailgun sends messages through Mailgun's HTTP API.
+type Mailgun struct {
+	HTTP   *http.Client
+	APIKey string
+	Domain string
+	// Endpoint defaults to https://api.mailgun.net; EU domains use
+	// https://api.eu.mailgun.net.
+	Endpoint string
+	From     string
+	To       string
+}
+
+// Send implements Mailer.
+func (mg *Mailgun) Send(ctx context.Context, m Message) error {
+	html, err := m.HTML()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, f := range [][2]string{
+		{"from", mg.From},
+		{"to", mg.To},
+		{"h:Reply-To", replyTo(m)},
+		{"subject", m.MailSubject()},
+		{"text", m.Text()},
+		{"html", html},
+	} {
+		if err := w.WriteField(f[0], f[1]); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	endpoint := mg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.mailgun.net"
+	}
+	u := strings.TrimSuffix(endpoint, "/") + "/v3/" + mg.Domain + "/messages"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.SetBasicAuth("api", mg.APIKey)
+	client := mg.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("contact: mailgun: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("contact: mailgun: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+// Package content loads the markdown posts under content/ and parses their
+// front matter the same way Hugo does, so the Go tooling and the site agree
+// on titles, dates, slugs, and URLs.
+package content
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is the default location of the site's content, relative to the repo
+// root.
+const Dir = "content"
+
+// NotesSection is the section of notes: short posts without a title that
+// get their own feed and stay out of the article tooling.
+const NotesSection = "notes"
+
+// DefaultLanguage is config.yml's defaultContentLanguage: posts in it
+// have no language suffix in their file name and no prefix in their URL.
+// `blogctl lint translations` checks the two agree.
+const DefaultLanguage = "en"
+
+// FrontMatter holds the front matter keys the tooling cares about. Unknown
+// keys are kept in Params.
+type FrontMatter struct {
+	Title   string
+	Date    time.Time
+	Lastmod time.Time
+	// PublishDate is when a scheduled draft goes live; see cmd/scheduler.
+	PublishDate time.Time
+	Tags        []string
+	URL         string
+	Draft       bool
+	Summary     string
+	Description string
+	Layout      string
+	// Series names the series the post is part of, and Part its place in
+	// it, counting from 1; see internal/series.
+	Series string
+	Part   int
+	// TranslationKey links a post to its translations. It defaults to the
+	// file's path without the language suffix, so python/pathlib.md and
+	// python/pathlib.bn.md are translations of each other.
+	TranslationKey string
+
+	// Params holds every key from the front matter, lowercased, including
+	// the ones decoded into the fields above.
+	Params map[string]any
+}
+
+// Post is a single markdown file under a content section.
+type Post struct {
+	FrontMatter
+
+	// Path is the file path relative to the content directory, using
+	// forward slashes, e.g. "python/pathlib.md".
+	Path string
+	// Section is the top-level directory the post lives in.
+	Section string
+	// Lang is the language in the file name, as bn in pathlib.bn.md, or
+	// "" for DefaultLanguage.
+	Lang string
+	// Slug is the last segment of the post's URL.
+	Slug string
+	// Body is the markdown following the front matter.
+	Body string
+	// BodyLine is the 1-based line number in the file where Body starts.
+	BodyLine int
+}
+
+// Updated returns the post's lastmod, falling back to its date.
+func (p *Post) Updated() time.Time {
+	if p.Lastmod.After(p.Date) {
+		return p.Lastmod
+	}
+	return p.Date
+}
+
+// IsNote reports whether the post is a note rather than an article.
+func (p *Post) IsNote() bool {
+	return p.Section == NotesSection
+}
+
+// RelPermalink returns the post's URL path, e.g. "/python/pathlib/", or
+// "/bn/python/pathlib/" for a translation into bn.
+func (p *Post) RelPermalink() string {
+	if p.URL != "" {
+		return p.URL
+	}
+	return "/" + strings.ToLower(path.Join(p.Lang, p.Section, p.Slug)) + "/"
+}
+
+// DataKey returns the key of p's entries in the data files blogctl writes
+// for the templates, like data/readtime.json: its slug, after its language
+// and a slash for a translation, as in bn/pathlib, so translations don't
+// share one. layouts/partials/datakey.html makes the same key of a page.
+func (p *Post) DataKey() string {
+	if p.Lang == "" {
+		return p.Slug
+	}
+	return p.Lang + "/" + p.Slug
+}
+
+// LangOrDefault returns p's language, DefaultLanguage included.
+func (p *Post) LangOrDefault() string {
+	if p.Lang == "" {
+		return DefaultLanguage
+	}
+	return p.Lang
+}
+
+// TagSlug returns the URL segment Hugo uses for a tag's term page, as in
+// /tags/<slug>/.
+func TagSlug(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), " ", "-"))
+}
+
+// Files returns the paths, relative to dir and with forward slashes, of
+// the post files under dir. Files at the root of dir (standalone pages like
+// search and archives) and section _index.md files are skipped.
+func Files(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".md" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !strings.Contains(rel, "/") || path.Base(rel) == "_index.md" {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// Load parses every post under dir, as listed by Files. Drafts are
+// included; use Published to drop them. Posts are sorted newest first.
+func Load(dir string) ([]*Post, error) {
+	files, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	var posts []*Post
+	for _, rel := range files {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		post, err := Parse(rel, b)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		if !posts[i].Date.Equal(posts[j].Date) {
+			return posts[i].Date.After(posts[j].Date)
+		}
+		return posts[i].Path < posts[j].Path
+	})
+	return posts, nil
+}
+
+// Published returns the posts that aren't drafts.
+func Published(posts []*Post) []*Post {
+	var out []*Post
+	for _, p := range posts {
+		if !p.Draft {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Articles returns the posts that aren't notes.
+func Articles(posts []*Post) []*Post {
+	var out []*Post
+	for _, p := range posts {
+		if !p.IsNote() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Notes returns the posts that are notes.
+func Notes(posts []*Post) []*Post {
+	var out []*Post
+	for _, p := range posts {
+		if p.IsNote() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// langRe matches a language suffix in a file name, as bn in pathlib.bn.md
+// or pt-br in pathlib.pt-br.md.
+var langRe = regexp.MustCompile(`^(.+)\.([a-z]{2,3}(?:-[a-z0-9]+)?)\.md$`)
+
+// SplitLang splits the language suffix off a post's file name, as
+// pathlib.bn.md into pathlib and bn. lang is "" without a suffix or for
+// DefaultLanguage.
+func SplitLang(file string) (name, lang string) {
+	m := langRe.FindStringSubmatch(path.Base(file))
+	if m == nil {
+		return strings.TrimSuffix(path.Base(file), ".md"), ""
+	}
+	if m[2] == DefaultLanguage {
+		return m[1], ""
+	}
+	return m[1], m[2]
+}
+
+// Parse parses a markdown file with YAML or TOML front matter. rel is the
+// path relative to the content directory and determines the section and
+// slug.
+func Parse(rel string, b []byte) (*Post, error) {
+	fm, format, body, line, err := SplitFrontMatter(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	raw := map[string]any{}
+	switch format {
+	case TOML:
+		err = toml.Unmarshal(fm, &raw)
+	default:
+		err = yaml.Unmarshal(fm, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: front matter: %w", rel, err)
+	}
+	params := make(map[string]any, len(raw))
+	for k, v := range raw {
+		params[strings.ToLower(k)] = v
+	}
+
+	post := &Post{
+		Path:     rel,
+		Section:  strings.SplitN(rel, "/", 2)[0],
+		Body:     string(body),
+		BodyLine: line,
+	}
+	post.Params = params
+	post.Title = stringParam(params, "title")
+	post.Slug = stringParam(params, "slug")
+	post.URL = stringParam(params, "url")
+	post.Summary = stringParam(params, "summary")
+	post.Description = stringParam(params, "description")
+	post.Layout = stringParam(params, "layout")
+	post.Draft, _ = params["draft"].(bool)
+	post.Tags = stringsParam(params, "tags")
+	post.Series = stringParam(params, "series")
+	post.Part = intParam(params, "part")
+	post.TranslationKey = stringParam(params, "translationkey")
+
+	name, lang := SplitLang(rel)
+	post.Lang = lang
+	if post.Slug == "" {
+		post.Slug = name
+	}
+	if post.TranslationKey == "" {
+		post.TranslationKey = path.Join(path.Dir(rel), name)
+	}
+	if v, ok := params["date"]; ok {
+		d, err := parseDate(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rel, err)
+		}
+		post.Date = d
+	}
+	if v, ok := params["lastmod"]; ok {
+		d, err := parseDate(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: lastmod: %w", rel, err)
+		}
+		post.Lastmod = d
+	}
+	if v, ok := params["publishdate"]; ok {
+		d, err := parseDate(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: publishDate: %w", rel, err)
+		}
+		post.PublishDate = d
+	}
+	return post, nil
+}
+
+// Front matter formats, as returned by SplitFrontMatter.
+const (
+	YAML = "yaml"
+	TOML = "toml"
+)
+
+// SplitFrontMatter separates the front matter between the leading "---"
+// (YAML) or "+++" (TOML) fences from the rest of the file. It also returns
+// the format, "" if there's no front matter, and the line number where the
+// body starts.
+func SplitFrontMatter(b []byte) (fm []byte, format string, body []byte, line int, err error) {
+	b = bytes.TrimPrefix(b, []byte("\ufeff"))
+	var fence string
+	switch {
+	case bytes.HasPrefix(b, []byte("---")):
+		fence, format = "---", YAML
+	case bytes.HasPrefix(b, []byte("+++")):
+		fence, format = "+++", TOML
+	default:
+		return nil, "", b, 1, nil
+	}
+	rest := b[len(fence):]
+	nl := bytes.IndexByte(rest, '\n')
+	if nl < 0 || len(bytes.TrimSpace(rest[:nl])) != 0 {
+		return nil, "", b, 1, nil
+	}
+	rest = rest[nl+1:]
+	line = 1
+	for off := 0; off < len(rest); {
+		end := bytes.IndexByte(rest[off:], '\n')
+		var l []byte
+		if end < 0 {
+			l = rest[off:]
+			end = len(rest) - off
+		} else {
+			l = rest[off : off+end]
+		}
+		line++
+		if string(bytes.TrimRight(l, " \t\r")) == fence {
+			next := off + end + 1
+			if next > len(rest) {
+				next = len(rest)
+			}
+			return rest[:off], format, rest[next:], line + 1, nil
+		}
+		off += end + 1
+	}
+	return nil, format, nil, 0, errors.New("unterminated front matter")
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.RFC1123,
+	time.RFC1123Z,
+}
+
+// parseDate accepts the date formats that show up across the posts: plain
+// dates, RFC 3339 timestamps, and RFC 1123 strings.
+func parseDate(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		v = strings.TrimSpace(v)
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognized date %q", v)
+	default:
+		return time.Time{}, fmt.Errorf("unrecognized date %v", v)
+	}
+}
+
+func stringParam(params map[string]any, key string) string {
+	switch v := params[key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func intParam(params map[string]any, key string) int {
+	switch v := params[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+func stringsParam(params map[string]any, key string) []string {
+	switch v := params[key].(type) {
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			out = append(out, fmt.Sprint(s))
+		}
+		return out
+	case string:
+		return []string{v}
+	default:
+		return nil
+	}
+}
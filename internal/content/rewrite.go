@@ -0,0 +1,289 @@
+package content
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlItemRe matches a block list item and captures everything before its
+// value, so rewritten items keep the post's indentation.
+var yamlItemRe = regexp.MustCompile(`^(\s*-\s+)`)
+
+// SetList sets the top-level list key in the front matter of the post file
+// b to values, leaving every other byte of the file as it was. A YAML block
+// list stays a block list with the same indentation and a flow list stays
+// a flow list. A missing key is added at the end of the front matter, and
+// an empty values removes the key.
+func SetList(b []byte, key string, values []string) ([]byte, error) {
+	fm, format, _, _, err := SplitFrontMatter(b)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		return b, nil
+	}
+	// fm is a sub-slice of b, so their capacities give its offset.
+	start := cap(b) - cap(fm)
+	lines := strings.SplitAfter(string(fm), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var from, to int
+	var repl string
+	switch format {
+	case YAML:
+		from, to, repl = yamlSpan(lines, key, values)
+	case TOML:
+		from, to, repl = tomlSpan(lines, key, values)
+	}
+	if len(values) == 0 {
+		repl = ""
+	}
+	if from < 0 && len(values) == 0 {
+		return b, nil
+	}
+	off := start
+	for _, l := range lines[:from] {
+		off += len(l)
+	}
+	end := off
+	for _, l := range lines[from:to] {
+		end += len(l)
+	}
+	var out bytes.Buffer
+	out.Grow(len(b) + len(repl))
+	out.Write(b[:off])
+	out.WriteString(repl)
+	out.Write(b[end:])
+	return out.Bytes(), nil
+}
+
+// SetString sets the top-level string key in the front matter of the post
+// file b to value, the way SetList sets a list: in place, quoted only when
+// it has to be, and added at the end of the front matter when it's missing.
+// An empty value removes the key.
+func SetString(b []byte, key, value string) ([]byte, error) {
+	fm, format, _, _, err := SplitFrontMatter(b)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		return b, nil
+	}
+	start := cap(b) - cap(fm)
+	lines := strings.SplitAfter(string(fm), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var from, to int
+	var repl string
+	switch format {
+	case YAML:
+		from, to, repl = yamlScalarSpan(lines, key, value)
+	case TOML:
+		from, to, repl = tomlScalarSpan(lines, key, value)
+	}
+	if value == "" {
+		repl = ""
+	}
+	off := start
+	for _, l := range lines[:from] {
+		off += len(l)
+	}
+	end := off
+	for _, l := range lines[from:to] {
+		end += len(l)
+	}
+	var out bytes.Buffer
+	out.Grow(len(b) + len(repl))
+	out.Write(b[:off])
+	out.WriteString(repl)
+	out.Write(b[end:])
+	return out.Bytes(), nil
+}
+
+// yamlScalarSpan is yamlSpan for a string, which may continue on indented
+// lines when it's folded or a block scalar.
+func yamlScalarSpan(lines []string, key, value string) (from, to int, repl string) {
+	keyRe := regexp.MustCompile(`^(?i:` + regexp.QuoteMeta(key) + `)\s*:`)
+	for i, l := range lines {
+		if !keyRe.MatchString(l) {
+			continue
+		}
+		to = i + 1
+		for to < len(lines) && (strings.HasPrefix(lines[to], " ") || strings.HasPrefix(lines[to], "\t")) {
+			to++
+		}
+		for to > i+1 && strings.TrimSpace(lines[to-1]) == "" {
+			to--
+		}
+		return i, to, l[:strings.IndexByte(l, ':')+1] + " " + yamlScalar(value) + "\n"
+	}
+	n := len(lines)
+	for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+		n--
+	}
+	return n, n, key + ": " + yamlScalar(value) + "\n"
+}
+
+// tomlScalarSpan is tomlSpan for a string on a single line.
+func tomlScalarSpan(lines []string, key, value string) (from, to int, repl string) {
+	keyRe := regexp.MustCompile(`^(?i:` + regexp.QuoteMeta(key) + `)\s*=`)
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "[") {
+			n := i
+			for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+				n--
+			}
+			return n, n, key + " = " + strconv.Quote(value) + "\n"
+		}
+		if loc := keyRe.FindStringIndex(l); loc != nil {
+			return i, i + 1, l[:loc[1]] + " " + strconv.Quote(value) + "\n"
+		}
+	}
+	n := len(lines)
+	for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+		n--
+	}
+	return n, n, key + " = " + strconv.Quote(value) + "\n"
+}
+
+// yamlSpan finds the lines [from, to) holding the top-level key and its
+// list, and returns what to put in their place. A missing key is an empty
+// span at the end of the front matter.
+func yamlSpan(lines []string, key string, values []string) (from, to int, repl string) {
+	keyRe := regexp.MustCompile(`^(?i:` + regexp.QuoteMeta(key) + `)\s*:(.*)$`)
+	for i, l := range lines {
+		m := keyRe.FindStringSubmatch(strings.TrimRight(l, "\r\n"))
+		if m == nil {
+			continue
+		}
+		k := l[:strings.IndexByte(l, ':')+1]
+		if v := strings.TrimSpace(m[1]); v != "" && !strings.HasPrefix(v, "#") {
+			// key: [a, b] or key: a on a single line.
+			return i, i + 1, k + " " + yamlFlow(values) + "\n"
+		}
+		to = i + 1
+		prefix := "    - "
+		for to < len(lines) {
+			item := strings.TrimRight(lines[to], "\r\n")
+			if p := yamlItemRe.FindString(item); p != "" {
+				if to == i+1 {
+					prefix = p
+				}
+			} else if strings.TrimSpace(item) != "" && !strings.HasPrefix(item, " ") && !strings.HasPrefix(item, "\t") {
+				break
+			}
+			to++
+		}
+		// Blank lines between the list and the next key belong to the
+		// layout, not the list.
+		for to > i+1 && strings.TrimSpace(lines[to-1]) == "" {
+			to--
+		}
+		return i, to, yamlBlock(k, prefix, values)
+	}
+	// Add the key after the last non-blank line.
+	n := len(lines)
+	for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+		n--
+	}
+	return n, n, yamlBlock(key+":", "    - ", values)
+}
+
+func yamlBlock(key, prefix string, values []string) string {
+	var sb strings.Builder
+	sb.WriteString(key + "\n")
+	for _, v := range values {
+		sb.WriteString(prefix + yamlScalar(v) + "\n")
+	}
+	return sb.String()
+}
+
+// tomlSpan is yamlSpan for TOML, where the array may span several lines.
+// A missing key is added before the first table, since keys after a table
+// header belong to the table.
+func tomlSpan(lines []string, key string, values []string) (from, to int, repl string) {
+	keyRe := regexp.MustCompile(`^(?i:` + regexp.QuoteMeta(key) + `)\s*=`)
+	quoted := make([]string, len(values))
+	for j, v := range values {
+		quoted[j] = strconv.Quote(v)
+	}
+	array := "[" + strings.Join(quoted, ", ") + "]\n"
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "[") {
+			n := i
+			for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+				n--
+			}
+			return n, n, key + " = " + array
+		}
+		loc := keyRe.FindStringIndex(l)
+		if loc == nil {
+			continue
+		}
+		// Find the line the array's closing bracket is on, skipping
+		// brackets inside strings.
+		depth, inStr := 0, byte(0)
+		for to = i; to < len(lines); to++ {
+			s := lines[to]
+			if to == i {
+				s = s[loc[1]:]
+			}
+			for j := 0; j < len(s); j++ {
+				switch c := s[j]; {
+				case inStr != 0:
+					if c == '\\' && inStr == '"' {
+						j++
+					} else if c == inStr {
+						inStr = 0
+					}
+				case c == '"' || c == '\'':
+					inStr = c
+				case c == '[':
+					depth++
+				case c == ']':
+					depth--
+				case c == '#':
+					j = len(s)
+				}
+			}
+			if depth <= 0 {
+				break
+			}
+		}
+		to = min(to+1, len(lines))
+		return i, to, l[:loc[1]] + " " + array
+	}
+	n := len(lines)
+	for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+		n--
+	}
+	return n, n, key + " = " + array
+}
+
+func yamlFlow(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = yamlScalar(v)
+		if strings.ContainsAny(quoted[i], ",[]{}") && !strings.HasPrefix(quoted[i], `"`) {
+			quoted[i] = strconv.Quote(v)
+		}
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// yamlScalar spells a value as YAML, quoting it only when it needs to be.
+func yamlScalar(v string) string {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return strconv.Quote(v)
+	}
+	return strings.TrimSuffix(string(b), "\n")
+}
@@ -0,0 +1,468 @@
+// Package critical inlines the CSS a page needs to render above the fold
+// into its <head> and defers the full stylesheets, so the first paint
+// doesn't wait on them. There's no browser to lay the page out, so "above
+// the fold" is the elements that come before a budget of text in document
+// order, matched with the stylesheets' selectors against the built DOM.
+// The critical CSS is worked out once per kind of page, home, post, and
+// list, from a sample of them, since each kind shares a template.
+package critical
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/rednafi/rednafi.com/internal/htmlcheck"
+)
+
+// Kinds of page, by template.
+const (
+	Home = "home"
+	Post = "post"
+	List = "list"
+)
+
+// StyleID marks the inlined critical CSS, so a page isn't processed twice.
+const StyleID = "critical-css"
+
+// KindOf returns the kind of the page doc served at urlPath: the home
+// page, a post, which PaperMod renders as article.post-single, or a list.
+func KindOf(urlPath string, doc *html.Node) string {
+	switch {
+	case urlPath == "/":
+		return Home
+	case find(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Article && hasClass(n, "post-single")
+	}) != nil:
+		return Post
+	}
+	return List
+}
+
+// Done reports whether doc already has its critical CSS inlined.
+func Done(doc *html.Node) bool {
+	return find(doc, func(n *html.Node) bool { return n.DataAtom == atom.Style && attr(n, "id") == StyleID }) != nil
+}
+
+// Stylesheets returns the <link rel=stylesheet> elements in doc.
+func Stylesheets(doc *html.Node) []*html.Node {
+	var out []*html.Node
+	walk(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Link && slices.Contains(strings.Fields(strings.ToLower(attr(n, "rel"))), "stylesheet") && attr(n, "href") != "" {
+			out = append(out, n)
+		}
+	})
+	return out
+}
+
+// AboveFold returns doc's <body> and the elements in it that come before
+// budget characters of text, counting an image, video, or iframe as 200.
+func AboveFold(doc *html.Node, budget int) []*html.Node {
+	body := find(doc, func(n *html.Node) bool { return n.DataAtom == atom.Body })
+	if body == nil {
+		return nil
+	}
+	var (
+		out  []*html.Node
+		seen int
+	)
+	var visit func(n *html.Node) bool
+	visit = func(n *html.Node) bool {
+		if seen > budget {
+			return false
+		}
+		switch n.Type {
+		case html.TextNode:
+			seen += len(strings.Join(strings.Fields(n.Data), " "))
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Template, atom.Noscript:
+				return true
+			case atom.Img, atom.Video, atom.Iframe, atom.Svg:
+				seen += 200
+			}
+			out = append(out, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if !visit(c) {
+				return false
+			}
+		}
+		return true
+	}
+	visit(body)
+	// The root matches selectors like :root and html.
+	for p := body.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		out = append(out, p)
+	}
+	return out
+}
+
+// rule is a CSS rule: a style rule, whose prelude is its selectors, an
+// at-rule with a block, whose rules are nested when it's conditional, or a
+// statement at-rule like @import, which has no block.
+type rule struct {
+	prelude string
+	block   string
+	nested  []rule
+	stmt    bool
+}
+
+// grouping are the at-rules whose blocks hold rules.
+var grouping = []string{"@media", "@supports", "@layer", "@container", "@document"}
+
+// parse splits a stylesheet into its top-level rules.
+func parse(s string) []rule {
+	var rules []rule
+	i := 0
+	for i < len(s) {
+		start := i
+		end, c := scan(s, i, "{;")
+		prelude := strings.TrimSpace(s[start:end])
+		if end >= len(s) {
+			break
+		}
+		if c == ';' {
+			rules = append(rules, rule{prelude: prelude, stmt: true})
+			i = end + 1
+			continue
+		}
+		close := matching(s, end)
+		r := rule{prelude: prelude, block: s[end+1 : close]}
+		for _, g := range grouping {
+			if strings.HasPrefix(strings.ToLower(prelude), g) {
+				r.nested = parse(r.block)
+				break
+			}
+		}
+		rules = append(rules, r)
+		i = close + 1
+	}
+	return rules
+}
+
+// scan returns the index of the first of stops in s from i, and which it
+// is, skipping comments, strings, and parentheses. It returns len(s) and 0
+// when there's none.
+func scan(s string, i int, stops string) (int, byte) {
+	depth := 0
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			if j := strings.Index(s[i+2:], "*/"); j >= 0 {
+				i += j + 4
+				continue
+			}
+			return len(s), 0
+		case c == '"' || c == '\'':
+			i++
+			for i < len(s) && s[i] != c {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.IndexByte(stops, c) >= 0:
+			return i, c
+		}
+		i++
+	}
+	return len(s), 0
+}
+
+// matching returns the index of the brace closing the one at open.
+func matching(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); {
+		j, c := scan(s, i, "{}")
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		default:
+			return len(s) - 1
+		}
+		i = j + 1
+	}
+	return len(s) - 1
+}
+
+// dynamicRe matches the pseudo-classes and pseudo-elements that depend on
+// state or generate content; the element they're on is what's matched.
+var dynamicRe = regexp.MustCompile(`::?(?:before|after|first-line|first-letter|placeholder|selection|marker|backdrop|file-selector-button|-webkit-[a-z-]+|-moz-[a-z-]+|hover|focus|focus-visible|focus-within|active|visited|target|link|any-link)\b(?:\([^)]*\))?`)
+
+// matches reports whether any of the selectors in the list sel matches
+// one of nodes. Selectors cascadia can't parse are kept, to be safe.
+func matches(sel string, nodes []*html.Node) bool {
+	for part := range strings.SplitSeq(sel, ",") {
+		part = strings.TrimSpace(dynamicRe.ReplaceAllString(part, ""))
+		if part == "" || strings.ContainsAny(part[len(part)-1:], ">+~") {
+			part += "*"
+		}
+		m, err := cascadia.Parse(part)
+		if err != nil {
+			return true
+		}
+		for _, n := range nodes {
+			if m.Match(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Extract returns the rules of css that style any of nodes, with the
+// grouping at-rules around them and the font faces they may use.
+// Keyframes, imports, and other at-rules are left to the full stylesheet.
+func Extract(css string, nodes []*html.Node) string {
+	var b strings.Builder
+	extract(&b, parse(css), nodes)
+	return b.String()
+}
+
+func extract(b *strings.Builder, rules []rule, nodes []*html.Node) {
+	for _, r := range rules {
+		lower := strings.ToLower(r.prelude)
+		switch {
+		case r.stmt:
+		case r.nested != nil:
+			var inner strings.Builder
+			extract(&inner, r.nested, nodes)
+			if inner.Len() > 0 {
+				b.WriteString(r.prelude + "{" + inner.String() + "}")
+			}
+		case strings.HasPrefix(lower, "@font-face"):
+			b.WriteString(r.prelude + "{" + r.block + "}")
+		case strings.HasPrefix(lower, "@"):
+		case matches(r.prelude, nodes):
+			b.WriteString(r.prelude + "{" + r.block + "}")
+		}
+	}
+}
+
+// onload turns a preloaded stylesheet into an applied one once it's
+// loaded.
+const onload = "this.onload=null;this.rel='stylesheet'"
+
+// Inline adds css to the head of doc, before its first stylesheet, and
+// defers the stylesheets: each is preloaded and applied once it loads,
+// with a <noscript> fallback.
+func Inline(doc *html.Node, css string) {
+	sheets := Stylesheets(doc)
+	if len(sheets) == 0 {
+		return
+	}
+	style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style, Attr: []html.Attribute{{Key: "id", Val: StyleID}}}
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: css})
+	sheets[0].Parent.InsertBefore(style, sheets[0])
+	for _, n := range sheets {
+		fallback := &html.Node{Type: html.ElementNode, Data: "link", DataAtom: atom.Link}
+		for _, a := range n.Attr {
+			switch a.Key {
+			case "rel":
+				a.Val = "stylesheet"
+			case "as":
+				continue
+			}
+			fallback.Attr = append(fallback.Attr, a)
+		}
+		noscript := &html.Node{Type: html.ElementNode, Data: "noscript", DataAtom: atom.Noscript}
+		noscript.AppendChild(fallback)
+		n.Parent.InsertBefore(noscript, n.NextSibling)
+		// PaperMod already preloads it, as rel="preload stylesheet".
+		n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool {
+			return a.Key == "rel" || a.Key == "as" || a.Key == "onload"
+		})
+		n.Attr = append(n.Attr,
+			html.Attribute{Key: "rel", Val: "preload"},
+			html.Attribute{Key: "as", Val: "style"},
+			html.Attribute{Key: "onload", Val: onload})
+	}
+}
+
+var cssURLRe = regexp.MustCompile(`url\(\s*(['"]?)([^'")]+?)(['"]?)\s*\)`)
+
+// rebase points the relative url()s in css, from the stylesheet at sheet,
+// at root-relative paths, so they still resolve once it's inlined.
+func rebase(css string, sheet *url.URL) string {
+	return cssURLRe.ReplaceAllStringFunc(css, func(m string) string {
+		sm := cssURLRe.FindStringSubmatch(m)
+		ref := strings.TrimSpace(sm[2])
+		if sm[1] != sm[3] || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "#") || strings.Contains(ref, ":") {
+			return m
+		}
+		u, err := sheet.Parse(ref)
+		if err != nil {
+			return m
+		}
+		return "url(" + sm[1] + u.RequestURI() + sm[3] + ")"
+	})
+}
+
+// Options tune Run.
+type Options struct {
+	// Sample is the number of pages of each kind the critical CSS is
+	// worked out from.
+	Sample int
+	// Budget is the characters of text counted as above the fold.
+	Budget int
+}
+
+// Stats are, by kind, the pages Run inlined CSS into and the size of the
+// CSS.
+type Stats struct {
+	Pages map[string]int
+	Bytes map[string]int
+}
+
+type page struct {
+	file, url string
+}
+
+// Run inlines the critical CSS into the pages of the site built in dir,
+// whose same-origin stylesheets it reads from dir. Alias redirect stubs
+// and pages done before are skipped.
+func Run(dir string, opts Options) (Stats, error) {
+	st := Stats{Pages: map[string]int{}, Bytes: map[string]int{}}
+	byKind := map[string][]page{}
+	nodes := map[string][]*html.Node{}
+	// sheets are each kind's stylesheets' URL paths, in the order pages
+	// link them.
+	sheets := map[string][]string{}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".html" {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil || htmlcheck.Redirect(b) {
+			return err
+		}
+		doc, err := html.Parse(bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("critical: %s: %w", p, err)
+		}
+		if Done(doc) || len(Stylesheets(doc)) == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		u := "/" + filepath.ToSlash(rel)
+		if path.Base(u) == "index.html" {
+			u = strings.TrimSuffix(u, "index.html")
+		}
+		kind := KindOf(u, doc)
+		byKind[kind] = append(byKind[kind], page{p, u})
+		if len(byKind[kind]) > opts.Sample {
+			return nil
+		}
+		nodes[kind] = append(nodes[kind], AboveFold(doc, opts.Budget)...)
+		for _, n := range Stylesheets(doc) {
+			ref, err := url.Parse(u)
+			if err != nil {
+				continue
+			}
+			sheet, err := ref.Parse(attr(n, "href"))
+			if err != nil || sheet.Host != "" || !strings.HasPrefix(sheet.Path, "/") {
+				continue
+			}
+			if !slices.Contains(sheets[kind], sheet.Path) {
+				sheets[kind] = append(sheets[kind], sheet.Path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+
+	for kind, pages := range byKind {
+		var css strings.Builder
+		for _, s := range sheets[kind] {
+			b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(s)))
+			if err != nil {
+				return st, fmt.Errorf("critical: %w", err)
+			}
+			css.WriteString(rebase(string(b), &url.URL{Path: s}))
+		}
+		critical := Extract(css.String(), nodes[kind])
+		if critical == "" {
+			continue
+		}
+		st.Bytes[kind] = len(critical)
+		for _, pg := range pages {
+			b, err := os.ReadFile(pg.file)
+			if err != nil {
+				return st, err
+			}
+			doc, err := html.Parse(bytes.NewReader(b))
+			if err != nil {
+				return st, fmt.Errorf("critical: %s: %w", pg.file, err)
+			}
+			Inline(doc, critical)
+			var buf bytes.Buffer
+			if err := html.Render(&buf, doc); err != nil {
+				return st, err
+			}
+			if err := os.WriteFile(pg.file, buf.Bytes(), 0o644); err != nil {
+				return st, err
+			}
+			st.Pages[kind]++
+		}
+	}
+	return st, nil
+}
+
+func find(n *html.Node, pred func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && pred(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, pred); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func walk(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	return slices.Contains(strings.Fields(attr(n, "class")), class)
+}
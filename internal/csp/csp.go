@@ -0,0 +1,317 @@
+// Package csp computes each built page's Content-Security-Policy from what
+// the page actually loads, rather than from a hand-kept allowlist: the
+// origins of its external scripts, styles, images, media, frames, and
+// forms, and the SHA-256 hashes of its inline scripts, styles, and event
+// handlers, so it needs no 'unsafe-inline'. Violations are reported to
+// cmd/cspreportd.
+package csp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/rednafi/rednafi.com/internal/headers"
+	"github.com/rednafi/rednafi.com/internal/htmlcheck"
+)
+
+// Page is what a page loads, by directive.
+type Page struct {
+	// Sources are origins, or keywords like data:, by directive name.
+	Sources map[string]map[string]bool
+	// Hashes are the 'sha256-...' sources of inline code, by directive
+	// name; attrs reports the directives whose hashes include attributes,
+	// which take 'unsafe-hashes'.
+	Hashes map[string]map[string]bool
+	attrs  map[string]bool
+}
+
+// Directives a Page fills in, in the order Policy writes them.
+var Directives = []string{"script-src", "style-src", "img-src", "media-src", "frame-src", "connect-src", "form-action"}
+
+// follows lists the origins a script from an origin is known to reach in
+// turn, which its page's HTML can't show.
+var follows = map[string]map[string][]string{
+	"https://www.googletagmanager.com": {
+		"script-src":  {"https://*.googletagmanager.com"},
+		"img-src":     {"https://*.google-analytics.com", "https://*.googletagmanager.com"},
+		"connect-src": {"https://*.google-analytics.com", "https://*.analytics.google.com", "https://*.googletagmanager.com"},
+	},
+}
+
+// scriptTypes are the <script> types browsers run; other types, like
+// JSON-LD, are data and don't need a hash.
+var scriptTypes = map[string]bool{
+	"": true, "text/javascript": true, "application/javascript": true, "module": true,
+}
+
+func newPage() *Page {
+	return &Page{Sources: map[string]map[string]bool{}, Hashes: map[string]map[string]bool{}, attrs: map[string]bool{}}
+}
+
+func (p *Page) add(m map[string]map[string]bool, directive, source string) {
+	if m[directive] == nil {
+		m[directive] = map[string]bool{}
+	}
+	m[directive][source] = true
+}
+
+// source records the URL ref loaded by directive on a page at base. Same
+// origin URLs are covered by 'self'.
+func (p *Page) source(base *url.URL, directive, ref string) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return
+	}
+	switch u.Scheme {
+	case "data", "blob":
+		p.add(p.Sources, directive, u.Scheme+":")
+		return
+	case "http", "https":
+	default:
+		return
+	}
+	if u.Host == base.Host && u.Scheme == base.Scheme {
+		return
+	}
+	origin := u.Scheme + "://" + u.Host
+	p.add(p.Sources, directive, origin)
+	if directive == "script-src" {
+		for d, srcs := range follows[origin] {
+			for _, s := range srcs {
+				p.add(p.Sources, d, s)
+			}
+		}
+	}
+}
+
+func hash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// Scan reads the page served at base.
+func Scan(r io.Reader, base *url.URL) (*Page, error) {
+	p := newPage()
+	z := html.NewTokenizer(r)
+	// inline is the directive of the <script> or <style> being read, if
+	// its contents need a hash, and text is its contents so far.
+	var (
+		inline string
+		text   strings.Builder
+	)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return p, nil
+			}
+			return nil, z.Err()
+		case html.TextToken:
+			if inline != "" {
+				text.Write(z.Raw())
+			}
+		case html.EndTagToken:
+			if inline != "" {
+				// An empty element is hashed too; browsers check it.
+				p.add(p.Hashes, inline, hash(text.String()))
+				inline = ""
+				text.Reset()
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			attr := func(k string) string {
+				for _, a := range tok.Attr {
+					if a.Key == k {
+						return a.Val
+					}
+				}
+				return ""
+			}
+			for _, a := range tok.Attr {
+				switch {
+				case strings.HasPrefix(a.Key, "on"):
+					p.add(p.Hashes, "script-src", hash(a.Val))
+					p.attrs["script-src"] = true
+				case a.Key == "style" && a.Val != "":
+					p.add(p.Hashes, "style-src", hash(a.Val))
+					p.attrs["style-src"] = true
+				}
+			}
+			switch tok.Data {
+			case "script":
+				if src := attr("src"); src != "" {
+					p.source(base, "script-src", src)
+				} else if tt == html.StartTagToken && scriptTypes[strings.ToLower(attr("type"))] {
+					inline = "script-src"
+				}
+			case "style":
+				if tt == html.StartTagToken {
+					inline = "style-src"
+				}
+			case "link":
+				rel := strings.Fields(strings.ToLower(attr("rel")))
+				switch {
+				case slices.Contains(rel, "stylesheet"):
+					p.source(base, "style-src", attr("href"))
+				case slices.Contains(rel, "icon"), slices.Contains(rel, "apple-touch-icon"):
+					p.source(base, "img-src", attr("href"))
+				case slices.Contains(rel, "preload"), slices.Contains(rel, "modulepreload"):
+					if d := map[string]string{"script": "script-src", "style": "style-src", "image": "img-src"}[attr("as")]; d != "" {
+						p.source(base, d, attr("href"))
+					}
+				}
+			case "img":
+				p.source(base, "img-src", attr("src"))
+				srcset(p, base, "img-src", attr("srcset"))
+			case "source":
+				if attr("srcset") != "" {
+					srcset(p, base, "img-src", attr("srcset"))
+				} else {
+					p.source(base, "media-src", attr("src"))
+				}
+			case "video", "audio", "track":
+				p.source(base, "media-src", attr("src"))
+				if tok.Data == "video" {
+					p.source(base, "img-src", attr("poster"))
+				}
+			case "iframe":
+				p.source(base, "frame-src", attr("src"))
+			case "form":
+				p.source(base, "form-action", attr("action"))
+				// The contact widget submits with fetch to the form's action.
+				p.source(base, "connect-src", attr("action"))
+			}
+		}
+	}
+}
+
+func srcset(p *Page, base *url.URL, directive, set string) {
+	for c := range strings.SplitSeq(set, ",") {
+		if f := strings.Fields(c); len(f) > 0 {
+			p.source(base, directive, f[0])
+		}
+	}
+}
+
+// Options add to what pages load.
+type Options struct {
+	// Connect are origins scripts fetch from, like the view counter's,
+	// which a page's HTML doesn't show.
+	Connect []string
+	// Report is the URL violations are sent to, if any.
+	Report string
+}
+
+// ReportGroup names the Reporting-Endpoints group Policy reports to.
+const ReportGroup = "csp"
+
+// Policy returns the page's Content-Security-Policy.
+func (p *Page) Policy(opts Options) string {
+	parts := []string{"default-src 'self'"}
+	for _, d := range Directives {
+		srcs := []string{"'self'"}
+		for s := range p.Sources[d] {
+			srcs = append(srcs, s)
+		}
+		if d == "connect-src" {
+			for _, c := range opts.Connect {
+				if u, err := url.Parse(c); err == nil && u.Host != "" {
+					srcs = append(srcs, u.Scheme+"://"+u.Host)
+				}
+			}
+		}
+		var hashes []string
+		for h := range p.Hashes[d] {
+			hashes = append(hashes, h)
+		}
+		if p.attrs[d] {
+			hashes = append(hashes, "'unsafe-hashes'")
+		}
+		sort.Strings(srcs[1:])
+		sort.Strings(hashes)
+		parts = append(parts, d+" "+strings.Join(slices.Compact(append(srcs, hashes...)), " "))
+	}
+	parts = append(parts, "font-src 'self' data:", "object-src 'none'", "base-uri 'self'", "frame-ancestors 'none'")
+	if opts.Report != "" {
+		parts = append(parts, "report-uri "+opts.Report, "report-to "+ReportGroup)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Build scans the HTML pages under dir, the site built for base, and
+// returns each one's policy by the URL path it's served at: a directory's
+// path for its index.html. Alias redirect stubs are skipped.
+func Build(dir string, base *url.URL, opts Options) (map[string]string, error) {
+	policies := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".html" {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if htmlcheck.Redirect(b) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		u := "/" + filepath.ToSlash(rel)
+		if strings.HasSuffix(u, "/index.html") || u == "/index.html" {
+			u = strings.TrimSuffix(u, "index.html")
+		}
+		page, err := Scan(strings.NewReader(string(b)), base.JoinPath(u))
+		if err != nil {
+			return fmt.Errorf("csp: %s: %w", path, err)
+		}
+		policies[u] = page.Policy(opts)
+		return nil
+	})
+	return policies, err
+}
+
+// Headers returns policy with each page's Content-Security-Policy in a
+// rule of its own, after policy's rules, whose own are dropped. With
+// report, every path also gets the Reporting-Endpoints header report-to
+// names.
+func Headers(policy *headers.Policy, pages map[string]string, report string) *headers.Policy {
+	out := &headers.Policy{}
+	for _, r := range policy.Rule {
+		h := map[string]string{}
+		maps.Copy(h, r.Headers)
+		delete(h, "Content-Security-Policy")
+		out.Rule = append(out.Rule, headers.Rule{Path: r.Path, Headers: h})
+	}
+	if report != "" {
+		i := slices.IndexFunc(out.Rule, func(r headers.Rule) bool { return r.Path == "/*" })
+		if i < 0 {
+			out.Rule = slices.Insert(out.Rule, 0, headers.Rule{Path: "/*", Headers: map[string]string{}})
+			i = 0
+		}
+		out.Rule[i].Headers["Reporting-Endpoints"] = fmt.Sprintf("%s=%q", ReportGroup, report)
+	}
+	for _, u := range slices.Sorted(maps.Keys(pages)) {
+		out.Rule = append(out.Rule, headers.Rule{Path: u, Headers: map[string]string{
+			"Content-Security-Policy": pages[u],
+		}})
+	}
+	return out
+}
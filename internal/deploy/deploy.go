@@ -0,0 +1,366 @@
+// Package deploy keeps a history of the site's deploys to R2, per
+// environment, so any of them can be restored. Each deploy is a snapshot
+// of the hash and Cache-Control of every object it left in the site's
+// bucket. The objects' contents are kept by hash in a bucket of their own,
+// which isn't served, so a rollback copies them back into place without a
+// rebuild.
+//
+// The environments live in data/deploy.toml:
+//
+//	snapshots = "rednafi-deploys"
+//
+//	[env.prod]
+//	bucket = "rednafi-com"
+//	purge = true
+//
+//	[env.staging]
+//	bucket = "rednafi-com-staging"
+//	base_url = "https://staging.rednafi.com"
+//
+//	[preview]
+//	bucket = "rednafi-previews"
+//	base_url = "https://preview.rednafi.com"
+//	days = 14
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/r2"
+)
+
+// DefaultConfig is where the environments live.
+const DefaultConfig = "data/deploy.toml"
+
+// DefaultEnv is the environment deployed to when none is named.
+const DefaultEnv = "prod"
+
+// Env is where an environment is deployed.
+type Env struct {
+	// Bucket and Prefix are where the site's objects go. An empty bucket
+	// leaves it to R2_BUCKET.
+	Bucket string `toml:"bucket"`
+	Prefix string `toml:"prefix"`
+	// BaseURL is the URL the environment is served at, for purging; empty
+	// is config.yml's baseURL.
+	BaseURL string `toml:"base_url"`
+	// Purge purges the changed URLs from Cloudflare's cache on every deploy.
+	Purge bool `toml:"purge"`
+}
+
+// Config is the deploy settings file.
+type Config struct {
+	// Snapshots is the bucket the deploy history is kept in. Without one,
+	// deploys aren't recorded and can't be rolled back.
+	Snapshots string         `toml:"snapshots"`
+	Envs      map[string]Env `toml:"env"`
+	Preview   Preview        `toml:"preview"`
+}
+
+// Load reads the settings at path. A missing file has no environments
+// besides DefaultEnv, which deploys where R2_BUCKET says.
+func Load(path string) (Config, error) {
+	var c Config
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := toml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("deploy: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Env returns the environment named name.
+func (c Config) Env(name string) (Env, error) {
+	if env, ok := c.Envs[name]; ok {
+		return env, nil
+	}
+	if name == DefaultEnv && len(c.Envs) == 0 {
+		return Env{}, nil
+	}
+	return Env{}, fmt.Errorf("deploy: unknown environment %q; have %s", name, strings.Join(slices.Sorted(maps.Keys(c.Envs)), ", "))
+}
+
+// Object is a deployed object: the hex MD5 of its contents, which R2
+// reports as its ETag, and the Cache-Control and Content-Type the header
+// policy had it stored with.
+type Object struct {
+	Hash         string `json:"hash"`
+	CacheControl string `json:"cache_control,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+}
+
+// Snapshot is the state of an environment after a deploy.
+type Snapshot struct {
+	ID     string    `json:"id"`
+	Env    string    `json:"env"`
+	Time   time.Time `json:"time"`
+	Prefix string    `json:"prefix,omitempty"`
+	// Rollback is the deploy a rollback restored, if this was one.
+	Rollback string `json:"rollback,omitempty"`
+	// Objects are by key.
+	Objects map[string]Object `json:"objects"`
+}
+
+// NewID returns the ID of a deploy made at t. IDs sort by time.
+func NewID(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// Diff lists the pages, by URL path, that a deploy added, changed, and
+// removed.
+type Diff struct {
+	Added, Changed, Removed []string
+}
+
+// Compare returns the pages that differ between the snapshots. A nil old
+// snapshot is an empty bucket.
+func Compare(old, cur *Snapshot) Diff {
+	var d Diff
+	if old == nil {
+		old = &Snapshot{}
+	}
+	for key, o := range cur.Objects {
+		page, ok := Page(cur.Prefix, key)
+		if !ok {
+			continue
+		}
+		prev, had := old.Objects[key]
+		switch {
+		case !had:
+			d.Added = append(d.Added, page)
+		case prev.Hash != o.Hash:
+			d.Changed = append(d.Changed, page)
+		}
+	}
+	for key := range old.Objects {
+		if _, ok := cur.Objects[key]; ok {
+			continue
+		}
+		if page, ok := Page(old.Prefix, key); ok {
+			d.Removed = append(d.Removed, page)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Changed)
+	sort.Strings(d.Removed)
+	return d
+}
+
+// Page returns the URL path of the page stored under key, and whether key
+// is a page.
+func Page(prefix, key string) (string, bool) {
+	rel := "/" + strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/")
+	if path.Ext(rel) != ".html" {
+		return "", false
+	}
+	return strings.TrimSuffix(rel, "index.html"), true
+}
+
+// Store keeps snapshots, under snapshots/<env>/<id>.json, and the contents
+// they refer to, under blobs/<hash>, in a bucket.
+type Store struct {
+	c *r2.Client
+}
+
+// NewStore returns a store in c's bucket.
+func NewStore(c *r2.Client) *Store {
+	return &Store{c: c}
+}
+
+func snapshotKey(env, id string) string {
+	return "snapshots/" + env + "/" + id + ".json"
+}
+
+// Save stores snap.
+func (s *Store) Save(ctx context.Context, snap *Snapshot) error {
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.c.Put(ctx, snapshotKey(snap.Env, snap.ID), b, r2.PutOptions{ContentType: "application/json"})
+}
+
+// List returns the IDs of env's deploys, oldest first.
+func (s *Store) List(ctx context.Context, env string) ([]string, error) {
+	prefix := "snapshots/" + env + "/"
+	objects, err := s.c.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, o := range objects {
+		if id, ok := strings.CutSuffix(strings.TrimPrefix(o.Key, prefix), ".json"); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Get returns env's deploy id.
+func (s *Store) Get(ctx context.Context, env, id string) (*Snapshot, error) {
+	b, err := s.c.Get(ctx, snapshotKey(env, id))
+	if errors.Is(err, r2.ErrNotFound) {
+		return nil, fmt.Errorf("deploy: no %s deploy %s", env, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{}
+	if err := json.Unmarshal(b, snap); err != nil {
+		return nil, fmt.Errorf("deploy: %s: %w", snapshotKey(env, id), err)
+	}
+	return snap, nil
+}
+
+// Latest returns env's last deploy, or nil if there's none yet.
+func (s *Store) Latest(ctx context.Context, env string) (*Snapshot, error) {
+	ids, err := s.List(ctx, env)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return s.Get(ctx, env, ids[len(ids)-1])
+}
+
+// Keep uploads the contents of the files the store doesn't have yet, with
+// up to jobs uploads at a time, and returns how many it uploaded.
+func (s *Store) Keep(ctx context.Context, files []r2.File, jobs int) (int, error) {
+	have, err := s.c.List(ctx, "blobs/")
+	if err != nil {
+		return 0, err
+	}
+	known := map[string]bool{}
+	for _, o := range have {
+		known[strings.TrimPrefix(o.Key, "blobs/")] = true
+	}
+	var blobs []r2.File
+	for _, f := range files {
+		if !known[f.Hash] {
+			known[f.Hash] = true
+			blobs = append(blobs, r2.File{Path: f.Path, Key: "blobs/" + f.Hash, Hash: f.Hash})
+		}
+	}
+	return len(blobs), s.c.Upload(ctx, blobs, "", jobs, nil)
+}
+
+// Snap returns a snapshot of the files as deployed to env at t.
+func Snap(env, prefix string, t time.Time, files []r2.File) *Snapshot {
+	snap := &Snapshot{ID: NewID(t), Env: env, Time: t.UTC(), Prefix: prefix, Objects: map[string]Object{}}
+	for _, f := range files {
+		snap.Objects[f.Key] = Object{Hash: f.Hash, CacheControl: f.CacheControl, ContentType: f.ContentType}
+	}
+	return snap
+}
+
+// Restamp returns pending with the files added whose contents prev
+// deployed but with another Cache-Control or Content-Type, so uploading
+// them again brings their metadata up to date.
+func Restamp(prev *Snapshot, files, pending []r2.File) []r2.File {
+	if prev == nil {
+		return pending
+	}
+	queued := map[string]bool{}
+	for _, f := range pending {
+		queued[f.Key] = true
+	}
+	for _, f := range files {
+		o, ok := prev.Objects[f.Key]
+		if ok && !queued[f.Key] && o.Hash == f.Hash && (o.CacheControl != f.CacheControl || o.ContentType != f.ContentType) {
+			pending = append(pending, f)
+		}
+	}
+	return pending
+}
+
+// Plan returns the keys a rollback from latest, the environment's last
+// deploy, to target puts back, because they're missing from the site's
+// bucket or differ, and the keys it deletes, because latest deployed them
+// and target doesn't have them. Objects no deploy recorded, like the ones
+// cmd/r2sync uploads, are left alone.
+func Plan(current []r2.Object, latest, target *Snapshot) (put, del []string) {
+	etags := map[string]string{}
+	for _, o := range current {
+		etags[o.Key] = o.ETag
+	}
+	for key, o := range target.Objects {
+		if etags[key] != o.Hash {
+			put = append(put, key)
+		}
+	}
+	if latest != nil {
+		for key := range latest.Objects {
+			if _, ok := target.Objects[key]; !ok && etags[key] != "" {
+				del = append(del, key)
+			}
+		}
+	}
+	sort.Strings(put)
+	sort.Strings(del)
+	return put, del
+}
+
+// Restore puts the objects of target under put back into site, from the
+// store, and deletes del, calling done after each key.
+func (s *Store) Restore(ctx context.Context, site *r2.Client, target *Snapshot, put, del []string, done func(key string)) error {
+	for _, key := range put {
+		o := target.Objects[key]
+		b, err := s.c.Get(ctx, "blobs/"+o.Hash)
+		if err != nil {
+			return fmt.Errorf("deploy: %s: %w", key, err)
+		}
+		ctype := o.ContentType
+		if ctype == "" {
+			ctype = mime.TypeByExtension(path.Ext(key))
+		}
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		if err := site.Put(ctx, key, b, r2.PutOptions{ContentType: ctype, CacheControl: o.CacheControl}); err != nil {
+			return err
+		}
+		done(key)
+	}
+	for _, key := range del {
+		if err := site.Delete(ctx, key); err != nil {
+			return err
+		}
+		done(key)
+	}
+	return nil
+}
+
+// Print writes d as one line per page: + added, ~ changed, - removed.
+func (d Diff) Print(w io.Writer) {
+	for _, p := range d.Added {
+		fmt.Fprintf(w, "+ %s\n", p)
+	}
+	for _, p := range d.Changed {
+		fmt.Fprintf(w, "~ %s\n", p)
+	}
+	for _, p := range d.Removed {
+		fmt.Fprintf(w, "- %s\n", p)
+	}
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("%d added, %d changed, %d removed page(s)", len(d.Added), len(d.Changed), len(d.Removed))
+}
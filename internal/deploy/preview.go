@@ -0,0 +1,121 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/headers"
+	"github.com/rednafi/rednafi.com/internal/r2"
+)
+
+// PreviewRoot is the key prefix branch previews are uploaded under, each
+// in a directory named after its branch.
+const PreviewRoot = "preview/"
+
+// DefaultPreviewDays is how long a preview is kept after its last deploy
+// when the settings don't say.
+const DefaultPreviewDays = 14
+
+// Preview is where branch previews are deployed: a bucket of their own,
+// served at a subdomain search engines are told not to index.
+type Preview struct {
+	Bucket  string `toml:"bucket"`
+	BaseURL string `toml:"base_url"`
+	// Days is how long a preview is kept after its last deploy.
+	Days int `toml:"days"`
+}
+
+// PreviewPrefix returns the key prefix of branch's preview. Branch names
+// are lowercased and runs of anything but letters and digits become one
+// dash, so feature/Dark_Mode is previewed under preview/feature-dark-mode.
+func PreviewPrefix(branch string) (string, error) {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(branch) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "", fmt.Errorf("deploy: branch %q has no letters or digits to name a preview by", branch)
+	}
+	return PreviewRoot + b.String(), nil
+}
+
+// URL returns where the preview under prefix is served.
+func (p Preview) URL(prefix string) string {
+	return strings.TrimRight(p.BaseURL, "/") + "/" + prefix + "/"
+}
+
+// NoIndex is the header policy uploaded as the preview bucket's _headers
+// file, so the edge tells crawlers to keep every preview out of search
+// results. A robots.txt Disallow would stop them from seeing the header,
+// so previews get none.
+var NoIndex = &headers.Policy{Rule: []headers.Rule{{
+	Path:    "/*",
+	Headers: map[string]string{"X-Robots-Tag": "noindex, nofollow"},
+}}}
+
+// Branch is a deployed preview.
+type Branch struct {
+	Prefix string
+	// Updated is when any of its objects was last uploaded.
+	Updated time.Time
+	Keys    []string
+}
+
+// Previews groups the objects in the preview bucket by preview, most
+// recently updated first.
+func Previews(objects []r2.Object) []Branch {
+	byPrefix := map[string]*Branch{}
+	for _, o := range objects {
+		rest, ok := strings.CutPrefix(o.Key, PreviewRoot)
+		if !ok {
+			continue
+		}
+		name, _, ok := strings.Cut(rest, "/")
+		if !ok {
+			continue
+		}
+		prefix := PreviewRoot + name
+		b := byPrefix[prefix]
+		if b == nil {
+			b = &Branch{Prefix: prefix}
+			byPrefix[prefix] = b
+		}
+		b.Keys = append(b.Keys, o.Key)
+		if o.LastModified.After(b.Updated) {
+			b.Updated = o.LastModified
+		}
+	}
+	var branches []Branch
+	for _, b := range byPrefix {
+		branches = append(branches, *b)
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Updated.After(branches[j].Updated) })
+	return branches
+}
+
+// Expired returns the previews last deployed more than days before now.
+func Expired(branches []Branch, now time.Time, days int) ([]Branch, error) {
+	if days <= 0 {
+		return nil, errors.New("deploy: previews must be kept for at least a day")
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	var old []Branch
+	for _, b := range branches {
+		if b.Updated.Before(cutoff) {
+			old = append(old, b)
+		}
+	}
+	return old, nil
+}
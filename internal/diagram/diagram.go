@@ -0,0 +1,234 @@
+// Package diagram renders the posts' mermaid and d2 fenced blocks to SVG,
+// so diagrams show without client-side JavaScript. Each diagram is drawn
+// twice, in a light and a dark theme, for the site's two color schemes.
+//
+// Renderings are stored as data/diagrams/<hash>.json, keyed by the hash of
+// the block's source, and the render-codeblock-mermaid and
+// render-codeblock-d2 hooks inline them; a block with no rendering shows
+// its source instead. A stored rendering is reused for as long as its
+// source doesn't change, so the renderers only run for new diagrams.
+package diagram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/highlight"
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+// DefaultDir is where the render hooks read diagrams from, as
+// site.Data.diagrams.
+const DefaultDir = "data/diagrams"
+
+// Langs are the fence languages rendered as diagrams.
+var Langs = []string{"mermaid", "d2"}
+
+// Default renderer commands. The mermaid CLI is pinned so renderings stay
+// stable; d2 is expected on PATH, as `go install oss.terrastruct.com/d2`
+// puts it.
+var (
+	DefaultMermaid = []string{"npx", "--yes", "-p", "@mermaid-js/mermaid-cli@10.9.1", "mmdc"}
+	DefaultD2      = []string{"d2"}
+)
+
+// Block is a diagram found in a post.
+type Block struct {
+	snippet.Block
+	// Hash identifies the source; see highlight.Hash.
+	Hash string
+}
+
+// Diagram is a rendered diagram, as stored.
+type Diagram struct {
+	Lang  string `json:"lang"`
+	Light string `json:"light"`
+	Dark  string `json:"dark"`
+}
+
+// Blocks returns the diagrams in posts, in order. The same source used
+// twice is listed once.
+func Blocks(posts []*content.Post) []Block {
+	var out []Block
+	seen := map[string]bool{}
+	for _, p := range posts {
+		for _, b := range snippet.Extract(p) {
+			if !slices.Contains(Langs, b.Lang) {
+				continue
+			}
+			h := highlight.Hash(b.Code)
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+			out = append(out, Block{b, h})
+		}
+	}
+	return out
+}
+
+// Renderer runs the diagram CLIs.
+type Renderer struct {
+	Mermaid []string
+	D2      []string
+}
+
+// Render draws b in both themes.
+func (r Renderer) Render(ctx context.Context, b Block) (*Diagram, error) {
+	light, err := r.render(ctx, b, false)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%d: %s: %w", b.Post, b.Line, b.Lang, err)
+	}
+	dark, err := r.render(ctx, b, true)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%d: %s: %w", b.Post, b.Line, b.Lang, err)
+	}
+	return &Diagram{
+		Lang:  b.Lang,
+		Light: Optimize(light, "dg"+b.Hash[:8]+"l-"),
+		Dark:  Optimize(dark, "dg"+b.Hash[:8]+"d-"),
+	}, nil
+}
+
+func (r Renderer) render(ctx context.Context, b Block, dark bool) (string, error) {
+	tmp, err := os.MkdirTemp("", "diagram")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	in, out := filepath.Join(tmp, "in."+b.Lang), filepath.Join(tmp, "out.svg")
+	if err := os.WriteFile(in, []byte(b.Code), 0o644); err != nil {
+		return "", err
+	}
+
+	var argv []string
+	switch b.Lang {
+	case "mermaid":
+		theme := "default"
+		if dark {
+			theme = "dark"
+		}
+		argv = append(slices.Clone(r.Mermaid), "--quiet", "--theme", theme, "--backgroundColor", "transparent", "-i", in, "-o", out)
+	case "d2":
+		// Theme 0 is Neutral Default and 200 Dark Mauve.
+		theme := "0"
+		if dark {
+			theme = "200"
+		}
+		argv = append(slices.Clone(r.D2), "--theme", theme, "--pad", "16", in, out)
+	default:
+		return "", fmt.Errorf("unknown diagram language %q", b.Lang)
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	svg, err := os.ReadFile(out)
+	return string(svg), err
+}
+
+var (
+	prologRe  = regexp.MustCompile(`(?s)<\?xml.*?\?>|<!DOCTYPE[^>]*>|<!--.*?-->`)
+	newlineRe = regexp.MustCompile(`>\s*\n\s*<`)
+	rootRe    = regexp.MustCompile(`<svg\b[^>]*>`)
+	sizeRe    = regexp.MustCompile(`\s(?:width|height)="[^"]*"`)
+	idRe      = regexp.MustCompile(`\sid="([^"]+)"`)
+	refRe     = regexp.MustCompile(`(url\(#|href="#|#)([A-Za-z_][\w.:-]*)`)
+)
+
+// Optimize makes svg fit for inlining in a page: the XML prolog and
+// comments go, whitespace between tags goes, the root's fixed size gives
+// way to its viewBox so it scales with the page, and every id is prefixed
+// with prefix so two diagrams on a page, or the two themes of one, don't
+// share ids and style each other.
+func Optimize(svg, prefix string) string {
+	svg = prologRe.ReplaceAllString(svg, "")
+	svg = newlineRe.ReplaceAllString(svg, "><")
+	svg = strings.TrimSpace(svg)
+	if root := rootRe.FindString(svg); root != "" && strings.Contains(root, "viewBox") {
+		svg = strings.Replace(svg, root, sizeRe.ReplaceAllString(root, ""), 1)
+	}
+
+	ids := map[string]bool{}
+	for _, m := range idRe.FindAllStringSubmatch(svg, -1) {
+		ids[m[1]] = true
+	}
+	svg = idRe.ReplaceAllStringFunc(svg, func(s string) string {
+		return ` id="` + prefix + idRe.FindStringSubmatch(s)[1] + `"`
+	})
+	return refRe.ReplaceAllStringFunc(svg, func(s string) string {
+		m := refRe.FindStringSubmatch(s)
+		if !ids[m[2]] {
+			return s
+		}
+		return m[1] + prefix + m[2]
+	})
+}
+
+// Load returns the stored diagram for hash, or nil.
+func Load(dir, hash string) (*Diagram, error) {
+	b, err := os.ReadFile(filepath.Join(dir, hash+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d Diagram
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("diagram: %s: %w", hash, err)
+	}
+	return &d, nil
+}
+
+// Write stores d as dir/<hash>.json.
+func Write(dir, hash string, d *Diagram) error {
+	// Keep the SVG readable rather than \u003c-escaped.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, hash+".json"), b.Bytes(), 0o644)
+}
+
+// Prune removes the stored diagrams not in keep and returns their paths.
+func Prune(dir string, keep []Block) ([]string, error) {
+	want := map[string]bool{}
+	for _, b := range keep {
+		want[b.Hash+".json"] = true
+	}
+	var removed []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == dir {
+			return nil
+		}
+		if err != nil || d.IsDir() || want[d.Name()] || filepath.Ext(p) != ".json" {
+			return err
+		}
+		removed = append(removed, p)
+		return os.Remove(p)
+	})
+	return removed, err
+}
@@ -0,0 +1,103 @@
+// Package embed turns posts into embedding vectors for semantic search and
+// ranks them against a query.
+//
+// Vectors come from any OpenAI-compatible /embeddings endpoint, which
+// covers OpenAI itself as well as local servers like Ollama or llama.cpp.
+// `blogctl embed` computes them offline and stores them in the index file
+// that cmd/semsearch loads.
+package embed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Client requests embeddings from an OpenAI-compatible API.
+type Client struct {
+	HTTP *http.Client
+	// BaseURL is the API root, e.g. "https://api.openai.com/v1".
+	BaseURL string
+	APIKey  string
+	Model   string
+}
+
+// Default endpoint and model.
+const (
+	DefaultBaseURL = "https://api.openai.com/v1"
+	DefaultModel   = "text-embedding-3-small"
+)
+
+// ClientFromEnv returns a client configured by EMBED_BASE_URL, EMBED_API_KEY,
+// and EMBED_MODEL, falling back to the defaults for unset values.
+func ClientFromEnv() *Client {
+	c := &Client{
+		BaseURL: os.Getenv("EMBED_BASE_URL"),
+		APIKey:  os.Getenv("EMBED_API_KEY"),
+		Model:   os.Getenv("EMBED_MODEL"),
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	if c.Model == "" {
+		c.Model = DefaultModel
+	}
+	return c
+}
+
+// Embed returns one vector per input, in order.
+func (c *Client) Embed(ctx context.Context, inputs []string) ([]Vector, error) {
+	body, err := json.Marshal(map[string]any{"model": c.Model, "input": inputs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+"/embeddings", bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("embed: decode response: %w", err)
+	}
+	if len(out.Data) != len(inputs) {
+		return nil, fmt.Errorf("embed: got %d vectors for %d inputs", len(out.Data), len(inputs))
+	}
+	vecs := make([]Vector, len(inputs))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("embed: vector index %d out of range", d.Index)
+		}
+		vecs[d.Index] = Vector(d.Embedding).Normalize()
+	}
+	return vecs, nil
+}
@@ -0,0 +1,274 @@
+package embed
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// DefaultPath is where `blogctl embed` writes the index and semsearch reads
+// it. It's kept out of data/ so Hugo doesn't load it.
+const DefaultPath = "embeddings.json"
+
+// Vector is an embedding. It's encoded in JSON as base64 little-endian
+// float32s, which is about a third of the size of a float array.
+type Vector []float32
+
+// MarshalJSON implements json.Marshaler.
+func (v Vector) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *Vector) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(b)%4 != 0 {
+		return errors.New("embed: vector length isn't a multiple of 4 bytes")
+	}
+	*v = make(Vector, len(b)/4)
+	for i := range *v {
+		(*v)[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return nil
+}
+
+// Normalize scales v to unit length in place and returns it, so that
+// similarity is a plain dot product.
+func (v Vector) Normalize() Vector {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return v
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+	return v
+}
+
+// Dot returns the dot product of v and w, which is their cosine similarity
+// when both are normalized.
+func (v Vector) Dot(w Vector) float64 {
+	var sum float64
+	for i := range min(len(v), len(w)) {
+		sum += float64(v[i]) * float64(w[i])
+	}
+	return sum
+}
+
+// Chunk is a passage of a post and its embedding.
+type Chunk struct {
+	Text   string `json:"text"`
+	Vector Vector `json:"vector"`
+}
+
+// Post is a post's entry in the index.
+type Post struct {
+	Slug  string `json:"slug"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// Hash identifies the text that was embedded, so unchanged posts
+	// aren't embedded again.
+	Hash   string  `json:"hash"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Index is the set of embedded posts.
+type Index struct {
+	Model string `json:"model"`
+	Posts []Post `json:"posts"`
+}
+
+// Load reads the index at path. A missing file yields an empty index.
+func Load(path string) (*Index, error) {
+	idx := &Index{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("embed: parse %s: %w", path, err)
+	}
+	return idx, nil
+}
+
+// Save writes the index to path.
+func (idx *Index) Save(path string) error {
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// ChunkSize is the target length of a passage in bytes. Paragraphs are
+// packed into passages up to this size; longer paragraphs stand alone.
+const ChunkSize = 1200
+
+// Passages splits a post's prose into the passages that get embedded. The
+// title leads the first passage so it carries the post's topic.
+func Passages(p *content.Post) []string {
+	text := markdown.Parse([]byte(p.Body), p.BodyLine).PlainText(false)
+	var out []string
+	cur := p.Title
+	for _, para := range strings.Split(text, "\n") {
+		if para = strings.TrimSpace(para); para == "" {
+			continue
+		}
+		if len(cur)+len(para) > ChunkSize && cur != "" {
+			out = append(out, cur)
+			cur = ""
+		}
+		if cur != "" {
+			cur += "\n"
+		}
+		cur += para
+	}
+	if cur != "" {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// Stats reports what an Update did.
+type Stats struct {
+	Embedded int
+	Reused   int
+}
+
+// Update embeds every published post that's new or changed since idx was
+// built and drops posts that are gone. Switching models re-embeds
+// everything. batch caps how many passages go into a single API call.
+func (idx *Index) Update(ctx context.Context, c *Client, posts []*content.Post, batch int) (Stats, error) {
+	if batch <= 0 {
+		batch = 64
+	}
+	prev := map[string]Post{}
+	if idx.Model == c.Model {
+		for _, p := range idx.Posts {
+			prev[p.Slug] = p
+		}
+	}
+
+	var st Stats
+	var next []Post
+	for _, p := range content.Published(posts) {
+		passages := Passages(p)
+		h := hash(passages)
+		if old, ok := prev[p.Slug]; ok && old.Hash == h {
+			old.URL, old.Title = p.RelPermalink(), p.Title
+			next = append(next, old)
+			st.Reused++
+			continue
+		}
+		e := Post{Slug: p.Slug, URL: p.RelPermalink(), Title: p.Title, Hash: h}
+		for i := 0; i < len(passages); i += batch {
+			part := passages[i:min(i+batch, len(passages))]
+			vecs, err := c.Embed(ctx, part)
+			if err != nil {
+				return st, fmt.Errorf("%s: %w", p.Path, err)
+			}
+			for j, v := range vecs {
+				e.Chunks = append(e.Chunks, Chunk{Text: part[j], Vector: v})
+			}
+		}
+		next = append(next, e)
+		st.Embedded++
+	}
+	idx.Model = c.Model
+	idx.Posts = next
+	return st, nil
+}
+
+func hash(passages []string) string {
+	h := sha256.New()
+	for _, p := range passages {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Hit is a search result.
+type Hit struct {
+	Slug    string  `json:"slug"`
+	URL     string  `json:"url"`
+	Title   string  `json:"title"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// SnippetLen is the maximum length of a hit's snippet in runes.
+const SnippetLen = 240
+
+// Search ranks posts by their best-matching passage against q and returns
+// the top n. The snippet is taken from that passage.
+func (idx *Index) Search(q Vector, n int) []Hit {
+	hits := make([]Hit, 0, len(idx.Posts))
+	for _, p := range idx.Posts {
+		best, score := -1, math.Inf(-1)
+		for i, c := range p.Chunks {
+			if s := q.Dot(c.Vector); s > score {
+				best, score = i, s
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		hits = append(hits, Hit{
+			Slug:    p.Slug,
+			URL:     p.URL,
+			Title:   p.Title,
+			Score:   score,
+			Snippet: snippet(p.Chunks[best].Text, SnippetLen),
+		})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > n {
+		hits = hits[:n]
+	}
+	return hits
+}
+
+// snippet shortens s to at most n runes, cutting at a word boundary.
+func snippet(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	cut := string(r[:n])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
@@ -0,0 +1,454 @@
+// Package export bundles the site's content into a single tarball for
+// backups, or for moving to another generator: every markdown file under
+// content/, its front matter rewritten as YAML with the same keys in one
+// order, the files under static/ the posts reference, and manifest.json,
+// which describes both so that nothing has to parse the front matter to
+// use them.
+package export
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/imgopt"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Version is the manifest's format, bumped when a field changes meaning.
+const Version = 1
+
+// ManifestName is the manifest's name in the archive's root folder.
+const ManifestName = "manifest.json"
+
+// Manifest describes an export.
+type Manifest struct {
+	Version   int       `json:"version"`
+	Generated time.Time `json:"generated"`
+	Site      Site      `json:"site"`
+	Pages     []Page    `json:"pages"`
+	Assets    []Asset   `json:"assets"`
+}
+
+// Site is the site the export was taken from.
+type Site struct {
+	Title   string `json:"title"`
+	BaseURL string `json:"base_url"`
+}
+
+// Page is a markdown file under content/: a post, a note, or a standalone
+// page like /search/.
+type Page struct {
+	// File is the page's path in the archive, and Source its path in the
+	// content directory.
+	File        string     `json:"file"`
+	Source      string     `json:"source"`
+	Title       string     `json:"title,omitempty"`
+	Section     string     `json:"section,omitempty"`
+	Slug        string     `json:"slug,omitempty"`
+	URL         string     `json:"url"`
+	Date        *time.Time `json:"date,omitempty"`
+	Lastmod     *time.Time `json:"lastmod,omitempty"`
+	PublishDate *time.Time `json:"publish_date,omitempty"`
+	Draft       bool       `json:"draft"`
+	Tags        []string   `json:"tags,omitempty"`
+	Series      string     `json:"series,omitempty"`
+	Part        int        `json:"part,omitempty"`
+	Summary     string     `json:"summary,omitempty"`
+	Description string     `json:"description,omitempty"`
+	// Assets are the archive paths of the static files the page
+	// references.
+	Assets []string `json:"assets,omitempty"`
+	SHA256 string   `json:"sha256"`
+}
+
+// Asset is a file under static/ that a page references.
+type Asset struct {
+	// File is the asset's path in the archive, and Src the root-relative
+	// URL path the pages reference it by.
+	File   string `json:"file"`
+	Src    string `json:"src"`
+	Type   string `json:"type,omitempty"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// Options says what to export.
+type Options struct {
+	// Content and Static are the site's directories.
+	Content string
+	Static  string
+	Site    Site
+	// Root is the folder the archive's files are under, so that it
+	// unpacks into one place.
+	Root string
+	// Time is the manifest's Generated and every entry's modification
+	// time.
+	Time time.Time
+}
+
+// entry is a file to write into the archive.
+type entry struct {
+	name string
+	data []byte
+}
+
+// Write writes the export as a gzipped tarball to w. Problems are the
+// references to images that aren't under Static; the export is written
+// without them.
+func Write(w io.Writer, o Options) (m *Manifest, problems []string, err error) {
+	names, err := markdownFiles(o.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+	m = &Manifest{Version: Version, Generated: o.Time.UTC(), Site: o.Site, Pages: []Page{}, Assets: []Asset{}}
+	var entries []entry
+	assets := map[string]*Asset{}
+	for _, rel := range names {
+		b, err := os.ReadFile(filepath.Join(o.Content, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, nil, err
+		}
+		p, err := content.Parse(rel, b)
+		if err != nil {
+			return nil, nil, err
+		}
+		out, err := Normalize(p, b)
+		if err != nil {
+			return nil, nil, err
+		}
+		pg := page(p, path.Join(o.Root, "content", rel), out)
+		for _, ref := range refs(p) {
+			a, ok := assets[ref.src]
+			if !ok {
+				f, found, err := asset(o, ref.src)
+				if err != nil {
+					return nil, nil, err
+				}
+				if !found {
+					if ref.image {
+						problems = append(problems, fmt.Sprintf("%s:%d: %s isn't under %s", rel, ref.line, ref.src, o.Static))
+					}
+					continue
+				}
+				a = &f.Asset
+				assets[ref.src] = a
+				entries = append(entries, entry{a.File, f.data})
+			}
+			if !slices.Contains(pg.Assets, a.File) {
+				pg.Assets = append(pg.Assets, a.File)
+			}
+		}
+		slices.Sort(pg.Assets)
+		m.Pages = append(m.Pages, pg)
+		entries = append(entries, entry{pg.File, out})
+	}
+	for _, src := range slices.Sorted(maps.Keys(assets)) {
+		m.Assets = append(m.Assets, *assets[src])
+	}
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	entries = append(entries, entry{path.Join(o.Root, ManifestName), append(mb, '\n')})
+	slices.SortFunc(entries, func(a, b entry) int { return cmp.Compare(a.name, b.name) })
+	return m, problems, writeTar(w, entries, o.Time)
+}
+
+// markdownFiles returns every markdown file under dir, standalone pages
+// and section indexes included, relative to dir with forward slashes.
+func markdownFiles(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".md" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("export: %w", err)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func page(p *content.Post, file string, out []byte) Page {
+	sum := sha256.Sum256(out)
+	pg := Page{
+		File: file, Source: p.Path, Title: p.Title, Section: p.Section,
+		Slug: p.Slug, URL: p.RelPermalink(), Draft: p.Draft, Tags: p.Tags,
+		Series: p.Series, Part: p.Part, Summary: p.Summary,
+		Description: p.Description, SHA256: hex.EncodeToString(sum[:]),
+	}
+	// Parse takes a standalone page's file name for its section, and a
+	// section's _index.md for a post in it.
+	switch {
+	case !strings.Contains(p.Path, "/"):
+		pg.Section = ""
+		if p.URL == "" {
+			pg.URL = "/" + strings.ToLower(p.Slug) + "/"
+		}
+	case path.Base(p.Path) == "_index.md":
+		pg.Slug = ""
+		if p.URL == "" {
+			pg.URL = "/" + strings.ToLower(path.Dir(p.Path)) + "/"
+		}
+	}
+	for _, t := range []struct {
+		v   time.Time
+		dst **time.Time
+	}{{p.Date, &pg.Date}, {p.Lastmod, &pg.Lastmod}, {p.PublishDate, &pg.PublishDate}} {
+		if !t.v.IsZero() {
+			v := t.v
+			*t.dst = &v
+		}
+	}
+	return pg
+}
+
+// keyOrder is the order of the keys Hugo and the tooling know; the rest
+// follow them alphabetically.
+var keyOrder = []string{
+	"title", "date", "lastmod", "publishDate", "expiryDate", "slug", "url",
+	"aliases", "tags", "series", "part", "draft", "layout", "summary",
+	"description",
+}
+
+// dateKeys are the keys content.Parse reads as dates.
+var dateKeys = map[string]bool{"date": true, "lastmod": true, "publishdate": true}
+
+// Normalize rewrites the front matter of b, the file p was parsed from,
+// as YAML: keys lowercased, except the ones Hugo spells in camel case, in
+// keyOrder, and dates as YAML timestamps. Comments in the front matter
+// are dropped; the body is kept as it is.
+func Normalize(p *content.Post, b []byte) ([]byte, error) {
+	fm, format, body, _, err := content.SplitFrontMatter(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Path, err)
+	}
+	if format == "" {
+		body = b
+	}
+	raw := map[string]any{}
+	switch format {
+	case content.TOML:
+		err = toml.Unmarshal(fm, &raw)
+	case content.YAML:
+		err = yaml.Unmarshal(fm, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: front matter: %w", p.Path, err)
+	}
+	vals := map[string]any{}
+	for k, v := range raw {
+		vals[strings.ToLower(k)] = v
+	}
+	order := make([]string, 0, len(vals))
+	for _, k := range keyOrder {
+		if _, ok := vals[strings.ToLower(k)]; ok {
+			order = append(order, k)
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(vals)) {
+		if !slices.ContainsFunc(order, func(o string) bool { return strings.EqualFold(o, k) }) {
+			order = append(order, k)
+		}
+	}
+
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range order {
+		v := vals[strings.ToLower(k)]
+		var n yaml.Node
+		if dateKeys[strings.ToLower(k)] {
+			n = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: date(p, k)}
+		} else if err := n.Encode(v); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", p.Path, k, err)
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: k}, &n)
+	}
+	var out bytes.Buffer
+	out.WriteString("---\n")
+	if len(doc.Content) > 0 {
+		enc := yaml.NewEncoder(&out)
+		enc.SetIndent(4)
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("%s: front matter: %w", p.Path, err)
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	}
+	out.WriteString("---\n")
+	out.Write(body)
+	return out.Bytes(), nil
+}
+
+// date formats the date at key as Parse read it: a plain date when it has
+// no time of day, or RFC 3339.
+func date(p *content.Post, key string) string {
+	t := p.Date
+	switch strings.ToLower(key) {
+	case "lastmod":
+		t = p.Lastmod
+	case "publishdate":
+		t = p.PublishDate
+	}
+	if t.Location() == time.UTC && t.Equal(t.Truncate(24*time.Hour)) {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// ref is a root-relative path a page references.
+type ref struct {
+	src   string
+	line  int
+	image bool
+}
+
+// htmlImgRe matches the src of an <img> written as HTML in a post.
+var htmlImgRe = regexp.MustCompile(`<img\s[^>]*\bsrc=["']([^"']+)["']`)
+
+// refs returns the root-relative paths p references: its links, images,
+// img shortcodes and their dark variants, <img> tags, and front matter
+// values like cover images and audio.
+func refs(p *content.Post) []ref {
+	var out []ref
+	add := func(dest string, line int, image bool) {
+		if src, ok := localPath(dest); ok {
+			out = append(out, ref{src, line, image})
+		}
+	}
+	for _, l := range markdown.Parse([]byte(p.Body), p.BodyLine).Links() {
+		add(l.Dest, l.Line, l.Image)
+	}
+	for _, r := range imgopt.Refs(p) {
+		add(r.Src, r.Line, true)
+		if r.Dark != "" {
+			add(r.Dark, r.Line, true)
+		}
+	}
+	for i, line := range strings.Split(p.Body, "\n") {
+		for _, m := range htmlImgRe.FindAllStringSubmatch(line, -1) {
+			add(m[1], p.BodyLine+i, true)
+		}
+	}
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case string:
+			add(v, 1, false)
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]any:
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				walk(v[k])
+			}
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(p.Params)) {
+		walk(p.Params[k])
+	}
+	return out
+}
+
+// localPath returns the URL path of dest if it's root-relative and names
+// a file, as opposed to a page, which ends in a slash or has no extension.
+func localPath(dest string) (string, bool) {
+	if !strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "//") {
+		return "", false
+	}
+	u, err := url.Parse(dest)
+	if err != nil || path.Ext(u.Path) == "" || strings.HasSuffix(u.Path, "/") {
+		return "", false
+	}
+	return path.Clean(u.Path), true
+}
+
+type file struct {
+	Asset
+	data []byte
+}
+
+// asset reads the file at the URL path src under Static, if there is one.
+func asset(o Options, src string) (file, bool, error) {
+	name := filepath.Join(o.Static, filepath.FromSlash(src))
+	if fi, err := os.Stat(name); err != nil || fi.IsDir() {
+		return file{}, false, nil
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return file{}, false, fmt.Errorf("export: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return file{
+		Asset: Asset{
+			File:   path.Join(o.Root, "static", strings.TrimPrefix(src, "/")),
+			Src:    src,
+			Type:   mime.TypeByExtension(path.Ext(src)),
+			Bytes:  int64(len(b)),
+			SHA256: hex.EncodeToString(sum[:]),
+		},
+		data: b,
+	}, true, nil
+}
+
+func writeTar(w io.Writer, entries []entry, mtime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	dirs := map[string]bool{}
+	for _, e := range entries {
+		for d := path.Dir(e.name); d != "." && !dirs[d]; d = path.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	for _, d := range slices.Sorted(maps.Keys(dirs)) {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: d + "/", Mode: 0o755, ModTime: mtime, Format: tar.FormatPAX}); err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+	}
+	for _, e := range entries {
+		h := &tar.Header{Typeflag: tar.TypeReg, Name: e.name, Mode: 0o644, Size: int64(len(e.data)), ModTime: mtime, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(h); err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Package feeds builds the site's syndication feeds: RSS 2.0, Atom, and
+// JSON Feed 1.1, each carrying the full rendered post, for the whole site,
+// for every tag, and for the notes, which are kept out of the others. Each
+// translated language gets its own under /<lang>/.
+//
+// Item IDs are the post's permalink, which matches what Hugo's RSS emitted
+// before, so existing subscribers don't see old posts resurface. Set `guid`
+// in a post's front matter to pin its ID before renaming its slug.
+package feeds
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/i18n"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/notes"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// Feed is a format-independent feed.
+type Feed struct {
+	Title       string
+	Description string
+	// Path is the site-relative directory the feed files are written to,
+	// e.g. "/" or "/tags/go/".
+	Path    string
+	HomeURL string
+	Author  string
+	// AuthorURL is the author's home page, the site root for every feed.
+	AuthorURL string
+	Language  string
+	Updated   time.Time
+	Items     []Item
+}
+
+// Item is one post in a feed.
+type Item struct {
+	ID          string
+	URL         string
+	Title       string
+	Summary     string
+	ContentHTML string
+	Published   time.Time
+	Updated     time.Time
+	Tags        []string
+}
+
+// Formats maps each feed file name to the function that encodes it.
+var Formats = map[string]func(f Feed, selfURL string) ([]byte, error){
+	"index.xml": RSS,
+	"atom.xml":  Atom,
+	"feed.json": JSONFeed,
+}
+
+// Build returns the site-wide feed, the notes feed, and one feed per tag,
+// in that order, followed by the same for each translated language under
+// /<lang>/, without the notes. Notes are only in their own feed. limit
+// caps the number of items per feed; 0 means no limit.
+func Build(cfg *site.Config, posts []*content.Post, limit int) ([]Feed, error) {
+	byLang := i18n.ByLang(content.Published(posts))
+	var feeds []Feed
+	for _, code := range cfg.Langs() {
+		lang, dir := code, "/"+code+"/"
+		if code == cfg.DefaultContentLanguage {
+			lang, dir = "", "/"
+		}
+		published := byLang[lang]
+		if lang != "" && len(published) == 0 {
+			continue
+		}
+		l := cfg.Language(code)
+		var items, noteItems []Item
+		byTag := map[string][]Item{}
+		tagNames := map[string]string{}
+		for _, p := range content.Notes(published) {
+			it, err := newItem(cfg, p)
+			if err != nil {
+				return nil, err
+			}
+			noteItems = append(noteItems, it)
+		}
+		for _, p := range content.Articles(published) {
+			it, err := newItem(cfg, p)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, it)
+			for _, t := range p.Tags {
+				slug := content.TagSlug(t)
+				byTag[slug] = append(byTag[slug], it)
+				if _, ok := tagNames[slug]; !ok {
+					tagNames[slug] = t
+				}
+			}
+		}
+
+		desc := cfg.Params.Description
+		if lang != "" {
+			desc = l.Title + " in " + cmp.Or(l.LanguageName, lang)
+		}
+		feeds = append(feeds, newFeed(cfg, l, l.Title, desc, dir, items, limit))
+		if lang == "" {
+			feeds = append(feeds, newFeed(cfg, l, "Notes on "+l.Title, "Short notes from "+cfg.Params.Author, "/"+content.NotesSection+"/", noteItems, limit))
+		}
+		slugs := make([]string, 0, len(byTag))
+		for s := range byTag {
+			slugs = append(slugs, s)
+		}
+		sort.Strings(slugs)
+		for _, s := range slugs {
+			name := tagNames[s]
+			feeds = append(feeds, newFeed(
+				cfg,
+				l,
+				name+" on "+l.Title,
+				"Posts tagged "+name+" on "+l.Title,
+				dir+"tags/"+s+"/",
+				byTag[s],
+				limit,
+			))
+		}
+	}
+	return feeds, nil
+}
+
+func newFeed(cfg *site.Config, l site.Language, title, desc, dir string, items []Item, limit int) Feed {
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	f := Feed{
+		Title:       title,
+		Description: desc,
+		Path:        dir,
+		HomeURL:     cfg.Permalink(dir),
+		Author:      cfg.Params.Author,
+		AuthorURL:   cfg.Permalink("/"),
+		Language:    l.LanguageCode,
+		Items:       items,
+	}
+	for _, it := range items {
+		if it.Updated.After(f.Updated) {
+			f.Updated = it.Updated
+		}
+	}
+	return f
+}
+
+// noteExcerptLen is how many characters of a note stand in for its title.
+const noteExcerptLen = 140
+
+func newItem(cfg *site.Config, p *content.Post) (Item, error) {
+	body, err := markdown.Render([]byte(p.Body))
+	if err != nil {
+		return Item{}, fmt.Errorf("%s: %w", p.Path, err)
+	}
+	u := cfg.Permalink(p.RelPermalink())
+	id := u
+	if g, ok := p.Params["guid"].(string); ok && g != "" {
+		id = g
+	}
+	summary := p.Description
+	if summary == "" {
+		summary = p.Summary
+	}
+	if p.IsNote() && summary == "" {
+		// Notes have no title, so readers show the start of the text.
+		summary = notes.Excerpt(p, noteExcerptLen)
+	}
+	return Item{
+		ID:          id,
+		URL:         u,
+		Title:       p.Title,
+		Summary:     summary,
+		ContentHTML: string(markdown.Absolutize(body, cfg.BaseURL)),
+		Published:   p.Date,
+		Updated:     p.Updated(),
+		Tags:        p.Tags,
+	}, nil
+}
+
+// Write encodes every feed in every format under dir, typically static/.
+// Files whose contents didn't change are left untouched. It returns the
+// paths written.
+func Write(dir string, cfg *site.Config, feeds []Feed) ([]string, error) {
+	names := make([]string, 0, len(Formats))
+	for n := range Formats {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var written []string
+	for _, f := range feeds {
+		for _, name := range names {
+			rel := path.Join(f.Path, name)
+			b, err := Formats[name](f, cfg.Permalink(rel))
+			if err != nil {
+				return written, fmt.Errorf("%s: %w", rel, err)
+			}
+			dst := filepath.Join(dir, filepath.FromSlash(rel))
+			wrote, err := fsutil.WriteIfChanged(dst, b)
+			if err != nil {
+				return written, err
+			}
+			if wrote {
+				written = append(written, dst)
+			}
+		}
+	}
+	return written, nil
+}
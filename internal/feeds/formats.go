@@ -0,0 +1,288 @@
+package feeds
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RSS encodes f as RSS 2.0 with the full post in content:encoded.
+func RSS(f Feed, selfURL string) ([]byte, error) {
+	type guid struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+	// Notes have no title; RSS only needs one of title and description.
+	type item struct {
+		Title       string   `xml:"title,omitempty"`
+		Link        string   `xml:"link"`
+		GUID        guid     `xml:"guid"`
+		PubDate     string   `xml:"pubDate"`
+		Description string   `xml:"description,omitempty"`
+		Categories  []string `xml:"category"`
+		Content     cdata    `xml:"content:encoded"`
+	}
+	type atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	}
+	type channel struct {
+		Title         string   `xml:"title"`
+		Link          string   `xml:"link"`
+		Description   string   `xml:"description"`
+		Language      string   `xml:"language"`
+		LastBuildDate string   `xml:"lastBuildDate,omitempty"`
+		AtomLink      atomLink `xml:"atom:link"`
+		Items         []item   `xml:"item"`
+	}
+	type rss struct {
+		XMLName   xml.Name `xml:"rss"`
+		Version   string   `xml:"version,attr"`
+		AtomNS    string   `xml:"xmlns:atom,attr"`
+		ContentNS string   `xml:"xmlns:content,attr"`
+		Channel   channel  `xml:"channel"`
+	}
+
+	ch := channel{
+		Title:       f.Title,
+		Link:        f.HomeURL,
+		Description: f.Description,
+		Language:    f.Language,
+		AtomLink:    atomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+	}
+	if !f.Updated.IsZero() {
+		ch.LastBuildDate = f.Updated.Format(time.RFC1123Z)
+	}
+	for _, it := range f.Items {
+		ch.Items = append(ch.Items, item{
+			Title:       it.Title,
+			Link:        it.URL,
+			GUID:        guid{IsPermaLink: it.ID == it.URL, Value: it.ID},
+			PubDate:     it.Published.Format(time.RFC1123Z),
+			Description: it.Summary,
+			Categories:  it.Tags,
+			Content:     cdata{it.ContentHTML},
+		})
+	}
+	return encodeXML(rss{
+		Version:   "2.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		Channel:   ch,
+	})
+}
+
+// Atom encodes f as an Atom 1.0 feed with the full post as HTML content.
+func Atom(f Feed, selfURL string) ([]byte, error) {
+	type link struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+		Type string `xml:"type,attr,omitempty"`
+	}
+	type text struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	}
+	type category struct {
+		Term string `xml:"term,attr"`
+	}
+	type entry struct {
+		Title      string     `xml:"title"`
+		ID         string     `xml:"id"`
+		Link       link       `xml:"link"`
+		Published  string     `xml:"published"`
+		Updated    string     `xml:"updated"`
+		Summary    *text      `xml:"summary,omitempty"`
+		Categories []category `xml:"category"`
+		Content    text       `xml:"content"`
+	}
+	type author struct {
+		Name string `xml:"name"`
+	}
+	type feed struct {
+		XMLName  xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Lang     string   `xml:"xml:lang,attr,omitempty"`
+		Title    string   `xml:"title"`
+		Subtitle string   `xml:"subtitle,omitempty"`
+		ID       string   `xml:"id"`
+		Links    []link   `xml:"link"`
+		Updated  string   `xml:"updated"`
+		Author   author   `xml:"author"`
+		Entries  []entry  `xml:"entry"`
+	}
+
+	out := feed{
+		Lang:     f.Language,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       f.HomeURL,
+		Links: []link{
+			{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.HomeURL, Rel: "alternate", Type: "text/html"},
+		},
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Author:  author{Name: f.Author},
+	}
+	for _, it := range f.Items {
+		// Atom requires a title, so a note's is its summary.
+		e := entry{
+			Title:     cmp.Or(it.Title, it.Summary),
+			ID:        it.ID,
+			Link:      link{Href: it.URL, Rel: "alternate", Type: "text/html"},
+			Published: it.Published.UTC().Format(time.RFC3339),
+			Updated:   it.Updated.UTC().Format(time.RFC3339),
+			Content:   text{Type: "html", Value: it.ContentHTML},
+		}
+		if it.Summary != "" {
+			e.Summary = &text{Type: "text", Value: it.Summary}
+		}
+		for _, t := range it.Tags {
+			e.Categories = append(e.Categories, category{Term: t})
+		}
+		out.Entries = append(out.Entries, e)
+	}
+	return encodeXML(out)
+}
+
+// JSONFeedVersion is the spec version the JSON feed declares.
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// JSONFeedDoc is the JSON Feed 1.1 top-level object.
+// See https://www.jsonfeed.org/version/1.1/.
+type JSONFeedDoc struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+// JSONFeedAuthor is an entry in a JSON Feed authors array.
+type JSONFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// JSONFeedItem is a JSON Feed item object.
+type JSONFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url,omitempty"`
+	Title         string   `json:"title,omitempty"`
+	ContentHTML   string   `json:"content_html,omitempty"`
+	ContentText   string   `json:"content_text,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	DatePublished string   `json:"date_published,omitempty"`
+	DateModified  string   `json:"date_modified,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// JSONFeed encodes f as JSON Feed 1.1. The document is validated against the
+// spec's requirements before it's returned.
+func JSONFeed(f Feed, selfURL string) ([]byte, error) {
+	doc := JSONFeedDoc{
+		Version:     JSONFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     selfURL,
+		Description: f.Description,
+		Language:    f.Language,
+		Items:       []JSONFeedItem{},
+	}
+	if f.Author != "" {
+		doc.Authors = []JSONFeedAuthor{{Name: f.Author, URL: f.AuthorURL}}
+	}
+	for _, it := range f.Items {
+		doc.Items = append(doc.Items, JSONFeedItem{
+			ID:            it.ID,
+			URL:           it.URL,
+			Title:         it.Title,
+			ContentHTML:   it.ContentHTML,
+			Summary:       it.Summary,
+			DatePublished: it.Published.UTC().Format(time.RFC3339),
+			DateModified:  it.Updated.UTC().Format(time.RFC3339),
+			Tags:          it.Tags,
+		})
+	}
+	if err := ValidateJSONFeed(doc); err != nil {
+		return nil, err
+	}
+	// Keep the HTML readable instead of escaping every angle bracket.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateJSONFeed checks doc against the MUSTs of the JSON Feed 1.1 spec:
+// the version URL, a title, an items array, and for every item a unique,
+// non-empty id, content_html or content_text, and RFC 3339 dates.
+func ValidateJSONFeed(doc JSONFeedDoc) error {
+	var errs []error
+	if doc.Version != JSONFeedVersion {
+		errs = append(errs, fmt.Errorf("version must be %s", JSONFeedVersion))
+	}
+	if doc.Title == "" {
+		errs = append(errs, errors.New("title is required"))
+	}
+	if doc.Items == nil {
+		errs = append(errs, errors.New("items is required"))
+	}
+	for _, a := range doc.Authors {
+		if a.Name == "" && a.URL == "" {
+			errs = append(errs, errors.New("author must have a name or url"))
+		}
+	}
+	seen := map[string]bool{}
+	for i, it := range doc.Items {
+		if it.ID == "" {
+			errs = append(errs, fmt.Errorf("items[%d]: id is required", i))
+		} else if seen[it.ID] {
+			errs = append(errs, fmt.Errorf("items[%d]: duplicate id %q", i, it.ID))
+		}
+		seen[it.ID] = true
+		if it.ContentHTML == "" && it.ContentText == "" {
+			errs = append(errs, fmt.Errorf("items[%d]: content_html or content_text is required", i))
+		}
+		for field, v := range map[string]string{
+			"date_published": it.DatePublished,
+			"date_modified":  it.DateModified,
+		} {
+			if _, err := time.Parse(time.RFC3339, v); v != "" && err != nil {
+				errs = append(errs, fmt.Errorf("items[%d]: %s is not RFC 3339", i, field))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid JSON feed: %w", err)
+	}
+	return nil
+}
+
+// cdata wraps HTML in a CDATA section so feed readers get it verbatim.
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+func encodeXML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
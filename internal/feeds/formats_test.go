@@ -0,0 +1,212 @@
+package feeds
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// feedConfig has just what the feeds' top level is built from.
+func feedConfig() *site.Config {
+	cfg := &site.Config{BaseURL: "https://notes.example.org", Title: "Field notes", LanguageCode: "en-gb"}
+	cfg.Params.Author = "Sam Ortiz"
+	cfg.Params.Description = "Short pieces on Go"
+	return cfg
+}
+
+func testPosts() []*content.Post {
+	at := func(day int) time.Time { return time.Date(2024, 3, day, 9, 30, 0, 0, time.FixedZone("BST", 6*60*60)) }
+	return []*content.Post{
+		{
+			FrontMatter: content.FrontMatter{
+				Title:   "Testing in Go",
+				Date:    at(1),
+				Lastmod: at(4),
+				Tags:    []string{"Go"},
+			},
+			Path:    "go/testing.md",
+			Section: "go",
+			Slug:    "testing",
+			Body:    "Use `t.Run` & <b>subtests</b>.\n",
+		},
+		{
+			FrontMatter: content.FrontMatter{
+				Title:  "Renamed",
+				Date:   at(2),
+				Tags:   []string{"Go"},
+				Params: map[string]any{"guid": "https://notes.example.org/go/old-name/"},
+			},
+			Path:    "go/renamed.md",
+			Section: "go",
+			Slug:    "renamed",
+			Body:    "Moved.\n",
+		},
+		{
+			FrontMatter: content.FrontMatter{Title: "Draft", Date: at(3), Draft: true},
+			Path:        "go/draft.md",
+			Section:     "go",
+			Slug:        "draft",
+			Body:        "Not yet.\n",
+		},
+	}
+}
+
+// jsonFeed builds the site-wide feed from testPosts and decodes it without
+// the package's own types, the way a reader would.
+func jsonFeed(t *testing.T) map[string]any {
+	t.Helper()
+	feeds, err := Build(feedConfig(), testPosts(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := JSONFeed(feeds[0], "https://notes.example.org/feed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("feed.json isn't JSON: %v\n%s", err, b)
+	}
+	return doc
+}
+
+func TestJSONFeedTopLevel(t *testing.T) {
+	doc := jsonFeed(t)
+	want := map[string]string{
+		"version":       "https://jsonfeed.org/version/1.1",
+		"title":         "Field notes",
+		"home_page_url": "https://notes.example.org/",
+		"feed_url":      "https://notes.example.org/feed.json",
+		"description":   "Short pieces on Go",
+		"language":      "en-gb",
+	}
+	for k, v := range want {
+		if doc[k] != v {
+			t.Errorf("%s = %v, want %q", k, doc[k], v)
+		}
+	}
+	// 1.1 replaced author with an authors array.
+	if _, ok := doc["author"]; ok {
+		t.Error("has the 1.0 author field")
+	}
+	authors, _ := doc["authors"].([]any)
+	if len(authors) != 1 {
+		t.Fatalf("authors = %v, want one", doc["authors"])
+	}
+	if a, _ := authors[0].(map[string]any); a["name"] != "Sam Ortiz" || a["url"] != "https://notes.example.org/" {
+		t.Errorf("authors[0] = %v, want the site's author", a)
+	}
+}
+
+func TestJSONFeedItems(t *testing.T) {
+	items, ok := jsonFeed(t)["items"].([]any)
+	if !ok {
+		t.Fatal("items isn't an array")
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want the two published posts", len(items))
+	}
+	byURL := map[string]map[string]any{}
+	seen := map[string]bool{}
+	for i, v := range items {
+		it, _ := v.(map[string]any)
+		id, _ := it["id"].(string)
+		if id == "" || seen[id] {
+			t.Errorf("items[%d].id = %v, want a unique string", i, it["id"])
+		}
+		seen[id] = true
+		if html, _ := it["content_html"].(string); html == "" {
+			if text, _ := it["content_text"].(string); text == "" {
+				t.Errorf("items[%d] has neither content_html nor content_text", i)
+			}
+		}
+		for _, k := range []string{"date_published", "date_modified"} {
+			s, _ := it[k].(string)
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				t.Errorf("items[%d].%s = %q isn't RFC 3339", i, k, s)
+			}
+		}
+		byURL[it["url"].(string)] = it
+	}
+
+	it := byURL["https://notes.example.org/go/testing/"]
+	if it == nil {
+		t.Fatalf("no item for the testing post in %v", items)
+	}
+	if it["id"] != "https://notes.example.org/go/testing/" {
+		t.Errorf("id = %v, want the permalink", it["id"])
+	}
+	if html := it["content_html"].(string); !strings.Contains(html, "<code>t.Run</code> &amp; <b>subtests</b>") {
+		t.Errorf("content_html = %q, want the rendered post", html)
+	}
+	if it["date_published"] != "2024-03-01T03:30:00Z" || it["date_modified"] != "2024-03-04T03:30:00Z" {
+		t.Errorf("dates = %v and %v, want the date and lastmod in UTC", it["date_published"], it["date_modified"])
+	}
+	if tags, _ := json.Marshal(it["tags"]); string(tags) != `["Go"]` {
+		t.Errorf("tags = %s", tags)
+	}
+
+	renamed := byURL["https://notes.example.org/go/renamed/"]
+	if renamed["id"] != "https://notes.example.org/go/old-name/" {
+		t.Errorf("id = %v, want the guid from the front matter", renamed["id"])
+	}
+	if renamed["date_modified"] != renamed["date_published"] {
+		t.Errorf("date_modified = %v, want the date for a post without lastmod", renamed["date_modified"])
+	}
+}
+
+func TestJSONFeedEmpty(t *testing.T) {
+	b, err := JSONFeed(Feed{Title: "Empty"}, "https://notes.example.org/feed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// items is required even when there are none.
+	if !strings.Contains(string(b), `"items": []`) {
+		t.Errorf("feed without items = %s, want an empty items array", b)
+	}
+}
+
+func TestValidateJSONFeed(t *testing.T) {
+	valid := func() JSONFeedDoc {
+		return JSONFeedDoc{
+			Version: JSONFeedVersion,
+			Title:   "T",
+			Items: []JSONFeedItem{
+				{ID: "a", ContentHTML: "<p>a</p>", DatePublished: "2024-03-01T00:00:00Z"},
+				{ID: "b", ContentText: "b", DateModified: "2024-03-01T00:00:00+06:00"},
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(*JSONFeedDoc)
+		want   string // in the error; "" for none
+	}{
+		{"valid", func(*JSONFeedDoc) {}, ""},
+		{"version 1", func(d *JSONFeedDoc) { d.Version = "https://jsonfeed.org/version/1" }, "version must be"},
+		{"no title", func(d *JSONFeedDoc) { d.Title = "" }, "title is required"},
+		{"no items", func(d *JSONFeedDoc) { d.Items = nil }, "items is required"},
+		{"no id", func(d *JSONFeedDoc) { d.Items[0].ID = "" }, "items[0]: id is required"},
+		{"duplicate id", func(d *JSONFeedDoc) { d.Items[1].ID = "a" }, `items[1]: duplicate id "a"`},
+		{"no content", func(d *JSONFeedDoc) { d.Items[1].ContentText = "" }, "items[1]: content_html or content_text"},
+		{"bad date", func(d *JSONFeedDoc) { d.Items[0].DatePublished = "Fri, 01 Mar 2024 00:00:00 +0000" }, "items[0]: date_published is not RFC 3339"},
+		{"empty author", func(d *JSONFeedDoc) { d.Authors = []JSONFeedAuthor{{}} }, "name or url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := valid()
+			tt.modify(&doc)
+			err := ValidateJSONFeed(doc)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("got %v, want no error", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got %v, want an error about %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+// Package fingerprint renames the built site's stylesheets, scripts,
+// images, and fonts to name.<hash>.ext, after a hash of their contents, and
+// rewrites the pages and stylesheets that reference them, so every asset
+// can be cached as immutable: a changed file gets a new URL instead of a
+// stale copy at the edge. The renames are recorded in a manifest in the
+// build.
+package fingerprint
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// ManifestFile is the manifest's name in the built site. It maps each
+// original URL path to its fingerprinted one.
+const ManifestFile = "assets.json"
+
+// CacheControl is what fingerprinted files can be served with.
+const CacheControl = "public, max-age=31536000, immutable"
+
+// Exts are the extensions of the files that are fingerprinted.
+var Exts = []string{
+	".css", ".js", ".mjs",
+	".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg", ".ico",
+	".woff", ".woff2", ".ttf", ".otf",
+	".mp4", ".webm", ".mp3",
+}
+
+// DefaultKeep are the paths whose originals are kept beside the
+// fingerprinted copies: the icons browsers ask for by name or find in
+// site.webmanifest, and the images that feeds and other sites link to
+// directly.
+var DefaultKeep = []string{"/favicon.ico", "/apple-touch-icon.png", "/icon-*", "/images/*"}
+
+// hashLen is the number of hex digits of the hash names carry.
+const hashLen = 10
+
+var hashedRe = regexp.MustCompile(`\.[0-9a-f]{10,}\.[^./]+$`)
+
+// Hashed reports whether the file at urlPath already carries a hash in its
+// name, from this package or from Hugo's fingerprint pipe.
+func Hashed(urlPath string) bool {
+	return hashedRe.MatchString(path.Base(urlPath))
+}
+
+// Name returns the fingerprinted name of the file at urlPath with contents
+// b.
+func Name(urlPath string, b []byte) string {
+	sum := sha256.Sum256(b)
+	ext := path.Ext(urlPath)
+	return strings.TrimSuffix(urlPath, ext) + "." + hex.EncodeToString(sum[:])[:hashLen] + ext
+}
+
+// Manifest maps original URL paths to fingerprinted ones.
+type Manifest map[string]string
+
+// Load reads the manifest in the built site dir. A missing manifest is
+// empty.
+func Load(dir string) (Manifest, error) {
+	m := Manifest{}
+	b, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("fingerprint: %s: %w", ManifestFile, err)
+	}
+	return m, nil
+}
+
+// Stats counts what Run did.
+type Stats struct {
+	// Assets is the number of files fingerprinted, Pages the number of
+	// pages rewritten.
+	Assets, Pages int
+}
+
+// Run fingerprints the assets in dir, the site built for base, and
+// rewrites the references to them. Originals matching keep, exact paths
+// or prefixes ending in *, stay in place. Files fingerprinted by an
+// earlier run are left alone, so Run can run again on the same build.
+func Run(dir string, base *url.URL, keep []string) (Stats, error) {
+	var st Stats
+	m, err := Load(dir)
+	if err != nil {
+		return st, err
+	}
+	for from, to := range m {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(to))); err != nil {
+			delete(m, from)
+		}
+	}
+	var assets, styles, pages []string
+	err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		u := "/" + filepath.ToSlash(rel)
+		ext := strings.ToLower(path.Ext(u))
+		switch {
+		case ext == ".html":
+			pages = append(pages, u)
+		case !slices.Contains(Exts, ext) || Hashed(u) || m[u] != "":
+		case ext == ".css":
+			styles = append(styles, u)
+		default:
+			assets = append(assets, u)
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+	r := &rewriter{dir: dir, base: base, m: m}
+
+	rename := func(u string, b []byte) error {
+		to := Name(u, b)
+		dst := filepath.Join(dir, filepath.FromSlash(to))
+		if err := os.WriteFile(dst, b, 0o644); err != nil {
+			return err
+		}
+		if !matchAny(keep, u) {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(u))); err != nil {
+				return err
+			}
+		}
+		m[u] = to
+		st.Assets++
+		return nil
+	}
+	for _, u := range assets {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(u)))
+		if err != nil {
+			return st, err
+		}
+		if err := rename(u, b); err != nil {
+			return st, err
+		}
+	}
+	// Stylesheets go last, since the url()s in them change their hashes.
+	for _, u := range styles {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(u)))
+		if err != nil {
+			return st, err
+		}
+		if err := rename(u, []byte(r.css(base.JoinPath(u), string(b)))); err != nil {
+			return st, err
+		}
+	}
+
+	for _, u := range pages {
+		file := filepath.Join(dir, filepath.FromSlash(u))
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return st, err
+		}
+		page := u
+		if path.Base(u) == "index.html" {
+			page = strings.TrimSuffix(u, "index.html")
+		}
+		out, err := r.page(base.JoinPath(page), b)
+		if err != nil {
+			return st, fmt.Errorf("fingerprint: %s: %w", file, err)
+		}
+		if bytes.Equal(out, b) {
+			continue
+		}
+		if err := os.WriteFile(file, out, 0o644); err != nil {
+			return st, err
+		}
+		st.Pages++
+	}
+
+	_, err = fsutil.WriteJSONIfChanged(filepath.Join(dir, ManifestFile), m)
+	return st, err
+}
+
+func matchAny(patterns []string, u string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(u, prefix) || u == p {
+			return true
+		}
+	}
+	return false
+}
+
+type rewriter struct {
+	dir  string
+	base *url.URL
+	m    Manifest
+}
+
+// ref returns ref, a reference from the document at doc, pointed at its
+// asset's fingerprinted copy, and whether it changed. References keep
+// their query and fragment, and absolute ones stay absolute.
+func (r *rewriter) ref(doc *url.URL, ref string) (string, bool) {
+	trimmed := strings.TrimSpace(ref)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "data:") {
+		return ref, false
+	}
+	u, err := doc.Parse(trimmed)
+	if err != nil || u.Host != r.base.Host || (u.Scheme != "http" && u.Scheme != "https") {
+		return ref, false
+	}
+	to, ok := r.m[u.Path]
+	if !ok {
+		return ref, false
+	}
+	out := &url.URL{Path: to, RawQuery: u.RawQuery, Fragment: u.Fragment}
+	if orig, err := url.Parse(trimmed); err == nil && orig.IsAbs() {
+		out.Scheme, out.Host = u.Scheme, u.Host
+	}
+	return out.String(), true
+}
+
+var (
+	cssURLRe    = regexp.MustCompile(`url\(\s*(['"]?)([^'")]+?)(['"]?)\s*\)`)
+	cssImportRe = regexp.MustCompile(`@import\s+(['"])([^'"]+)(['"])`)
+)
+
+// css rewrites the url()s and @imports of the stylesheet at doc.
+func (r *rewriter) css(doc *url.URL, s string) string {
+	for _, re := range []*regexp.Regexp{cssURLRe, cssImportRe} {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			sm := re.FindStringSubmatch(match)
+			if sm[1] != sm[3] {
+				return match
+			}
+			to, ok := r.ref(doc, sm[2])
+			if !ok {
+				return match
+			}
+			return strings.Replace(match, sm[2], to, 1)
+		})
+	}
+	return s
+}
+
+// srcset rewrites each candidate's URL in a srcset.
+func (r *rewriter) srcset(doc *url.URL, set string) (string, bool) {
+	cs := strings.Split(set, ",")
+	changed := false
+	for i, c := range cs {
+		f := strings.Fields(c)
+		if len(f) == 0 {
+			continue
+		}
+		if to, ok := r.ref(doc, f[0]); ok {
+			f[0] = to
+			changed = true
+		}
+		cs[i] = strings.Join(f, " ")
+	}
+	return strings.Join(cs, ", "), changed
+}
+
+// page rewrites the references in the HTML page at doc: the URL attributes
+// of its elements, its srcsets, its Open Graph and Twitter images, and the
+// url()s in its styles. Subresource integrity hashes of the assets whose
+// contents changed are recomputed.
+func (r *rewriter) page(doc *url.URL, b []byte) ([]byte, error) {
+	root, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	var walk func(n *html.Node) error
+	walk = func(n *html.Node) error {
+		switch {
+		case n.Type == html.ElementNode:
+			var target string
+			isMeta := n.Data == "meta" && strings.Contains(attr(n, "property")+attr(n, "name"), "image")
+			for i, a := range n.Attr {
+				var (
+					to string
+					ok bool
+				)
+				switch {
+				case a.Key == "src" || a.Key == "href" || a.Key == "poster" || a.Key == "data" || a.Key == "content" && isMeta:
+					if to, ok = r.ref(doc, a.Val); ok && a.Key != "content" {
+						target = to
+					}
+				case a.Key == "srcset" || a.Key == "imagesrcset":
+					to, ok = r.srcset(doc, a.Val)
+				case a.Key == "style":
+					to = r.css(doc, a.Val)
+					ok = to != a.Val
+				}
+				if ok {
+					n.Attr[i].Val = to
+					changed = true
+				}
+			}
+			if target != "" {
+				if err := r.integrity(n, doc, target); err != nil {
+					return err
+				}
+			}
+		case n.Type == html.TextNode && n.Parent != nil && n.Parent.Data == "style":
+			if s := r.css(doc, n.Data); s != n.Data {
+				n.Data = s
+				changed = true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	if !changed {
+		return b, nil
+	}
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// integrity updates n's integrity attribute, if it has one, to the
+// contents of target, in the same algorithm.
+func (r *rewriter) integrity(n *html.Node, doc *url.URL, target string) error {
+	for i, a := range n.Attr {
+		if a.Key != "integrity" {
+			continue
+		}
+		u, err := doc.Parse(target)
+		if err != nil {
+			return nil
+		}
+		b, err := os.ReadFile(filepath.Join(r.dir, filepath.FromSlash(u.Path)))
+		if err != nil {
+			return err
+		}
+		n.Attr[i].Val = Integrity(a.Val, b)
+	}
+	return nil
+}
+
+// Integrity returns the subresource integrity hash of b in the algorithm
+// of old, an integrity attribute's value. An algorithm it doesn't know
+// leaves old as it is.
+func Integrity(old string, b []byte) string {
+	algo, _, _ := strings.Cut(strings.TrimSpace(old), "-")
+	var h hash.Hash
+	switch algo {
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return old
+	}
+	h.Write(b)
+	return algo + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
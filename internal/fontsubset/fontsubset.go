@@ -0,0 +1,240 @@
+// Package fontsubset cuts web fonts down to the glyphs a site uses. The
+// font keeps its glyph IDs, with the outlines of unused glyphs emptied and
+// their characters dropped from the character map, so browsers fall back
+// to another font for them. Keeping the IDs keeps the layout tables valid,
+// and with them kerning and the ligatures and contextual alternates of
+// code fonts, whose glyphs are kept by following the substitutions.
+package fontsubset
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"sort"
+
+	"github.com/tdewolff/font"
+)
+
+// Result describes a subset font.
+type Result struct {
+	// WOFF2 is the subset font.
+	WOFF2 []byte
+	// Runes are the characters the subset maps, in order.
+	Runes []rune
+	// Glyphs is the number of glyphs with outlines kept, of Total.
+	Glyphs, Total int
+}
+
+// ErrCFF is returned for fonts with CFF outlines, which can't be emptied
+// glyph by glyph without renumbering them.
+var ErrCFF = errors.New("fontsubset: only TrueType outlines are subset")
+
+// Subset returns the font in b, a WOFF2, WOFF, TTF, or OTF file, cut down
+// to runes and written as WOFF2.
+func Subset(b []byte, runes []rune) (*Result, error) {
+	sfntBytes, err := font.ToSFNT(b)
+	if err != nil {
+		return nil, fmt.Errorf("fontsubset: %w", err)
+	}
+	sfnt, err := font.ParseSFNT(sfntBytes, 0)
+	if err != nil {
+		return nil, fmt.Errorf("fontsubset: %w", err)
+	}
+	if !sfnt.IsTrueType || sfnt.Glyf == nil {
+		return nil, ErrCFF
+	}
+	n := int(sfnt.NumGlyphs())
+
+	res := &Result{Total: n}
+	cmap := map[rune]uint16{}
+	keep := map[uint16]bool{0: true}
+	for _, r := range runes {
+		if g := sfnt.GlyphIndex(r); g != 0 {
+			cmap[r] = g
+			keep[g] = true
+		}
+	}
+	closure(table(sfnt.Tables["GSUB"]), keep)
+	for g := range keep {
+		if int(g) >= n {
+			delete(keep, g)
+			continue
+		}
+		deps, err := sfnt.Glyf.Dependencies(g)
+		if err != nil {
+			return nil, fmt.Errorf("fontsubset: %w", err)
+		}
+		for _, d := range deps {
+			keep[d] = true
+		}
+	}
+
+	// glyf and loca, in the long format.
+	var glyf []byte
+	loca := make([]byte, 4*(n+1))
+	for g := range n {
+		binary.BigEndian.PutUint32(loca[4*g:], uint32(len(glyf)))
+		if keep[uint16(g)] {
+			glyf = append(glyf, sfnt.Glyf.Get(uint16(g))...)
+			for len(glyf)%4 != 0 {
+				glyf = append(glyf, 0)
+			}
+			res.Glyphs++
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*n:], uint32(len(glyf)))
+
+	tables := map[string][]byte{}
+	for tag, t := range sfnt.Tables {
+		switch tag {
+		case "DSIG":
+			// A signature doesn't survive the changes.
+		case "head":
+			head := slices.Clone(t)
+			binary.BigEndian.PutUint16(head[50:], 1) // indexToLocFormat
+			tables[tag] = head
+		default:
+			tables[tag] = t
+		}
+	}
+	tables["glyf"] = glyf
+	tables["loca"] = loca
+	tables["cmap"] = writeCmap(cmap)
+
+	sub, err := font.ParseSFNT(writeSFNT(tables), 0)
+	if err != nil {
+		return nil, fmt.Errorf("fontsubset: subset: %w", err)
+	}
+	if res.WOFF2, err = sub.WriteWOFF2(); err != nil {
+		return nil, fmt.Errorf("fontsubset: %w", err)
+	}
+	for r := range cmap {
+		res.Runes = append(res.Runes, r)
+	}
+	slices.Sort(res.Runes)
+	return res, nil
+}
+
+// writeCmap returns a character map of m: a format 4 subtable for the
+// Basic Multilingual Plane, which every browser reads, and a format 12 one
+// for all of it.
+func writeCmap(m map[rune]uint16) []byte {
+	runes := make([]rune, 0, len(m))
+	for r := range m {
+		runes = append(runes, r)
+	}
+	slices.Sort(runes)
+
+	// Runs of consecutive characters mapped to consecutive glyphs.
+	type run struct {
+		start, end rune
+		glyph      uint16
+	}
+	var runs []run
+	for _, r := range runes {
+		if k := len(runs) - 1; k >= 0 && runs[k].end == r-1 && m[r] == runs[k].glyph+uint16(r-runs[k].start) {
+			runs[k].end = r
+			continue
+		}
+		runs = append(runs, run{r, r, m[r]})
+	}
+
+	var bmp []run
+	for _, r := range runs {
+		if r.end <= 0xFFFE {
+			bmp = append(bmp, r)
+		}
+	}
+	seg := len(bmp) + 1
+	f4 := make([]byte, 16+8*seg)
+	entry := bits.Len(uint(seg)) - 1
+	put16 := func(b []byte, off, v int) { binary.BigEndian.PutUint16(b[off:], uint16(v)) }
+	put16(f4, 0, 4)
+	put16(f4, 2, len(f4))
+	put16(f4, 6, 2*seg)
+	put16(f4, 8, 2<<entry)
+	put16(f4, 10, entry)
+	put16(f4, 12, 2*seg-2<<entry)
+	ends, starts, deltas := 14, 16+2*seg, 16+4*seg
+	for i, r := range bmp {
+		put16(f4, ends+2*i, int(r.end))
+		put16(f4, starts+2*i, int(r.start))
+		put16(f4, deltas+2*i, int(r.glyph)-int(r.start))
+	}
+	put16(f4, ends+2*(seg-1), 0xFFFF)
+	put16(f4, starts+2*(seg-1), 0xFFFF)
+	put16(f4, deltas+2*(seg-1), 1)
+
+	f12 := make([]byte, 16+12*len(runs))
+	put16(f12, 0, 12)
+	binary.BigEndian.PutUint32(f12[4:], uint32(len(f12)))
+	binary.BigEndian.PutUint32(f12[12:], uint32(len(runs)))
+	for i, r := range runs {
+		off := 16 + 12*i
+		binary.BigEndian.PutUint32(f12[off:], uint32(r.start))
+		binary.BigEndian.PutUint32(f12[off+4:], uint32(r.end))
+		binary.BigEndian.PutUint32(f12[off+8:], uint32(r.glyph))
+	}
+
+	cmap := make([]byte, 20, 20+len(f4)+len(f12))
+	put16(cmap, 2, 2)
+	put16(cmap, 4, 3)
+	put16(cmap, 6, 1)
+	binary.BigEndian.PutUint32(cmap[8:], 20)
+	put16(cmap, 12, 3)
+	put16(cmap, 14, 10)
+	binary.BigEndian.PutUint32(cmap[16:], uint32(20+len(f4)))
+	return append(append(cmap, f4...), f12...)
+}
+
+// writeSFNT lays out tables as a TrueType font. Unlike the font package's
+// writer it leaves the modification date alone, so the same input always
+// gives the same file.
+func writeSFNT(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	n := len(tags)
+	entry := bits.Len(uint(n)) - 1
+	b := make([]byte, 12+16*n)
+	binary.BigEndian.PutUint32(b, 0x00010000)
+	binary.BigEndian.PutUint16(b[4:], uint16(n))
+	binary.BigEndian.PutUint16(b[6:], uint16(16<<entry))
+	binary.BigEndian.PutUint16(b[8:], uint16(entry))
+	binary.BigEndian.PutUint16(b[10:], uint16(16*n-16<<entry))
+	headAt := -1
+	for i, tag := range tags {
+		t := tables[tag]
+		off := len(b)
+		if tag == "head" {
+			headAt = off
+			t = slices.Clone(t)
+			binary.BigEndian.PutUint32(t[8:], 0) // checksumAdjustment
+		}
+		b = append(b, t...)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		rec := 12 + 16*i
+		copy(b[rec:], tag)
+		binary.BigEndian.PutUint32(b[rec+4:], checksum(b[off:]))
+		binary.BigEndian.PutUint32(b[rec+8:], uint32(off))
+		binary.BigEndian.PutUint32(b[rec+12:], uint32(len(t)))
+	}
+	if headAt >= 0 {
+		binary.BigEndian.PutUint32(b[headAt+8:], 0xB1B0AFBA-checksum(b))
+	}
+	return b
+}
+
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i+4 <= len(b); i += 4 {
+		sum += binary.BigEndian.Uint32(b[i:])
+	}
+	return sum
+}
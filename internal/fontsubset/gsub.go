@@ -0,0 +1,147 @@
+package fontsubset
+
+import "encoding/binary"
+
+// table reads big-endian fields from a font table, as zero past its end,
+// so a malformed table yields empty results rather than a panic.
+type table []byte
+
+func (t table) u16(off int) int {
+	if off < 0 || off+2 > len(t) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(t[off:]))
+}
+
+func (t table) u32(off int) int {
+	if off < 0 || off+4 > len(t) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(t[off:]))
+}
+
+func (t table) at(off int) table {
+	if off < 0 || off > len(t) {
+		return nil
+	}
+	return t[off:]
+}
+
+// coverage returns the glyphs of the coverage table at t with their
+// coverage indexes.
+func coverage(t table) map[uint16]int {
+	glyphs := map[uint16]int{}
+	switch t.u16(0) {
+	case 1:
+		for i := range t.u16(2) {
+			glyphs[uint16(t.u16(4+2*i))] = i
+		}
+	case 2:
+		for i := range t.u16(2) {
+			r := 4 + 6*i
+			start, end, index := t.u16(r), t.u16(r+2), t.u16(r+4)
+			for g := start; g <= end; g++ {
+				glyphs[uint16(g)] = index + g - start
+			}
+		}
+	}
+	return glyphs
+}
+
+// subtables returns the GSUB lookup subtables by type, with extension
+// subtables (type 7) resolved to the ones they wrap.
+func subtables(gsub table) map[int][]table {
+	out := map[int][]table{}
+	list := gsub.at(gsub.u16(8))
+	for i := range list.u16(0) {
+		lookup := list.at(list.u16(2 + 2*i))
+		typ := lookup.u16(0)
+		for j := range lookup.u16(4) {
+			sub := lookup.at(lookup.u16(6 + 2*j))
+			t := typ
+			if t == 7 {
+				t = sub.u16(2)
+				sub = sub.at(sub.u32(4))
+			}
+			out[t] = append(out[t], sub)
+		}
+	}
+	return out
+}
+
+// closure adds to glyphs every glyph the font's GSUB table can substitute
+// for them: single, multiple, and alternate substitutes, ligatures whose
+// components are all kept, and reverse chaining substitutes. Contextual
+// lookups only pick which of those apply, so every one is assumed to,
+// which keeps more glyphs than needed but never too few; it's how code
+// fonts' ligatures and contextual alternates survive.
+func closure(gsub table, glyphs map[uint16]bool) {
+	if len(gsub) == 0 {
+		return
+	}
+	subs := subtables(gsub)
+	for changed := true; changed; {
+		changed = false
+		add := func(g int) {
+			if !glyphs[uint16(g)] {
+				glyphs[uint16(g)] = true
+				changed = true
+			}
+		}
+		for _, sub := range subs[1] {
+			for g, i := range coverage(sub.at(sub.u16(2))) {
+				if !glyphs[g] {
+					continue
+				}
+				if sub.u16(0) == 1 {
+					add(int(uint16(int(g) + int(int16(sub.u16(4))))))
+				} else {
+					add(sub.u16(6 + 2*i))
+				}
+			}
+		}
+		// Multiple and alternate substitutions share a layout: a glyph
+		// list per covered glyph.
+		for _, typ := range []int{2, 3} {
+			for _, sub := range subs[typ] {
+				for g, i := range coverage(sub.at(sub.u16(2))) {
+					if !glyphs[g] {
+						continue
+					}
+					seq := sub.at(sub.u16(6 + 2*i))
+					for k := range seq.u16(0) {
+						add(seq.u16(2 + 2*k))
+					}
+				}
+			}
+		}
+		for _, sub := range subs[4] {
+			for g, i := range coverage(sub.at(sub.u16(2))) {
+				if !glyphs[g] {
+					continue
+				}
+				set := sub.at(sub.u16(6 + 2*i))
+			ligatures:
+				for k := range set.u16(0) {
+					lig := set.at(set.u16(2 + 2*k))
+					for c := 1; c < lig.u16(2); c++ {
+						if !glyphs[uint16(lig.u16(4+2*(c-1)))] {
+							continue ligatures
+						}
+					}
+					add(lig.u16(0))
+				}
+			}
+		}
+		for _, sub := range subs[8] {
+			back := sub.u16(4)
+			ahead := sub.u16(6 + 2*back)
+			substitutes := 10 + 2*back + 2*ahead
+			for g, i := range coverage(sub.at(sub.u16(2))) {
+				if glyphs[g] {
+					add(sub.u16(substitutes + 2*i))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package fontsubset
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+
+	"github.com/rednafi/rednafi.com/internal/fingerprint"
+)
+
+// DefaultKeep are the characters every subset keeps, whether the site
+// uses them yet or not: printable ASCII, the no-break space, and the
+// typographer's punctuation Markdown turns quotes and dashes into.
+const DefaultKeep = " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~\u00a0‘’“”–—…•←→"
+
+// textAttrs are the attributes whose values browsers show as text.
+var textAttrs = []string{"alt", "title", "aria-label", "placeholder", "value"}
+
+// Runes returns the characters the pages and stylesheets under dir show:
+// the text of the pages, outside scripts and styles, the attributes in
+// textAttrs, and the strings of CSS content properties. Each letter comes
+// with its other cases, for text-transform.
+func Runes(dir string) ([]rune, error) {
+	seen := map[rune]bool{}
+	add := func(s string) {
+		for _, r := range s {
+			if unicode.IsControl(r) {
+				continue
+			}
+			seen[r] = true
+			for _, c := range []rune{unicode.ToUpper(r), unicode.ToLower(r), unicode.ToTitle(r)} {
+				seen[c] = true
+			}
+		}
+	}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".html":
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			doc, err := html.Parse(bytes.NewReader(b))
+			if err != nil {
+				return fmt.Errorf("fontsubset: %s: %w", p, err)
+			}
+			walk(doc, func(n *html.Node) {
+				switch {
+				case n.Type == html.TextNode && n.Parent != nil && n.Parent.Data == "style":
+					for _, s := range contentStrings(n.Data) {
+						add(s)
+					}
+				case n.Type == html.TextNode && (n.Parent == nil || !slices.Contains([]string{"script", "noscript", "template"}, n.Parent.Data)):
+					add(n.Data)
+				case n.Type == html.ElementNode:
+					for _, a := range n.Attr {
+						if slices.Contains(textAttrs, a.Key) {
+							add(a.Val)
+						}
+					}
+				}
+			})
+		case ".css":
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			for _, s := range contentStrings(string(b)) {
+				add(s)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	runes := make([]rune, 0, len(seen))
+	for r := range seen {
+		runes = append(runes, r)
+	}
+	slices.Sort(runes)
+	return runes, nil
+}
+
+var contentRe = regexp.MustCompile(`content\s*:\s*(?:"((?:\\.|[^"\\])*)"|'((?:\\.|[^'\\])*)')`)
+
+// contentStrings returns the unescaped strings of the content properties
+// in css.
+func contentStrings(css string) []string {
+	var out []string
+	for _, m := range contentRe.FindAllStringSubmatch(css, -1) {
+		out = append(out, unescape(m[1]+m[2]))
+	}
+	return out
+}
+
+var escapeRe = regexp.MustCompile(`\\([0-9a-fA-F]{1,6})\s?|\\(.)`)
+
+// unescape resolves the CSS escapes in s.
+func unescape(s string) string {
+	return escapeRe.ReplaceAllStringFunc(s, func(m string) string {
+		sm := escapeRe.FindStringSubmatch(m)
+		if sm[2] != "" {
+			return sm[2]
+		}
+		n, _ := strconv.ParseUint(sm[1], 16, 32)
+		return string(rune(n))
+	})
+}
+
+// Font is what Run did to a font.
+type Font struct {
+	// Path is the font's URL path in the site, after any rename.
+	Path string
+	// Before and After are its sizes in bytes.
+	Before, After int
+	// Glyphs and Total are the number of glyphs kept and in the font.
+	Glyphs, Total int
+	// Skipped says why the font was left as it is, if it was.
+	Skipped error
+}
+
+// Options configure Run.
+type Options struct {
+	// Keep are characters to keep besides the ones the site uses.
+	Keep string
+	// DryRun reports what would be subset without writing anything.
+	DryRun bool
+}
+
+var (
+	fontFaceRe = regexp.MustCompile(`(?i)@font-face\s*\{[^}]*\}`)
+	cssURLRe   = regexp.MustCompile(`url\(\s*(['"]?)([^'")]+?)(['"]?)\s*\)`)
+	rangeRe    = regexp.MustCompile(`(?i)unicode-range\s*:`)
+)
+
+// Run subsets the WOFF2 fonts that the @font-face rules of the
+// stylesheets in dir, a built site, load to the characters the site uses
+// and opts.Keep. Each rule without a unicode-range gets one listing the
+// characters its subset has, so browsers fall back to the next font for
+// the rest without fetching this one. Files whose names carry a hash are
+// renamed after their new contents, and the pages and stylesheets that
+// load them are updated, integrity hashes included. Run it before
+// `blogctl fingerprint`, which hashes the rest.
+func Run(dir string, opts Options) ([]Font, error) {
+	runes, err := Runes(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range opts.Keep {
+		runes = append(runes, r)
+	}
+
+	var sheets []string
+	err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.ToLower(filepath.Ext(p)) != ".css" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		sheets = append(sheets, "/"+filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &subsetter{dir: dir, runes: runes, dryRun: opts.DryRun, fonts: map[string]*Font{}, ranges: map[string]string{}, renames: map[string]string{}}
+	var fonts []Font
+	for _, sheet := range sheets {
+		if err := s.sheet(sheet); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range s.order {
+		fonts = append(fonts, *s.fonts[f])
+	}
+	if len(s.renames) > 0 && !opts.DryRun {
+		if err := s.pages(); err != nil {
+			return nil, err
+		}
+	}
+	return fonts, nil
+}
+
+type subsetter struct {
+	dir    string
+	runes  []rune
+	dryRun bool
+	// fonts are the fonts seen so far by URL path, in order.
+	fonts map[string]*Font
+	order []string
+	// ranges are the unicode-range values of the fonts subset.
+	ranges map[string]string
+	// renames map the URL paths of hashed files to their new ones.
+	renames map[string]string
+}
+
+func (s *subsetter) file(urlPath string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(urlPath))
+}
+
+// sheet subsets the fonts the stylesheet at urlPath loads and rewrites
+// its @font-face rules.
+func (s *subsetter) sheet(urlPath string) error {
+	b, err := os.ReadFile(s.file(urlPath))
+	if err != nil {
+		return err
+	}
+	doc := &url.URL{Path: urlPath}
+	var ferr error
+	css := fontFaceRe.ReplaceAllStringFunc(string(b), func(rule string) string {
+		subset := ""
+		rule = cssURLRe.ReplaceAllStringFunc(rule, func(match string) string {
+			sm := cssURLRe.FindStringSubmatch(match)
+			u, err := doc.Parse(strings.TrimSpace(sm[2]))
+			if sm[1] != sm[3] || err != nil || u.Host != "" || strings.ToLower(path.Ext(u.Path)) != ".woff2" {
+				return match
+			}
+			to, err := s.font(u.Path)
+			if err != nil {
+				if ferr == nil {
+					ferr = err
+				}
+				return match
+			}
+			if r, ok := s.ranges[u.Path]; ok {
+				subset = r
+			}
+			if to == u.Path {
+				return match
+			}
+			out := &url.URL{Path: to, RawQuery: u.RawQuery, Fragment: u.Fragment}
+			return strings.Replace(match, sm[2], out.String(), 1)
+		})
+		if subset == "" || rangeRe.MatchString(rule) {
+			return rule
+		}
+		return addDecl(rule, "unicode-range", subset)
+	})
+	if ferr != nil {
+		return ferr
+	}
+	if css == string(b) || s.dryRun {
+		return nil
+	}
+	_, err = s.write(urlPath, []byte(css))
+	return err
+}
+
+// font subsets the font at urlPath, once, and returns its URL path
+// afterwards.
+func (s *subsetter) font(urlPath string) (string, error) {
+	if f, ok := s.fonts[urlPath]; ok {
+		return f.Path, nil
+	}
+	f := &Font{Path: urlPath}
+	s.fonts[urlPath] = f
+	s.order = append(s.order, urlPath)
+	b, err := os.ReadFile(s.file(urlPath))
+	if errors.Is(err, os.ErrNotExist) {
+		f.Skipped = errors.New("not in the build")
+		return urlPath, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	f.Before, f.After = len(b), len(b)
+	res, err := Subset(b, s.runes)
+	if errors.Is(err, ErrCFF) {
+		f.Skipped = err
+		return urlPath, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", urlPath, err)
+	}
+	f.Glyphs, f.Total = res.Glyphs, res.Total
+	s.ranges[urlPath] = Ranges(res.Runes)
+	if len(res.WOFF2) >= len(b) {
+		// Already subset, or too small to gain anything.
+		return urlPath, nil
+	}
+	f.After = len(res.WOFF2)
+	if s.dryRun {
+		return urlPath, nil
+	}
+	if f.Path, err = s.write(urlPath, res.WOFF2); err != nil {
+		return "", err
+	}
+	return f.Path, nil
+}
+
+// write writes b to the file at urlPath, renaming the file after b if its
+// name carries a hash, and returns its URL path.
+func (s *subsetter) write(urlPath string, b []byte) (string, error) {
+	to := urlPath
+	if fingerprint.Hashed(urlPath) {
+		ext := path.Ext(urlPath)
+		stem := strings.TrimSuffix(urlPath, ext)
+		to = fingerprint.Name(strings.TrimSuffix(stem, path.Ext(stem))+ext, b)
+		s.renames[urlPath] = to
+	}
+	if err := os.WriteFile(s.file(to), b, 0o644); err != nil {
+		return "", err
+	}
+	if to != urlPath {
+		if err := os.Remove(s.file(urlPath)); err != nil {
+			return "", err
+		}
+	}
+	return to, nil
+}
+
+// pages points the pages' references to renamed files at their new names,
+// with fresh integrity hashes.
+func (s *subsetter) pages() error {
+	return filepath.WalkDir(s.dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.ToLower(filepath.Ext(p)) != ".html" {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		page := &url.URL{Path: "/" + filepath.ToSlash(rel)}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		doc, err := html.Parse(bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("fontsubset: %s: %w", p, err)
+		}
+		changed := false
+		walk(doc, func(n *html.Node) {
+			if n.Type != html.ElementNode {
+				return
+			}
+			for i, a := range n.Attr {
+				if a.Key != "href" && a.Key != "src" {
+					continue
+				}
+				u, err := page.Parse(strings.TrimSpace(a.Val))
+				if err != nil || u.Host != "" {
+					continue
+				}
+				to, ok := s.renames[u.Path]
+				if !ok {
+					continue
+				}
+				n.Attr[i].Val = (&url.URL{Path: to, RawQuery: u.RawQuery, Fragment: u.Fragment}).String()
+				changed = true
+				for j, a := range n.Attr {
+					if a.Key == "integrity" {
+						if b, err := os.ReadFile(s.file(to)); err == nil {
+							n.Attr[j].Val = fingerprint.Integrity(a.Val, b)
+						}
+					}
+				}
+			}
+		})
+		if !changed {
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := html.Render(&buf, doc); err != nil {
+			return err
+		}
+		return os.WriteFile(p, buf.Bytes(), 0o644)
+	})
+}
+
+// Ranges returns runes, in order, as a unicode-range value.
+func Ranges(runes []rune) string {
+	var parts []string
+	for i := 0; i < len(runes); {
+		j := i
+		for j+1 < len(runes) && runes[j+1] == runes[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, fmt.Sprintf("U+%04X", runes[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("U+%04X-%04X", runes[i], runes[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// addDecl adds the declaration name: val to the end of rule, a block,
+// laid out like the declarations before it.
+func addDecl(rule, name, val string) string {
+	end := strings.LastIndexByte(rule, '}')
+	head := strings.TrimRightFunc(rule[:end], unicode.IsSpace)
+	tail := rule[len(head):]
+	decl := name + ":" + val
+	if nl := strings.LastIndexByte(head, '\n'); nl >= 0 {
+		line := head[nl+1:]
+		decl = "\n" + line[:len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace))] + name + ": " + val + ";"
+	}
+	if !strings.HasSuffix(head, ";") && !strings.HasSuffix(head, "{") {
+		head += ";"
+	}
+	return head + decl + tail
+}
+
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
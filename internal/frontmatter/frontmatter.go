@@ -0,0 +1,330 @@
+package frontmatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// Problem is a front matter violation at a line of a post's file.
+type Problem struct {
+	Path  string
+	Line  int
+	Field string
+	Msg   string
+}
+
+func (p Problem) String() string {
+	if p.Field == "" {
+		return fmt.Sprintf("%s:%d: %s", p.Path, p.Line, p.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", p.Path, p.Line, p.Field, p.Msg)
+}
+
+// File is a post's decoded front matter.
+type File struct {
+	Path   string
+	Schema Schema
+	// Lines maps each top-level key, lowercased, to the line it's on.
+	Lines map[string]int
+}
+
+// line returns the line of key, or the opening fence if it's missing.
+func (f *File) line(key string) int {
+	if n, ok := f.Lines[key]; ok {
+		return n
+	}
+	return 1
+}
+
+// Slug returns the post's slug the way content.Post does.
+func (f *File) Slug() string {
+	if f.Schema.Slug != "" {
+		return f.Schema.Slug
+	}
+	name, _ := content.SplitLang(f.Path)
+	return name
+}
+
+var slugRe = regexp.MustCompile(`^[a-z0-9]+(?:[-_][a-z0-9]+)*$`)
+
+// Check decodes and validates the front matter of the post file b, whose
+// path relative to the content directory is rel. It returns the decoded
+// file, nil if it couldn't be decoded, and every problem found.
+func Check(rel string, b []byte) (*File, []Problem) {
+	fm, format, _, _, err := content.SplitFrontMatter(b)
+	if err != nil {
+		return nil, []Problem{{Path: rel, Line: 1, Msg: err.Error()}}
+	}
+	f := &File{Path: rel}
+	var problems []Problem
+	add := func(line int, field, msg string, args ...any) {
+		problems = append(problems, Problem{rel, line, field, fmt.Sprintf(msg, args...)})
+	}
+
+	var (
+		ps []Problem
+		ok bool
+	)
+	switch format {
+	case content.YAML:
+		ps, ok = f.decodeYAML(fm)
+	case content.TOML:
+		ps, ok = f.decodeTOML(fm)
+	default:
+		add(1, "", "no front matter")
+		return nil, problems
+	}
+	problems = append(problems, ps...)
+	if !ok {
+		// Nothing else can be checked in a file that doesn't parse.
+		return nil, problems
+	}
+	s := f.Schema
+
+	note := strings.SplitN(rel, "/", 2)[0] == content.NotesSection
+	required := Required
+	if note {
+		required = NoteRequired
+	}
+	for _, key := range required {
+		if _, ok := f.Lines[key]; !ok {
+			add(1, key, "required")
+		}
+	}
+	if _, ok := f.Lines["title"]; ok && note {
+		add(f.line("title"), "title", "notes don't have one")
+	} else if ok && strings.TrimSpace(s.Title) == "" {
+		add(f.line("title"), "title", "is empty")
+	}
+	if s.Lastmod.Set && s.Date.Set && s.Lastmod.Before(s.Date.Time) {
+		add(f.line("lastmod"), "lastmod", "is before date")
+	}
+	if _, ok := f.Lines["tags"]; ok && len(s.Tags) == 0 {
+		add(f.line("tags"), "tags", "is empty")
+	}
+	seen := map[string]bool{}
+	for _, t := range s.Tags {
+		switch {
+		case strings.TrimSpace(t) != t || t == "":
+			add(f.line("tags"), "tags", "%q has surrounding space", t)
+		case seen[strings.ToLower(t)]:
+			add(f.line("tags"), "tags", "%q is listed twice", t)
+		default:
+			if r, _ := utf8.DecodeRuneInString(t); unicode.IsLower(r) {
+				add(f.line("tags"), "tags", "%q should be title case", t)
+			}
+		}
+		seen[strings.ToLower(t)] = true
+	}
+	if s.Slug != "" && !slugRe.MatchString(s.Slug) {
+		add(f.line("slug"), "slug", "%q must be lowercase letters, digits, - and _", s.Slug)
+	}
+	if s.Canonical != "" {
+		if u, err := url.Parse(s.Canonical); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add(f.line("canonical"), "canonical", "%q isn't an absolute http(s) URL", s.Canonical)
+		}
+	}
+	_, hasSeries := f.Lines["series"]
+	_, hasPart := f.Lines["part"]
+	switch {
+	case hasSeries && strings.TrimSpace(s.Series) == "":
+		add(f.line("series"), "series", "is empty")
+	case hasSeries && !hasPart:
+		add(f.line("series"), "part", "required with series")
+	case hasPart && !hasSeries:
+		add(f.line("part"), "series", "required with part")
+	}
+	if hasPart && s.Part < 1 {
+		add(f.line("part"), "part", "must be 1 or more")
+	}
+	return f, problems
+}
+
+// decodeYAML fills in f from YAML front matter. It reports false if the
+// YAML doesn't parse.
+func (f *File) decodeYAML(fm []byte) ([]Problem, bool) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(fm, &doc); err != nil {
+		return []Problem{f.yamlProblem(err.Error())}, false
+	}
+	f.Lines = map[string]int{}
+	if len(doc.Content) == 0 {
+		return nil, true
+	}
+	m := doc.Content[0]
+	if m.Kind != yaml.MappingNode {
+		return []Problem{{Path: f.Path, Line: m.Line + 1, Msg: "front matter isn't a mapping"}}, false
+	}
+	var problems []Problem
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k := m.Content[i]
+		// Node lines count from the line after the opening fence.
+		problems = append(problems, f.key(k.Value, k.Line+1)...)
+		// Hugo's keys are case-insensitive; decode them lowercased so
+		// "Date" still counts as the date. Each key is decoded on its own
+		// so one bad value doesn't hide the others.
+		k.Value = strings.ToLower(k.Value)
+		one := &yaml.Node{Kind: yaml.MappingNode, Content: m.Content[i : i+2]}
+		err := one.Decode(&f.Schema)
+		var te *yaml.TypeError
+		if errors.As(err, &te) {
+			for _, msg := range te.Errors {
+				problems = append(problems, f.yamlProblem(msg))
+			}
+		} else if err != nil {
+			problems = append(problems, f.yamlProblem(err.Error()))
+		}
+	}
+	return problems, true
+}
+
+// camelKeys are the keys Hugo's docs spell in camel case, which are fine
+// either way.
+var camelKeys = map[string]string{
+	"publishdate":    "publishDate",
+	"expirydate":     "expiryDate",
+	"linktitle":      "linkTitle",
+	"translationkey": "translationKey",
+}
+
+// key records the line of a top-level key and checks its spelling.
+func (f *File) key(name string, line int) []Problem {
+	lower := strings.ToLower(name)
+	if _, dup := f.Lines[lower]; !dup {
+		f.Lines[lower] = line
+	}
+	if name != lower && name != camelKeys[lower] {
+		return []Problem{{f.Path, line, name, fmt.Sprintf("keys are lowercase; use %q", lower)}}
+	}
+	return nil
+}
+
+var yamlLineRe = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+func (f *File) yamlProblem(msg string) Problem {
+	p := Problem{Path: f.Path, Line: 1, Msg: msg}
+	if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		p.Line, p.Msg = n+1, m[2]
+	}
+	return p
+}
+
+var tomlKeyRe = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s*=`)
+
+// decodeTOML fills in f from TOML front matter. It reports false if the
+// TOML doesn't parse.
+func (f *File) decodeTOML(fm []byte) ([]Problem, bool) {
+	f.Lines = map[string]int{}
+	var problems []Problem
+	for i, l := range bytes.Split(fm, []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimSpace(l), []byte("[")) {
+			// Keys after a table header aren't top-level.
+			break
+		}
+		if m := tomlKeyRe.FindSubmatch(l); m != nil {
+			problems = append(problems, f.key(string(m[1]), i+2)...)
+		}
+	}
+	// Decode through a map to lowercase the keys, as for YAML.
+	raw := map[string]any{}
+	if _, err := toml.Decode(string(fm), &raw); err != nil {
+		p := Problem{Path: f.Path, Line: 1, Msg: err.Error()}
+		var pe toml.ParseError
+		if errors.As(err, &pe) {
+			p.Line, p.Msg = pe.Position.Line+1, pe.Message
+		}
+		return []Problem{p}, false
+	}
+	lower := make(map[string]any, len(raw))
+	for k, v := range raw {
+		lower[strings.ToLower(k)] = v
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(lower); err != nil {
+		return append(problems, Problem{Path: f.Path, Line: 1, Msg: err.Error()}), false
+	}
+	if _, err := toml.Decode(buf.String(), &f.Schema); err != nil {
+		problems = append(problems, Problem{Path: f.Path, Line: 1, Msg: err.Error()})
+	}
+	return problems, true
+}
+
+// CheckSite runs the checks that span posts over files: every slug is
+// used once in each language, and every tag is spelled the same way everywhere, matching
+// the spelling most posts use.
+func CheckSite(files []*File) []Problem {
+	var problems []Problem
+
+	type key struct{ slug, lang string }
+	bySlug := map[key][]*File{}
+	for _, f := range files {
+		_, lang := content.SplitLang(f.Path)
+		k := key{f.Slug(), lang}
+		bySlug[k] = append(bySlug[k], f)
+	}
+	for k, fs := range bySlug {
+		for _, f := range fs[1:] {
+			problems = append(problems, Problem{f.Path, f.line("slug"), "slug",
+				fmt.Sprintf("%q is also the slug of %s", k.slug, fs[0].Path)})
+		}
+	}
+
+	spellings := map[string]map[string]int{}
+	for _, f := range files {
+		for _, t := range f.Schema.Tags {
+			k := strings.ToLower(t)
+			if spellings[k] == nil {
+				spellings[k] = map[string]int{}
+			}
+			spellings[k][t]++
+		}
+	}
+	for _, f := range files {
+		for _, t := range f.Schema.Tags {
+			if want := majority(spellings[strings.ToLower(t)]); t != want {
+				problems = append(problems, Problem{f.Path, f.line("tags"), "tags",
+					fmt.Sprintf("%q is spelled %q in other posts", t, want)})
+			}
+		}
+	}
+
+	return problems
+}
+
+// majority returns the most used spelling, preferring one that starts
+// with a capital, then the alphabetically first, on ties.
+func majority(counts map[string]int) string {
+	var names []string
+	for n := range counts {
+		names = append(names, n)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		ra, _ := utf8.DecodeRuneInString(a)
+		rb, _ := utf8.DecodeRuneInString(b)
+		if unicode.IsUpper(ra) != unicode.IsUpper(rb) {
+			if unicode.IsUpper(ra) {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	return names[0]
+}
@@ -0,0 +1,109 @@
+// Package frontmatter validates the posts' front matter against a schema:
+// required fields, date formats, tag casing, and slugs that are unique
+// across the site.
+package frontmatter
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is the front matter a post may set. Keys Hugo or the theme
+// understand but that aren't listed here are allowed and not checked.
+type Schema struct {
+	Title   string `yaml:"title" toml:"title"`
+	Date    Date   `yaml:"date" toml:"date"`
+	Lastmod Date   `yaml:"lastmod" toml:"lastmod"`
+	// PublishDate schedules a draft; see cmd/scheduler.
+	PublishDate Date `yaml:"publishdate" toml:"publishdate"`
+	// Tags use title case, as in "Python" or "Incident Post-mortem", and
+	// are spelled the same way in every post.
+	Tags []string `yaml:"tags" toml:"tags"`
+	// Slug overrides the file name in the URL and as the key of the data
+	// files generated per post, so it has to be unique.
+	Slug        string `yaml:"slug" toml:"slug"`
+	URL         string `yaml:"url" toml:"url"`
+	Description string `yaml:"description" toml:"description"`
+	Summary     string `yaml:"summary" toml:"summary"`
+	// Canonical points at the original of a post first published
+	// elsewhere.
+	Canonical string `yaml:"canonical" toml:"canonical"`
+	Draft     bool   `yaml:"draft" toml:"draft"`
+	// Series and Part go together: the name of the series the post is
+	// part of and its place in it, from 1.
+	Series string `yaml:"series" toml:"series"`
+	Part   int    `yaml:"part" toml:"part"`
+	// ABTitles and ABDescriptions are alternates for a title experiment;
+	// see internal/abtest.
+	ABTitles       []string `yaml:"ab_titles" toml:"ab_titles"`
+	ABDescriptions []string `yaml:"ab_descriptions" toml:"ab_descriptions"`
+}
+
+// Required lists the keys every post must set.
+var Required = []string{"title", "date", "tags"}
+
+// NoteRequired lists the keys every note must set. Notes have no title,
+// and tags are optional.
+var NoteRequired = []string{"date"}
+
+// DateLayouts are the accepted date formats: a plain date, or an RFC 3339
+// timestamp when the time of day matters.
+var DateLayouts = []string{time.DateOnly, time.RFC3339}
+
+// Date is a front matter date in one of DateLayouts.
+type Date struct {
+	time.Time
+	// Set reports whether the key was present.
+	Set bool
+}
+
+func (d *Date) parse(s string) error {
+	for _, layout := range DateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			d.Time, d.Set = t, true
+			return nil
+		}
+	}
+	d.Set = true
+	return fmt.Errorf("date %q isn't YYYY-MM-DD or RFC 3339", s)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. It reads the value as written
+// rather than letting YAML's looser timestamp rules decide.
+func (d *Date) UnmarshalYAML(n *yaml.Node) error {
+	// Errors carry the line prefix yaml.v3 uses for its own.
+	if n.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: date must be a string, not a %s", n.Line, kindName(n.Kind))
+	}
+	if err := d.parse(n.Value); err != nil {
+		return fmt.Errorf("line %d: %w", n.Line, err)
+	}
+	return nil
+}
+
+// UnmarshalTOML implements toml.Unmarshaler. TOML has a datetime type of
+// its own, which is always fine.
+func (d *Date) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case time.Time:
+		d.Time, d.Set = v, true
+		return nil
+	case string:
+		return d.parse(v)
+	default:
+		return fmt.Errorf("date must be a string or datetime, not %T", v)
+	}
+}
+
+func kindName(k yaml.Kind) string {
+	switch k {
+	case yaml.SequenceNode:
+		return "list"
+	case yaml.MappingNode:
+		return "mapping"
+	default:
+		return "scalar"
+	}
+}
@@ -0,0 +1,34 @@
+// Package fsutil writes the files the build generates. Rewriting a file
+// with the same bytes would still bump its modification time, which Hugo's
+// server takes for an edit and rebuilds on, so generated files are only
+// written when what's in them changes.
+package fsutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// WriteIfChanged writes b to path, creating its directory, unless the
+// file already holds b. It reports whether it wrote.
+func WriteIfChanged(path string, b []byte) (bool, error) {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, b) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path, b, 0o644)
+}
+
+// WriteJSONIfChanged encodes v as indented JSON, ending in a newline, and
+// writes it to path like WriteIfChanged.
+func WriteJSONIfChanged(path string, v any) (bool, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	return WriteIfChanged(path, append(b, '\n'))
+}
@@ -0,0 +1,349 @@
+package gallery
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EXIF is the metadata of a photo that its page shows.
+type EXIF struct {
+	Make, Model string
+	Lens        string
+	Description string
+	// Taken is when the shutter fired, in the camera's offset if it
+	// recorded one and UTC otherwise.
+	Taken time.Time
+	// Exposure is the shutter speed in seconds, FNumber the aperture, and
+	// FocalLength in millimetres; zero if unrecorded.
+	Exposure    float64
+	FNumber     float64
+	ISO         int
+	FocalLength float64
+	// GPS is set if the photo has coordinates.
+	GPS      bool
+	Lat, Lon float64
+}
+
+// The tags read, by IFD.
+const (
+	tagDescription = 0x010E
+	tagMake        = 0x010F
+	tagModel       = 0x0110
+	tagDateTime    = 0x0132
+	tagExifIFD     = 0x8769
+	tagGPSIFD      = 0x8825
+
+	tagExposure    = 0x829A
+	tagFNumber     = 0x829D
+	tagISO         = 0x8827
+	tagTaken       = 0x9003
+	tagTakenOffset = 0x9011
+	tagFocalLength = 0x920A
+	tagLensMake    = 0xA433
+	tagLensModel   = 0xA434
+
+	tagLatRef = 0x0001
+	tagLat    = 0x0002
+	tagLonRef = 0x0003
+	tagLon    = 0x0004
+)
+
+// typeSize is the size in bytes of one value of each TIFF field type.
+var typeSize = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// tiff is the TIFF structure inside a JPEG's Exif segment; offsets in it
+// are relative to its start.
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+// field is an IFD entry. Its value is inline in the entry when it fits in
+// four bytes, elsewhere in the TIFF otherwise.
+type field struct {
+	typ   uint16
+	count int
+	// off is the offset of the value.
+	off int
+}
+
+func (f field) size() int { return typeSize[f.typ] * f.count }
+
+// findTIFF returns the offset in the JPEG b of the TIFF structure in its
+// Exif segment.
+func findTIFF(b []byte) (int, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return 0, false
+	}
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return 0, false
+		}
+		marker := b[i+1]
+		size := int(binary.BigEndian.Uint16(b[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(b) {
+			return 0, false
+		}
+		seg := b[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 14 && string(seg[:6]) == "Exif\x00\x00" {
+			return i + 10, true
+		}
+		i += 2 + size
+	}
+	return 0, false
+}
+
+func parseTIFF(b []byte) (tiff, error) {
+	if len(b) < 8 {
+		return tiff{}, errors.New("short TIFF header")
+	}
+	t := tiff{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return tiff{}, errors.New("bad TIFF byte order")
+	}
+	return t, nil
+}
+
+// ifd reads the entries of the IFD at off, skipping any that point
+// outside the TIFF.
+func (t tiff) ifd(off int) map[uint16]field {
+	fields := map[uint16]field{}
+	if off <= 0 || off+2 > len(t.b) {
+		return fields
+	}
+	n := int(t.order.Uint16(t.b[off:]))
+	for e := range n {
+		at := off + 2 + 12*e
+		if at+12 > len(t.b) {
+			break
+		}
+		f := field{
+			typ:   t.order.Uint16(t.b[at+2:]),
+			count: int(t.order.Uint32(t.b[at+4:])),
+			off:   at + 8,
+		}
+		if f.size() > 4 {
+			f.off = int(t.order.Uint32(t.b[at+8:]))
+		}
+		if typeSize[f.typ] == 0 || f.count < 0 || f.off+f.size() > len(t.b) {
+			continue
+		}
+		fields[t.order.Uint16(t.b[at:])] = f
+	}
+	return fields
+}
+
+func (t tiff) ifd0() map[uint16]field {
+	return t.ifd(int(t.order.Uint32(t.b[4:])))
+}
+
+// sub reads the IFD the pointer tag of fields leads to.
+func (t tiff) sub(fields map[uint16]field, tag uint16) map[uint16]field {
+	if f, ok := fields[tag]; ok {
+		return t.ifd(t.uint(f, 0))
+	}
+	return map[uint16]field{}
+}
+
+func (t tiff) str(f field) string {
+	if f.typ != 2 && f.typ != 7 {
+		return ""
+	}
+	s := string(t.b[f.off : f.off+f.count])
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// uint returns the i'th value of a SHORT or LONG field.
+func (t tiff) uint(f field, i int) int {
+	if i >= f.count {
+		return 0
+	}
+	switch f.typ {
+	case 3:
+		return int(t.order.Uint16(t.b[f.off+2*i:]))
+	case 4:
+		return int(t.order.Uint32(t.b[f.off+4*i:]))
+	}
+	return 0
+}
+
+// rat returns the i'th value of a RATIONAL or SRATIONAL field.
+func (t tiff) rat(f field, i int) float64 {
+	if (f.typ != 5 && f.typ != 10) || i >= f.count {
+		return 0
+	}
+	num, den := t.order.Uint32(t.b[f.off+8*i:]), t.order.Uint32(t.b[f.off+8*i+4:])
+	if den == 0 {
+		return 0
+	}
+	if f.typ == 10 {
+		return float64(int32(num)) / float64(int32(den))
+	}
+	return float64(num) / float64(den)
+}
+
+// ReadEXIF returns the metadata of the JPEG b. A JPEG without EXIF yields
+// the zero EXIF.
+func ReadEXIF(b []byte) (EXIF, error) {
+	start, ok := findTIFF(b)
+	if !ok {
+		return EXIF{}, nil
+	}
+	t, err := parseTIFF(b[start:])
+	if err != nil {
+		return EXIF{}, fmt.Errorf("gallery: EXIF: %w", err)
+	}
+	ifd0 := t.ifd0()
+	exif := t.sub(ifd0, tagExifIFD)
+	gps := t.sub(ifd0, tagGPSIFD)
+
+	var e EXIF
+	if f, ok := ifd0[tagMake]; ok {
+		e.Make = t.str(f)
+	}
+	if f, ok := ifd0[tagModel]; ok {
+		e.Model = t.str(f)
+	}
+	if f, ok := ifd0[tagDescription]; ok {
+		e.Description = t.str(f)
+	}
+	lensMake, lens := "", ""
+	if f, ok := exif[tagLensMake]; ok {
+		lensMake = t.str(f)
+	}
+	if f, ok := exif[tagLensModel]; ok {
+		lens = t.str(f)
+	}
+	e.Lens = joinBrand(lensMake, lens)
+	if f, ok := exif[tagExposure]; ok {
+		e.Exposure = t.rat(f, 0)
+	}
+	if f, ok := exif[tagFNumber]; ok {
+		e.FNumber = t.rat(f, 0)
+	}
+	if f, ok := exif[tagISO]; ok {
+		e.ISO = t.uint(f, 0)
+	}
+	if f, ok := exif[tagFocalLength]; ok {
+		e.FocalLength = t.rat(f, 0)
+	}
+
+	taken, ok := exif[tagTaken]
+	if !ok {
+		taken, ok = ifd0[tagDateTime]
+	}
+	if ok {
+		offset := ""
+		if f, ok := exif[tagTakenOffset]; ok {
+			offset = t.str(f)
+		}
+		e.Taken = parseTime(t.str(taken), offset)
+	}
+
+	lat, latOK := gps[tagLat]
+	lon, lonOK := gps[tagLon]
+	if latOK && lonOK && lat.count == 3 && lon.count == 3 {
+		e.Lat, e.Lon = t.degrees(lat), t.degrees(lon)
+		if f, ok := gps[tagLatRef]; ok && t.str(f) == "S" {
+			e.Lat = -e.Lat
+		}
+		if f, ok := gps[tagLonRef]; ok && t.str(f) == "W" {
+			e.Lon = -e.Lon
+		}
+		e.GPS = !math.IsNaN(e.Lat) && !math.IsNaN(e.Lon) && (e.Lat != 0 || e.Lon != 0)
+	}
+	return e, nil
+}
+
+// degrees reads a GPS coordinate, stored as degrees, minutes, and seconds.
+func (t tiff) degrees(f field) float64 {
+	return t.rat(f, 0) + t.rat(f, 1)/60 + t.rat(f, 2)/3600
+}
+
+// parseTime reads an EXIF date, "2006:01:02 15:04:05", with its offset
+// tag's "+06:00" if there is one.
+func parseTime(s, offset string) time.Time {
+	loc := time.UTC
+	if offset != "" {
+		if o, err := time.Parse("-07:00", offset); err == nil {
+			_, secs := o.Zone()
+			loc = time.FixedZone("", secs)
+		}
+	}
+	tm, err := time.ParseInLocation("2006:01:02 15:04:05", s, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return tm
+}
+
+// joinBrand puts a make in front of a model unless the model already
+// starts with it, as "Canon EOS R6" usually does.
+func joinBrand(brand, model string) string {
+	if brand == "" || model == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(brand)[0])) {
+		return model
+	}
+	return brand + " " + model
+}
+
+// StripGPS returns a copy of the JPEG b with its GPS coordinates zeroed out
+// and the GPS IFD emptied, leaving the rest of the EXIF in place, and
+// whether there was anything to strip. Nothing moves, so the offsets the
+// other tags use stay valid.
+func StripGPS(b []byte) ([]byte, bool, error) {
+	start, ok := findTIFF(b)
+	if !ok {
+		return b, false, nil
+	}
+	out := append([]byte(nil), b...)
+	t, err := parseTIFF(out[start:])
+	if err != nil {
+		return b, false, fmt.Errorf("gallery: EXIF: %w", err)
+	}
+	ptr, ok := t.ifd0()[tagGPSIFD]
+	if !ok {
+		return b, false, nil
+	}
+	off := t.uint(ptr, 0)
+	if off <= 0 || off+2 > len(t.b) {
+		return b, false, nil
+	}
+	if t.order.Uint16(t.b[off:]) == 0 {
+		return b, false, nil
+	}
+	for _, f := range t.ifd(off) {
+		if f.size() > 4 {
+			clear(t.b[f.off : f.off+f.size()])
+		}
+	}
+	n := int(t.order.Uint16(t.b[off:]))
+	clear(t.b[off+2 : min(off+2+12*n, len(t.b))])
+	t.order.PutUint16(t.b[off:], 0)
+	return out, true, nil
+}
+
+// formatExposure writes a shutter speed the way cameras show it: 1/250 s
+// below a second, 2.5 s above.
+func formatExposure(s float64) string {
+	switch {
+	case s <= 0:
+		return ""
+	case s < 1:
+		return "1/" + strconv.Itoa(int(math.Round(1/s))) + " s"
+	default:
+		return strconv.FormatFloat(s, 'f', -1, 64) + " s"
+	}
+}
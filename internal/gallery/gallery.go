@@ -0,0 +1,520 @@
+// Package gallery builds the Photos section from the JPEGs under photos/:
+// one album per folder, the photos at the top level on /photos/ itself. It
+// reads each photo's camera, lens, exposure, and date from its EXIF,
+// encodes responsive variants of it with imgopt, which drop the EXIF, and
+// writes the pages the gallery and photo layouts render as justified
+// grids and per-photo permalinks.
+package gallery
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/imgopt"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+)
+
+// DefaultSource is where the original photos are dropped.
+const DefaultSource = "photos"
+
+// DefaultData is where the section is written for the layouts to read as
+// site.Data.gallery.
+const DefaultData = "data/gallery.json"
+
+// DefaultDir is where the variants go, relative to the static directory.
+const DefaultDir = "gallery"
+
+// DefaultWidths are the variant widths, wider than the posts' since a
+// photo's page shows it across the screen.
+var DefaultWidths = []int{400, 800, 1600, 2400}
+
+// Root is the section's URL.
+const Root = "/photos/"
+
+// AlbumFile is the optional file in an album's folder, or in the source
+// folder for the top-level photos, that titles and captions it.
+const AlbumFile = "album.toml"
+
+// marker starts the front matter of the page stubs Write generates, so it
+// only ever deletes its own.
+const marker = "# Generated by `gallery`; don't edit."
+
+// Meta is an AlbumFile.
+type Meta struct {
+	Title       string `toml:"title"`
+	Description string `toml:"description"`
+	// Cover is the file name of the photo that stands for the album on
+	// /photos/; the newest by default.
+	Cover string `toml:"cover"`
+	// Captions are by file name, and take the place of the EXIF
+	// description.
+	Captions map[string]string `toml:"captions"`
+}
+
+// Location is where a photo was taken, rounded to about a kilometre.
+type Location struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Photo is a photo's page.
+type Photo struct {
+	URL   string `json:"url"`
+	Album string `json:"album"`
+	// Source is the original's path, for finding it again.
+	Source  string `json:"source"`
+	Title   string `json:"title"`
+	Caption string `json:"caption,omitempty"`
+	// Taken is RFC 3339, empty if the camera didn't record it.
+	Taken    string    `json:"taken,omitempty"`
+	Camera   string    `json:"camera,omitempty"`
+	Lens     string    `json:"lens,omitempty"`
+	Exposure string    `json:"exposure,omitempty"`
+	Aperture string    `json:"aperture,omitempty"`
+	ISO      int       `json:"iso,omitempty"`
+	Focal    string    `json:"focal,omitempty"`
+	Location *Location `json:"location,omitempty"`
+	// Ratio is the width over the height, which the grid sizes the photo
+	// by.
+	Ratio float64      `json:"ratio"`
+	Image imgopt.Image `json:"image"`
+	// Prev and Next are the neighbouring photos in the album.
+	Prev string `json:"prev,omitempty"`
+	Next string `json:"next,omitempty"`
+}
+
+// Album is an album's page, or the section's for the top level.
+type Album struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// Cover is the URL of the album's cover photo.
+	Cover string `json:"cover,omitempty"`
+	// Albums lists the albums, newest first; only the top level has any.
+	Albums []string `json:"albums,omitempty"`
+	// Photos lists the album's photos, newest first.
+	Photos []string `json:"photos"`
+}
+
+// Gallery is the section: its albums and photos by URL.
+type Gallery struct {
+	Albums map[string]Album `json:"albums"`
+	Photos map[string]Photo `json:"photos"`
+}
+
+// Load reads the section written to path. A missing file yields an empty
+// section.
+func Load(path string) (Gallery, error) {
+	g := Gallery{Albums: map[string]Album{}, Photos: map[string]Photo{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return g, nil
+	}
+	if err != nil {
+		return g, err
+	}
+	if err := json.Unmarshal(b, &g); err != nil {
+		return g, fmt.Errorf("gallery: parse %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// Options control Build.
+type Options struct {
+	// Static is the static directory, and Dir the variants' place in it.
+	Static, Dir string
+	Images      imgopt.Options
+	// Location publishes where the photos were taken.
+	Location bool
+	// StripGPS rewrites the originals without their GPS coordinates, so
+	// they can be committed without giving away where they were taken.
+	StripGPS bool
+	// Force re-encodes every photo.
+	Force bool
+	// Jobs is how many photos are encoded at once.
+	Jobs int
+}
+
+// Report counts what Build did.
+type Report struct {
+	Photos, Encoded, Stripped, Removed int
+}
+
+// original is a photo under the source folder.
+type original struct {
+	album  string // the album's slug, empty at the top level
+	name   string // file name
+	slug   string
+	source string // path on disk
+	data   []byte
+	exif   EXIF
+	url    string
+}
+
+// Build rebuilds the section from the originals under src, reusing prev's
+// variants of the photos whose bytes didn't change and deleting those of
+// the photos that are gone.
+func Build(src string, prev Gallery, o Options) (Gallery, Report, error) {
+	var r Report
+	metas, origs, err := scan(src)
+	if err != nil {
+		return Gallery{}, r, err
+	}
+	r.Photos = len(origs)
+
+	for i := range origs {
+		og := &origs[i]
+		if o.StripGPS {
+			b, stripped, err := StripGPS(og.data)
+			if err != nil {
+				return Gallery{}, r, fmt.Errorf("%s: %w", og.source, err)
+			}
+			if stripped {
+				if err := os.WriteFile(og.source, b, 0o644); err != nil {
+					return Gallery{}, r, err
+				}
+				og.data = b
+				r.Stripped++
+			}
+		}
+		if og.exif, err = ReadEXIF(og.data); err != nil {
+			return Gallery{}, r, fmt.Errorf("%s: %w", og.source, err)
+		}
+	}
+
+	images := make([]imgopt.Image, len(origs))
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, max(o.Jobs, 1))
+	)
+	for i, og := range origs {
+		if p, ok := prev.Photos[og.url]; ok && !o.Force && p.Image.Hash == imgopt.Hash(og.data, o.Images) && exists(o.Static, p.Image.Files()) {
+			images[i] = p.Image
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			img, err := imgopt.Process(og.data, path.Join(og.album, og.slug+".jpg"), o.Static, o.Dir, o.Images)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			images[i] = img
+			r.Encoded++
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return Gallery{}, r, firstErr
+	}
+
+	g := layout(metas, origs, images, o.Location)
+	for u, p := range prev.Photos {
+		keep := g.Photos[u].Image.Files()
+		for _, f := range p.Image.Files() {
+			if slices.Contains(keep, f) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(o.Static, filepath.FromSlash(f))); err != nil && !os.IsNotExist(err) {
+				return g, r, err
+			}
+		}
+		if _, ok := g.Photos[u]; !ok {
+			r.Removed++
+		}
+	}
+	return g, r, nil
+}
+
+// scan reads the JPEGs and album files under src, ignoring anything
+// deeper than one folder.
+func scan(src string) (map[string]Meta, []original, error) {
+	metas := map[string]Meta{}
+	var origs []original
+	read := func(dir, album string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		var m Meta
+		if _, err := toml.DecodeFile(filepath.Join(dir, AlbumFile), &m); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("gallery: %w", err)
+		}
+		metas[album] = m
+		for _, e := range entries {
+			ext := strings.ToLower(filepath.Ext(e.Name()))
+			if e.IsDir() || (ext != ".jpg" && ext != ".jpeg") {
+				continue
+			}
+			p := filepath.Join(dir, e.Name())
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			slug := newpost.Slugify(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+			if slug == "" {
+				return fmt.Errorf("gallery: can't derive a slug from %s", p)
+			}
+			origs = append(origs, original{album: album, name: e.Name(), slug: slug, source: p, data: b, url: photoURL(album, slug)})
+		}
+		return nil
+	}
+	if err := read(src, ""); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return metas, nil, nil
+		}
+		return nil, nil, err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		slug := newpost.Slugify(e.Name())
+		if slug == "" {
+			return nil, nil, fmt.Errorf("gallery: can't derive a slug from %s", e.Name())
+		}
+		if _, ok := metas[slug]; ok {
+			return nil, nil, fmt.Errorf("gallery: two albums are %s", slug)
+		}
+		if err := read(filepath.Join(src, e.Name()), slug); err != nil {
+			return nil, nil, err
+		}
+	}
+	seen := map[string]string{}
+	for _, og := range origs {
+		if other, ok := seen[og.url]; ok {
+			return nil, nil, fmt.Errorf("gallery: %s and %s are both %s", other, og.source, og.url)
+		}
+		seen[og.url] = og.source
+	}
+	return metas, origs, nil
+}
+
+func albumURL(album string) string {
+	if album == "" {
+		return Root
+	}
+	return Root + album + "/"
+}
+
+func photoURL(album, slug string) string {
+	return albumURL(album) + slug + "/"
+}
+
+// layout puts the photos in their albums, newest first, and the albums on
+// the top level, newest first too.
+func layout(metas map[string]Meta, origs []original, images []imgopt.Image, location bool) Gallery {
+	g := Gallery{Albums: map[string]Album{}, Photos: map[string]Photo{}}
+	byAlbum := map[string][]original{}
+	for i, og := range origs {
+		g.Photos[og.url] = describe(og, metas[og.album], images[i], location)
+		byAlbum[og.album] = append(byAlbum[og.album], og)
+	}
+	newest := func(list []original) {
+		slices.SortStableFunc(list, func(a, b original) int {
+			return cmp.Or(b.exif.Taken.Compare(a.exif.Taken), cmp.Compare(a.name, b.name))
+		})
+	}
+
+	top := Album{URL: Root, Title: cmp.Or(metas[""].Title, "Photos"), Description: metas[""].Description, Photos: []string{}}
+	var albums []original // each album's newest photo, to order the albums by
+	for album, m := range metas {
+		list := byAlbum[album]
+		newest(list)
+		a := Album{URL: albumURL(album), Title: cmp.Or(m.Title, album), Description: m.Description, Photos: []string{}}
+		for i, og := range list {
+			a.Photos = append(a.Photos, og.url)
+			p := g.Photos[og.url]
+			if i > 0 {
+				p.Prev = list[i-1].url
+			}
+			if i+1 < len(list) {
+				p.Next = list[i+1].url
+			}
+			g.Photos[og.url] = p
+			if a.Cover == "" || og.name == m.Cover {
+				a.Cover = og.url
+			}
+		}
+		if album == "" {
+			top.Photos, top.Cover = a.Photos, a.Cover
+			continue
+		}
+		if len(list) == 0 {
+			continue
+		}
+		g.Albums[a.URL] = a
+		albums = append(albums, list[0])
+	}
+	newest(albums)
+	for _, og := range albums {
+		top.Albums = append(top.Albums, albumURL(og.album))
+	}
+	if top.Cover == "" && len(top.Albums) > 0 {
+		top.Cover = g.Albums[top.Albums[0]].Cover
+	}
+	g.Albums[Root] = top
+	return g
+}
+
+// describe turns a photo's EXIF into its page.
+func describe(og original, m Meta, img imgopt.Image, location bool) Photo {
+	e := og.exif
+	p := Photo{
+		URL:      og.url,
+		Album:    albumURL(og.album),
+		Source:   filepath.ToSlash(og.source),
+		Caption:  cmp.Or(m.Captions[og.name], e.Description),
+		Camera:   joinBrand(e.Make, e.Model),
+		Lens:     e.Lens,
+		Exposure: formatExposure(e.Exposure),
+		ISO:      e.ISO,
+		Image:    img,
+	}
+	if !e.Taken.IsZero() {
+		p.Taken = e.Taken.Format(time.RFC3339)
+	}
+	if e.FNumber > 0 {
+		p.Aperture = "ƒ/" + strconv.FormatFloat(e.FNumber, 'f', -1, 64)
+	}
+	if e.FocalLength > 0 {
+		p.Focal = strconv.FormatFloat(math.Round(e.FocalLength*10)/10, 'f', -1, 64) + " mm"
+	}
+	if location && e.GPS {
+		p.Location = &Location{Lat: math.Round(e.Lat*100) / 100, Lon: math.Round(e.Lon*100) / 100}
+	}
+	if img.Height > 0 {
+		p.Ratio = math.Round(float64(img.Width)/float64(img.Height)*1000) / 1000
+	}
+	p.Title = p.Caption
+	if p.Title == "" && !e.Taken.IsZero() {
+		p.Title = e.Taken.Format("January 2, 2006")
+	}
+	p.Title = cmp.Or(p.Title, strings.TrimSuffix(og.name, filepath.Ext(og.name)))
+	return p
+}
+
+// stub returns the name, under the content directory, of the page served
+// at url, and its contents. The stubs sit at the content root, which the
+// tooling reads as standalone pages rather than posts.
+func stub(url, title, layout, description string) (string, []byte) {
+	name := "photos" + strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(url, "/photos"), "/"), "/", "-") + ".md"
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "---\n%s\ntitle: %q\nlayout: %q\nurl: %q\nsummary: photos\n", marker, title, layout, url)
+	if description != "" {
+		fmt.Fprintf(&b, "description: %q\n", description)
+	}
+	b.WriteString("---\n")
+	return name, b.Bytes()
+}
+
+// Write writes g to dataPath and a page stub for each of its albums and
+// photos into contentDir, deleting the stubs of pages it no longer has and
+// skipping files whose contents are unchanged, and returns the number of
+// files written or deleted.
+func (g Gallery) Write(contentDir, dataPath string) (int, error) {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	files := map[string][]byte{dataPath: append(data, '\n')}
+	for url, a := range g.Albums {
+		name, b := stub(url, a.Title, "gallery", a.Description)
+		files[filepath.Join(contentDir, name)] = b
+	}
+	for url, p := range g.Photos {
+		desc := p.Caption
+		if desc == p.Title {
+			desc = ""
+		}
+		name, b := stub(url, p.Title, "photo", desc)
+		files[filepath.Join(contentDir, name)] = b
+	}
+
+	n := 0
+	old, err := filepath.Glob(filepath.Join(contentDir, "photos*.md"))
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range old {
+		if _, ok := files[p]; ok {
+			continue
+		}
+		if mine, err := generated(p); err != nil {
+			return n, err
+		} else if mine {
+			if err := os.Remove(p); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	for p, b := range files {
+		wrote, err := fsutil.WriteIfChanged(p, b)
+		if err != nil {
+			return n, err
+		}
+		if wrote {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// generated reports whether the file at p is a stub Write made.
+func generated(p string) (bool, error) {
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for i := 0; i < 2 && sc.Scan(); i++ {
+		if sc.Text() == marker {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
+
+// exists reports whether every URL path in files is on disk under root.
+func exists(root string, files []string) bool {
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(f))); err != nil {
+			return false
+		}
+	}
+	return true
+}
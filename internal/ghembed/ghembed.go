@@ -0,0 +1,291 @@
+// Package ghembed renders the files, or line ranges of them, that posts
+// embed from GitHub with the ghembed shortcode:
+//
+//	{{< ghembed repo="golang/go" ref="<commit SHA>" path="src/sync/once.go" lines="46-70" >}}
+//
+// The ref is a full commit SHA, so an embed shows what the post was
+// written against however the file changes upstream. The files are
+// fetched from raw.githubusercontent.com, which doesn't count against the
+// API's rate limit, and kept in a cache that never goes stale, since a
+// commit's files don't change; the highlighted HTML goes to
+// data/ghembed.json for the shortcode, with no gist script on the page.
+package ghembed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/highlight"
+)
+
+// DefaultPath is where the shortcode reads the embeds from, as
+// site.Data.ghembed.
+const DefaultPath = "data/ghembed.json"
+
+// DefaultCache holds the fetched files, by repo, commit, and path.
+const DefaultCache = ".ghembed-cache"
+
+// Embed is a shortcode's file or line range.
+type Embed struct {
+	Repo, Ref, Path string
+	// Lines is the shortcode's range, like "46-70" or "46", or "" for the
+	// whole file.
+	Lines string
+	// Lang overrides the language the file's extension says it's in.
+	Lang string
+}
+
+// Key identifies the embed in the manifest. The shortcode computes the
+// same from its arguments.
+func (e Embed) Key() string {
+	return fmt.Sprintf("%s@%s/%s#%s", e.Repo, e.Ref, e.Path, e.Lines)
+}
+
+// URL is the embed's page on GitHub, with its lines selected.
+func (e Embed) URL() string {
+	u := fmt.Sprintf("https://github.com/%s/blob/%s/%s", e.Repo, e.Ref, e.Path)
+	if from, to, err := e.Range(); err == nil && from > 0 {
+		u += fmt.Sprintf("#L%d", from)
+		if to != from {
+			u += fmt.Sprintf("-L%d", to)
+		}
+	}
+	return u
+}
+
+// Range returns the embed's first and last line, or 0, 0 for the whole
+// file.
+func (e Embed) Range() (from, to int, err error) {
+	if e.Lines == "" {
+		return 0, 0, nil
+	}
+	lo, hi, ok := strings.Cut(e.Lines, "-")
+	if from, err = strconv.Atoi(strings.TrimSpace(lo)); err != nil {
+		return 0, 0, fmt.Errorf("lines=%q: %w", e.Lines, err)
+	}
+	to = from
+	if ok {
+		if to, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+			return 0, 0, fmt.Errorf("lines=%q: %w", e.Lines, err)
+		}
+	}
+	if from < 1 || to < from {
+		return 0, 0, fmt.Errorf("lines=%q: want a range like 10-20 from line 1", e.Lines)
+	}
+	return from, to, nil
+}
+
+var shaRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Pinned reports whether the embed's ref is a full commit SHA.
+func (e Embed) Pinned() bool {
+	return shaRe.MatchString(e.Ref)
+}
+
+var (
+	shortcodeRe = regexp.MustCompile(`\{\{<\s*ghembed\s+([^>]*?)\s*/?>\}\}`)
+	argRe       = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	refRe       = regexp.MustCompile(`\bref="[^"]*"`)
+	repoRe      = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+)
+
+// Shortcode is an embed in a post, where it is in the post's body.
+type Shortcode struct {
+	Embed
+	// Line is the line of the post's file it's on.
+	Line int
+	// start and end are its offsets in the body.
+	start, end int
+}
+
+// Find returns the ghembed shortcodes in p.
+func Find(p *content.Post) ([]Shortcode, error) {
+	var scs []Shortcode
+	for _, m := range shortcodeRe.FindAllStringSubmatchIndex(p.Body, -1) {
+		sc := Shortcode{
+			Line:  p.BodyLine + strings.Count(p.Body[:m[0]], "\n"),
+			start: m[0],
+			end:   m[1],
+		}
+		for _, a := range argRe.FindAllStringSubmatch(p.Body[m[2]:m[3]], -1) {
+			switch a[1] {
+			case "repo":
+				sc.Repo = a[2]
+			case "ref":
+				sc.Ref = a[2]
+			case "path":
+				sc.Path = strings.TrimPrefix(a[2], "/")
+			case "lines":
+				sc.Lines = a[2]
+			case "lang":
+				sc.Lang = a[2]
+			default:
+				return nil, fmt.Errorf("%s:%d: ghembed: unknown argument %s", p.Path, sc.Line, a[1])
+			}
+		}
+		if sc.Repo == "" || sc.Ref == "" || sc.Path == "" {
+			return nil, fmt.Errorf("%s:%d: ghembed needs repo, ref, and path", p.Path, sc.Line)
+		}
+		if !repoRe.MatchString(sc.Repo) || strings.Contains(sc.Repo, "..") {
+			return nil, fmt.Errorf("%s:%d: ghembed: repo=%q: want owner/name", p.Path, sc.Line, sc.Repo)
+		}
+		if clean := path.Clean(sc.Path); clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("%s:%d: ghembed: path=%q is outside the repo", p.Path, sc.Line, sc.Path)
+		}
+		if _, _, err := sc.Range(); err != nil {
+			return nil, fmt.Errorf("%s:%d: ghembed: %w", p.Path, sc.Line, err)
+		}
+		scs = append(scs, sc)
+	}
+	return scs, nil
+}
+
+// Pin replaces the refs of the shortcodes in src, the file of the post
+// they were found in, with the SHAs in shas, keyed by shortcode line.
+func Pin(src []byte, p *content.Post, scs []Shortcode, shas map[int]string) []byte {
+	// The body is the end of the file, so offsets into it count from
+	// where the file and the body part ways.
+	base := len(src) - len(p.Body)
+	out := string(src)
+	for i := len(scs) - 1; i >= 0; i-- {
+		sc := scs[i]
+		sha, ok := shas[sc.Line]
+		if !ok {
+			continue
+		}
+		code := out[base+sc.start : base+sc.end]
+		code = refRe.ReplaceAllLiteralString(code, `ref="`+sha+`"`)
+		out = out[:base+sc.start] + code + out[base+sc.end:]
+	}
+	return []byte(out)
+}
+
+// Fetcher gets files from GitHub, through the cache.
+type Fetcher struct {
+	HTTP *http.Client
+	// BaseURL is raw.githubusercontent.com's, for tests.
+	BaseURL string
+	// Cache is the directory files are kept in.
+	Cache string
+
+	// Fetched counts the files that weren't in the cache.
+	Fetched int
+}
+
+// maxFile bounds a fetched file; an embed of more is a mistake.
+const maxFile = 5 << 20
+
+// Fetch returns the file e embeds, at its commit.
+func (f *Fetcher) Fetch(ctx context.Context, e Embed) ([]byte, error) {
+	cached := filepath.Join(f.Cache, filepath.FromSlash(e.Repo), e.Ref, filepath.FromSlash(path.Clean(e.Path)))
+	if b, err := os.ReadFile(cached); err == nil {
+		return b, nil
+	}
+	base := f.BaseURL
+	if base == "" {
+		base = "https://raw.githubusercontent.com"
+	}
+	u := strings.TrimRight(base, "/") + "/" + e.Repo + "/" + e.Ref + "/" + e.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ghembed: %s: %s", u, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFile+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxFile {
+		return nil, fmt.Errorf("ghembed: %s is over %d MiB", u, maxFile>>20)
+	}
+	f.Fetched++
+	if err := os.MkdirAll(filepath.Dir(cached), 0o755); err != nil {
+		return nil, err
+	}
+	return b, os.WriteFile(cached, b, 0o644)
+}
+
+// Rendered is an embed as the shortcode shows it.
+type Rendered struct {
+	HTML string `json:"html"`
+	// URL is the embed's page on GitHub.
+	URL string `json:"url"`
+}
+
+// Render highlights the lines of src that e embeds, numbered as they are
+// upstream.
+func Render(e Embed, src []byte) (Rendered, error) {
+	lines := strings.Split(strings.TrimRight(string(src), "\n"), "\n")
+	from, to, err := e.Range()
+	if err != nil {
+		return Rendered{}, err
+	}
+	if from == 0 {
+		from, to = 1, len(lines)
+	}
+	if to > len(lines) {
+		return Rendered{}, fmt.Errorf("ghembed: lines=%s, but %s has %d", e.Lines, e.Path, len(lines))
+	}
+	lang := e.Lang
+	if lang == "" {
+		lang = strings.TrimPrefix(path.Ext(e.Path), ".")
+	}
+	html, err := highlight.Render(lang, strings.Join(lines[from-1:to], "\n"), highlight.Options{
+		LineNos:     "table",
+		LineNoStart: from,
+	})
+	if err != nil {
+		return Rendered{}, err
+	}
+	return Rendered{HTML: html, URL: e.URL()}, nil
+}
+
+// Manifest maps each embed's key to its rendering.
+type Manifest map[string]Rendered
+
+// Load reads the manifest at path. A missing file yields an empty manifest.
+func Load(path string) (Manifest, error) {
+	m := Manifest{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("ghembed: parse %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Save writes the manifest to path, with the HTML unescaped so it reads
+// in diffs.
+func (m Manifest) Save(path string) error {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
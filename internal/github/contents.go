@@ -0,0 +1,86 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrExists is returned by CreateFile for a path that's already taken.
+var ErrExists = errors.New("github: file exists")
+
+// CreateFile commits a new file at path on branch of repo, owner/name, and
+// returns the commit's web URL. It never overwrites: a path that exists is
+// ErrExists.
+func (c *Client) CreateFile(ctx context.Context, repo, branch, path, message string, b []byte) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"message": message,
+		"content": base64.StdEncoding.EncodeToString(b),
+		"branch":  branch,
+	})
+	if err != nil {
+		return "", err
+	}
+	var segs []string
+	for _, s := range strings.Split(path, "/") {
+		segs = append(segs, url.PathEscape(s))
+	}
+	p := "/repos/" + escapeRepo(repo) + "/contents/" + strings.Join(segs, "/")
+	req, err := c.request(ctx, http.MethodPut, p, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusUnprocessableEntity, http.StatusConflict:
+		// Without a sha, a PUT to an existing path is refused.
+		return "", fmt.Errorf("%w: %s", ErrExists, path)
+	default:
+		return "", status(resp, p)
+	}
+	var out struct {
+		Commit struct {
+			HTMLURL string `json:"html_url"`
+		} `json:"commit"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("github: %s: %w", p, err)
+	}
+	return out.Commit.HTMLURL, nil
+}
+
+// Dispatch starts a run of workflow, a file name like "hugo.yml", on ref
+// of repo. The workflow has to allow workflow_dispatch.
+func (c *Client) Dispatch(ctx context.Context, repo, workflow, ref string) error {
+	body, err := json.Marshal(map[string]string{"ref": ref})
+	if err != nil {
+		return err
+	}
+	p := "/repos/" + escapeRepo(repo) + "/actions/workflows/" + escapeRepo(workflow) + "/dispatches"
+	req, err := c.request(ctx, http.MethodPost, p, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return status(resp, p)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Package github is a small client for the parts of GitHub's API the
+// tooling needs: the repos on the projects page, and committing files and
+// starting workflows for cmd/mailpostd. REST reads are cached with their
+// ETags, and every repeat read is conditional: GitHub doesn't count a 304
+// against the rate limit, so a rebuild that finds nothing changed costs
+// nothing.
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultCache holds the cached responses between runs.
+const DefaultCache = ".github-cache.json"
+
+// UserAgent identifies the requests; GitHub rejects ones without it.
+const UserAgent = "rednafi.com projects (+https://rednafi.com/projects/)"
+
+// ErrNotFound is returned for a repo or user that doesn't exist.
+var ErrNotFound = errors.New("github: not found")
+
+// ErrEmpty is returned for the commits of a repo that has none.
+var ErrEmpty = errors.New("github: repository is empty")
+
+// Cached is a response kept for the next conditional request.
+type Cached struct {
+	ETag string          `json:"etag"`
+	Body json.RawMessage `json:"body"`
+}
+
+// Cache maps a request path to its last response.
+type Cache map[string]Cached
+
+// LoadCache reads the cache at path. A missing or unreadable cache is
+// empty, so every request is made in full.
+func LoadCache(path string) Cache {
+	c := Cache{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	if json.Unmarshal(b, &c) != nil {
+		return Cache{}
+	}
+	return c
+}
+
+// Client calls GitHub's API.
+type Client struct {
+	HTTP *http.Client
+	// Token, if set, raises the rate limit and is needed for GraphQL.
+	Token string
+	// BaseURL is the API's, for tests; empty is api.github.com.
+	BaseURL string
+	Cache   Cache
+
+	// Requests and NotModified count the REST requests made and the ones
+	// answered from the cache.
+	Requests, NotModified int
+
+	used map[string]bool
+}
+
+// Save writes the responses used by this client's requests to path,
+// dropping the ones it no longer made.
+func (c *Client) Save(path string) error {
+	keep := Cache{}
+	for p := range c.used {
+		if r, ok := c.Cache[p]; ok {
+			keep[p] = r
+		}
+	}
+	b, err := json.MarshalIndent(keep, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+func (c *Client) base() string {
+	if c.BaseURL == "" {
+		return "https://api.github.com"
+	}
+	return strings.TrimRight(c.BaseURL, "/")
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", UserAgent)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+// Get decodes the response to the REST path into v, making the request
+// conditional on the cached ETag and decoding the cached body on a 304.
+func (c *Client) Get(ctx context.Context, path string, v any) error {
+	if c.Cache == nil {
+		c.Cache = Cache{}
+	}
+	if c.used == nil {
+		c.used = map[string]bool{}
+	}
+	c.used[path] = true
+	req, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	cached, had := c.Cache[path]
+	if had && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	c.Requests++
+	switch {
+	case resp.StatusCode == http.StatusNotModified && had:
+		c.NotModified++
+		return json.Unmarshal(cached.Body, v)
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	case resp.StatusCode == http.StatusConflict:
+		return fmt.Errorf("%w: %s", ErrEmpty, path)
+	case resp.StatusCode != http.StatusOK:
+		return status(resp, path)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("github: %s: %w", path, err)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		c.Cache[path] = Cached{ETag: etag, Body: b}
+	} else {
+		delete(c.Cache, path)
+	}
+	return nil
+}
+
+// GraphQL runs query with vars and decodes its data into v. GraphQL
+// needs a token and can't be made conditional, so it's kept to what REST
+// doesn't offer.
+func (c *Client) GraphQL(ctx context.Context, query string, vars map[string]any, v any) error {
+	if c.Token == "" {
+		return errors.New("github: GraphQL needs a token")
+	}
+	body, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+	req, err := c.request(ctx, http.MethodPost, "/graphql", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return status(resp, "/graphql")
+	}
+	var doc struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("github: graphql: %w", err)
+	}
+	if len(doc.Errors) > 0 {
+		return fmt.Errorf("github: graphql: %s", doc.Errors[0].Message)
+	}
+	return json.Unmarshal(doc.Data, v)
+}
+
+// status describes a failed response, with when the rate limit resets if
+// that's what failed it.
+func status(resp *http.Response, path string) error {
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		var reset int64
+		fmt.Sscan(resp.Header.Get("X-RateLimit-Reset"), &reset)
+		return fmt.Errorf("github: %s: rate limited until %s", path, time.Unix(reset, 0).UTC().Format(time.RFC3339))
+	}
+	return fmt.Errorf("github: %s: %s", path, resp.Status)
+}
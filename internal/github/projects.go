@@ -0,0 +1,111 @@
+package github
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultPath is the file the projects layout reads as site.Data.projects.
+const DefaultPath = "data/projects.json"
+
+// Project is a repo on the projects page.
+type Project struct {
+	Name        string    `json:"name"`
+	FullName    string    `json:"full_name"`
+	URL         string    `json:"url"`
+	Homepage    string    `json:"homepage,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Language    string    `json:"language,omitempty"`
+	Topics      []string  `json:"topics,omitempty"`
+	Stars       int       `json:"stars"`
+	Forks       int       `json:"forks"`
+	Pinned      bool      `json:"pinned,omitempty"`
+	Archived    bool      `json:"archived,omitempty"`
+	LastCommit  time.Time `json:"last_commit,omitzero"`
+}
+
+// Projects returns user's projects: the repos pinned to their profile, in
+// their order there, then the repos of theirs they've starred, most stars
+// first. Forks are left out unless pinned. Pins need c.Token; without one
+// only the starred repos are listed.
+func Projects(ctx context.Context, c *Client, user string) ([]Project, error) {
+	var pinned []string
+	if c.Token != "" {
+		var err error
+		if pinned, err = c.Pinned(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	starred, err := c.Starred(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]Repo{}
+	var own []Repo
+	for _, r := range starred {
+		byName[strings.ToLower(r.FullName)] = r
+		if strings.EqualFold(r.Owner.Login, user) && !r.Fork {
+			own = append(own, r)
+		}
+	}
+	sort.SliceStable(own, func(i, j int) bool { return own[i].Stars > own[j].Stars })
+
+	var projects []Project
+	seen := map[string]bool{}
+	add := func(r Repo, pin bool) error {
+		key := strings.ToLower(r.FullName)
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		last, err := c.LastCommit(ctx, r.FullName)
+		if err != nil {
+			return err
+		}
+		projects = append(projects, Project{
+			Name:        r.Name,
+			FullName:    r.FullName,
+			URL:         r.HTMLURL,
+			Homepage:    r.Homepage,
+			Description: r.Description,
+			Language:    r.Language,
+			Topics:      r.Topics,
+			Stars:       r.Stars,
+			Forks:       r.Forks,
+			Pinned:      pin,
+			Archived:    r.Archived,
+			LastCommit:  last,
+		})
+		return nil
+	}
+	for _, name := range pinned {
+		r, ok := byName[strings.ToLower(name)]
+		if !ok {
+			if r, err = c.Repo(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+		if err := add(r, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range own {
+		if err := add(r, false); err != nil {
+			return nil, err
+		}
+	}
+	return projects, nil
+}
+
+// Write writes the projects to path for the projects layout, reporting
+// whether the file changed.
+func Write(path string, projects []Project) (bool, error) {
+	if projects == nil {
+		projects = []Project{}
+	}
+	return fsutil.WriteJSONIfChanged(path, projects)
+}
@@ -0,0 +1,132 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Repo is the part of a repository the projects page shows.
+type Repo struct {
+	FullName      string    `json:"full_name"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	HTMLURL       string    `json:"html_url"`
+	Homepage      string    `json:"homepage"`
+	Language      string    `json:"language"`
+	Topics        []string  `json:"topics"`
+	Stars         int       `json:"stargazers_count"`
+	Forks         int       `json:"forks_count"`
+	Fork          bool      `json:"fork"`
+	Archived      bool      `json:"archived"`
+	DefaultBranch string    `json:"default_branch"`
+	PushedAt      time.Time `json:"pushed_at"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+// perPage is the largest page GitHub's REST API serves.
+const perPage = 100
+
+// maxPages bounds the pages read of a list, so a runaway list can't spend
+// the rate limit.
+const maxPages = 10
+
+// Starred returns the repos user has starred, most recently starred first.
+func (c *Client) Starred(ctx context.Context, user string) ([]Repo, error) {
+	var all []Repo
+	for page := 1; page <= maxPages; page++ {
+		var repos []Repo
+		path := fmt.Sprintf("/users/%s/starred?per_page=%d&page=%d", url.PathEscape(user), perPage, page)
+		if err := c.Get(ctx, path, &repos); err != nil {
+			return nil, err
+		}
+		all = append(all, repos...)
+		if len(repos) < perPage {
+			break
+		}
+	}
+	return all, nil
+}
+
+// Repo returns the repo named owner/name.
+func (c *Client) Repo(ctx context.Context, fullName string) (Repo, error) {
+	var r Repo
+	err := c.Get(ctx, "/repos/"+escapeRepo(fullName), &r)
+	return r, err
+}
+
+// LastCommit returns when the last commit on the repo's default branch was
+// made, or the zero time for an empty repo.
+func (c *Client) LastCommit(ctx context.Context, fullName string) (time.Time, error) {
+	var commits []struct {
+		Commit struct {
+			Committer struct {
+				Date time.Time `json:"date"`
+			} `json:"committer"`
+		} `json:"commit"`
+	}
+	err := c.Get(ctx, "/repos/"+escapeRepo(fullName)+"/commits?per_page=1", &commits)
+	if errors.Is(err, ErrEmpty) || err == nil && len(commits) == 0 {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return commits[0].Commit.Committer.Date.UTC(), nil
+}
+
+// CommitSHA returns the full SHA of the commit ref, a branch, tag, or
+// short SHA, names in the repo.
+func (c *Client) CommitSHA(ctx context.Context, fullName, ref string) (string, error) {
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := c.Get(ctx, "/repos/"+escapeRepo(fullName)+"/commits/"+url.PathEscape(ref), &commit); err != nil {
+		return "", err
+	}
+	return commit.SHA, nil
+}
+
+// Pinned returns the full names of the repos pinned to user's profile, in
+// their order there. Pins are only in the GraphQL API, so this needs a
+// token.
+func (c *Client) Pinned(ctx context.Context, user string) ([]string, error) {
+	var doc struct {
+		User *struct {
+			PinnedItems struct {
+				Nodes []struct {
+					NameWithOwner string `json:"nameWithOwner"`
+				} `json:"nodes"`
+			} `json:"pinnedItems"`
+		} `json:"user"`
+	}
+	err := c.GraphQL(ctx, `query($login: String!) {
+  user(login: $login) {
+    pinnedItems(first: 6, types: REPOSITORY) { nodes { ... on Repository { nameWithOwner } } }
+  }
+}`, map[string]any{"login": user}, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.User == nil {
+		return nil, fmt.Errorf("%w: user %s", ErrNotFound, user)
+	}
+	var names []string
+	for _, n := range doc.User.PinnedItems.Nodes {
+		names = append(names, n.NameWithOwner)
+	}
+	return names, nil
+}
+
+func escapeRepo(fullName string) string {
+	owner, name, ok := strings.Cut(fullName, "/")
+	if !ok {
+		return url.PathEscape(fullName)
+	}
+	return url.PathEscape(owner) + "/" + url.PathEscape(name)
+}
@@ -0,0 +1,238 @@
+// Package gitmeta derives each post's created and modified dates and a
+// changelog from git history, so lastmod doesn't have to be kept up to date
+// by hand in the front matter.
+package gitmeta
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultPath is where templates read the history from, as
+// site.Data.gitmeta.
+const DefaultPath = "data/gitmeta.json"
+
+// IgnoreRevsFile lists commits, one full hash per line, that don't count as
+// edits: reformatting, front matter migrations, and the like. It's the same
+// file git blame reads with --ignore-revs-file.
+const IgnoreRevsFile = ".git-blame-ignore-revs"
+
+// Change is a commit that touched a post.
+type Change struct {
+	Hash    string    `json:"hash"`
+	Date    time.Time `json:"date"`
+	Author  string    `json:"author"`
+	Subject string    `json:"subject"`
+}
+
+// Meta is a post's history.
+type Meta struct {
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	// Changes lists the edits after the first commit, newest first.
+	Changes []Change `json:"changes"`
+}
+
+// Collect reads the history of the posts under dir, following renames, and
+// maps each post's content.Post.DataKey to its Meta. Commits in ignore are
+// skipped as edits but still count for renames and for the created date.
+// Posts that were never committed are left out.
+//
+// A shallow clone would make every post look as if it was written in the
+// last fetched commit, so Collect refuses to run in one.
+func Collect(ctx context.Context, dir string, posts []*content.Post, ignore map[string]bool) (map[string]Meta, error) {
+	shallow, err := git(ctx, dir, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(string(shallow)) == "true" {
+		return nil, errors.New("gitmeta: shallow clone; fetch the full history (fetch-depth: 0)")
+	}
+	// One pass over the whole history, newest first. --relative makes the
+	// paths relative to dir, matching content.Post.Path.
+	out, err := git(ctx, dir, "log", "--no-merges", "-M", "--name-status", "--relative",
+		"--format=%x1e%H%x1f%aI%x1f%an%x1f%s", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	hist, err := parseLog(out, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]Meta)
+	for _, p := range posts {
+		if h, ok := hist[p.Path]; ok {
+			m[p.DataKey()] = h
+		}
+	}
+	return m, nil
+}
+
+// gone marks a path whose older history belongs to a different file: it
+// was added, or renamed onto, at that point.
+const gone = "\x00"
+
+// parseLog folds git log --name-status output into per-file histories,
+// keyed by each file's newest path.
+func parseLog(out []byte, ignore map[string]bool) (map[string]Meta, error) {
+	type commit struct {
+		Change
+		edit bool
+	}
+	// Every commit that touched each file, newest first.
+	byPath := make(map[string][]commit)
+	// alias maps a path as it was at the current point in history to the
+	// path the file has today.
+	alias := make(map[string]string)
+	resolve := func(p string) string {
+		if a, ok := alias[p]; ok {
+			return a
+		}
+		return p
+	}
+	record := func(path string, c Change, edit bool) {
+		if path != gone {
+			byPath[path] = append(byPath[path], commit{c, edit})
+		}
+	}
+
+	for _, rec := range bytes.Split(out, []byte{0x1e}) {
+		if len(bytes.TrimSpace(rec)) == 0 {
+			continue
+		}
+		sc := bufio.NewScanner(bytes.NewReader(rec))
+		sc.Buffer(nil, 1<<20)
+		sc.Scan()
+		head := strings.Split(sc.Text(), "\x1f")
+		if len(head) != 4 {
+			return nil, fmt.Errorf("gitmeta: unexpected log line %q", sc.Text())
+		}
+		date, err := time.Parse(time.RFC3339, head[1])
+		if err != nil {
+			return nil, fmt.Errorf("gitmeta: commit %s: %w", head[0], err)
+		}
+		c := Change{Hash: head[0], Date: date.UTC(), Author: head[2], Subject: head[3]}
+		edit := !ignore[c.Hash]
+
+		for sc.Scan() {
+			f := strings.Split(sc.Text(), "\t")
+			if len(f) < 2 || f[0] == "" {
+				continue
+			}
+			switch status := f[0]; status[0] {
+			case 'R':
+				if len(f) < 3 {
+					continue
+				}
+				cur := resolve(f[2])
+				// A pure rename doesn't change what the post says.
+				record(cur, c, edit && status != "R100")
+				alias[f[1]] = cur
+				alias[f[2]] = gone
+			case 'A':
+				record(resolve(f[1]), c, edit)
+				alias[f[1]] = gone
+			default:
+				record(resolve(f[1]), c, edit)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	hist := make(map[string]Meta, len(byPath))
+	for path, commits := range byPath {
+		// The oldest commit created the post; it isn't an edit of it.
+		first := commits[len(commits)-1]
+		h := Meta{Created: first.Date, Modified: first.Date, Changes: []Change{}}
+		for _, c := range commits[:len(commits)-1] {
+			if c.edit {
+				h.Changes = append(h.Changes, c.Change)
+			}
+		}
+		if len(h.Changes) > 0 {
+			h.Modified = h.Changes[0].Date
+		}
+		hist[path] = h
+	}
+	return hist, nil
+}
+
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	// Paths like content/mélange/ would otherwise come back octal-quoted.
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "core.quotePath=false"}, args...)...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gitmeta: git %s: %w: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// LoadIgnoreRevs reads a list of commit hashes in the format of
+// IgnoreRevsFile, skipping blank lines and # comments. A missing file yields
+// an empty set.
+func LoadIgnoreRevs(path string) (map[string]bool, error) {
+	revs := make(map[string]bool)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return revs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line, _, _ = strings.Cut(line, "#"); strings.TrimSpace(line) != "" {
+			revs[strings.TrimSpace(line)] = true
+		}
+	}
+	return revs, nil
+}
+
+// Load reads the history written by Write. A missing file yields an empty
+// map.
+func Load(path string) (map[string]Meta, error) {
+	m := make(map[string]Meta)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("gitmeta: parse %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Apply sets the Lastmod of every post in m to its modified date, unless
+// the front matter already has a later one.
+func Apply(posts []*content.Post, m map[string]Meta) {
+	for _, p := range posts {
+		if h, ok := m[p.DataKey()]; ok && h.Modified.After(p.Lastmod) {
+			p.Lastmod = h.Modified
+		}
+	}
+}
+
+// Write encodes m to path, leaving the file alone if it's unchanged. It
+// reports whether the file was written.
+func Write(path string, m map[string]Meta) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, m)
+}
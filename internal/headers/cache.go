@@ -0,0 +1,199 @@
+package headers
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/fingerprint"
+	"github.com/rednafi/rednafi.com/internal/r2"
+)
+
+// Class gives the files with one of Exts their Cache-Control. A class
+// without extensions covers every file no other class does, pages
+// included.
+type Class struct {
+	Name         string   `toml:"name"`
+	Exts         []string `toml:"exts"`
+	CacheControl string   `toml:"cache-control"`
+}
+
+// Cache is how a file may be cached.
+type Cache struct {
+	Control string
+	// Immutable files never change under their URL, so they're kept for
+	// good and never revalidated.
+	Immutable bool
+	// ETag is whether responses should carry an ETag: files that may be
+	// revalidated need one to answer with a 304.
+	ETag bool
+	// From names what decided it: "fingerprinted", the path of the rule
+	// that sets it, or the class.
+	From string
+}
+
+func (p *Policy) checkClasses() error {
+	var defaults int
+	for _, c := range p.Cache {
+		switch {
+		case c.Name == "":
+			return fmt.Errorf("cache class without a name")
+		case c.CacheControl == "":
+			return fmt.Errorf("cache class %q sets no cache-control", c.Name)
+		case len(c.Exts) == 0:
+			defaults++
+		}
+		for _, e := range c.Exts {
+			if !strings.HasPrefix(e, ".") || strings.ContainsAny(e, "/*") {
+				return fmt.Errorf("cache class %q: %q isn't an extension like .css", c.Name, e)
+			}
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("only one cache class may go without exts")
+	}
+	return nil
+}
+
+// class returns the class of the file served at urlPath. Pages, served at
+// paths ending in /, are .html files.
+func (p *Policy) class(urlPath string) (Class, bool) {
+	ext := path.Ext(urlPath)
+	if strings.HasSuffix(urlPath, "/") {
+		ext = ".html"
+	}
+	var def Class
+	var ok bool
+	for _, c := range p.Cache {
+		if len(c.Exts) == 0 {
+			def, ok = c, true
+		} else if slices.Contains(c.Exts, ext) {
+			return c, true
+		}
+	}
+	return def, ok
+}
+
+// CacheFor returns how the file served at urlPath may be cached: a
+// fingerprinted file is immutable, whatever the rules say; otherwise the
+// last rule matching the path that sets Cache-Control decides, and
+// without one the file's class does. The zero Cache means the policy has
+// nothing to say.
+func (p *Policy) CacheFor(urlPath string) Cache {
+	if fingerprint.Hashed(urlPath) {
+		return cache(fingerprint.CacheControl, "fingerprinted")
+	}
+	for _, r := range slices.Backward(p.Rule) {
+		if v, ok := r.Headers["Cache-Control"]; ok && r.match(urlPath) {
+			return cache(v, r.Path)
+		}
+	}
+	if c, ok := p.class(urlPath); ok {
+		return cache(c.CacheControl, c.Name)
+	}
+	return Cache{}
+}
+
+func cache(control, from string) Cache {
+	return Cache{Control: control, Immutable: hasDirective(control, "immutable"), ETag: Revalidates(control), From: from}
+}
+
+// Revalidates reports whether a response with the given Cache-Control may
+// be revalidated, and so should carry an ETag: it may be stored, and it
+// isn't immutable.
+func Revalidates(cacheControl string) bool {
+	return cacheControl != "" && !hasDirective(cacheControl, "immutable") && !hasDirective(cacheControl, "no-store")
+}
+
+func hasDirective(cacheControl, name string) bool {
+	for d := range strings.SplitSeq(cacheControl, ",") {
+		d, _, _ = strings.Cut(d, "=")
+		if strings.EqualFold(strings.TrimSpace(d), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SameCacheControl reports whether two Cache-Control values have the
+// same directives, in any order and case.
+func SameCacheControl(a, b string) bool {
+	norm := func(v string) []string {
+		var ds []string
+		for d := range strings.SplitSeq(v, ",") {
+			if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+				ds = append(ds, strings.ReplaceAll(d, " ", ""))
+			}
+		}
+		slices.Sort(ds)
+		return ds
+	}
+	return slices.Equal(norm(a), norm(b))
+}
+
+// Expand returns the policy for the site built into dir as path rules
+// alone, for the _headers file: each class becomes a rule for its
+// extensions, before the policy's own rules so those still win, and each
+// fingerprinted file gets a rule of its own after them.
+func (p *Policy) Expand(dir string) (*Policy, error) {
+	out := &Policy{}
+	rules := slices.Clone(p.Rule)
+	if c, ok := p.class("/"); ok {
+		def := Rule{Path: "/*", Headers: map[string]string{}}
+		// The policy's catch-all absorbs the default, unless it sets its
+		// own Cache-Control.
+		if len(rules) > 0 && rules[0].Path == "/*" {
+			maps.Copy(def.Headers, rules[0].Headers)
+			rules = rules[1:]
+		}
+		if _, ok := def.Headers["Cache-Control"]; !ok {
+			def.Headers["Cache-Control"] = c.CacheControl
+		}
+		out.Rule = append(out.Rule, def)
+	}
+	for _, c := range p.Cache {
+		for _, e := range c.Exts {
+			if e == ".html" {
+				// Pages are served by their directory.
+				continue
+			}
+			out.Rule = append(out.Rule, Rule{Path: "/*" + e, Headers: map[string]string{"Cache-Control": c.CacheControl}})
+		}
+	}
+	out.Rule = append(out.Rule, rules...)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if u := "/" + filepath.ToSlash(rel); fingerprint.Hashed(u) {
+			out.Rule = append(out.Rule, Rule{Path: u, Headers: map[string]string{"Cache-Control": fingerprint.CacheControl}})
+		}
+		return nil
+	})
+	return out, err
+}
+
+// SetMetadata sets each file's Cache-Control and Content-Type from the
+// policy, for R2 to store with the object and send back with it. urlPath
+// maps a file to the path it's served at. Files the policy says nothing
+// about keep what they have.
+func (p *Policy) SetMetadata(files []r2.File, urlPath func(r2.File) string) {
+	for i, f := range files {
+		u := urlPath(f)
+		if c := p.CacheFor(u); c.Control != "" {
+			files[i].CacheControl = c.Control
+		}
+		if t := p.For(u).Get("Content-Type"); t != "" {
+			files[i].ContentType = t
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Package headers reads the site's response header policy from
+// data/headers.toml: security headers by path, and cache lifetimes by
+// path, by file type, and by whether a file is fingerprinted. `blogctl
+// deploy` and cmd/r2sync store each object's Cache-Control from it,
+// `blogctl serve` sends all of it, and `blogctl headers verify` checks
+// the live site against it, so the local preview and the edge agree. It
+// also reads and writes the _headers file `blogctl csp` adds the pages'
+// Content-Security-Policy to.
+package headers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultPath is where the policy lives.
+const DefaultPath = "data/headers.toml"
+
+// Rule sets headers on the paths Path matches: an exact path, or one with
+// a single * standing for any run of characters, like /images/* or
+// /*.css.
+type Rule struct {
+	Path    string            `toml:"path"`
+	Headers map[string]string `toml:"headers"`
+}
+
+// Policy is the rules in file order; where several match a path, later
+// ones override the headers they share with earlier ones. Cache sets the
+// Cache-Control of the files no rule gives one, by type.
+type Policy struct {
+	Rule  []Rule  `toml:"rule"`
+	Cache []Class `toml:"cache"`
+}
+
+// Load reads the policy at path. A missing file sets no headers.
+func Load(path string) (*Policy, error) {
+	p := &Policy{}
+	_, err := toml.DecodeFile(path, p)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("headers: %s: %w", path, err)
+	}
+	for _, r := range p.Rule {
+		if !strings.HasPrefix(r.Path, "/") {
+			return nil, fmt.Errorf("headers: %s: path %q must start with /", path, r.Path)
+		}
+		if strings.Count(r.Path, "*") > 1 {
+			return nil, fmt.Errorf("headers: %s: path %q may have one * at most", path, r.Path)
+		}
+	}
+	if err := p.checkClasses(); err != nil {
+		return nil, fmt.Errorf("headers: %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (r Rule) match(urlPath string) bool {
+	if prefix, suffix, ok := strings.Cut(r.Path, "*"); ok {
+		return len(urlPath) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(urlPath, prefix) && strings.HasSuffix(urlPath, suffix)
+	}
+	return urlPath == r.Path
+}
+
+// For returns the headers for the file served at urlPath.
+func (p *Policy) For(urlPath string) http.Header {
+	h := http.Header{}
+	for _, r := range p.Rule {
+		if r.match(urlPath) {
+			for k, v := range r.Headers {
+				h.Set(k, v)
+			}
+		}
+	}
+	return h
+}
+
+// File is the name of the headers file in a built site, in the format
+// Cloudflare Pages and Netlify read: a path on a line of its own, then its
+// headers indented below it.
+const File = "_headers"
+
+// Parse reads a headers file into a policy. Headers a rule detaches with
+// "! Name" are dropped, since For already lets later rules override.
+func Parse(r io.Reader) (*Policy, error) {
+	p := &Policy{}
+	sc := bufio.NewScanner(r)
+	n := 0
+	for sc.Scan() {
+		n++
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case line[0] != ' ' && line[0] != '\t':
+			p.Rule = append(p.Rule, Rule{Path: trimmed, Headers: map[string]string{}})
+		case len(p.Rule) == 0:
+			return nil, fmt.Errorf("headers: line %d: header before any path", n)
+		case strings.HasPrefix(trimmed, "!"):
+		default:
+			k, v, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				return nil, fmt.Errorf("headers: line %d: %q isn't a header", n, trimmed)
+			}
+			p.Rule[len(p.Rule)-1].Headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return p, sc.Err()
+}
+
+// Format writes the policy as a headers file. Where a rule overrides a
+// header an earlier rule sets on the same paths, it detaches the earlier
+// value first, since those files add up the matching rules' headers
+// rather than let the last one win.
+func (p *Policy) Format() []byte {
+	var b bytes.Buffer
+	for i, r := range p.Rule {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintln(&b, r.Path)
+		keys := make([]string, 0, len(r.Headers))
+		for k := range r.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, prev := range p.Rule[:i] {
+				if _, ok := prev.Headers[k]; ok && prev.match(strings.TrimSuffix(r.Path, "*")) {
+					fmt.Fprintf(&b, "  ! %s\n", k)
+					break
+				}
+			}
+			fmt.Fprintf(&b, "  %s: %s\n", k, r.Headers[k])
+		}
+	}
+	return b.Bytes()
+}
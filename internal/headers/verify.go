@@ -0,0 +1,82 @@
+package headers
+
+import (
+	"io/fs"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Mismatch is a header a response got wrong.
+type Mismatch struct {
+	Header    string
+	Want, Got string
+}
+
+// Check returns how the headers of a response for the file served at
+// urlPath differ from what p says: a different Cache-Control, no ETag on
+// a file that may be revalidated, or a different value of any other
+// header p sets.
+func (p *Policy) Check(urlPath string, got http.Header) []Mismatch {
+	var out []Mismatch
+	c := p.CacheFor(urlPath)
+	if v := got.Get("Cache-Control"); c.Control != "" && !SameCacheControl(c.Control, v) {
+		out = append(out, Mismatch{"Cache-Control", c.Control, v})
+	}
+	if c.ETag && got.Get("ETag") == "" {
+		out = append(out, Mismatch{"ETag", "any", ""})
+	}
+	want := p.For(urlPath)
+	for _, k := range slices.Sorted(maps.Keys(want)) {
+		if k == "Cache-Control" {
+			continue
+		}
+		if v := got.Get(k); v != want.Get(k) {
+			out = append(out, Mismatch{k, want.Get(k), v})
+		}
+	}
+	return out
+}
+
+// Samples returns the URL paths of up to per files of the site built into
+// dir for each way p caches them, by rule, class, or fingerprint, so a
+// check of the live site covers every one. They're taken in path order,
+// so the home page comes first.
+func (p *Policy) Samples(dir string, per int) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		u := "/" + filepath.ToSlash(rel)
+		if u == "/"+File {
+			return nil
+		}
+		if base, ok := strings.CutSuffix(u, "/index.html"); ok {
+			u = base + "/"
+		}
+		paths = append(paths, u)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+
+	taken := map[string]int{}
+	var out []string
+	for _, u := range paths {
+		from := p.CacheFor(u).From
+		if taken[from] < per {
+			taken[from]++
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
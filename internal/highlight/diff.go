@@ -0,0 +1,64 @@
+package highlight
+
+import (
+	"regexp"
+	"strings"
+)
+
+// lineKind is the role of a line in a diff fence.
+type lineKind int
+
+const (
+	unchanged lineKind = iota
+	added
+	removed
+	hunk
+)
+
+var kindClass = map[lineKind]string{
+	added:   "diff-add",
+	removed: "diff-del",
+	hunk:    "diff-hunk",
+}
+
+// diffLang reports the underlying language of a fence like "diff-go".
+func diffLang(lang string) (string, bool) {
+	base, ok := strings.CutPrefix(lang, "diff-")
+	return base, ok && base != ""
+}
+
+// splitDiff strips the +, -, or space marker from each line of a unified
+// diff body so the rest can be highlighted as source code, and returns each
+// line's kind. Hunk headers are kept as they are.
+func splitDiff(code string) (string, []lineKind) {
+	lines := strings.Split(strings.TrimRight(code, "\n"), "\n")
+	kinds := make([]lineKind, len(lines))
+	for i, l := range lines {
+		switch {
+		case strings.HasPrefix(l, "@@"):
+			kinds[i] = hunk
+		case strings.HasPrefix(l, "+"):
+			kinds[i], lines[i] = added, l[1:]
+		case strings.HasPrefix(l, "-"):
+			kinds[i], lines[i] = removed, l[1:]
+		case strings.HasPrefix(l, " "):
+			lines[i] = l[1:]
+		}
+	}
+	return strings.Join(lines, "\n"), kinds
+}
+
+var lineSpanRe = regexp.MustCompile(`<span class="line( hl)?">`)
+
+// markDiff adds the diff classes to Chroma's per-line spans. The markers
+// themselves come back through CSS, so they aren't copied with the code.
+func markDiff(html string, kinds []lineKind) string {
+	i := 0
+	return lineSpanRe.ReplaceAllStringFunc(html, func(span string) string {
+		defer func() { i++ }()
+		if i >= len(kinds) || kinds[i] == unchanged {
+			return span
+		}
+		return strings.TrimSuffix(span, `">`) + " " + kindClass[kinds[i]] + `">`
+	})
+}
@@ -0,0 +1,250 @@
+// Package highlight pre-renders the posts' fenced code blocks with Chroma,
+// so pages ship static, class-based HTML and a small stylesheet instead of
+// highlighting in the browser.
+//
+// The render-codeblock hook looks each block up by its ordinal on the page
+// in data/highlight/<key>.json, keyed by content.Post.DataKey so a
+// translation's blocks are under its language, and uses the stored HTML when the block's
+// hash still matches, falling back to Hugo's own highlighter otherwise.
+package highlight
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+// DefaultDir is where the render hook reads blocks from, as
+// site.Data.highlight.
+const DefaultDir = "data/highlight"
+
+// DefaultCSS is picked up by PaperMod, which bundles every stylesheet under
+// assets/css/extended/.
+const DefaultCSS = "assets/css/extended/highlight.css"
+
+// DefaultStyle is the Chroma style the stylesheet is generated from.
+const DefaultStyle = "github"
+
+// Block is a rendered code block.
+type Block struct {
+	// Hash identifies the code the HTML was rendered from; see Hash.
+	Hash string `json:"hash"`
+	Lang string `json:"lang,omitempty"`
+	HTML string `json:"html"`
+}
+
+// Hash returns the hex SHA-256 of code without trailing newlines. The hook
+// computes the same from .Inner with sha256 and strings.TrimRight.
+func Hash(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimRight(code, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Options are the rendering attributes Hugo accepts in a fence's info
+// string, as in "go {linenos=table, hl_lines=[3,5-7], linenostart=10}".
+type Options struct {
+	// LineNos is "", "inline", or "table".
+	LineNos string
+	// HLLines holds inclusive ranges of lines to emphasize. As in Hugo,
+	// they count the block's lines from 1 whatever LineNoStart is.
+	HLLines [][2]int
+	// LineNoStart is the number of the first line; 0 means 1.
+	LineNoStart int
+}
+
+// ParseOptions reads Options from the attributes of a fence.
+func ParseOptions(attrs map[string]string) (Options, error) {
+	var o Options
+	switch v := attrs["linenos"]; v {
+	case "", "false":
+	case "true", "table":
+		o.LineNos = "table"
+	case "inline":
+		o.LineNos = "inline"
+	default:
+		return o, fmt.Errorf("linenos=%s: want true, false, inline, or table", v)
+	}
+	if v := attrs["linenostart"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return o, fmt.Errorf("linenostart=%s: %w", v, err)
+		}
+		o.LineNoStart = n
+	}
+	if v := attrs["hl_lines"]; v != "" {
+		r, err := parseLines(v)
+		if err != nil {
+			return o, fmt.Errorf("hl_lines=%s: %w", v, err)
+		}
+		o.HLLines = r
+	}
+	return o, nil
+}
+
+// parseLines reads a line list like "[3,5-7]" or "3 5-7".
+func parseLines(s string) ([][2]int, error) {
+	s = strings.Trim(strings.TrimSpace(s), "[]")
+	var out [][2]int
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		lo, hi, isRange := strings.Cut(strings.Trim(f, `"'`), "-")
+		a, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, err
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(hi); err != nil {
+				return nil, err
+			}
+		}
+		if b < a {
+			return nil, fmt.Errorf("range %s runs backwards", f)
+		}
+		out = append(out, [2]int{a, b})
+	}
+	return out, nil
+}
+
+// Render highlights code as lang. Unknown languages are rendered as plain
+// text so the markup, and the stylesheet, stay the same for every block.
+//
+// A lang like "diff-go" takes a unified diff of Go source: the lines are
+// highlighted as Go and marked as added or removed.
+func Render(lang, code string, o Options) (string, error) {
+	src := lang
+	var kinds []lineKind
+	if base, ok := diffLang(lang); ok {
+		src = base
+		code, kinds = splitDiff(code)
+	}
+	lexer := lexers.Get(src)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	start := o.LineNoStart
+	if start == 0 {
+		start = 1
+	}
+	// Chroma matches highlighted lines against the line numbers.
+	hl := make([][2]int, len(o.HLLines))
+	for i, r := range o.HLLines {
+		hl[i] = [2]int{r[0] + start - 1, r[1] + start - 1}
+	}
+	f := chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.TabWidth(4),
+		chromahtml.WithLineNumbers(o.LineNos != ""),
+		chromahtml.LineNumbersInTable(o.LineNos == "table"),
+		chromahtml.BaseLineNumber(start),
+		chromahtml.HighlightLines(hl),
+	)
+	it, err := lexer.Tokenise(nil, strings.TrimRight(code, "\n")+"\n")
+	if err != nil {
+		return "", fmt.Errorf("highlight: %s: %w", lang, err)
+	}
+	var b strings.Builder
+	if lang != "" {
+		fmt.Fprintf(&b, `<div class="highlight" data-lang="%[1]s"><span class="lang-badge">%[1]s</span>`, html.EscapeString(lang))
+	} else {
+		b.WriteString(`<div class="highlight">`)
+	}
+	var out strings.Builder
+	if err := f.Format(&out, styles.Get(DefaultStyle), it); err != nil {
+		return "", fmt.Errorf("highlight: %s: %w", lang, err)
+	}
+	if kinds != nil {
+		b.WriteString(markDiff(out.String(), kinds))
+	} else {
+		b.WriteString(out.String())
+	}
+	b.WriteString("</div>")
+	return b.String(), nil
+}
+
+// Post renders every fenced block in p, in page order. Blocks whose
+// attributes don't parse are reported and left to Hugo.
+func Post(p *content.Post) ([]Block, []error) {
+	var (
+		out  []Block
+		errs []error
+	)
+	for _, sb := range snippet.Extract(p) {
+		b := Block{Hash: Hash(sb.Code), Lang: sb.Lang}
+		o, err := ParseOptions(sb.Attrs)
+		if err == nil {
+			b.HTML, err = Render(sb.Lang, sb.Code, o)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", p.Path, sb.Line, err))
+			// An empty hash never matches, so the hook falls back.
+			b = Block{}
+		}
+		out = append(out, b)
+	}
+	return out, errs
+}
+
+// CSS returns the stylesheet for the named Chroma style, plus the rules for
+// the language badge and diff lines.
+func CSS(style string) (string, error) {
+	s, ok := styles.Registry[style]
+	if !ok {
+		return "", fmt.Errorf("highlight: unknown style %q", style)
+	}
+	var b bytes.Buffer
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&b, s); err != nil {
+		return "", err
+	}
+	b.WriteString(extraCSS)
+	return b.String(), nil
+}
+
+const extraCSS = `.highlight[data-lang] { position: relative }
+.highlight .lang-badge {
+  position: absolute; top: 0; right: 0; z-index: 1;
+  padding: 0 .5em; font-size: .75em; line-height: 1.8;
+  text-transform: lowercase; opacity: .6; pointer-events: none;
+}
+.chroma .line.diff-add { display: block; background-color: rgba(46, 160, 67, .15) }
+.chroma .line.diff-del { display: block; background-color: rgba(248, 81, 73, .15) }
+.chroma .line.diff-hunk { display: block; opacity: .6 }
+.chroma .line.diff-add::before, .chroma .line.diff-del::before {
+  display: inline-block; width: 1.5ch; margin-left: -1.5ch;
+  user-select: none; opacity: .8;
+}
+.chroma .line.diff-add::before { content: "+" }
+.chroma .line.diff-del::before { content: "-" }
+`
+
+// Write stores blocks as dir/<key>.json, where key is a
+// content.Post.DataKey, so a translation's go in a directory of its
+// language, as dir/bn/pathlib.json. It leaves the file alone if it's
+// unchanged, and reports whether it was written.
+func Write(dir, key string, blocks []Block) (bool, error) {
+	// Keep the HTML readable in diffs rather than \u003c-escaped.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(blocks); err != nil {
+		return false, err
+	}
+	return fsutil.WriteIfChanged(filepath.Join(dir, filepath.FromSlash(key)+".json"), b.Bytes())
+}
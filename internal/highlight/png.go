@@ -0,0 +1,132 @@
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// PNG limits: longer lines are cut, and blocks taller than MaxPNGLines
+// are cut with a note, so an image stays legible on a phone.
+const (
+	MaxPNGColumns = 90
+	MaxPNGLines   = 50
+)
+
+// pngSize is the font size, in pixels; images are drawn at twice the
+// size they're shown at so they stay sharp.
+const (
+	pngSize    = 28
+	pngPadding = 48
+)
+
+// PNG highlights code as lang, in DefaultStyle, and draws it on an image
+// sized to fit, for places that can't show HTML, like the posts of a
+// social thread. The fonts are the Go fonts, as for the social cards.
+func PNG(lang, code string) ([]byte, error) {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+	code = strings.ReplaceAll(strings.TrimRight(code, "\n"), "\t", "    ")
+	it, err := lexer.Tokenise(nil, code+"\n")
+	if err != nil {
+		return nil, fmt.Errorf("highlight: %s: %w", lang, err)
+	}
+	lines := chroma.SplitTokensIntoLines(it.Tokens())
+	cut := len(lines) > MaxPNGLines
+	if cut {
+		lines = lines[:MaxPNGLines]
+	}
+
+	f, err := opentype.Parse(gomono.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: pngSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	adv, _ := face.GlyphAdvance('m')
+	lineHeight := face.Metrics().Height.Ceil() * 3 / 2
+
+	cols := 20
+	for _, l := range lines {
+		cols = max(cols, min(lineWidth(l), MaxPNGColumns))
+	}
+	rows := len(lines)
+	if cut {
+		rows++
+	}
+	w := 2*pngPadding + cols*adv.Ceil()
+	h := 2*pngPadding + rows*lineHeight
+
+	style := styles.Get(DefaultStyle)
+	bg := rgb(style.Get(chroma.Background).Background, color.White)
+	fg := rgb(style.Get(chroma.Text).Colour, color.Black)
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	d := font.Drawer{Dst: img, Face: face}
+	y := pngPadding + face.Metrics().Ascent.Ceil()
+	for _, l := range lines {
+		d.Dot = fixed.P(pngPadding, y)
+		col, long := 0, lineWidth(l) > MaxPNGColumns
+		for _, t := range l {
+			d.Src = image.NewUniform(rgb(style.Get(t.Type).Colour, fg))
+			for _, r := range strings.TrimRight(t.Value, "\n") {
+				if long && col == MaxPNGColumns-1 {
+					r = '…'
+				}
+				if col >= MaxPNGColumns {
+					break
+				}
+				d.DrawString(string(r))
+				col++
+			}
+		}
+		y += lineHeight
+	}
+	if cut {
+		d.Dot = fixed.P(pngPadding, y)
+		d.Src = image.NewUniform(rgb(style.Get(chroma.Comment).Colour, fg))
+		d.DrawString(fmt.Sprintf("… %d more lines in the post", strings.Count(code, "\n")+1-MaxPNGLines))
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// lineWidth is the columns a line of tokens takes.
+func lineWidth(l []chroma.Token) int {
+	n := 0
+	for _, t := range l {
+		n += len([]rune(strings.TrimRight(t.Value, "\n")))
+	}
+	return n
+}
+
+// rgb returns c as a color, or def when the style doesn't set it.
+func rgb(c chroma.Colour, def color.Color) color.Color {
+	if !c.IsSet() {
+		return def
+	}
+	return color.RGBA{c.Red(), c.Green(), c.Blue(), 0xff}
+}
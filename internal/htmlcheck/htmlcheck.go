@@ -0,0 +1,237 @@
+// Package htmlcheck validates the pages Hugo generates: that the markup is
+// well formed, that ids are unique, and that each page carries the
+// metadata search engines and link previews read, a canonical URL, Open
+// Graph and Twitter card tags, a description of a sensible length, and a
+// single h1.
+package htmlcheck
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Rules reported in Problem.Rule.
+const (
+	RuleStructure   = "structure"
+	RuleDuplicateID = "duplicate-id"
+	RuleCanonical   = "canonical"
+	RuleOpenGraph   = "og"
+	RuleTwitter     = "twitter"
+	RuleDescription = "description"
+	RuleH1          = "h1"
+)
+
+// Rules lists every rule, in the order the summary shows them.
+var Rules = []string{RuleStructure, RuleDuplicateID, RuleCanonical, RuleOpenGraph, RuleTwitter, RuleDescription, RuleH1}
+
+// Required meta properties, in the order they're reported.
+var (
+	OpenGraph = []string{"og:title", "og:description", "og:type", "og:url", "og:image"}
+	Twitter   = []string{"twitter:card", "twitter:title", "twitter:description"}
+)
+
+// Problem is an issue at a line of a page.
+type Problem struct {
+	Line int
+	Rule string
+	Msg  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d: %s: %s", p.Line, p.Rule, p.Msg)
+}
+
+// Options bound the description's length, in characters.
+type Options struct {
+	MinDescription, MaxDescription int
+}
+
+// DefaultOptions keep descriptions long enough to say something and short
+// enough that search results don't cut them off.
+var DefaultOptions = Options{MinDescription: 50, MaxDescription: 160}
+
+// void elements have no end tag.
+var void = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// optionalEnd elements may leave out their end tag, as minified pages do;
+// the parser closes them when their parent ends.
+var optionalEnd = map[string]bool{
+	"html": true, "head": true, "body": true, "p": true, "li": true,
+	"dt": true, "dd": true, "option": true, "optgroup": true, "tr": true,
+	"td": true, "th": true, "thead": true, "tbody": true, "tfoot": true,
+	"colgroup": true, "rb": true, "rt": true, "rp": true,
+}
+
+type open struct {
+	tag  string
+	line int
+}
+
+// Redirect reports whether page is one of the stubs Hugo writes for
+// aliases, which only send the browser elsewhere and aren't checked.
+func Redirect(page []byte) bool {
+	return bytes.Contains(page, []byte(`http-equiv="refresh"`)) ||
+		bytes.Contains(page, []byte(`http-equiv=refresh`))
+}
+
+// Check reads the page served at URL path u and returns its problems.
+func Check(r io.Reader, u string, opts Options) ([]Problem, error) {
+	var (
+		problems []Problem
+		stack    []open
+		ids      = map[string]int{}
+		meta     = map[string]string{}
+		h1s      []int
+		doctype  bool
+		// head is the line the page-wide problems are reported at.
+		head = 1
+		// canonical is the href of the canonical link, and canonicalSet
+		// whether there was one.
+		canonical    string
+		canonicalSet bool
+	)
+	add := func(line int, rule, format string, args ...any) {
+		problems = append(problems, Problem{line, rule, fmt.Sprintf(format, args...)})
+	}
+
+	z := html.NewTokenizer(r)
+	line := 1
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return nil, z.Err()
+			}
+			break
+		}
+		start := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+		switch tt {
+		case html.DoctypeToken:
+			doctype = true
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			attrs := map[string]string{}
+			for _, a := range tok.Attr {
+				attrs[a.Key] = a.Val
+			}
+			if id, ok := attrs["id"]; ok {
+				if prev, dup := ids[id]; dup {
+					add(start, RuleDuplicateID, "id %q is already used on line %d", id, prev)
+				} else {
+					ids[id] = start
+				}
+			}
+			switch tok.Data {
+			case "head":
+				head = start
+			case "html":
+				if attrs["lang"] == "" {
+					add(start, RuleStructure, "<html> has no lang")
+				}
+			case "h1":
+				h1s = append(h1s, start)
+			case "link":
+				if slices.Contains(strings.Fields(attrs["rel"]), "canonical") {
+					canonical, canonicalSet = attrs["href"], true
+				}
+			case "meta":
+				key := attrs["property"]
+				if key == "" {
+					key = attrs["name"]
+				}
+				if key != "" {
+					meta[key] = attrs["content"]
+				}
+			}
+			if tt == html.StartTagToken && !void[tok.Data] {
+				stack = append(stack, open{tok.Data, start})
+			}
+		case html.EndTagToken:
+			tok := z.Token()
+			if void[tok.Data] {
+				continue
+			}
+			i := len(stack) - 1
+			for i >= 0 && stack[i].tag != tok.Data {
+				i--
+			}
+			if i < 0 {
+				add(start, RuleStructure, "</%s> closes nothing", tok.Data)
+				continue
+			}
+			for _, o := range stack[i+1:] {
+				if !optionalEnd[o.tag] {
+					add(o.line, RuleStructure, "<%s> isn't closed before </%s> on line %d", o.tag, tok.Data, start)
+				}
+			}
+			stack = stack[:i]
+		}
+	}
+	for _, o := range stack {
+		if !optionalEnd[o.tag] {
+			add(o.line, RuleStructure, "<%s> is never closed", o.tag)
+		}
+	}
+	if !doctype {
+		add(1, RuleStructure, "no <!DOCTYPE html>")
+	}
+
+	switch {
+	case !canonicalSet:
+		add(head, RuleCanonical, "no <link rel=canonical>")
+	default:
+		c, err := url.Parse(canonical)
+		switch {
+		case err != nil || c.Host == "" || (c.Scheme != "https" && c.Scheme != "http"):
+			add(head, RuleCanonical, "%q isn't an absolute URL", canonical)
+		case c.Path != u:
+			add(head, RuleCanonical, "%q isn't this page, %s", canonical, u)
+		}
+	}
+	for _, key := range OpenGraph {
+		if strings.TrimSpace(meta[key]) == "" {
+			add(head, RuleOpenGraph, "no %s", key)
+		}
+	}
+	if og := meta["og:url"]; og != "" && canonicalSet && og != canonical {
+		add(head, RuleOpenGraph, "og:url %q isn't the canonical URL %q", og, canonical)
+	}
+	for _, key := range Twitter {
+		if strings.TrimSpace(meta[key]) == "" {
+			add(head, RuleTwitter, "no %s", key)
+		}
+	}
+	switch d, ok := meta["description"]; {
+	case !ok || strings.TrimSpace(d) == "":
+		add(head, RuleDescription, "no meta description")
+	default:
+		n := utf8.RuneCountInString(strings.TrimSpace(d))
+		if n < opts.MinDescription || n > opts.MaxDescription {
+			add(head, RuleDescription, "description is %d characters, not %d to %d", n, opts.MinDescription, opts.MaxDescription)
+		}
+	}
+	switch len(h1s) {
+	case 1:
+	case 0:
+		add(1, RuleH1, "no <h1>")
+	default:
+		for _, l := range h1s[1:] {
+			add(l, RuleH1, "another <h1>, after the one on line %d", h1s[0])
+		}
+	}
+
+	slices.SortStableFunc(problems, func(a, b Problem) int { return a.Line - b.Line })
+	return problems, nil
+}
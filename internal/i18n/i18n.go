@@ -0,0 +1,144 @@
+// Package i18n ties the posts to their translations. A translation is the
+// post's file with the language before .md, as python/pathlib.bn.md, or
+// any post sharing its translationKey; it's served under /<lang>/ and
+// carries its own feeds and sitemap. Each version links the others with
+// hreflang, and Check reports the translations that have fallen behind
+// the post they translate.
+package i18n
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// XDefault is the hreflang of the version for readers whose language
+// none of the others match: the default language's.
+const XDefault = "x-default"
+
+// Alternate is a version of a page, for a <link rel="alternate"> or a
+// sitemap's <xhtml:link>.
+type Alternate struct {
+	Lang string
+	Href string
+}
+
+// Groups maps each translation key shared by two or more posts to those
+// posts, default language first and then by language.
+func Groups(posts []*content.Post) map[string][]*content.Post {
+	all := map[string][]*content.Post{}
+	for _, p := range posts {
+		all[p.TranslationKey] = append(all[p.TranslationKey], p)
+	}
+	groups := map[string][]*content.Post{}
+	for k, ps := range all {
+		if len(ps) < 2 {
+			continue
+		}
+		slices.SortStableFunc(ps, func(a, b *content.Post) int { return cmp.Compare(a.Lang, b.Lang) })
+		groups[k] = ps
+	}
+	return groups
+}
+
+// Alternates returns the hreflang links of each post with translations
+// among posts, keyed by its RelPermalink: every version, itself included,
+// and XDefault for the default language's.
+func Alternates(cfg *site.Config, posts []*content.Post) map[string][]Alternate {
+	out := map[string][]Alternate{}
+	for _, group := range Groups(posts) {
+		var links []Alternate
+		for _, p := range group {
+			links = append(links, Alternate{Lang: p.LangOrDefault(), Href: cfg.Permalink(p.RelPermalink())})
+			if p.Lang == "" {
+				links = append(links, Alternate{Lang: XDefault, Href: cfg.Permalink(p.RelPermalink())})
+			}
+		}
+		for _, p := range group {
+			out[p.RelPermalink()] = links
+		}
+	}
+	return out
+}
+
+// ByLang splits posts by language, the default language's under "".
+func ByLang(posts []*content.Post) map[string][]*content.Post {
+	out := map[string][]*content.Post{}
+	for _, p := range posts {
+		out[p.Lang] = append(out[p.Lang], p)
+	}
+	return out
+}
+
+// Problem is a translation that's missing its original, in a language the
+// site doesn't have, or behind.
+type Problem struct {
+	Path string
+	Msg  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Msg)
+}
+
+// DefaultMaxLag is how long a translation may go without catching up
+// with its original's changes.
+const DefaultMaxLag = 90 * 24 * time.Hour
+
+// Check reports the translations among posts in a language config.yml
+// doesn't list, with no default-language original, sharing a language
+// with another translation of the same post, or last updated more than
+// maxLag before their original was. It also checks config.yml's default
+// language is content.DefaultLanguage.
+func Check(cfg *site.Config, posts []*content.Post, maxLag time.Duration) []Problem {
+	var problems []Problem
+	if cfg.DefaultContentLanguage != content.DefaultLanguage {
+		problems = append(problems, Problem{
+			Path: site.ConfigPath,
+			Msg:  fmt.Sprintf("defaultContentLanguage is %q but the tooling assumes %q", cfg.DefaultContentLanguage, content.DefaultLanguage),
+		})
+	}
+	byKey := map[string][]*content.Post{}
+	for _, p := range posts {
+		byKey[p.TranslationKey] = append(byKey[p.TranslationKey], p)
+		if p.Lang != "" && !slices.Contains(cfg.Langs(), p.Lang) {
+			problems = append(problems, Problem{p.Path, fmt.Sprintf("language %q isn't in config.yml's languages", p.Lang)})
+		}
+	}
+	for _, group := range byKey {
+		var original *content.Post
+		seen := map[string]string{}
+		for _, p := range group {
+			if prev, ok := seen[p.Lang]; ok {
+				problems = append(problems, Problem{p.Path, fmt.Sprintf("%s is already the %s version of %s", prev, p.LangOrDefault(), p.TranslationKey)})
+				continue
+			}
+			seen[p.Lang] = p.Path
+			if p.Lang == "" {
+				original = p
+			}
+		}
+		for _, p := range group {
+			if p.Lang == "" {
+				continue
+			}
+			if original == nil {
+				problems = append(problems, Problem{p.Path, fmt.Sprintf("translates %s, which has no %s version", p.TranslationKey, content.DefaultLanguage)})
+				continue
+			}
+			if lag := original.Updated().Sub(p.Updated()); lag > maxLag {
+				problems = append(problems, Problem{p.Path, fmt.Sprintf(
+					"%d days behind %s, updated %s and last translated %s",
+					int(lag.Hours()/24), original.Path,
+					original.Updated().Format(time.DateOnly), p.Updated().Format(time.DateOnly),
+				)})
+			}
+		}
+	}
+	slices.SortStableFunc(problems, func(a, b Problem) int { return cmp.Compare(a.Path, b.Path) })
+	return problems
+}
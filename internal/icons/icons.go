@@ -0,0 +1,246 @@
+// Package icons renders the site's icons from one SVG: the favicons, the
+// Apple touch icon, and the Web App Manifest's regular and maskable icons,
+// plus site.webmanifest and the <link> tags the theme doesn't write.
+package icons
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultSource is the SVG the icons are drawn from.
+const DefaultSource = "assets/icon.svg"
+
+// DefaultLinks is where the <link> tags are written for the icons partial.
+const DefaultLinks = "data/icons.json"
+
+// ManifestFile is the Web App Manifest's name.
+const ManifestFile = "site.webmanifest"
+
+// Icon is a PNG rendered from the source.
+type Icon struct {
+	Name string
+	Size int
+	// Scale is the share of the icon the source fills, centered; the rest
+	// is the background. Maskable icons keep their content in the middle
+	// 80%, since launchers crop them to their own shapes.
+	Scale float64
+	// Opaque icons get the background behind the source, for platforms
+	// that would show transparency as black.
+	Opaque bool
+	// Purpose is the icon's purpose in the manifest; empty leaves it out
+	// of the manifest.
+	Purpose string
+}
+
+// Icons are the PNGs rendered. The favicon and touch icon names are the
+// ones browsers and the theme ask for without a <link>.
+var Icons = []Icon{
+	{Name: "favicon-16x16.png", Size: 16, Scale: 1},
+	{Name: "favicon-32x32.png", Size: 32, Scale: 1},
+	{Name: "apple-touch-icon.png", Size: 180, Scale: 1, Opaque: true},
+	{Name: "icon-192.png", Size: 192, Scale: 1, Purpose: "any"},
+	{Name: "icon-512.png", Size: 512, Scale: 1, Purpose: "any"},
+	{Name: "icon-maskable-192.png", Size: 192, Scale: 0.8, Opaque: true, Purpose: "maskable"},
+	{Name: "icon-maskable-512.png", Size: 512, Scale: 0.8, Opaque: true, Purpose: "maskable"},
+}
+
+// icoSizes are the sizes packed into favicon.ico.
+var icoSizes = []int{16, 32, 48}
+
+// Options describe the site in its manifest.
+type Options struct {
+	Name, ShortName, Description string
+	// Background and Theme are hex colors like "#1d1e20": the splash
+	// screen and opaque icons' background, and the browser chrome's.
+	Background, Theme string
+}
+
+// Link is a <link> tag in each page's head.
+type Link struct {
+	Rel   string `json:"rel"`
+	Type  string `json:"type,omitempty"`
+	Sizes string `json:"sizes,omitempty"`
+	Href  string `json:"href"`
+}
+
+// Set is what Generate renders: files by name, and the tags that link them.
+type Set struct {
+	Files map[string][]byte
+	Links []Link
+}
+
+// Generate renders the icons, favicon.ico, and the manifest from src, an
+// SVG, which is also kept as favicon.svg for browsers that take one.
+func Generate(src []byte, opts Options) (*Set, error) {
+	bg, err := parseHex(opts.Background)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseHex(opts.Theme); err != nil {
+		return nil, err
+	}
+	// Parse once up front, for the error.
+	if _, err := oksvg.ReadIconStream(bytes.NewReader(src)); err != nil {
+		return nil, fmt.Errorf("icons: %w", err)
+	}
+	set := &Set{Files: map[string][]byte{"favicon.svg": src}}
+
+	type manifestIcon struct {
+		Src     string `json:"src"`
+		Sizes   string `json:"sizes"`
+		Type    string `json:"type"`
+		Purpose string `json:"purpose"`
+	}
+	var icons []manifestIcon
+	for _, ic := range Icons {
+		b, err := encode(src, ic, bg)
+		if err != nil {
+			return nil, err
+		}
+		set.Files[ic.Name] = b
+		sizes := fmt.Sprintf("%dx%d", ic.Size, ic.Size)
+		if ic.Purpose != "" {
+			icons = append(icons, manifestIcon{Src: "/" + ic.Name, Sizes: sizes, Type: "image/png", Purpose: ic.Purpose})
+		}
+	}
+
+	var pngs [][]byte
+	for _, size := range icoSizes {
+		b, err := encode(src, Icon{Size: size, Scale: 1}, bg)
+		if err != nil {
+			return nil, err
+		}
+		pngs = append(pngs, b)
+	}
+	set.Files["favicon.ico"] = ico(icoSizes, pngs)
+
+	manifest, err := json.MarshalIndent(struct {
+		Name            string         `json:"name"`
+		ShortName       string         `json:"short_name"`
+		Description     string         `json:"description,omitempty"`
+		StartURL        string         `json:"start_url"`
+		Scope           string         `json:"scope"`
+		Display         string         `json:"display"`
+		BackgroundColor string         `json:"background_color"`
+		ThemeColor      string         `json:"theme_color"`
+		Icons           []manifestIcon `json:"icons"`
+	}{
+		Name:            opts.Name,
+		ShortName:       cmp.Or(opts.ShortName, opts.Name),
+		Description:     strings.TrimSpace(opts.Description),
+		StartURL:        "/",
+		Scope:           "/",
+		Display:         "standalone",
+		BackgroundColor: opts.Background,
+		ThemeColor:      opts.Theme,
+		Icons:           icons,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	set.Files[ManifestFile] = append(manifest, '\n')
+
+	// The theme links the favicons and touch icon from params.assets.
+	set.Links = []Link{
+		{Rel: "icon", Type: "image/svg+xml", Href: "/favicon.svg"},
+		{Rel: "manifest", Href: "/" + ManifestFile},
+	}
+	return set, nil
+}
+
+// encode renders src as the PNG ic.
+func encode(src []byte, ic Icon, bg color.Color) ([]byte, error) {
+	svg, err := oksvg.ReadIconStream(bytes.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("icons: %w", err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, ic.Size, ic.Size))
+	if ic.Opaque {
+		draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	}
+	inner := float64(ic.Size) * ic.Scale
+	off := (float64(ic.Size) - inner) / 2
+	svg.SetTarget(off, off, inner, inner)
+	// oksvg doesn't scale strokes along with the viewBox.
+	for i := range svg.SVGPaths {
+		svg.SVGPaths[i].LineWidth *= inner / svg.ViewBox.W
+	}
+	scanner := rasterx.NewScannerGV(ic.Size, ic.Size, img, img.Bounds())
+	svg.Draw(rasterx.NewDasher(ic.Size, ic.Size, scanner), 1)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ico packs PNGs of the given sizes into an ICO file, for the browsers and
+// feed readers that ask for /favicon.ico without reading any <link>.
+func ico(sizes []int, pngs [][]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(pngs))})
+	off := 6 + 16*len(pngs)
+	for i, b := range pngs {
+		dim := uint8(sizes[i] % 256) // 0 means 256
+		buf.Write([]byte{dim, dim, 0, 0})
+		binary.Write(&buf, binary.LittleEndian, [2]uint16{1, 32})
+		binary.Write(&buf, binary.LittleEndian, [2]uint32{uint32(len(b)), uint32(off)})
+		off += len(b)
+	}
+	for _, b := range pngs {
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+func parseHex(s string) (color.RGBA, error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) != 6 {
+		return color.RGBA{}, fmt.Errorf("icons: color %q isn't #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("icons: color %q isn't #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// Write writes the set's files into dir and its links to linksPath, skipping
+// files whose contents are unchanged, and returns the number written.
+func (s *Set) Write(dir, linksPath string) (int, error) {
+	links, err := json.MarshalIndent(s.Links, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	files := map[string][]byte{linksPath: append(links, '\n')}
+	for name, b := range s.Files {
+		files[filepath.Join(dir, name)] = b
+	}
+	n := 0
+	for p, b := range files {
+		wrote, err := fsutil.WriteIfChanged(p, b)
+		if err != nil {
+			return n, err
+		}
+		if wrote {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,405 @@
+// Package imgcheck checks the images the posts show: that each exists,
+// fits the size budget, and has the responsive variants cmd/imgopt makes,
+// and that every image under static/ is still shown somewhere.
+//
+// Images are found as markdown images, img shortcodes, HTML <img> tags,
+// and the cover.image front matter of PaperMod. A root-relative source is
+// a file under static/, and a relative one a file of the post's bundle.
+// Remote images are checked over HTTP, when there's a client to.
+package imgcheck
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	_ "github.com/gen2brain/avif"
+	_ "github.com/gen2brain/webp"
+	_ "golang.org/x/image/bmp"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/imgopt"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Rules, as reported.
+const (
+	RuleMissing  = "missing"
+	RuleBytes    = "bytes"
+	RuleSize     = "dimensions"
+	RuleVariants = "variants"
+	RuleOrphan   = "orphan"
+)
+
+// Ref is an image a post shows.
+type Ref struct {
+	// Path is the post's, relative to the content directory.
+	Path string
+	Line int
+	Src  string
+	// Shortcode is set for the img shortcode, which serves the manifest's
+	// variants; other references serve the file as it is.
+	Shortcode bool
+}
+
+var (
+	htmlImgRe = regexp.MustCompile(`(?i)<img\s[^>]*?\bsrc\s*=\s*["']([^"']+)["']`)
+	// A shortcode's code is {{</* img */>}} while it's quoted in a post,
+	// and shows no image.
+	quotedRe = regexp.MustCompile(`\{\{<\s*/\*.*?\*/\s*>\}\}`)
+)
+
+// Refs returns the images p shows, but not the ones in code blocks or
+// inlined as data: URLs.
+func Refs(p *content.Post) []Ref {
+	var refs []Ref
+	add := func(r Ref) {
+		if !strings.HasPrefix(r.Src, "data:") {
+			refs = append(refs, r)
+		}
+	}
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	for _, l := range doc.Links() {
+		if l.Image {
+			add(Ref{Path: p.Path, Line: l.Line, Src: l.Dest})
+		}
+	}
+	inCode := codeLines(p)
+	for _, r := range imgopt.Refs(p) {
+		if inCode[r.Line-p.BodyLine] {
+			continue
+		}
+		add(Ref{Path: p.Path, Line: r.Line, Src: r.Src, Shortcode: true})
+		if r.Dark != "" {
+			add(Ref{Path: p.Path, Line: r.Line, Src: r.Dark, Shortcode: true})
+		}
+	}
+	for i, line := range strings.Split(p.Body, "\n") {
+		if inCode[i] {
+			continue
+		}
+		for _, m := range htmlImgRe.FindAllStringSubmatch(quotedRe.ReplaceAllString(line, ""), -1) {
+			add(Ref{Path: p.Path, Line: p.BodyLine + i, Src: m[1]})
+		}
+	}
+	if cover, ok := p.Params["cover"].(map[string]any); ok {
+		if src, ok := cover["image"].(string); ok && src != "" {
+			add(Ref{Path: p.Path, Line: 1, Src: src})
+		}
+	}
+	return refs
+}
+
+// codeLines marks the body's lines that are in fenced code.
+func codeLines(p *content.Post) map[int]bool {
+	lines := map[int]bool{}
+	fence := ""
+	for i, line := range strings.Split(p.Body, "\n") {
+		t := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			lines[i] = true
+			if strings.HasPrefix(t, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~"):
+			lines[i], fence = true, t[:3]
+		}
+	}
+	return lines
+}
+
+// Remote reports whether src is an absolute http(s) URL.
+func Remote(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "//")
+}
+
+// Budget caps an image. Zero is no cap.
+type Budget struct {
+	Bytes         int64
+	Width, Height int
+}
+
+// Options say where the images are and what to hold them to.
+type Options struct {
+	// Static is the static directory, and Content the content directory,
+	// where bundles keep their images.
+	Static, Content string
+	Budget          Budget
+	// Manifest is cmd/imgopt's. An img shortcode of an image that isn't
+	// in it, or whose variants are gone, serves the file as it is.
+	Manifest imgopt.Manifest
+	// HTTP checks remote images, or nil to skip them.
+	HTTP *http.Client
+	// Jobs bounds the remote images fetched at once.
+	Jobs int
+}
+
+// Problem is an image that breaks a rule, shown at a line of a post, or
+// an orphaned file under static/, whose Line is 0.
+type Problem struct {
+	Path string
+	Line int
+	Rule string
+	Msg  string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", p.Path, p.Rule, p.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", p.Path, p.Line, p.Rule, p.Msg)
+}
+
+// info is what's known of an image file.
+type info struct {
+	bytes         int64
+	width, height int
+	// err is why the image can't be had, if it can't.
+	err error
+}
+
+// Check checks refs against o, in order. Each image is read once however
+// many posts show it.
+func Check(ctx context.Context, refs []Ref, o Options) []Problem {
+	infos := map[string]*info{}
+	var remote []string
+	for _, r := range refs {
+		key := resolve(r, o)
+		if _, ok := infos[key]; ok || key == "" {
+			continue
+		}
+		if Remote(key) {
+			if o.HTTP == nil {
+				continue
+			}
+			infos[key] = nil
+			remote = append(remote, key)
+			continue
+		}
+		infos[key] = local(key)
+	}
+	fetchAll(ctx, o, remote, infos)
+
+	var problems []Problem
+	for _, r := range refs {
+		add := func(rule, msg string, args ...any) {
+			problems = append(problems, Problem{r.Path, r.Line, rule, r.Src + ": " + fmt.Sprintf(msg, args...)})
+		}
+		key := resolve(r, o)
+		in := infos[key]
+		switch {
+		case key == "":
+			add(RuleMissing, "no image to show")
+			continue
+		case in == nil:
+			continue
+		case in.err != nil:
+			add(RuleMissing, "%v", in.err)
+			continue
+		}
+		if b := o.Budget.Bytes; b > 0 && in.bytes > b {
+			add(RuleBytes, "%d bytes, over the %d-byte budget", in.bytes, b)
+		}
+		if (o.Budget.Width > 0 && in.width > o.Budget.Width) || (o.Budget.Height > 0 && in.height > o.Budget.Height) {
+			add(RuleSize, "%dx%d, over the %dx%d budget", in.width, in.height, o.Budget.Width, o.Budget.Height)
+		}
+		// cmd/imgopt makes variants of what's under static/ only.
+		rel, err := filepath.Rel(o.Static, key)
+		if Remote(key) || !imgopt.Supported(key) || o.Manifest == nil || err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		m, ok := o.Manifest["/"+filepath.ToSlash(rel)]
+		switch {
+		case !r.Shortcode:
+			add(RuleVariants, "served as is; use {{< img >}} for responsive variants")
+		case !ok:
+			add(RuleVariants, "not in %s; run cmd/imgopt", imgopt.DefaultManifest)
+		default:
+			for _, f := range m.Files() {
+				if _, err := os.Stat(filepath.Join(o.Static, filepath.FromSlash(f))); err != nil {
+					add(RuleVariants, "variant %s is gone; run cmd/imgopt", f)
+					break
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// resolve returns where r's image is: a URL, or a file path. It's "" for
+// an empty source.
+func resolve(r Ref, o Options) string {
+	src := r.Src
+	if Remote(src) {
+		if strings.HasPrefix(src, "//") {
+			return "https:" + src
+		}
+		return src
+	}
+	if i := strings.IndexAny(src, "?#"); i >= 0 {
+		src = src[:i]
+	}
+	switch {
+	case src == "":
+		return ""
+	case strings.HasPrefix(src, "/"):
+		return filepath.Join(o.Static, filepath.FromSlash(path.Clean(src)))
+	default:
+		return filepath.Join(o.Content, filepath.FromSlash(path.Dir(r.Path)), filepath.FromSlash(path.Clean(src)))
+	}
+}
+
+// local reads a file's size and dimensions.
+func local(name string) *info {
+	f, err := os.Open(name)
+	if err != nil {
+		return &info{err: fmt.Errorf("no file %s", name)}
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return &info{err: err}
+	}
+	in := &info{bytes: st.Size()}
+	in.width, in.height = dimensions(f, name)
+	return in
+}
+
+// dimensions decodes the size of the image in r, or 0, 0 for a format
+// that has none, like SVG, or that doesn't decode.
+func dimensions(r io.Reader, name string) (int, int) {
+	if strings.EqualFold(path.Ext(name), ".svg") {
+		return 0, 0
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
+
+// fetchAll fetches the remote images, o.Jobs at a time, reading only as
+// much of each as its dimensions need.
+func fetchAll(ctx context.Context, o Options, urls []string, infos map[string]*info) {
+	var mu sync.Mutex
+	sem := make(chan struct{}, max(o.Jobs, 1))
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			in := fetch(ctx, o.HTTP, u)
+			mu.Lock()
+			infos[u] = in
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+func fetch(ctx context.Context, client *http.Client, u string) *info {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return &info{err: err}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &info{err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &info{err: fmt.Errorf("GET: %s", resp.Status)}
+	}
+	// An unknown length, -1, is within any budget.
+	in := &info{bytes: resp.ContentLength}
+	in.width, in.height = dimensions(resp.Body, req.URL.Path)
+	return in
+}
+
+// Orphans returns the images under dir, a directory of o.Static, that
+// none of refs shows and no file under elsewhere mentions, as templates
+// and the config do. skip lists the directories under dir that are
+// generated, like cmd/imgopt's variants. A dark variant counts as shown
+// with its light image.
+func Orphans(dir string, skip []string, refs []Ref, o Options, elsewhere []string) ([]Problem, error) {
+	static := o.Static
+	shown := map[string]bool{}
+	for _, r := range refs {
+		shown[filepath.Clean(resolve(r, o))] = true
+	}
+	var mentions strings.Builder
+	for _, root := range elsewhere {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) {
+				return fs.SkipDir
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			mentions.Write(b)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	all := mentions.String()
+
+	var problems []Problem
+	root := filepath.Join(static, dir)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && p == root {
+			return fs.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		if d.IsDir() {
+			if slices.Contains(skip, filepath.ToSlash(rel)) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !isImage(p) || shown[p] {
+			return nil
+		}
+		if light, ok := imgopt.IsDark(p); ok && shown[light] {
+			return nil
+		}
+		url := "/" + filepath.ToSlash(strings.TrimPrefix(p, filepath.Clean(static)+string(filepath.Separator)))
+		if strings.Contains(all, url) {
+			return nil
+		}
+		problems = append(problems, Problem{Path: p, Rule: RuleOrphan, Msg: "no post shows it"})
+		return nil
+	})
+	return problems, err
+}
+
+func isImage(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg", ".bmp":
+		return true
+	}
+	return false
+}
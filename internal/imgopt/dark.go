@@ -0,0 +1,91 @@
+package imgopt
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// DarkSuffix marks an image as the dark variant of the one without it:
+// cover.dark.png pairs with cover.png.
+const DarkSuffix = ".dark"
+
+// DarkSrc returns the URL path of the dark variant of src.
+func DarkSrc(src string) string {
+	ext := path.Ext(src)
+	return strings.TrimSuffix(src, ext) + DarkSuffix + ext
+}
+
+// IsDark reports whether src names a dark variant, and of which image.
+func IsDark(src string) (light string, ok bool) {
+	ext := path.Ext(src)
+	base, ok := strings.CutSuffix(strings.TrimSuffix(src, ext), DarkSuffix)
+	return base + ext, ok
+}
+
+// Ref is an img shortcode in a post.
+type Ref struct {
+	Path string
+	Line int
+	Src  string
+	// Dark is the URL path of the dark variant the shortcode declares,
+	// or "". dark=true declares the one DarkSrc names.
+	Dark string
+}
+
+var (
+	imgShortcodeRe = regexp.MustCompile(`\{\{<\s*img\s+(.*?)\s*/?>\}\}`)
+	paramRe        = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|(\S+))`)
+)
+
+// Refs returns the img shortcodes in p.
+func Refs(p *content.Post) []Ref {
+	var refs []Ref
+	for i, line := range strings.Split(p.Body, "\n") {
+		for _, m := range imgShortcodeRe.FindAllStringSubmatch(line, -1) {
+			r := Ref{Path: p.Path, Line: p.BodyLine + i}
+			for _, pm := range paramRe.FindAllStringSubmatch(m[1], -1) {
+				v := pm[2] + pm[3]
+				switch pm[1] {
+				case "src":
+					r.Src = v
+				case "dark":
+					r.Dark = v
+				}
+			}
+			switch r.Dark {
+			case "true":
+				r.Dark = DarkSrc(r.Src)
+			case "false":
+				r.Dark = ""
+			}
+			refs = append(refs, r)
+		}
+	}
+	return refs
+}
+
+// CheckPairs returns a problem for each img shortcode that declares a
+// dark variant that isn't among srcs, the URL paths of the site's images,
+// and for each dark variant in srcs without its light image.
+func CheckPairs(refs []Ref, srcs []string) []string {
+	have := map[string]bool{}
+	for _, s := range srcs {
+		have[s] = true
+	}
+	var problems []string
+	for _, s := range srcs {
+		if light, ok := IsDark(s); ok && !have[light] {
+			problems = append(problems, fmt.Sprintf("%s: no light image %s to pair with", s, light))
+		}
+	}
+	for _, r := range refs {
+		if r.Dark != "" && !have[r.Dark] {
+			problems = append(problems, fmt.Sprintf("%s:%d: img %s: dark variant %s doesn't exist", r.Path, r.Line, r.Src, r.Dark))
+		}
+	}
+	return problems
+}
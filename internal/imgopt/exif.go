@@ -0,0 +1,105 @@
+package imgopt
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// orientation returns the EXIF Orientation of a JPEG (1 through 8), or 1 if
+// it has none. Re-encoding drops EXIF, so the rotation it describes has to
+// be applied to the pixels first.
+func orientation(b []byte) int {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return 1
+		}
+		marker := b[i+1]
+		size := int(binary.BigEndian.Uint16(b[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(b) {
+			// Start of scan: the metadata segments are behind us.
+			return 1
+		}
+		seg := b[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(t[4:]))
+	if ifd+2 > len(t) {
+		return 1
+	}
+	n := int(order.Uint16(t[ifd:]))
+	for e := 0; e < n; e++ {
+		off := ifd + 2 + 12*e
+		if off+12 > len(t) {
+			return 1
+		}
+		if order.Uint16(t[off:]) == 0x0112 {
+			if v := int(order.Uint16(t[off+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient applies an EXIF orientation to m.
+func orient(m image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return m
+	}
+	src := image.NewRGBA(image.Rect(0, 0, m.Bounds().Dx(), m.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), m, m.Bounds().Min, draw.Src)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	// Orientations 5 through 8 swap width and height.
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,236 @@
+// Package imgopt turns the site's source images into responsive variants:
+// AVIF and WebP at several widths plus a fallback in the original format,
+// all without EXIF, and a manifest with each image's dimensions and a tiny
+// blurred placeholder for the img shortcode.
+package imgopt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gen2brain/avif"
+	"github.com/gen2brain/webp"
+	"golang.org/x/image/draw"
+)
+
+// DefaultManifest is where the img shortcode reads images from, as
+// site.Data.images.
+const DefaultManifest = "data/images.json"
+
+// DefaultWidths are the variant widths, in pixels. Images are never
+// upscaled; one narrower than the widest variant also gets a variant at its
+// own width.
+var DefaultWidths = []int{480, 960, 1600}
+
+// fallbackQuality is the JPEG quality of the fallback variants, which only
+// browsers without AVIF or WebP get.
+const fallbackQuality = 85
+
+// lqipWidth is the width of the placeholder, which the browser scales up
+// and blurs.
+const lqipWidth = 16
+
+// Variant is one encoded size of an image.
+type Variant struct {
+	Width int    `json:"w"`
+	Src   string `json:"src"`
+}
+
+// Image is an entry of the manifest.
+type Image struct {
+	// Hash is the SHA-256 of the source file and the options it was
+	// processed with, so unchanged images aren't encoded again.
+	Hash   string `json:"hash"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// LQIP is a data: URL of a tiny JPEG to show while the image loads.
+	LQIP string `json:"lqip"`
+	// Type is the MIME type of the Fallback variants.
+	Type     string    `json:"type"`
+	AVIF     []Variant `json:"avif"`
+	WebP     []Variant `json:"webp"`
+	Fallback []Variant `json:"fallback"`
+	// Dark is the manifest key of the image's dark variant, if it has
+	// one; see DarkSrc.
+	Dark string `json:"dark,omitempty"`
+}
+
+// Files returns the URL paths of every variant of the image.
+func (m Image) Files() []string {
+	var out []string
+	for _, vs := range [][]Variant{m.AVIF, m.WebP, m.Fallback} {
+		for _, v := range vs {
+			out = append(out, v.Src)
+		}
+	}
+	return out
+}
+
+// Manifest maps the URL path of each source image, such as
+// "/images/go/chan.png", to its variants.
+type Manifest map[string]Image
+
+// Load reads the manifest at path. A missing file yields an empty manifest.
+func Load(path string) (Manifest, error) {
+	m := Manifest{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("imgopt: parse %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Save writes the manifest to path.
+func (m Manifest) Save(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Options control the encoding.
+type Options struct {
+	Widths []int
+	// Quality is passed to the AVIF and WebP encoders, 0 to 100.
+	Quality int
+}
+
+// Supported reports whether name is a format Process takes. GIFs are left
+// alone since they're usually animated, and SVGs don't need variants.
+func Supported(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// Hash identifies a source file processed with o.
+func Hash(src []byte, o Options) string {
+	h := sha256.New()
+	h.Write(src)
+	fmt.Fprintf(h, "\x00%v\x00%d", o.Widths, o.Quality)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Process encodes the variants of the image src into the directory
+// root/dir, where root is the static directory and dir the variants'
+// location under it. name is the source's path relative to the images
+// directory, e.g. "go/chan.png", and the variants keep it, as in
+// dir/go/chan-960w.avif. The caller decides whether the source changed
+// by comparing Hash.
+func Process(src []byte, name, root, dir string, o Options) (Image, error) {
+	m, format, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return Image{}, fmt.Errorf("imgopt: %s: %w", name, err)
+	}
+	if format == "jpeg" {
+		m = orient(m, orientation(src))
+	}
+	b := m.Bounds()
+	img := Image{Hash: Hash(src, o), Width: b.Dx(), Height: b.Dy(), Type: "image/" + format}
+
+	lqip, err := placeholder(m)
+	if err != nil {
+		return Image{}, fmt.Errorf("imgopt: %s: %w", name, err)
+	}
+	img.LQIP = lqip
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for _, w := range widths(o.Widths, img.Width) {
+		scaled := resize(m, w)
+		for _, enc := range []struct {
+			ext  string
+			list *[]Variant
+			fn   func(*bytes.Buffer, image.Image) error
+		}{
+			{".avif", &img.AVIF, func(buf *bytes.Buffer, m image.Image) error {
+				return avif.Encode(buf, m, avif.Options{Quality: o.Quality, Speed: 6})
+			}},
+			{".webp", &img.WebP, func(buf *bytes.Buffer, m image.Image) error {
+				return webp.Encode(buf, m, webp.Options{Quality: o.Quality, Method: 4})
+			}},
+			{ext, &img.Fallback, func(buf *bytes.Buffer, m image.Image) error {
+				if format == "png" {
+					return (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(buf, m)
+				}
+				return jpeg.Encode(buf, m, &jpeg.Options{Quality: fallbackQuality})
+			}},
+		} {
+			var buf bytes.Buffer
+			if err := enc.fn(&buf, scaled); err != nil {
+				return Image{}, fmt.Errorf("imgopt: %s at %dw: %w", name, w, err)
+			}
+			rel := path.Join(dir, fmt.Sprintf("%s-%dw%s", base, w, enc.ext))
+			out := filepath.Join(root, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+				return Image{}, err
+			}
+			if err := os.WriteFile(out, buf.Bytes(), 0o644); err != nil {
+				return Image{}, err
+			}
+			*enc.list = append(*enc.list, Variant{Width: w, Src: "/" + rel})
+		}
+	}
+	return img, nil
+}
+
+// widths returns the variant widths for an image w pixels wide.
+func widths(want []int, w int) []int {
+	var out []int
+	for _, x := range want {
+		if x < w {
+			out = append(out, x)
+		}
+	}
+	if len(out) < len(want) {
+		out = append(out, w)
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func resize(m image.Image, w int) image.Image {
+	b := m.Bounds()
+	if w == b.Dx() {
+		return m
+	}
+	h := max(b.Dy()*w/b.Dx(), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), m, b, draw.Src, nil)
+	return dst
+}
+
+func placeholder(m image.Image) (string, error) {
+	small := resize(m, min(lqipWidth, m.Bounds().Dx()))
+	// JPEG has no alpha, so flatten transparent PNGs onto white.
+	flat := image.NewRGBA(small.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), small, small.Bounds().Min, draw.Over)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: 40}); err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
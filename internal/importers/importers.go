@@ -0,0 +1,111 @@
+// Package importers holds what the importers of drafts written elsewhere
+// share: rendering a draft the way `blogctl new` does, spelling imported
+// tags the site's way, and naming the attachments copied into static/.
+// The importers themselves live in the packages below it.
+package importers
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+// Draft is an imported post, ready to render.
+type Draft struct {
+	newpost.Post
+	// Description and Summary are set in the front matter when they
+	// aren't empty.
+	Description, Summary string
+	Body                 []byte
+}
+
+// Render renders the draft's front matter from the template at tmpl, as
+// newpost.Render does, followed by its body, and checks that the result
+// parses.
+func (d Draft) Render(tmpl string) ([]byte, error) {
+	fm, err := newpost.Render(tmpl, d.Post)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range [][2]string{{"description", d.Description}, {"summary", d.Summary}} {
+		if kv[1] == "" {
+			continue
+		}
+		if fm, err = content.SetString(fm, kv[0], kv[1]); err != nil {
+			return nil, err
+		}
+	}
+	out := append(bytes.TrimRight(fm, "\n"), "\n\n"...)
+	out = append(out, bytes.TrimLeft(d.Body, "\n")...)
+	if _, err := content.Parse(d.Path(), out); err != nil {
+		return nil, fmt.Errorf("importers: %s: %w", d.Path(), err)
+	}
+	return out, nil
+}
+
+// Tags spells imported tags the site's way: nested tags like lang/go by
+// their last part, hyphens and underscores as spaces, then the canonical
+// spelling from aliases, the spelling posts already use, or title case.
+func Tags(ts []string, aliases tags.Aliases, posts []*content.Post) []string {
+	used := map[string]string{}
+	for _, p := range posts {
+		for _, t := range p.Tags {
+			used[strings.ToLower(t)] = t
+		}
+	}
+	out := make([]string, 0, len(ts))
+	for _, t := range ts {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "#")
+		t = t[strings.LastIndexByte(t, '/')+1:]
+		t = strings.Join(strings.FieldsFunc(t, func(r rune) bool { return r == '-' || r == '_' || unicode.IsSpace(r) }), " ")
+		if t == "" {
+			continue
+		}
+		if n := aliases.Normalize([]string{t}); len(n) == 1 && n[0] != t {
+			t = n[0]
+		} else if u, ok := used[strings.ToLower(t)]; ok {
+			t = u
+		} else {
+			t = titleCase(t)
+		}
+		out = append(out, t)
+	}
+	return aliases.Normalize(out)
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
+
+// IsImage reports whether a file name is an image's.
+func IsImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg":
+		return true
+	}
+	return false
+}
+
+// FileName is the name an attachment is copied under: slugified, since
+// exported names like "Pasted image 20240101.png" have spaces, with its
+// extension lowercased.
+func FileName(name string) string {
+	ext := path.Ext(name)
+	base := newpost.Slugify(strings.TrimSuffix(path.Base(name), ext))
+	if base == "" {
+		base = "file"
+	}
+	return base + strings.ToLower(ext)
+}
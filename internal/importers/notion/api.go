@@ -0,0 +1,447 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Client reads pages through Notion's API with an integration's token.
+// The pages have to be shared with the integration.
+type Client struct {
+	HTTP  *http.Client
+	Token string
+	// BaseURL is the API root; it's only changed for testing.
+	BaseURL string
+}
+
+// Version is the API version the client speaks.
+const Version = "2022-06-28"
+
+// ClientFromEnv returns a client with the token in NOTION_TOKEN.
+func ClientFromEnv() (*Client, error) {
+	t := os.Getenv("NOTION_TOKEN")
+	if t == "" {
+		return nil, fmt.Errorf("notion: NOTION_TOKEN isn't set")
+	}
+	return &Client{HTTP: &http.Client{Timeout: time.Minute}, Token: t, BaseURL: "https://api.notion.com/v1"}, nil
+}
+
+func (c *Client) get(ctx context.Context, p string, q url.Values, v any) error {
+	u := strings.TrimSuffix(c.BaseURL, "/") + p
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Notion-Version", Version)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("notion: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notion: GET %s: %s: %s", p, resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("notion: GET %s: %w", p, err)
+	}
+	return nil
+}
+
+// richText is a run of text with its formatting.
+type richText struct {
+	Type      string `json:"type"`
+	PlainText string `json:"plain_text"`
+	Href      string `json:"href"`
+	Mention   struct {
+		Type string `json:"type"`
+		Page struct {
+			ID string `json:"id"`
+		} `json:"page"`
+	} `json:"mention"`
+	Equation struct {
+		Expression string `json:"expression"`
+	} `json:"equation"`
+	Annotations struct {
+		Bold          bool `json:"bold"`
+		Italic        bool `json:"italic"`
+		Strikethrough bool `json:"strikethrough"`
+		Code          bool `json:"code"`
+	} `json:"annotations"`
+}
+
+type file struct {
+	Type     string `json:"type"`
+	External struct {
+		URL string `json:"url"`
+	} `json:"external"`
+	File struct {
+		URL string `json:"url"`
+	} `json:"file"`
+	Caption []richText `json:"caption"`
+}
+
+func (f file) url() string {
+	if f.Type == "external" {
+		return f.External.URL
+	}
+	return f.File.URL
+}
+
+// block is the part of a block the converter reads. Each type keeps its
+// fields under a key named after it, which body unpacks.
+type block struct {
+	ID          string                     `json:"id"`
+	Type        string                     `json:"type"`
+	HasChildren bool                       `json:"has_children"`
+	Raw         map[string]json.RawMessage `json:"-"`
+	children    []*block
+}
+
+func (b *block) UnmarshalJSON(data []byte) error {
+	type plain block
+	if err := json.Unmarshal(data, (*plain)(b)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &b.Raw)
+}
+
+// body decodes the block's type-specific object into v.
+func (b *block) body(v any) {
+	_ = json.Unmarshal(b.Raw[b.Type], v)
+}
+
+// Page reads the page with the given ID, or its URL, and converts its
+// blocks.
+func (c *Client) Page(ctx context.Context, id string) (*Page, error) {
+	id = pageID(id)
+	var meta struct {
+		ID          string    `json:"id"`
+		CreatedTime time.Time `json:"created_time"`
+		Properties  map[string]struct {
+			Type        string     `json:"type"`
+			Title       []richText `json:"title"`
+			RichText    []richText `json:"rich_text"`
+			MultiSelect []struct {
+				Name string `json:"name"`
+			} `json:"multi_select"`
+			Date struct {
+				Start string `json:"start"`
+			} `json:"date"`
+		} `json:"properties"`
+	}
+	if err := c.get(ctx, "/pages/"+id, nil, &meta); err != nil {
+		return nil, err
+	}
+	p := &Page{ID: strings.ReplaceAll(meta.ID, "-", ""), Created: meta.CreatedTime, Links: map[string]string{}}
+	for name, prop := range meta.Properties {
+		switch n := strings.ToLower(name); {
+		case prop.Type == "title":
+			p.Title = plain(prop.Title)
+		case prop.Type == "multi_select" && (n == "tags" || n == "tag"):
+			for _, s := range prop.MultiSelect {
+				p.Tags = append(p.Tags, s.Name)
+			}
+		case prop.Type == "date" && (n == "date" || n == "published"):
+			for _, layout := range []string{time.RFC3339, time.DateOnly} {
+				if t, err := time.Parse(layout, prop.Date.Start); err == nil {
+					p.Created = t
+					break
+				}
+			}
+		case prop.Type == "rich_text" && (n == "description" || n == "summary"):
+			p.Description = plain(prop.RichText)
+		}
+	}
+	if p.Title == "" {
+		return nil, fmt.Errorf("notion: page %s has no title", id)
+	}
+	blocks, err := c.children(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var r renderer
+	r.page = p
+	r.blocks(blocks, "")
+	p.Markdown = strings.TrimSpace(r.b.String()) + "\n"
+	return p, nil
+}
+
+// children reads a block's children and theirs, a page of 100 at a time.
+func (c *Client) children(ctx context.Context, id string) ([]*block, error) {
+	var out []*block
+	q := url.Values{"page_size": {"100"}}
+	for {
+		var resp struct {
+			Results    []*block `json:"results"`
+			HasMore    bool     `json:"has_more"`
+			NextCursor string   `json:"next_cursor"`
+		}
+		if err := c.get(ctx, "/blocks/"+id+"/children", q, &resp); err != nil {
+			return nil, err
+		}
+		for _, b := range resp.Results {
+			// Child pages are pages of their own; import them by ID.
+			if b.HasChildren && b.Type != "child_page" && b.Type != "child_database" {
+				kids, err := c.children(ctx, b.ID)
+				if err != nil {
+					return nil, err
+				}
+				b.children = kids
+			}
+		}
+		out = append(out, resp.Results...)
+		if !resp.HasMore {
+			return out, nil
+		}
+		q.Set("start_cursor", resp.NextCursor)
+	}
+}
+
+// pageID returns the ID in a page's URL, or s itself, without dashes.
+func pageID(s string) string {
+	s = strings.TrimSpace(s)
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		s = path.Base(u.Path)
+	}
+	s = strings.ReplaceAll(s, "-", "")
+	if len(s) > 32 {
+		s = s[len(s)-32:]
+	}
+	return s
+}
+
+// renderer writes blocks as markdown.
+type renderer struct {
+	page *Page
+	b    strings.Builder
+}
+
+// blocks writes a list of sibling blocks, each at indent, with a blank
+// line between them except inside a list. Empty paragraphs, which Notion
+// spaces pages out with, are skipped.
+func (r *renderer) blocks(bs []*block, indent string) {
+	wrote := false
+	for i, b := range bs {
+		if b.Type == "paragraph" && len(b.children) == 0 && strings.TrimSpace(plain(richTexts(b))) == "" {
+			continue
+		}
+		if wrote && !(isListItem(b.Type) && b.Type == bs[i-1].Type) {
+			r.b.WriteString(strings.TrimRight(indent, " ") + "\n")
+		}
+		r.block(b, indent, numbered(bs, i))
+		wrote = true
+	}
+}
+
+func richTexts(b *block) []richText {
+	var t struct {
+		RichText []richText `json:"rich_text"`
+	}
+	b.body(&t)
+	return t.RichText
+}
+
+func isListItem(t string) bool {
+	return t == "bulleted_list_item" || t == "numbered_list_item" || t == "to_do"
+}
+
+// numbered returns the number of the ith block in its numbered list.
+func numbered(bs []*block, i int) int {
+	n := 1
+	for j := i - 1; j >= 0 && bs[j].Type == "numbered_list_item"; j-- {
+		n++
+	}
+	return n
+}
+
+func (r *renderer) line(indent, s string) {
+	for _, l := range strings.Split(s, "\n") {
+		r.b.WriteString(strings.TrimRight(indent+l, " ") + "\n")
+	}
+}
+
+func (r *renderer) block(b *block, indent string, n int) {
+	var t struct {
+		RichText   []richText `json:"rich_text"`
+		Language   string     `json:"language"`
+		Checked    bool       `json:"checked"`
+		Expression string     `json:"expression"`
+		URL        string     `json:"url"`
+		Title      string     `json:"title"`
+		Icon       struct {
+			Emoji string `json:"emoji"`
+		} `json:"icon"`
+	}
+	b.body(&t)
+	text := r.rich(t.RichText)
+	kids := indent + "    "
+	switch b.Type {
+	case "paragraph":
+		r.line(indent, text)
+		kids = indent
+	case "heading_1", "heading_2", "heading_3":
+		// The title is the post's only H1, so headings go down a level.
+		level := int(b.Type[len(b.Type)-1]-'0') + 1
+		r.line(indent, strings.Repeat("#", level)+" "+text)
+	case "bulleted_list_item":
+		r.line(indent, "- "+text)
+	case "numbered_list_item":
+		r.line(indent, fmt.Sprintf("%d. %s", n, text))
+	case "to_do":
+		box := "[ ]"
+		if t.Checked {
+			box = "[x]"
+		}
+		r.line(indent, "- "+box+" "+text)
+	case "toggle":
+		r.line(indent, text)
+		kids = indent
+	case "quote":
+		r.line(indent, "> "+strings.ReplaceAll(text, "\n", "\n> "))
+		kids = indent + "> "
+	case "callout":
+		if t.Icon.Emoji != "" {
+			text = t.Icon.Emoji + " " + text
+		}
+		r.line(indent, "> "+strings.ReplaceAll(text, "\n", "\n> "))
+		kids = indent + "> "
+	case "code":
+		r.line(indent, "```"+Lang(t.Language))
+		r.line(indent, plain(t.RichText))
+		r.line(indent, "```")
+	case "equation":
+		r.line(indent, "$$\n"+t.Expression+"\n$$")
+	case "divider":
+		r.line(indent, "---")
+	case "image":
+		var f file
+		b.body(&f)
+		alt := plain(f.Caption)
+		name := path.Base(strings.SplitN(f.url(), "?", 2)[0])
+		if f.Type == "external" && !strings.Contains(f.url(), "amazonaws.com") {
+			r.line(indent, "!["+alt+"]("+f.url()+")")
+			break
+		}
+		ref := fmt.Sprintf("notion-image:%d", len(r.page.Images))
+		r.page.Images = append(r.page.Images, Image{Ref: ref, Name: name, URL: f.url()})
+		if alt == "" {
+			alt = strings.TrimSuffix(name, path.Ext(name))
+		}
+		r.line(indent, "!["+alt+"]("+ref+")")
+	case "bookmark", "embed", "link_preview", "video", "pdf", "file":
+		u := t.URL
+		if u == "" {
+			var f file
+			b.body(&f)
+			u = f.url()
+		}
+		r.line(indent, "<"+u+">")
+	case "table":
+		r.table(b, indent)
+		return
+	case "child_page":
+		r.page.Problems = append(r.page.Problems, fmt.Sprintf("child page %q isn't imported; import it by its ID", t.Title))
+		r.line(indent, t.Title)
+	case "column_list", "column", "synced_block", "template":
+		r.blocks(b.children, indent)
+		return
+	default:
+		r.page.Problems = append(r.page.Problems, fmt.Sprintf("%s block %s isn't supported", b.Type, b.ID))
+		return
+	}
+	if len(b.children) > 0 {
+		if !isListItem(b.Type) {
+			r.b.WriteString(strings.TrimRight(kids, " ") + "\n")
+		}
+		r.blocks(b.children, kids)
+	}
+}
+
+func (r *renderer) table(b *block, indent string) {
+	for i, row := range b.children {
+		var t struct {
+			Cells [][]richText `json:"cells"`
+		}
+		row.body(&t)
+		cells := make([]string, len(t.Cells))
+		for j, c := range t.Cells {
+			cells[j] = strings.ReplaceAll(r.rich(c), "|", `\|`)
+		}
+		r.line(indent, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			r.line(indent, strings.TrimSuffix(strings.Repeat("| --- ", len(cells)), " ")+" |")
+		}
+	}
+}
+
+// rich writes rich text as markdown. Links to other pages get a Ref for
+// Import to point at their posts.
+func (r *renderer) rich(rt []richText) string {
+	var b strings.Builder
+	for _, t := range rt {
+		s := t.PlainText
+		switch {
+		case t.Type == "equation":
+			b.WriteString("$" + t.Equation.Expression + "$")
+			continue
+		case t.Annotations.Code:
+			s = "`" + s + "`"
+		default:
+			// Markdown marks go inside the spaces at the ends of the run.
+			lead := s[:len(s)-len(strings.TrimLeft(s, " "))]
+			trail := s[len(strings.TrimRight(s, " ")):]
+			core := strings.TrimSpace(s)
+			if core == "" {
+				break
+			}
+			if t.Annotations.Strikethrough {
+				core = "~~" + core + "~~"
+			}
+			if t.Annotations.Italic {
+				core = "_" + core + "_"
+			}
+			if t.Annotations.Bold {
+				core = "**" + core + "**"
+			}
+			s = lead + core + trail
+		}
+		href := t.Href
+		if t.Type == "mention" && t.Mention.Type == "page" {
+			id := strings.ReplaceAll(t.Mention.Page.ID, "-", "")
+			href = "notion-page:" + id
+			r.page.Links[href] = id
+		} else if href != "" && strings.HasPrefix(href, "/") {
+			// Links to other pages in the workspace are relative.
+			id := pageID(href)
+			href = "notion-page:" + id
+			r.page.Links[href] = id
+		}
+		if href != "" {
+			s = "[" + s + "](" + href + ")"
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+func plain(rt []richText) string {
+	var b strings.Builder
+	for _, t := range rt {
+		b.WriteString(t.PlainText)
+	}
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package notion
+
+import "strings"
+
+// langs maps the code block languages Notion offers, lowercased as they
+// appear in exports and the API, to the names Chroma highlights them by.
+// Languages Chroma knows by Notion's name, like Go or Python, aren't
+// listed.
+var langs = map[string]string{
+	"plain text":       "text",
+	"ascii art":        "text",
+	"c++":              "cpp",
+	"c#":               "csharp",
+	"f#":               "fsharp",
+	"java/c/c++/c#":    "java",
+	"objective-c":      "objectivec",
+	"visual basic":     "vbnet",
+	"vb.net":           "vbnet",
+	"docker":           "dockerfile",
+	"markup":           "html",
+	"flow":             "javascript",
+	"webassembly":      "wasm",
+	"lisp":             "common-lisp",
+	"assembly":         "nasm",
+	"reason":           "reasonml",
+	"bnf":              "ebnf",
+	"protocol buffers": "protobuf",
+}
+
+// Lang returns the fence language for a Notion code block's, or "text"
+// for none.
+func Lang(notion string) string {
+	l := strings.ToLower(strings.TrimSpace(notion))
+	if l == "" {
+		return "text"
+	}
+	if c, ok := langs[l]; ok {
+		return c
+	}
+	return strings.ReplaceAll(l, " ", "-")
+}
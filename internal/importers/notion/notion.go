@@ -0,0 +1,216 @@
+// Package notion turns Notion pages into draft posts, from a workspace's
+// "Markdown & CSV" export zip or from the API with an integration token
+// and page IDs. Code blocks keep their language, spelled the way Chroma
+// knows it, images are copied or downloaded into static/, and the page's
+// properties fill in a front matter stub to review.
+package notion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/importers"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+// Page is a Notion page converted to markdown.
+type Page struct {
+	// ID is the page's, without dashes.
+	ID      string
+	Title   string
+	Created time.Time
+	Tags    []string
+	// Description is the page's Description or Summary property.
+	Description string
+	// Markdown is the page's body. The images in it are referenced by
+	// Image.Ref until Import places them.
+	Markdown string
+	Images   []Image
+	// Links are the other pages the body links to, by the Ref it uses.
+	Links map[string]string
+	// Problems are the blocks that didn't convert.
+	Problems []string
+}
+
+// Image is an image a page shows: its bytes, from an export, or a URL to
+// download them from, from the API.
+type Image struct {
+	// Ref stands for the image in Page.Markdown.
+	Ref  string
+	Name string
+	Data []byte
+	URL  string
+}
+
+// Options says how pages become posts.
+type Options struct {
+	// Section is where the drafts go, and Template renders their front
+	// matter; see newpost.Render.
+	Section  string
+	Template string
+	// Date is used for pages without a created time.
+	Date    time.Time
+	Aliases tags.Aliases
+	// Posts are the site's, for spelling tags the way they already are
+	// and keeping slugs unique.
+	Posts []*content.Post
+	// Images is where images go, relative to static/, under a folder per
+	// post.
+	Images string
+	// HTTP downloads the images the API links to.
+	HTTP *http.Client
+}
+
+// Post is a converted page.
+type Post struct {
+	Page *Page
+	// Path is the post's in the content directory.
+	Path string
+	Body []byte
+}
+
+// Attachment is an image to write, at Dest relative to static/.
+type Attachment struct {
+	Dest string
+	Data []byte
+}
+
+// Result is what an Import converted.
+type Result struct {
+	Posts       []Post
+	Attachments []Attachment
+}
+
+// maxImage bounds a downloaded image.
+const maxImage = 32 << 20
+
+// Import renders pages as drafts, placing their images under
+// Images/<slug>/ and turning links between them into refs. Links to pages
+// that aren't among them are left as their text, and reported with the
+// page's other problems.
+func Import(ctx context.Context, pages []*Page, o Options) (*Result, error) {
+	type draft struct {
+		page  *Page
+		draft importers.Draft
+	}
+	var drafts []draft
+	paths := map[string]string{}
+	for _, p := range pages {
+		slug := newpost.Slugify(p.Title)
+		if slug == "" {
+			return nil, fmt.Errorf("notion: page %s: can't derive a slug from %q", p.ID, p.Title)
+		}
+		d := importers.Draft{
+			Post: newpost.Post{
+				Title: p.Title, Date: o.Date, Slug: slug, Section: o.Section,
+				Tags: importers.Tags(p.Tags, o.Aliases, o.Posts),
+			},
+			Description: p.Description,
+		}
+		if !p.Created.IsZero() {
+			d.Date = p.Created
+		}
+		for _, other := range o.Posts {
+			if other.Slug == slug && other.Path != d.Path() {
+				return nil, fmt.Errorf("notion: page %q: slug %q is taken by %s", p.Title, slug, other.Path)
+			}
+		}
+		if len(d.Tags) == 0 {
+			p.Problems = append(p.Problems, "no tags; add some before publishing")
+		}
+		paths[p.ID] = d.Path()
+		drafts = append(drafts, draft{p, d})
+	}
+
+	r := &Result{}
+	for _, d := range drafts {
+		md := d.page.Markdown
+		names := map[string]bool{}
+		for _, img := range d.page.Images {
+			data := img.Data
+			if data == nil {
+				var err error
+				if data, err = download(ctx, o.HTTP, img.URL); err != nil {
+					return nil, fmt.Errorf("notion: page %q: %w", d.page.Title, err)
+				}
+			}
+			name := importers.FileName(img.Name)
+			for i := 2; names[name]; i++ {
+				ext := path.Ext(name)
+				name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(importers.FileName(img.Name), ext), i, ext)
+			}
+			names[name] = true
+			dest := path.Join(o.Images, d.draft.Slug, name)
+			md = strings.ReplaceAll(md, "("+img.Ref+")", "(/"+dest+")")
+			r.Attachments = append(r.Attachments, Attachment{Dest: dest, Data: data})
+		}
+		refs := slices.Sorted(maps.Keys(d.page.Links))
+		for _, ref := range refs {
+			id := d.page.Links[ref]
+			to, ok := paths[id]
+			if !ok {
+				d.page.Problems = append(d.page.Problems, fmt.Sprintf("links to page %s, which isn't imported", id))
+				md = unlink(md, ref)
+				continue
+			}
+			md = strings.ReplaceAll(md, "("+ref+")", `({{< ref "`+to+`" >}})`)
+		}
+		d.draft.Body = []byte(md)
+		b, err := d.draft.Render(o.Template)
+		if err != nil {
+			return nil, fmt.Errorf("notion: page %q: %w", d.page.Title, err)
+		}
+		r.Posts = append(r.Posts, Post{Page: d.page, Path: d.draft.Path(), Body: b})
+	}
+	return r, nil
+}
+
+// unlink replaces the links to ref in md with their text.
+func unlink(md, ref string) string {
+	re := regexp.MustCompile(`\[([^\]]*)\]\(` + regexp.QuoteMeta(ref) + `\)`)
+	return re.ReplaceAllString(md, "$1")
+}
+
+func download(ctx context.Context, c *http.Client, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = http.DefaultClient
+	}
+	// Notion's file URLs are signed; the query isn't worth printing.
+	where := req.URL.Host + req.URL.Path
+	resp, err := c.Do(req)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return nil, fmt.Errorf("GET %s: %w", where, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", where, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxImage+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxImage {
+		return nil, fmt.Errorf("GET %s: image is over %d MB", where, maxImage>>20)
+	}
+	return b, nil
+}
@@ -0,0 +1,254 @@
+package notion
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// idRe matches the ID Notion appends to the file and folder names of
+	// an export, as in "Context managers 0123…cdef.md".
+	idRe = regexp.MustCompile(` ?([0-9a-f]{32})(\.md)?$`)
+	// fenceRe matches a line that opens or closes a code block, with the
+	// language, if any, that follows an opening one.
+	fenceRe = regexp.MustCompile("^(\\s*)(```|~~~)\\s*(.*)$")
+	// headingRe matches an ATX heading.
+	headingRe = regexp.MustCompile(`^(#{1,6})\s`)
+	// propRe matches a line of the properties Notion writes under the
+	// title of a database page, as in "Tags: Go, Python".
+	propRe = regexp.MustCompile(`^([\p{L}][\p{L}\p{N} _-]{0,40}): (.*)$`)
+	// linkRe matches a markdown link or image with a relative destination.
+	linkRe = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]+)\)`)
+)
+
+// props are the property names that mark the lines under a title as a
+// database page's properties rather than its first paragraph.
+var props = map[string]bool{
+	"created": true, "created time": true, "date": true, "published": true,
+	"tags": true, "tag": true, "description": true, "summary": true,
+	"status": true, "type": true, "category": true, "last edited time": true,
+	"created by": true, "author": true,
+}
+
+// dateLayouts are how exports write dates, as Notion displays them.
+var dateLayouts = []string{
+	"January 2, 2006 3:04 PM", "January 2, 2006", "2006/01/02", time.DateOnly,
+	"01/02/2006", "2 January 2006",
+}
+
+// maxEntry bounds a file read from an export, nested zips included.
+const maxEntry = 256 << 20
+
+// FromZip reads the pages in a Notion export zip, including the zips that
+// large exports are split into inside the outer one. With titles, only the
+// pages with those titles are read.
+func FromZip(name string, titles []string) ([]*Page, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("notion: %w", err)
+	}
+	defer zr.Close()
+	files := map[string][]byte{}
+	if err := readZip(&zr.Reader, files); err != nil {
+		return nil, fmt.Errorf("notion: %s: %w", name, err)
+	}
+
+	var pages []*Page
+	var names []string
+	for n := range files {
+		if strings.HasSuffix(n, ".md") {
+			names = append(names, n)
+		}
+	}
+	slices.Sort(names)
+	for _, n := range names {
+		p := parseExport(n, files)
+		if len(titles) > 0 && !slices.ContainsFunc(titles, func(t string) bool { return strings.EqualFold(t, p.Title) }) {
+			continue
+		}
+		pages = append(pages, p)
+	}
+	for _, t := range titles {
+		if !slices.ContainsFunc(pages, func(p *Page) bool { return strings.EqualFold(t, p.Title) }) {
+			return nil, fmt.Errorf("notion: no page titled %q in %s", t, name)
+		}
+	}
+	return pages, nil
+}
+
+func readZip(zr *zip.Reader, files map[string][]byte) error {
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(io.LimitReader(rc, maxEntry+1))
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if len(b) > maxEntry {
+			return fmt.Errorf("%s is over %d MB", f.Name, maxEntry>>20)
+		}
+		if strings.HasSuffix(f.Name, ".zip") {
+			inner, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			if err := readZip(inner, files); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			continue
+		}
+		files[f.Name] = b
+	}
+	return nil
+}
+
+// parseExport converts the exported page at name: the title from its H1
+// or file name, the properties under it, and the body with its fences'
+// languages fixed, its headings moved down a level under the title, its
+// images found in the export, and its callouts, which are exported as
+// <aside>, turned into quotes.
+func parseExport(name string, files map[string][]byte) *Page {
+	p := &Page{Links: map[string]string{}}
+	base := path.Base(name)
+	if m := idRe.FindStringSubmatch(base); m != nil {
+		p.ID = m[1]
+		p.Title = strings.TrimSpace(base[:len(base)-len(m[0])])
+	} else {
+		p.Title = strings.TrimSuffix(base, ".md")
+	}
+	lines := strings.Split(strings.ReplaceAll(string(files[name]), "\r\n", "\n"), "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "# ") {
+		p.Title = strings.TrimSpace(lines[0][2:])
+		lines = lines[1:]
+	}
+	lines = p.properties(lines)
+
+	dir := path.Dir(name)
+	var out []string
+	var fence string
+	aside := false
+	for _, l := range lines {
+		if fence != "" {
+			if m := fenceRe.FindStringSubmatch(l); m != nil && m[2] == fence && m[3] == "" {
+				fence = ""
+			}
+			out = append(out, l)
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(l); m != nil {
+			fence = m[2]
+			out = append(out, m[1]+m[2]+Lang(m[3]))
+			continue
+		}
+		switch strings.TrimSpace(l) {
+		case "<aside>":
+			aside = true
+			continue
+		case "</aside>":
+			aside = false
+			continue
+		}
+		if m := headingRe.FindStringSubmatch(l); m != nil && len(m[1]) < 6 {
+			l = "#" + l
+		}
+		l = linkRe.ReplaceAllStringFunc(l, func(s string) string {
+			return p.exportLink(s, dir, files)
+		})
+		if aside {
+			l = strings.TrimRight("> "+l, " ")
+		}
+		out = append(out, l)
+	}
+	p.Markdown = strings.TrimSpace(strings.Join(out, "\n")) + "\n"
+	return p
+}
+
+// properties reads the block of properties under the title, if there is
+// one, and returns the lines after it.
+func (p *Page) properties(lines []string) []string {
+	i := 0
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	start, known := i, false
+	var kv [][2]string
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+		m := propRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			return lines[start:]
+		}
+		k := strings.ToLower(m[1])
+		known = known || props[k]
+		kv = append(kv, [2]string{k, strings.TrimSpace(m[2])})
+	}
+	if !known {
+		return lines[start:]
+	}
+	for _, e := range kv {
+		switch e[0] {
+		case "created", "created time", "date", "published":
+			for _, layout := range dateLayouts {
+				if t, err := time.Parse(layout, e[1]); err == nil && p.Created.IsZero() {
+					p.Created = t
+					break
+				}
+			}
+		case "tags", "tag":
+			for _, t := range strings.Split(e[1], ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					p.Tags = append(p.Tags, t)
+				}
+			}
+		case "description", "summary":
+			if p.Description == "" {
+				p.Description = e[1]
+			}
+		}
+	}
+	return lines[i:]
+}
+
+// exportLink rewrites a link within the export: an image to a Ref for
+// Import to place, and a link to another page to a Ref for its post.
+func (p *Page) exportLink(s, dir string, files map[string][]byte) string {
+	m := linkRe.FindStringSubmatch(s)
+	dest := m[3]
+	if strings.Contains(dest, "://") || strings.HasPrefix(dest, "#") || strings.HasPrefix(dest, "mailto:") {
+		return s
+	}
+	rel, err := url.PathUnescape(dest)
+	if err != nil {
+		return s
+	}
+	target := path.Join(dir, rel)
+	if strings.HasSuffix(target, ".md") {
+		if id := idRe.FindStringSubmatch(path.Base(target)); id != nil {
+			ref := "notion-page:" + id[1]
+			p.Links[ref] = id[1]
+			return m[1] + "[" + m[2] + "](" + ref + ")"
+		}
+		return s
+	}
+	data, ok := files[target]
+	if !ok {
+		p.Problems = append(p.Problems, fmt.Sprintf("%s isn't in the export", rel))
+		return s
+	}
+	ref := fmt.Sprintf("notion-image:%d", len(p.Images))
+	p.Images = append(p.Images, Image{Ref: ref, Name: path.Base(target), Data: data})
+	return m[1] + "[" + m[2] + "](" + ref + ")"
+}
@@ -0,0 +1,550 @@
+// Package obsidian turns notes from an Obsidian vault into draft posts:
+// front matter mapped to the site's schema, wiki-links turned into Hugo
+// refs to the posts they name, and the attachments they embed copied into
+// static/. Links it can't resolve are reported rather than guessed.
+package obsidian
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/importers"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+// Vault is the notes and attachments under a vault's root. Obsidian links
+// to either by file name alone, wherever it is in the vault, so both are
+// indexed by their lowercased name.
+type Vault struct {
+	Root string
+	// notes maps a note's name, without .md, to its path from Root, and
+	// files does the same for every other file, by its name with the
+	// extension.
+	notes map[string]string
+	files map[string]string
+}
+
+// Open indexes the vault at root, skipping the .obsidian settings, the
+// trash, and other dot directories.
+func Open(root string) (*Vault, error) {
+	v := &Vault{Root: root, notes: map[string]string{}, files: map[string]string{}}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		name := strings.ToLower(path.Base(rel))
+		if n, ok := strings.CutSuffix(name, ".md"); ok {
+			v.notes[n] = rel
+		} else {
+			v.files[name] = rel
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("obsidian: %w", err)
+	}
+	return v, nil
+}
+
+// Options says how notes become posts.
+type Options struct {
+	// Section is where the drafts go, and Template renders their front
+	// matter; see newpost.Render.
+	Section  string
+	Template string
+	// Date is used for notes whose front matter has no date or created.
+	Date    time.Time
+	Aliases tags.Aliases
+	// Posts are the site's, for resolving links to published posts and
+	// spelling tags the way they already are.
+	Posts []*content.Post
+	// Images and Files are where attachments go, relative to static/:
+	// images under Images/<slug>/ and everything else under Files/<slug>/.
+	Images, Files string
+}
+
+// Post is a converted note.
+type Post struct {
+	// Note is the note's path in the vault, and Path the post's in the
+	// content directory.
+	Note  string
+	Path  string
+	Title string
+	Body  []byte
+}
+
+// Attachment is a file a post embeds or links to.
+type Attachment struct {
+	// Src is the file's path in the vault, and Dest its path relative to
+	// static/.
+	Src, Dest string
+}
+
+// Problem is something in a note that didn't convert cleanly, at a line of
+// it.
+type Problem struct {
+	Note string
+	Line int
+	Msg  string
+}
+
+func (p Problem) String() string { return fmt.Sprintf("%s:%d: %s", p.Note, p.Line, p.Msg) }
+
+// Result is what an Import converted.
+type Result struct {
+	Posts       []Post
+	Attachments []Attachment
+	Problems    []Problem
+}
+
+// note is a note being imported, with what other notes need to link to it.
+type note struct {
+	rel     string
+	fm      map[string]any
+	body    []byte
+	line    int
+	title   string
+	slug    string
+	date    time.Time
+	path    string
+	aliases []string
+}
+
+// Select returns the notes to import: those named, by name or by path in
+// the vault, or, when none are, every note whose front matter sets
+// `publish: true`, as Obsidian Publish does.
+func (v *Vault) Select(names []string) ([]string, error) {
+	var out []string
+	for _, n := range names {
+		n = strings.TrimSuffix(filepath.ToSlash(n), ".md")
+		rel, ok := v.notes[strings.ToLower(path.Base(n))]
+		if !ok {
+			return nil, fmt.Errorf("obsidian: no note %q in %s", n, v.Root)
+		}
+		out = append(out, rel)
+	}
+	if len(names) > 0 {
+		return out, nil
+	}
+	for _, rel := range v.notes {
+		fm, _, _, err := v.read(rel)
+		if err != nil {
+			return nil, err
+		}
+		if pub, _ := fm["publish"].(bool); pub {
+			out = append(out, rel)
+		}
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// read returns a note's front matter, its body, and the line the body
+// starts on.
+func (v *Vault) read(rel string) (map[string]any, []byte, int, error) {
+	b, err := os.ReadFile(filepath.Join(v.Root, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	fm, format, body, line, err := content.SplitFrontMatter(b)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("obsidian: %s: %w", rel, err)
+	}
+	m := map[string]any{}
+	if format == content.YAML {
+		if err := yaml.Unmarshal(fm, &m); err != nil {
+			return nil, nil, 0, fmt.Errorf("obsidian: %s: %w", rel, err)
+		}
+	}
+	lower := make(map[string]any, len(m))
+	for k, val := range m {
+		lower[strings.ToLower(k)] = val
+	}
+	return lower, body, line, nil
+}
+
+// Import converts the notes at rels, paths in the vault, into draft posts.
+// Notes link to each other by the posts they become, and to the site's
+// posts by file name, title, or slug.
+func (v *Vault) Import(rels []string, o Options) (*Result, error) {
+	r := &Result{}
+	var notes []*note
+	for _, rel := range rels {
+		fm, body, line, err := v.read(rel)
+		if err != nil {
+			return nil, err
+		}
+		n := &note{rel: rel, fm: fm, body: body, line: line}
+		n.title = str(fm, "title")
+		if n.title == "" {
+			n.title = strings.TrimSuffix(path.Base(rel), ".md")
+		}
+		n.slug = str(fm, "slug")
+		if n.slug == "" {
+			n.slug = newpost.Slugify(n.title)
+		}
+		if n.slug == "" {
+			return nil, fmt.Errorf("obsidian: %s: can't derive a slug from %q", rel, n.title)
+		}
+		n.date = o.Date
+		for _, k := range []string{"date", "created"} {
+			if d, ok := date(fm[k]); ok {
+				n.date = d
+				break
+			}
+		}
+		n.path = newpost.Post{Section: o.Section, Date: n.date, Slug: n.slug}.Path()
+		n.aliases = list(fm["aliases"])
+		for _, p := range o.Posts {
+			if p.Slug == n.slug && p.Path != n.path {
+				return nil, fmt.Errorf("obsidian: %s: slug %q is taken by %s", rel, n.slug, p.Path)
+			}
+		}
+		notes = append(notes, n)
+	}
+
+	links := linkTargets(notes, o.Posts)
+	copied := map[string]bool{}
+	for _, n := range notes {
+		c := &converter{v: v, o: o, n: n, links: links, r: r, copied: copied}
+		body := c.body()
+		d := importers.Draft{
+			Post: newpost.Post{
+				Title: n.title, Date: n.date, Slug: n.slug, Section: o.Section,
+				Tags: importers.Tags(append(list(n.fm["tags"]), c.tags...), o.Aliases, o.Posts),
+			},
+			Description: str(n.fm, "description"),
+			Summary:     str(n.fm, "summary"),
+			Body:        body,
+		}
+		if len(d.Tags) == 0 {
+			c.problem(1, "no tags; add some before publishing")
+		}
+		out, err := d.Render(o.Template)
+		if err != nil {
+			return nil, fmt.Errorf("obsidian: %s: %w", n.rel, err)
+		}
+		r.Posts = append(r.Posts, Post{Note: n.rel, Path: n.path, Title: n.title, Body: out})
+	}
+	return r, nil
+}
+
+// linkTargets maps the lowercased names a wiki-link may use, for the notes
+// being imported and the site's posts, to the post's path in the content
+// directory. Imported notes win over posts with the same name.
+func linkTargets(notes []*note, posts []*content.Post) map[string]string {
+	m := map[string]string{}
+	for _, p := range posts {
+		for _, k := range []string{strings.TrimSuffix(path.Base(p.Path), ".md"), p.Slug, p.Title} {
+			if k != "" {
+				m[strings.ToLower(k)] = p.Path
+			}
+		}
+	}
+	for _, n := range notes {
+		names := append([]string{strings.TrimSuffix(path.Base(n.rel), ".md"), n.title}, n.aliases...)
+		for _, k := range names {
+			m[strings.ToLower(k)] = n.path
+		}
+	}
+	return m
+}
+
+// converter rewrites a note's body.
+type converter struct {
+	v      *Vault
+	o      Options
+	n      *note
+	links  map[string]string
+	r      *Result
+	copied map[string]bool
+	// tags are the inline #tags taken out of the body.
+	tags []string
+}
+
+var (
+	// wikiRe matches [[Note]], [[Note#Heading|alias]], ![[file.png|300]],
+	// and the like.
+	wikiRe = regexp.MustCompile(`(!?)\[\[([^\]|#]*)(#[^\]|]*)?(?:\|([^\]]*))?\]\]`)
+	// mdLinkRe matches a markdown link or image with a destination that
+	// has no spaces, or one in angle brackets as Obsidian writes those.
+	mdLinkRe = regexp.MustCompile(`(!?)\[([^\]]*)\]\((<[^>]+>|[^)\s]+)\)`)
+	// tagRe matches an inline tag, which starts with a letter so issue
+	// numbers like #12 aren't taken for one.
+	tagRe = regexp.MustCompile(`(^|\s)#(\p{L}[\p{L}\p{N}_/-]*)`)
+	// fenceRe matches the line that opens or closes a code block.
+	fenceRe = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// body converts the note's body line by line, leaving code blocks and
+// inline code as they are. Obsidian comments, %%like this%%, are private
+// and dropped, and a leading H1 repeating the title goes too.
+func (c *converter) body() []byte {
+	var out bytes.Buffer
+	lines := strings.SplitAfter(string(c.n.body), "\n")
+	var fence string
+	comment := false
+	first := true
+	for i, l := range lines {
+		lineNo := c.n.line + i
+		if fence != "" {
+			if m := fenceRe.FindStringSubmatch(l); m != nil && m[1] == fence {
+				fence = ""
+			}
+			out.WriteString(l)
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(l); m != nil && !comment {
+			fence = m[1]
+			out.WriteString(l)
+			first = false
+			continue
+		}
+		nl := ""
+		if strings.HasSuffix(l, "\n") {
+			l, nl = l[:len(l)-1], "\n"
+		}
+		var kept strings.Builder
+		stripped := comment
+		for {
+			if comment {
+				end := strings.Index(l, "%%")
+				if end < 0 {
+					l = ""
+					break
+				}
+				l, comment = l[end+2:], false
+				continue
+			}
+			start := strings.Index(l, "%%")
+			if start < 0 {
+				kept.WriteString(l)
+				break
+			}
+			kept.WriteString(l[:start])
+			l, comment, stripped = l[start+2:], true, true
+		}
+		orig := strings.TrimSpace(strings.TrimSuffix(lines[i], "\n"))
+		conv := c.line(kept.String(), lineNo, stripped)
+		if strings.TrimSpace(conv) == "" && orig != "" {
+			// The line was only a comment or tags.
+			continue
+		}
+		if first && strings.TrimSpace(conv) != "" {
+			first = false
+			if h, ok := strings.CutPrefix(strings.TrimSpace(conv), "# "); ok && strings.EqualFold(strings.TrimSpace(h), c.n.title) {
+				continue
+			}
+		}
+		out.WriteString(conv + nl)
+	}
+	return bytes.TrimLeft(out.Bytes(), "\n")
+}
+
+// spacesRe matches the run of spaces left inside a line where a comment
+// or a tag was taken out.
+var spacesRe = regexp.MustCompile(`(\S) {2,}(\S)`)
+
+// line converts the prose of a line, the parts outside inline code.
+// stripped says a comment was taken out of it.
+func (c *converter) line(l string, lineNo int, stripped bool) string {
+	parts := strings.Split(l, "`")
+	for i := 0; i < len(parts); i += 2 {
+		s := wikiRe.ReplaceAllStringFunc(parts[i], func(m string) string {
+			g := wikiRe.FindStringSubmatch(m)
+			return c.wiki(g[1] == "!", strings.TrimSpace(g[2]), strings.TrimPrefix(g[3], "#"), g[4], lineNo)
+		})
+		s = mdLinkRe.ReplaceAllStringFunc(s, func(m string) string {
+			g := mdLinkRe.FindStringSubmatch(m)
+			return c.mdLink(m, g[1] == "!", g[2], strings.Trim(g[3], "<>"), lineNo)
+		})
+		s = tagRe.ReplaceAllStringFunc(s, func(m string) string {
+			g := tagRe.FindStringSubmatch(m)
+			c.tags = append(c.tags, g[2])
+			stripped = true
+			return g[1]
+		})
+		if stripped {
+			s = spacesRe.ReplaceAllString(s, "$1 $2")
+		}
+		parts[i] = s
+	}
+	return strings.TrimRight(strings.Join(parts, "`"), " \t")
+}
+
+// wiki converts a wiki-link or embed.
+func (c *converter) wiki(embed bool, target, heading, alias string, lineNo int) string {
+	if target != "" && path.Ext(target) != "" && !strings.EqualFold(path.Ext(target), ".md") {
+		src, ok := c.v.files[strings.ToLower(path.Base(target))]
+		if !ok {
+			c.problem(lineNo, "unresolved attachment %q", target)
+			return cmp.Or(alias, target)
+		}
+		u := c.attach(src)
+		if embed && importers.IsImage(target) {
+			// The alias of an embedded image is its size, like |300.
+			text := strings.TrimSuffix(path.Base(target), path.Ext(target))
+			if alias != "" && !isSize(alias) {
+				text = alias
+			}
+			return "![" + text + "](" + u + ")"
+		}
+		return "[" + cmp.Or(alias, path.Base(target)) + "](" + u + ")"
+	}
+
+	text := cmp.Or(alias, target)
+	if heading != "" && alias == "" {
+		text = strings.TrimPrefix(heading, "^")
+		if target != "" {
+			text = target + " § " + text
+		}
+	}
+	anchor := ""
+	if heading != "" && !strings.HasPrefix(heading, "^") {
+		// Block references, #^id, have no anchor on the site; the link
+		// goes to the post.
+		anchor = "#" + markdown.Anchorize(heading)
+	}
+	if target == "" {
+		return "[" + text + "](" + anchor + ")"
+	}
+	dest, ok := c.links[strings.ToLower(target)]
+	if !ok {
+		c.problem(lineNo, "unresolved link [[%s]]", target)
+		return text
+	}
+	if embed {
+		c.problem(lineNo, "embedded note [[%s]] isn't supported; linked to it instead", target)
+	}
+	return "[" + text + `]({{< ref "` + dest + anchor + `" >}})`
+}
+
+// mdLink converts a markdown link or image whose destination is a note or
+// a file in the vault, passing every other link through.
+func (c *converter) mdLink(m string, embed bool, text, dest string, lineNo int) string {
+	if strings.Contains(dest, "://") || strings.HasPrefix(dest, "#") || strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "mailto:") || strings.Contains(dest, "{{") {
+		return m
+	}
+	name, fragment, _ := strings.Cut(dest, "#")
+	if u, err := url.PathUnescape(name); err == nil {
+		name = u
+	}
+	if strings.EqualFold(path.Ext(name), ".md") || path.Ext(name) == "" {
+		target := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		p, ok := c.links[strings.ToLower(target)]
+		if !ok {
+			c.problem(lineNo, "unresolved link %s", dest)
+			return text
+		}
+		anchor := ""
+		if fragment != "" {
+			anchor = "#" + markdown.Anchorize(fragment)
+		}
+		return "[" + text + `]({{< ref "` + p + anchor + `" >}})`
+	}
+	src, ok := c.v.files[strings.ToLower(path.Base(name))]
+	if !ok {
+		c.problem(lineNo, "unresolved attachment %s", dest)
+		return m
+	}
+	bang := ""
+	if embed {
+		bang = "!"
+	}
+	return bang + "[" + text + "](" + c.attach(src) + ")"
+}
+
+// attach records the vault file at src to be copied for the post and
+// returns its URL.
+func (c *converter) attach(src string) string {
+	dir := c.o.Files
+	if importers.IsImage(src) {
+		dir = c.o.Images
+	}
+	dest := path.Join(dir, c.n.slug, importers.FileName(src))
+	if !c.copied[dest] {
+		c.copied[dest] = true
+		c.r.Attachments = append(c.r.Attachments, Attachment{Src: src, Dest: dest})
+	}
+	return "/" + dest
+}
+
+func (c *converter) problem(line int, format string, args ...any) {
+	c.r.Problems = append(c.r.Problems, Problem{Note: c.n.rel, Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// isSize reports whether an embed's alias is a size, 300 or 300x200,
+// rather than alt text.
+func isSize(s string) bool {
+	w, h, _ := strings.Cut(s, "x")
+	return w != "" && strings.Trim(w, "0123456789") == "" && strings.Trim(h, "0123456789") == ""
+}
+
+func str(fm map[string]any, key string) string {
+	s, _ := fm[key].(string)
+	return strings.TrimSpace(s)
+}
+
+// list reads a front matter value Obsidian writes as a list or, in older
+// vaults, as a comma- or space-separated string.
+func list(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	case []any:
+		var out []string
+		for _, e := range v {
+			if s, ok := e.(string); ok && strings.TrimSpace(s) != "" {
+				out = append(out, strings.TrimSpace(s))
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// date reads a front matter date: YAML's own timestamps, or the layouts
+// Obsidian's date and date-time properties and the Templater plugin write.
+func date(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range []string{time.DateOnly, time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02T15:04:05"} {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,173 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Literal reports the books a Literal user is reading.
+type Literal struct {
+	Handle string
+	// BaseURL is the GraphQL endpoint, for tests; empty is literal.club's.
+	BaseURL string
+}
+
+func (l *Literal) Name() string  { return "books" }
+func (l *Literal) Title() string { return "Reading" }
+
+// Fetch implements Source. Literal's API is GraphQL and needs no key for
+// public profiles: the handle is looked up first, then its shelf.
+func (l *Literal) Fetch(ctx context.Context, c *http.Client) ([]Item, error) {
+	endpoint := l.BaseURL
+	if endpoint == "" {
+		endpoint = "https://literal.club/graphql/"
+	}
+	var profile struct {
+		Profile *struct {
+			ID string `json:"id"`
+		} `json:"profile"`
+	}
+	err := graphQL(ctx, c, endpoint, `query($handle: String!) { profile(where: { handle: $handle }) { id } }`,
+		map[string]any{"handle": l.Handle}, &profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Profile == nil {
+		return nil, fmt.Errorf("no Literal profile %q", l.Handle)
+	}
+	var shelf struct {
+		Books []struct {
+			Slug    string `json:"slug"`
+			Title   string `json:"title"`
+			Cover   string `json:"cover"`
+			Authors []struct {
+				Name string `json:"name"`
+			} `json:"authors"`
+		} `json:"booksByReadingStateAndProfile"`
+	}
+	err = graphQL(ctx, c, endpoint, `query($profileId: String!) {
+  booksByReadingStateAndProfile(limit: 10, offset: 0, readingStatus: IS_READING, profileId: $profileId) {
+    slug title cover authors { name }
+  }
+}`, map[string]any{"profileId": profile.Profile.ID}, &shelf)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, b := range shelf.Books {
+		var authors []string
+		for _, a := range b.Authors {
+			authors = append(authors, a.Name)
+		}
+		items = append(items, Item{
+			Title:  b.Title,
+			URL:    "https://literal.club/book/" + url.PathEscape(b.Slug),
+			Detail: strings.Join(authors, ", "),
+			Image:  b.Cover,
+		})
+	}
+	return items, nil
+}
+
+// graphQL runs query against endpoint and decodes its data into v.
+func graphQL(ctx context.Context, c *http.Client, endpoint, query string, vars map[string]any, v any) error {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: %s", endpoint, resp.Status)
+	}
+	var doc struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+	if len(doc.Errors) > 0 {
+		return errors.New(doc.Errors[0].Message)
+	}
+	return json.Unmarshal(doc.Data, v)
+}
+
+// Goodreads reports the books on a Goodreads user's currently-reading
+// shelf. Goodreads closed its API, but shelves still have RSS feeds.
+type Goodreads struct {
+	UserID string
+	// BaseURL is the site's, for tests; empty is www.goodreads.com.
+	BaseURL string
+}
+
+func (g *Goodreads) Name() string  { return "books" }
+func (g *Goodreads) Title() string { return "Reading" }
+
+// Fetch implements Source.
+func (g *Goodreads) Fetch(ctx context.Context, c *http.Client) ([]Item, error) {
+	base := g.BaseURL
+	if base == "" {
+		base = "https://www.goodreads.com"
+	}
+	feedURL := base + "/review/list_rss/" + url.PathEscape(g.UserID) + "?shelf=currently-reading"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", feedURL, resp.Status)
+	}
+	var doc struct {
+		Items []struct {
+			Title  string `xml:"title"`
+			Link   string `xml:"link"`
+			Author string `xml:"author_name"`
+			Image  string `xml:"book_image_url"`
+			Added  string `xml:"user_date_added"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 5<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", feedURL, err)
+	}
+	var items []Item
+	for _, it := range doc.Items {
+		item := Item{
+			Title:  strings.TrimSpace(it.Title),
+			URL:    strings.TrimSpace(it.Link),
+			Detail: strings.TrimSpace(it.Author),
+			Image:  strings.TrimSpace(it.Image),
+		}
+		if t, err := time.Parse(time.RFC1123Z, strings.TrimSpace(it.Added)); err == nil {
+			item.Time = t.UTC()
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,119 @@
+package integrations
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GitHub reports a user's recent public activity: pushes, opened pull
+// requests and issues, releases, and new repositories.
+type GitHub struct {
+	User, Token string
+	Limit       int
+	// BaseURL is the API's, for tests; empty is api.github.com.
+	BaseURL string
+}
+
+func (g *GitHub) Name() string  { return "github" }
+func (g *GitHub) Title() string { return "Hacking on" }
+
+type ghEvent struct {
+	Type string `json:"type"`
+	Repo struct {
+		Name string `json:"name"`
+	} `json:"repo"`
+	CreatedAt time.Time `json:"created_at"`
+	Payload   struct {
+		Action  string `json:"action"`
+		Ref     string `json:"ref"`
+		RefType string `json:"ref_type"`
+		Size    int    `json:"size"`
+		Commits []struct {
+			Message string `json:"message"`
+		} `json:"commits"`
+		PullRequest struct {
+			Title   string `json:"title"`
+			HTMLURL string `json:"html_url"`
+		} `json:"pull_request"`
+		Issue struct {
+			Title   string `json:"title"`
+			HTMLURL string `json:"html_url"`
+		} `json:"issue"`
+		Release struct {
+			Name    string `json:"name"`
+			TagName string `json:"tag_name"`
+			HTMLURL string `json:"html_url"`
+		} `json:"release"`
+	} `json:"payload"`
+}
+
+// Fetch implements Source.
+func (g *GitHub) Fetch(ctx context.Context, c *http.Client) ([]Item, error) {
+	base := g.BaseURL
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	h := http.Header{"Accept": {"application/vnd.github+json"}}
+	if g.Token != "" {
+		h.Set("Authorization", "Bearer "+g.Token)
+	}
+	var events []ghEvent
+	if err := getJSON(ctx, c, base+"/users/"+url.PathEscape(g.User)+"/events/public?per_page=100", h, &events); err != nil {
+		return nil, err
+	}
+	var items []Item
+	// A repo's pushes are one item, with the commits added up.
+	pushed := map[string]int{}
+	commits := map[string]int{}
+	for _, e := range events {
+		if len(items) == g.Limit {
+			break
+		}
+		repoURL := "https://github.com/" + e.Repo.Name
+		it := Item{Time: e.CreatedAt.UTC(), Detail: e.Repo.Name}
+		switch {
+		case e.Type == "PushEvent":
+			commits[e.Repo.Name] += max(e.Payload.Size, len(e.Payload.Commits))
+			if i, ok := pushed[e.Repo.Name]; ok {
+				items[i].Title = pushes(commits[e.Repo.Name])
+				continue
+			}
+			it.Title = pushes(commits[e.Repo.Name])
+			it.URL = repoURL + "/commits"
+			if br, ok := strings.CutPrefix(e.Payload.Ref, "refs/heads/"); ok {
+				it.URL = repoURL + "/commits/" + br
+			}
+		case e.Type == "PullRequestEvent" && e.Payload.Action == "opened":
+			it.Title = "Opened " + e.Payload.PullRequest.Title
+			it.URL = e.Payload.PullRequest.HTMLURL
+		case e.Type == "IssuesEvent" && e.Payload.Action == "opened":
+			it.Title = "Reported " + e.Payload.Issue.Title
+			it.URL = e.Payload.Issue.HTMLURL
+		case e.Type == "ReleaseEvent" && e.Payload.Action == "published":
+			it.Title = "Released " + cmp.Or(e.Payload.Release.Name, e.Payload.Release.TagName)
+			it.URL = e.Payload.Release.HTMLURL
+		case e.Type == "CreateEvent" && e.Payload.RefType == "repository":
+			it.Title = "Started " + e.Repo.Name
+			it.URL = repoURL
+		default:
+			continue
+		}
+		if e.Type == "PushEvent" {
+			pushed[e.Repo.Name] = len(items)
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+func pushes(n int) string {
+	if n == 1 {
+		return "Pushed 1 commit"
+	}
+	return fmt.Sprintf("Pushed %d commits", n)
+}
@@ -0,0 +1,231 @@
+// Package integrations pulls what I've been up to from outside services
+// for the /now page: recent GitHub activity, Last.fm scrobbles, and the
+// books I'm reading on Literal or Goodreads. Each service is a Source; what
+// they return is cached, so a build within the TTL doesn't call them
+// again, and a service that's down keeps its last items.
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultConfig is where the sources are configured.
+const DefaultConfig = "data/now.toml"
+
+// DefaultCache holds each source's last items between runs.
+const DefaultCache = ".now-cache.json"
+
+// UserAgent identifies the requests to the services.
+const UserAgent = "rednafi.com now (+https://rednafi.com/now/)"
+
+// Item is a thing a source reports: a push, a track, a book.
+type Item struct {
+	Title string `json:"title"`
+	URL   string `json:"url,omitempty"`
+	// Detail is a line under the title, like the artist or the author.
+	Detail string    `json:"detail,omitempty"`
+	Image  string    `json:"image,omitempty"`
+	Time   time.Time `json:"time,omitzero"`
+}
+
+// Source is an outside service.
+type Source interface {
+	// Name is the source's key in the cache and in data/now.json.
+	Name() string
+	// Title heads its section on the page.
+	Title() string
+	Fetch(ctx context.Context, c *http.Client) ([]Item, error)
+}
+
+// Config is data/now.toml. A source without a user isn't fetched.
+type Config struct {
+	// TTL is how long a source's items are reused before it's called
+	// again.
+	TTL    time.Duration `toml:"ttl"`
+	GitHub struct {
+		User  string `toml:"user"`
+		Limit int    `toml:"limit"`
+	} `toml:"github"`
+	LastFM struct {
+		User  string `toml:"user"`
+		Limit int    `toml:"limit"`
+	} `toml:"lastfm"`
+	Books struct {
+		// Service is "literal" or "goodreads".
+		Service string `toml:"service"`
+		// User is the Literal handle or the Goodreads user ID.
+		User string `toml:"user"`
+	} `toml:"books"`
+}
+
+// LoadConfig reads the configuration at path. A missing file configures
+// no sources.
+func LoadConfig(path string) (Config, error) {
+	c := Config{TTL: 6 * time.Hour}
+	_, err := toml.DecodeFile(path, &c)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("integrations: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Sources returns the configured sources, in the order the page shows
+// them. GitHub reads GITHUB_TOKEN, if set, for a higher rate limit;
+// Last.fm needs LASTFM_API_KEY.
+func (c Config) Sources() ([]Source, error) {
+	var srcs []Source
+	if c.GitHub.User != "" {
+		srcs = append(srcs, &GitHub{User: c.GitHub.User, Token: os.Getenv("GITHUB_TOKEN"), Limit: limit(c.GitHub.Limit)})
+	}
+	if c.LastFM.User != "" {
+		key := os.Getenv("LASTFM_API_KEY")
+		if key == "" {
+			return nil, errors.New("integrations: lastfm.user is set but LASTFM_API_KEY isn't")
+		}
+		srcs = append(srcs, &LastFM{User: c.LastFM.User, APIKey: key, Limit: limit(c.LastFM.Limit)})
+	}
+	if c.Books.User != "" {
+		switch c.Books.Service {
+		case "literal":
+			srcs = append(srcs, &Literal{Handle: c.Books.User})
+		case "goodreads":
+			srcs = append(srcs, &Goodreads{UserID: c.Books.User})
+		default:
+			return nil, fmt.Errorf("integrations: books.service %q isn't literal or goodreads", c.Books.Service)
+		}
+	}
+	return srcs, nil
+}
+
+func limit(n int) int {
+	if n <= 0 {
+		return 5
+	}
+	return n
+}
+
+// Cached is a source's last items and when they were fetched.
+type Cached struct {
+	Fetched time.Time `json:"fetched"`
+	Items   []Item    `json:"items"`
+}
+
+// Cache maps a source's name to its last items.
+type Cache map[string]Cached
+
+// LoadCache reads the cache at path. A missing or unreadable cache is
+// empty, so every source is fetched.
+func LoadCache(path string) Cache {
+	c := Cache{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	if json.Unmarshal(b, &c) != nil {
+		return Cache{}
+	}
+	return c
+}
+
+// Save writes the cache to path.
+func (c Cache) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Section is a source's part of the page.
+type Section struct {
+	Name    string    `json:"name"`
+	Title   string    `json:"title"`
+	Updated time.Time `json:"updated"`
+	Items   []Item    `json:"items"`
+}
+
+// Gather returns each source's section, calling the sources whose cached
+// items are older than ttl and updating c with what they return. A source
+// that fails keeps its cached items, and its error is joined into the
+// returned one; sources that never succeeded are left off the page.
+func Gather(ctx context.Context, client *http.Client, srcs []Source, c Cache, ttl time.Duration, now time.Time) ([]Section, error) {
+	sections := []Section{}
+	var errs []error
+	for _, src := range srcs {
+		cached, ok := c[src.Name()]
+		if !ok || now.Sub(cached.Fetched) >= ttl {
+			items, err := src.Fetch(ctx, client)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+			} else {
+				cached = Cached{Fetched: now.UTC(), Items: items}
+				c[src.Name()] = cached
+				ok = true
+			}
+		}
+		if ok {
+			sections = append(sections, Section{Name: src.Name(), Title: src.Title(), Updated: cached.Fetched, Items: cached.Items})
+		}
+	}
+	return sections, errors.Join(errs...)
+}
+
+// DefaultPath is the file the now layout reads as site.Data.now.
+const DefaultPath = "data/now.json"
+
+// Write writes the sections to path for the now layout, reporting whether
+// the file changed.
+func Write(path string, sections []Section) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, struct {
+		Sections []Section `json:"sections"`
+	}{sections})
+}
+
+// getJSON decodes the JSON at rawURL into v.
+func getJSON(ctx context.Context, c *http.Client, rawURL string, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", redact(rawURL), resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// redact hides the API key in rawURL, so it stays out of logs.
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	if q.Has("api_key") {
+		q.Set("api_key", "REDACTED")
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
@@ -0,0 +1,82 @@
+package integrations
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LastFM reports a user's recent scrobbles.
+type LastFM struct {
+	User, APIKey string
+	Limit        int
+	// BaseURL is the API's, for tests; empty is ws.audioscrobbler.com.
+	BaseURL string
+}
+
+func (l *LastFM) Name() string  { return "lastfm" }
+func (l *LastFM) Title() string { return "Listening to" }
+
+// Fetch implements Source. The track playing now, if any, comes first and
+// has no time.
+func (l *LastFM) Fetch(ctx context.Context, c *http.Client) ([]Item, error) {
+	base := l.BaseURL
+	if base == "" {
+		base = "https://ws.audioscrobbler.com/2.0/"
+	}
+	q := url.Values{
+		"method":  {"user.getrecenttracks"},
+		"user":    {l.User},
+		"api_key": {l.APIKey},
+		"format":  {"json"},
+		"limit":   {strconv.Itoa(l.Limit)},
+	}
+	var doc struct {
+		RecentTracks struct {
+			Track []struct {
+				Name   string `json:"name"`
+				URL    string `json:"url"`
+				Artist struct {
+					Text string `json:"#text"`
+				} `json:"artist"`
+				Image []struct {
+					Size string `json:"size"`
+					Text string `json:"#text"`
+				} `json:"image"`
+				Date struct {
+					UTS string `json:"uts"`
+				} `json:"date"`
+				Attr struct {
+					NowPlaying string `json:"nowplaying"`
+				} `json:"@attr"`
+			} `json:"track"`
+		} `json:"recenttracks"`
+	}
+	if err := getJSON(ctx, c, base+"?"+q.Encode(), nil, &doc); err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, t := range doc.RecentTracks.Track {
+		// The playing track is listed on top of limit more.
+		if len(items) == l.Limit {
+			break
+		}
+		it := Item{Title: t.Name, URL: t.URL, Detail: t.Artist.Text}
+		for _, img := range t.Image {
+			if img.Size == "medium" {
+				it.Image = img.Text
+			}
+		}
+		if t.Attr.NowPlaying != "true" {
+			uts, err := strconv.ParseInt(t.Date.UTS, 10, 64)
+			if err != nil {
+				continue
+			}
+			it.Time = time.Unix(uts, 0).UTC()
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
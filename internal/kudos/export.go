@@ -0,0 +1,43 @@
+package kudos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultPath is where the counts are snapshotted for templates to read as
+// site.Data.kudos, so totals render when kudosd is down.
+const DefaultPath = "data/kudos.json"
+
+// Fetch reads every slug's hearts from the kudosd at base.
+func Fetch(ctx context.Context, client *http.Client, base string) (map[string]int, error) {
+	u := strings.TrimSuffix(base, "/") + "/kudos"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kudos: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kudos: GET %s: %s", u, resp.Status)
+	}
+	var counts map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&counts); err != nil {
+		return nil, fmt.Errorf("kudos: GET %s: %w", u, err)
+	}
+	return counts, nil
+}
+
+// Write encodes the counts to path, leaving the file alone if it's
+// unchanged. It reports whether it wrote.
+func Write(path string, counts map[string]int) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, counts)
+}
@@ -0,0 +1,99 @@
+// Package kudos stores the hearts readers give posts, one per device.
+//
+// A device is a random ID the page keeps in localStorage; only its hash is
+// stored, and nothing ties it to a person or an address.
+package kudos
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Store persists hearts in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS hearts (
+	slug    TEXT NOT NULL,
+	device  TEXT NOT NULL,
+	created INTEGER NOT NULL,
+	PRIMARY KEY (slug, device)
+);
+`
+
+// OpenStore opens (or creates) the database at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("kudos: init %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error { return s.db.Close() }
+
+var deviceRe = regexp.MustCompile(`^[A-Za-z0-9-]{16,64}$`)
+
+// ValidDevice reports whether id looks like a device ID the page made.
+func ValidDevice(id string) bool { return deviceRe.MatchString(id) }
+
+func hash(device string) string {
+	sum := sha256.Sum256([]byte(device))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Heart records device's heart for slug, unless it gave one already, and
+// returns the slug's total.
+func (s *Store) Heart(ctx context.Context, slug, device string, now time.Time) (int, error) {
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO hearts (slug, device, created) VALUES (?, ?, ?)`,
+		slug, hash(device), now.Unix()); err != nil {
+		return 0, err
+	}
+	n, _, err := s.Count(ctx, slug, "")
+	return n, err
+}
+
+// Count returns slug's hearts and whether device gave one. An empty device
+// is never counted as having given one.
+func (s *Store) Count(ctx context.Context, slug, device string) (n int, hearted bool, err error) {
+	err = s.db.QueryRowContext(ctx, `
+		SELECT count(*), coalesce(sum(device = ?), 0) > 0
+		FROM hearts WHERE slug = ?`, hash(device), slug).Scan(&n, &hearted)
+	return n, hearted && device != "", err
+}
+
+// All returns the hearts of every slug that has any.
+func (s *Store) All(ctx context.Context) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT slug, count(*) FROM hearts GROUP BY slug`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var (
+			slug string
+			n    int
+		)
+		if err := rows.Scan(&slug, &n); err != nil {
+			return nil, err
+		}
+		out[slug] = n
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,34 @@
+package linkcheck
+
+import (
+	"net/url"
+	"strings"
+)
+
+// CheckAnchors resolves the links in s that point at a #fragment of one of
+// the site's own pages against rendered, the site as Hugo built it, so a
+// fragment is only good if the page really has the anchor, whatever
+// heading IDs the markdown would suggest. Links to pages rendered doesn't
+// have are left to Check.
+func (s *Site) CheckAnchors(rendered *Site) []Problem {
+	var problems []Problem
+	for _, u := range sortedURLs(s.Pages) {
+		base, _ := url.Parse(u)
+		for _, ref := range s.Pages[u].Links {
+			dest, err := url.Parse(strings.TrimSpace(ref.Dest))
+			if err != nil || dest.Fragment == "" {
+				continue
+			}
+			if (dest.Scheme != "" && dest.Scheme != "http" && dest.Scheme != "https") ||
+				(dest.Host != "" && !isSiteHost(s.Host, dest.Host)) {
+				continue
+			}
+			target := base.ResolveReference(dest)
+			page, ok := rendered.page(target.Path)
+			if ok && !page.IDs[target.Fragment] {
+				problems = append(problems, Problem{ref, "no anchor #" + target.Fragment + " on " + page.URL})
+			}
+		}
+	}
+	return problems
+}
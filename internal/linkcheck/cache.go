@@ -0,0 +1,62 @@
+package linkcheck
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucket = []byte("links")
+
+// Cache persists external link results between runs in a bbolt file.
+type Cache struct {
+	db *bolt.DB
+}
+
+// OpenCache opens (or creates) the cache file at path.
+func OpenCache(path string) (*Cache, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Cache{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (c *Cache) Close() error { return c.db.Close() }
+
+// Get returns the last stored result for url.
+func (c *Cache) Get(url string) (Result, bool) {
+	var (
+		r  Result
+		ok bool
+	)
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucket).Get([]byte(url))
+		if v != nil && json.Unmarshal(v, &r) == nil {
+			ok = true
+		}
+		return nil
+	})
+	return r, ok
+}
+
+// Put stores r, keyed by its URL.
+func (c *Cache) Put(r Result) error {
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(r.URL), v)
+	})
+}
@@ -0,0 +1,223 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of checking one external URL.
+type Result struct {
+	URL       string    `json:"url"`
+	OK        bool      `json:"ok"`
+	Status    int       `json:"status,omitempty"`
+	Err       string    `json:"err,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	// LastOK is when the URL last resolved successfully. It's used to tell
+	// a regression from a link that has been broken all along.
+	LastOK time.Time `json:"last_ok,omitzero"`
+}
+
+// Checker verifies external URLs politely: requests to the same host are
+// spaced out, transient failures are retried with exponential backoff, and
+// results are cached so repeated runs only hit the network for stale
+// entries.
+type Checker struct {
+	Client *http.Client
+	Cache  *Cache
+
+	// TTL is how long a successful result is trusted. FailTTL is how long a
+	// failure is trusted before being retried on a later run.
+	TTL     time.Duration
+	FailTTL time.Duration
+
+	// PerHost is the minimum gap between two requests to the same host.
+	PerHost time.Duration
+	// Retries is how many times a transient failure is retried.
+	Retries int
+
+	mu    sync.Mutex
+	hosts map[string]*hostGate
+}
+
+type hostGate struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// Check returns the result for u along with the previously cached result, if
+// any. A fresh cached result is returned without touching the network.
+func (c *Checker) Check(ctx context.Context, u string) (cur, prev Result, hadPrev bool) {
+	if c.Cache != nil {
+		prev, hadPrev = c.Cache.Get(u)
+		if hadPrev && c.fresh(prev) {
+			return prev, prev, true
+		}
+	}
+	cur = c.fetch(ctx, u)
+	switch {
+	case cur.OK:
+		cur.LastOK = cur.CheckedAt
+	case hadPrev:
+		cur.LastOK = prev.LastOK
+	}
+	if c.Cache != nil && ctx.Err() == nil {
+		_ = c.Cache.Put(cur)
+	}
+	return cur, prev, hadPrev
+}
+
+func (c *Checker) fresh(r Result) bool {
+	ttl := c.FailTTL
+	if r.OK {
+		ttl = c.TTL
+	}
+	return time.Since(r.CheckedAt) < ttl
+}
+
+// fetch requests u, retrying transient failures.
+func (c *Checker) fetch(ctx context.Context, u string) Result {
+	res := Result{URL: u}
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx, u); err != nil {
+			res.Err = err.Error()
+			break
+		}
+		status, retryAfter, err := c.request(ctx, u)
+		res.Status, res.Err = status, ""
+		if err != nil {
+			res.Err = err.Error()
+		}
+		res.OK = err == nil && status < 400
+		if res.OK || !transient(status, err) || attempt >= c.Retries {
+			break
+		}
+		delay := backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			res.Err = ctx.Err().Error()
+			res.CheckedAt = time.Now()
+			return res
+		case <-time.After(delay):
+		}
+	}
+	res.CheckedAt = time.Now()
+	return res
+}
+
+// request issues a HEAD, falling back to GET for servers that don't support
+// HEAD properly.
+func (c *Checker) request(ctx context.Context, u string) (int, time.Duration, error) {
+	status, retry, err := c.send(ctx, http.MethodHead, u)
+	if err == nil && (status == http.StatusMethodNotAllowed ||
+		status == http.StatusForbidden ||
+		status == http.StatusNotFound ||
+		status == http.StatusNotImplemented) {
+		return c.send(ctx, http.MethodGet, u)
+	}
+	return status, retry, err
+}
+
+func (c *Checker) send(ctx context.Context, method, u string) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("User-Agent", "rednafi.com-linkcheck (+https://rednafi.com)")
+	req.Header.Set("Accept", "text/html,*/*;q=0.8")
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, retryAfter(resp.Header.Get("Retry-After")), nil
+}
+
+// wait blocks until a request to u's host is allowed.
+func (c *Checker) wait(ctx context.Context, u string) error {
+	host := u
+	if p, err := url.Parse(u); err == nil {
+		host = p.Host
+	}
+	c.mu.Lock()
+	if c.hosts == nil {
+		c.hosts = map[string]*hostGate{}
+	}
+	g := c.hosts[host]
+	if g == nil {
+		g = &hostGate{}
+		c.hosts[host] = g
+	}
+	c.mu.Unlock()
+
+	g.mu.Lock()
+	now := time.Now()
+	at := g.next
+	if at.Before(now) {
+		at = now
+	}
+	g.next = at.Add(c.PerHost)
+	g.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(at)):
+		return nil
+	}
+}
+
+// transient reports whether a failure is worth retrying.
+func transient(status int, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff returns the delay before retry attempt n: 1s, 2s, 4s, ... with up
+// to 50% jitter.
+func backoff(n int) time.Duration {
+	d := time.Second << n
+	return d + time.Duration(rand.Int64N(int64(d/2)))
+}
+
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// String formats r for reports.
+func (r Result) String() string {
+	switch {
+	case r.OK:
+		return fmt.Sprintf("%d", r.Status)
+	case r.Err != "":
+		return r.Err
+	default:
+		return http.StatusText(r.Status) + " (" + strconv.Itoa(r.Status) + ")"
+	}
+}
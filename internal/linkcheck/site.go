@@ -0,0 +1,298 @@
+// Package linkcheck finds broken links in the site, either in the markdown
+// sources or in Hugo's rendered output.
+//
+// Internal links are resolved against an index of the site's pages and the
+// heading anchors on each page. External links are checked over HTTP by a
+// Checker, which caches results between runs.
+package linkcheck
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Ref is a link found in a source file.
+type Ref struct {
+	Source string
+	Line   int
+	Dest   string
+}
+
+// Page is a page of the site: its URL path, the anchors it defines, and the
+// links it contains.
+type Page struct {
+	URL   string
+	IDs   map[string]bool
+	Links []Ref
+}
+
+// Site is an index of every page and static file the site serves.
+type Site struct {
+	// Host is the site's host, from baseURL. Absolute links to it, with or
+	// without www., are internal.
+	Host  string
+	Pages map[string]*Page
+	// Files holds URL paths of non-page files like images.
+	Files map[string]bool
+}
+
+// Problem is a link that doesn't resolve.
+type Problem struct {
+	Ref
+	Reason string
+}
+
+// generated lists the files Hugo produces that have no markdown source.
+var generated = []string{"/index.xml", "/index.json", "/sitemap.xml", "/robots.txt"}
+
+// HostOf returns the host of baseURL, the one its links are internal to.
+func HostOf(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("linkcheck: baseURL %q isn't an absolute URL", baseURL)
+	}
+	return u.Host, nil
+}
+
+// FromMarkdown indexes the site served at baseURL from its markdown
+// sources. Pages Hugo generates on its own (the home page, section and tag
+// lists, feeds) are added without anchors. Files under staticDir are
+// indexed if it exists.
+func FromMarkdown(baseURL, dir string, posts []*content.Post, staticDir string) (*Site, error) {
+	host, err := HostOf(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	s := &Site{Host: host, Pages: map[string]*Page{}, Files: map[string]bool{}}
+	for _, u := range []string{"/", "/archives/", "/search/", "/tags/"} {
+		s.Pages[u] = &Page{URL: u, IDs: map[string]bool{}}
+	}
+	for _, f := range generated {
+		s.Files[f] = true
+	}
+	for _, p := range posts {
+		if p.Draft {
+			continue
+		}
+		doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+		page := &Page{URL: p.RelPermalink(), IDs: map[string]bool{}}
+		for _, h := range doc.Headings() {
+			page.IDs[h.ID] = true
+		}
+		src := filepath.ToSlash(filepath.Join(dir, p.Path))
+		for _, l := range doc.Links() {
+			page.Links = append(page.Links, Ref{Source: src, Line: l.Line, Dest: l.Dest})
+		}
+		s.Pages[page.URL] = page
+		s.addList("/" + p.Section + "/")
+		for _, t := range p.Tags {
+			s.addList("/tags/" + content.TagSlug(t) + "/")
+		}
+	}
+	if err := s.indexFiles(staticDir, false); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Site) addList(u string) {
+	if _, ok := s.Pages[u]; !ok {
+		s.Pages[u] = &Page{URL: u, IDs: map[string]bool{}}
+	}
+}
+
+// FromHTML indexes the site served at baseURL as rendered under
+// publicDir.
+func FromHTML(baseURL, publicDir string) (*Site, error) {
+	host, err := HostOf(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	s := &Site{Host: host, Pages: map[string]*Page{}, Files: map[string]bool{}}
+	return s, s.indexFiles(publicDir, true)
+}
+
+func (s *Site) indexFiles(root string, parseHTML bool) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		u := "/" + filepath.ToSlash(rel)
+		s.Files[u] = true
+		if !parseHTML || filepath.Ext(p) != ".html" {
+			return nil
+		}
+		if path.Base(u) == "index.html" {
+			u = path.Dir(u)
+			if u != "/" {
+				u += "/"
+			}
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		page, err := parsePage(f, filepath.ToSlash(p), u)
+		if err != nil {
+			return err
+		}
+		s.Pages[u] = page
+		return nil
+	})
+}
+
+// parsePage collects the IDs and links of an HTML document. Line numbers are
+// tracked by counting newlines in the raw token stream.
+func parsePage(r io.Reader, source, u string) (*Page, error) {
+	page := &Page{URL: u, IDs: map[string]bool{}}
+	z := html.NewTokenizer(r)
+	line := 1
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return page, nil
+			}
+			return nil, z.Err()
+		}
+		raw := z.Raw()
+		start := line
+		line += bytes.Count(raw, []byte("\n"))
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		for hasAttr {
+			var k, v []byte
+			k, v, hasAttr = z.TagAttr()
+			switch {
+			case string(k) == "id" || (string(k) == "name" && string(name) == "a"):
+				page.IDs[string(v)] = true
+			case string(k) == "href" && (string(name) == "a" || string(name) == "link"),
+				string(k) == "src" && (string(name) == "img" || string(name) == "script"):
+				page.Links = append(page.Links, Ref{Source: source, Line: start, Dest: string(v)})
+			}
+		}
+	}
+}
+
+// Check resolves every internal link and returns the problems found along
+// with the external links, grouped by URL, that still need checking over
+// HTTP.
+func (s *Site) Check() (problems []Problem, external map[string][]Ref) {
+	external = map[string][]Ref{}
+	for _, u := range sortedURLs(s.Pages) {
+		page := s.Pages[u]
+		base, _ := url.Parse(page.URL)
+		for _, ref := range page.Links {
+			dest, err := url.Parse(strings.TrimSpace(ref.Dest))
+			if err != nil {
+				problems = append(problems, Problem{ref, "malformed URL"})
+				continue
+			}
+			switch dest.Scheme {
+			case "", "http", "https":
+			default:
+				continue // mailto:, tel:, javascript:, ...
+			}
+			if dest.Host != "" && !isSiteHost(s.Host, dest.Host) {
+				key := Normalize(dest.String())
+				external[key] = append(external[key], ref)
+				continue
+			}
+			if reason := s.resolve(base.ResolveReference(dest)); reason != "" {
+				problems = append(problems, Problem{ref, reason})
+			}
+		}
+	}
+	return problems, external
+}
+
+func sortedURLs(pages map[string]*Page) []string {
+	urls := make([]string, 0, len(pages))
+	for u := range pages {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// isSiteHost reports whether h is host, or host with or without www.
+func isSiteHost(host, h string) bool {
+	host, h = strings.TrimPrefix(strings.ToLower(host), "www."), strings.ToLower(h)
+	return h == host || h == "www."+host
+}
+
+// Normalize returns the form of an external URL that results are cached
+// under: the fragment is dropped and a missing scheme becomes https.
+func Normalize(dest string) string {
+	u, err := url.Parse(strings.TrimSpace(dest))
+	if err != nil {
+		return dest
+	}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// IsExternal reports whether dest is an absolute http(s) URL pointing
+// somewhere other than host, the site's.
+func IsExternal(host, dest string) bool {
+	u, err := url.Parse(strings.TrimSpace(dest))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return u.Host != "" && !isSiteHost(host, u.Host)
+}
+
+// resolve returns why an internal URL doesn't resolve, or "" if it does.
+func (s *Site) resolve(u *url.URL) string {
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	page, ok := s.page(p)
+	if !ok {
+		if s.Files[p] {
+			return ""
+		}
+		return "no page or file at " + p
+	}
+	if u.Fragment != "" && !page.IDs[u.Fragment] {
+		return "no anchor #" + u.Fragment + " on " + page.URL
+	}
+	return ""
+}
+
+// page returns the page at URL path p, which may leave off the trailing
+// slash.
+func (s *Site) page(p string) (*Page, bool) {
+	if p == "" {
+		p = "/"
+	}
+	page, ok := s.Pages[p]
+	if !ok && !strings.HasSuffix(p, "/") {
+		page, ok = s.Pages[p+"/"]
+	}
+	return page, ok
+}
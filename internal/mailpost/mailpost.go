@@ -0,0 +1,200 @@
+// Package mailpost turns the emails Mailgun routes to cmd/mailpostd into
+// notes and draft posts. Mailgun signs each forwarded message with the
+// account's webhook signing key; a message is only used if that signature
+// is fresh and unused, its sender is on the allowlist, and Mailgun found
+// the sender's SPF or DKIM to pass, so a forged From alone isn't enough.
+package mailpost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/newpost"
+	"github.com/rednafi/rednafi.com/internal/notes"
+	"github.com/rednafi/rednafi.com/internal/tags"
+	"github.com/rednafi/rednafi.com/internal/webhook"
+)
+
+// ErrStale is returned for a message whose signature is too old to trust.
+var ErrStale = errors.New("mailpost: stale signature")
+
+// ErrSender is returned for a message from outside the allowlist, or one
+// Mailgun couldn't authenticate.
+var ErrSender = errors.New("mailpost: sender not allowed")
+
+// Message is an email as Mailgun forwards it.
+type Message struct {
+	// Sender is the envelope sender, From the header's address.
+	Sender, From string
+	Subject      string
+	// Text is the plain-text body without the quoted reply and signature
+	// Mailgun strips, or the whole plain-text body if it stripped it all.
+	Text string
+	// Headers are the message's headers, as Mailgun lists them.
+	Headers   map[string]string
+	Timestamp time.Time
+	Token     string
+	Signature string
+}
+
+// FromForm reads a message from the fields of Mailgun's forward.
+func FromForm(f url.Values) (Message, error) {
+	m := Message{
+		Sender:    f.Get("sender"),
+		Subject:   strings.TrimSpace(f.Get("subject")),
+		Text:      f.Get("stripped-text"),
+		Token:     f.Get("token"),
+		Signature: f.Get("signature"),
+		Headers:   map[string]string{},
+	}
+	if strings.TrimSpace(m.Text) == "" {
+		m.Text = f.Get("body-plain")
+	}
+	m.Text = strings.ReplaceAll(m.Text, "\r\n", "\n")
+	if from, err := mail.ParseAddress(f.Get("from")); err == nil {
+		m.From = from.Address
+	}
+	ts, err := strconv.ParseInt(f.Get("timestamp"), 10, 64)
+	if err != nil {
+		return m, fmt.Errorf("mailpost: timestamp: %w", err)
+	}
+	m.Timestamp = time.Unix(ts, 0)
+	var headers [][]string
+	if h := f.Get("message-headers"); h != "" {
+		if err := json.Unmarshal([]byte(h), &headers); err != nil {
+			return m, fmt.Errorf("mailpost: message-headers: %w", err)
+		}
+	}
+	for _, h := range headers {
+		if len(h) == 2 {
+			m.Headers[strings.ToLower(h[0])] = h[1]
+		}
+	}
+	return m, nil
+}
+
+// Verify checks the message's signature against Mailgun's signing key and
+// that it was made within maxAge of now. Replayed tokens are the caller's
+// to catch; see Seen.
+func (m Message) Verify(key string, now time.Time, maxAge time.Duration) error {
+	if key == "" {
+		return webhook.ErrSignature
+	}
+	if err := webhook.VerifyHMAC([]byte(key), []byte(strconv.FormatInt(m.Timestamp.Unix(), 10)+m.Token), m.Signature); err != nil {
+		return err
+	}
+	if d := now.Sub(m.Timestamp); d > maxAge || d < -maxAge {
+		return ErrStale
+	}
+	return nil
+}
+
+// Allowed checks that both the envelope and header senders are in
+// allowlist and, if requireAuth is set, that Mailgun's SPF or DKIM check
+// passed.
+func (m Message) Allowed(allowlist []string, requireAuth bool) error {
+	ok := func(addr string) bool {
+		for _, a := range allowlist {
+			if addr != "" && strings.EqualFold(strings.TrimSpace(a), addr) {
+				return true
+			}
+		}
+		return false
+	}
+	if !ok(m.Sender) || !ok(m.From) {
+		return fmt.Errorf("%w: %s", ErrSender, m.From)
+	}
+	if requireAuth && m.Headers["x-mailgun-spf"] != "Pass" && m.Headers["x-mailgun-dkim-check-result"] != "Pass" {
+		return fmt.Errorf("%w: %s failed SPF and DKIM", ErrSender, m.From)
+	}
+	return nil
+}
+
+// Seen remembers the tokens of the messages already used, so a captured
+// forward can't be replayed while its signature is still fresh.
+type Seen map[string]time.Time
+
+// Add records token at now and reports whether it's new, forgetting the
+// tokens older than maxAge.
+func (s Seen) Add(token string, now time.Time, maxAge time.Duration) bool {
+	for t, at := range s {
+		if now.Sub(at) > maxAge {
+			delete(s, t)
+		}
+	}
+	if _, ok := s[token]; ok {
+		return false
+	}
+	s[token] = now
+	return true
+}
+
+// File is a post or note to commit.
+type File struct {
+	// Path is relative to the content directory.
+	Path string
+	Body []byte
+	// Note is set for a note, which is published right away, and unset
+	// for a draft post.
+	Note bool
+	// Title is the post's, or empty for a note.
+	Title string
+}
+
+// Options says how messages become files.
+type Options struct {
+	// Section is where draft posts go.
+	Section string
+	// Template renders a draft's front matter; see newpost.Render.
+	Template string
+	Aliases  tags.Aliases
+}
+
+// Convert turns the message into a file. A message without a subject, or
+// with the subject "note", becomes a note; any other subject is the title
+// of a draft post. Hashtags in the subject, like "#go", become tags, and
+// the body, plain text or markdown, is used as is.
+func (m Message) Convert(o Options, now time.Time) (File, error) {
+	body := strings.TrimSpace(m.Text)
+	if body == "" {
+		return File{}, errors.New("mailpost: empty body")
+	}
+	var words, ts []string
+	for _, w := range strings.Fields(m.Subject) {
+		if t, ok := strings.CutPrefix(w, "#"); ok && t != "" {
+			ts = append(ts, t)
+			continue
+		}
+		words = append(words, w)
+	}
+	ts = o.Aliases.Normalize(ts)
+	title := strings.Join(words, " ")
+
+	if title == "" || strings.EqualFold(title, "note") {
+		n := notes.Note{Date: now, Tags: ts, Body: body}
+		b, err := n.Render()
+		return File{Path: n.Path(), Body: b, Note: true}, err
+	}
+	p := newpost.Post{Title: title, Date: now, Section: o.Section, Slug: newpost.Slugify(title), Tags: ts}
+	if p.Slug == "" {
+		return File{}, fmt.Errorf("mailpost: can't derive a slug from %q", title)
+	}
+	fm, err := newpost.Render(o.Template, p)
+	if err != nil {
+		return File{}, err
+	}
+	b := append(fm, '\n')
+	b = append(b, body...)
+	b = append(b, '\n')
+	if _, err := content.Parse(p.Path(), b); err != nil {
+		return File{}, fmt.Errorf("mailpost: %w", err)
+	}
+	return File{Path: p.Path(), Body: b, Title: title}, nil
+}
@@ -0,0 +1,405 @@
+// Package markdown parses post bodies with goldmark configured the way
+// config.yml configures Hugo, and exposes the bits of the document the
+// tooling needs: links, headings, and their line numbers.
+package markdown
+
+import (
+	"bytes"
+	stdhtml "html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// New returns a goldmark instance with the same extensions and parser
+// options the site enables in config.yml under markup.goldmark.
+func New(opts ...goldmark.Option) goldmark.Markdown {
+	base := []goldmark.Option{
+		goldmark.WithExtensions(
+			extension.DefinitionList,
+			extension.Footnote,
+			extension.NewLinkify(
+				extension.WithLinkifyAllowedProtocols([]string{"http:", "https:"}),
+			),
+			extension.Strikethrough,
+			extension.Table,
+			extension.TaskList,
+			extension.Typographer,
+		),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			// markup.goldmark.parser.attribute.title: ## Heading {#id}
+			parser.WithHeadingAttribute(),
+		),
+	}
+	return goldmark.New(append(base, opts...)...)
+}
+
+// Render converts src to HTML the way Hugo renders post bodies, including
+// raw HTML passthrough (renderer.unsafe) and heading IDs.
+func Render(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	md := New(goldmark.WithRendererOptions(html.WithUnsafe()))
+	ctx := parser.NewContext(parser.WithIDs(NewIDs()))
+	if err := md.Convert(src, &buf, parser.WithContext(ctx)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var rootRelRe = regexp.MustCompile(`(href|src)="/([^/"][^"]*)?"`)
+
+// Absolutize rewrites the root-relative href and src attributes in
+// rendered HTML against base, so links keep working off the site, as in
+// feed readers.
+func Absolutize(html []byte, base string) []byte {
+	return rootRelRe.ReplaceAll(html, []byte(`$1="`+base+`/$2"`))
+}
+
+// Doc is a parsed markdown document.
+type Doc struct {
+	Source []byte
+	Root   ast.Node
+	// firstLine is the file line number of Source's first line.
+	firstLine int
+	lineStart []int
+	ids       *IDs
+}
+
+// Parse parses src. firstLine is the line in the original file where src
+// starts, so that positions reported by the returned Doc map back to it.
+func Parse(src []byte, firstLine int) *Doc {
+	ids := NewIDs()
+	ctx := parser.NewContext(parser.WithIDs(ids))
+	root := New().Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+	d := &Doc{Source: src, Root: root, firstLine: firstLine, lineStart: []int{0}, ids: ids}
+	for i, c := range src {
+		if c == '\n' {
+			d.lineStart = append(d.lineStart, i+1)
+		}
+	}
+	return d
+}
+
+// Line returns the file line number of the byte at offset.
+func (d *Doc) Line(offset int) int {
+	lo, hi := 0, len(d.lineStart)
+	for lo+1 < hi {
+		mid := (lo + hi) / 2
+		if d.lineStart[mid] <= offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return d.firstLine + lo
+}
+
+// NodeLine returns the file line a node starts on, walking down to the first
+// text segment for inline nodes and up to the enclosing block otherwise.
+func (d *Doc) NodeLine(n ast.Node) int {
+	if off, ok := offsetOf(n); ok {
+		return d.Line(off)
+	}
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if off, ok := offsetOf(p); ok {
+			return d.Line(off)
+		}
+	}
+	return d.firstLine
+}
+
+func offsetOf(n ast.Node) (int, bool) {
+	if n.Type() == ast.TypeBlock {
+		if lines := n.Lines(); lines != nil && lines.Len() > 0 {
+			return lines.At(0).Start, true
+		}
+	}
+	if t, ok := n.(*ast.Text); ok {
+		return t.Segment.Start, true
+	}
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if off, ok := offsetOf(c); ok {
+			return off, true
+		}
+	}
+	return 0, false
+}
+
+// Text returns the plain text content of n.
+func (d *Doc) Text(n ast.Node) string {
+	var b bytes.Buffer
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(d.Source))
+			if c.SoftLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.WriteString(stdhtml.UnescapeString(string(c.Value)))
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// PlainText returns the document's prose with markup removed, one block per
+// line. Code blocks are included only if withCode is set; inline code is
+// always kept since it's part of the sentence around it.
+func (d *Doc) PlainText(withCode bool) string {
+	if !withCode {
+		return d.plainText(nil)
+	}
+	return d.plainText(func(n ast.Node) string {
+		var b strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			b.Write(seg.Value(d.Source))
+		}
+		return b.String()
+	})
+}
+
+// Spoken returns the prose as PlainText(false) does, with each code block
+// replaced by the line say returns for its language, empty if it has
+// none, and its number of lines. A block say returns "" for is skipped.
+func (d *Doc) Spoken(say func(lang string, lines int) string) string {
+	return d.plainText(func(n ast.Node) string {
+		lang := ""
+		if f, ok := n.(*ast.FencedCodeBlock); ok {
+			lang = string(f.Language(d.Source))
+		}
+		return say(lang, n.Lines().Len())
+	})
+}
+
+// Interleaved returns the prose as PlainText(false) does, with each code
+// block replaced by the line code returns for its language and source. A
+// block code returns "" for is skipped.
+func (d *Doc) Interleaved(code func(lang, src string) string) string {
+	return d.plainText(func(n ast.Node) string {
+		lang := ""
+		if f, ok := n.(*ast.FencedCodeBlock); ok {
+			lang = string(f.Language(d.Source))
+		}
+		var b strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			b.Write(seg.Value(d.Source))
+		}
+		return code(lang, b.String())
+	})
+}
+
+// plainText walks the document's prose, writing what code returns in
+// place of each code block, or nothing if code is nil.
+func (d *Doc) plainText(code func(n ast.Node) string) string {
+	return d.textOf(d.Root, code)
+}
+
+// textOf is plainText for the subtree at root.
+func (d *Doc) textOf(root ast.Node, code func(n ast.Node) string) string {
+	var b strings.Builder
+	_ = ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock && n.HasChildren() {
+				b.WriteByte('\n')
+			}
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			if code != nil {
+				if s := code(n); s != "" {
+					b.WriteString(s)
+					b.WriteByte('\n')
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.HTMLBlock, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			b.Write(n.Segment.Value(d.Source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			// The typographer emits smart quotes and dashes as entities.
+			b.WriteString(stdhtml.UnescapeString(string(n.Value)))
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// Section is the prose under a heading, up to the next heading of any
+// level. The text before the first heading is a section with no heading.
+type Section struct {
+	Heading *Heading
+	Text    string
+}
+
+// Sections splits the document's prose, as PlainText(false) has it, at
+// its headings.
+func (d *Doc) Sections() []Section {
+	var out []Section
+	var b strings.Builder
+	var cur *Heading
+	flush := func() {
+		if text := strings.TrimSpace(b.String()); text != "" || cur != nil {
+			out = append(out, Section{Heading: cur, Text: text})
+		}
+		b.Reset()
+	}
+	for n := d.Root.FirstChild(); n != nil; n = n.NextSibling() {
+		if h, ok := n.(*ast.Heading); ok {
+			flush()
+			heading := d.heading(h)
+			cur = &heading
+			continue
+		}
+		b.WriteString(d.textOf(n, nil))
+	}
+	flush()
+	return out
+}
+
+// Link is a link or image found in the document.
+type Link struct {
+	Dest  string
+	Text  string
+	Line  int
+	Image bool
+}
+
+// Links returns every link, autolink, and image in the document, including
+// reference-style links resolved to their definitions.
+func (d *Doc) Links() []Link {
+	var links []Link
+	_ = ast.Walk(d.Root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			links = append(links, Link{
+				Dest: string(n.Destination), Text: d.Text(n), Line: d.NodeLine(n),
+			})
+		case *ast.Image:
+			links = append(links, Link{
+				Dest: string(n.Destination), Text: d.Text(n), Line: d.NodeLine(n), Image: true,
+			})
+		case *ast.AutoLink:
+			u := string(n.URL(d.Source))
+			if n.AutoLinkType == ast.AutoLinkEmail {
+				u = "mailto:" + u
+			}
+			links = append(links, Link{
+				Dest: u, Text: string(n.Label(d.Source)), Line: d.NodeLine(n),
+			})
+		}
+		return ast.WalkContinue, nil
+	})
+	return links
+}
+
+// Heading is a section heading and the anchor ID Hugo gives it.
+type Heading struct {
+	Level int
+	Text  string
+	ID    string
+	Line  int
+	// Suffixed reports whether ID got a -1, -2 suffix because an earlier
+	// heading's text made the same one.
+	Suffixed bool
+}
+
+// Headings returns the document's headings in order.
+func (d *Doc) Headings() []Heading {
+	var hs []Heading
+	_ = ast.Walk(d.Root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		hs = append(hs, d.heading(h))
+		return ast.WalkSkipChildren, nil
+	})
+	return hs
+}
+
+func (d *Doc) heading(h *ast.Heading) Heading {
+	var id string
+	if v, ok := h.AttributeString("id"); ok {
+		if b, ok := v.([]byte); ok {
+			id = string(b)
+		}
+	}
+	return Heading{
+		Level: h.Level, Text: d.Text(h), ID: id, Line: d.NodeLine(h),
+		Suffixed: d.ids.suffixed[id],
+	}
+}
+
+// IDs generates heading IDs the way Hugo does with
+// autoHeadingIDType: github, including the -1, -2 suffixes for duplicates.
+type IDs struct {
+	seen     map[string]bool
+	suffixed map[string]bool
+}
+
+// NewIDs returns an empty ID generator.
+func NewIDs() *IDs { return &IDs{seen: map[string]bool{}, suffixed: map[string]bool{}} }
+
+// Generate implements parser.IDs.
+func (ids *IDs) Generate(value []byte, _ ast.NodeKind) []byte {
+	id := Anchorize(string(value))
+	if id == "" {
+		id = "heading"
+	}
+	unique := id
+	for i := 1; ids.seen[unique]; i++ {
+		unique = id + "-" + strconv.Itoa(i)
+	}
+	ids.seen[unique] = true
+	ids.suffixed[unique] = unique != id
+	return []byte(unique)
+}
+
+// Put implements parser.IDs.
+func (ids *IDs) Put(value []byte) { ids.seen[string(value)] = true }
+
+// markupRe strips the inline markup characters goldmark leaves in heading
+// source text before it's turned into an ID.
+var markupRe = regexp.MustCompile("[`*]")
+
+// Anchorize turns heading text into a GitHub-style anchor: lowercased,
+// spaces replaced by hyphens, and everything but letters, digits, hyphens,
+// and underscores dropped.
+func Anchorize(s string) string {
+	s = markupRe.ReplaceAllString(strings.TrimSpace(s), "")
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == ' ' || r == '-':
+			b.WriteByte('-')
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,252 @@
+// Package math renders the TeX in posts, $...$ inline and $$...$$ as a
+// display, to MathML at build time, so math reads without a client-side
+// KaTeX bundle or JavaScript at all. The TeX goes through the KaTeX CLI; its
+// output is cached by expression so only new math needs Node.
+//
+// Hugo has no math syntax, and goldmark reads the TeX as markdown, turning
+// a_1 + b_1 into emphasis. So the expressions are found in the markdown,
+// where the TeX is intact, and matched up with the built page by the
+// dollar signs, which goldmark leaves alone: the nth dollar sign in the
+// page's prose is the nth one in the post's.
+package math
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultCache is where rendered expressions are kept between builds.
+const DefaultCache = ".math-cache.json"
+
+// DefaultKaTeX is the KaTeX CLI command, pinned so the cache stays valid.
+var DefaultKaTeX = []string{"npx", "--yes", "katex@0.16.11"}
+
+// Expr is a TeX expression.
+type Expr struct {
+	TeX     string
+	Display bool
+}
+
+// Token is a dollar sign in a post's prose, in source order: either a
+// literal one, escaped as \$ or left unpaired like a price, or the opening
+// of a math expression, which takes its closing dollars with it.
+type Token struct {
+	Literal bool
+	Expr    Expr
+	// dollars is how many dollar signs the expression shows up as in the
+	// built page: its delimiters and any \$ in the TeX.
+	dollars int
+}
+
+// Dollars returns the number of dollar signs t accounts for in the page.
+func (t Token) Dollars() int {
+	if t.Literal {
+		return 1
+	}
+	return t.dollars
+}
+
+var fenceRe = regexp.MustCompile("^(`{3,}|~{3,})")
+
+// Scan returns the dollar signs in body, a post's markdown, skipping code
+// blocks and code spans. Math follows pandoc's rules, a little stricter,
+// so prices aren't math: an opening $ can't be followed by a space, and
+// the next $, which closes it, can't follow a space or be followed by a
+// digit. Neither kind spans a blank line.
+func Scan(body []byte) []Token {
+	// Blank out fenced code, keeping the lines so paragraphs stay apart.
+	var prose strings.Builder
+	fence := ""
+	for _, l := range strings.SplitAfter(string(body), "\n") {
+		t := strings.TrimLeft(l, " \t")
+		switch {
+		case fence != "":
+			if strings.HasPrefix(t, fence) && strings.TrimSpace(strings.TrimLeft(t, fence[:1])) == "" {
+				fence = ""
+			}
+			prose.WriteString("\n")
+		case fenceRe.MatchString(t):
+			fence = fenceRe.FindString(t)
+			prose.WriteString("\n")
+		default:
+			prose.WriteString(l)
+		}
+	}
+
+	s := prose.String()
+	var toks []Token
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '$' {
+				toks = append(toks, Token{Literal: true})
+			}
+			i += 2
+		case '`':
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			run := s[i : i+n]
+			if end := strings.Index(s[i+n:], run); end >= 0 {
+				i += n + end + n
+			} else {
+				i += n
+			}
+		case '$':
+			if t, n, ok := scanMath(s[i:]); ok {
+				toks = append(toks, t)
+				i += n
+			} else {
+				toks = append(toks, Token{Literal: true})
+				i++
+			}
+		default:
+			i++
+		}
+	}
+	return toks
+}
+
+// scanMath reads the expression s starts with, returning it and its
+// length in s.
+func scanMath(s string) (Token, int, bool) {
+	display := strings.HasPrefix(s, "$$")
+	open := 1
+	if display {
+		open = 2
+	} else if len(s) < 2 || strings.ContainsRune(" \t\n", rune(s[1])) {
+		return Token{}, 0, false
+	}
+	inner := 0
+	for j := open; j < len(s); j++ {
+		switch {
+		case s[j] == '\\':
+			if j+1 < len(s) && s[j+1] == '$' {
+				inner++
+			}
+			j++
+		case s[j] == '\n' && strings.HasPrefix(strings.TrimLeft(s[j+1:], " \t"), "\n"):
+			return Token{}, 0, false
+		case display && strings.HasPrefix(s[j:], "$$"):
+			tex := strings.TrimSpace(s[open:j])
+			if tex == "" {
+				return Token{}, 0, false
+			}
+			return Token{Expr: Expr{tex, true}, dollars: 4 + inner}, j + 2, true
+		case !display && s[j] == '$':
+			closes := !strings.ContainsRune(" \t\n", rune(s[j-1])) &&
+				(j+1 >= len(s) || s[j+1] < '0' || s[j+1] > '9')
+			if !closes {
+				return Token{}, 0, false
+			}
+			return Token{Expr: Expr{s[1:j], false}, dollars: 2 + inner}, j + 1, true
+		}
+	}
+	return Token{}, 0, false
+}
+
+// Exprs returns the expressions among toks.
+func Exprs(toks []Token) []Expr {
+	var out []Expr
+	for _, t := range toks {
+		if !t.Literal {
+			out = append(out, t.Expr)
+		}
+	}
+	return out
+}
+
+// Renderer renders expressions to MathML with the KaTeX CLI, through a
+// cache.
+type Renderer struct {
+	// Command runs the KaTeX CLI; the output options are appended.
+	Command []string
+	// Cache maps a key of the command and the expression to its MathML.
+	Cache map[string]string
+	used  map[string]bool
+}
+
+// LoadRenderer returns a renderer running command with the cache at path.
+// A missing cache is empty.
+func LoadRenderer(command []string, path string) (*Renderer, error) {
+	r := &Renderer{Command: command, Cache: map[string]string{}, used: map[string]bool{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &r.Cache); err != nil {
+		return nil, fmt.Errorf("math: %s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *Renderer) key(e Expr) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %t %s", r.Command, e.Display, e.TeX)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Render returns e as MathML.
+func (r *Renderer) Render(ctx context.Context, e Expr) (string, error) {
+	k := r.key(e)
+	r.used[k] = true
+	if out, ok := r.Cache[k]; ok {
+		return out, nil
+	}
+	args := append(slices.Clone(r.Command[1:]), "--format", "mathml")
+	if e.Display {
+		args = append(args, "--display-mode")
+	}
+	cmd := exec.CommandContext(ctx, r.Command[0], args...)
+	cmd.Stdin = strings.NewReader(e.TeX)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", fmt.Errorf("math: %q: %w", e.TeX, err)
+	}
+	r.Cache[k] = strings.TrimSpace(string(out))
+	return r.Cache[k], nil
+}
+
+// RenderAll renders exprs in order, stopping at the first error.
+func (r *Renderer) RenderAll(ctx context.Context, exprs []Expr) ([]string, error) {
+	out := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		m, err := r.Render(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// Save writes the cache to path, dropping the expressions no post uses
+// anymore.
+func (r *Renderer) Save(path string) error {
+	for k := range r.Cache {
+		if !r.used[k] {
+			delete(r.Cache, k)
+		}
+	}
+	b, err := json.MarshalIndent(r.Cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
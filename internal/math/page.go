@@ -0,0 +1,209 @@
+package math
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ContentClass is the class of the element holding a post's body in the
+// theme's single page layout. Only dollar signs inside it are counted.
+const ContentClass = "post-content"
+
+// skip are the elements whose text isn't prose: code, which Scan skips
+// too, and math that's already rendered.
+var skip = map[atom.Atom]bool{
+	atom.Code: true, atom.Pre: true, atom.Script: true, atom.Style: true,
+	atom.Textarea: true, atom.Math: true,
+}
+
+// dollar is a dollar sign in a text node.
+type dollar struct {
+	n   *html.Node
+	off int
+}
+
+// Rewrite replaces each expression among toks, from the TeX between its
+// dollar signs to the closing ones, with its MathML: mathml[i] is the
+// markup of the ith expression. A page whose dollar signs don't add up to
+// toks is an error and is left alone.
+func Rewrite(root *html.Node, toks []Token, mathml []string) error {
+	var dollars []dollar
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			for off := 0; ; off++ {
+				i := strings.IndexByte(n.Data[off:], '$')
+				if i < 0 {
+					break
+				}
+				off += i
+				dollars = append(dollars, dollar{n, off})
+			}
+		case n.Type == html.ElementNode && skip[n.DataAtom]:
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	want := 0
+	for _, t := range toks {
+		want += t.Dollars()
+	}
+	if len(dollars) != want {
+		return fmt.Errorf("math: %d dollar sign(s) in the page, %d in the post", len(dollars), want)
+	}
+
+	type span struct {
+		from, to dollar
+		mathml   string
+	}
+	var spans []span
+	i, e := 0, 0
+	for _, t := range toks {
+		if !t.Literal {
+			spans = append(spans, span{dollars[i], dollars[i+t.Dollars()-1], mathml[e]})
+			e++
+		}
+		i += t.Dollars()
+	}
+	// Last first, so splitting a text node keeps the offsets of the dollar
+	// signs before it valid.
+	for _, s := range slices.Backward(spans) {
+		if err := replace(root, s.from, s.to, s.mathml); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emphasis are the elements goldmark makes of the markdown delimiters
+// that TeX uses too, like * and ~.
+var emphasis = map[atom.Atom]bool{atom.Em: true, atom.Strong: true, atom.Del: true}
+
+// replace swaps the page from the dollar sign at from up to and including
+// the one at to for markup. Emphasis that opens or closes inside the span
+// was read out of the TeX, so it's unwrapped; other elements the span only
+// partly covers are kept with what's outside it.
+func replace(root *html.Node, from, to dollar, markup string) error {
+	var artifacts []*html.Node
+	for _, pair := range [][2]*html.Node{{from.n, to.n}, {to.n, from.n}} {
+		for n := pair[0].Parent; n != nil && !contains(n, pair[1]); n = n.Parent {
+			if emphasis[n.DataAtom] {
+				artifacts = append(artifacts, n)
+			}
+		}
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(markup), from.n.Parent)
+	if err != nil {
+		return err
+	}
+	rest := &html.Node{Type: html.TextNode, Data: to.n.Data[to.off+1:]}
+	if from.n == to.n {
+		from.n.Parent.InsertBefore(rest, from.n.NextSibling)
+	} else {
+		to.n.Data = rest.Data
+		var order []*html.Node
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			order = append(order, n)
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(root)
+		start, end := slices.Index(order, from.n), slices.Index(order, to.n)
+		removed := map[*html.Node]bool{}
+		for _, n := range order[start+1 : end] {
+			if removed[n.Parent] {
+				removed[n] = true
+				continue
+			}
+			if !contains(n, to.n) {
+				n.Parent.RemoveChild(n)
+				removed[n] = true
+			}
+		}
+	}
+	from.n.Data = from.n.Data[:from.off]
+	next := from.n.NextSibling
+	for _, n := range nodes {
+		from.n.Parent.InsertBefore(n, next)
+	}
+	for _, n := range artifacts {
+		unwrap(n)
+	}
+	return nil
+}
+
+// unwrap replaces n with its children.
+func unwrap(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = n.FirstChild {
+		n.RemoveChild(c)
+		n.Parent.InsertBefore(c, n)
+	}
+	n.Parent.RemoveChild(n)
+}
+
+func contains(n, desc *html.Node) bool {
+	for ; desc != nil; desc = desc.Parent {
+		if desc == n {
+			return true
+		}
+	}
+	return false
+}
+
+// content returns the element holding the post's body, or nil.
+func content(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode && slices.Contains(strings.Fields(attrVal(n, "class")), ContentClass) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := content(c); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attrVal(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// RewritePage applies Rewrite to the post body of a whole page, as Hugo
+// built it. It returns page as is when toks holds no math or the page has
+// none left to render.
+func RewritePage(page []byte, toks []Token, mathml []string) ([]byte, error) {
+	if len(mathml) == 0 || bytes.Contains(page, []byte("<math")) {
+		return page, nil
+	}
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	body := content(doc)
+	if body == nil {
+		return nil, fmt.Errorf("math: no .%s element", ContentClass)
+	}
+	if err := Rewrite(body, toks, mathml); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
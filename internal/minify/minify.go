@@ -0,0 +1,224 @@
+// Package minify minifies the built site's HTML, stylesheets, scripts,
+// SVG, JSON, and XML in place with tdewolff/minify, the minifier Hugo uses,
+// after blogctl's rewrites have re-rendered the pages, and reports the
+// site's weight by type, raw and as gzip and brotli would send it, so a
+// change that bloats the pages shows up in the build log.
+package minify
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	mjson "github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+	"github.com/tdewolff/minify/v2/xml"
+
+	"github.com/rednafi/rednafi.com/internal/fingerprint"
+)
+
+// Types maps the extensions of the files that are minified and weighed to
+// their type's name in Options and the report.
+var Types = map[string]string{
+	".html": "html",
+	".css":  "css",
+	".js":   "js",
+	".mjs":  "js",
+	".svg":  "svg",
+	".json": "json",
+	".xml":  "xml",
+}
+
+var mediaTypes = map[string]string{
+	"html": "text/html",
+	"css":  "text/css",
+	"js":   "application/javascript",
+	"svg":  "image/svg+xml",
+	"json": "application/json",
+	"xml":  "text/xml",
+}
+
+// Options turns minifying each type on or off, by its name in Types. Files
+// of a type that's off are still weighed.
+type Options map[string]bool
+
+// New returns a minifier for the types opts turns on. Inline styles,
+// scripts, and JSON-LD in pages are minified along with their type.
+func New(opts Options) *minify.M {
+	m := minify.New()
+	if opts["html"] {
+		// Hugo's defaults, which the theme's markup is built for.
+		m.Add("text/html", &html.Minifier{
+			KeepDefaultAttrVals: true,
+			KeepDocumentTags:    true,
+			KeepEndTags:         true,
+			KeepSpecialComments: true,
+		})
+	}
+	if opts["css"] {
+		m.AddFunc("text/css", css.Minify)
+	}
+	if opts["js"] {
+		m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), js.Minify)
+		m.AddFunc("module", js.Minify)
+	}
+	if opts["svg"] {
+		m.AddFunc("image/svg+xml", svg.Minify)
+	}
+	if opts["json"] {
+		m.AddFuncRegexp(regexp.MustCompile(`^application/([a-z+.-]+\+)?json$`), mjson.Minify)
+	}
+	if opts["xml"] {
+		m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/([a-z+.-]+\+)?xml$`), xml.Minify)
+	}
+	return m
+}
+
+// Size is the weight of a set of files, in bytes. Gzip and Brotli are
+// estimates of what's sent compressed, at each library's default level.
+type Size struct {
+	Files  int   `json:"files"`
+	Before int64 `json:"before"`
+	After  int64 `json:"after"`
+	Gzip   int64 `json:"gzip"`
+	Brotli int64 `json:"brotli"`
+}
+
+func (s *Size) add(o Size) {
+	s.Files += o.Files
+	s.Before += o.Before
+	s.After += o.After
+	s.Gzip += o.Gzip
+	s.Brotli += o.Brotli
+}
+
+// Report is the weight of a built site by type, and in total.
+type Report struct {
+	Types map[string]*Size `json:"types"`
+	Total Size             `json:"total"`
+	// Minified is the number of files that got smaller.
+	Minified int `json:"minified"`
+}
+
+// Run minifies the files under dir with m and weighs them. Fingerprinted
+// files are only weighed, since their names are hashes of their contents.
+func Run(dir string, m *minify.M) (*Report, error) {
+	rep := &Report{Types: map[string]*Size{}}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		typ, ok := Types[strings.ToLower(path.Ext(d.Name()))]
+		if !ok {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		out := b
+		if !fingerprint.Hashed(filepath.ToSlash(p)) {
+			var buf bytes.Buffer
+			err := m.Minify(mediaTypes[typ], &buf, bytes.NewReader(b))
+			switch {
+			case errors.Is(err, minify.ErrNotExist):
+				// The type is off.
+			case err != nil:
+				return fmt.Errorf("minify: %s: %w", p, err)
+			case buf.Len() < len(b):
+				out = buf.Bytes()
+				if err := os.WriteFile(p, out, 0o644); err != nil {
+					return err
+				}
+				rep.Minified++
+			}
+		}
+		s := rep.Types[typ]
+		if s == nil {
+			s = &Size{}
+			rep.Types[typ] = s
+		}
+		w, err := weigh(b, out)
+		if err != nil {
+			return err
+		}
+		s.add(w)
+		rep.Total.add(w)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func weigh(before, after []byte) (Size, error) {
+	s := Size{Files: 1, Before: int64(len(before)), After: int64(len(after))}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(after); err != nil {
+		return s, err
+	}
+	if err := gz.Close(); err != nil {
+		return s, err
+	}
+	s.Gzip = int64(buf.Len())
+	buf.Reset()
+	br := brotli.NewWriter(&buf)
+	if _, err := br.Write(after); err != nil {
+		return s, err
+	}
+	if err := br.Close(); err != nil {
+		return s, err
+	}
+	s.Brotli = int64(buf.Len())
+	return s, nil
+}
+
+// Names returns the report's types in order.
+func (r *Report) Names() []string {
+	names := make([]string, 0, len(r.Types))
+	for t := range r.Types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadReport reads a report saved by Save. A missing report is nil.
+func LoadReport(path string) (*Report, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("minify: %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Save writes the report to path, for the next build to compare against.
+func (r *Report) Save(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
@@ -0,0 +1,129 @@
+// Package newpost scaffolds a post: a slug from the title, tags suggested
+// from the ones the site already uses, and front matter rendered from a
+// template.
+package newpost
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+// DefaultTemplate is the template new posts are rendered from. It's a Go
+// text/template that receives a Post, rather than a Hugo archetype, so it
+// can fill in the slug and tags.
+const DefaultTemplate = "archetypes/new.md"
+
+// Post is what the template receives.
+type Post struct {
+	Title   string
+	Date    time.Time
+	Slug    string
+	Section string
+	Tags    []string
+}
+
+// Path returns the new post's path relative to the content directory:
+// <section>/<date>-<slug>.md. The date prefix keeps drafts in order on
+// disk; the slug in the front matter keeps it out of the URL.
+func (p Post) Path() string {
+	return path.Join(p.Section, p.Date.Format(time.DateOnly)+"-"+p.Slug+".md")
+}
+
+// Slugify turns a title into a slug the front matter lint accepts:
+// lowercase ASCII letters and digits separated by underscores, as the
+// existing posts' file names are. Apostrophes are dropped, so "Python's"
+// becomes "pythons".
+func Slugify(title string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r == '\'' || r == '’':
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if sep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			sep = false
+			b.WriteRune(r)
+		default:
+			sep = true
+		}
+	}
+	return b.String()
+}
+
+// SuggestTags returns the tags the site already uses, or their aliases,
+// that appear as whole words in title, most used first.
+func SuggestTags(title string, posts []*content.Post, aliases tags.Aliases) []string {
+	used := map[string]int{}
+	for _, p := range posts {
+		for _, t := range aliases.Normalize(p.Tags) {
+			used[t]++
+		}
+	}
+	// Every spelling that should become a tag: its own and its aliases'.
+	spellings := map[string]string{}
+	for t := range used {
+		spellings[strings.ToLower(t)] = t
+	}
+	for alias, t := range aliases {
+		spellings[alias] = t
+	}
+
+	words := " " + strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`,:;!?()"`, r)
+	}), " ") + " "
+	words = strings.NewReplacer("'s ", " ", "’s ", " ").Replace(words)
+	found := map[string]bool{}
+	for s, t := range spellings {
+		if strings.Contains(words, " "+s+" ") {
+			found[t] = true
+		}
+	}
+	out := make([]string, 0, len(found))
+	for t := range found {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if used[out[i]] != used[out[j]] {
+			return used[out[i]] > used[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// Render executes the template at tmplPath for p. Templates can use the
+// yaml function to quote a value for YAML front matter.
+func Render(tmplPath string, p Post) ([]byte, error) {
+	b, err := os.ReadFile(tmplPath)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(path.Base(tmplPath)).Funcs(template.FuncMap{"yaml": yamlScalar}).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("newpost: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, p); err != nil {
+		return nil, fmt.Errorf("newpost: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func yamlScalar(s string) (string, error) {
+	b, err := yaml.Marshal(s)
+	return strings.TrimSuffix(string(b), "\n"), err
+}
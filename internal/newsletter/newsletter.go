@@ -0,0 +1,184 @@
+// Package newsletter renders a digest of the posts published since the last
+// issue and delivers it as a Buttondown draft or over SMTP.
+package newsletter
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// DefaultStatePath records the watermark of the last issue.
+const DefaultStatePath = "data/newsletter.json"
+
+// State is the newsletter's progress.
+type State struct {
+	// LastPost is the publish date of the newest post in the last issue.
+	// The next issue covers posts published after it.
+	LastPost  time.Time `json:"last_post"`
+	LastIssue time.Time `json:"last_issue"`
+	Subject   string    `json:"subject,omitempty"`
+}
+
+// LoadState reads the state at path. A missing file yields the zero state.
+func LoadState(path string) (State, error) {
+	var s State
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("newsletter: parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the state to path.
+func (s State) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Post is a digest entry.
+type Post struct {
+	Title   string
+	URL     string
+	Date    time.Time
+	Tags    []string
+	Summary string
+}
+
+// Digest is the data the template renders.
+type Digest struct {
+	Subject   string
+	Intro     string
+	SiteTitle string
+	SiteURL   string
+	Posts     []Post
+}
+
+// Newest returns the publish date of the digest's newest post.
+func (d Digest) Newest() time.Time {
+	var t time.Time
+	for _, p := range d.Posts {
+		if p.Date.After(t) {
+			t = p.Date
+		}
+	}
+	return t
+}
+
+// summaryLen caps summaries taken from the post body, in runes.
+const summaryLen = 280
+
+// Collect builds a digest of the published articles dated after since,
+// oldest first so the email reads in order. Notes are left out.
+func Collect(cfg *site.Config, posts []*content.Post, since time.Time) Digest {
+	d := Digest{SiteTitle: cfg.Title, SiteURL: cfg.Permalink("/")}
+	published := content.Articles(content.Published(posts))
+	for i := len(published) - 1; i >= 0; i-- {
+		p := published[i]
+		if !p.Date.After(since) {
+			continue
+		}
+		d.Posts = append(d.Posts, Post{
+			Title:   p.Title,
+			URL:     cfg.Permalink(p.RelPermalink()),
+			Date:    p.Date,
+			Tags:    p.Tags,
+			Summary: summarize(p),
+		})
+	}
+	switch len(d.Posts) {
+	case 0:
+	case 1:
+		d.Subject = d.Posts[0].Title
+	default:
+		d.Subject = fmt.Sprintf("%d new posts on %s", len(d.Posts), cfg.Title)
+	}
+	return d
+}
+
+// summarize returns the post's description or summary, falling back to the
+// first paragraph of its prose.
+func summarize(p *content.Post) string {
+	for _, s := range []string{p.Description, p.Summary} {
+		if s = strings.TrimSpace(s); s != "" {
+			return s
+		}
+	}
+	text := markdown.Parse([]byte(p.Body), p.BodyLine).PlainText(false)
+	for _, para := range strings.Split(text, "\n") {
+		if para = strings.TrimSpace(para); para != "" {
+			r := []rune(para)
+			if len(r) <= summaryLen {
+				return para
+			}
+			cut := string(r[:summaryLen])
+			if i := strings.LastIndexByte(cut, ' '); i > 0 {
+				cut = cut[:i]
+			}
+			return cut + "…"
+		}
+	}
+	return ""
+}
+
+//go:embed digest.html
+var defaultTemplate string
+
+// Template parses the digest template at path, or the built-in one if path
+// is empty. The template gets a Digest and has a join function.
+func Template(path string) (*template.Template, error) {
+	src := defaultTemplate
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src = string(b)
+	}
+	return template.New("digest").Funcs(template.FuncMap{"join": strings.Join}).Parse(src)
+}
+
+// Render executes t with d.
+func Render(t *template.Template, d Digest) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// PlainText renders d as the text/plain alternative of the email.
+func PlainText(d Digest) string {
+	var b strings.Builder
+	if d.Intro != "" {
+		b.WriteString(d.Intro + "\n\n")
+	}
+	for _, p := range d.Posts {
+		fmt.Fprintf(&b, "%s\n%s\n", p.Title, p.URL)
+		if p.Summary != "" {
+			b.WriteString("\n" + p.Summary + "\n")
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "-- \n%s\n%s\n", d.SiteTitle, d.SiteURL)
+	return b.String()
+}
@@ -0,0 +1,170 @@
+package newsletter
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sender delivers an issue.
+type Sender interface {
+	// Send delivers the issue and returns a short description of where it
+	// went, e.g. the draft's ID.
+	Send(ctx context.Context, subject, html, text string) (string, error)
+}
+
+// Buttondown creates issues as drafts in Buttondown, to be reviewed and sent
+// from its dashboard.
+type Buttondown struct {
+	HTTP   *http.Client
+	APIKey string
+}
+
+// ButtondownFromEnv configures Buttondown from BUTTONDOWN_API_KEY.
+func ButtondownFromEnv() (*Buttondown, error) {
+	k := os.Getenv("BUTTONDOWN_API_KEY")
+	if k == "" {
+		return nil, errors.New("newsletter: BUTTONDOWN_API_KEY is not set")
+	}
+	return &Buttondown{APIKey: k}, nil
+}
+
+// Send implements Sender.
+func (b *Buttondown) Send(ctx context.Context, subject, html, _ string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"subject": subject,
+		"body":    html,
+		"status":  "draft",
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, "https://api.buttondown.email/v1/emails", bytes.NewReader(body),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+b.APIKey)
+	client := b.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("newsletter: buttondown: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("newsletter: buttondown: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("newsletter: buttondown: decode response: %w", err)
+	}
+	return "buttondown draft " + out.ID, nil
+}
+
+// SMTP mails the issue as multipart/alternative HTML and plain text, with
+// every recipient blind-copied.
+type SMTP struct {
+	// Addr is host:port. STARTTLS is used when the server offers it.
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// SMTPFromEnv configures SMTP from SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD,
+// SMTP_FROM, and SMTP_TO (comma-separated).
+func SMTPFromEnv() (*SMTP, error) {
+	s := &SMTP{
+		Addr:     os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	for _, to := range strings.Split(os.Getenv("SMTP_TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			s.To = append(s.To, to)
+		}
+	}
+	if s.Addr == "" || s.From == "" || len(s.To) == 0 {
+		return nil, errors.New("newsletter: SMTP_ADDR, SMTP_FROM, and SMTP_TO must be set")
+	}
+	return s, nil
+}
+
+// Send implements Sender.
+func (s *SMTP) Send(_ context.Context, subject, html, text string) (string, error) {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return "", fmt.Errorf("newsletter: smtp: %w", err)
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	msg, err := s.message(subject, html, text)
+	if err != nil {
+		return "", err
+	}
+	if err := smtp.SendMail(s.Addr, auth, s.From, s.To, msg); err != nil {
+		return "", fmt.Errorf("newsletter: smtp: %w", err)
+	}
+	return fmt.Sprintf("mailed to %d recipient(s)", len(s.To)), nil
+}
+
+func (s *SMTP) message(subject, html, text string) ([]byte, error) {
+	var rnd [12]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return nil, err
+	}
+	boundary := "digest-" + hex.EncodeToString(rnd[:])
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	// Recipients only appear in the envelope, so subscribers don't see
+	// each other's addresses.
+	fmt.Fprintf(&b, "To: %s\r\n", s.From)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ typ, body string }{
+		{"text/plain", text},
+		{"text/html", html},
+	} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=utf-8\r\n", part.typ)
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		w := quotedprintable.NewWriter(&b)
+		if _, err := w.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
@@ -0,0 +1,72 @@
+// Package notes scaffolds notes, the short title-less posts under
+// content/notes/, and turns them into the plain text that stands in for a
+// title in feeds and cross-posts.
+package notes
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Note is a new note.
+type Note struct {
+	Date  time.Time
+	Tags  []string
+	Draft bool
+	// Body is the note's markdown.
+	Body string
+}
+
+// Path returns the note's path relative to the content directory:
+// notes/<date>-<hhmm>.md, which is also its slug. Notes have no title to
+// derive a slug from, and the minute keeps a day's notes apart.
+func (n Note) Path() string {
+	return path.Join(content.NotesSection, n.Date.Format("2006-01-02-1504")+".md")
+}
+
+// Render returns the note's file: YAML front matter with the date, to the
+// second since notes are ordered by it, then the body.
+func (n Note) Render() ([]byte, error) {
+	fm, err := yaml.Marshal(struct {
+		Date  time.Time `yaml:"date"`
+		Tags  []string  `yaml:"tags,omitempty"`
+		Draft bool      `yaml:"draft,omitempty"`
+	}{n.Date.Truncate(time.Second), n.Tags, n.Draft})
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	b.Write(fm)
+	b.WriteString("---\n\n")
+	b.WriteString(strings.TrimSpace(n.Body))
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// Text returns the note's prose as one line of plain text.
+func Text(p *content.Post) string {
+	return strings.Join(strings.Fields(markdown.Parse([]byte(p.Body), p.BodyLine).PlainText(false)), " ")
+}
+
+// Excerpt returns at most n characters of the note's text, cut at a word
+// and marked with an ellipsis if it's longer.
+func Excerpt(p *content.Post, n int) string {
+	s := Text(p)
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	cut := string([]rune(s)[:n-1])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
@@ -0,0 +1,236 @@
+// Package ogimage renders Open Graph social cards for posts.
+//
+// A card is a PNG with the post title, date, and tags laid out according to
+// a Template. The fonts are the Go fonts shipped with golang.org/x/image, so
+// cards render the same on every machine without any system fonts.
+package ogimage
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Template controls the size, palette, and typography of a card. Colors are
+// hex strings like "#1d1e20".
+type Template struct {
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Padding    int     `json:"padding"`
+	Background string  `json:"background"`
+	Foreground string  `json:"foreground"`
+	Muted      string  `json:"muted"`
+	Accent     string  `json:"accent"`
+	SiteName   string  `json:"site_name"`
+	TitleSize  float64 `json:"title_size"`
+	MetaSize   float64 `json:"meta_size"`
+	DateFormat string  `json:"date_format"`
+	// MaxTitleLines caps how many lines the title may wrap to. The title
+	// font shrinks until it fits.
+	MaxTitleLines int `json:"max_title_lines"`
+}
+
+// DefaultTemplate is the 1200x630 card used across the site.
+var DefaultTemplate = Template{
+	Width:         1200,
+	Height:        630,
+	Padding:       80,
+	Background:    "#ffffff",
+	Foreground:    "#1e1e1e",
+	Muted:         "#6c6c6c",
+	Accent:        "#d35400",
+	SiteName:      "Redowan's Reflections",
+	TitleSize:     68,
+	MetaSize:      30,
+	DateFormat:    "January 2, 2006",
+	MaxTitleLines: 4,
+}
+
+// LoadTemplate reads a JSON template from path. Fields missing from the file
+// fall back to DefaultTemplate.
+func LoadTemplate(path string) (Template, error) {
+	t := DefaultTemplate
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return t, fmt.Errorf("ogimage: parse template %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Card is the post data printed on a social card.
+type Card struct {
+	Title string
+	Date  time.Time
+	Tags  []string
+}
+
+// Render draws c using t and encodes it as PNG to w.
+func Render(w io.Writer, t Template, c Card) error {
+	img, err := Draw(t, c)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// Draw lays c out on a new image according to t.
+func Draw(t Template, c Card) (*image.RGBA, error) {
+	bg, err := parseHex(t.Background)
+	if err != nil {
+		return nil, err
+	}
+	fg, err := parseHex(t.Foreground)
+	if err != nil {
+		return nil, err
+	}
+	muted, err := parseHex(t.Muted)
+	if err != nil {
+		return nil, err
+	}
+	accent, err := parseHex(t.Accent)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, t.Width, t.Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	bar := image.Rect(0, 0, t.Padding/4, t.Height)
+	draw.Draw(img, bar, image.NewUniform(accent), image.Point{}, draw.Src)
+
+	meta, err := newFace(goregular.TTF, t.MetaSize)
+	if err != nil {
+		return nil, err
+	}
+	defer meta.Close()
+
+	textWidth := t.Width - 2*t.Padding
+	title, lines, err := fitTitle(c.Title, t.TitleSize, textWidth, t.MaxTitleLines)
+	if err != nil {
+		return nil, err
+	}
+	defer title.Close()
+
+	// Site name sits at the top, metadata at the bottom, and the title is
+	// vertically centered in the space between them.
+	top := t.Padding + lineHeight(meta)
+	writeLine(img, meta, accent, t.Padding, top, t.SiteName)
+
+	titleHeight := len(lines) * lineHeight(title)
+	bottom := t.Height - t.Padding
+	y := top + (bottom-lineHeight(meta)-top-titleHeight)/2 + lineHeight(title)
+	for _, l := range lines {
+		writeLine(img, title, fg, t.Padding, y, l)
+		y += lineHeight(title)
+	}
+
+	var parts []string
+	if !c.Date.IsZero() {
+		parts = append(parts, c.Date.Format(t.DateFormat))
+	}
+	if len(c.Tags) > 0 {
+		tags := make([]string, len(c.Tags))
+		for i, tag := range c.Tags {
+			tags[i] = "#" + strings.ToLower(strings.ReplaceAll(tag, " ", "-"))
+		}
+		parts = append(parts, strings.Join(tags, " "))
+	}
+	writeLine(img, meta, muted, t.Padding, bottom, strings.Join(parts, "  ·  "))
+	return img, nil
+}
+
+// fitTitle wraps s to width, shrinking the font until it fits in maxLines.
+func fitTitle(s string, size float64, width, maxLines int) (font.Face, []string, error) {
+	for ; ; size -= 4 {
+		face, err := newFace(gobold.TTF, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		lines := wrap(face, s, width)
+		if len(lines) <= maxLines || size <= 24 {
+			return face, lines, nil
+		}
+		face.Close()
+	}
+}
+
+// wrap breaks s into lines no wider than width pixels. A single word wider
+// than width gets a line of its own.
+func wrap(face font.Face, s string, width int) []string {
+	var lines []string
+	var cur string
+	for _, word := range strings.Fields(s) {
+		next := word
+		if cur != "" {
+			next = cur + " " + word
+		}
+		if cur != "" && font.MeasureString(face, next).Ceil() > width {
+			lines = append(lines, cur)
+			cur = word
+			continue
+		}
+		cur = next
+	}
+	if cur != "" {
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+func writeLine(img draw.Image, face font.Face, c color.Color, x, y int, s string) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
+
+func lineHeight(face font.Face) int {
+	return face.Metrics().Height.Ceil()
+}
+
+func newFace(ttf []byte, size float64) (font.Face, error) {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("ogimage: parse font: %w", err)
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// parseHex parses "#rgb" or "#rrggbb".
+func parseHex(s string) (color.RGBA, error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	if len(h) != 6 {
+		return color.RGBA{}, fmt.Errorf("ogimage: invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("ogimage: invalid color %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
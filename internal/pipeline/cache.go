@@ -0,0 +1,268 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCache is where `blogctl build` remembers each stage's last
+// successful run.
+const DefaultCache = ".pipeline-cache.json"
+
+// GoSource is the code the stages run with blogctl or go run are built
+// from. It's hashed along with the inputs they declare, so a change to a
+// package reruns the stages without each listing what it imports. Tests
+// don't change what a stage writes.
+var GoSource = []string{"go.mod", "go.sum", "cmd/**/*.go", "internal/**/*.go", "!**/*_test.go"}
+
+// Cache is each stage's last successful run, by name.
+type Cache map[string]Entry
+
+// Entry is a stage's last successful run: the hash of its inputs, and the
+// files its outputs matched after it, which must all still be there for
+// it to be skipped.
+type Entry struct {
+	Hash    string   `json:"hash"`
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// LoadCache reads the cache at path, empty if there's none yet. A cache
+// from before the outputs were recorded is empty too, so every stage runs
+// once more.
+func LoadCache(path string) (Cache, error) {
+	c := Cache{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) {
+			return Cache{}, nil
+		}
+		return nil, fmt.Errorf("pipeline: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Save writes c to path.
+func (c Cache) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Files returns the files under root the patterns match, sorted, as
+// slash-separated paths relative to root. A pattern starting with ! leaves
+// out the files it matches, whatever the others match.
+func Files(root string, patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+	var exclude []string
+	for _, p := range patterns {
+		if rest, ok := strings.CutPrefix(p, "!"); ok {
+			exclude = append(exclude, path.Clean(strings.TrimPrefix(rest, "./")))
+			continue
+		}
+		p = path.Clean(strings.TrimPrefix(p, "./"))
+		base := literalPrefix(p)
+		err := filepath.WalkDir(filepath.Join(root, filepath.FromSlash(base)), func(abs string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, abs)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == p || strings.HasPrefix(rel, p+"/") || Match(p, rel) {
+				seen[rel] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	files := make([]string, 0, len(seen))
+	for f := range seen {
+		if !slices.ContainsFunc(exclude, func(p string) bool { return covers(p, f) }) {
+			files = append(files, f)
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// covers reports whether pattern matches name or a directory it's in.
+func covers(pattern, name string) bool {
+	return name == pattern || strings.HasPrefix(name, pattern+"/") || Match(pattern, name)
+}
+
+// literalPrefix is the directories of pattern before its first wildcard,
+// which are all that need walking.
+func literalPrefix(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[") {
+			return path.Join(parts[:i]...)
+		}
+	}
+	return pattern
+}
+
+// Match reports whether the slash-separated name matches pattern, where
+// ** matches any number of directories and the rest is as path.Match.
+func Match(pattern, name string) bool {
+	return matchParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Hasher hashes stages' inputs under Root, remembering each file's hash
+// while its size and modification time stay the same, so inputs shared by
+// several stages are read once.
+type Hasher struct {
+	Root string
+
+	mu    sync.Mutex
+	files map[string]fileHash
+}
+
+type fileHash struct {
+	size int64
+	mod  time.Time
+	sum  string
+}
+
+// Hash returns the hash of s's command and the contents of its inputs,
+// GoSource included when s runs Go, or "" if it declares none.
+func (h *Hasher) Hash(s Stage) (string, error) {
+	if len(s.Inputs) == 0 {
+		return "", nil
+	}
+	inputs := s.Inputs
+	if runsGo(s.Run) {
+		inputs = append(slices.Clip(inputs), GoSource...)
+	}
+	files, err := Files(h.Root, inputs)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\x00", s.Run)
+	for _, f := range files {
+		fh, err := h.file(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(sum, "%s\x00%s\x00", f, fh)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func (h *Hasher) file(rel string) (string, error) {
+	abs := filepath.Join(h.Root, filepath.FromSlash(rel))
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	h.mu.Lock()
+	fh, ok := h.files[rel]
+	h.mu.Unlock()
+	if ok && fh.size == info.Size() && fh.mod.Equal(info.ModTime()) {
+		return fh.sum, nil
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	fh = fileHash{size: info.Size(), mod: info.ModTime(), sum: hex.EncodeToString(sum.Sum(nil))}
+	h.mu.Lock()
+	if h.files == nil {
+		h.files = map[string]fileHash{}
+	}
+	h.files[rel] = fh
+	h.mu.Unlock()
+	return fh.sum, nil
+}
+
+// runsGo reports whether run is built from the repository's Go code: a
+// blogctl command or go run.
+func runsGo(run string) bool {
+	name, _, _ := strings.Cut(strings.TrimSpace(run), " ")
+	return name == "blogctl" || strings.HasPrefix(run, "go run ")
+}
+
+// Present reports whether s's outputs are as its last run left them: each
+// one without a wildcard matches a file, and every file they matched then
+// is still there. It names the first that isn't.
+func Present(root string, s Stage, last []string) (bool, string, error) {
+	for _, o := range s.Outputs {
+		if strings.ContainsAny(o, "*?[") {
+			// A glob, like a translation's feeds, may rightly match none.
+			continue
+		}
+		files, err := Files(root, []string{o})
+		if err != nil {
+			return false, "", err
+		}
+		if len(files) == 0 {
+			return false, o, nil
+		}
+	}
+	for _, f := range last {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(f))); errors.Is(err, fs.ErrNotExist) {
+			return false, f, nil
+		} else if err != nil {
+			return false, "", err
+		}
+	}
+	return true, "", nil
+}
@@ -0,0 +1,183 @@
+// Package pipeline runs the build as a graph of stages, declared in
+// data/pipeline.toml. A stage names the stages it needs, which finish
+// before it starts, and the files it reads and writes; stages whose needs
+// are met run in parallel. A stage whose inputs hash the same as when it
+// last succeeded, and whose outputs are all there, is skipped, so fixing a
+// typo doesn't redo the image variants, the snippet tests, and the Open
+// Graph cards.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultConfig is where `blogctl build` reads the stages from.
+const DefaultConfig = "data/pipeline.toml"
+
+// Stage is a step of the build.
+type Stage struct {
+	Name string `toml:"name"`
+	// Run is the shell command that does the work.
+	Run string `toml:"run"`
+	// Needs are the stages that finish before this one starts.
+	Needs []string `toml:"needs"`
+	// Inputs and Outputs are the files the stage reads and writes, as
+	// slash-separated paths or globs; ** matches any number of
+	// directories, a directory stands for everything under it, and a
+	// leading ! leaves out what the rest match. A stage reading another's
+	// outputs lists them among its inputs.
+	Inputs  []string `toml:"inputs"`
+	Outputs []string `toml:"outputs"`
+	// Always runs the stage even when its inputs haven't changed, for
+	// stages that read the network or rewrite their own inputs. A stage
+	// without inputs always runs too.
+	Always bool `toml:"always"`
+	// Optional stages may fail without failing the build, and the stages
+	// needing them still run.
+	Optional bool `toml:"optional"`
+}
+
+// Config is the stages of the build.
+type Config struct {
+	Stages []Stage `toml:"stage"`
+}
+
+// Load reads the stages at path and checks they form a graph: names are
+// unique, needs exist, and nothing needs itself, however indirectly.
+func Load(path string) (Config, error) {
+	var c Config
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := toml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("pipeline: %s: %w", path, err)
+	}
+	if err := c.check(); err != nil {
+		return c, fmt.Errorf("pipeline: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c Config) check() error {
+	names := map[string]bool{}
+	for i, s := range c.Stages {
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("stage %d has no name", i+1)
+		case names[s.Name]:
+			return fmt.Errorf("stage %q is declared twice", s.Name)
+		case strings.TrimSpace(s.Run) == "":
+			return fmt.Errorf("stage %q has nothing to run", s.Name)
+		}
+		names[s.Name] = true
+	}
+	for _, s := range c.Stages {
+		for _, n := range s.Needs {
+			if !names[n] {
+				return fmt.Errorf("stage %q needs %q, which isn't a stage", s.Name, n)
+			}
+		}
+	}
+	_, err := c.Order()
+	return err
+}
+
+// Stage returns the stage named name.
+func (c Config) Stage(name string) (Stage, bool) {
+	i := slices.IndexFunc(c.Stages, func(s Stage) bool { return s.Name == name })
+	if i < 0 {
+		return Stage{}, false
+	}
+	return c.Stages[i], true
+}
+
+// Order returns the stages in waves: each wave's needs are all in the
+// waves before it, so its stages can run at once. Within a wave, stages
+// keep the order they're declared in.
+func (c Config) Order() ([][]Stage, error) {
+	done := map[string]bool{}
+	var waves [][]Stage
+	for len(done) < len(c.Stages) {
+		var wave []Stage
+		for _, s := range c.Stages {
+			if !done[s.Name] && !slices.ContainsFunc(s.Needs, func(n string) bool { return !done[n] }) {
+				wave = append(wave, s)
+			}
+		}
+		if len(wave) == 0 {
+			var stuck []string
+			for _, s := range c.Stages {
+				if !done[s.Name] {
+					stuck = append(stuck, s.Name)
+				}
+			}
+			return nil, errors.New("stages need each other in a cycle: " + strings.Join(stuck, ", "))
+		}
+		for _, s := range wave {
+			done[s.Name] = true
+		}
+		waves = append(waves, wave)
+	}
+	return waves, nil
+}
+
+// Select returns c cut down to the stages named and the ones they need,
+// however indirectly.
+func (c Config) Select(names []string) (Config, error) {
+	want := map[string]bool{}
+	var add func(string) error
+	add = func(name string) error {
+		if want[name] {
+			return nil
+		}
+		s, ok := c.Stage(name)
+		if !ok {
+			return fmt.Errorf("pipeline: no stage %q", name)
+		}
+		want[name] = true
+		for _, n := range s.Needs {
+			if err := add(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, n := range names {
+		if err := add(n); err != nil {
+			return Config{}, err
+		}
+	}
+	var out Config
+	for _, s := range c.Stages {
+		if want[s.Name] {
+			out.Stages = append(out.Stages, s)
+		}
+	}
+	return out, nil
+}
+
+// Dot returns the graph in Graphviz's dot language, an edge from each
+// stage to the ones needing it.
+func (c Config) Dot() string {
+	var b strings.Builder
+	b.WriteString("digraph pipeline {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	for _, s := range c.Stages {
+		attrs := ""
+		if s.Optional {
+			attrs = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "\t%q%s;\n", s.Name, attrs)
+		for _, n := range s.Needs {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", n, s.Name)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Statuses of a stage after a build.
+const (
+	Ran     = "ran"
+	Skipped = "skipped"
+	Failed  = "failed"
+	// Blocked stages didn't run because a stage failed first.
+	Blocked = "blocked"
+)
+
+// Result is what became of a stage.
+type Result struct {
+	Stage  Stage
+	Status string
+	// Reason says why the stage ran or was skipped.
+	Reason string
+	Output []byte
+	Err    error
+	Dur    time.Duration
+
+	// hash is the stage's inputs', and outputs the files its outputs
+	// matched after it ran, cached once it succeeds.
+	hash    string
+	outputs []string
+}
+
+// Runner runs the stages of a Config.
+type Runner struct {
+	// Root is the directory inputs and outputs are relative to.
+	Root string
+	// Jobs is how many stages may run at once, at least one.
+	Jobs int
+	// Cache is read to skip stages and updated as they succeed.
+	Cache Cache
+	// Force runs the stages it names whatever their inputs; ForceAll
+	// runs every stage.
+	Force    []string
+	ForceAll bool
+	// DryRun decides what would run without running anything.
+	DryRun bool
+	// Exec runs a stage's command and returns its output.
+	Exec func(ctx context.Context, s Stage) ([]byte, error)
+	// Done, if set, is called as each stage finishes, one at a time.
+	Done func(Result)
+
+	hasher Hasher
+	mu     sync.Mutex
+}
+
+// Run runs c's stages, each once its needs are done, and returns what
+// became of them in the order they're declared. It stops starting stages
+// once one that isn't optional fails, and returns an error naming it.
+func (r *Runner) Run(ctx context.Context, c Config) ([]Result, error) {
+	if r.Cache == nil {
+		r.Cache = Cache{}
+	}
+	r.hasher.Root = r.Root
+	waiting := map[string]int{}
+	needed := map[string][]string{}
+	var ready []Stage
+	for _, s := range c.Stages {
+		waiting[s.Name] = len(s.Needs)
+		for _, n := range s.Needs {
+			needed[n] = append(needed[n], s.Name)
+		}
+		if len(s.Needs) == 0 {
+			ready = append(ready, s)
+		}
+	}
+
+	results := map[string]Result{}
+	done := make(chan Result)
+	var running int
+	var failed []string
+	for {
+		for running < max(r.Jobs, 1) && len(ready) > 0 && len(failed) == 0 && ctx.Err() == nil {
+			s := ready[0]
+			ready = ready[1:]
+			running++
+			go func() { done <- r.stage(ctx, s) }()
+		}
+		if running == 0 {
+			break
+		}
+		res := <-done
+		running--
+		results[res.Stage.Name] = res
+		if !r.DryRun {
+			r.mu.Lock()
+			switch {
+			case res.Status == Failed:
+				delete(r.Cache, res.Stage.Name)
+			case res.Status == Ran && res.hash != "":
+				r.Cache[res.Stage.Name] = Entry{Hash: res.hash, Outputs: res.outputs}
+			}
+			r.mu.Unlock()
+		}
+		if r.Done != nil {
+			r.Done(res)
+		}
+		if res.Status == Failed && !res.Stage.Optional {
+			failed = append(failed, res.Stage.Name)
+			continue
+		}
+		for _, name := range needed[res.Stage.Name] {
+			if waiting[name]--; waiting[name] == 0 {
+				s, _ := c.Stage(name)
+				ready = append(ready, s)
+			}
+		}
+	}
+
+	out := make([]Result, 0, len(c.Stages))
+	for _, s := range c.Stages {
+		res, ok := results[s.Name]
+		if !ok {
+			res = Result{Stage: s, Status: Blocked, Reason: "an earlier stage failed"}
+			if err := ctx.Err(); err != nil {
+				res.Reason = err.Error()
+			}
+		}
+		out = append(out, res)
+	}
+	if len(failed) > 0 {
+		return out, fmt.Errorf("pipeline: %s failed", failed[0])
+	}
+	return out, ctx.Err()
+}
+
+// stage runs s unless its inputs are as they were when it last succeeded.
+func (r *Runner) stage(ctx context.Context, s Stage) Result {
+	res := Result{Stage: s}
+	hash, err := r.hasher.Hash(s)
+	if err != nil {
+		res.Status, res.Err = Failed, err
+		return res
+	}
+	res.hash = hash
+	run, reason, err := r.plan(s, hash)
+	res.Reason = reason
+	if err != nil {
+		res.Status, res.Err = Failed, err
+		return res
+	}
+	if !run || r.DryRun {
+		res.Status = Skipped
+		if run {
+			res.Status = Ran
+		}
+		return res
+	}
+
+	start := time.Now()
+	res.Output, res.Err = r.Exec(ctx, s)
+	res.Dur = time.Since(start)
+	res.Status = Ran
+	if res.Err == nil {
+		res.outputs, res.Err = Files(r.Root, s.Outputs)
+	}
+	if res.Err != nil {
+		res.Status = Failed
+	}
+	return res
+}
+
+// plan decides whether a stage with inputs hashing to hash runs, and why.
+func (r *Runner) plan(s Stage, hash string) (bool, string, error) {
+	r.mu.Lock()
+	cached := r.Cache[s.Name]
+	r.mu.Unlock()
+	switch {
+	case r.ForceAll || slices.Contains(r.Force, s.Name):
+		return true, "forced", nil
+	case s.Always:
+		return true, "always runs", nil
+	case hash == "":
+		return true, "no inputs declared", nil
+	case cached.Hash != hash:
+		return true, "inputs changed", nil
+	}
+	ok, missing, err := Present(r.Root, s, cached.Outputs)
+	if err != nil {
+		return false, "", err
+	}
+	if !ok {
+		return true, missing + " is missing", nil
+	}
+	return false, "unchanged", nil
+}
@@ -0,0 +1,247 @@
+package planet
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Post is an entry in a blog's feed.
+type Post struct {
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Published time.Time `json:"published"`
+	// Summary is the start of the entry's text, without markup.
+	Summary string `json:"summary,omitempty"`
+}
+
+// summaryLen is how many characters of a post's text its summary keeps.
+const summaryLen = 240
+
+// ParseFeed reads the posts out of an RSS 2.0, Atom, or JSON Feed
+// document, resolving their links against base, the feed's URL. Entries
+// without a link or a date are skipped.
+func ParseFeed(b []byte, base string) ([]Post, error) {
+	trimmed := bytes.TrimSpace(b)
+	var posts []Post
+	var err error
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		posts, err = parseJSONFeed(trimmed)
+	} else {
+		posts, err = parseXMLFeed(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	baseURL, _ := url.Parse(base)
+	var out []Post
+	for _, p := range posts {
+		if p.URL == "" || p.Published.IsZero() {
+			continue
+		}
+		if baseURL != nil {
+			if u, err := baseURL.Parse(strings.TrimSpace(p.URL)); err == nil {
+				p.URL = u.String()
+			}
+		}
+		p.Title = strings.TrimSpace(text(p.Title))
+		if p.Title == "" {
+			p.Title = p.URL
+		}
+		p.Summary = truncate(text(p.Summary), summaryLen)
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func parseXMLFeed(b []byte) ([]Post, error) {
+	type link struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	}
+	var doc struct {
+		XMLName xml.Name
+		// RSS
+		Items []struct {
+			Title string `xml:"title"`
+			// Items may add an atom:link next to their own.
+			Links []struct {
+				Value string `xml:",chardata"`
+			} `xml:"link"`
+			GUID        string `xml:"guid"`
+			PubDate     string `xml:"pubDate"`
+			Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+			Description string `xml:"description"`
+		} `xml:"channel>item"`
+		// Atom
+		Entries []struct {
+			Title     string `xml:"title"`
+			Links     []link `xml:"link"`
+			Published string `xml:"published"`
+			Updated   string `xml:"updated"`
+			Summary   string `xml:"summary"`
+			Content   string `xml:"content"`
+		} `xml:"entry"`
+	}
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	// Feeds declare all sorts of encodings; the ones that aren't UTF-8 are
+	// nearly always Latin-1 or a superset, close enough for titles.
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	dec.Strict = false
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("planet: feed: %w", err)
+	}
+	var posts []Post
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, it := range doc.Items {
+			var u string
+			for _, l := range it.Links {
+				if u = strings.TrimSpace(l.Value); u != "" {
+					break
+				}
+			}
+			if u == "" && strings.HasPrefix(it.GUID, "http") {
+				u = it.GUID
+			}
+			posts = append(posts, Post{Title: it.Title, URL: u, Published: parseDate(it.PubDate, it.Date), Summary: it.Description})
+		}
+	case "feed":
+		for _, e := range doc.Entries {
+			var u string
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					u = l.Href
+					break
+				}
+			}
+			summary := e.Summary
+			if summary == "" {
+				summary = e.Content
+			}
+			posts = append(posts, Post{Title: e.Title, URL: u, Published: parseDate(e.Published, e.Updated), Summary: summary})
+		}
+	default:
+		return nil, fmt.Errorf("planet: feed: <%s> isn't RSS or Atom", doc.XMLName.Local)
+	}
+	return posts, nil
+}
+
+func parseJSONFeed(b []byte) ([]Post, error) {
+	var doc struct {
+		Version string `json:"version"`
+		Items   []struct {
+			URL           string `json:"url"`
+			ExternalURL   string `json:"external_url"`
+			Title         string `json:"title"`
+			Summary       string `json:"summary"`
+			ContentText   string `json:"content_text"`
+			ContentHTML   string `json:"content_html"`
+			DatePublished string `json:"date_published"`
+			DateModified  string `json:"date_modified"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("planet: feed: %w", err)
+	}
+	if !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("planet: feed: %q isn't a JSON Feed version", doc.Version)
+	}
+	var posts []Post
+	for _, it := range doc.Items {
+		summary := it.Summary
+		for _, s := range []string{it.ContentText, it.ContentHTML} {
+			if summary == "" {
+				summary = s
+			}
+		}
+		u := it.URL
+		if u == "" {
+			u = it.ExternalURL
+		}
+		posts = append(posts, Post{Title: it.Title, URL: u, Published: parseDate(it.DatePublished, it.DateModified), Summary: summary})
+	}
+	return posts, nil
+}
+
+// dateLayouts are the date formats feeds use in practice, RFC 822 with
+// and without seconds and with named or numeric zones, and RFC 3339.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseDate returns the first of dates that parses, or the zero time.
+func parseDate(dates ...string) time.Time {
+	for _, d := range dates {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, d); err == nil {
+				return t.UTC()
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// text returns the text of s, an HTML fragment, with whitespace collapsed.
+func text(s string) string {
+	if !strings.ContainsAny(s, "<&") {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "script" || string(name) == "style" {
+				skip++
+			}
+			b.WriteByte(' ')
+		case html.EndTagToken:
+			if name, _ := z.TagName(); (string(name) == "script" || string(name) == "style") && skip > 0 {
+				skip--
+			}
+			b.WriteByte(' ')
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+		}
+	}
+}
+
+// truncate cuts s to at most n characters at a word boundary, marking the
+// cut with an ellipsis.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	cut := []rune(s)[:n]
+	if i := strings.LastIndexByte(string(cut), ' '); i > 0 {
+		return strings.TrimRight(string(cut)[:i], " ,.;:") + "…"
+	}
+	return string(cut) + "…"
+}
@@ -0,0 +1,178 @@
+package planet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultCache holds each feed's validators and last posts between runs.
+const DefaultCache = ".planet-cache.json"
+
+// UserAgent identifies the fetches to the blogs' servers.
+const UserAgent = "rednafi.com planet (+https://rednafi.com/planet/)"
+
+// Cached is what's kept of a feed: the validators for the next
+// conditional GET and the posts it had.
+type Cached struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Posts        []Post    `json:"posts"`
+}
+
+// Cache maps a feed URL to what's kept of it.
+type Cache map[string]Cached
+
+// LoadCache reads the cache at path. A missing or unreadable cache is
+// empty, so every feed is fetched in full.
+func LoadCache(path string) Cache {
+	c := Cache{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	if json.Unmarshal(b, &c) != nil {
+		return Cache{}
+	}
+	return c
+}
+
+// Save writes the cache to path, dropping the feeds no longer in blogs.
+func (c Cache) Save(path string, blogs []Blog) error {
+	keep := Cache{}
+	for _, b := range blogs {
+		if f, ok := c[b.FeedURL]; ok {
+			keep[b.FeedURL] = f
+		}
+	}
+	b, err := json.MarshalIndent(keep, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Result is how fetching a blog's feed went.
+type Result struct {
+	Blog Blog
+	// NotModified is set when the feed answered 304 and its cached posts
+	// were kept.
+	NotModified bool
+	Err         error
+}
+
+// Fetch fetches the blogs' feeds, up to jobs at a time, with conditional
+// GETs from the validators in c, and updates c with what changed. A feed
+// that fails keeps its cached posts; its Result says why.
+func Fetch(ctx context.Context, client *http.Client, blogs []Blog, c Cache, jobs int) []Result {
+	results := make([]Result, len(blogs))
+	var mu sync.Mutex
+	sem := make(chan struct{}, max(jobs, 1))
+	var wg sync.WaitGroup
+	for i, b := range blogs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			mu.Lock()
+			prev, had := c[b.FeedURL]
+			mu.Unlock()
+			next, notModified, err := fetch(ctx, client, b.FeedURL, prev, had)
+			results[i] = Result{Blog: b, NotModified: notModified, Err: err}
+			if err == nil {
+				mu.Lock()
+				c[b.FeedURL] = next
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func fetch(ctx context.Context, client *http.Client, feedURL string, prev Cached, had bool) (Cached, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return prev, false, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "application/atom+xml, application/rss+xml, application/feed+json, application/xml;q=0.9, */*;q=0.8")
+	if had {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return prev, false, err
+	}
+	defer resp.Body.Close()
+	now := time.Now().UTC()
+	if resp.StatusCode == http.StatusNotModified && had {
+		prev.Fetched = now
+		return prev, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return prev, false, fmt.Errorf("planet: %s: %s", feedURL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return prev, false, err
+	}
+	// Redirects moved the feed; relative links resolve against where it is.
+	posts, err := ParseFeed(b, resp.Request.URL.String())
+	if err != nil {
+		return prev, false, fmt.Errorf("%s: %w", feedURL, err)
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Published.After(posts[j].Published) })
+	return Cached{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      now,
+		Posts:        posts,
+	}, false, nil
+}
+
+// Entry is a post on the page, with the blog it's from.
+type Entry struct {
+	Blog    string `json:"blog"`
+	BlogURL string `json:"blog_url,omitempty"`
+	Post
+}
+
+// Recent returns the posts from the last days before now, newest first,
+// at most perBlog from any one blog and limit in all. Posts dated in the
+// future, which some feeds have, count as published now.
+func Recent(blogs []Blog, c Cache, now time.Time, days, perBlog, limit int) []Entry {
+	since := now.AddDate(0, 0, -days)
+	var entries []Entry
+	for _, b := range blogs {
+		n := 0
+		for _, p := range c[b.FeedURL].Posts {
+			if p.Published.After(now) {
+				p.Published = now
+			}
+			if p.Published.Before(since) || n == perBlog {
+				continue
+			}
+			entries = append(entries, Entry{Blog: b.Title, BlogURL: b.HTMLURL, Post: p})
+			n++
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Published.After(entries[j].Published) })
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
@@ -0,0 +1,131 @@
+// Package planet aggregates the blogs I follow, from an OPML blogroll,
+// into the "What I'm reading" page: each blog's feed is fetched with a
+// conditional GET, so unchanged feeds cost a 304, and cached between runs,
+// so a feed that's down keeps its last posts. The blogroll is also
+// exported as OPML for anyone who wants to follow the same blogs.
+package planet
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultBlogroll is the OPML file listing the blogs.
+const DefaultBlogroll = "data/blogroll.opml"
+
+// Blog is a blog in the blogroll.
+type Blog struct {
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url,omitempty"`
+	FeedURL string `json:"feed_url"`
+	// Category is the outline the blog is filed under, if any.
+	Category string `json:"category,omitempty"`
+}
+
+type outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []outline `xml:"outline"`
+}
+
+type opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title     string `xml:"title"`
+		OwnerName string `xml:"ownerName,omitempty"`
+		DocsURL   string `xml:"docs,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []outline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// ParseOPML reads the blogs out of an OPML document. Outlines without a
+// feed URL group the ones inside them; their text is the blogs' category.
+func ParseOPML(b []byte) ([]Blog, error) {
+	var doc opml
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("planet: opml: %w", err)
+	}
+	var blogs []Blog
+	seen := map[string]bool{}
+	var walk func(outlines []outline, category string)
+	walk = func(outlines []outline, category string) {
+		for _, o := range outlines {
+			if o.XMLURL == "" {
+				walk(o.Outlines, strings.TrimSpace(o.Text))
+				continue
+			}
+			if seen[o.XMLURL] {
+				continue
+			}
+			seen[o.XMLURL] = true
+			title := strings.TrimSpace(o.Title)
+			if title == "" {
+				title = strings.TrimSpace(o.Text)
+			}
+			blogs = append(blogs, Blog{Title: title, HTMLURL: o.HTMLURL, FeedURL: o.XMLURL, Category: category})
+		}
+	}
+	walk(doc.Body.Outlines, "")
+	if len(blogs) == 0 {
+		return nil, errors.New("planet: opml: no feeds")
+	}
+	return blogs, nil
+}
+
+// LoadOPML reads the blogroll at path.
+func LoadOPML(path string) ([]Blog, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	blogs, err := ParseOPML(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return blogs, nil
+}
+
+// ExportOPML returns the blogs as an OPML 2.0 document titled title, owned
+// by owner, grouped by category in the order the categories first appear.
+// It has no dateCreated, so an unchanged blogroll exports the same bytes.
+func ExportOPML(blogs []Blog, title, owner string) ([]byte, error) {
+	var doc opml
+	doc.Version = "2.0"
+	doc.Head.Title = title
+	doc.Head.OwnerName = owner
+	doc.Head.DocsURL = "http://opml.org/spec2.opml"
+	groups := map[string]int{}
+	for _, b := range blogs {
+		o := outline{Text: b.Title, Title: b.Title, Type: "rss", XMLURL: b.FeedURL, HTMLURL: b.HTMLURL}
+		if b.Category == "" {
+			doc.Body.Outlines = append(doc.Body.Outlines, o)
+			continue
+		}
+		i, ok := groups[b.Category]
+		if !ok {
+			i = len(doc.Body.Outlines)
+			groups[b.Category] = i
+			doc.Body.Outlines = append(doc.Body.Outlines, outline{Text: b.Category, Title: b.Category})
+		}
+		doc.Body.Outlines[i].Outlines = append(doc.Body.Outlines[i].Outlines, o)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+// Package playground shares the posts' runnable Go snippets on the Go
+// Playground, so the code block hook can link each one to a copy readers
+// can run and edit.
+package playground
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+// DefaultPath is where the render-codeblock hook reads share IDs from, as
+// site.Data.playground. It doubles as the cache that keeps unchanged
+// snippets from being uploaded again, so it's committed.
+const DefaultPath = "data/playground.json"
+
+// Shares maps the hash of a snippet's code, as computed by highlight.Hash,
+// to its Playground share ID.
+type Shares map[string]string
+
+// Load reads the shares at path. A missing file yields an empty map.
+func Load(path string) (Shares, error) {
+	s := Shares{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("playground: parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the shares to path.
+func (s Shares) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+var (
+	mainRe = regexp.MustCompile(`(?m)^package\s+main\b`)
+	funcRe = regexp.MustCompile(`(?m)^func\s+(main|Test\w*|Example\w*)\(`)
+)
+
+// Shareable reports whether b is a complete Go program or test file the
+// Playground can run. Blocks marked {playground=false} are left out.
+func Shareable(b snippet.Block) bool {
+	if b.Lang != "go" || b.Attrs["playground"] == "false" {
+		return false
+	}
+	return mainRe.MatchString(b.Code) && funcRe.MatchString(b.Code)
+}
+
+// URL returns the link to a shared snippet.
+func URL(id string) string {
+	return "https://go.dev/play/p/" + id
+}
+
+// Client uploads snippets to the Playground's share API.
+type Client struct {
+	HTTP *http.Client
+	// BaseURL defaults to https://play.golang.org.
+	BaseURL string
+}
+
+// Share uploads code and returns its share ID. The Playground derives the
+// ID from the content, so sharing the same code twice is harmless.
+func (c *Client) Share(ctx context.Context, code string) (string, error) {
+	base := c.BaseURL
+	if base == "" {
+		base = "https://play.golang.org"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/share", strings.NewReader(code+"\n"))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "rednafi.com-playground (+https://rednafi.com)")
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("playground: share: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if err != nil {
+		return "", fmt.Errorf("playground: share: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("playground: share: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	id := string(bytes.TrimSpace(body))
+	if id == "" || strings.ContainsAny(id, "/ <") {
+		return "", fmt.Errorf("playground: share: unexpected response %q", id)
+	}
+	return id, nil
+}
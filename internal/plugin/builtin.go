@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/ogimage"
+	"github.com/rednafi/rednafi.com/internal/related"
+	"github.com/rednafi/rednafi.com/internal/sidenote"
+)
+
+// Builtins are the plugins blogctl comes with, by name.
+var Builtins = map[string]Factory{
+	"related":   newRelated,
+	"ogimage":   newOGImage,
+	"sidenotes": newSidenotes,
+}
+
+// relatedPlugin collects each article's related articles into
+// Site.Data["related"] and emits them as data/related.json, the way
+// `blogctl related` does.
+type relatedPlugin struct {
+	Base
+	method related.Method
+	n      int
+	out    string
+}
+
+func newRelated(decode func(any) error) (Plugin, error) {
+	opts := struct {
+		Method string `toml:"method"`
+		N      int    `toml:"n"`
+		Out    string `toml:"out"`
+	}{string(related.TFIDF), 5, related.DefaultPath}
+	if err := decode(&opts); err != nil {
+		return nil, err
+	}
+	m, err := related.ParseMethod(opts.Method)
+	if err != nil {
+		return nil, err
+	}
+	return &relatedPlugin{method: m, n: opts.N, out: opts.Out}, nil
+}
+
+func (p *relatedPlugin) Collect(ctx context.Context, s *Site) error {
+	s.Data["related"] = related.Compute(s.Posts, p.method, p.n)
+	return nil
+}
+
+func (p *relatedPlugin) Emit(ctx context.Context, s *Site) ([]Artifact, error) {
+	rel, ok := s.Data["related"].(map[string][]string)
+	if !ok {
+		rel = related.Compute(s.Posts, p.method, p.n)
+	}
+	b, err := related.Encode(rel)
+	if err != nil {
+		return nil, err
+	}
+	return []Artifact{{Path: p.out, Data: b}}, nil
+}
+
+// ogimagePlugin emits an Open Graph card for each published article, the
+// way cmd/ogimage does.
+type ogimagePlugin struct {
+	Base
+	template ogimage.Template
+	out      string
+}
+
+func newOGImage(decode func(any) error) (Plugin, error) {
+	opts := struct {
+		Template string `toml:"template"`
+		Out      string `toml:"out"`
+	}{Out: "static/images/og"}
+	if err := decode(&opts); err != nil {
+		return nil, err
+	}
+	p := &ogimagePlugin{template: ogimage.DefaultTemplate, out: opts.Out}
+	if opts.Template != "" {
+		t, err := ogimage.LoadTemplate(opts.Template)
+		if err != nil {
+			return nil, err
+		}
+		p.template = t
+	}
+	return p, nil
+}
+
+func (p *ogimagePlugin) Emit(ctx context.Context, s *Site) ([]Artifact, error) {
+	var out []Artifact
+	for _, post := range content.Articles(content.Published(s.Posts)) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		card := ogimage.Card{Title: post.Title, Date: post.Date, Tags: post.Tags}
+		if err := ogimage.Render(&buf, p.template, card); err != nil {
+			return nil, fmt.Errorf("%s: %w", post.Path, err)
+		}
+		out = append(out, Artifact{Path: path.Join(p.out, post.Slug+".png"), Data: buf.Bytes()})
+	}
+	return out, nil
+}
+
+// sidenotesPlugin turns each built post's footnotes into sidenotes, the
+// way `blogctl sidenotes` does.
+type sidenotesPlugin struct{ Base }
+
+func newSidenotes(decode func(any) error) (Plugin, error) {
+	return sidenotesPlugin{}, decode(&struct{}{})
+}
+
+func (sidenotesPlugin) Transform(ctx context.Context, s *Site, p *Page) error {
+	out, _, err := sidenote.RewritePage(p.HTML, sidenote.Labels([]byte(p.Post.Body)))
+	if err != nil {
+		return err
+	}
+	p.HTML = out
+	return nil
+}
@@ -0,0 +1,185 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// An exec plugin is a command, run with sh from the repository root once
+// for each phase it takes part in, and for transform once per page. It
+// reads a request as JSON on stdin:
+//
+//	{"phase": "emit", "options": {...}, "site": {...}}
+//	{"phase": "transform", "options": {...}, "page": {"path": ..., "html": ..., "post": {...}}}
+//
+// where the site carries its title, base URL, posts, and the data the
+// plugins before it collected, and writes its reply as JSON on stdout:
+//
+//	{"data": ...}                                      for collect
+//	{"html": "..."}                                    for transform; none leaves the page alone
+//	{"artifacts": [{"path": "...", "data": "..."}]}    for emit; "base64" for binary data
+//
+// What it writes to stderr passes through, and exiting other than 0 fails
+// the build.
+type execPlugin struct {
+	name    string
+	command string
+	phases  []string
+	options map[string]any
+}
+
+func newExec(s Spec, decode func(any) error) (Plugin, error) {
+	p := &execPlugin{name: s.Name, command: s.Command, phases: s.Phases, options: map[string]any{}}
+	if len(p.phases) == 0 {
+		p.phases = []string{"emit"}
+	}
+	if err := decode(&p.options); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type execSite struct {
+	Title   string         `json:"title"`
+	BaseURL string         `json:"baseURL"`
+	Posts   []execPost     `json:"posts"`
+	Data    map[string]any `json:"data"`
+}
+
+type execPost struct {
+	Path        string         `json:"path"`
+	Section     string         `json:"section"`
+	Lang        string         `json:"lang,omitempty"`
+	Slug        string         `json:"slug"`
+	Permalink   string         `json:"permalink"`
+	Title       string         `json:"title"`
+	Date        time.Time      `json:"date"`
+	Lastmod     time.Time      `json:"lastmod,omitzero"`
+	Tags        []string       `json:"tags"`
+	Draft       bool           `json:"draft,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Params      map[string]any `json:"params"`
+	Body        string         `json:"body"`
+}
+
+type execPage struct {
+	Path string   `json:"path"`
+	HTML string   `json:"html"`
+	Post execPost `json:"post"`
+}
+
+type execRequest struct {
+	Phase   string         `json:"phase"`
+	Options map[string]any `json:"options"`
+	Site    *execSite      `json:"site,omitempty"`
+	Page    *execPage      `json:"page,omitempty"`
+}
+
+type execReply struct {
+	Data      any     `json:"data"`
+	HTML      *string `json:"html"`
+	Artifacts []struct {
+		Path   string `json:"path"`
+		Data   string `json:"data"`
+		Base64 string `json:"base64"`
+	} `json:"artifacts"`
+}
+
+func toExecPost(p *content.Post) execPost {
+	return execPost{
+		Path: p.Path, Section: p.Section, Lang: p.Lang, Slug: p.Slug, Permalink: p.RelPermalink(),
+		Title: p.Title, Date: p.Date, Lastmod: p.Lastmod, Tags: p.Tags, Draft: p.Draft,
+		Description: p.Description, Params: p.Params, Body: p.Body,
+	}
+}
+
+func toExecSite(s *Site) *execSite {
+	es := &execSite{Data: s.Data}
+	if s.Config != nil {
+		es.Title, es.BaseURL = s.Config.Title, s.Config.BaseURL
+	}
+	for _, p := range s.Posts {
+		es.Posts = append(es.Posts, toExecPost(p))
+	}
+	return es
+}
+
+func (p *execPlugin) Collect(ctx context.Context, s *Site) error {
+	if !slices.Contains(p.phases, "collect") {
+		return nil
+	}
+	reply, err := p.call(ctx, execRequest{Phase: "collect", Site: toExecSite(s)})
+	if err != nil {
+		return err
+	}
+	s.Data[p.name] = reply.Data
+	return nil
+}
+
+func (p *execPlugin) Transform(ctx context.Context, s *Site, page *Page) error {
+	if !slices.Contains(p.phases, "transform") {
+		return nil
+	}
+	reply, err := p.call(ctx, execRequest{Phase: "transform", Page: &execPage{
+		Path: page.Path, HTML: string(page.HTML), Post: toExecPost(page.Post),
+	}})
+	if err != nil {
+		return err
+	}
+	if reply.HTML != nil {
+		page.HTML = []byte(*reply.HTML)
+	}
+	return nil
+}
+
+func (p *execPlugin) Emit(ctx context.Context, s *Site) ([]Artifact, error) {
+	if !slices.Contains(p.phases, "emit") {
+		return nil, nil
+	}
+	reply, err := p.call(ctx, execRequest{Phase: "emit", Site: toExecSite(s)})
+	if err != nil {
+		return nil, err
+	}
+	var out []Artifact
+	for _, a := range reply.Artifacts {
+		data := []byte(a.Data)
+		if a.Base64 != "" {
+			if data, err = base64.StdEncoding.DecodeString(a.Base64); err != nil {
+				return nil, fmt.Errorf("%s: %w", a.Path, err)
+			}
+		}
+		out = append(out, Artifact{Path: a.Path, Data: data})
+	}
+	return out, nil
+}
+
+func (p *execPlugin) call(ctx context.Context, req execRequest) (execReply, error) {
+	var reply execReply
+	req.Options = p.options
+	in, err := json.Marshal(req)
+	if err != nil {
+		return reply, err
+	}
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", p.command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(in), &out, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return reply, fmt.Errorf("%s: %w", req.Phase, err)
+	}
+	if len(bytes.TrimSpace(out.Bytes())) == 0 {
+		return reply, nil
+	}
+	if err := json.Unmarshal(out.Bytes(), &reply); err != nil {
+		return reply, fmt.Errorf("%s: reply: %w", req.Phase, err)
+	}
+	return reply, nil
+}
@@ -0,0 +1,264 @@
+// Package plugin runs the build's steps that are plugins rather than
+// commands of their own. A plugin may Collect from the whole site, for the
+// plugins after it; Transform each built page; and Emit files into the
+// repository. data/plugins.toml names the plugins to run, in order, with
+// their options: one of Builtins, like related posts, Open Graph cards, or
+// sidenotes, or any command that reads the site as JSON and replies in
+// JSON, so a step can be added without touching blogctl.
+//
+// `blogctl plugins emit` runs before Hugo and `blogctl plugins transform`
+// after it; both collect first.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/site"
+	"github.com/rednafi/rednafi.com/internal/telemetry"
+)
+
+// DefaultConfig is the plugins `blogctl plugins` runs.
+const DefaultConfig = "data/plugins.toml"
+
+// Site is what plugins see of the site.
+type Site struct {
+	Config *site.Config
+	// Content is the content directory and Public the built site.
+	Content string
+	Public  string
+	// Posts are all the posts, drafts included.
+	Posts []*content.Post
+	// Data is what plugins have collected, by plugin name, for the ones
+	// after them.
+	Data map[string]any
+}
+
+// Page is a post's built page.
+type Page struct {
+	Post *content.Post
+	// Path is the page's file under Site.Public.
+	Path string
+	HTML []byte
+}
+
+// Artifact is a file a plugin emits.
+type Artifact struct {
+	// Path is slash-separated and relative to the repository root.
+	Path string
+	Data []byte
+}
+
+// Plugin is a step of the build. The site is loaded once for all of a
+// run's plugins; Collect runs for each plugin in order, then Transform for
+// each page or Emit once. Embed Base for the phases a plugin skips.
+type Plugin interface {
+	Collect(ctx context.Context, s *Site) error
+	Transform(ctx context.Context, s *Site, p *Page) error
+	Emit(ctx context.Context, s *Site) ([]Artifact, error)
+}
+
+// Base does nothing in every phase.
+type Base struct{}
+
+func (Base) Collect(context.Context, *Site) error            { return nil }
+func (Base) Transform(context.Context, *Site, *Page) error   { return nil }
+func (Base) Emit(context.Context, *Site) ([]Artifact, error) { return nil, nil }
+
+// Factory makes a plugin from its options, which decode decodes into a
+// struct or map the way toml.Unmarshal would.
+type Factory func(decode func(v any) error) (Plugin, error)
+
+// Spec is a plugin as data/plugins.toml declares it.
+type Spec struct {
+	Name string `toml:"name"`
+	// Command, if set, runs the plugin as a command; see execPlugin for
+	// what it reads and writes. Without it Name is one of the builtins.
+	Command string `toml:"command"`
+	// Phases are the phases Command takes part in, emit by default.
+	Phases []string `toml:"phases"`
+	// Disabled leaves the plugin out without deleting its options.
+	Disabled bool           `toml:"disabled"`
+	Options  toml.Primitive `toml:"options"`
+}
+
+// Config is the plugins to run, in order.
+type Config struct {
+	Plugins []Spec `toml:"plugin"`
+
+	path string
+	md   toml.MetaData
+}
+
+// Named is a plugin with the name it was declared by.
+type Named struct {
+	Name string
+	Plugin
+}
+
+// Load reads the plugins declared at path.
+func Load(path string) (Config, error) {
+	c := Config{path: path}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if c.md, err = toml.Decode(string(b), &c); err != nil {
+		return c, fmt.Errorf("plugin: %s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i, s := range c.Plugins {
+		switch {
+		case s.Name == "":
+			return c, fmt.Errorf("plugin: %s: plugin %d has no name", path, i+1)
+		case seen[s.Name]:
+			return c, fmt.Errorf("plugin: %s: plugin %q is declared twice", path, s.Name)
+		}
+		seen[s.Name] = true
+		for _, p := range s.Phases {
+			if p != "collect" && p != "transform" && p != "emit" {
+				return c, fmt.Errorf("plugin: %s: %s: unknown phase %q", path, s.Name, p)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Open makes the enabled plugins, looking the ones without a command up
+// in registry, and fails on options none of them read.
+func (c Config) Open(registry map[string]Factory) ([]Named, error) {
+	var out []Named
+	for _, s := range c.Plugins {
+		decode := func(v any) error { return c.md.PrimitiveDecode(s.Options, v) }
+		if s.Disabled {
+			// Its options are kept for when it's enabled again.
+			if err := decode(&map[string]any{}); err != nil {
+				return nil, fmt.Errorf("plugin: %s: %s: %w", c.path, s.Name, err)
+			}
+			continue
+		}
+		var (
+			p   Plugin
+			err error
+		)
+		if s.Command != "" {
+			p, err = newExec(s, decode)
+		} else if f, ok := registry[s.Name]; ok {
+			p, err = f(decode)
+		} else {
+			err = errors.New("no such plugin; give it a command to run one of your own")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("plugin: %s: %s: %w", c.path, s.Name, err)
+		}
+		out = append(out, Named{s.Name, p})
+	}
+	if keys := c.md.Undecoded(); len(keys) > 0 {
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = k.String()
+		}
+		return nil, fmt.Errorf("plugin: %s: unknown options %s", c.path, strings.Join(names, ", "))
+	}
+	return out, nil
+}
+
+// Collect runs each plugin's Collect in order.
+func Collect(ctx context.Context, plugins []Named, s *Site) error {
+	if s.Data == nil {
+		s.Data = map[string]any{}
+	}
+	for _, p := range plugins {
+		_, timer := telemetry.Start(ctx, p.Name+" collect")
+		err := p.Collect(ctx, s)
+		timer.End(err)
+		if err != nil {
+			return fmt.Errorf("plugin %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Transform passes the built page of each published post through every
+// plugin's Transform in order, and writes back the pages that changed,
+// returning their paths. Posts that weren't built are left out.
+func Transform(ctx context.Context, plugins []Named, s *Site) ([]string, error) {
+	_, timer := telemetry.Start(ctx, "transform")
+	var written []string
+	err := func() error {
+		for _, post := range content.Published(s.Posts) {
+			path := filepath.Join(s.Public, filepath.FromSlash(post.RelPermalink()), "index.html")
+			b, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			page := &Page{Post: post, Path: path, HTML: b}
+			for _, p := range plugins {
+				if err := p.Transform(ctx, s, page); err != nil {
+					return fmt.Errorf("plugin %s: %s: %w", p.Name, path, err)
+				}
+			}
+			if bytes.Equal(page.HTML, b) {
+				continue
+			}
+			if err := os.WriteFile(path, page.HTML, 0o644); err != nil {
+				return err
+			}
+			written = append(written, path)
+		}
+		return nil
+	}()
+	timer.End(err)
+	return written, err
+}
+
+// Emit gathers every plugin's artifacts and writes the ones that changed
+// under root, returning their paths. Two plugins may not emit the same
+// file.
+func Emit(ctx context.Context, plugins []Named, s *Site, root string) ([]string, error) {
+	from := map[string]string{}
+	var all []Artifact
+	for _, p := range plugins {
+		_, timer := telemetry.Start(ctx, p.Name+" emit")
+		as, err := p.Emit(ctx, s)
+		timer.End(err)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+		}
+		for _, a := range as {
+			if !filepath.IsLocal(filepath.FromSlash(a.Path)) {
+				return nil, fmt.Errorf("plugin %s: %s is outside the repository", p.Name, a.Path)
+			}
+			if other, ok := from[a.Path]; ok {
+				return nil, fmt.Errorf("plugin %s: %s is emitted by %s too", p.Name, a.Path, other)
+			}
+			from[a.Path] = p.Name
+		}
+		all = append(all, as...)
+	}
+
+	var written []string
+	for _, a := range all {
+		path := filepath.Join(root, filepath.FromSlash(a.Path))
+		wrote, err := fsutil.WriteIfChanged(path, a.Data)
+		if err != nil {
+			return written, err
+		}
+		if wrote {
+			written = append(written, path)
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,415 @@
+// Package podcast turns the posts with an `audio` front matter key into a
+// podcast: it probes each file's size and duration, writes an RSS feed of
+// them with the iTunes tags podcast apps read, and records the audio in
+// data/podcast.json for the audio partial's player.
+//
+// audio is a path under static/, like /audio/gc.mp3, or the URL of a file
+// hosted elsewhere, whose first megabyte is fetched to probe. A file
+// whose duration can't be read takes it from `duration`, as "1:02:03" or
+// seconds.
+package podcast
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// FeedName is the feed's file name at the site root.
+const FeedName = "podcast.xml"
+
+// DefaultData is where the audio partial reads the episodes from, as
+// site.Data.podcast.
+const DefaultData = "data/podcast.json"
+
+// Audio is an episode's file as the audio partial plays it.
+type Audio struct {
+	// Src is the front matter's audio, root-relative or absolute.
+	Src     string `json:"src"`
+	Type    string `json:"type"`
+	Bytes   int64  `json:"bytes"`
+	Seconds int    `json:"seconds"`
+	// Duration is Seconds as the player shows it, like "1:02:03".
+	Duration string `json:"duration"`
+}
+
+// Episode is a post with audio.
+type Episode struct {
+	Audio
+	Slug string
+	// ID is the permalink, or the post's `guid` if it pins one, as in the
+	// site's feeds.
+	ID          string
+	URL         string
+	Title       string
+	Summary     string
+	ContentHTML string
+	Published   time.Time
+	// Number and Season are the front matter's `episode` and `season`,
+	// zero if unset.
+	Number, Season int
+	Explicit       bool
+}
+
+// Build probes the audio of the published posts that have some and returns
+// them as episodes, newest first. static is the directory root-relative
+// audio paths are under; c fetches the rest.
+func Build(ctx context.Context, c *http.Client, cfg *site.Config, posts []*content.Post, static string) ([]Episode, error) {
+	var eps []Episode
+	for _, p := range content.Published(posts) {
+		src, _ := p.Params["audio"].(string)
+		if src = strings.TrimSpace(src); src == "" {
+			continue
+		}
+		a, err := probe(ctx, c, src, static, p.Params["duration"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Path, err)
+		}
+		body, err := markdown.Render([]byte(p.Body))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Path, err)
+		}
+		explicit, _ := p.Params["explicit"].(bool)
+		u := cfg.Permalink(p.RelPermalink())
+		id, _ := p.Params["guid"].(string)
+		eps = append(eps, Episode{
+			Audio:       a,
+			Slug:        p.Slug,
+			ID:          cmp.Or(id, u),
+			URL:         u,
+			Title:       p.Title,
+			Summary:     cmp.Or(p.Description, p.Summary),
+			ContentHTML: string(markdown.Absolutize(body, cfg.BaseURL)),
+			Published:   p.Date,
+			Number:      intParam(p.Params["episode"]),
+			Season:      intParam(p.Params["season"]),
+			Explicit:    explicit,
+		})
+	}
+	sort.SliceStable(eps, func(i, j int) bool { return eps[i].Published.After(eps[j].Published) })
+	return eps, nil
+}
+
+// probe reads the size, type, and duration of the audio at src. A set
+// duration is used instead of the probed one.
+func probe(ctx context.Context, c *http.Client, src, static string, duration any) (Audio, error) {
+	a := Audio{Src: src, Type: Types[strings.ToLower(path.Ext(strings.SplitN(src, "?", 2)[0]))]}
+	if a.Type == "" {
+		return a, fmt.Errorf("podcast: %s isn't an audio format podcast apps play", src)
+	}
+	set, err := parseDuration(duration)
+	if err != nil {
+		return a, err
+	}
+
+	var (
+		r    io.ReaderAt
+		size int64
+	)
+	if strings.HasPrefix(src, "/") {
+		f, err := os.Open(filepath.Join(static, filepath.FromSlash(src)))
+		if err != nil {
+			return a, err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return a, err
+		}
+		r, size = f, fi.Size()
+	} else {
+		b, total, err := fetch(ctx, c, src)
+		if err != nil {
+			return a, err
+		}
+		r, size = bytes.NewReader(b), total
+	}
+	a.Bytes = size
+
+	d := set
+	if d == 0 {
+		if d, err = Probe(r, size, src); err != nil {
+			return a, err
+		}
+	}
+	a.Seconds = int(d.Round(time.Second) / time.Second)
+	a.Duration = FormatDuration(a.Seconds)
+	return a, nil
+}
+
+// fetch returns the start of the remote file at u, enough to probe, and
+// its full size.
+func fetch(ctx context.Context, c *http.Client, u string) ([]byte, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Range", "bytes=0-"+strconv.Itoa(probeBytes-1))
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	var size int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-1048575/52428800
+		_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		size, err = strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("podcast: %s: no size in Content-Range %q", u, resp.Header.Get("Content-Range"))
+		}
+	case http.StatusOK:
+		// The server ignored the range; the whole file is coming.
+		size = resp.ContentLength
+	default:
+		return nil, 0, fmt.Errorf("podcast: %s: %s", u, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, probeBytes))
+	if err != nil {
+		return nil, 0, err
+	}
+	if size <= 0 {
+		return nil, 0, fmt.Errorf("podcast: %s: unknown size", u)
+	}
+	return b, size, nil
+}
+
+// parseDuration reads the front matter's duration: seconds, or "1:02:03"
+// and "45:10". Unset is zero.
+func parseDuration(v any) (time.Duration, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		var secs int
+		for _, part := range strings.Split(strings.TrimSpace(v), ":") {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("podcast: unrecognized duration %q", v)
+			}
+			secs = secs*60 + n
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	return 0, fmt.Errorf("podcast: unrecognized duration %v", v)
+}
+
+// formatDuration writes seconds as H:MM:SS, or M:SS under an hour.
+func FormatDuration(secs int) string {
+	h, m, s := secs/3600, secs/60%60, secs%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func intParam(v any) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// RSS encodes the episodes as an RSS 2.0 feed with the iTunes tags Apple
+// Podcasts and the apps that follow it require.
+func RSS(cfg *site.Config, eps []Episode, selfURL string) ([]byte, error) {
+	type enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	}
+	type guid struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+	type cdata struct {
+		Value string `xml:",cdata"`
+	}
+	type item struct {
+		Title       string    `xml:"title"`
+		Link        string    `xml:"link"`
+		GUID        guid      `xml:"guid"`
+		PubDate     string    `xml:"pubDate"`
+		Description string    `xml:"description,omitempty"`
+		Content     cdata     `xml:"content:encoded"`
+		Enclosure   enclosure `xml:"enclosure"`
+		Duration    int       `xml:"itunes:duration"`
+		Episode     int       `xml:"itunes:episode,omitempty"`
+		Season      int       `xml:"itunes:season,omitempty"`
+		EpisodeType string    `xml:"itunes:episodeType"`
+		Explicit    bool      `xml:"itunes:explicit"`
+	}
+	type href struct {
+		Href string `xml:"href,attr"`
+	}
+	type category struct {
+		Text string `xml:"text,attr"`
+	}
+	type owner struct {
+		Name  string `xml:"itunes:name"`
+		Email string `xml:"itunes:email,omitempty"`
+	}
+	type image struct {
+		URL   string `xml:"url"`
+		Title string `xml:"title"`
+		Link  string `xml:"link"`
+	}
+	type atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	}
+	type channel struct {
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Description   string    `xml:"description"`
+		Language      string    `xml:"language"`
+		LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+		AtomLink      atomLink  `xml:"atom:link"`
+		Image         *image    `xml:"image,omitempty"`
+		Author        string    `xml:"itunes:author"`
+		Owner         owner     `xml:"itunes:owner"`
+		ITunesImage   *href     `xml:"itunes:image,omitempty"`
+		Category      *category `xml:"itunes:category,omitempty"`
+		Explicit      bool      `xml:"itunes:explicit"`
+		Type          string    `xml:"itunes:type"`
+		Items         []item    `xml:"item"`
+	}
+	type rss struct {
+		XMLName   xml.Name `xml:"rss"`
+		Version   string   `xml:"version,attr"`
+		AtomNS    string   `xml:"xmlns:atom,attr"`
+		ContentNS string   `xml:"xmlns:content,attr"`
+		ITunesNS  string   `xml:"xmlns:itunes,attr"`
+		Channel   channel  `xml:"channel"`
+	}
+
+	pc := cfg.Params.Podcast
+	title := cmp.Or(pc.Title, cfg.Title)
+	ch := channel{
+		Title:       title,
+		Link:        cfg.Permalink("/"),
+		Description: cmp.Or(pc.Description, cfg.Params.Description),
+		Language:    cfg.LanguageCode,
+		AtomLink:    atomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+		Author:      cfg.Params.Author,
+		Owner:       owner{Name: cfg.Params.Author, Email: pc.Email},
+		Explicit:    pc.Explicit,
+		Type:        "episodic",
+	}
+	img := pc.Image
+	if img == "" && len(cfg.Params.Images) > 0 {
+		img = cfg.Params.Images[0]
+	}
+	if img != "" {
+		if strings.HasPrefix(img, "/") {
+			img = cfg.Permalink(img)
+		}
+		ch.Image = &image{URL: img, Title: title, Link: ch.Link}
+		ch.ITunesImage = &href{Href: img}
+	}
+	if pc.Category != "" {
+		ch.Category = &category{Text: pc.Category}
+	}
+	for _, e := range eps {
+		if ch.LastBuildDate == "" {
+			ch.LastBuildDate = e.Published.Format(time.RFC1123Z)
+		}
+		u := e.Src
+		if strings.HasPrefix(u, "/") {
+			u = cfg.Permalink(u)
+		}
+		ch.Items = append(ch.Items, item{
+			Title:       e.Title,
+			Link:        e.URL,
+			GUID:        guid{IsPermaLink: e.ID == e.URL, Value: e.ID},
+			PubDate:     e.Published.Format(time.RFC1123Z),
+			Description: e.Summary,
+			Content:     cdata{e.ContentHTML},
+			Enclosure:   enclosure{URL: u, Length: e.Bytes, Type: e.Type},
+			Duration:    e.Seconds,
+			Episode:     e.Number,
+			Season:      e.Season,
+			EpisodeType: "full",
+			Explicit:    e.Explicit || pc.Explicit,
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(rss{
+		Version:   "2.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		ITunesNS:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel:   ch,
+	}); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// Write writes the feed into dir, typically static/, and the episodes'
+// audio, by slug, to dataPath, skipping files whose contents are
+// unchanged, and returns the paths written.
+func Write(dir, dataPath string, cfg *site.Config, eps []Episode) ([]string, error) {
+	feed, err := RSS(cfg, eps, cfg.Permalink("/"+FeedName))
+	if err != nil {
+		return nil, err
+	}
+	audio := map[string]Audio{}
+	for _, e := range eps {
+		audio[e.Slug] = e.Audio
+	}
+	data, err := json.MarshalIndent(audio, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, f := range []struct {
+		path string
+		b    []byte
+	}{{filepath.Join(dir, FeedName), feed}, {dataPath, append(data, '\n')}} {
+		wrote, err := fsutil.WriteIfChanged(f.path, f.b)
+		if err != nil {
+			return written, err
+		}
+		if wrote {
+			written = append(written, f.path)
+		}
+	}
+	return written, nil
+}
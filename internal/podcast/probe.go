@@ -0,0 +1,169 @@
+package podcast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrUnprobed is returned for audio whose duration can't be read from its
+// first bytes; set `duration` in the post's front matter instead.
+var ErrUnprobed = errors.New("podcast: can't read the duration")
+
+// Types maps the audio extensions podcast apps play to the MIME type
+// their enclosures declare.
+var Types = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/x-m4a",
+	".mp4":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+}
+
+// probeBytes is how much of a file Probe reads: enough for MP3's first
+// frame behind a large ID3 tag, and for an M4A's moov atom when it's at
+// the front, as it is in files prepared for streaming.
+const probeBytes = 1 << 20
+
+// Probe reads the duration of the audio in r, size bytes long, whose file
+// name is name. It handles MP3, from the Xing or VBRI header of VBR files
+// and from the bitrate of CBR ones, and M4A or MP4, from the movie header.
+func Probe(r io.ReaderAt, size int64, name string) (time.Duration, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mp3":
+		b := make([]byte, min(size, probeBytes))
+		n, err := r.ReadAt(b, 0)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		return probeMP3(b[:n], size)
+	case ".m4a", ".mp4":
+		return probeMP4(r, size)
+	}
+	return 0, fmt.Errorf("%w of %s files", ErrUnprobed, path.Ext(name))
+}
+
+// Layer III bitrates in kbps by index, for MPEG-1 and for MPEG-2 and 2.5.
+var (
+	bitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	bitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+)
+
+func probeMP3(b []byte, size int64) (time.Duration, error) {
+	start := 0
+	if len(b) >= 10 && string(b[:3]) == "ID3" {
+		// The tag's size is syncsafe: seven bits to a byte.
+		start = 10 + (int(b[6])<<21 | int(b[7])<<14 | int(b[8])<<7 | int(b[9]))
+		if b[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+	for i := start; i+4 <= len(b); i++ {
+		if b[i] != 0xFF || b[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version := (b[i+1] >> 3) & 3 // 3 is MPEG-1, 2 MPEG-2, 0 MPEG-2.5
+		layer := (b[i+1] >> 1) & 3   // 1 is Layer III
+		bi, si := b[i+2]>>4, (b[i+2]>>2)&3
+		if version == 1 || layer != 1 || bi == 0 || bi == 15 || si == 3 {
+			continue
+		}
+		rate := [3]int{44100, 48000, 32000}[si]
+		bitrate := bitratesV1[bi]
+		samples := 1152
+		sideInfo := 32
+		mono := b[i+3]>>6 == 3
+		if mono {
+			sideInfo = 17
+		}
+		if version != 3 {
+			rate /= 2
+			if version == 0 {
+				rate /= 2
+			}
+			bitrate = bitratesV2[bi]
+			samples = 576
+			sideInfo = 17
+			if mono {
+				sideInfo = 9
+			}
+		}
+
+		// A VBR file says how many frames it has in its first one.
+		frames := 0
+		if x := i + 4 + sideInfo; x+12 <= len(b) && (string(b[x:x+4]) == "Xing" || string(b[x:x+4]) == "Info") {
+			if binary.BigEndian.Uint32(b[x+4:])&1 != 0 {
+				frames = int(binary.BigEndian.Uint32(b[x+8:]))
+			}
+		} else if v := i + 36; v+18 <= len(b) && string(b[v:v+4]) == "VBRI" {
+			frames = int(binary.BigEndian.Uint32(b[v+14:]))
+		}
+		if frames > 0 {
+			return time.Duration(float64(frames) * float64(samples) / float64(rate) * float64(time.Second)), nil
+		}
+		audio := size - int64(i)
+		return time.Duration(float64(audio) * 8 / float64(bitrate*1000) * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("%w: no MP3 frame", ErrUnprobed)
+}
+
+// probeMP4 reads the duration from the mvhd atom inside moov.
+func probeMP4(r io.ReaderAt, size int64) (time.Duration, error) {
+	moov, moovSize, err := findAtom(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhd, _, err := findAtom(r, moov, moov+moovSize, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	h := make([]byte, 32)
+	if _, err := r.ReadAt(h, mvhd); err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("%w: %v", ErrUnprobed, err)
+	}
+	var scale, dur uint64
+	if h[0] == 1 {
+		scale, dur = uint64(binary.BigEndian.Uint32(h[20:])), binary.BigEndian.Uint64(h[24:])
+	} else {
+		scale, dur = uint64(binary.BigEndian.Uint32(h[12:])), uint64(binary.BigEndian.Uint32(h[16:]))
+	}
+	if scale == 0 {
+		return 0, fmt.Errorf("%w: mvhd has no timescale", ErrUnprobed)
+	}
+	return time.Duration(float64(dur) / float64(scale) * float64(time.Second)), nil
+}
+
+// findAtom returns the offset and size of the body of the first atom
+// named typ between from and to.
+func findAtom(r io.ReaderAt, from, to int64, typ string) (int64, int64, error) {
+	h := make([]byte, 16)
+	for off := from; off+8 <= to; {
+		if _, err := r.ReadAt(h[:8], off); err != nil {
+			return 0, 0, fmt.Errorf("%w: %s: %v", ErrUnprobed, typ, err)
+		}
+		size, head := int64(binary.BigEndian.Uint32(h)), int64(8)
+		switch size {
+		case 0:
+			size = to - off
+		case 1:
+			if _, err := r.ReadAt(h[8:16], off+8); err != nil {
+				return 0, 0, fmt.Errorf("%w: %s: %v", ErrUnprobed, typ, err)
+			}
+			size, head = int64(binary.BigEndian.Uint64(h[8:])), 16
+		}
+		if size < head {
+			return 0, 0, fmt.Errorf("%w: bad atom at %d", ErrUnprobed, off)
+		}
+		if bytes.Equal(h[4:8], []byte(typ)) {
+			return off + head, size - head, nil
+		}
+		off += size
+	}
+	return 0, 0, fmt.Errorf("%w: no %s atom", ErrUnprobed, typ)
+}
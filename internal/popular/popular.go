@@ -0,0 +1,143 @@
+// Package popular ranks the posts by page views for the "Most read" lists.
+// Views are fetched a day at a time and cached, since a finished day's
+// numbers don't change and the analytics API is rate limited.
+package popular
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/redirects"
+)
+
+// DefaultPath is where templates read the rankings from, as
+// site.Data.popular.
+const DefaultPath = "data/popular.json"
+
+// DefaultCache holds the per-day views between runs.
+const DefaultCache = ".popular-cache.json"
+
+// Day is the views per path on one UTC day.
+type Day map[string]int
+
+// Cache maps a UTC date, YYYY-MM-DD, to its views. Only finished days are
+// stored.
+type Cache map[string]Day
+
+// LoadCache reads the cache at path. A missing or unreadable cache is
+// empty, which only costs a refetch.
+func LoadCache(path string) Cache {
+	c := Cache{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Cache{}
+	}
+	return c
+}
+
+// Save writes the cache to path.
+func (c Cache) Save(path string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// Prune drops the days before since.
+func (c Cache) Prune(since time.Time) {
+	cutoff := since.UTC().Format(time.DateOnly)
+	for d := range c {
+		if d < cutoff {
+			delete(c, d)
+		}
+	}
+}
+
+// Missing returns the finished days in the last n before now that aren't
+// cached, newest first.
+func (c Cache) Missing(now time.Time, n int) []time.Time {
+	today := now.UTC().Truncate(24 * time.Hour)
+	var out []time.Time
+	for i := 1; i <= n; i++ {
+		d := today.AddDate(0, 0, -i)
+		if _, ok := c[d.Format(time.DateOnly)]; !ok {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Entry is a post's views in a window.
+type Entry struct {
+	Slug  string `json:"slug"`
+	Views int    `json:"views"`
+}
+
+// Rank sums each published post's views over the last days finished days
+// before now, for each window in days, and returns the top n per window,
+// keyed by the window's length in days. Views of a redirected old URL
+// count toward the post it redirects to.
+func Rank(c Cache, posts []*content.Post, rs []redirects.Redirect, windows []int, now time.Time, n int) map[string][]Entry {
+	slugs := map[string]string{}
+	for _, p := range content.Published(posts) {
+		slugs[pathKey(p.RelPermalink())] = p.Slug
+	}
+	for _, r := range rs {
+		if slug, ok := slugs[pathKey(r.To)]; ok && r.Local() {
+			slugs[pathKey(r.From)] = slug
+		}
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	out := make(map[string][]Entry, len(windows))
+	for _, w := range windows {
+		views := map[string]int{}
+		for i := 1; i <= w; i++ {
+			for path, v := range c[today.AddDate(0, 0, -i).Format(time.DateOnly)] {
+				if slug, ok := slugs[pathKey(path)]; ok {
+					views[slug] += v
+				}
+			}
+		}
+		entries := make([]Entry, 0, len(views))
+		for slug, v := range views {
+			entries = append(entries, Entry{slug, v})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Views != entries[j].Views {
+				return entries[i].Views > entries[j].Views
+			}
+			return entries[i].Slug < entries[j].Slug
+		})
+		if len(entries) > n {
+			entries = entries[:n]
+		}
+		out[strconv.Itoa(w)] = entries
+	}
+	return out
+}
+
+// pathKey normalizes a request path to compare it with a permalink.
+func pathKey(p string) string {
+	p = strings.TrimSuffix(strings.ToLower(p), "index.html")
+	if p != "/" {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+// Write encodes the rankings to path, leaving the file alone if it's
+// unchanged. It reports whether it wrote.
+func Write(path string, ranks map[string][]Entry) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, ranks)
+}
@@ -0,0 +1,205 @@
+// Package postarchive builds the data the /archives/ page reads as
+// site.Data.post_archive: the published articles grouped by year and
+// month, newest first, with each year's post and word counts and a
+// sparkline of how often posts went out. The grouping and the sums are
+// done here rather than in the template.
+package postarchive
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/readtime"
+)
+
+// DefaultPath is where templates read the archive from, as
+// site.Data.post_archive.
+const DefaultPath = "data/post_archive.json"
+
+// Sparkline sizes, in the SVG's user units: a year's is a bar a month,
+// the site's a point a month for every month since the first post.
+const (
+	YearWidth   = 120
+	SiteWidth   = 600
+	SparkHeight = 24
+)
+
+// Archive is what gets written to DefaultPath.
+type Archive struct {
+	Posts int `json:"posts"`
+	Words int `json:"words"`
+	// First and Last are the dates of the oldest and newest posts.
+	First string `json:"first"`
+	Last  string `json:"last"`
+	// Sparkline counts the posts of every month from First to Last.
+	Sparkline Sparkline `json:"sparkline"`
+	Years     []Year    `json:"years"`
+}
+
+// Year is a year's posts.
+type Year struct {
+	Year  int `json:"year"`
+	Posts int `json:"posts"`
+	Words int `json:"words"`
+	// Sparkline counts the posts of each month, January first.
+	Sparkline Sparkline `json:"sparkline"`
+	Months    []Month   `json:"months"`
+}
+
+// Month is the posts of a month of a year, newest first.
+type Month struct {
+	// ID anchors the month on the page, as in "2023-04".
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Posts []Entry `json:"posts"`
+
+	month time.Month
+}
+
+// Entry is a post as the archive lists it.
+type Entry struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Date    string `json:"date"`
+	Words   int    `json:"words"`
+	Minutes int    `json:"minutes"`
+}
+
+// Sparkline is a run of counts, drawn ready for an SVG: Points for a
+// polyline and Bars for one rect each, both scaled to Width by
+// SparkHeight with the tallest count at the top.
+type Sparkline struct {
+	Counts []int `json:"counts"`
+	Max    int   `json:"max"`
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	// Step is the width of a month's slot, and of its bar short of a gap.
+	Step   float64 `json:"step"`
+	Points string  `json:"points"`
+	Bars   []Bar   `json:"bars"`
+}
+
+// Bar is a rect of a sparkline.
+type Bar struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Height float64 `json:"height"`
+	Count  int     `json:"count"`
+	// Label names the month the bar counts, as in "April 2023".
+	Label string `json:"label"`
+}
+
+// Build groups the published articles in posts, leaving out the notes,
+// with reading times at speed's pace.
+func Build(posts []*content.Post, speed readtime.Config) Archive {
+	var articles []*content.Post
+	for _, p := range content.Published(posts) {
+		if !p.IsNote() && !p.Date.IsZero() {
+			articles = append(articles, p)
+		}
+	}
+	slices.SortStableFunc(articles, func(a, b *content.Post) int { return b.Date.Compare(a.Date) })
+
+	var a Archive
+	if len(articles) == 0 {
+		return a
+	}
+	a.First = articles[len(articles)-1].Date.Format(time.DateOnly)
+	a.Last = articles[0].Date.Format(time.DateOnly)
+	first, last := monthOf(articles[len(articles)-1].Date), monthOf(articles[0].Date)
+	var months []time.Time
+	for m := first; !m.After(last); m = m.AddDate(0, 1, 0) {
+		months = append(months, m)
+	}
+	counts := make([]int, len(months))
+
+	for _, p := range articles {
+		est := speed.Post(p)
+		e := Entry{
+			Title:   p.Title,
+			URL:     p.RelPermalink(),
+			Date:    p.Date.Format(time.DateOnly),
+			Words:   est.Words,
+			Minutes: est.Minutes,
+		}
+		a.Posts++
+		a.Words += e.Words
+		counts[slices.Index(months, monthOf(p.Date))]++
+
+		if n := len(a.Years); n == 0 || a.Years[n-1].Year != p.Date.Year() {
+			a.Years = append(a.Years, Year{Year: p.Date.Year()})
+		}
+		y := &a.Years[len(a.Years)-1]
+		y.Posts++
+		y.Words += e.Words
+		id := p.Date.Format("2006-01")
+		if n := len(y.Months); n == 0 || y.Months[n-1].ID != id {
+			y.Months = append(y.Months, Month{ID: id, Name: p.Date.Month().String(), month: p.Date.Month()})
+		}
+		mo := &y.Months[len(y.Months)-1]
+		mo.Posts = append(mo.Posts, e)
+	}
+
+	labels := make([]string, len(months))
+	for i, m := range months {
+		labels[i] = m.Format("January 2006")
+	}
+	a.Sparkline = spark(counts, labels, SiteWidth)
+	for i := range a.Years {
+		y := &a.Years[i]
+		counts := make([]int, 12)
+		labels := make([]string, 12)
+		for m := range 12 {
+			labels[m] = fmt.Sprintf("%s %d", time.Month(m+1), y.Year)
+		}
+		for _, mo := range y.Months {
+			counts[mo.month-1] = len(mo.Posts)
+		}
+		y.Sparkline = spark(counts, labels, YearWidth)
+	}
+	return a
+}
+
+// monthOf is the first of t's month, in UTC.
+func monthOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// spark draws counts across width: a point at the middle of each slot
+// and a bar from its left edge.
+func spark(counts []int, labels []string, width int) Sparkline {
+	s := Sparkline{Counts: counts, Width: width, Height: SparkHeight, Bars: []Bar{}}
+	if len(counts) == 0 {
+		return s
+	}
+	s.Max = slices.Max(counts)
+	s.Step = round(float64(width) / float64(len(counts)))
+	var pts []string
+	for i, c := range counts {
+		h := 0.0
+		if s.Max > 0 {
+			h = round(float64(c) / float64(s.Max) * SparkHeight)
+		}
+		x := round(float64(i) * s.Step)
+		pts = append(pts, fmt.Sprintf("%g,%g", round(x+s.Step/2), round(SparkHeight-h)))
+		s.Bars = append(s.Bars, Bar{X: x, Y: round(SparkHeight - h), Height: h, Count: c, Label: labels[i]})
+	}
+	s.Points = strings.Join(pts, " ")
+	return s
+}
+
+// round keeps two decimals, plenty for an SVG and short in the JSON.
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// Write writes a to path as JSON, leaving the file alone if it wouldn't
+// change. It reports whether it wrote.
+func Write(path string, a Archive) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, a)
+}
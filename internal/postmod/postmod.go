@@ -0,0 +1,252 @@
+// Package postmod keeps the Go modules under code/<slug>/, the code that
+// goes with each post, tidy: every folder with Go files gets a go.mod of
+// its own, named after the post's slug, whose go mod tidy pins each
+// dependency in go.mod and go.sum. It also reports the dependencies whose
+// authors deprecated them, and, with govulncheck, the known
+// vulnerabilities the code reaches.
+package postmod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Dir is a post's code folder.
+type Dir struct {
+	// Slug is the post's, and the folder's name.
+	Slug string
+	Path string
+}
+
+// Dirs returns the folders under root with Go files in them, sorted by
+// slug. A missing root has none.
+func Dirs(root string) ([]Dir, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dirs []Dir
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, e.Name())
+		hasGo := false
+		err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(d.Name()) == ".go" {
+				hasGo = true
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if hasGo {
+			dirs = append(dirs, Dir{Slug: e.Name(), Path: dir})
+		}
+	}
+	return dirs, nil
+}
+
+// Options says what Tidy does besides go mod tidy.
+type Options struct {
+	// Upgrade moves every dependency to its latest version first, with
+	// go get -u.
+	Upgrade bool
+	// Govulncheck is the govulncheck command to scan with, or "" not to.
+	Govulncheck string
+}
+
+// Module is a dependency as go list -m reports it.
+type Module struct {
+	Path       string
+	Version    string
+	Deprecated string
+	Indirect   bool
+	Main       bool
+	// Update is the newest version, if it's newer than Version.
+	Update *struct{ Version string }
+}
+
+// Vuln is a known vulnerability in a dependency.
+type Vuln struct {
+	// ID is the Go vulnerability database's, like GO-2024-2687.
+	ID      string
+	Summary string
+	Module  string
+	Version string
+	// Fixed is the first version without it, or "" if none is yet.
+	Fixed string
+	// Called is set when the code reaches the vulnerable function, rather
+	// than only importing its package or requiring its module.
+	Called bool
+}
+
+// Report is what Tidy did to a folder and found in it.
+type Report struct {
+	Dir Dir
+	// Created is set when the folder had no go.mod, and Changed when
+	// go.mod or go.sum changed.
+	Created, Changed bool
+	Deprecated       []Module
+	// Updates are the dependencies with newer versions than they're
+	// pinned to.
+	Updates []Module
+	Vulns   []Vuln
+}
+
+// Tidy gives d a go.mod if it doesn't have one, tidies it, and reports on
+// its dependencies.
+func Tidy(ctx context.Context, d Dir, opts Options) (*Report, error) {
+	r := &Report{Dir: d}
+	before := modFiles(d.Path)
+	if before == nil {
+		if _, err := run(ctx, d.Path, "go", "mod", "init", d.Slug); err != nil {
+			return r, err
+		}
+		r.Created = true
+	}
+	if opts.Upgrade {
+		if _, err := run(ctx, d.Path, "go", "get", "-t", "-u", "./..."); err != nil {
+			return r, err
+		}
+	}
+	if _, err := run(ctx, d.Path, "go", "mod", "tidy"); err != nil {
+		return r, err
+	}
+	r.Changed = !r.Created && !bytes.Equal(before, modFiles(d.Path))
+
+	out, err := run(ctx, d.Path, "go", "list", "-m", "-u", "-json", "all")
+	if err != nil {
+		return r, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m Module
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return r, fmt.Errorf("postmod: go list: %w", err)
+		}
+		if m.Main {
+			continue
+		}
+		if m.Deprecated != "" {
+			r.Deprecated = append(r.Deprecated, m)
+		}
+		if m.Update != nil && !m.Indirect {
+			r.Updates = append(r.Updates, m)
+		}
+	}
+
+	if opts.Govulncheck != "" {
+		if r.Vulns, err = scan(ctx, d.Path, opts.Govulncheck); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// modFiles returns go.mod and go.sum in dir, concatenated, or nil if there
+// isn't a go.mod.
+func modFiles(dir string) []byte {
+	mod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil
+	}
+	sum, _ := os.ReadFile(filepath.Join(dir, "go.sum"))
+	return append(mod, sum...)
+}
+
+// run runs name with args in dir, with the local toolchain so that every
+// folder is tidied with the same one.
+func run(ctx context.Context, dir, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("postmod: %s %s: %w\n%s", filepath.Base(name), strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// scan runs govulncheck on dir and returns the vulnerabilities it found,
+// one per ID and module.
+func scan(ctx context.Context, dir, govulncheck string) ([]Vuln, error) {
+	out, err := run(ctx, dir, govulncheck, "-format", "json", "./...")
+	if err != nil {
+		return nil, err
+	}
+	// The output is a stream of messages, each with one field set.
+	type frame struct {
+		Module, Version, Function string
+	}
+	var msg struct {
+		OSV *struct {
+			ID      string
+			Summary string
+		}
+		Finding *struct {
+			OSV          string
+			FixedVersion string `json:"fixed_version"`
+			Trace        []frame
+		}
+	}
+	summaries := map[string]string{}
+	var vulns []Vuln
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		msg.OSV, msg.Finding = nil, nil
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("postmod: govulncheck: %w", err)
+		}
+		if msg.OSV != nil {
+			summaries[msg.OSV.ID] = msg.OSV.Summary
+		}
+		f := msg.Finding
+		if f == nil || len(f.Trace) == 0 {
+			continue
+		}
+		// The first frame is the vulnerable symbol, or only its module or
+		// package when the code doesn't reach it.
+		v := Vuln{
+			ID:      f.OSV,
+			Module:  f.Trace[0].Module,
+			Version: f.Trace[0].Version,
+			Fixed:   f.FixedVersion,
+			Called:  f.Trace[0].Function != "",
+		}
+		i := slices.IndexFunc(vulns, func(w Vuln) bool { return w.ID == v.ID && w.Module == v.Module })
+		if i < 0 {
+			vulns = append(vulns, v)
+		} else if v.Called {
+			vulns[i].Called = true
+		}
+	}
+	for i := range vulns {
+		vulns[i].Summary = summaries[vulns[i].ID]
+	}
+	return vulns, nil
+}
@@ -0,0 +1,246 @@
+// Package prose lints the writing in posts, the way Vale or write-good
+// would: sentences that run long, filler like "very" and "really", weasel
+// words that hedge a claim, a word typed twice, and passive voice once a
+// post leans on it. Only prose is read; code, quotes, headings, and
+// shortcodes are skipped.
+//
+// The word lists and limits come from data/prose.toml, and a post turns
+// rules off for itself in its front matter:
+//
+//	prose:
+//	  ignore: [passive-voice, weasel-words]
+//
+// or skips the linter altogether with prose: false.
+package prose
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Rules reported in Problem.Rule.
+const (
+	RulePassive        = "passive-voice"
+	RuleWeasel         = "weasel-words"
+	RuleRepeated       = "repeated-word"
+	RuleSentenceLength = "sentence-length"
+	RuleFiller         = "filler"
+)
+
+// Rules lists every rule.
+var Rules = []string{RulePassive, RuleWeasel, RuleRepeated, RuleSentenceLength, RuleFiller}
+
+// DefaultConfig is where the rules' settings live.
+const DefaultConfig = "data/prose.toml"
+
+// Config tunes the rules. A key missing from the file keeps its default.
+type Config struct {
+	// Disable turns rules off for every post.
+	Disable []string `toml:"disable"`
+	// MaxSentenceWords is the longest a sentence may run.
+	MaxSentenceWords int `toml:"max_sentence_words"`
+	// MaxPassive is the share of a post's sentences, from 0 to 1, that may
+	// be in the passive voice before each of them is reported.
+	MaxPassive float64 `toml:"max_passive"`
+	// Weasel and Filler are the words and phrases the two rules flag.
+	Weasel []string `toml:"weasel"`
+	Filler []string `toml:"filler"`
+}
+
+// Default returns the settings used when there's no config file.
+func Default() Config {
+	return Config{
+		MaxSentenceWords: 40,
+		MaxPassive:       0.15,
+		Weasel: []string{
+			"clearly", "completely", "exceedingly", "excellent", "extremely",
+			"fairly", "huge", "interestingly", "largely", "mostly", "quite",
+			"relatively", "remarkably", "significantly", "substantially",
+			"surprisingly", "tiny", "various", "vast",
+		},
+		Filler: []string{"very", "really", "actually", "basically", "literally", "totally"},
+	}
+}
+
+// LoadConfig reads the settings at path over the defaults. A missing file
+// is the defaults.
+func LoadConfig(path string) (Config, error) {
+	c := Default()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := toml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("prose: %s: %w", path, err)
+	}
+	for _, r := range c.Disable {
+		if !slices.Contains(Rules, r) {
+			return c, fmt.Errorf("prose: %s: unknown rule %q", path, r)
+		}
+	}
+	return c, nil
+}
+
+// Problem is a finding at a line and column of a post's file.
+type Problem struct {
+	Line, Col int
+	Rule      string
+	Msg       string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", p.Line, p.Col, p.Rule, p.Msg)
+}
+
+// Ignored returns the rules p's front matter turns off for it; prose:
+// false turns off all of them.
+func Ignored(p *content.Post) (map[string]bool, error) {
+	off := map[string]bool{}
+	switch v := p.Params["prose"].(type) {
+	case nil:
+	case bool:
+		if !v {
+			for _, r := range Rules {
+				off[r] = true
+			}
+		}
+	case map[string]any:
+		list, _ := v["ignore"].([]any)
+		for _, r := range list {
+			s, _ := r.(string)
+			if !slices.Contains(Rules, s) {
+				return nil, fmt.Errorf("prose: ignore: unknown rule %q", r)
+			}
+			off[s] = true
+		}
+	default:
+		return nil, fmt.Errorf("prose must be false or a mapping with ignore, not %T", v)
+	}
+	return off, nil
+}
+
+// Linter runs the rules with one config.
+type Linter struct {
+	cfg    Config
+	weasel *regexp.Regexp
+	filler *regexp.Regexp
+}
+
+// NewLinter returns a linter for cfg.
+func NewLinter(cfg Config) *Linter {
+	return &Linter{cfg: cfg, weasel: wordsRe(cfg.Weasel), filler: wordsRe(cfg.Filler)}
+}
+
+// wordsRe matches any of words as whole words, ignoring case, or nothing
+// if there are none.
+func wordsRe(words []string) *regexp.Regexp {
+	if len(words) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// passiveRe matches a form of "to be" followed by a past participle: a
+// regular one ending in -ed or one of the common irregular ones.
+var passiveRe = regexp.MustCompile(`(?i)\b(?:am|is|are|was|were|be|been|being)\s+(?:\w+ly\s+)?(?:\w+ed|been|begun|bitten|blown|bought|bound|broken|brought|built|caught|chosen|done|drawn|driven|eaten|fed|felt|forgotten|found|given|gotten|grown|held|hidden|kept|known|laid|left|lost|made|meant|paid|put|read|run|said|seen|sent|set|shown|shut|sold|spent|split|spoken|stolen|taken|taught|thought|thrown|told|understood|won|worn|written)\b`)
+
+// Post lints p's prose and returns the problems, in order, leaving out
+// the rules cfg disables and p ignores.
+func (l *Linter) Post(p *content.Post) ([]Problem, error) {
+	ignored, err := Ignored(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range l.cfg.Disable {
+		ignored[r] = true
+	}
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	var (
+		problems  []Problem
+		passive   []Problem
+		sentences int
+	)
+	for _, para := range paragraphs(doc) {
+		at := func(i int, rule, format string, args ...any) Problem {
+			line, col := para.pos(doc, i)
+			return Problem{line, col, rule, fmt.Sprintf(format, args...)}
+		}
+		for _, s := range sentencesOf(para.text) {
+			sentences++
+			text := para.text[s.start:s.end]
+			words := wordRe.FindAllStringIndex(text, -1)
+			if n := len(words); n > l.cfg.MaxSentenceWords {
+				problems = append(problems, at(s.start, RuleSentenceLength, "sentence has %d words, more than %d", n, l.cfg.MaxSentenceWords))
+			}
+			for i := 1; i < len(words); i++ {
+				prev, w := text[words[i-1][0]:words[i-1][1]], text[words[i][0]:words[i][1]]
+				gap := text[words[i-1][1]:words[i][0]]
+				if strings.EqualFold(prev, w) && strings.TrimSpace(gap) == "" && !isNumber(w) {
+					problems = append(problems, at(s.start+words[i][0], RuleRepeated, "%q is repeated", w))
+				}
+			}
+			for _, rule := range []struct {
+				name string
+				re   *regexp.Regexp
+				msg  string
+			}{
+				{RuleFiller, l.filler, "%q adds nothing; cut it or pick a stronger word"},
+				{RuleWeasel, l.weasel, "%q hedges; say how much, or cut it"},
+			} {
+				if rule.re == nil {
+					continue
+				}
+				for _, m := range rule.re.FindAllStringIndex(text, -1) {
+					problems = append(problems, at(s.start+m[0], rule.name, rule.msg, oneLine(text[m[0]:m[1]])))
+				}
+			}
+			if m := passiveRe.FindStringIndex(text); m != nil {
+				passive = append(passive, at(s.start+m[0], RulePassive, "%q is passive", oneLine(text[m[0]:m[1]])))
+			}
+		}
+	}
+	if sentences > 0 {
+		if share := float64(len(passive)) / float64(sentences); share > l.cfg.MaxPassive {
+			for _, pr := range passive {
+				pr.Msg += fmt.Sprintf("; %.0f%% of the sentences are, more than %.0f%%", share*100, l.cfg.MaxPassive*100)
+				problems = append(problems, pr)
+			}
+		}
+	}
+
+	problems = slices.DeleteFunc(problems, func(pr Problem) bool { return ignored[pr.Rule] })
+	slices.SortStableFunc(problems, func(a, b Problem) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Col - b.Col
+	})
+	return problems, nil
+}
+
+var wordRe = regexp.MustCompile(`[\p{L}\p{N}][\p{L}\p{N}'’_-]*`)
+
+// oneLine joins a match that spans a soft line break.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func isNumber(w string) bool {
+	return strings.Trim(w, "0123456789") == ""
+}
@@ -0,0 +1,156 @@
+package prose
+
+import (
+	stdhtml "html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// paragraph is the plain text of a paragraph, with the offset in the
+// document's source of each of its bytes.
+type paragraph struct {
+	text string
+	offs []int
+}
+
+// pos returns the file line and column of the byte at i.
+func (p paragraph) pos(d *markdown.Doc, i int) (line, col int) {
+	off := p.offs[min(i, len(p.offs)-1)]
+	line = d.Line(off)
+	col = off - strings.LastIndexByte(string(d.Source[:off]), '\n')
+	return line, col
+}
+
+// shortcodeRe matches Hugo shortcodes, which goldmark leaves as text.
+var shortcodeRe = regexp.MustCompile(`\{\{[<%].*?[%>]\}\}`)
+
+// paragraphs returns the prose paragraphs of d: not the ones in quotes,
+// which aren't the author's words, and not headings, code, or HTML.
+func paragraphs(d *markdown.Doc) []paragraph {
+	var out []paragraph
+	_ = ast.Walk(d.Root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindBlockquote, ast.KindHeading:
+			return ast.WalkSkipChildren, nil
+		case ast.KindParagraph, ast.KindTextBlock:
+			if p := inline(d, n); strings.TrimSpace(p.text) != "" {
+				out = append(out, p)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return out
+}
+
+// inline flattens the inline content of block n to text. Code spans and
+// autolinks stand in as a 0, a word that counts toward the sentence's
+// length but that no rule reads; images and raw HTML are dropped.
+func inline(d *markdown.Doc, n ast.Node) paragraph {
+	var (
+		b    strings.Builder
+		offs []int
+		last int
+	)
+	write := func(s string, off int, step bool) {
+		for i := range len(s) {
+			b.WriteByte(s[i])
+			if step {
+				last = off + i
+			}
+			offs = append(offs, last)
+		}
+	}
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || c == n {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			write(string(c.Segment.Value(d.Source)), c.Segment.Start, true)
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				write("\n", c.Segment.Stop, true)
+			}
+		case *ast.String:
+			write(stdhtml.UnescapeString(string(c.Value)), last, false)
+		case *ast.CodeSpan, *ast.AutoLink:
+			if off, ok := firstOffset(c); ok {
+				last = off
+			}
+			write("0", last, false)
+			return ast.WalkSkipChildren, nil
+		case *ast.Image, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	text := shortcodeRe.ReplaceAllStringFunc(b.String(), func(s string) string {
+		return strings.Repeat(" ", len(s))
+	})
+	return paragraph{text, offs}
+}
+
+func firstOffset(n ast.Node) (int, bool) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if t, ok := c.(*ast.Text); ok {
+			return t.Segment.Start, true
+		}
+	}
+	return 0, false
+}
+
+// span is a sentence's byte range in a paragraph's text.
+type span struct{ start, end int }
+
+// abbreviations end in a period without ending the sentence.
+var abbreviations = map[string]bool{
+	"e.g.": true, "i.e.": true, "etc.": true, "vs.": true, "cf.": true,
+	"mr.": true, "mrs.": true, "ms.": true, "dr.": true, "st.": true,
+}
+
+// sentencesOf splits text at the periods, question marks, and exclamation
+// marks followed by a space or the end, skipping abbreviations and
+// initials.
+func sentencesOf(text string) []span {
+	var out []span
+	start := 0
+	add := func(end int) {
+		if strings.TrimSpace(text[start:end]) != "" {
+			// Trim the leading space so the sentence points at its first word.
+			lead := len(text[start:end]) - len(strings.TrimLeft(text[start:end], " \t\n"))
+			out = append(out, span{start + lead, end})
+		}
+		start = end
+	}
+	for i := 0; i < len(text); i++ {
+		if !strings.ContainsRune(".!?", rune(text[i])) {
+			continue
+		}
+		j := i + 1
+		for j < len(text) && strings.ContainsRune(".!?\"')]”’", rune(text[j])) {
+			j++
+		}
+		if j < len(text) && !strings.ContainsRune(" \t\n", rune(text[j])) {
+			i = j - 1
+			continue
+		}
+		if text[i] == '.' {
+			word := text[strings.LastIndexAny(text[:i], " \t\n(")+1 : i+1]
+			if abbreviations[strings.ToLower(word)] || len(word) == 2 {
+				i = j - 1
+				continue
+			}
+		}
+		add(j)
+		i = j - 1
+	}
+	add(len(text))
+	return out
+}
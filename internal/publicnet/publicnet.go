@@ -0,0 +1,51 @@
+// Package publicnet makes HTTP clients for fetching URLs that strangers
+// hand the site's services, such as a webmention's source or the actor
+// and key an ActivityPub inbox is told about, so that they can't make a
+// service reach into the network it runs on.
+package publicnet
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// Client returns an HTTP client that refuses to connect to loopback,
+// private, link-local, multicast, and unspecified addresses. The check is
+// made on the address dialed, after DNS and on every redirect, so a public
+// name resolving to a private address is refused too. Proxies from the
+// environment are ignored, since the proxy would be what's dialed.
+func Client(timeout time.Duration) *http.Client {
+	d := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !Public(ip) {
+				return fmt.Errorf("publicnet: refusing to connect to %s", ip)
+			}
+			return nil
+		},
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = d.DialContext
+	t.Proxy = nil
+	return &http.Client{Timeout: timeout, Transport: t}
+}
+
+// Public reports whether ip is on the public internet, an IPv4 address
+// mapped into IPv6 judged as the IPv4 one.
+func Public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
@@ -0,0 +1,330 @@
+// Package r2 is a minimal client for Cloudflare R2's S3-compatible API.
+//
+// It implements only the handful of operations the site's tooling needs
+// (list, head, get, put, delete) and signs requests with AWS Signature
+// Version 4 so we don't have to pull in the whole AWS SDK.
+package r2
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	region  = "auto"
+	service = "s3"
+)
+
+// ErrNotFound is returned when an object doesn't exist in the bucket.
+var ErrNotFound = errors.New("r2: object not found")
+
+// Config holds the credentials and bucket an R2 client talks to.
+type Config struct {
+	AccountID       string
+	AccessKeyID     string
+	SecretAccessKey string
+	Bucket          string
+
+	// Endpoint overrides the default account endpoint. Handy for pointing
+	// the client at a local S3-compatible server.
+	Endpoint string
+}
+
+// ConfigFromEnv reads R2_ACCOUNT_ID, R2_ACCESS_KEY_ID, R2_SECRET_ACCESS_KEY,
+// R2_BUCKET, and R2_ENDPOINT from the environment.
+func ConfigFromEnv() Config {
+	return Config{
+		AccountID:       os.Getenv("R2_ACCOUNT_ID"),
+		AccessKeyID:     os.Getenv("R2_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("R2_SECRET_ACCESS_KEY"),
+		Bucket:          os.Getenv("R2_BUCKET"),
+		Endpoint:        os.Getenv("R2_ENDPOINT"),
+	}
+}
+
+// Client talks to a single R2 bucket.
+type Client struct {
+	cfg      Config
+	endpoint *url.URL
+	http     *http.Client
+}
+
+// New validates cfg and returns a client for its bucket.
+func New(cfg Config) (*Client, error) {
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("r2: missing access key id or secret access key")
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("r2: missing bucket")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		if cfg.AccountID == "" {
+			return nil, errors.New("r2: missing account id or endpoint")
+		}
+		endpoint = fmt.Sprintf("https://%s.r2.cloudflarestorage.com", cfg.AccountID)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("r2: parse endpoint: %w", err)
+	}
+	return &Client{
+		cfg:      cfg,
+		endpoint: u,
+		http:     &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Bucket returns the name of the bucket the client operates on.
+func (c *Client) Bucket() string { return c.cfg.Bucket }
+
+// Object describes a stored object as reported by the list API.
+type Object struct {
+	Key          string
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// PutOptions carries the metadata attached to an uploaded object.
+type PutOptions struct {
+	ContentType  string
+	CacheControl string
+	Metadata     map[string]string
+}
+
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns every object whose key starts with prefix, following
+// continuation tokens until the listing is exhausted.
+func (c *Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			q.Set("prefix", prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res listResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("r2: decode list response: %w", err)
+		}
+		for _, o := range res.Contents {
+			objects = append(objects, Object{
+				Key:          o.Key,
+				ETag:         strings.Trim(o.ETag, `"`),
+				Size:         o.Size,
+				LastModified: o.LastModified,
+			})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// Head returns the metadata for key without downloading its body.
+func (c *Client) Head(ctx context.Context, key string) (Object, error) {
+	resp, err := c.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+	lm, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return Object{
+		Key:          key,
+		ETag:         strings.Trim(resp.Header.Get("ETag"), `"`),
+		Size:         resp.ContentLength,
+		LastModified: lm,
+	}, nil
+}
+
+// Get downloads the object stored under key.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Put uploads body under key with the given metadata.
+func (c *Client) Put(ctx context.Context, key string, body []byte, opts PutOptions) error {
+	h := http.Header{}
+	if opts.ContentType != "" {
+		h.Set("Content-Type", opts.ContentType)
+	}
+	if opts.CacheControl != "" {
+		h.Set("Cache-Control", opts.CacheControl)
+	}
+	for k, v := range opts.Metadata {
+		h.Set("x-amz-meta-"+k, v)
+	}
+	resp, err := c.do(ctx, http.MethodPut, key, nil, h, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Delete removes key from the bucket. Deleting a missing key isn't an error.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (c *Client) do(
+	ctx context.Context,
+	method, key string,
+	query url.Values,
+	header http.Header,
+	body []byte,
+) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path = "/" + c.cfg.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = encodeQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	c.sign(req, body, time.Now().UTC())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("r2: %s %s: %w", method, key, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+		return nil, fmt.Errorf(
+			"r2: %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg),
+		)
+	}
+	return resp, nil
+}
+
+// sign adds an AWS SigV4 Authorization header to req.
+// See https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func (c *Client) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		v := strings.Join(req.Header.Values(k), ",")
+		canonHeaders.WriteString(k + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonReq)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKeyID, scope, signedHeaders, sig,
+	))
+}
+
+// encodeQuery renders q in the canonical form SigV4 expects: sorted keys and
+// RFC 3986 percent-encoding (spaces as %20, not +).
+func encodeQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,136 @@
+package r2
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// File is a local file mapped to the object key it's uploaded under.
+type File struct {
+	Path string // path on disk
+	Key  string // object key in the bucket
+	Hash string // hex md5, comparable to a single-part upload ETag
+
+	// CacheControl, if set, overrides the upload's cache-control for this
+	// file, and ContentType the type its extension implies.
+	CacheControl string
+	ContentType  string
+}
+
+// Walk hashes every regular file under dir and maps it to a key under
+// prefix. Files are sorted by key.
+func Walk(dir, prefix string) ([]File, error) {
+	var files []File
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(b)
+		files = append(files, File{
+			Path: p,
+			Key:  path.Join(prefix, filepath.ToSlash(rel)),
+			Hash: hex.EncodeToString(sum[:]),
+		})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	return files, err
+}
+
+// Changed returns the files that are missing from the bucket or whose hash
+// doesn't match the object's ETag, and how many objects there are under
+// prefix.
+func (c *Client) Changed(ctx context.Context, files []File, prefix string) ([]File, int, error) {
+	remote, err := c.List(ctx, prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	etags := make(map[string]string, len(remote))
+	for _, o := range remote {
+		etags[o.Key] = o.ETag
+	}
+	var changed []File
+	for _, f := range files {
+		if etags[f.Key] != f.Hash {
+			changed = append(changed, f)
+		}
+	}
+	return changed, len(remote), nil
+}
+
+// Upload puts files in the bucket using up to jobs concurrent requests,
+// calling done after each successful upload. It keeps going after a
+// failure and reports the first error at the end.
+func (c *Client) Upload(ctx context.Context, files []File, cacheControl string, jobs int, done func(File)) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, jobs)
+	)
+	for _, f := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := c.putFile(ctx, f, cacheControl)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("upload %s: %v", f.Key, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			if done != nil {
+				done(f)
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (c *Client) putFile(ctx context.Context, f File, cacheControl string) error {
+	b, err := os.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+	ctype := f.ContentType
+	if ctype == "" {
+		ctype = mime.TypeByExtension(filepath.Ext(f.Path))
+	}
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	if f.CacheControl != "" {
+		cacheControl = f.CacheControl
+	}
+	return c.Put(ctx, f.Key, b, PutOptions{
+		ContentType:  ctype,
+		CacheControl: cacheControl,
+	})
+}
@@ -0,0 +1,107 @@
+// Package ratelimit throttles the public endpoints of the site's services
+// per client, in memory.
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket per key, such as a client IP. Each bucket
+// holds up to Burst tokens and refills at one per Every. The zero value
+// allows nothing; use New.
+type Limiter struct {
+	every time.Duration
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter that allows burst requests at once and one
+// per every after that.
+func New(every time.Duration, burst int) *Limiter {
+	return &Limiter{every: every, burst: burst, buckets: map[string]*bucket{}}
+}
+
+// Allow takes a token from key's bucket at now and reports whether there
+// was one.
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(now, l.every, l.burst)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Prune forgets the buckets that have refilled by now; a new one would be
+// the same.
+func (l *Limiter) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, b := range l.buckets {
+		if b.refill(now, l.every, l.burst); b.tokens >= float64(l.burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// PruneEvery prunes every d until ctx is done, so idle clients' keys
+// don't linger in memory. Run it in its own goroutine.
+func (l *Limiter) PruneEvery(ctx context.Context, d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			l.Prune(now)
+		}
+	}
+}
+
+func (b *bucket) refill(now time.Time, every time.Duration, burst int) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(burst), b.tokens+float64(elapsed)/float64(every))
+		b.last = now
+	}
+}
+
+// ClientIP returns the address r came from: the one in header, when a
+// proxy in front sets one (such as Cloudflare's CF-Connecting-IP), or else
+// the connection's. For a list like X-Forwarded-For it's the last
+// address, the one the proxy in front appended; the client can put
+// anything it likes before that.
+func ClientIP(r *http.Request, header string) string {
+	if header != "" {
+		if vs := r.Header.Values(header); len(vs) > 0 {
+			v := vs[len(vs)-1]
+			if ip := strings.TrimSpace(v[strings.LastIndex(v, ",")+1:]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
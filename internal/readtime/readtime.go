@@ -0,0 +1,279 @@
+// Package readtime estimates how long a post takes to read. Hugo's
+// .ReadingTime divides every word, code included, by one speed; here
+// prose is read at a pace, code is read a line at a time, a table a row at
+// a time, and each image holds the eye for a moment, the first the
+// longest. Chinese, Japanese, and Korean text has no spaces between its
+// words, so each of its characters counts as one, as Hugo counts them
+// with isCJKLanguage. The post_meta partial shows the estimates from
+// data/readtime.json in place of Hugo's.
+//
+// The pace and costs come from data/reading_speed.toml. A post whose
+// estimate is off sets its own with a readtime front matter key, in whole
+// minutes.
+package readtime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// DefaultPath is where templates read the estimates from, as
+// site.Data.readtime.
+const DefaultPath = "data/readtime.json"
+
+// DefaultConfig is where the pace and costs live.
+const DefaultConfig = "data/reading_speed.toml"
+
+// Config is how fast each part of a post is read. A key missing from the
+// file keeps its default.
+type Config struct {
+	// WordsPerMinute is the pace of prose.
+	WordsPerMinute int `toml:"words_per_minute"`
+	// CodeLineSeconds is the time a line of code takes; blank lines are
+	// free.
+	CodeLineSeconds float64 `toml:"code_line_seconds"`
+	// TableRowSeconds is the time a row of a table takes, header
+	// included. Tables don't count toward the words.
+	TableRowSeconds float64 `toml:"table_row_seconds"`
+	// ImageSeconds is the time the first image takes. Each one after it
+	// takes a second less, down to MinImageSeconds.
+	ImageSeconds    float64 `toml:"image_seconds"`
+	MinImageSeconds float64 `toml:"min_image_seconds"`
+}
+
+// Default returns the settings used when there's no config file: Hugo's
+// pace for prose, and Medium's for images.
+func Default() Config {
+	return Config{
+		WordsPerMinute:  213,
+		CodeLineSeconds: 1,
+		TableRowSeconds: 3,
+		ImageSeconds:    12,
+		MinImageSeconds: 3,
+	}
+}
+
+// LoadConfig reads the settings at path over the defaults. A missing file
+// is the defaults.
+func LoadConfig(path string) (Config, error) {
+	c := Default()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := toml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("readtime: %s: %w", path, err)
+	}
+	if c.WordsPerMinute <= 0 {
+		return c, fmt.Errorf("readtime: %s: words_per_minute must be positive", path)
+	}
+	if c.CodeLineSeconds < 0 || c.TableRowSeconds < 0 || c.ImageSeconds < 0 || c.MinImageSeconds < 0 {
+		return c, fmt.Errorf("readtime: %s: the costs can't be negative", path)
+	}
+	return c, nil
+}
+
+// Counts are the parts of a post that take time to read.
+type Counts struct {
+	Words     int `json:"words"`
+	CodeLines int `json:"code_lines"`
+	TableRows int `json:"table_rows"`
+	Images    int `json:"images"`
+}
+
+// Estimate is how long a post takes to read, and what it's made of.
+type Estimate struct {
+	Counts
+	// Minutes is the time rounded up to a whole minute, at least one.
+	Minutes int `json:"minutes"`
+}
+
+// shortcodeRe matches a shortcode, with a slash when it's a closing one,
+// and its name.
+var (
+	shortcodeRe = regexp.MustCompile(`\{\{[<%]\s*(/?)\s*([\w-]+)[^}]*[>%]\}\}`)
+	imgTagRe    = regexp.MustCompile(`(?i)<img\b`)
+)
+
+// imageShortcodes are the shortcodes that show an image.
+var imageShortcodes = map[string]bool{"img": true, "figure": true}
+
+// Count reads p's body. Prose is what PlainText has outside tables,
+// without shortcodes; code is every non-blank line of a code block;
+// images are markdown images, <img> tags, and the image shortcodes.
+func Count(p *content.Post) Counts {
+	var c Counts
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	var prose strings.Builder
+	_ = ast.Walk(doc.Root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock {
+				prose.WriteByte('\n')
+			}
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				seg := lines.At(i)
+				if len(bytes.TrimSpace(seg.Value(doc.Source))) > 0 {
+					c.CodeLines++
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		case *extast.Table:
+			for r := n.FirstChild(); r != nil; r = r.NextSibling() {
+				c.TableRows++
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.Image:
+			c.Images++
+			return ast.WalkSkipChildren, nil
+		case *ast.HTMLBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				seg := lines.At(i)
+				c.Images += len(imgTagRe.FindAll(seg.Value(doc.Source), -1))
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.RawHTML:
+			for i := 0; i < n.Segments.Len(); i++ {
+				seg := n.Segments.At(i)
+				c.Images += len(imgTagRe.FindAll(seg.Value(doc.Source), -1))
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			prose.Write(n.Segment.Value(doc.Source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				prose.WriteByte(' ')
+			}
+		case *ast.String:
+			prose.Write(n.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	text := shortcodeRe.ReplaceAllStringFunc(prose.String(), func(sc string) string {
+		m := shortcodeRe.FindStringSubmatch(sc)
+		if m[1] == "" && imageShortcodes[m[2]] {
+			c.Images++
+		}
+		return " "
+	})
+	c.Words = words(text)
+	return c
+}
+
+// words counts the words of text: the runs between spaces, where each CJK
+// character is a word of its own. Punctuation doesn't start a word, so a
+// dash or a CJK full stop on its own isn't one.
+func words(text string) int {
+	n := 0
+	for _, f := range strings.Fields(text) {
+		inWord := false
+		for _, r := range f {
+			switch {
+			case isCJK(r):
+				n++
+				inWord = false
+			case !inWord && !unicode.IsPunct(r):
+				n++
+				inWord = true
+			}
+		}
+	}
+	return n
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Seconds is how long c takes to read at cfg's pace.
+func (cfg Config) Seconds(c Counts) float64 {
+	s := float64(c.Words) / float64(cfg.WordsPerMinute) * 60
+	s += float64(c.CodeLines) * cfg.CodeLineSeconds
+	s += float64(c.TableRows) * cfg.TableRowSeconds
+	for i := range c.Images {
+		s += max(cfg.ImageSeconds-float64(i), cfg.MinImageSeconds)
+	}
+	return s
+}
+
+// Minutes rounds seconds up to whole minutes, at least one, the way
+// Hugo's .ReadingTime does.
+func Minutes(seconds float64) int {
+	return max(1, int(math.Ceil(seconds/60)))
+}
+
+// Override returns the minutes p's readtime front matter key sets, or 0
+// if it sets none.
+func Override(p *content.Post) (int, error) {
+	var n int
+	switch v := p.Params["readtime"].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		n = v
+	case int64:
+		n = int(v)
+	default:
+		return 0, fmt.Errorf("readtime must be a number of minutes, not %T", v)
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("readtime must be 1 minute or more, not %d", n)
+	}
+	return n, nil
+}
+
+// Post estimates p at cfg's pace, unless its front matter sets the
+// minutes. A bad readtime key is ignored here; Posts reports it.
+func (cfg Config) Post(p *content.Post) Estimate {
+	c := Count(p)
+	minutes, _ := Override(p)
+	if minutes == 0 {
+		minutes = Minutes(cfg.Seconds(c))
+	}
+	return Estimate{Counts: c, Minutes: minutes}
+}
+
+// Posts estimates every post but the notes, keyed by content.Post.DataKey
+// as the templates look pages up. It estimates them all, and then returns
+// the bad readtime keys it found on the way.
+func (cfg Config) Posts(posts []*content.Post) (map[string]Estimate, error) {
+	out := map[string]Estimate{}
+	var errs []error
+	for _, p := range posts {
+		if p.IsNote() {
+			continue
+		}
+		if _, err := Override(p); err != nil {
+			errs = append(errs, fmt.Errorf("readtime: %s: %w", p.Path, err))
+		}
+		out[p.DataKey()] = cfg.Post(p)
+	}
+	return out, errors.Join(errs...)
+}
+
+// Write writes the estimates to path as JSON, leaving the file alone if
+// it wouldn't change. It reports whether it wrote.
+func Write(path string, estimates map[string]Estimate) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, estimates)
+}
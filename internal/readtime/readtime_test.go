@@ -0,0 +1,186 @@
+package readtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+func post(body string) *content.Post {
+	return &content.Post{Path: "go/test.md", Section: "go", Slug: "test", Body: body}
+}
+
+func TestPost(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    Counts
+		minutes int
+	}{
+		{"empty", "", Counts{}, 1},
+		{"blank lines", "\n\n   \n", Counts{}, 1},
+		{
+			"one minute of prose",
+			strings.Repeat("word ", 213),
+			Counts{Words: 213}, 1,
+		},
+		{
+			"just over",
+			strings.Repeat("word ", 214),
+			Counts{Words: 214}, 2,
+		},
+		{
+			"code only",
+			"```go\nfunc main() {\n\n\tprintln(1)\n}\n```\n\n    indented := true\n",
+			Counts{CodeLines: 4}, 1,
+		},
+		{
+			"a long listing",
+			"```\n" + strings.Repeat("x++\n", 61) + "```\n",
+			Counts{CodeLines: 61}, 2,
+		},
+		{
+			"code words aren't prose",
+			"Run it:\n\n```sh\ngo test ./... -run TestPost -count 1\n```\n",
+			Counts{Words: 2, CodeLines: 1}, 1,
+		},
+		{
+			"images",
+			"![a](a.png)\n\n<img src=\"b.png\">\n\nSee <img src=\"c.png\"> here.\n\n" +
+				"{{< img src=\"d.png\" >}}\n\n{{< figure src=\"e.png\" >}}\n",
+			Counts{Words: 2, Images: 5}, 1,
+		},
+		{
+			"images add up",
+			strings.Repeat("![a](a.png)\n\n", 8),
+			Counts{Images: 8}, 2,
+		},
+		{
+			"other shortcodes aren't words",
+			"{{< youtube abc >}}\n\n{{% note %}}Careful.{{% /note %}}\n",
+			Counts{Words: 1}, 1,
+		},
+		{
+			"table",
+			"| a | b |\n|---|---|\n| one two | three |\n| four | five |\n",
+			Counts{TableRows: 3}, 1,
+		},
+		{
+			"punctuation alone isn't a word",
+			"Fast — and, well, simple.\n",
+			Counts{Words: 4}, 1,
+		},
+		{
+			"chinese",
+			"快速的编译。\n",
+			Counts{Words: 5}, 1,
+		},
+		{
+			"japanese with latin",
+			"Go は速いです。\n",
+			Counts{Words: 6}, 1,
+		},
+		{
+			"korean",
+			"고 언어\n",
+			Counts{Words: 3}, 1,
+		},
+		{
+			"a minute of chinese",
+			strings.Repeat("字", 214),
+			Counts{Words: 214}, 2,
+		},
+	}
+	cfg := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cfg.Post(post(tt.body))
+			if got.Counts != tt.want {
+				t.Errorf("Counts = %+v, want %+v", got.Counts, tt.want)
+			}
+			if got.Minutes != tt.minutes {
+				t.Errorf("Minutes = %d, want %d", got.Minutes, tt.minutes)
+			}
+		})
+	}
+}
+
+func TestSecondsImages(t *testing.T) {
+	cfg := Default()
+	// 12, 11, ..., down to 3 and then 3 each.
+	tests := []struct {
+		images int
+		want   float64
+	}{
+		{0, 0},
+		{1, 12},
+		{2, 23},
+		{10, 12 + 11 + 10 + 9 + 8 + 7 + 6 + 5 + 4 + 3},
+		{12, 12 + 11 + 10 + 9 + 8 + 7 + 6 + 5 + 4 + 3 + 3 + 3},
+	}
+	for _, tt := range tests {
+		if got := cfg.Seconds(Counts{Images: tt.images}); got != tt.want {
+			t.Errorf("%d images take %gs, want %gs", tt.images, got, tt.want)
+		}
+	}
+}
+
+func TestOverride(t *testing.T) {
+	long := strings.Repeat("word ", 2000)
+	tests := []struct {
+		name    string
+		file    string
+		minutes int
+		err     string // in the error Posts returns; "" for none
+	}{
+		{"none", "---\ntitle: T\n---\n" + long, 10, ""},
+		{"yaml", "---\ntitle: T\nreadtime: 3\n---\n" + long, 3, ""},
+		{"toml", "+++\ntitle = \"T\"\nreadtime = 3\n+++\n" + long, 3, ""},
+		{"longer than estimated", "---\ntitle: T\nreadtime: 25\n---\nShort.\n", 25, ""},
+		{"zero", "---\ntitle: T\nreadtime: 0\n---\n" + long, 10, "1 minute or more"},
+		{"not a number", "---\ntitle: T\nreadtime: soon\n---\n" + long, 10, "a number of minutes"},
+	}
+	cfg := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := content.Parse("go/test.md", []byte(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := cfg.Posts([]*content.Post{p})
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Posts: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("Posts error = %v, want one about %q", err, tt.err)
+			}
+			if got["test"].Minutes != tt.minutes {
+				t.Errorf("Minutes = %d, want %d", got["test"].Minutes, tt.minutes)
+			}
+			if got["test"].Words != Count(p).Words {
+				t.Errorf("Words = %d, want the counts kept", got["test"].Words)
+			}
+		})
+	}
+}
+
+func TestPostsKeys(t *testing.T) {
+	en := post("Hello.")
+	bn := post("হ্যালো, বিশ্ব।")
+	bn.Lang = "bn"
+	note := post("A note.")
+	note.Section = content.NotesSection
+	note.Slug = "note"
+
+	got, err := Default().Posts([]*content.Post{en, bn, note})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("got %d estimates, want the two articles without the note", len(got))
+	}
+	if got["test"].Words != 1 || got["bn/test"].Words != 2 {
+		t.Errorf("got %+v, want the original at test and its translation at bn/test", got)
+	}
+}
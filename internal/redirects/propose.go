@@ -0,0 +1,190 @@
+package redirects
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/search"
+)
+
+// Hit is a path that got a 404 and how many times.
+type Hit struct {
+	Path  string
+	Count int
+}
+
+// Proposal is a cluster of 404 paths that differ only in case, a trailing
+// slash, or an index.html or .html suffix, and the post they most likely
+// meant.
+type Proposal struct {
+	// From is the most requested spelling; Variants are the rest.
+	From     string
+	Variants []string
+	Count    int
+	// To is the best matching post's path, "" if none scored the minimum.
+	To    string
+	Title string
+	Score float64
+}
+
+// clusterKey normalizes a path to the form its variants share.
+func clusterKey(p string) string {
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	p = strings.TrimSuffix(strings.ToLower(p), "index.html")
+	p = strings.TrimSuffix(p, ".html")
+	return key(p)
+}
+
+// Propose clusters the 404 hits and fuzzy-matches each cluster against
+// the published posts' slugs. Paths that are live pages or already
+// redirected are skipped. Clusters come back most requested first; those
+// scoring below min have no To.
+func Propose(hits []Hit, posts []*content.Post, existing []Redirect, pages map[string]bool, min float64) []Proposal {
+	redirected := map[string]bool{}
+	for _, r := range existing {
+		redirected[clusterKey(r.From)] = true
+	}
+	type cluster struct {
+		variants []Hit
+		count    int
+	}
+	clusters := map[string]*cluster{}
+	for _, h := range hits {
+		k := clusterKey(h.Path)
+		if pages[key(h.Path)] || redirected[k] {
+			continue
+		}
+		c := clusters[k]
+		if c == nil {
+			c = &cluster{}
+			clusters[k] = c
+		}
+		c.variants = append(c.variants, h)
+		c.count += h.Count
+	}
+
+	posts = content.Published(posts)
+	var out []Proposal
+	for _, c := range clusters {
+		sort.SliceStable(c.variants, func(i, j int) bool { return c.variants[i].Count > c.variants[j].Count })
+		p := Proposal{From: c.variants[0].Path, Count: c.count}
+		// Variants that only differ in case or a trailing slash are the same
+		// redirect; list the ones that need an entry of their own.
+		seen := map[string]bool{key(p.From): true}
+		for _, v := range c.variants[1:] {
+			if !seen[key(v.Path)] {
+				seen[key(v.Path)] = true
+				p.Variants = append(p.Variants, v.Path)
+			}
+		}
+		if best, score := match(p.From, posts); best != nil && score >= min {
+			p.To, p.Title, p.Score = best.RelPermalink(), best.Title, score
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].From < out[j].From
+	})
+	return out
+}
+
+// match returns the post whose section and slug best match the last
+// segment of p, and the score, from 0 to 1.
+func match(p string, posts []*content.Post) (*content.Post, float64) {
+	seg := path.Base(strings.TrimSuffix(clusterKey(p), "/"))
+	words := tokens(seg)
+	if len(words) == 0 {
+		return nil, 0
+	}
+	var (
+		best  *content.Post
+		score float64
+	)
+	for _, post := range posts {
+		slug := strings.ToLower(post.Slug)
+		s := max(
+			similarity(strings.Join(words, "_"), strings.Join(tokens(slug), "_")),
+			overlap(words, append(tokens(slug), strings.ToLower(post.Section))),
+		)
+		// Posts are newest first, so ties go to the newer post.
+		if s > score {
+			best, score = post, s
+		}
+	}
+	return best, score
+}
+
+// tokens splits s into its words, dropping numbers, like the dates in old
+// URLs, and stopwords.
+func tokens(s string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if strings.IndexFunc(w, unicode.IsLetter) < 0 || search.IsStopword(w) {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+// overlap is the Jaccard index of two word lists, counting words that are
+// at least 80% similar, like a typo, as the same word.
+func overlap(a, b []string) float64 {
+	var shared int
+	used := make([]bool, len(b))
+	for _, w := range a {
+		for j, v := range b {
+			if !used[j] && similarity(w, v) >= 0.8 {
+				used[j] = true
+				shared++
+				break
+			}
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// similarity is 1 minus the edit distance between a and b over the length
+// of the longer one.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	n := max(len(ra), len(rb))
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(n)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,161 @@
+// Package redirects manages the site's redirect map: old URLs and where
+// they moved to. The map is checked for loops and chains, turned into
+// Hugo aliases on the target posts, and synced to Cloudflare Bulk
+// Redirects.
+package redirects
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// DefaultPath is where the redirect map lives.
+const DefaultPath = "data/redirects.toml"
+
+// Redirect sends visitors from an old path to a new one. From is a path
+// on the site; To is a path on the site or an absolute URL.
+type Redirect struct {
+	From string `toml:"from"`
+	To   string `toml:"to"`
+	// Status defaults to 301.
+	Status int `toml:"status"`
+}
+
+// Local reports whether r points at a path on the site.
+func (r Redirect) Local() bool { return strings.HasPrefix(r.To, "/") }
+
+type file struct {
+	Redirect []Redirect `toml:"redirect"`
+}
+
+// Load reads the map at path. A missing file is an empty map.
+func Load(path string) ([]Redirect, error) {
+	var f file
+	_, err := toml.DecodeFile(path, &f)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redirects: %s: %w", path, err)
+	}
+	for i := range f.Redirect {
+		if f.Redirect[i].Status == 0 {
+			f.Redirect[i].Status = 301
+		}
+	}
+	return f.Redirect, nil
+}
+
+// key normalizes a path for comparison the way Hugo serves it: lowercase,
+// with or without the trailing slash.
+func key(p string) string {
+	if p = strings.ToLower(p); p != "/" {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+// Pages returns the paths the site serves pages at, normalized: the
+// posts, the sections, the tag pages, the home page, and the standalone
+// pages at the root of dir.
+func Pages(dir string, posts []*content.Post) (map[string]bool, error) {
+	pages := map[string]bool{"/": true, "/tags": true}
+	for _, p := range posts {
+		pages[key(p.RelPermalink())] = true
+		pages[key("/"+p.Section+"/")] = true
+		for _, t := range p.Tags {
+			pages[key("/tags/"+content.TagSlug(t)+"/")] = true
+		}
+	}
+	root, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range root {
+		pages[key("/"+strings.TrimSuffix(filepath.Base(f), ".md")+"/")] = true
+	}
+	return pages, nil
+}
+
+// Validate checks the map against the site's pages: every From is a path
+// that isn't itself a live page and is listed once, every local To is a
+// page, and no redirect leads to another redirect, since a chain costs
+// visitors a round trip per hop and a loop never ends.
+func Validate(rs []Redirect, pages map[string]bool) []error {
+	var errs []error
+	bad := func(r Redirect, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", r.From, fmt.Sprintf(format, args...)))
+	}
+	next := map[string]string{}
+	for _, r := range rs {
+		switch {
+		case !strings.HasPrefix(r.From, "/") || strings.Contains(r.From, "://"):
+			bad(r, "from must be a path starting with /")
+			continue
+		case next[key(r.From)] != "":
+			bad(r, "listed more than once")
+			continue
+		case pages[key(r.From)]:
+			bad(r, "is a live page; redirecting it would hide the page")
+		}
+		if !slices.Contains([]int{301, 302, 307, 308}, r.Status) {
+			bad(r, "status %d isn't a redirect status", r.Status)
+		}
+		if r.Local() {
+			if !pages[key(r.To)] {
+				bad(r, "target %s isn't a page on the site", r.To)
+			}
+		} else if u, err := url.Parse(r.To); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			bad(r, "target %q must be a path or an absolute http(s) URL", r.To)
+		}
+		next[key(r.From)] = r.To
+	}
+	for _, r := range rs {
+		if !r.Local() {
+			continue
+		}
+		chain := []string{r.From}
+		seen := map[string]bool{key(r.From): true}
+		for to := r.To; to != ""; to = next[key(to)] {
+			chain = append(chain, to)
+			if seen[key(to)] {
+				bad(r, "loop: %s", strings.Join(chain, " -> "))
+				break
+			}
+			seen[key(to)] = true
+			if next[key(to)] == "" && len(chain) > 2 {
+				bad(r, "chain: %s; point it at %s directly", strings.Join(chain, " -> "), to)
+			}
+		}
+	}
+	return errs
+}
+
+// Aliases maps the path of each post that redirects point at to the
+// sorted From paths of those redirects, which Hugo renders as alias pages.
+func Aliases(rs []Redirect, posts []*content.Post) map[string][]string {
+	byURL := map[string]*content.Post{}
+	for _, p := range posts {
+		byURL[key(p.RelPermalink())] = p
+	}
+	out := map[string][]string{}
+	for _, r := range rs {
+		if p, ok := byURL[key(r.To)]; ok && r.Local() {
+			out[p.Path] = append(out[p.Path], r.From)
+		}
+	}
+	for _, froms := range out {
+		sort.Strings(froms)
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+// Package related picks each post's most similar posts for the "related
+// posts" list, either by TF-IDF cosine similarity over the post text or by
+// how many tags two posts share.
+package related
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/search"
+)
+
+// DefaultPath is where templates read the related posts from, as
+// site.Data.related.
+const DefaultPath = "data/related.json"
+
+// Method is a similarity measure.
+type Method string
+
+const (
+	// TFIDF compares the posts' titles, tags, and prose.
+	TFIDF Method = "tfidf"
+	// Tags ranks posts by the Jaccard overlap of their tags.
+	Tags Method = "tags"
+)
+
+// ParseMethod validates a -method flag value.
+func ParseMethod(s string) (Method, error) {
+	switch m := Method(s); m {
+	case TFIDF, Tags:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown method %q (want %s or %s)", s, TFIDF, Tags)
+}
+
+// Compute maps the content.Post.DataKey of every published article to the
+// keys of at most n related articles in its language, best match first;
+// notes are left out. Posts with nothing in common get an empty list.
+func Compute(posts []*content.Post, m Method, n int) map[string][]string {
+	byLang := map[string][]*content.Post{}
+	for _, p := range content.Articles(content.Published(posts)) {
+		byLang[p.Lang] = append(byLang[p.Lang], p)
+	}
+	out := make(map[string][]string, len(posts))
+	for _, group := range byLang {
+		compute(out, group, m, n)
+	}
+	return out
+}
+
+// compute adds the related articles of each of posts, of one language, to
+// out.
+func compute(out map[string][]string, posts []*content.Post, m Method, n int) {
+	var score func(i, j int) float64
+	switch m {
+	case Tags:
+		score = tagScorer(posts)
+	default:
+		score = tfidfScorer(posts)
+	}
+
+	for i, p := range posts {
+		type match struct {
+			j     int
+			score float64
+		}
+		var ms []match
+		for j := range posts {
+			if j == i {
+				continue
+			}
+			if s := score(i, j); s > 0 {
+				ms = append(ms, match{j, s})
+			}
+		}
+		// Posts are newest first, so a stable sort favors newer posts on
+		// ties.
+		sort.SliceStable(ms, func(a, b int) bool { return ms[a].score > ms[b].score })
+		if len(ms) > n {
+			ms = ms[:n]
+		}
+		keys := make([]string, 0, len(ms))
+		for _, m := range ms {
+			keys = append(keys, posts[m.j].DataKey())
+		}
+		out[p.DataKey()] = keys
+	}
+}
+
+// tagScorer scores a pair of posts by |A∩B| / |A∪B| over their tag slugs.
+func tagScorer(posts []*content.Post) func(i, j int) float64 {
+	sets := make([]map[string]bool, len(posts))
+	for i, p := range posts {
+		sets[i] = map[string]bool{}
+		for _, t := range p.Tags {
+			sets[i][content.TagSlug(t)] = true
+		}
+	}
+	return func(i, j int) float64 {
+		var shared int
+		for t := range sets[i] {
+			if sets[j][t] {
+				shared++
+			}
+		}
+		union := len(sets[i]) + len(sets[j]) - shared
+		if union == 0 {
+			return 0
+		}
+		return float64(shared) / float64(union)
+	}
+}
+
+// tfidfScorer scores a pair of posts by the cosine similarity of their
+// TF-IDF vectors, using sublinear term frequency.
+func tfidfScorer(posts []*content.Post) func(i, j int) float64 {
+	tfs := make([]map[string]float64, len(posts))
+	df := map[string]int{}
+	for i, p := range posts {
+		text := p.Title + "\n" + strings.Join(p.Tags, " ") + "\n" +
+			markdown.Parse([]byte(p.Body), p.BodyLine).PlainText(false)
+		tf := map[string]float64{}
+		for _, t := range search.Tokenize(text) {
+			tf[t]++
+		}
+		for t := range tf {
+			df[t]++
+		}
+		tfs[i] = tf
+	}
+
+	vecs := make([]map[string]float64, len(posts))
+	for i, tf := range tfs {
+		v := make(map[string]float64, len(tf))
+		var norm float64
+		for t, n := range tf {
+			w := (1 + math.Log(n)) * math.Log(float64(len(posts))/float64(df[t]))
+			if w > 0 {
+				v[t] = w
+				norm += w * w
+			}
+		}
+		norm = math.Sqrt(norm)
+		for t := range v {
+			v[t] /= norm
+		}
+		vecs[i] = v
+	}
+	return func(i, j int) float64 {
+		a, b := vecs[i], vecs[j]
+		if len(a) > len(b) {
+			a, b = b, a
+		}
+		var dot float64
+		for t, w := range a {
+			dot += w * b[t]
+		}
+		return dot
+	}
+}
+
+// Encode returns related as data/related.json holds it.
+func Encode(related map[string][]string) ([]byte, error) {
+	b, err := json.MarshalIndent(related, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// Write encodes related to path, leaving the file alone if it's unchanged.
+// It reports whether the file was written.
+func Write(path string, related map[string][]string) (bool, error) {
+	b, err := Encode(related)
+	if err != nil {
+		return false, err
+	}
+	return fsutil.WriteIfChanged(path, b)
+}
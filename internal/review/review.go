@@ -0,0 +1,109 @@
+// Package review sizes a post up before it's published: how long it
+// runs, how hard its prose reads, and how much of it is code. Reading
+// time is internal/readtime's.
+package review
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Stats measure a post's body. Words, Sentences, and Syllables count the
+// prose only; CodeWords counts the words in its code blocks.
+type Stats struct {
+	Words      int
+	Sentences  int
+	Syllables  int
+	CodeBlocks int
+	CodeLines  int
+	CodeWords  int
+}
+
+// Measure reads p's body.
+func Measure(p *content.Post) Stats {
+	var s Stats
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	prose := doc.Interleaved(func(lang, src string) string {
+		s.CodeBlocks++
+		s.CodeLines += strings.Count(strings.TrimRight(src, "\n"), "\n") + 1
+		s.CodeWords += len(strings.Fields(src))
+		return ""
+	})
+	for _, line := range strings.Split(prose, "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		s.Words += len(words)
+		for _, w := range words {
+			s.Syllables += Syllables(w)
+		}
+		// A sentence ends at a word ending in a stop, and so does a
+		// heading or list item without one.
+		for i, w := range words {
+			w = strings.TrimRight(w, `"')]”’`)
+			if i == len(words)-1 || (w != "" && strings.ContainsRune(".!?", rune(w[len(w)-1]))) {
+				s.Sentences++
+			}
+		}
+	}
+	return s
+}
+
+// Readability is the prose's Flesch reading ease: 100 reads like a
+// children's book, 60 to 70 like plain English, and under 30 like a paper.
+func (s Stats) Readability() float64 {
+	if s.Words == 0 || s.Sentences == 0 {
+		return 0
+	}
+	return 206.835 - 1.015*float64(s.Words)/float64(s.Sentences) - 84.6*float64(s.Syllables)/float64(s.Words)
+}
+
+// Grade names the band a Flesch reading ease score falls in.
+func Grade(score float64) string {
+	switch {
+	case score >= 80:
+		return "easy"
+	case score >= 60:
+		return "plain English"
+	case score >= 50:
+		return "fairly difficult"
+	case score >= 30:
+		return "difficult"
+	default:
+		return "very difficult"
+	}
+}
+
+// CodeShare is the code's share of all the words, from 0 to 1.
+func (s Stats) CodeShare() float64 {
+	if s.Words+s.CodeWords == 0 {
+		return 0
+	}
+	return float64(s.CodeWords) / float64(s.Words+s.CodeWords)
+}
+
+// Syllables estimates the syllables in an English word by counting its
+// groups of vowels, less a silent final e. Words without letters, like
+// numbers, count as one.
+func Syllables(word string) int {
+	w := strings.ToLower(strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) }))
+	if w == "" {
+		return 1
+	}
+	n, prev := 0, false
+	for _, r := range w {
+		v := strings.ContainsRune("aeiouy", r)
+		if v && !prev {
+			n++
+		}
+		prev = v
+	}
+	if strings.HasSuffix(w, "e") && !strings.HasSuffix(w, "le") && n > 1 {
+		n--
+	}
+	return max(1, n)
+}
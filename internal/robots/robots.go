@@ -0,0 +1,209 @@
+// Package robots generates the site's robots.txt from the crawler policy
+// in data/crawlers.toml, along with the Cloudflare WAF rules that enforce
+// it for the crawlers that don't honor robots.txt, so the policy is kept
+// in one place instead of in hand-edited text and dashboard rules.
+package robots
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultPath is where the policy lives.
+const DefaultPath = "data/crawlers.toml"
+
+// Crawler is the policy for one user agent.
+type Crawler struct {
+	// UserAgent is the token the crawler matches in robots.txt, like
+	// "GPTBot".
+	UserAgent string `toml:"user_agent"`
+	// Operator and Purpose say whose it is and what it crawls for; they're
+	// written as a comment above its group.
+	Operator string `toml:"operator"`
+	Purpose  string `toml:"purpose"`
+	// Allow and Disallow are path prefixes. A crawler with neither is
+	// disallowed from the whole site, since listing it is opting out.
+	Allow    []string `toml:"allow"`
+	Disallow []string `toml:"disallow"`
+	// WAF blocks the crawler at the edge on the paths it's disallowed
+	// from, for the ones known to ignore robots.txt.
+	WAF bool `toml:"waf"`
+}
+
+// Policy is the whole file.
+type Policy struct {
+	// Default is the group for every other user agent.
+	Default Crawler `toml:"default"`
+	// Sitemap is the path of the sitemap, announced at the end.
+	Sitemap string    `toml:"sitemap"`
+	Crawler []Crawler `toml:"crawler"`
+}
+
+// Load reads the policy at path. A missing file is a policy that allows
+// everything.
+func Load(path string) (*Policy, error) {
+	p := &Policy{}
+	_, err := toml.DecodeFile(path, p)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("robots: %s: %w", path, err)
+	}
+	for i := range p.Crawler {
+		if c := &p.Crawler[i]; len(c.Allow) == 0 && len(c.Disallow) == 0 {
+			c.Disallow = []string{"/"}
+		}
+	}
+	return p, nil
+}
+
+// Validate returns what's wrong with the policy: user agents missing,
+// repeated, or with characters robots.txt doesn't allow in a token, paths
+// that don't start with /, and WAF rules for crawlers that are allowed
+// somewhere, which a WAF rule can't express.
+func (p *Policy) Validate() []error {
+	var errs []error
+	bad := func(who, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", who, fmt.Sprintf(format, args...)))
+	}
+	paths := func(who string, c Crawler) {
+		for _, path := range slices.Concat(c.Allow, c.Disallow) {
+			if !strings.HasPrefix(path, "/") {
+				bad(who, "path %q must start with /", path)
+			}
+		}
+	}
+	paths("default", p.Default)
+	if p.Default.UserAgent != "" && p.Default.UserAgent != "*" {
+		bad("default", "user_agent is always *")
+	}
+	if p.Default.WAF {
+		bad("default", "waf would block every visitor")
+	}
+	if p.Sitemap != "" && !strings.HasPrefix(p.Sitemap, "/") {
+		bad("sitemap", "%q must be a path starting with /", p.Sitemap)
+	}
+	seen := map[string]bool{}
+	for i, c := range p.Crawler {
+		who := c.UserAgent
+		switch {
+		case who == "":
+			bad(fmt.Sprintf("crawler %d", i+1), "no user_agent")
+			continue
+		case who == "*":
+			bad(who, "the default group is [default]")
+		case strings.ContainsAny(who, " \t:#\"\\"):
+			bad(who, "user_agent must be a single token")
+		case seen[strings.ToLower(who)]:
+			bad(who, "listed more than once")
+		}
+		seen[strings.ToLower(who)] = true
+		paths(who, c)
+		if c.WAF && len(c.Allow) > 0 {
+			bad(who, "waf can't honor allow; list only disallow")
+		}
+	}
+	return errs
+}
+
+// RobotsTxt renders the policy as robots.txt. base is the site's absolute
+// URL, for the sitemap line.
+func (p *Policy) RobotsTxt(base string) []byte {
+	var b bytes.Buffer
+	b.WriteString("# Generated by `blogctl robots` from data/crawlers.toml; edit that instead.\n")
+	group := func(c Crawler, agent string) {
+		b.WriteString("\n")
+		if about := strings.Trim(strings.Join([]string{c.Operator, c.Purpose}, ": "), ": "); about != "" {
+			fmt.Fprintf(&b, "# %s\n", about)
+		}
+		fmt.Fprintf(&b, "User-agent: %s\n", agent)
+		for _, path := range c.Allow {
+			fmt.Fprintf(&b, "Allow: %s\n", path)
+		}
+		for _, path := range c.Disallow {
+			fmt.Fprintf(&b, "Disallow: %s\n", path)
+		}
+		if len(c.Allow) == 0 && len(c.Disallow) == 0 {
+			// An empty Disallow allows everything.
+			b.WriteString("Disallow:\n")
+		}
+	}
+	for _, c := range p.Crawler {
+		group(c, c.UserAgent)
+	}
+	group(p.Default, "*")
+	if p.Sitemap != "" {
+		fmt.Fprintf(&b, "\nSitemap: %s%s\n", strings.TrimSuffix(base, "/"), p.Sitemap)
+	}
+	return b.Bytes()
+}
+
+// Rule is a Cloudflare WAF custom rule.
+type Rule struct {
+	Description string `json:"description"`
+	Expression  string `json:"expression"`
+	Action      string `json:"action"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// Ruleset is the body of a PUT to the zone's
+// http_request_firewall_custom phase entrypoint. The PUT replaces every
+// custom rule in the zone, so the payload is the zone's whole list.
+type Ruleset struct {
+	Rules []Rule `json:"rules"`
+}
+
+// WAF returns the rules that block the crawlers marked waf: one rule for
+// all the crawlers disallowed from the whole site, which keeps within the
+// free plan's few custom rules, and one for each crawler disallowed from
+// only some paths.
+func (p *Policy) WAF() Ruleset {
+	rs := Ruleset{Rules: []Rule{}}
+	var everywhere []string
+	for _, c := range p.Crawler {
+		if !c.WAF {
+			continue
+		}
+		if slices.Contains(c.Disallow, "/") {
+			everywhere = append(everywhere, c.UserAgent)
+			continue
+		}
+		var prefixes []string
+		for _, path := range c.Disallow {
+			prefixes = append(prefixes, fmt.Sprintf("starts_with(http.request.uri.path, %s)", strconv.Quote(path)))
+		}
+		rs.Rules = append(rs.Rules, Rule{
+			Description: fmt.Sprintf("Block %s from %s (blogctl robots)", c.UserAgent, strings.Join(c.Disallow, ", ")),
+			Expression:  fmt.Sprintf("%s and (%s)", agent(c.UserAgent), strings.Join(prefixes, " or ")),
+			Action:      "block",
+			Enabled:     true,
+		})
+	}
+	if len(everywhere) > 0 {
+		exprs := make([]string, len(everywhere))
+		for i, a := range everywhere {
+			exprs[i] = "(" + agent(a) + ")"
+		}
+		rs.Rules = slices.Insert(rs.Rules, 0, Rule{
+			Description: fmt.Sprintf("Block crawlers opted out in robots.txt: %s (blogctl robots)", strings.Join(everywhere, ", ")),
+			Expression:  strings.Join(exprs, " or "),
+			Action:      "block",
+			Enabled:     true,
+		})
+	}
+	return rs
+}
+
+// agent matches a user agent token the way robots.txt does, regardless of
+// case.
+func agent(token string) string {
+	return fmt.Sprintf("lower(http.user_agent) contains %s", strconv.Quote(strings.ToLower(token)))
+}
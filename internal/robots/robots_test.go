@@ -0,0 +1,123 @@
+package robots
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string // in the one error reported; "" for none
+	}{
+		{"valid", Policy{
+			Sitemap: "/sitemap.xml",
+			Crawler: []Crawler{
+				{UserAgent: "GPTBot", Disallow: []string{"/"}, WAF: true},
+				{UserAgent: "Googlebot", Allow: []string{"/"}, Disallow: []string{"/drafts/"}},
+			},
+		}, ""},
+		{"no user agent", Policy{Crawler: []Crawler{{Disallow: []string{"/"}}}}, "crawler 1: no user_agent"},
+		{"duplicate", Policy{Crawler: []Crawler{
+			{UserAgent: "GPTBot", Disallow: []string{"/"}},
+			{UserAgent: "gptbot", Disallow: []string{"/"}},
+		}}, "gptbot: listed more than once"},
+		{"wildcard", Policy{Crawler: []Crawler{{UserAgent: "*", Disallow: []string{"/"}}}}, "the default group is [default]"},
+		{"space in token", Policy{Crawler: []Crawler{{UserAgent: "Some Bot", Disallow: []string{"/"}}}}, "single token"},
+		{"colon in token", Policy{Crawler: []Crawler{{UserAgent: "Bot:1", Disallow: []string{"/"}}}}, "single token"},
+		{"relative path", Policy{Crawler: []Crawler{{UserAgent: "GPTBot", Disallow: []string{"private/"}}}}, `path "private/" must start with /`},
+		{"relative default path", Policy{Default: Crawler{Allow: []string{"posts"}}}, `default: path "posts"`},
+		{"waf with allow", Policy{Crawler: []Crawler{
+			{UserAgent: "Bytespider", Allow: []string{"/about/"}, Disallow: []string{"/"}, WAF: true},
+		}}, "waf can't honor allow"},
+		{"waf for everyone", Policy{Default: Crawler{WAF: true}}, "waf would block every visitor"},
+		{"default agent", Policy{Default: Crawler{UserAgent: "GPTBot"}}, "user_agent is always *"},
+		{"relative sitemap", Policy{Sitemap: "sitemap.xml"}, "must be a path starting with /"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.policy.Validate()
+			switch {
+			case tt.want == "" && len(errs) > 0:
+				t.Errorf("got %v, want no errors", errs)
+			case tt.want != "" && (len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.want)):
+				t.Errorf("got %v, want one error about %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestRobotsTxt(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string // after the header comment
+	}{
+		{"allow everything", Policy{},
+			"\nUser-agent: *\nDisallow:\n"},
+		{"groups in order, default last", Policy{
+			Default: Crawler{Disallow: []string{"/drafts/"}},
+			Crawler: []Crawler{
+				{UserAgent: "GPTBot", Operator: "OpenAI", Purpose: "model training", Disallow: []string{"/"}},
+				{UserAgent: "CCBot", Operator: "Common Crawl", Allow: []string{"/about/"}, Disallow: []string{"/"}},
+			},
+		}, "" +
+			"\n# OpenAI: model training\nUser-agent: GPTBot\nDisallow: /\n" +
+			"\n# Common Crawl\nUser-agent: CCBot\nAllow: /about/\nDisallow: /\n" +
+			"\nUser-agent: *\nDisallow: /drafts/\n"},
+		{"sitemap", Policy{Sitemap: "/sitemap.xml"},
+			"\nUser-agent: *\nDisallow:\n\nSitemap: https://example.org/sitemap.xml\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(tt.policy.RobotsTxt("https://example.org/"))
+			header, rest, _ := strings.Cut(got, "\n")
+			if !strings.HasPrefix(header, "# Generated by `blogctl robots`") {
+				t.Errorf("header = %q, want the generated-file comment", header)
+			}
+			if rest != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", rest, tt.want)
+			}
+		})
+	}
+}
+
+func TestWAF(t *testing.T) {
+	p := Policy{Crawler: []Crawler{
+		{UserAgent: "GPTBot", Disallow: []string{"/"}, WAF: true},
+		{UserAgent: "Googlebot", Disallow: []string{"/"}},
+		{UserAgent: "Amazonbot", Disallow: []string{"/notes/", "/tags/"}, WAF: true},
+		{UserAgent: "Bytespider", Disallow: []string{"/"}, WAF: true},
+	}}
+	rules := p.WAF().Rules
+	want := []Rule{
+		{
+			Description: "Block crawlers opted out in robots.txt: GPTBot, Bytespider (blogctl robots)",
+			Expression:  `(lower(http.user_agent) contains "gptbot") or (lower(http.user_agent) contains "bytespider")`,
+		},
+		{
+			Description: "Block Amazonbot from /notes/, /tags/ (blogctl robots)",
+			Expression: `lower(http.user_agent) contains "amazonbot" and ` +
+				`(starts_with(http.request.uri.path, "/notes/") or starts_with(http.request.uri.path, "/tags/"))`,
+		},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d: %+v", len(rules), len(want), rules)
+	}
+	for i, r := range rules {
+		if r.Description != want[i].Description {
+			t.Errorf("rules[%d].Description = %q, want %q", i, r.Description, want[i].Description)
+		}
+		if r.Expression != want[i].Expression {
+			t.Errorf("rules[%d].Expression = %q, want %q", i, r.Expression, want[i].Expression)
+		}
+		if r.Action != "block" || !r.Enabled {
+			t.Errorf("rules[%d] = %s, enabled %t; want an enabled block", i, r.Action, r.Enabled)
+		}
+	}
+
+	if rs := (&Policy{Crawler: []Crawler{{UserAgent: "GPTBot", Disallow: []string{"/"}}}}).WAF(); rs.Rules == nil || len(rs.Rules) > 0 {
+		t.Errorf("rules without waf crawlers = %#v, want an empty list, which clears the zone's rules", rs.Rules)
+	}
+}
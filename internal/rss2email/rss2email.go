@@ -0,0 +1,395 @@
+// Package rss2email mails each new post in the site's JSON Feed to the
+// subscribers, in place of a third-party feed-to-email service. The feed
+// already carries the whole rendered post; here it's made to survive
+// email clients: code blocks are highlighted with inline styles in a
+// wrapping <pre>, and the rest of the markup gets the styles the site's
+// stylesheet would have given it, since clients drop <style> blocks.
+//
+// Which posts went out is kept in data/rss2email.json, a post at a time,
+// so a failed run picks up where it stopped.
+package rss2email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/rednafi/rednafi.com/internal/feeds"
+	"github.com/rednafi/rednafi.com/internal/highlight"
+)
+
+// DefaultStatePath records the posts already mailed.
+const DefaultStatePath = "data/rss2email.json"
+
+// DefaultSubscribers lists the addresses to mail, one a line. It's kept
+// out of the repo.
+const DefaultSubscribers = "data/subscribers.txt"
+
+// State is what's been mailed.
+type State struct {
+	// Sent maps the ID of each post mailed, or skipped on the first run,
+	// to when.
+	Sent map[string]time.Time `json:"sent"`
+	// ETag is the feed's, for a conditional fetch.
+	ETag      string    `json:"etag,omitempty"`
+	LastCheck time.Time `json:"last_check"`
+}
+
+// LoadState reads the state at path. A missing file yields the zero
+// state, which Seed fills on the first run.
+func LoadState(path string) (State, error) {
+	var s State
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("rss2email: parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the state to path.
+func (s State) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// LoadSubscribers reads the addresses at path, one a line. Blank lines and
+// lines starting with # are skipped; anything else must be an address.
+func LoadSubscribers(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []string
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		a, err := mail.ParseAddress(line)
+		if err != nil {
+			return nil, fmt.Errorf("rss2email: %s:%d: %w", path, n, err)
+		}
+		if !slices.Contains(out, a.Address) {
+			out = append(out, a.Address)
+		}
+	}
+	return out, sc.Err()
+}
+
+// Fetch gets the JSON Feed at url. It returns nil without an error when
+// the feed hasn't changed since etag, along with the new ETag.
+func Fetch(ctx context.Context, client *http.Client, url, etag string) (*feeds.JSONFeedDoc, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/feed+json, application/json")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("rss2email: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("rss2email: %s: %s", url, resp.Status)
+	}
+	var doc feeds.JSONFeedDoc
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(&doc); err != nil {
+		return nil, "", fmt.Errorf("rss2email: %s: %w", url, err)
+	}
+	return &doc, resp.Header.Get("ETag"), nil
+}
+
+// Seed marks every post in doc as sent but the newest keep, on the first
+// run, so subscribers don't get the whole archive.
+func (s *State) Seed(doc *feeds.JSONFeedDoc, keep int, now time.Time) {
+	s.Sent = map[string]time.Time{}
+	items := Unsent(doc, *s)
+	for _, it := range items[:max(len(items)-keep, 0)] {
+		s.Sent[it.ID] = now
+	}
+}
+
+// Unsent returns doc's posts that haven't been mailed, oldest first.
+func Unsent(doc *feeds.JSONFeedDoc, s State) []feeds.JSONFeedItem {
+	var out []feeds.JSONFeedItem
+	for _, it := range doc.Items {
+		if _, ok := s.Sent[it.ID]; !ok {
+			out = append(out, it)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b feeds.JSONFeedItem) int {
+		return strings.Compare(a.DatePublished, b.DatePublished)
+	})
+	return out
+}
+
+// Email is the data the template renders.
+type Email struct {
+	SiteTitle string
+	SiteURL   string
+	Title     string
+	URL       string
+	Date      time.Time
+	Tags      []string
+	Summary   string
+	Body      template.HTML
+	// Unsubscribe is where the footer sends readers who want out.
+	Unsubscribe string
+}
+
+// NewEmail makes an email of it, a post of doc.
+func NewEmail(doc *feeds.JSONFeedDoc, it feeds.JSONFeedItem, unsubscribe string) (Email, error) {
+	body, err := Inline(it.ContentHTML)
+	if err != nil {
+		return Email{}, fmt.Errorf("rss2email: %s: %w", it.URL, err)
+	}
+	date, _ := time.Parse(time.RFC3339, it.DatePublished)
+	return Email{
+		SiteTitle:   doc.Title,
+		SiteURL:     doc.HomePageURL,
+		Title:       it.Title,
+		URL:         it.URL,
+		Date:        date,
+		Tags:        it.Tags,
+		Summary:     it.Summary,
+		Body:        template.HTML(body),
+		Unsubscribe: unsubscribe,
+	}, nil
+}
+
+//go:embed post.html
+var defaultTemplate string
+
+// Template parses the email template at path, or the built-in one if path
+// is empty. The template gets an Email and has a join function.
+func Template(path string) (*template.Template, error) {
+	src := defaultTemplate
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src = string(b)
+	}
+	return template.New("post").Funcs(template.FuncMap{"join": strings.Join}).Parse(src)
+}
+
+// Render executes t with e.
+func Render(t *template.Template, e Email) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, e); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// PlainText renders e as the text/plain alternative: the summary and a
+// link, since code and tables don't read as plain text.
+func PlainText(e Email) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s\n\n", e.Title, e.URL)
+	if e.Summary != "" {
+		b.WriteString(e.Summary + "\n\n")
+	}
+	fmt.Fprintf(&b, "Read the whole post at %s\n\n", e.URL)
+	fmt.Fprintf(&b, "-- \n%s\n%s\n", e.SiteTitle, e.SiteURL)
+	if e.Unsubscribe != "" {
+		fmt.Fprintf(&b, "Unsubscribe: %s\n", e.Unsubscribe)
+	}
+	return b.String()
+}
+
+// inlineStyles are the styles each element gets, ahead of any it has.
+var inlineStyles = map[atom.Atom]string{
+	atom.P:          "margin:0 0 16px 0; font-size:16px; line-height:1.6;",
+	atom.Li:         "margin:0 0 6px 0; font-size:16px; line-height:1.6;",
+	atom.A:          "color:#1a5fb4;",
+	atom.H2:         "margin:28px 0 12px 0; font-size:20px; line-height:1.35;",
+	atom.H3:         "margin:24px 0 10px 0; font-size:18px; line-height:1.35;",
+	atom.H4:         "margin:20px 0 8px 0; font-size:16px; line-height:1.35;",
+	atom.Blockquote: "margin:0 0 16px 0; padding:0 0 0 14px; border-left:3px solid #d0d0d0; color:#555555;",
+	atom.Img:        "max-width:100%; height:auto; border:0;",
+	atom.Table:      "margin:0 0 16px 0; border-collapse:collapse; font-size:14px;",
+	atom.Th:         "border:1px solid #d0d0d0; padding:4px 8px; text-align:left;",
+	atom.Td:         "border:1px solid #d0d0d0; padding:4px 8px;",
+	atom.Hr:         "border:0; border-top:1px solid #e0e0e0; margin:24px 0;",
+	atom.Code:       "font-family:Menlo, Consolas, 'Courier New', monospace; font-size:90%; background:#f2f2f2; padding:1px 4px; border-radius:3px;",
+}
+
+// preStyle keeps a code block readable on a phone: clients that can't
+// scroll sideways wrap the long lines instead of cutting them off.
+const preStyle = "margin:0 0 16px 0; padding:12px 14px; border-radius:4px; font-family:Menlo, Consolas, 'Courier New', monospace; font-size:13px; line-height:1.5; white-space:pre-wrap; word-wrap:break-word; overflow-x:auto;"
+
+// Inline rewrites a post's HTML for email: each <pre><code> is highlighted
+// with Chroma's inline styles, in the site's highlight style, and every
+// other element in inlineStyles gets its style attribute.
+func Inline(src string) (string, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(src), body)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	var walk func(n *html.Node) error
+	walk = func(n *html.Node) error {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && c.DataAtom == atom.Pre {
+				code, lang := codeOf(c)
+				out, err := highlightInline(lang, code)
+				if err != nil {
+					return err
+				}
+				n.InsertBefore(&html.Node{Type: html.RawNode, Data: out}, c)
+				n.RemoveChild(c)
+				c = next
+				continue
+			}
+			if c.Type == html.ElementNode {
+				if s, ok := inlineStyles[c.DataAtom]; ok {
+					addStyle(c, s)
+				}
+			}
+			if err := walk(c); err != nil {
+				return err
+			}
+			c = next
+		}
+		return nil
+	}
+	if err := walk(body); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// codeOf returns the text of a <pre> and the language its <code> names in
+// a language-* class, as goldmark renders a fence.
+func codeOf(pre *html.Node) (code, lang string) {
+	var b strings.Builder
+	var text func(n *html.Node)
+	text = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Code {
+			for _, a := range n.Attr {
+				if a.Key != "class" {
+					continue
+				}
+				for _, c := range strings.Fields(a.Val) {
+					if l, ok := strings.CutPrefix(c, "language-"); ok {
+						lang = l
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			text(c)
+		}
+	}
+	text(pre)
+	return b.String(), lang
+}
+
+// highlightInline renders code as lang with the colors in style
+// attributes, unknown languages as plain text.
+func highlightInline(lang, code string) (string, error) {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, strings.TrimRight(code, "\n")+"\n")
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", lang, err)
+	}
+	f := chromahtml.New(
+		chromahtml.WithClasses(false),
+		chromahtml.TabWidth(4),
+		chromahtml.WithPreWrapper(emailPre{}),
+		// Chroma's lines are flex boxes, which clients drop or won't
+		// wrap; inline, the newlines in the <pre> break them.
+		chromahtml.WithCustomCSS(map[chroma.TokenType]string{chroma.Line: "display: inline;"}),
+	)
+	var b strings.Builder
+	if err := f.Format(&b, styles.Get(highlight.DefaultStyle), it); err != nil {
+		return "", fmt.Errorf("%s: %w", lang, err)
+	}
+	return b.String(), nil
+}
+
+// emailPre is Chroma's <pre><code> with preStyle after the style's colors.
+type emailPre struct{}
+
+func (emailPre) Start(code bool, styleAttr string) string {
+	style := ` style="` + preStyle + `"`
+	if s, ok := strings.CutSuffix(styleAttr, `"`); ok {
+		style = s + " " + preStyle + `"`
+	}
+	if code {
+		return "<pre" + style + "><code>"
+	}
+	return "<pre" + style + ">"
+}
+
+func (emailPre) End(code bool) string {
+	if code {
+		return "</code></pre>"
+	}
+	return "</pre>"
+}
+
+// addStyle puts s ahead of n's own style, so the post's wins.
+func addStyle(n *html.Node, s string) {
+	for i, a := range n.Attr {
+		if a.Key == "style" {
+			n.Attr[i].Val = s + " " + a.Val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: s})
+}
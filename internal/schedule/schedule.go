@@ -0,0 +1,55 @@
+// Package schedule finds drafts whose publishDate has passed and flips
+// them live in place.
+package schedule
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// Due returns the drafts whose publishDate is set and not after now.
+func Due(posts []*content.Post, now time.Time) []*content.Post {
+	var out []*content.Post
+	for _, p := range posts {
+		if p.Draft && !p.PublishDate.IsZero() && !p.PublishDate.After(now) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+var (
+	yamlDraftRe = regexp.MustCompile(`(?m)^((?i:draft)\s*:\s*)(?:true|True|TRUE|yes|on)(\s*(?:#.*)?\r?)$`)
+	tomlDraftRe = regexp.MustCompile(`(?m)^((?i:draft)\s*=\s*)true(\s*(?:#.*)?\r?)$`)
+)
+
+// Publish sets draft to false in the front matter of the post file b,
+// leaving the rest of the file, comments included, as it was.
+func Publish(b []byte) ([]byte, error) {
+	fm, format, _, _, err := content.SplitFrontMatter(b)
+	if err != nil {
+		return nil, err
+	}
+	re := yamlDraftRe
+	switch format {
+	case content.TOML:
+		re = tomlDraftRe
+	case "":
+		return nil, errors.New("schedule: no front matter")
+	}
+	loc := re.FindSubmatchIndex(fm)
+	if loc == nil {
+		return nil, errors.New("schedule: no draft: true in the front matter")
+	}
+	// fm is a sub-slice of b, so their capacities give its offset.
+	start := cap(b) - cap(fm)
+	var out bytes.Buffer
+	out.Write(b[:start+loc[3]])
+	out.WriteString("false")
+	out.Write(b[start+loc[4]:])
+	return out.Bytes(), nil
+}
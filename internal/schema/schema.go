@@ -0,0 +1,304 @@
+// Package schema builds the schema.org structured data search engines read
+// for rich results, as JSON-LD: a BlogPosting and a BreadcrumbList for
+// each post, from its front matter, and the Person who writes them, from
+// the site config, for the home page. The data is injected into the pages
+// Hugo built, so no template hand-writes the script tags; the theme's own
+// schema_json partial is overridden to render nothing.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// Context is the vocabulary every item is in.
+const Context = "https://schema.org"
+
+// MaxHeadline is the longest headline Google shows in a rich result.
+const MaxHeadline = 110
+
+// Person is the author of the site.
+type Person struct {
+	Context string   `json:"@context,omitempty"`
+	Type    string   `json:"@type"`
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	SameAs  []string `json:"sameAs,omitempty"`
+}
+
+// BlogPosting is a post.
+type BlogPosting struct {
+	Context          string   `json:"@context"`
+	Type             string   `json:"@type"`
+	Headline         string   `json:"headline"`
+	Description      string   `json:"description,omitempty"`
+	URL              string   `json:"url"`
+	MainEntityOfPage WebPage  `json:"mainEntityOfPage"`
+	Image            []string `json:"image,omitempty"`
+	DatePublished    string   `json:"datePublished"`
+	DateModified     string   `json:"dateModified"`
+	Author           Person   `json:"author"`
+	Publisher        Person   `json:"publisher"`
+	Keywords         string   `json:"keywords,omitempty"`
+	InLanguage       string   `json:"inLanguage,omitempty"`
+}
+
+// WebPage is the page a post is the main entity of.
+type WebPage struct {
+	Type string `json:"@type"`
+	ID   string `json:"@id"`
+}
+
+// BreadcrumbList is the trail from the home page to a post.
+type BreadcrumbList struct {
+	Context         string     `json:"@context"`
+	Type            string     `json:"@type"`
+	ItemListElement []ListItem `json:"itemListElement"`
+}
+
+// ListItem is a step of a breadcrumb trail.
+type ListItem struct {
+	Type     string `json:"@type"`
+	Position int    `json:"position"`
+	Name     string `json:"name"`
+	Item     string `json:"item"`
+}
+
+// Author returns the site's author as cfg describes them, linked to the
+// profiles among the social icons.
+func Author(cfg *site.Config) Person {
+	p := Person{Type: "Person", Name: cfg.Params.Author, URL: cfg.Permalink("/")}
+	for _, s := range cfg.Params.SocialIcons {
+		if s.Name != "rss" && s.URL != "" {
+			p.SameAs = append(p.SameAs, s.URL)
+		}
+	}
+	return p
+}
+
+// Home returns the items for the home page.
+func Home(cfg *site.Config) []any {
+	p := Author(cfg)
+	p.Context = Context
+	return []any{p}
+}
+
+// Post returns the items for p's page. images are the site-relative or
+// absolute URLs of the images that represent it, best first.
+func Post(cfg *site.Config, p *content.Post, images []string) []any {
+	u := cfg.Permalink(p.RelPermalink())
+	author := Author(cfg)
+	desc := p.Description
+	if desc == "" {
+		desc = p.Summary
+	}
+	post := BlogPosting{
+		Context:          Context,
+		Type:             "BlogPosting",
+		Headline:         p.Title,
+		Description:      strings.TrimSpace(desc),
+		URL:              u,
+		MainEntityOfPage: WebPage{Type: "WebPage", ID: u},
+		DatePublished:    p.Date.Format(time.RFC3339),
+		DateModified:     p.Updated().Format(time.RFC3339),
+		Author:           author,
+		Publisher:        author,
+		Keywords:         strings.Join(p.Tags, ", "),
+		InLanguage:       cfg.LanguageCode,
+	}
+	for _, img := range images {
+		if !strings.Contains(img, "://") {
+			img = cfg.Permalink(img)
+		}
+		post.Image = append(post.Image, img)
+	}
+
+	crumbs := BreadcrumbList{Context: Context, Type: "BreadcrumbList"}
+	for i, c := range []struct{ name, url string }{
+		{cfg.Title, cfg.Permalink("/")},
+		{sectionName(p.Section), cfg.Permalink("/" + p.Section + "/")},
+		{p.Title, u},
+	} {
+		crumbs.ItemListElement = append(crumbs.ItemListElement, ListItem{
+			Type: "ListItem", Position: i + 1, Name: c.name, Item: c.url,
+		})
+	}
+	return []any{post, crumbs}
+}
+
+// sectionName is how the theme titles a section's list page.
+func sectionName(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return strings.ToUpper(string(r)) + s[n:]
+}
+
+// Images returns the images to list for p: the ones its images front
+// matter key names, then its Open Graph card if has reports that one was
+// rendered, then the site's default.
+func Images(cfg *site.Config, p *content.Post, has func(urlPath string) bool) []string {
+	var out []string
+	if list, ok := p.Params["images"].([]any); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	if card := path.Join("/images/og", p.Slug+".png"); has(card) {
+		out = append(out, card)
+	}
+	if len(out) == 0 {
+		out = append(out, cfg.Params.Images...)
+	}
+	return out
+}
+
+// Check returns what keeps items short of schema.org's and Google's
+// expectations for them: missing required properties, URLs that aren't
+// absolute, dates that aren't ISO 8601, and breadcrumbs out of order.
+func Check(items []any) []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	absolute := func(what, s string) {
+		if u, err := url.Parse(s); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			add("%s %q isn't an absolute URL", what, s)
+		}
+	}
+	person := func(what string, p Person) {
+		if p.Name == "" {
+			add("%s has no name", what)
+		}
+		absolute(what+" url", p.URL)
+	}
+	for _, item := range items {
+		switch v := item.(type) {
+		case Person:
+			person("Person", v)
+		case BlogPosting:
+			switch n := utf8.RuneCountInString(v.Headline); {
+			case n == 0:
+				add("BlogPosting has no headline")
+			case n > MaxHeadline:
+				add("BlogPosting headline is %d characters, more than %d", n, MaxHeadline)
+			}
+			absolute("BlogPosting url", v.URL)
+			if v.MainEntityOfPage.ID != v.URL {
+				add("BlogPosting mainEntityOfPage %q isn't its url", v.MainEntityOfPage.ID)
+			}
+			if len(v.Image) == 0 {
+				add("BlogPosting has no image")
+			}
+			for _, img := range v.Image {
+				absolute("BlogPosting image", img)
+			}
+			published, err := time.Parse(time.RFC3339, v.DatePublished)
+			if err != nil || published.IsZero() {
+				add("BlogPosting datePublished %q isn't an ISO 8601 date", v.DatePublished)
+			}
+			modified, err := time.Parse(time.RFC3339, v.DateModified)
+			switch {
+			case err != nil || modified.IsZero():
+				add("BlogPosting dateModified %q isn't an ISO 8601 date", v.DateModified)
+			case modified.Before(published):
+				add("BlogPosting dateModified is before datePublished")
+			}
+			person("BlogPosting author", v.Author)
+			person("BlogPosting publisher", v.Publisher)
+		case BreadcrumbList:
+			if len(v.ItemListElement) == 0 {
+				add("BreadcrumbList is empty")
+			}
+			for i, li := range v.ItemListElement {
+				if li.Position != i+1 {
+					add("BreadcrumbList item %d has position %d", i+1, li.Position)
+				}
+				if li.Name == "" {
+					add("BreadcrumbList item %d has no name", i+1)
+				}
+				absolute(fmt.Sprintf("BreadcrumbList item %d", i+1), li.Item)
+			}
+		default:
+			add("unknown item %T", item)
+		}
+	}
+	return problems
+}
+
+// ScriptID marks the script InjectPage adds, so running it again replaces
+// the script rather than adding another.
+const ScriptID = "schema-jsonld"
+
+// InjectPage adds items to the head of page, a page Hugo built, as a
+// JSON-LD script, replacing one added before.
+func InjectPage(page []byte, items []any) ([]byte, error) {
+	// A single item is written on its own, several as an array.
+	var v any = items
+	if len(items) == 1 {
+		v = items[0]
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	head := find(doc, atom.Head)
+	if head == nil {
+		return nil, fmt.Errorf("schema: no <head>")
+	}
+	for c := head.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.DataAtom == atom.Script && attr(c, "id") == ScriptID {
+			head.RemoveChild(c)
+		}
+		c = next
+	}
+	script := &html.Node{
+		Type: html.ElementNode, Data: "script", DataAtom: atom.Script,
+		Attr: []html.Attribute{{Key: "id", Val: ScriptID}, {Key: "type", Val: "application/ld+json"}},
+	}
+	script.AppendChild(&html.Node{Type: html.TextNode, Data: string(data)})
+	head.AppendChild(script)
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
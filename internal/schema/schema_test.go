@@ -0,0 +1,182 @@
+package schema
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+func testConfig() *site.Config {
+	cfg := &site.Config{BaseURL: "https://example.com", Title: "Example", LanguageCode: "en-us"}
+	cfg.Params.Author = "Jane Doe"
+	cfg.Params.SocialIcons = append(cfg.Params.SocialIcons,
+		struct {
+			Name string `yaml:"name"`
+			URL  string `yaml:"url"`
+		}{"github", "https://github.com/jane"},
+		struct {
+			Name string `yaml:"name"`
+			URL  string `yaml:"url"`
+		}{"rss", "https://example.com/index.xml"},
+	)
+	return cfg
+}
+
+func testPost(title string) *content.Post {
+	return &content.Post{
+		FrontMatter: content.FrontMatter{
+			Title:       title,
+			Date:        time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+			Lastmod:     time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC),
+			Tags:        []string{"Go", "Testing"},
+			Description: "  How to test things.  ",
+		},
+		Path:    "go/testing.md",
+		Section: "go",
+		Slug:    "testing",
+	}
+}
+
+// ldJSON returns the JSON-LD InjectPage wrote into page, decoded.
+func ldJSON(t *testing.T, page []byte) []map[string]any {
+	t.Helper()
+	m := regexp.MustCompile(`(?s)<script id="` + ScriptID + `" type="application/ld\+json">(.*?)</script>`).FindSubmatch(page)
+	if m == nil {
+		t.Fatalf("no JSON-LD script in %s", page)
+	}
+	var items []map[string]any
+	if err := json.Unmarshal(m[1], &items); err != nil {
+		t.Fatalf("JSON-LD %s: %v", m[1], err)
+	}
+	return items
+}
+
+func inject(t *testing.T, items []any) []map[string]any {
+	t.Helper()
+	page, err := InjectPage([]byte("<!DOCTYPE html><html><head><title>x</title></head><body></body></html>"), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ldJSON(t, page)
+}
+
+func TestPostBlogPosting(t *testing.T) {
+	cfg := testConfig()
+	items := Post(cfg, testPost("Testing in Go"), []string{"/images/og/testing.png", "https://cdn.example.com/a.png"})
+	if problems := Check(items); len(problems) > 0 {
+		t.Errorf("Check: %v", problems)
+	}
+	got := inject(t, items)[0]
+
+	want := map[string]any{
+		"@context":         Context,
+		"@type":            "BlogPosting",
+		"headline":         "Testing in Go",
+		"description":      "How to test things.",
+		"url":              "https://example.com/go/testing/",
+		"datePublished":    "2024-03-01T09:30:00Z",
+		"dateModified":     "2024-04-02T00:00:00Z",
+		"keywords":         "Go, Testing",
+		"inLanguage":       "en-us",
+		"mainEntityOfPage": map[string]any{"@type": "WebPage", "@id": "https://example.com/go/testing/"},
+		"image":            []any{"https://example.com/images/og/testing.png", "https://cdn.example.com/a.png"},
+	}
+	for k, v := range want {
+		if g, _ := json.Marshal(got[k]); string(g) != mustJSON(t, v) {
+			t.Errorf("%s = %s, want %s", k, g, mustJSON(t, v))
+		}
+	}
+	for _, k := range []string{"author", "publisher"} {
+		p, _ := got[k].(map[string]any)
+		if p["@type"] != "Person" || p["name"] != "Jane Doe" || p["url"] != "https://example.com/" {
+			t.Errorf("%s = %v, want the site's author", k, got[k])
+		}
+		if same, _ := json.Marshal(p["sameAs"]); string(same) != `["https://github.com/jane"]` {
+			t.Errorf("%s.sameAs = %s, want the profiles without the feed", k, same)
+		}
+	}
+}
+
+func TestPostBreadcrumbs(t *testing.T) {
+	got := inject(t, Post(testConfig(), testPost("Testing in Go"), nil))
+	if len(got) != 2 {
+		t.Fatalf("got %d items, want a BlogPosting and a BreadcrumbList", len(got))
+	}
+	crumbs := got[1]
+	if crumbs["@context"] != Context || crumbs["@type"] != "BreadcrumbList" {
+		t.Errorf("second item is %v %v, want a schema.org BreadcrumbList", crumbs["@context"], crumbs["@type"])
+	}
+	list, _ := crumbs["itemListElement"].([]any)
+	want := []struct{ name, item string }{
+		{"Example", "https://example.com/"},
+		{"Go", "https://example.com/go/"},
+		{"Testing in Go", "https://example.com/go/testing/"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d breadcrumbs, want %d", len(list), len(want))
+	}
+	for i, w := range want {
+		li, _ := list[i].(map[string]any)
+		if li["@type"] != "ListItem" || li["position"] != float64(i+1) || li["name"] != w.name || li["item"] != w.item {
+			t.Errorf("breadcrumb %d = %v, want ListItem %d %q %q", i, li, i+1, w.name, w.item)
+		}
+	}
+}
+
+func TestInjectPageEscapesScript(t *testing.T) {
+	title := `Ending a "script" with </script><script>alert(1)</script>`
+	page, err := InjectPage([]byte("<html><head></head><body></body></html>"), Post(testConfig(), testPost(title), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(page), "</script>"); n != 1 {
+		t.Fatalf("page has %d </script>, want just the one closing the JSON-LD:\n%s", n, page)
+	}
+	if got := ldJSON(t, page)[0]["headline"]; got != title {
+		t.Errorf("headline = %q, want %q", got, title)
+	}
+}
+
+func TestInjectPageReplaces(t *testing.T) {
+	page, err := InjectPage([]byte("<html><head></head><body></body></html>"), Home(testConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err = InjectPage(page, Home(testConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(page), `id="`+ScriptID+`"`); n != 1 {
+		t.Errorf("page has %d JSON-LD scripts after two runs, want 1", n)
+	}
+}
+
+func TestCheckReportsProblems(t *testing.T) {
+	items := Post(testConfig(), testPost("Testing in Go"), nil)
+	post := items[0].(BlogPosting)
+	post.Headline = strings.Repeat("x", MaxHeadline+1)
+	post.Image = []string{"/images/relative.png"}
+	post.DatePublished = "March 1, 2024"
+	items[0] = post
+	problems := Check(items)
+	for _, want := range []string{"headline", "image", "datePublished"} {
+		if !slices.ContainsFunc(problems, func(s string) bool { return strings.Contains(s, want) }) {
+			t.Errorf("Check didn't report the %s: %v", want, problems)
+		}
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
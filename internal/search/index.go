@@ -0,0 +1,255 @@
+// Package search builds the inverted index the client-side search UI loads
+// from static/search/index.json.
+//
+// The index maps each stemmed term to a postings list of [doc, weight]
+// pairs. A term's weight in a document is the sum over fields of
+// boost × (1 + ln tf), scaled by WeightScale and rounded to an integer to
+// keep the file small. The client derives IDF from the postings length and
+// tokenizes queries with the same rules as Tokenize.
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// IndexVersion is bumped whenever the index layout or the tokenizer
+// changes, which also invalidates the build cache.
+const IndexVersion = 1
+
+// WeightScale is the factor term weights are multiplied by before they're
+// rounded.
+const WeightScale = 10
+
+// Boosts weighs matches in each field.
+type Boosts struct {
+	Title float64 `json:"title"`
+	Tags  float64 `json:"tags"`
+	Body  float64 `json:"body"`
+}
+
+// DefaultBoosts ranks title matches above tag matches above body matches.
+var DefaultBoosts = Boosts{Title: 3, Tags: 2, Body: 1}
+
+// String formats b the way ParseBoosts reads it.
+func (b Boosts) String() string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	return "title=" + f(b.Title) + ",tags=" + f(b.Tags) + ",body=" + f(b.Body)
+}
+
+// ParseBoosts parses a comma-separated list like "title=3,body=1". Fields
+// that aren't mentioned keep their DefaultBoosts value.
+func ParseBoosts(s string) (Boosts, error) {
+	b := DefaultBoosts
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return b, fmt.Errorf("boost %q: want field=weight", kv)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || w < 0 {
+			return b, fmt.Errorf("boost %q: weight must be a non-negative number", kv)
+		}
+		switch strings.TrimSpace(k) {
+		case "title":
+			b.Title = w
+		case "tags":
+			b.Tags = w
+		case "body":
+			b.Body = w
+		default:
+			return b, fmt.Errorf("boost %q: unknown field %q", kv, k)
+		}
+	}
+	return b, nil
+}
+
+// Doc is what the UI displays for a search hit.
+type Doc struct {
+	URL   string   `json:"u"`
+	Title string   `json:"t"`
+	Date  string   `json:"d"`
+	Tags  []string `json:"g,omitempty"`
+}
+
+// Posting is a [doc index, weight] pair, encoded as a two-element array.
+type Posting [2]int
+
+// Index is the file the search UI loads.
+type Index struct {
+	Version int                  `json:"version"`
+	Boosts  Boosts               `json:"boosts"`
+	Docs    []Doc                `json:"docs"`
+	Terms   map[string][]Posting `json:"terms"`
+}
+
+// Cache holds each post's tokenized terms between runs so only new or
+// edited posts are re-tokenized.
+type Cache struct {
+	Version int                   `json:"version"`
+	Boosts  Boosts                `json:"boosts"`
+	Entries map[string]CacheEntry `json:"entries"`
+}
+
+// CacheEntry is one post's cached contribution to the index, keyed by its
+// content path.
+type CacheEntry struct {
+	Hash  string         `json:"hash"`
+	Doc   Doc            `json:"doc"`
+	Terms map[string]int `json:"terms"`
+}
+
+// LoadCache reads the cache at path. A missing or unreadable cache yields an
+// empty one, which makes the next build a full rebuild.
+func LoadCache(path string) *Cache {
+	c := &Cache{}
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, c)
+	}
+	if c.Entries == nil {
+		c.Entries = map[string]CacheEntry{}
+	}
+	return c
+}
+
+// Save writes the cache to path.
+func (c *Cache) Save(path string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// Stats reports how much of a build came from the cache.
+type Stats struct {
+	Docs    int
+	Indexed int
+	Cached  int
+}
+
+// Build indexes the published posts, reusing cache entries for posts whose
+// contents haven't changed. The cache is updated in place and pruned of
+// posts that no longer exist; a nil cache forces a full rebuild.
+func Build(posts []*content.Post, boosts Boosts, cache *Cache) (*Index, Stats) {
+	if cache == nil {
+		cache = &Cache{}
+	}
+	if cache.Version != IndexVersion || cache.Boosts != boosts || cache.Entries == nil {
+		*cache = Cache{Version: IndexVersion, Boosts: boosts, Entries: map[string]CacheEntry{}}
+	}
+
+	idx := &Index{Version: IndexVersion, Boosts: boosts, Docs: []Doc{}, Terms: map[string][]Posting{}}
+	var st Stats
+	seen := map[string]bool{}
+	for _, p := range content.Published(posts) {
+		seen[p.Path] = true
+		h := hash(p)
+		e, ok := cache.Entries[p.Path]
+		if ok && e.Hash == h {
+			st.Cached++
+		} else {
+			e = CacheEntry{Hash: h, Doc: newDoc(p), Terms: weigh(p, boosts)}
+			cache.Entries[p.Path] = e
+			st.Indexed++
+		}
+		n := len(idx.Docs)
+		idx.Docs = append(idx.Docs, e.Doc)
+		for t, w := range e.Terms {
+			idx.Terms[t] = append(idx.Terms[t], Posting{n, w})
+		}
+	}
+	for path := range cache.Entries {
+		if !seen[path] {
+			delete(cache.Entries, path)
+		}
+	}
+	// Map iteration is random; sort so unchanged content yields an
+	// identical file.
+	for _, ps := range idx.Terms {
+		sort.Slice(ps, func(i, j int) bool { return ps[i][0] < ps[j][0] })
+	}
+	st.Docs = len(idx.Docs)
+	return idx, st
+}
+
+func newDoc(p *content.Post) Doc {
+	return Doc{
+		URL:   p.RelPermalink(),
+		Title: p.Title,
+		Date:  p.Date.Format("2006-01-02"),
+		Tags:  p.Tags,
+	}
+}
+
+// weigh returns the scaled weight of every term in the post.
+func weigh(p *content.Post, b Boosts) map[string]int {
+	body := markdown.Parse([]byte(p.Body), p.BodyLine).PlainText(false)
+	fields := []struct {
+		text  string
+		boost float64
+	}{
+		{p.Title, b.Title},
+		{strings.Join(p.Tags, " "), b.Tags},
+		{body, b.Body},
+	}
+	score := map[string]float64{}
+	for _, f := range fields {
+		if f.boost == 0 {
+			continue
+		}
+		tf := map[string]int{}
+		for _, t := range Tokenize(f.text) {
+			tf[t]++
+		}
+		for t, n := range tf {
+			score[t] += f.boost * (1 + math.Log(float64(n)))
+		}
+	}
+	terms := make(map[string]int, len(score))
+	for t, s := range score {
+		if w := int(math.Round(s * WeightScale)); w > 0 {
+			terms[t] = w
+		}
+	}
+	return terms
+}
+
+// hash identifies a post's indexed contents.
+func hash(p *content.Post) string {
+	h := sha256.New()
+	for _, s := range []string{p.RelPermalink(), p.Title, p.Date.Format("2006-01-02"), strings.Join(p.Tags, "\x00"), p.Body} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Write encodes idx to path, leaving the file alone if it's unchanged. It
+// reports whether the file was written.
+func Write(path string, idx *Index) (bool, error) {
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return false, err
+	}
+	b = append(b, '\n')
+	return fsutil.WriteIfChanged(path, b)
+}
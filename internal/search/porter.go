@@ -0,0 +1,250 @@
+package search
+
+// Stem reduces an English word to its stem with the Porter algorithm
+// (M.F. Porter, 1980, "An algorithm for suffix stripping"). The word must
+// already be lowercase.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	b := []byte(word)
+	for _, c := range b {
+		if c < 'a' || c > 'z' {
+			return word // leave identifiers like "utf8" or "sqlite3" alone
+		}
+	}
+	s := &stemmer{b: b}
+	s.step1ab()
+	s.step1c()
+	s.step2()
+	s.step3()
+	s.step4()
+	s.step5()
+	return string(s.b)
+}
+
+type stemmer struct {
+	b []byte
+	j int // end of the stem once a suffix has matched
+}
+
+// cons reports whether b[i] is a consonant.
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	}
+	return true
+}
+
+// m measures the number of consonant sequences in b[:j+1]: for
+// [C](VC){m}[V], it returns m.
+func (s *stemmer) m() int {
+	n, i := 0, 0
+	for {
+		if i > s.j {
+			return n
+		}
+		if !s.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > s.j {
+				return n
+			}
+			if s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > s.j {
+				return n
+			}
+			if !s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+// vowelInStem reports whether b[:j+1] contains a vowel.
+func (s *stemmer) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doublec reports whether b[i-1:i+1] is a double consonant.
+func (s *stemmer) doublec(i int) bool {
+	return i >= 1 && s.b[i] == s.b[i-1] && s.cons(i)
+}
+
+// cvc reports whether b[i-2:i+1] is consonant-vowel-consonant with the last
+// consonant not w, x, or y. It's used to restore an e in words like hop(e).
+func (s *stemmer) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+	switch s.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether the word ends with suffix and, if so, sets j to the
+// end of the remaining stem.
+func (s *stemmer) ends(suffix string) bool {
+	n := len(suffix)
+	if n > len(s.b) || string(s.b[len(s.b)-n:]) != suffix {
+		return false
+	}
+	s.j = len(s.b) - n - 1
+	return true
+}
+
+// setTo replaces the suffix after j with r.
+func (s *stemmer) setTo(r string) {
+	s.b = append(s.b[:s.j+1], r...)
+}
+
+// r replaces the suffix with r if the stem's measure is positive.
+func (s *stemmer) r(r string) {
+	if s.m() > 0 {
+		s.setTo(r)
+	}
+}
+
+// step1ab removes plurals and -ed or -ing.
+func (s *stemmer) step1ab() {
+	if s.b[len(s.b)-1] == 's' {
+		switch {
+		case s.ends("sses"):
+			s.b = s.b[:len(s.b)-2]
+		case s.ends("ies"):
+			s.setTo("i")
+		case len(s.b) > 1 && s.b[len(s.b)-2] != 's':
+			s.b = s.b[:len(s.b)-1]
+		}
+	}
+	if s.ends("eed") {
+		if s.m() > 0 {
+			s.b = s.b[:len(s.b)-1]
+		}
+		return
+	}
+	if (s.ends("ed") || s.ends("ing")) && s.vowelInStem() {
+		s.b = s.b[:s.j+1]
+		switch {
+		case s.ends("at"):
+			s.setTo("ate")
+		case s.ends("bl"):
+			s.setTo("ble")
+		case s.ends("iz"):
+			s.setTo("ize")
+		case s.doublec(len(s.b) - 1):
+			switch s.b[len(s.b)-1] {
+			case 'l', 's', 'z':
+			default:
+				s.b = s.b[:len(s.b)-1]
+			}
+		default:
+			s.j = len(s.b) - 1
+			if s.m() == 1 && s.cvc(len(s.b)-1) {
+				s.b = append(s.b, 'e')
+			}
+		}
+	}
+}
+
+// step1c turns a terminal y into i when there's another vowel in the stem.
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[len(s.b)-1] = 'i'
+	}
+}
+
+// step2 maps double suffixes to single ones, e.g. -ization to -ize.
+func (s *stemmer) step2() {
+	if len(s.b) < 2 {
+		return
+	}
+	for _, p := range step2Suffixes[s.b[len(s.b)-2]] {
+		if s.ends(p[0]) {
+			s.r(p[1])
+			return
+		}
+	}
+}
+
+var step2Suffixes = map[byte][][2]string{
+	'a': {{"ational", "ate"}, {"tional", "tion"}},
+	'c': {{"enci", "ence"}, {"anci", "ance"}},
+	'e': {{"izer", "ize"}},
+	'l': {{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"}},
+	'o': {{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}},
+	's': {{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"}},
+	't': {{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}},
+	'g': {{"logi", "log"}},
+}
+
+// step3 handles -ic-, -full, -ness and friends.
+func (s *stemmer) step3() {
+	for _, p := range [][2]string{
+		{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+		{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+	} {
+		if s.ends(p[0]) {
+			s.r(p[1])
+			return
+		}
+	}
+}
+
+// step4 strips -ant, -ence, and the rest when the stem is long enough.
+func (s *stemmer) step4() {
+	for _, suf := range []string{
+		"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement",
+		"ment", "ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+	} {
+		if !s.ends(suf) {
+			continue
+		}
+		if suf == "ion" && (s.j < 0 || (s.b[s.j] != 's' && s.b[s.j] != 't')) {
+			return
+		}
+		if s.m() > 1 {
+			s.b = s.b[:s.j+1]
+		}
+		return
+	}
+}
+
+// step5 removes a final -e and reduces -ll to -l on long stems.
+func (s *stemmer) step5() {
+	s.j = len(s.b) - 1
+	if s.b[len(s.b)-1] == 'e' {
+		s.j = len(s.b) - 2
+		if m := s.m(); m > 1 || (m == 1 && !s.cvc(len(s.b)-2)) {
+			s.b = s.b[:len(s.b)-1]
+		}
+	}
+	s.j = len(s.b) - 1
+	if s.b[len(s.b)-1] == 'l' && s.doublec(len(s.b)-1) && s.m() > 1 {
+		s.b = s.b[:len(s.b)-1]
+	}
+}
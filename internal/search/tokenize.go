@@ -0,0 +1,49 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits s into lowercase words, drops stopwords and single
+// characters, and stems what's left. The client runs the same steps on the
+// query, so any change here needs a matching change in the search UI and a
+// bump of IndexVersion.
+func Tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	toks := words[:0]
+	for _, w := range words {
+		if len([]rune(w)) < 2 || stopwords[w] {
+			continue
+		}
+		toks = append(toks, Stem(w))
+	}
+	return toks
+}
+
+// IsStopword reports whether Tokenize drops w, which must be lowercase.
+func IsStopword(w string) bool { return stopwords[w] }
+
+// stopwords is a short English stopword list. It's deliberately smaller
+// than the usual ones so that words like "new" or "first" that show up in
+// post titles stay searchable.
+var stopwords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(`
+		a about above after again against all am an and any are as at be
+		because been before being below between both but by can could did do
+		does doing down during each few for from further had has have having
+		he her here hers herself him himself his how i if in into is it its
+		itself just me more most my myself no nor not of off on once only or
+		other our ours ourselves out over own same she should so some such
+		than that the their theirs them themselves then there these they this
+		those through to too under until up very was we were what when where
+		which while who whom why will with would you your yours yourself
+		yourselves ll re ve don doesn didn isn wasn aren weren won
+	`) {
+		m[w] = true
+	}
+	return m
+}()
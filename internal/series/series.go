@@ -0,0 +1,184 @@
+// Package series groups the posts that set the same `series` front matter
+// key into a numbered series, checks the numbering, and builds the data
+// the series partial and the series index page read as site.Data.series.
+//
+// A post joins a series with both keys:
+//
+//	series: "Go concurrency"
+//	part: 2
+package series
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultPath is where templates read the series from, as
+// site.Data.series.
+const DefaultPath = "data/series.json"
+
+// IndexURL is the page that lists every series; each one is anchored there
+// by its slug.
+const IndexURL = "/series/"
+
+// Data is what gets written to DefaultPath.
+type Data struct {
+	// Series lists every series, the most recently extended first.
+	Series []*Series `json:"series"`
+	// Posts maps the slug of each post in a series to its place in it.
+	Posts map[string]Nav `json:"posts"`
+}
+
+// Series is a set of posts meant to be read in order.
+type Series struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	URL   string `json:"url"`
+	Parts []Part `json:"parts"`
+}
+
+// Part is a post in a series.
+type Part struct {
+	Part  int    `json:"part"`
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Date  string `json:"date"`
+}
+
+// Nav is a post's place in its series, for the prev/next links.
+type Nav struct {
+	Series string `json:"series"`
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Part   int    `json:"part"`
+	Total  int    `json:"total"`
+	Prev   *Part  `json:"prev,omitempty"`
+	Next   *Part  `json:"next,omitempty"`
+}
+
+// Problem is a numbering mistake in a series.
+type Problem struct {
+	Path string
+	Msg  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Msg)
+}
+
+// Slug returns the series name as it appears in URLs and as the key of
+// the data, the way Hugo urlizes it.
+func Slug(name string) string {
+	return content.TagSlug(name)
+}
+
+// Build groups the published posts into series and numbers them. Parts
+// must run 1, 2, 3 and so on with no gaps and no number used twice; every
+// mistake is returned as a problem, and the data is built anyway with the
+// parts in their numbered order.
+func Build(posts []*content.Post) (*Data, []Problem) {
+	bySlug := map[string]*Series{}
+	paths := map[string][]string{}
+	var problems []Problem
+	seriesOf := func(p *content.Post) (*Series, bool) {
+		name := strings.TrimSpace(p.Series)
+		if name == "" {
+			if p.Part != 0 {
+				problems = append(problems, Problem{p.Path, fmt.Sprintf("part %d without a series", p.Part)})
+			}
+			return nil, false
+		}
+		s, ok := bySlug[Slug(name)]
+		if !ok {
+			s = &Series{Name: name, Slug: Slug(name), URL: IndexURL + "#" + Slug(name)}
+			bySlug[s.Slug] = s
+		} else if s.Name != name {
+			problems = append(problems, Problem{p.Path, fmt.Sprintf("series %q is spelled %q in other posts", name, s.Name)})
+		}
+		if p.Part < 1 {
+			problems = append(problems, Problem{p.Path, fmt.Sprintf("series %q: part must be 1 or more", s.Name)})
+			return s, false
+		}
+		return s, true
+	}
+
+	// Oldest first, so the first-published spelling of a name wins and
+	// parts with the same number keep their publishing order.
+	published := content.Published(posts)
+	slices.Reverse(published)
+	for _, p := range published {
+		s, ok := seriesOf(p)
+		if !ok {
+			continue
+		}
+		s.Parts = append(s.Parts, Part{
+			Part:  p.Part,
+			Slug:  p.Slug,
+			Title: p.Title,
+			URL:   p.RelPermalink(),
+			Date:  p.Date.Format("2006-01-02"),
+		})
+		paths[s.Slug] = append(paths[s.Slug], p.Path)
+	}
+
+	d := &Data{Series: []*Series{}, Posts: map[string]Nav{}}
+	latest := map[string]string{}
+	for _, s := range bySlug {
+		if len(s.Parts) == 0 {
+			continue
+		}
+		byPart := map[int]string{}
+		for i, part := range s.Parts {
+			if prev, dup := byPart[part.Part]; dup {
+				problems = append(problems, Problem{paths[s.Slug][i],
+					fmt.Sprintf("series %q: part %d is also %s", s.Name, part.Part, prev)})
+				continue
+			}
+			byPart[part.Part] = paths[s.Slug][i]
+			latest[s.Slug] = max(latest[s.Slug], part.Date)
+		}
+		slices.SortStableFunc(s.Parts, func(a, b Part) int { return a.Part - b.Part })
+		last := s.Parts[len(s.Parts)-1].Part
+		for want := 1; want < last; want++ {
+			if _, ok := byPart[want]; !ok {
+				problems = append(problems, Problem{byPart[last],
+					fmt.Sprintf("series %q: part %d is missing", s.Name, want)})
+			}
+		}
+		for i, part := range s.Parts {
+			nav := Nav{Series: s.Slug, Name: s.Name, URL: s.URL, Part: part.Part, Total: len(s.Parts)}
+			if i > 0 {
+				nav.Prev = &s.Parts[i-1]
+			}
+			if i+1 < len(s.Parts) {
+				nav.Next = &s.Parts[i+1]
+			}
+			d.Posts[part.Slug] = nav
+		}
+		d.Series = append(d.Series, s)
+	}
+	slices.SortFunc(d.Series, func(a, b *Series) int {
+		if c := strings.Compare(latest[b.Slug], latest[a.Slug]); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Slug, b.Slug)
+	})
+	slices.SortFunc(problems, func(a, b Problem) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Msg, b.Msg)
+	})
+	return d, problems
+}
+
+// Write encodes d to path, leaving the file alone if it's unchanged. It
+// reports whether the file was written.
+func Write(path string, d *Data) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, d)
+}
@@ -0,0 +1,185 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Paths the live reload script and socket are served at.
+const (
+	ReloadScript = "/__livereload.js"
+	ReloadSocket = "/__livereload"
+)
+
+// script reconnects after the server restarts, so a reload isn't missed
+// for long.
+const script = `(() => {
+  const connect = () => {
+    const ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "` + ReloadSocket + `");
+    ws.onmessage = () => location.reload();
+    ws.onclose = () => setTimeout(connect, 1000);
+  };
+  connect();
+})();
+`
+
+// Reloader tells the open pages to reload.
+type Reloader struct {
+	mu    sync.Mutex
+	conns map[*websocket.Conn]bool
+}
+
+// NewReloader returns a Reloader with no pages open.
+func NewReloader() *Reloader {
+	return &Reloader{conns: map[*websocket.Conn]bool{}}
+}
+
+// Reload sends every open page the reload message.
+func (r *Reloader) Reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for ws := range r.conns {
+		if err := websocket.Message.Send(ws, "reload"); err != nil {
+			ws.Close()
+			delete(r.conns, ws)
+		}
+	}
+}
+
+func (r *Reloader) accept(ws *websocket.Conn) {
+	r.mu.Lock()
+	r.conns[ws] = true
+	r.mu.Unlock()
+	// Pages don't send anything; reading just notices when they go.
+	_, _ = io.Copy(io.Discard, ws)
+	r.mu.Lock()
+	delete(r.conns, ws)
+	r.mu.Unlock()
+}
+
+// LiveReload serves the reload socket and script alongside h, and adds the
+// script to the HTML pages h serves. Responses aren't cached, so a reload
+// always shows the latest build.
+func LiveReload(h http.Handler, r *Reloader) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(ReloadSocket, websocket.Handler(r.accept))
+	mux.HandleFunc(ReloadScript, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		io.WriteString(w, script)
+	})
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Whole pages only, since the script changes their length, and as
+		// GETs, so a HEAD reports the length a GET would send.
+		head := req.Method == http.MethodHead
+		req = req.Clone(req.Context())
+		req.Header.Del("Range")
+		req.Method = http.MethodGet
+		buf := &buffer{header: http.Header{}, status: http.StatusOK}
+		h.ServeHTTP(buf, req)
+		body := buf.body.Bytes()
+		if strings.HasPrefix(buf.header.Get("Content-Type"), "text/html") {
+			tag := []byte(`<script src="` + ReloadScript + `"></script>`)
+			if i := bytes.LastIndex(body, []byte("</body>")); i >= 0 {
+				body = append(body[:i:i], append(tag, body[i:]...)...)
+			} else {
+				body = append(body, tag...)
+			}
+		}
+		for k, v := range buf.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		if buf.status != http.StatusNotModified {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		w.WriteHeader(buf.status)
+		if !head {
+			_, _ = w.Write(body)
+		}
+	}))
+	return mux
+}
+
+// buffer holds a response so the page can be edited before it's sent.
+type buffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *buffer) Header() http.Header         { return b.header }
+func (b *buffer) WriteHeader(status int)      { b.status = status }
+func (b *buffer) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+// Watch calls changed each time a file under paths is added, removed, or
+// modified, checking every interval until ctx is done. Hidden files and
+// directories are skipped.
+func Watch(ctx context.Context, paths []string, interval time.Duration, changed func()) {
+	last := fingerprint(paths)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if fp := fingerprint(paths); fp != last {
+				last = fp
+				changed()
+			}
+		}
+	}
+}
+
+// fingerprint sums the names, sizes, and modification times of the files
+// under paths.
+func fingerprint(paths []string) string {
+	h := sha256.New()
+	for _, root := range paths {
+		_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if fi, err := d.Info(); err == nil {
+				fmt.Fprintf(h, "%s\x00%d\x00%d\n", p, fi.Size(), fi.ModTime().UnixNano())
+			}
+			return nil
+		})
+	}
+	return string(h.Sum(nil))
+}
+
+// Sources returns the ones among Hugo's inputs that exist under root.
+func Sources(root string) []string {
+	var out []string
+	for _, p := range []string{"content", "layouts", "static", "data", "assets", "themes", "i18n", "config.yml"} {
+		p = filepath.Join(root, p)
+		if _, err := os.Stat(p); err == nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,212 @@
+// Package serve serves a built site locally the way production does: the
+// redirects from data/redirects.toml answer before any file, as Cloudflare
+// Bulk Redirects do; directories are served from their index.html, with a
+// redirect to the trailing slash; missing paths get 404.html with a 404;
+// and every response carries the headers data/headers.toml gives its path,
+// or the built site's _headers file, with each page's own
+// Content-Security-Policy, once `blogctl csp` has written it, and the
+// ETag R2 would send with it.
+package serve
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/headers"
+	"github.com/rednafi/rednafi.com/internal/redirects"
+)
+
+// NotFound is the page served for missing paths.
+const NotFound = "/404.html"
+
+type handler struct {
+	dir       string
+	policy    *headers.Policy
+	redirects map[string]redirects.Redirect
+
+	// built is the policy from dir's _headers file, read again when the
+	// file's modification time moves on from mtime.
+	mu    sync.Mutex
+	built *headers.Policy
+	mtime time.Time
+}
+
+// Handler serves the site built into dir, with the headers from its
+// _headers file if it has one and from policy otherwise.
+func Handler(dir string, policy *headers.Policy, rs []redirects.Redirect) http.Handler {
+	h := &handler{dir: dir, policy: policy, redirects: map[string]redirects.Redirect{}}
+	for _, r := range rs {
+		h.redirects[r.From] = r
+	}
+	return h
+}
+
+// headers returns the policy for the current build.
+func (h *handler) headers() *headers.Policy {
+	file := filepath.Join(h.dir, headers.File)
+	fi, err := os.Stat(file)
+	if err != nil {
+		return h.policy
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.built == nil || !fi.ModTime().Equal(h.mtime) {
+		f, err := os.Open(file)
+		if err != nil {
+			return h.policy
+		}
+		defer f.Close()
+		p, err := headers.Parse(f)
+		if err != nil {
+			return h.policy
+		}
+		h.built, h.mtime = p, fi.ModTime()
+	}
+	return h.built
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	// Bulk Redirects match the source URL exactly and keep the query.
+	if rd, ok := h.redirects[r.URL.Path]; ok {
+		to := rd.To
+		if r.URL.RawQuery != "" {
+			to += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, to, rd.Status)
+		return
+	}
+
+	p := r.URL.Path
+	// The headers file is configuration, not content.
+	if clean := path.Clean(p); !strings.HasPrefix(p, "/") || p != clean && p != clean+"/" || p == "/"+headers.File {
+		h.notFound(w, r)
+		return
+	}
+	file := filepath.Join(h.dir, filepath.FromSlash(p))
+	fi, err := os.Stat(file)
+	switch {
+	case err != nil:
+		h.notFound(w, r)
+		return
+	case fi.IsDir() && !strings.HasSuffix(p, "/"):
+		to := p + "/"
+		if r.URL.RawQuery != "" {
+			to += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, to, http.StatusMovedPermanently)
+		return
+	case fi.IsDir():
+		// Headers are by the URL, as at the edge, not the file.
+		file = filepath.Join(file, "index.html")
+	}
+	h.file(w, r, p, file, http.StatusOK)
+}
+
+func (h *handler) notFound(w http.ResponseWriter, r *http.Request) {
+	h.file(w, r, NotFound, filepath.Join(h.dir, filepath.FromSlash(NotFound)), http.StatusNotFound)
+}
+
+// file serves the file at path on disk as the URL path p with status.
+func (h *handler) file(w http.ResponseWriter, r *http.Request, p, file string, status int) {
+	fail := func() {
+		if status == http.StatusNotFound {
+			// There's no 404.html to serve.
+			http.NotFound(w, r)
+			return
+		}
+		h.notFound(w, r)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		fail()
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		fail()
+		return
+	}
+	policy := h.headers()
+	for k, v := range policy.For(p) {
+		w.Header()[k] = v
+	}
+	c := policy.CacheFor(p)
+	if c.Control != "" {
+		w.Header().Set("Cache-Control", c.Control)
+	}
+	// R2 tags every object with the MD5 of its contents; a file the
+	// policy lets clients revalidate gets the same here.
+	if c.ETag {
+		sum := md5.New()
+		if _, err := io.Copy(sum, f); err == nil {
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum.Sum(nil))+`"`)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			fail()
+			return
+		}
+	}
+	if status != http.StatusOK {
+		// ServeContent only writes 200s and ranges.
+		if ctype := mime.TypeByExtension(filepath.Ext(file)); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			_, _ = f.WriteTo(w)
+		}
+		return
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+// SelfSigned returns a certificate for localhost, made up for this run,
+// so browsers speak HTTP/2 to the server once they're told to trust it.
+func SelfSigned() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
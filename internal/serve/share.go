@@ -0,0 +1,103 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"time"
+)
+
+// DefaultTunnel opens a Cloudflare quick tunnel, a temporary public URL
+// that needs no account, to the local URL appended to it.
+var DefaultTunnel = []string{"cloudflared", "tunnel", "--no-autoupdate", "--url"}
+
+// tunnelRe matches the URL a quick tunnel reports on stderr.
+var tunnelRe = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+
+// Tunnel runs command with local appended and returns the public URL it
+// reports. The tunnel stays open until ctx is done.
+func Tunnel(ctx context.Context, command []string, local string) (string, error) {
+	cmd := exec.CommandContext(ctx, command[0], append(command[1:], local)...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+	cmd.Stdout = cmd.Stderr
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("serve: tunnel: %w", err)
+	}
+	found := make(chan string, 1)
+	go func() {
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			if u := tunnelRe.FindString(sc.Text()); u != "" {
+				found <- u
+				break
+			}
+		}
+		// Keep draining, or the tunnel blocks writing its log.
+		_, _ = io.Copy(io.Discard, stderr)
+		_ = cmd.Wait()
+		close(found)
+	}()
+	select {
+	case u, ok := <-found:
+		if !ok {
+			return "", errors.New("serve: tunnel exited without a URL")
+		}
+		return u, nil
+	case <-time.After(30 * time.Second):
+		_ = cmd.Process.Kill()
+		return "", errors.New("serve: tunnel didn't report a URL within 30s")
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// NewToken returns a random token for Protect.
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// tokenCookie keeps a reader signed in after the shared link's first visit.
+const tokenCookie = "preview_token"
+
+// Protect serves h only to requests that carry token: as the token query
+// parameter, which is swapped for a cookie and dropped from the URL, or as
+// that cookie. Anyone else gets a 403, so a shared link is as private as
+// the token in it.
+func Protect(h http.Handler, token string) http.Handler {
+	valid := func(s string) bool { return subtle.ConstantTimeCompare([]byte(s), []byte(token)) == 1 }
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if t := q.Get("token"); t != "" && valid(t) {
+			http.SetCookie(w, &http.Cookie{
+				Name: tokenCookie, Value: token, Path: "/",
+				HttpOnly: true, Secure: r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+				SameSite: http.SameSiteLaxMode,
+			})
+			q.Del("token")
+			u := *r.URL
+			u.RawQuery = q.Encode()
+			http.Redirect(w, r, u.RequestURI(), http.StatusFound)
+			return
+		}
+		if c, err := r.Cookie(tokenCookie); err != nil || !valid(c.Value) {
+			http.Error(w, "This preview needs the link it was shared with.", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+// Package shortlink mints short codes for posts, served as
+// rednafi.com/s/<code> by cmd/shortlinkd, and counts their clicks.
+package shortlink
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+)
+
+// DefaultPath is where the codes live. It's checked in, since a code must
+// never change once it's been shared, and templates read it as
+// site.Data.shortlinks.
+const DefaultPath = "data/shortlinks.json"
+
+// Prefix is the path short links are served under.
+const Prefix = "/s/"
+
+// MinLength is the length of a new code unless a shorter one collides.
+const MinLength = 4
+
+// Links maps a post's slug to its code.
+type Links map[string]string
+
+// Load reads the links at path. A missing file yields no links.
+func Load(path string) (Links, error) {
+	l := Links{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, fmt.Errorf("shortlink: parse %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Save writes the links to path.
+func (l Links) Save(path string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Codes maps each code to its slug. Two slugs sharing a code is an error;
+// it can only come from a hand edit.
+func (l Links) Codes() (map[string]string, error) {
+	out := make(map[string]string, len(l))
+	for slug, code := range l {
+		if prev, ok := out[code]; ok {
+			return nil, fmt.Errorf("shortlink: %q is the code of both %q and %q", code, prev, slug)
+		}
+		out[code] = slug
+	}
+	return out, nil
+}
+
+var codeRe = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+
+// ValidCode reports whether code could have been minted.
+func ValidCode(code string) bool { return codeRe.MatchString(code) }
+
+// Mint returns slug's code, minting one if it has none and reporting
+// whether it did. A new code is the slug's hash in base 62, cut to
+// MinLength characters or as many more as it takes to be unique, so
+// minting the same slugs in any order mostly agrees.
+func (l Links) Mint(slug string) (code string, minted bool) {
+	if code, ok := l[slug]; ok {
+		return code, false
+	}
+	taken := make(map[string]bool, len(l))
+	for _, c := range l {
+		taken[c] = true
+	}
+	sum := sha256.Sum256([]byte(slug))
+	full := new(big.Int).SetBytes(sum[:]).Text(62)
+	n := MinLength
+	for n < len(full) && taken[full[:n]] {
+		n++
+	}
+	l[slug] = full[:n]
+	return full[:n], true
+}
@@ -0,0 +1,69 @@
+package shortlink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Store counts clicks per code in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS clicks (
+	code   TEXT PRIMARY KEY,
+	clicks INTEGER NOT NULL,
+	last   INTEGER NOT NULL
+);
+`
+
+// OpenStore opens (or creates) the database at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("shortlink: init %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error { return s.db.Close() }
+
+// Click counts a click on code at now.
+func (s *Store) Click(ctx context.Context, code string, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO clicks (code, clicks, last) VALUES (?, 1, ?)
+		ON CONFLICT (code) DO UPDATE SET clicks = clicks + 1, last = excluded.last`,
+		code, now.Unix())
+	return err
+}
+
+// Clicks returns the clicks of every code that has any.
+func (s *Store) Clicks(ctx context.Context) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT code, clicks FROM clicks`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var (
+			code string
+			n    int
+		)
+		if err := rows.Scan(&code, &n); err != nil {
+			return nil, err
+		}
+		out[code] = n
+	}
+	return out, rows.Err()
+}
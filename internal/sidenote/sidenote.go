@@ -0,0 +1,320 @@
+// Package sidenote turns a post's footnotes into margin sidenotes. Hugo
+// has no render hook for footnotes, so this works on the HTML goldmark
+// renders them into: each note's text is copied next to its reference as
+// a sidenote that CSS floats into the margin on wide screens, while the
+// list at the bottom stays as the fallback on narrow ones.
+//
+// goldmark numbers footnotes in the order they're referenced, so its ids
+// (fn:1, fnref:1) change whenever a note is added above another. The ids
+// are replaced by ones derived from the notes' labels in the markdown,
+// [^gil] becoming fn-gil, so links to a note survive edits.
+package sidenote
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Classes the rewritten markup uses, for the stylesheet.
+const (
+	// Class is set on each sidenote.
+	Class = "sidenote"
+	// ShownClass marks the bottom footnotes that are also shown as
+	// sidenotes, and the whole list when they all are, so wide screens
+	// can hide them.
+	ShownClass = "sidenoted"
+)
+
+// Labels returns the labels of the footnotes referenced in body, a post's
+// markdown, in goldmark's numbering: labels[0] is footnote 1.
+func Labels(body []byte) []string {
+	doc := markdown.Parse(body, 1)
+	var labels []string
+	ast.Walk(doc.Root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if fn, ok := n.(*extast.Footnote); ok && entering && fn.Index > 0 {
+			for len(labels) < fn.Index {
+				labels = append(labels, "")
+			}
+			labels[fn.Index-1] = string(fn.Ref)
+		}
+		return ast.WalkContinue, nil
+	})
+	return labels
+}
+
+var (
+	refIDRe  = regexp.MustCompile(`^fnref(\d*):(\d+)$`)
+	noteIDRe = regexp.MustCompile(`^fn:(\d+)$`)
+)
+
+// note is a footnote found in the rendered HTML.
+type note struct {
+	id string
+	li *html.Node
+	// refs are the <sup> around each reference to the note, in order.
+	refs []*html.Node
+}
+
+// Rewrite rewrites the goldmark footnotes under root, given the labels
+// Labels found in the post's markdown, and reports how many notes became
+// sidenotes. Notes that are more than a paragraph, like ones holding a
+// list or a code block, stay at the bottom only. Markup already rewritten
+// is left alone, so running it twice is harmless.
+func Rewrite(root *html.Node, labels []string) int {
+	notes := map[int]*note{}
+	var list *html.Node
+	walk(root, func(n *html.Node) {
+		switch {
+		case n.DataAtom == atom.Sup:
+			if m := refIDRe.FindStringSubmatch(attr(n, "id")); m != nil {
+				i, _ := strconv.Atoi(m[2])
+				noteOf(notes, i).refs = append(noteOf(notes, i).refs, n)
+			}
+		case n.DataAtom == atom.Li:
+			if m := noteIDRe.FindStringSubmatch(attr(n, "id")); m != nil {
+				i, _ := strconv.Atoi(m[1])
+				noteOf(notes, i).li = n
+				if list == nil {
+					list = footnotes(n)
+				}
+			}
+		}
+	})
+	if len(notes) == 0 {
+		return 0
+	}
+
+	ids := map[string]bool{}
+	for _, i := range sortedKeys(notes) {
+		nt := notes[i]
+		base := strconv.Itoa(i)
+		if i-1 < len(labels) && labels[i-1] != "" {
+			if a := markdown.Anchorize(labels[i-1]); a != "" {
+				base = a
+			}
+		}
+		nt.id = base
+		for k := 2; ids[nt.id]; k++ {
+			nt.id = fmt.Sprintf("%s-%d", base, k)
+		}
+		ids[nt.id] = true
+	}
+
+	shown := 0
+	for _, i := range sortedKeys(notes) {
+		nt := notes[i]
+		for k, sup := range nt.refs {
+			setAttr(sup, "id", refID(nt.id, k))
+			for a := sup.FirstChild; a != nil; a = a.NextSibling {
+				if a.DataAtom == atom.A {
+					setAttr(a, "href", "#fn-"+nt.id)
+				}
+			}
+		}
+		if nt.li == nil {
+			continue
+		}
+		setAttr(nt.li, "id", "fn-"+nt.id)
+		var backrefs []*html.Node
+		walk(nt.li, func(n *html.Node) {
+			if backref(n) {
+				backrefs = append(backrefs, n)
+			}
+		})
+		for k, a := range backrefs {
+			setAttr(a, "href", "#"+refID(nt.id, k))
+		}
+		if len(nt.refs) == 0 {
+			continue
+		}
+		p := paragraph(nt.li)
+		if p == nil {
+			continue
+		}
+		sn := &html.Node{Type: html.ElementNode, Data: "span", DataAtom: atom.Span, Attr: []html.Attribute{
+			{Key: "class", Val: Class},
+			{Key: "id", Val: "sn-" + nt.id},
+			{Key: "role", Val: "note"},
+		}}
+		num := &html.Node{Type: html.ElementNode, Data: "sup", DataAtom: atom.Sup}
+		num.AppendChild(&html.Node{Type: html.TextNode, Data: strconv.Itoa(i)})
+		sn.AppendChild(num)
+		sn.AppendChild(&html.Node{Type: html.TextNode, Data: " "})
+		for c := p.FirstChild; c != nil; c = c.NextSibling {
+			if backref(c) {
+				continue
+			}
+			cc := clone(c)
+			if c.Type == html.TextNode && backref(c.NextSibling) {
+				// Drop the non-breaking space goldmark puts before the
+				// back-reference.
+				if cc.Data = strings.TrimRight(cc.Data, " \t\n\u00a0"); cc.Data == "" {
+					continue
+				}
+			}
+			sn.AppendChild(cc)
+		}
+		ref := nt.refs[0]
+		ref.Parent.InsertBefore(sn, ref.NextSibling)
+		addClass(nt.li, ShownClass)
+		shown++
+	}
+	if list != nil && shown == len(notes) {
+		addClass(list, ShownClass)
+	}
+	return shown
+}
+
+// goldmarkIDRe finds goldmark's footnote ids in a page, quoted or not.
+var goldmarkIDRe = regexp.MustCompile(`id=["']?fn(?:ref\d*)?:\d`)
+
+// RewritePage applies Rewrite to a whole HTML page, as Hugo built it. It
+// returns page as is when it has no footnotes to rewrite.
+func RewritePage(page []byte, labels []string) ([]byte, int, error) {
+	if !goldmarkIDRe.Match(page) {
+		return page, 0, nil
+	}
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, 0, err
+	}
+	n := Rewrite(doc, labels)
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), n, nil
+}
+
+// refID is the id of the k-th reference, from 0, to the note id.
+func refID(id string, k int) string {
+	if k == 0 {
+		return "fnref-" + id
+	}
+	return fmt.Sprintf("fnref-%s-%d", id, k+1)
+}
+
+func noteOf(notes map[int]*note, i int) *note {
+	if notes[i] == nil {
+		notes[i] = &note{}
+	}
+	return notes[i]
+}
+
+func sortedKeys(notes map[int]*note) []int {
+	keys := make([]int, 0, len(notes))
+	for i := range notes {
+		keys = append(keys, i)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// footnotes returns the element holding the footnote list li is in.
+func footnotes(li *html.Node) *html.Node {
+	for n := li.Parent; n != nil; n = n.Parent {
+		if hasClass(n, "footnotes") {
+			return n
+		}
+	}
+	return nil
+}
+
+// paragraph returns the note's only paragraph, or nil if it has other
+// blocks. A note of bare text, as minifiers sometimes leave it, counts
+// as its own paragraph.
+func paragraph(li *html.Node) *html.Node {
+	var p *html.Node
+	bare := false
+	for c := li.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.CommentNode, c.Type == html.TextNode && strings.TrimSpace(c.Data) == "":
+		case c.DataAtom == atom.P:
+			if p != nil || bare {
+				return nil
+			}
+			p = c
+		case c.Type == html.TextNode || inline[c.DataAtom]:
+			if p != nil {
+				return nil
+			}
+			bare = true
+		default:
+			return nil
+		}
+	}
+	if bare {
+		return li
+	}
+	return p
+}
+
+// inline are the elements a note can hold and still fit in a sidenote.
+var inline = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.B: true, atom.Br: true, atom.Cite: true,
+	atom.Code: true, atom.Del: true, atom.Em: true, atom.I: true, atom.Img: true,
+	atom.Kbd: true, atom.Mark: true, atom.Q: true, atom.S: true, atom.Small: true,
+	atom.Span: true, atom.Strong: true, atom.Sub: true, atom.Sup: true, atom.Time: true,
+}
+
+func backref(n *html.Node) bool {
+	return n != nil && n.DataAtom == atom.A && hasClass(n, "footnote-backref")
+}
+
+func walk(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+func clone(n *html.Node) *html.Node {
+	c := &html.Node{Type: n.Type, Data: n.Data, DataAtom: n.DataAtom, Namespace: n.Namespace,
+		Attr: slices.Clone(n.Attr)}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.AppendChild(clone(child))
+	}
+	return c
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func hasClass(n *html.Node, class string) bool {
+	return slices.Contains(strings.Fields(attr(n, "class")), class)
+}
+
+func addClass(n *html.Node, class string) {
+	if !hasClass(n, class) {
+		setAttr(n, "class", strings.TrimSpace(attr(n, "class")+" "+class))
+	}
+}
@@ -0,0 +1,168 @@
+// Package site reads the parts of Hugo's config.yml the tooling needs, so
+// values like the base URL and author live in one place.
+package site
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigPath is the Hugo config file, relative to the repo root.
+const ConfigPath = "config.yml"
+
+// Config is the subset of config.yml used by the tooling.
+type Config struct {
+	BaseURL      string `yaml:"baseURL"`
+	Title        string `yaml:"title"`
+	LanguageCode string `yaml:"languageCode"`
+	// DefaultContentLanguage is the language served at the root; the
+	// others are served under /<lang>/.
+	DefaultContentLanguage string              `yaml:"defaultContentLanguage"`
+	Languages              map[string]Language `yaml:"languages"`
+	Params                 struct {
+		Author      string   `yaml:"author"`
+		Description string   `yaml:"description"`
+		Images      []string `yaml:"images"`
+		// SocialIcons are the profiles linked from the home page.
+		SocialIcons []struct {
+			Name string `yaml:"name"`
+			URL  string `yaml:"url"`
+		} `yaml:"socialIcons"`
+		// ViewCount is the base URL of cmd/viewcountd, if it's deployed.
+		ViewCount string `yaml:"viewcount"`
+		// Kudos is the base URL of cmd/kudosd, if it's deployed.
+		Kudos string `yaml:"kudos"`
+		// Suggest is the base URL of cmd/suggestd, if it's deployed.
+		Suggest string `yaml:"suggest"`
+		// CSPReport is the base URL of cmd/cspreportd, if it's deployed.
+		CSPReport string `yaml:"cspreport"`
+		// Webmention is cmd/webmentiond's /webmention URL, if it's
+		// deployed.
+		Webmention string `yaml:"webmention"`
+		// WellKnown is what `blogctl wellknown` writes.
+		WellKnown WellKnown `yaml:"wellknown"`
+		// Podcast describes the feed `blogctl podcast` makes of the posts
+		// with audio.
+		Podcast Podcast `yaml:"podcast"`
+	} `yaml:"params"`
+}
+
+// Language is a language the site is written in, keyed in Languages by
+// the code its translations' file names carry, as bn in pathlib.bn.md.
+type Language struct {
+	LanguageName string `yaml:"languageName"`
+	// LanguageCode is the language's feeds' <language>, like "bn-bd". It
+	// defaults to the key.
+	LanguageCode string `yaml:"languageCode"`
+	// Title is the site's title in the language, the site's by default.
+	Title  string `yaml:"title"`
+	Weight int    `yaml:"weight"`
+}
+
+// Podcast is the show the podcast feed describes. Title and Description
+// default to the site's, and Image to its first image.
+type Podcast struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	// Category is one of Apple Podcasts' categories, like "Technology".
+	Category string `yaml:"category"`
+	// Email is the owner's, which directories mail to verify the feed.
+	Email    string `yaml:"email"`
+	Image    string `yaml:"image"`
+	Explicit bool   `yaml:"explicit"`
+}
+
+// WellKnown configures security.txt, humans.txt, and the verification
+// files services ask a site to serve.
+type WellKnown struct {
+	Security struct {
+		// Contact lists the URIs to report vulnerabilities to, best first.
+		Contact []string `yaml:"contact"`
+		// ExpiryDays is how far past each build the file expires.
+		ExpiryDays         int      `yaml:"expiryDays"`
+		Encryption         string   `yaml:"encryption"`
+		Acknowledgments    string   `yaml:"acknowledgments"`
+		Policy             string   `yaml:"policy"`
+		Hiring             string   `yaml:"hiring"`
+		PreferredLanguages []string `yaml:"preferredLanguages"`
+	} `yaml:"security"`
+	Humans struct {
+		Team []struct {
+			Role    string `yaml:"role"`
+			Name    string `yaml:"name"`
+			Site    string `yaml:"site"`
+			Contact string `yaml:"contact"`
+		} `yaml:"team"`
+		Thanks   []string `yaml:"thanks"`
+		Software []string `yaml:"software"`
+	} `yaml:"humans"`
+	// Files maps site paths, like /.well-known/keybase.txt, to the exact
+	// contents a service's verification asks for.
+	Files map[string]string `yaml:"files"`
+}
+
+// Load parses the Hugo config at path.
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("site: parse %s: %w", path, err)
+	}
+	c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+	c.Params.Description = strings.TrimSpace(c.Params.Description)
+	if c.LanguageCode == "" {
+		c.LanguageCode = "en-us"
+	}
+	if c.DefaultContentLanguage == "" {
+		c.DefaultContentLanguage = "en"
+	}
+	return &c, nil
+}
+
+// Langs returns the configured languages by weight, the default first
+// whether or not it's configured.
+func (c *Config) Langs() []string {
+	langs := []string{c.DefaultContentLanguage}
+	for l := range c.Languages {
+		if l != c.DefaultContentLanguage {
+			langs = append(langs, l)
+		}
+	}
+	slices.SortFunc(langs[1:], func(a, b string) int {
+		return cmp.Or(cmp.Compare(c.Languages[a].Weight, c.Languages[b].Weight), cmp.Compare(a, b))
+	})
+	return langs
+}
+
+// Language returns lang's settings with the defaults filled in: the
+// site's title, and for the default language the site's languageCode.
+func (c *Config) Language(lang string) Language {
+	l := c.Languages[lang]
+	if l.Title == "" {
+		l.Title = c.Title
+	}
+	if l.LanguageCode == "" {
+		l.LanguageCode = lang
+		if lang == c.DefaultContentLanguage {
+			l.LanguageCode = c.LanguageCode
+		}
+	}
+	return l
+}
+
+// Permalink turns a site-relative path like "/python/pathlib/" into an
+// absolute URL.
+func (c *Config) Permalink(rel string) string {
+	if !strings.HasPrefix(rel, "/") {
+		rel = "/" + rel
+	}
+	return c.BaseURL + rel
+}
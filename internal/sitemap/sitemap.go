@@ -0,0 +1,427 @@
+// Package sitemap builds the site's sitemap in place of Hugo's, which dates
+// every page by its front matter and gives them all the same priority.
+// Here a post's lastmod comes from git history, through data/gitmeta.json,
+// and its priority and changefreq from how recently it changed and how
+// much it's read. Drafts, scheduled posts, and utility pages like search
+// are left out, and past 50,000 URLs the sitemap becomes an index of
+// several files, as the protocol requires.
+//
+// Each language has its own sitemap, the default's at the root and the
+// others' under /<lang>/, and a translated post lists all its versions
+// as hreflang alternates.
+//
+// A post can set its own values, or leave the sitemap, with Hugo's key:
+//
+//	sitemap:
+//	  changefreq: monthly
+//	  priority: 0.8
+//	  disable: true
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/i18n"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// MaxURLs is the most URLs one sitemap file may list.
+const MaxURLs = 50000
+
+// Name is the sitemap's file name, at the root of the site. When it's
+// split, it's the index and the parts are sitemap-1.xml, sitemap-2.xml,
+// and so on.
+const Name = "sitemap.xml"
+
+// Exclude lists the utility pages that aren't worth indexing.
+var Exclude = []string{"/search/", "/archives/"}
+
+// URL is an entry of the sitemap.
+type URL struct {
+	Loc        string
+	Lastmod    time.Time
+	ChangeFreq string
+	Priority   float64
+	// Alternates are the page's versions in every language, itself
+	// included, when it's translated.
+	Alternates []i18n.Alternate
+}
+
+// Options are what the heuristics go by.
+type Options struct {
+	// Now is when the sitemap is built; ages are counted from it.
+	Now time.Time
+	// Views maps post slugs to their page views; see internal/views.
+	Views map[string]int
+	// Lang is the language to list, "" for the default.
+	Lang string
+}
+
+// Pages parses the standalone pages at the root of the content directory
+// dir, like search and archives, which content.Load leaves out.
+func Pages(dir string) ([]*content.Post, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var pages []*content.Post
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".md" || e.Name() == "_index.md" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		p, err := content.Parse(e.Name(), b)
+		if err != nil {
+			return nil, err
+		}
+		// Root pages have no section; Hugo serves them at their slug.
+		p.Section = ""
+		if p.URL == "" {
+			p.URL = "/" + strings.ToLower(path.Join(p.Lang, p.Slug)) + "/"
+		}
+		pages = append(pages, p)
+	}
+	return pages, nil
+}
+
+// Build returns the entries of opts.Lang's sitemap: the home page, the
+// posts, the standalone pages in pages that aren't excluded, and the
+// section and tag lists, each dated by its newest post. Drafts and posts
+// dated after opts.Now, which Hugo doesn't build, are left out.
+func Build(cfg *site.Config, posts, pages []*content.Post, opts Options) []URL {
+	var built []*content.Post
+	for _, p := range content.Published(posts) {
+		if !p.Date.After(opts.Now) && !p.PublishDate.After(opts.Now) {
+			built = append(built, p)
+		}
+	}
+	alternates := i18n.Alternates(cfg, built)
+	published := i18n.ByLang(built)[opts.Lang]
+	ranks := rank(published, opts.Views)
+	home := "/"
+	if opts.Lang != "" {
+		home = "/" + opts.Lang + "/"
+	}
+
+	var urls []URL
+	lists := map[string]time.Time{}
+	touch := func(u string, t time.Time) {
+		if t.After(lists[u]) {
+			lists[u] = t
+		}
+	}
+	for _, p := range published {
+		updated := p.Updated()
+		touch(home, updated)
+		touch(home+p.Section+"/", updated)
+		for _, t := range p.Tags {
+			touch(home+"tags/"+content.TagSlug(t)+"/", updated)
+		}
+		touch(home+"tags/", updated)
+		if disabled(p) {
+			continue
+		}
+		age := opts.Now.Sub(updated)
+		u := URL{
+			Loc:        loc(cfg, p.RelPermalink()),
+			Lastmod:    updated,
+			ChangeFreq: changeFreq(age),
+			Priority:   priority(age, ranks[p.Slug]),
+			Alternates: alternates[p.RelPermalink()],
+		}
+		override(&u, p)
+		urls = append(urls, u)
+	}
+	for _, p := range pages {
+		rel := strings.TrimPrefix(p.RelPermalink(), strings.TrimSuffix(home, "/"))
+		if p.Draft || p.Lang != opts.Lang || disabled(p) || slices.Contains(Exclude, rel) {
+			continue
+		}
+		u := URL{Loc: loc(cfg, p.RelPermalink()), Lastmod: p.Updated(), ChangeFreq: "monthly", Priority: 0.4}
+		override(&u, p)
+		urls = append(urls, u)
+	}
+
+	paths := make([]string, 0, len(lists))
+	for u := range lists {
+		paths = append(paths, u)
+	}
+	sort.Strings(paths)
+	for _, u := range paths {
+		e := URL{Loc: loc(cfg, u), Lastmod: lists[u], ChangeFreq: changeFreq(opts.Now.Sub(lists[u])), Priority: 0.3}
+		switch {
+		case u == home:
+			e.ChangeFreq, e.Priority = "daily", 1
+		case u == home+"tags/" || !strings.HasPrefix(u, home+"tags/"):
+			e.Priority = 0.5
+		}
+		urls = append(urls, e)
+	}
+	slices.SortStableFunc(urls, func(a, b URL) int {
+		if a.Priority != b.Priority {
+			return -cmpFloat(a.Priority, b.Priority)
+		}
+		return b.Lastmod.Compare(a.Lastmod)
+	})
+	return urls
+}
+
+// loc returns the absolute URL of the page at rel, percent-encoded as the
+// protocol requires.
+func loc(cfg *site.Config, rel string) string {
+	return escape(cfg.Permalink(rel))
+}
+
+// escape percent-encodes the absolute URL abs.
+func escape(abs string) string {
+	u, err := url.Parse(abs)
+	if err != nil {
+		return abs
+	}
+	return u.String()
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// rank maps each post's slug to the share of posts read less than it, from
+// 0 to 1. Posts without views rank 0.
+func rank(posts []*content.Post, views map[string]int) map[string]float64 {
+	ranks := map[string]float64{}
+	if len(views) == 0 || len(posts) < 2 {
+		return ranks
+	}
+	sorted := slices.Clone(posts)
+	slices.SortStableFunc(sorted, func(a, b *content.Post) int { return views[a.Slug] - views[b.Slug] })
+	for i, p := range sorted {
+		if views[p.Slug] > 0 {
+			ranks[p.Slug] = float64(i) / float64(len(sorted)-1)
+		}
+	}
+	return ranks
+}
+
+const day = 24 * time.Hour
+
+// changeFreq guesses how often a post changes from how long ago it last
+// did: new posts get fixes, old ones mostly stay put.
+func changeFreq(age time.Duration) string {
+	switch {
+	case age < 30*day:
+		return "weekly"
+	case age < 365*day:
+		return "monthly"
+	default:
+		return "yearly"
+	}
+}
+
+// priority starts a post at 0.5 and raises it for a recent change and for
+// being among the most read, up to 0.9; the home page alone has 1.
+func priority(age time.Duration, rank float64) float64 {
+	p := 0.5
+	switch {
+	case age < 90*day:
+		p += 0.2
+	case age < 365*day:
+		p += 0.1
+	}
+	switch {
+	case rank >= 0.9:
+		p += 0.2
+	case rank >= 0.75:
+		p += 0.1
+	}
+	return math.Round(math.Min(p, 0.9)*10) / 10
+}
+
+// params returns p's sitemap front matter key.
+func params(p *content.Post) map[string]any {
+	m, _ := p.Params["sitemap"].(map[string]any)
+	return m
+}
+
+func disabled(p *content.Post) bool {
+	v, _ := params(p)["disable"].(bool)
+	return v
+}
+
+// override applies the post's own changefreq and priority.
+func override(u *URL, p *content.Post) {
+	m := params(p)
+	if s, ok := m["changefreq"].(string); ok && s != "" {
+		u.ChangeFreq = s
+	}
+	switch v := m["priority"].(type) {
+	case float64:
+		u.Priority = v
+	case int:
+		u.Priority = float64(v)
+	case int64:
+		u.Priority = float64(v)
+	}
+}
+
+type urlset struct {
+	XMLName xml.Name `xml:"urlset"`
+	NS      string   `xml:"xmlns,attr"`
+	XHTML   string   `xml:"xmlns:xhtml,attr,omitempty"`
+	URLs    []xmlURL `xml:"url"`
+}
+
+type xmlURL struct {
+	Loc        string    `xml:"loc"`
+	Lastmod    string    `xml:"lastmod,omitempty"`
+	ChangeFreq string    `xml:"changefreq,omitempty"`
+	Priority   string    `xml:"priority,omitempty"`
+	Links      []xmlLink `xml:"xhtml:link"`
+}
+
+type xmlLink struct {
+	Rel      string `xml:"rel,attr"`
+	HrefLang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	NS       string       `xml:"xmlns,attr"`
+	Sitemaps []xmlSitemap `xml:"sitemap"`
+}
+
+type xmlSitemap struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod,omitempty"`
+}
+
+const (
+	ns      = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	xhtmlNS = "http://www.w3.org/1999/xhtml"
+)
+
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func encode(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// Files encodes urls as the sitemap's files in the site directory dir, "/"
+// or a language's like "/bn/", keyed by name: Name alone, or Name as the
+// index of the parts of at most max URLs each.
+func Files(cfg *site.Config, dir string, urls []URL, max int) (map[string][]byte, error) {
+	var parts [][]URL
+	for len(urls) > max {
+		parts, urls = append(parts, urls[:max]), urls[max:]
+	}
+	parts = append(parts, urls)
+
+	files := map[string][]byte{}
+	var index sitemapIndex
+	for i, part := range parts {
+		set := urlset{NS: ns}
+		var newest time.Time
+		for _, u := range part {
+			x := xmlURL{
+				Loc: u.Loc, Lastmod: date(u.Lastmod), ChangeFreq: u.ChangeFreq,
+				Priority: strconv.FormatFloat(u.Priority, 'f', 1, 64),
+			}
+			for _, a := range u.Alternates {
+				x.Links = append(x.Links, xmlLink{Rel: "alternate", HrefLang: a.Lang, Href: escape(a.Href)})
+				set.XHTML = xhtmlNS
+			}
+			set.URLs = append(set.URLs, x)
+			if u.Lastmod.After(newest) {
+				newest = u.Lastmod
+			}
+		}
+		b, err := encode(set)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 1 {
+			files[Name] = b
+			return files, nil
+		}
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		files[name] = b
+		index.Sitemaps = append(index.Sitemaps, xmlSitemap{Loc: cfg.Permalink(path.Join(dir, name)), Lastmod: date(newest)})
+	}
+	index.NS = ns
+	b, err := encode(index)
+	if err != nil {
+		return nil, err
+	}
+	files[Name] = b
+	return files, nil
+}
+
+var partRe = regexp.MustCompile(`^sitemap-\d+\.xml$`)
+
+// Write saves files under dir, skipping the unchanged ones and removing
+// the parts of an earlier, longer sitemap. It returns the paths written
+// or removed.
+func Write(dir string, files map[string][]byte) ([]string, error) {
+	var changed []string
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if _, keep := files[e.Name()]; !keep && partRe.MatchString(e.Name()) {
+			p := filepath.Join(dir, e.Name())
+			if err := os.Remove(p); err != nil {
+				return changed, err
+			}
+			changed = append(changed, p)
+		}
+	}
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		p := filepath.Join(dir, n)
+		wrote, err := fsutil.WriteIfChanged(p, files[n])
+		if err != nil {
+			return changed, err
+		}
+		if wrote {
+			changed = append(changed, p)
+		}
+	}
+	return changed, nil
+}
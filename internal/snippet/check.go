@@ -0,0 +1,239 @@
+package snippet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Checker checks a unit. GoChecker checks the Go units from GoUnits; the
+// Checkers check a block at a time.
+type Checker interface {
+	Check(ctx context.Context, u Unit) Result
+}
+
+// ErrNoTool is returned when none of the tools a checker runs is on $PATH.
+var ErrNoTool = errors.New("snippet: checker not installed")
+
+// Checkers maps the languages besides Go that blocks are checked in to
+// their checker.
+var Checkers = map[string]Checker{
+	"python": PythonChecker{},
+	"py":     PythonChecker{},
+	"sh":     ShellChecker{Shell: "sh"},
+	"bash":   ShellChecker{Shell: "bash"},
+	"json":   parseChecker{"main.json", parseJSON},
+	"yaml":   parseChecker{"main.yaml", parseYAML},
+	"yml":    parseChecker{"main.yaml", parseYAML},
+	"toml":   parseChecker{"main.toml", parseTOML},
+}
+
+// BlockUnits returns a unit of its own for each block in a language of
+// Checkers. Blocks marked {check=false} are skipped, as are Python REPL
+// sessions and indented fragments, and shell sessions with $ prompts,
+// which aren't programs.
+func BlockUnits(blocks []Block) []Unit {
+	var units []Unit
+	for _, b := range blocks {
+		c, ok := Checkers[b.Lang]
+		if !ok || b.Attrs["check"] == "false" || strings.TrimSpace(b.Code) == "" {
+			continue
+		}
+		var name string
+		switch c := c.(type) {
+		case PythonChecker:
+			if isSession(b.Code, ">>> ") || isFragment(b.Code) {
+				continue
+			}
+			name = "main.py"
+		case ShellChecker:
+			if isSession(b.Code, "$ ") {
+				continue
+			}
+			name = "main.sh"
+		case parseChecker:
+			name = c.file
+		}
+		units = append(units, Unit{Post: b.Post, Files: map[string]Block{name: b}})
+	}
+	return units
+}
+
+// CheckerFor returns the checker for u: GoChecker for Go, with the go
+// command in gocmd, or else the one in Checkers for its block's language.
+func CheckerFor(u Unit, gocmd string) Checker {
+	for _, b := range u.Files {
+		if b.Lang == "go" {
+			return GoChecker{Go: gocmd}
+		}
+		return Checkers[b.Lang]
+	}
+	return nil
+}
+
+// isSession reports whether any line of code starts with prompt.
+func isSession(code, prompt string) bool {
+	for line := range strings.Lines(code) {
+		if strings.HasPrefix(line, prompt) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFragment reports whether code starts indented, like a method lifted
+// out of its class.
+func isFragment(code string) bool {
+	for line := range strings.Lines(code) {
+		if strings.TrimSpace(line) != "" {
+			return line[0] == ' ' || line[0] == '\t'
+		}
+	}
+	return false
+}
+
+// PythonChecker checks that Python blocks compile: with ruff, limited to
+// syntax errors and the like, when it's installed, or else with python3
+// the way py_compile does.
+type PythonChecker struct{}
+
+const compilePy = `import sys
+try:
+    compile(open(sys.argv[1], encoding="utf-8").read(), sys.argv[1], "exec")
+except SyntaxError as e:
+    print(f"{e.filename}:{e.lineno}:{e.offset}: {e.msg}")
+    sys.exit(1)
+`
+
+func (PythonChecker) Check(ctx context.Context, u Unit) Result {
+	if _, err := exec.LookPath("ruff"); err == nil {
+		return runTool(ctx, u, "ruff", "check", "--no-cache", "--output-format", "concise", "--select", "E9,F63,F7", ".")
+	}
+	if _, err := exec.LookPath("python3"); err == nil {
+		return runTool(ctx, u, "python3", "-c", compilePy, "main.py")
+	}
+	return Result{Unit: u, Err: fmt.Errorf("%w: ruff or python3", ErrNoTool)}
+}
+
+// ShellChecker runs shellcheck on shell blocks, for warnings and errors,
+// or else only parses them with Shell -n.
+type ShellChecker struct {
+	// Shell is the dialect, "sh" or "bash".
+	Shell string
+}
+
+func (c ShellChecker) Check(ctx context.Context, u Unit) Result {
+	if _, err := exec.LookPath("shellcheck"); err == nil {
+		// Variables a fragment uses without setting, or sets for a later
+		// block, are the point of the fragment.
+		return runTool(ctx, u, "shellcheck", "-f", "gcc", "-s", c.Shell, "-S", "warning", "-e", "SC2034,SC2154", "main.sh")
+	}
+	if _, err := exec.LookPath(c.Shell); err == nil {
+		return runTool(ctx, u, c.Shell, "-n", "main.sh")
+	}
+	return Result{Unit: u, Err: fmt.Errorf("%w: shellcheck or %s", ErrNoTool, c.Shell)}
+}
+
+// runTool writes u to a temporary directory and runs name with args in it.
+func runTool(ctx context.Context, u Unit, name string, args ...string) Result {
+	res := Result{Unit: u}
+	dir, err := os.MkdirTemp("", "snippetcheck-")
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer os.RemoveAll(dir)
+	if err := writeUnit(dir, u); err != nil {
+		res.Err = err
+		return res
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		res.Err = fmt.Errorf("%s: %w", filepath.Base(name), err)
+		res.Output = rewritePositions(string(out), u)
+	}
+	return res
+}
+
+// parseChecker checks that a block of data parses, in process.
+type parseChecker struct {
+	// file is the block's name in positions.
+	file string
+	// parse returns the line of the error, if it knows it.
+	parse func(code string) (line int, err error)
+}
+
+func (c parseChecker) Check(_ context.Context, u Unit) Result {
+	res := Result{Unit: u}
+	line, err := c.parse(u.Files[c.file].Code)
+	if err != nil {
+		res.Err = fmt.Errorf("%s doesn't parse", strings.ToUpper(strings.TrimPrefix(filepath.Ext(c.file), ".")))
+		if line > 0 {
+			res.Output = rewritePositions(fmt.Sprintf("%s:%d: %v\n", c.file, line, err), u)
+		} else {
+			res.Output = err.Error() + "\n"
+		}
+	}
+	return res
+}
+
+func parseJSON(code string) (int, error) {
+	dec := json.NewDecoder(strings.NewReader(code))
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			var se *json.SyntaxError
+			if errors.As(err, &se) {
+				return strings.Count(code[:se.Offset], "\n") + 1, err
+			}
+			return 0, err
+		}
+	}
+}
+
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): `)
+
+func parseYAML(code string) (int, error) {
+	dec := yaml.NewDecoder(strings.NewReader(code))
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				return n, errors.New(strings.TrimPrefix(err.Error(), m[0]))
+			}
+			return 0, err
+		}
+	}
+}
+
+func parseTOML(code string) (int, error) {
+	var v map[string]any
+	_, err := toml.NewDecoder(strings.NewReader(code)).Decode(&v)
+	var pe toml.ParseError
+	if errors.As(err, &pe) {
+		return pe.Position.Line, errors.New(pe.Message)
+	}
+	return 0, err
+}
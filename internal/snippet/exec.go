@@ -0,0 +1,244 @@
+package snippet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Runnable reports whether b is marked {run=true} and is in a language the
+// Runner knows how to execute.
+func Runnable(b Block) bool {
+	if b.Attrs["run"] != "true" {
+		return false
+	}
+	_, ok := interpreters[b.Lang]
+	return ok
+}
+
+// interpreters maps a fence language to the file the block is written to and
+// the command that runs it.
+var interpreters = map[string]struct {
+	file string
+	cmd  []string
+}{
+	"go":     {"main.go", []string{"go", "run", "."}},
+	"python": {"main.py", []string{"python3", "main.py"}},
+	"py":     {"main.py", []string{"python3", "main.py"}},
+	"sh":     {"main.sh", []string{"sh", "main.sh"}},
+	"bash":   {"main.sh", []string{"bash", "main.sh"}},
+}
+
+// commentPrefix returns the line comment marker for lang.
+func commentPrefix(lang string) string {
+	switch lang {
+	case "python", "py", "sh", "bash":
+		return "#"
+	default:
+		return "//"
+	}
+}
+
+// Runner executes blocks in a sandbox: a throwaway working directory, an
+// environment scrubbed down to PATH and a private HOME, and a timeout.
+type Runner struct {
+	// Timeout bounds a single run. Defaults to 30 seconds.
+	Timeout time.Duration
+	// Go is the go command Go blocks run with. Defaults to "go".
+	Go string
+}
+
+// ErrNotRunnable is returned when a block's language has no interpreter.
+var ErrNotRunnable = errors.New("snippet: language can't be executed")
+
+// Run executes b and returns what it wrote to stdout.
+func (r Runner) Run(ctx context.Context, b Block) (string, error) {
+	interp, ok := interpreters[b.Lang]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrNotRunnable, b.Lang)
+	}
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "snippetexec-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, interp.file), []byte(b.Code+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	// The go command refuses to use a go.mod sitting directly in TMPDIR, so
+	// give the snippet its own temp directory one level down.
+	tmp := filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		return "", err
+	}
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + tmp,
+		"LANG=C.UTF-8",
+		"PYTHONDONTWRITEBYTECODE=1",
+	}
+	if b.Lang == "go" {
+		// Share the build cache so every run doesn't recompile the
+		// standard library.
+		cache, _ := os.UserCacheDir()
+		env = append(env,
+			"GOCACHE="+filepath.Join(cache, "go-build"),
+			"GOPATH="+filepath.Join(dir, "gopath"),
+			"GOTOOLCHAIN=local",
+			"GOFLAGS=-mod=mod",
+		)
+		// go mod init stamps the module with the toolchain's language
+		// version, so semantics like per-iteration loop variables match
+		// what readers get today.
+		initCmd := exec.CommandContext(ctx, r.goCmd(), "mod", "init", "snippet")
+		initCmd.Dir = dir
+		initCmd.Env = env
+		if out, err := initCmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("go mod init: %v\n%s", err, out)
+		}
+	}
+
+	name := interp.cmd[0]
+	if name == "go" {
+		name = r.goCmd()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, interp.cmd[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return stdout.String(), fmt.Errorf("%v\n%s", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+func (r Runner) goCmd() string {
+	if r.Go == "" {
+		return "go"
+	}
+	return r.Go
+}
+
+var outputRe = regexp.MustCompile(`^\s*(?://|#)\s*Output:(.*)$`)
+
+// ExpectedOutput returns the output recorded in the block's trailing
+// "// Output:" (or "# Output:") comment, the same convention Go example
+// tests use. ok is false if the block has no such comment.
+func ExpectedOutput(b Block) (want string, ok bool) {
+	lines := strings.Split(b.Code, "\n")
+	start := -1
+	for i, l := range lines {
+		if outputRe.MatchString(l) {
+			start = i
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	prefix := commentPrefix(b.Lang)
+	var out []string
+	if first := strings.TrimSpace(outputRe.FindStringSubmatch(lines[start])[1]); first != "" {
+		out = append(out, first)
+	}
+	for _, l := range lines[start+1:] {
+		l = strings.TrimSpace(l)
+		if !strings.HasPrefix(l, prefix) {
+			break
+		}
+		l = strings.TrimPrefix(l, prefix)
+		out = append(out, strings.TrimPrefix(l, " "))
+	}
+	return strings.Join(out, "\n"), true
+}
+
+// SameOutput compares output the way go test compares example output:
+// leading and trailing space is ignored, as is trailing space on each line.
+func SameOutput(got, want string) bool {
+	return normalize(got) == normalize(want)
+}
+
+func normalize(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WithOutput returns b's code with its output comment replaced by got, or
+// with a new output comment appended if it doesn't have one.
+func WithOutput(b Block, got string) string {
+	prefix := commentPrefix(b.Lang)
+	comment := []string{prefix + " Output:"}
+	for _, l := range strings.Split(normalize(got), "\n") {
+		comment = append(comment, strings.TrimRight(prefix+" "+l, " "))
+	}
+
+	lines := strings.Split(b.Code, "\n")
+	start := -1
+	for i, l := range lines {
+		if outputRe.MatchString(l) {
+			start = i
+		}
+	}
+	if start < 0 {
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		return strings.Join(append(append(lines, ""), comment...), "\n")
+	}
+
+	// Swap the old comment for the new one, keeping anything after it.
+	end := start + 1
+	for end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), prefix) {
+		end++
+	}
+	out := append(lines[:start:start], comment...)
+	return strings.Join(append(out, lines[end:]...), "\n")
+}
+
+// Rewrite replaces the code of each block in src (the full file the blocks
+// were extracted from) with the corresponding entry in code, keyed by the
+// block's opening fence line.
+func Rewrite(src []byte, blocks []Block, code map[int]string) []byte {
+	lines := strings.Split(string(src), "\n")
+	// Walk the blocks bottom-up so earlier line numbers stay valid.
+	for i := len(blocks) - 1; i >= 0; i-- {
+		b := blocks[i]
+		c, ok := code[b.Line]
+		if !ok {
+			continue
+		}
+		repl := strings.Split(c, "\n")
+		for j, l := range repl {
+			if l != "" {
+				repl[j] = b.Indent + l
+			}
+		}
+		// Lines are 1-based; the code sits strictly between the fences.
+		tail := append(repl, lines[b.End-1:]...)
+		lines = append(lines[:b.Line], tail...)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,159 @@
+package snippet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Unit is a set of Go blocks from one post that get compiled together as a
+// single module.
+//
+// Blocks that declare a file name in a leading comment (// main.go,
+// // main_test.go) are collected into one unit per post so that samples split
+// across several blocks build together. A file name that shows up twice
+// starts a new unit, since that's usually a before/after pair. Blocks with a
+// package clause but no file name are units of their own.
+type Unit struct {
+	Post  string
+	Files map[string]Block
+}
+
+// Line returns the line of the first block in the unit.
+func (u Unit) Line() int {
+	line := 0
+	for _, b := range u.Files {
+		if line == 0 || b.Line < line {
+			line = b.Line
+		}
+	}
+	return line
+}
+
+var packageRe = regexp.MustCompile(`(?m)^package\s+\w+`)
+
+// GoUnits groups a post's Go blocks into compilable units. Fragments without
+// a package clause and blocks marked {check=false} are skipped.
+func GoUnits(blocks []Block) []Unit {
+	var units []Unit
+	named := -1 // index of the unit collecting named files
+	for _, b := range blocks {
+		if b.Lang != "go" || b.Attrs["check"] == "false" {
+			continue
+		}
+		if !packageRe.MatchString(b.Code) {
+			continue
+		}
+		name := b.Filename()
+		if name == "" || !strings.HasSuffix(name, ".go") {
+			name = "main.go"
+			if strings.Contains(b.Code, "func Test") {
+				name = "main_test.go"
+			}
+			units = append(units, Unit{Post: b.Post, Files: map[string]Block{name: b}})
+			continue
+		}
+		if named >= 0 {
+			if _, dup := units[named].Files[name]; !dup {
+				units[named].Files[name] = b
+				continue
+			}
+		}
+		units = append(units, Unit{Post: b.Post, Files: map[string]Block{name: b}})
+		named = len(units) - 1
+	}
+	return units
+}
+
+// GoChecker vets and tests Go units in throwaway modules.
+type GoChecker struct {
+	// Go is the go command to run. Defaults to "go".
+	Go string
+}
+
+// Result is the outcome of checking a unit.
+type Result struct {
+	Unit Unit
+	// Output is the combined tool output with file positions rewritten to
+	// point into the post.
+	Output string
+	Err    error
+}
+
+// Check writes u to a temporary module and runs go mod tidy, go vet, and
+// go test against it.
+func (c GoChecker) Check(ctx context.Context, u Unit) Result {
+	res := Result{Unit: u}
+	dir, err := os.MkdirTemp("", "snippetcheck-")
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer os.RemoveAll(dir)
+
+	if err := writeUnit(dir, u); err != nil {
+		res.Err = err
+		return res
+	}
+
+	gocmd := c.Go
+	if gocmd == "" {
+		gocmd = "go"
+	}
+	var out bytes.Buffer
+	steps := [][]string{
+		{"mod", "init", "snippet"},
+		{"mod", "tidy"},
+		{"vet", "./..."},
+		{"test", "./..."},
+	}
+	for _, args := range steps {
+		cmd := exec.CommandContext(ctx, gocmd, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local", "GOFLAGS=-mod=mod")
+		b, err := cmd.CombinedOutput()
+		if err != nil {
+			out.Write(b)
+			res.Err = fmt.Errorf("go %s: %w", strings.Join(args, " "), err)
+			break
+		}
+	}
+	res.Output = rewritePositions(out.String(), u)
+	return res
+}
+
+func writeUnit(dir string, u Unit) error {
+	for name, b := range u.Files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, []byte(b.Code+"\n"), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var positionRe = regexp.MustCompile(`(?:\./)?([\w./-]+\.\w+)(?::|: line |: )(\d+)`)
+
+// rewritePositions turns file:line references in tool output, or the
+// shells' "file: line N" and "file: N", into post:line references.
+func rewritePositions(out string, u Unit) string {
+	return positionRe.ReplaceAllStringFunc(out, func(m string) string {
+		sub := positionRe.FindStringSubmatch(m)
+		b, ok := u.Files[path.Clean(sub[1])]
+		if !ok {
+			return m
+		}
+		n, _ := strconv.Atoi(sub[2])
+		return fmt.Sprintf("%s:%d", b.Post, b.Line+n)
+	})
+}
@@ -0,0 +1,150 @@
+// Package snippet extracts fenced code blocks from markdown posts so they can
+// be checked, executed, or republished by the site's tooling.
+package snippet
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// Block is a fenced code block found in a post.
+type Block struct {
+	// Post is the content-relative path of the post the block came from.
+	Post string
+	// Line is the 1-based line number of the opening fence in the post's
+	// file. The first line of Code is at Line+1.
+	Line int
+	// End is the line number of the closing fence.
+	End int
+	// Lang is the first word of the fence's info string, e.g. "go".
+	Lang string
+	// Attrs holds the key=value pairs from a trailing {...} in the info
+	// string, e.g. "go {run=true}".
+	Attrs map[string]string
+	// Code is the block's content with the fence indentation removed.
+	Code string
+	// Indent is the whitespace the fence was indented by, e.g. when the
+	// block is nested in a list item.
+	Indent string
+}
+
+// Filename returns the file name the block declares in a leading comment,
+// such as "// main_test.go" or "# src.py", or "" if there isn't one.
+func (b Block) Filename() string {
+	first, _, _ := strings.Cut(b.Code, "\n")
+	m := filenameRe.FindStringSubmatch(strings.TrimSpace(first))
+	if m == nil {
+		return ""
+	}
+	return path.Clean(m[1])
+}
+
+var filenameRe = regexp.MustCompile(`^(?://|#)\s*([\w./-]+\.\w+)$`)
+
+// Extract returns every fenced block in the post's body.
+func Extract(p *content.Post) []Block {
+	blocks := Parse(p.Body, p.BodyLine)
+	for i := range blocks {
+		blocks[i].Post = p.Path
+	}
+	return blocks
+}
+
+// Parse returns the fenced blocks in markdown. firstLine is the line number
+// of the first line of markdown within its file, so block line numbers point
+// into the original file.
+func Parse(markdown string, firstLine int) []Block {
+	var (
+		blocks []Block
+		cur    *Block
+		fence  string
+		indent string
+		code   []string
+	)
+	for i, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if cur == nil {
+			f := fenceOf(trimmed)
+			if f == "" {
+				continue
+			}
+			lang, attrs := ParseInfo(trimmed[len(f):])
+			cur = &Block{Line: firstLine + i, Lang: lang, Attrs: attrs}
+			fence = f
+			indent = line[:len(line)-len(trimmed)]
+			code = code[:0]
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.TrimSpace(trimmed[len(fence):]) == "" {
+			cur.Code = strings.Join(code, "\n")
+			cur.Indent = indent
+			cur.End = firstLine + i
+			blocks = append(blocks, *cur)
+			cur = nil
+			continue
+		}
+		code = append(code, strings.TrimPrefix(line, indent))
+	}
+	return blocks
+}
+
+// fenceOf returns the run of backticks or tildes that opens a fence, or "".
+func fenceOf(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// ParseInfo splits a fence info string like `go {run=true, hl_lines=[3,5-7]}`
+// into its language and attributes. Attribute values keep their brackets and
+// have surrounding quotes removed.
+func ParseInfo(info string) (lang string, attrs map[string]string) {
+	info = strings.TrimSpace(info)
+	attrs = map[string]string{}
+	open := strings.IndexByte(info, '{')
+	if open >= 0 && strings.HasSuffix(info, "}") {
+		parseAttrs(info[open+1:len(info)-1], attrs)
+		info = strings.TrimSpace(info[:open])
+	}
+	lang, _, _ = strings.Cut(info, " ")
+	return strings.ToLower(lang), attrs
+}
+
+func parseAttrs(s string, attrs map[string]string) {
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',', ' ':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, s[start:])
+	for _, p := range parts {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if k == "" {
+			continue
+		}
+		if !ok {
+			v = "true"
+		}
+		attrs[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"'`)
+	}
+}
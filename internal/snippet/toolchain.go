@@ -0,0 +1,109 @@
+package snippet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/version"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Toolchain is a Go toolchain to check and run blocks with.
+type Toolchain struct {
+	// Name is how it was asked for: "go", or a golang.org/dl wrapper like
+	// "go1.22.12".
+	Name string
+	// Go is the path of its go command.
+	Go string
+	// Version is its GOVERSION, like "go1.22.12".
+	Version string
+}
+
+// FindToolchain resolves name, "go" or a golang.org/dl wrapper like
+// "go1.22.12", to its go command. The wrappers find their SDK through
+// $HOME, which the Runner replaces, so the command is the SDK's own.
+// With install, a wrapper that isn't on $PATH is installed and its SDK
+// downloaded first.
+func FindToolchain(ctx context.Context, name string, install bool) (Toolchain, error) {
+	if _, err := exec.LookPath(name); err != nil && install && name != "go" {
+		if out, err := exec.CommandContext(ctx, "go", "install", "golang.org/dl/"+name+"@latest").CombinedOutput(); err != nil {
+			return Toolchain{}, fmt.Errorf("snippet: install %s: %v\n%s", name, err, out)
+		}
+		// go install puts the wrapper in GOBIN, which needn't be on $PATH.
+		if bin, err := goBin(ctx); err == nil {
+			if p := filepath.Join(bin, name); exists(p) {
+				name = p
+			}
+		}
+		if out, err := exec.CommandContext(ctx, name, "download").CombinedOutput(); err != nil {
+			return Toolchain{}, fmt.Errorf("snippet: %s download: %v\n%s", name, err, out)
+		}
+	}
+	out, err := exec.CommandContext(ctx, name, "env", "GOROOT", "GOVERSION").Output()
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			err = fmt.Errorf("%v: %s", err, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return Toolchain{}, fmt.Errorf("snippet: toolchain %s: %w; install it with -install, or go install golang.org/dl/%s@latest && %s download", filepath.Base(name), err, filepath.Base(name), filepath.Base(name))
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) != 2 {
+		return Toolchain{}, fmt.Errorf("snippet: toolchain %s: unexpected go env output %q", name, out)
+	}
+	return Toolchain{
+		Name:    filepath.Base(name),
+		Go:      filepath.Join(lines[0], "bin", "go"),
+		Version: lines[1],
+	}, nil
+}
+
+func goBin(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "go", "env", "GOBIN", "GOPATH").Output()
+	if err != nil {
+		return "", err
+	}
+	gobin, gopath, _ := strings.Cut(strings.TrimRight(string(out), "\n"), "\n")
+	if gobin != "" {
+		return gobin, nil
+	}
+	return filepath.Join(filepath.SplitList(gopath)[0], "bin"), nil
+}
+
+func exists(p string) bool {
+	_, err := exec.LookPath(p)
+	return err == nil
+}
+
+// MinGo returns the Go version b declares it needs with {go=1.22}, as in
+// a post about a language change, or "" if it doesn't.
+func (b Block) MinGo() string {
+	return b.Attrs["go"]
+}
+
+// Supports reports whether t is at least the version b needs. A
+// toolchain of unknown version, the plain "go" on $PATH, supports every
+// block.
+func (t Toolchain) Supports(b Block) bool {
+	v := b.MinGo()
+	if v == "" || t.Version == "" {
+		return true
+	}
+	if !strings.HasPrefix(v, "go") {
+		v = "go" + v
+	}
+	return version.Compare(t.Version, v) >= 0
+}
+
+// SupportsUnit reports whether t is at least the version every block in
+// u needs.
+func (t Toolchain) SupportsUnit(u Unit) bool {
+	for _, b := range u.Files {
+		if !t.Supports(b) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+// Package spell spell-checks the prose of posts with hunspell. Code
+// blocks, inline code, URLs, HTML tags, and shortcodes aren't prose and are
+// skipped, and the words hunspell doesn't know but the site uses on
+// purpose, like names of languages and tools, are listed in
+// data/dictionary.txt.
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+// DefaultDictionary is the project's word list: one word per line, with
+// # comments. Words match regardless of case.
+const DefaultDictionary = "data/dictionary.txt"
+
+// DefaultCommand lists, one per line, the words read from stdin that
+// aren't in the en_US dictionary.
+var DefaultCommand = []string{"hunspell", "-d", "en_US", "-i", "UTF-8", "-l"}
+
+// Word is a word at a line and column of a post's file.
+type Word struct {
+	Text      string
+	Line, Col int
+}
+
+// notProse matches the parts of a line that aren't words to check: code
+// spans, URLs and email addresses, link destinations, reference
+// definitions, footnote and heading ID markers, HTML tags and entities,
+// and shortcodes.
+var notProse = regexp.MustCompile("(`+).*?(?:`+|$)" +
+	`|\{\{[<%].*?(?:[%>]\}\}|$)` +
+	`|<[^>]*>?` +
+	`|&#?\w+;` +
+	`|\]\([^)]*\)` +
+	`|^\s*\[[^\]]+\]:.*` +
+	`|\[\^[^\]]*\]` +
+	`|\{#[^}]*\}` +
+	`|\b(?:https?://|www\.)\S+` +
+	`|\S+@\S+\.\w+`)
+
+var wordRe = regexp.MustCompile(`\p{L}+(?:['’]\p{L}+)*`)
+
+// Words returns the words of p's prose, in order.
+func Words(p *content.Post) []Word {
+	code := map[int]bool{}
+	for _, b := range snippet.Extract(p) {
+		for l := b.Line; l <= b.End; l++ {
+			code[l] = true
+		}
+	}
+	var words []Word
+	for i, line := range strings.Split(p.Body, "\n") {
+		n := p.BodyLine + i
+		if code[n] {
+			continue
+		}
+		line = notProse.ReplaceAllStringFunc(line, func(s string) string {
+			return strings.Repeat(" ", len(s))
+		})
+		for _, m := range wordRe.FindAllStringIndex(line, -1) {
+			w := line[m[0]:m[1]]
+			if len([]rune(w)) < 2 {
+				continue
+			}
+			words = append(words, Word{w, n, len([]rune(line[:m[0]])) + 1})
+		}
+	}
+	return words
+}
+
+// Dictionary is a set of accepted words, lowercased.
+type Dictionary map[string]bool
+
+// LoadDictionary reads the word list at path. A missing file is empty.
+func LoadDictionary(path string) (Dictionary, error) {
+	d := Dictionary{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if w := strings.TrimSpace(sc.Text()); w != "" && !strings.HasPrefix(w, "#") {
+			d[strings.ToLower(w)] = true
+		}
+	}
+	return d, sc.Err()
+}
+
+// Has reports whether w is in d, alone or with a possessive 's.
+func (d Dictionary) Has(w string) bool {
+	w = strings.ToLower(strings.ReplaceAll(w, "’", "'"))
+	return d[w] || d[strings.TrimSuffix(w, "'s")]
+}
+
+// Add appends words to the word list at path, skipping the ones it
+// already has, and returns how many it added.
+func Add(path string, words []string) (int, error) {
+	d, err := LoadDictionary(path)
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	for _, w := range words {
+		if !d.Has(w) {
+			d[strings.ToLower(w)] = true
+			fmt.Fprintln(&buf, w)
+		}
+	}
+	if buf.Len() == 0 {
+		return 0, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return bytes.Count(buf.Bytes(), []byte("\n")), f.Close()
+}
+
+// Unknown returns the distinct words among words that neither dict nor
+// the spell checker command knows, in the order they first appear.
+func Unknown(ctx context.Context, command []string, dict Dictionary, words []Word) ([]string, error) {
+	var (
+		check []string
+		seen  = map[string]bool{}
+	)
+	for _, w := range words {
+		if !seen[w.Text] && !dict.Has(w.Text) {
+			seen[w.Text] = true
+			check = append(check, w.Text)
+		}
+	}
+	if len(check) == 0 {
+		return nil, nil
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(strings.Join(check, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("spell: %s: %w", command[0], err)
+	}
+	bad := map[string]bool{}
+	for _, w := range strings.Fields(string(out)) {
+		bad[w] = true
+	}
+	return slices.DeleteFunc(check, func(w string) bool { return !bad[w] }), nil
+}
@@ -0,0 +1,204 @@
+// Package stats adds up the writing for the /stats/ page, which reads it
+// as site.Data.stats: the posts and words of each year and tag, the
+// average length, the longest waits between posts, and the sites linked
+// to most.
+package stats
+
+import (
+	"cmp"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/linkcheck"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/readtime"
+	"github.com/rednafi/rednafi.com/internal/tags"
+)
+
+// DefaultPath is where templates read the stats from, as site.Data.stats.
+const DefaultPath = "data/stats.json"
+
+// Stats is what gets written to DefaultPath. Words are the prose words
+// internal/readtime counts, code left out.
+type Stats struct {
+	Posts   int    `json:"posts"`
+	Words   int    `json:"words"`
+	Average int    `json:"average"`
+	First   string `json:"first"`
+	Last    string `json:"last"`
+	// Longest is the post with the most words.
+	Longest *Entry `json:"longest,omitempty"`
+	Years   []Row  `json:"years"`
+	Tags    []Row  `json:"tags"`
+	// Gaps are the longest waits between two posts, longest first.
+	Gaps []Gap `json:"gaps"`
+	// Domains are the sites the posts link to most, by the number of
+	// posts linking to them.
+	Domains []Domain `json:"domains"`
+}
+
+// Row is the posts of a year or a tag. Year rows are newest first; tag
+// rows have the most posts first.
+type Row struct {
+	Name    string `json:"name"`
+	Posts   int    `json:"posts"`
+	Words   int    `json:"words"`
+	Average int    `json:"average"`
+}
+
+// Entry is a post as the stats name it.
+type Entry struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Date  string `json:"date"`
+	Words int    `json:"words"`
+}
+
+// Gap is the wait between a post and the one after it.
+type Gap struct {
+	Days   int   `json:"days"`
+	Before Entry `json:"before"`
+	After  Entry `json:"after"`
+}
+
+// Domain is a site the posts link to.
+type Domain struct {
+	Host  string `json:"host"`
+	Posts int    `json:"posts"`
+	Links int    `json:"links"`
+}
+
+// Options bound the lists.
+type Options struct {
+	Gaps    int
+	Domains int
+	// Host is the site's, from baseURL; links to it aren't counted among
+	// the sites linked to.
+	Host string
+}
+
+// DefaultOptions are the list lengths the page shows.
+var DefaultOptions = Options{Gaps: 5, Domains: 15}
+
+// Build adds up the published articles in posts, leaving out the notes,
+// with their tags normalized through aliases.
+func Build(posts []*content.Post, aliases tags.Aliases, opts Options) Stats {
+	var articles []*content.Post
+	for _, p := range content.Articles(content.Published(posts)) {
+		if !p.Date.IsZero() {
+			articles = append(articles, p)
+		}
+	}
+	slices.SortStableFunc(articles, func(a, b *content.Post) int { return b.Date.Compare(a.Date) })
+
+	s := Stats{Years: []Row{}, Tags: []Row{}, Gaps: []Gap{}, Domains: []Domain{}}
+	if len(articles) == 0 {
+		return s
+	}
+	s.First = articles[len(articles)-1].Date.Format(time.DateOnly)
+	s.Last = articles[0].Date.Format(time.DateOnly)
+
+	byTag := map[string]*Row{}
+	domains := map[string]*Domain{}
+	entries := make([]Entry, len(articles))
+	for i, p := range articles {
+		e := Entry{
+			Title: p.Title,
+			URL:   p.RelPermalink(),
+			Date:  p.Date.Format(time.DateOnly),
+			Words: readtime.Count(p).Words,
+		}
+		entries[i] = e
+		s.Posts++
+		s.Words += e.Words
+		if s.Longest == nil || e.Words > s.Longest.Words {
+			s.Longest = &entries[i]
+		}
+
+		year := p.Date.Format("2006")
+		if n := len(s.Years); n == 0 || s.Years[n-1].Name != year {
+			s.Years = append(s.Years, Row{Name: year})
+		}
+		add(&s.Years[len(s.Years)-1], e.Words)
+		for _, t := range aliases.Normalize(p.Tags) {
+			r, ok := byTag[t]
+			if !ok {
+				r = &Row{Name: t}
+				byTag[t] = r
+			}
+			add(r, e.Words)
+		}
+
+		seen := map[string]bool{}
+		for _, l := range markdown.Parse([]byte(p.Body), p.BodyLine).Links() {
+			h := host(opts.Host, l.Dest)
+			if l.Image || h == "" {
+				continue
+			}
+			d, ok := domains[h]
+			if !ok {
+				d = &Domain{Host: h}
+				domains[h] = d
+			}
+			d.Links++
+			if !seen[h] {
+				seen[h] = true
+				d.Posts++
+			}
+		}
+	}
+	s.Average = s.Words / s.Posts
+
+	for _, r := range byTag {
+		s.Tags = append(s.Tags, *r)
+	}
+	slices.SortFunc(s.Tags, func(a, b Row) int {
+		return cmp.Or(cmp.Compare(b.Posts, a.Posts), cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)))
+	})
+
+	for i := 1; i < len(articles); i++ {
+		days := int(articles[i-1].Date.Sub(articles[i].Date).Hours() / 24)
+		s.Gaps = append(s.Gaps, Gap{Days: days, Before: entries[i], After: entries[i-1]})
+	}
+	slices.SortStableFunc(s.Gaps, func(a, b Gap) int { return cmp.Compare(b.Days, a.Days) })
+	s.Gaps = s.Gaps[:min(len(s.Gaps), opts.Gaps)]
+
+	for _, d := range domains {
+		s.Domains = append(s.Domains, *d)
+	}
+	slices.SortFunc(s.Domains, func(a, b Domain) int {
+		return cmp.Or(cmp.Compare(b.Posts, a.Posts), cmp.Compare(b.Links, a.Links), cmp.Compare(a.Host, b.Host))
+	})
+	s.Domains = s.Domains[:min(len(s.Domains), opts.Domains)]
+	return s
+}
+
+// add counts a post of words into r.
+func add(r *Row, words int) {
+	r.Posts++
+	r.Words += words
+	r.Average = r.Words / r.Posts
+}
+
+// host is the site an external link points at, without "www.", or "" if
+// dest isn't one, that is if it points at site.
+func host(site, dest string) string {
+	if !linkcheck.IsExternal(site, dest) {
+		return ""
+	}
+	u, err := url.Parse(strings.TrimSpace(dest))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// Write writes s to path as JSON, leaving the file alone if it wouldn't
+// change. It reports whether it wrote.
+func Write(path string, s Stats) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, s)
+}
@@ -0,0 +1,374 @@
+// Package suggest finds phrases in a post's prose that match another
+// post's title or keywords and proposes linking them to that post.
+package suggest
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/search"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// Options tunes how eager the suggestions are.
+type Options struct {
+	// PerPost caps the suggestions for a single post.
+	PerPost int
+	// MaxPosts drops a phrase taken from a title when more than this many
+	// posts use it; those are too generic to point at one post. Full
+	// titles and front matter keywords are always kept.
+	MaxPosts int
+}
+
+// Suggestion is a phrase in a post that could link to another post.
+type Suggestion struct {
+	// Path is the post the phrase is in, relative to the content directory.
+	Path string
+	Line int
+	// Text is the phrase as written in the post.
+	Text string
+	// URL and Title are the post to link to.
+	URL   string
+	Title string
+
+	// start and end are the phrase's byte offsets in the post's body.
+	start, end int
+}
+
+func (s Suggestion) String() string {
+	text := strings.Join(strings.Fields(s.Text), " ")
+	return fmt.Sprintf("%d: %q -> %s (%s)", s.Line, text, s.URL, s.Title)
+}
+
+// target is a post a phrase can link to.
+type target struct {
+	post *content.Post
+	// derived is set for phrases cut out of the title, which MaxPosts
+	// applies to.
+	derived bool
+}
+
+// run is a stretch of plain prose in a post's body: consecutive text nodes
+// outside links, code, and headings. norm is the text lowercased with
+// whitespace collapsed, and off maps each byte of norm, plus one past the
+// end, to an offset in the body.
+type run struct {
+	norm string
+	off  []int
+}
+
+type page struct {
+	post   *content.Post
+	doc    *markdown.Doc
+	runs   []run
+	linked map[string]bool
+}
+
+// Suggest proposes links between the published posts, at most o.PerPost
+// per post, sorted by path and line. A post never gets a suggestion for
+// itself or for a post it already links to, and each target is suggested
+// once per post, at its first mention. Links to cfg's BaseURL count as
+// internal, so do relative ones.
+func Suggest(cfg *site.Config, posts []*content.Post, o Options) []Suggestion {
+	var host string
+	if u, err := url.Parse(cfg.BaseURL); err == nil {
+		host = u.Host
+	}
+	posts = content.Published(posts)
+	pages := make([]*page, len(posts))
+	for i, p := range posts {
+		pages[i] = newPage(p, host)
+	}
+
+	targets := map[string][]target{}
+	for _, p := range posts {
+		for phrase, derived := range Phrases(p) {
+			targets[phrase] = append(targets[phrase], target{p, derived})
+		}
+	}
+	var phrases []string
+	for phrase, ts := range targets {
+		// A phrase that would link to two posts links to neither.
+		if len(ts) != 1 {
+			continue
+		}
+		if ts[0].derived && o.MaxPosts > 0 {
+			var n int
+			for _, pg := range pages {
+				if pg.post != ts[0].post && pg.find(phrase, nil) >= 0 {
+					n++
+				}
+			}
+			if n > o.MaxPosts {
+				continue
+			}
+		}
+		phrases = append(phrases, phrase)
+	}
+	// Longer phrases first, so "python dependency management" wins over
+	// "dependency management" when both match.
+	sort.Slice(phrases, func(i, j int) bool {
+		if len(phrases[i]) != len(phrases[j]) {
+			return len(phrases[i]) > len(phrases[j])
+		}
+		return phrases[i] < phrases[j]
+	})
+
+	var out []Suggestion
+	for _, pg := range pages {
+		var (
+			ss   []Suggestion
+			done = map[*content.Post]bool{}
+		)
+		for _, phrase := range phrases {
+			if o.PerPost > 0 && len(ss) >= o.PerPost {
+				break
+			}
+			t := targets[phrase][0].post
+			if t == pg.post || done[t] || pg.linked[t.RelPermalink()] {
+				continue
+			}
+			s, ok := pg.match(phrase, ss)
+			if !ok {
+				continue
+			}
+			s.URL, s.Title = t.RelPermalink(), t.Title
+			ss = append(ss, s)
+			done[t] = true
+		}
+		out = append(out, ss...)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].start < out[j].start
+	})
+	return out
+}
+
+// Phrases returns the normalized phrases other posts may link to p by,
+// each mapped to whether it was derived from the title rather than being
+// the full title or one of the post's keywords. Derived phrases are the
+// runs of two or more words in the title between stopwords, and single
+// words that look like identifiers, such as "concurrent.futures".
+func Phrases(p *content.Post) map[string]bool {
+	out := map[string]bool{}
+	if t := normalize(p.Title); t != "" {
+		out[t] = false
+	}
+	switch kw := p.Params["keywords"].(type) {
+	case []any:
+		for _, k := range kw {
+			if k := normalize(fmt.Sprint(k)); k != "" {
+				out[k] = false
+			}
+		}
+	case string:
+		for _, k := range strings.Split(kw, ",") {
+			if k := normalize(k); k != "" {
+				out[k] = false
+			}
+		}
+	}
+
+	var words []string
+	flush := func() {
+		if len(words) > 1 || len(words) == 1 && strings.ContainsAny(words[0], "._") {
+			if s := strings.Join(words, " "); !contains(out, s) {
+				out[s] = true
+			}
+		}
+		words = words[:0]
+	}
+	for _, w := range strings.Fields(normalize(p.Title)) {
+		w = strings.Trim(w, `'".,:;!?()`)
+		if w == "" || search.IsStopword(w) || search.IsStopword(strings.TrimSuffix(w, "'s")) {
+			flush()
+			continue
+		}
+		words = append(words, w)
+	}
+	flush()
+	return out
+}
+
+func contains(m map[string]bool, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// newPage reads p's prose and the internal links it has, the ones
+// without a host or to host.
+func newPage(p *content.Post, host string) *page {
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	pg := &page{post: p, doc: doc, linked: map[string]bool{}}
+	for _, l := range doc.Links() {
+		if u, err := url.Parse(l.Dest); err == nil && (u.Host == "" || strings.EqualFold(u.Host, host)) {
+			pg.linked["/"+strings.Trim(u.Path, "/")+"/"] = true
+		}
+	}
+	_ = ast.Walk(doc.Root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.(type) {
+		case *ast.Heading, *ast.Link, *ast.Image, *ast.AutoLink, *ast.CodeSpan,
+			*ast.FencedCodeBlock, *ast.CodeBlock, *ast.HTMLBlock, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		start, end := -1, -1
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			switch c := c.(type) {
+			case *ast.Text:
+				if start < 0 {
+					start = c.Segment.Start
+				}
+				end = c.Segment.Stop
+				continue
+			case *ast.String:
+				// Typographer quotes and dashes sit between the text
+				// segments around them.
+				if start >= 0 {
+					continue
+				}
+			}
+			if start >= 0 {
+				pg.runs = append(pg.runs, newRun(p.Body, start, end))
+				start = -1
+			}
+		}
+		if start >= 0 {
+			pg.runs = append(pg.runs, newRun(p.Body, start, end))
+		}
+		return ast.WalkContinue, nil
+	})
+	return pg
+}
+
+func newRun(body string, start, end int) run {
+	var (
+		b     strings.Builder
+		off   []int
+		space bool
+	)
+	for i, r := range body[start:end] {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+				off = append(off, start+i)
+			}
+			space = true
+			continue
+		}
+		space = false
+		r = fold(r)
+		for range utf8.RuneLen(r) {
+			off = append(off, start+i)
+		}
+		b.WriteRune(r)
+	}
+	return run{norm: b.String(), off: append(off, end)}
+}
+
+// normalize lowercases s, straightens its apostrophes, and collapses its
+// whitespace, the way runs are.
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.Map(fold, s)), " ")
+}
+
+func fold(r rune) rune {
+	if r == '’' || r == '‘' {
+		return '\''
+	}
+	return unicode.ToLower(r)
+}
+
+// find returns the index of the first run with a whole-word match of
+// phrase that doesn't overlap taken, or -1.
+func (pg *page) find(phrase string, taken []Suggestion) int {
+	for i, r := range pg.runs {
+		if _, _, ok := r.match(phrase, taken); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// match returns the first mention of phrase in the post as a Suggestion.
+func (pg *page) match(phrase string, taken []Suggestion) (Suggestion, bool) {
+	for _, r := range pg.runs {
+		start, end, ok := r.match(phrase, taken)
+		if !ok {
+			continue
+		}
+		text := pg.post.Body[start:end]
+		if strings.ContainsAny(text, "[]") {
+			continue
+		}
+		return Suggestion{
+			Path:  pg.post.Path,
+			Line:  pg.doc.Line(start),
+			Text:  text,
+			start: start,
+			end:   end,
+		}, true
+	}
+	return Suggestion{}, false
+}
+
+// match returns the body offsets of the first whole-word match of phrase
+// in r that doesn't overlap taken.
+func (r run) match(phrase string, taken []Suggestion) (start, end int, ok bool) {
+	for from := 0; ; {
+		i := strings.Index(r.norm[from:], phrase)
+		if i < 0 {
+			return 0, 0, false
+		}
+		i += from
+		j := i + len(phrase)
+		from = i + 1
+		if before, _ := utf8.DecodeLastRuneInString(r.norm[:i]); i > 0 && isWord(before) {
+			continue
+		}
+		if after, _ := utf8.DecodeRuneInString(r.norm[j:]); j < len(r.norm) && isWord(after) {
+			continue
+		}
+		start, end = r.off[i], r.off[j]
+		if !overlaps(start, end, taken) {
+			return start, end, true
+		}
+	}
+}
+
+func overlaps(start, end int, taken []Suggestion) bool {
+	for _, s := range taken {
+		if start < s.end && s.start < end {
+			return true
+		}
+	}
+	return false
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Apply links the suggested phrases in body, which must be the body the
+// suggestions were made for.
+func Apply(body string, ss []Suggestion) string {
+	ss = append([]Suggestion(nil), ss...)
+	sort.Slice(ss, func(i, j int) bool { return ss[i].start > ss[j].start })
+	for _, s := range ss {
+		body = body[:s.start] + "[" + body[s.start:s.end] + "](" + s.URL + ")" + body[s.end:]
+	}
+	return body
+}
@@ -0,0 +1,152 @@
+// Package summarize drafts a post's summary and meta description with a
+// language model, for the posts that don't have them yet.
+//
+// Drafts come from any OpenAI-compatible /chat/completions endpoint, as
+// embeddings do in internal/embed, so a local Ollama or llama.cpp server
+// works as well as a hosted API. `blogctl summarize` writes them into the
+// posts' front matter.
+package summarize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// Default endpoint and model.
+const (
+	DefaultBaseURL = "https://api.openai.com/v1"
+	DefaultModel   = "gpt-4o-mini"
+)
+
+// maxInput is how many characters of a post's prose the model is given.
+// The summary is about what the post sets out to do, which is in its
+// opening, so long posts lose little to the cut.
+const maxInput = 24000
+
+// Client requests drafts from an OpenAI-compatible API.
+type Client struct {
+	HTTP *http.Client
+	// BaseURL is the API root, e.g. "https://api.openai.com/v1".
+	BaseURL string
+	APIKey  string
+	Model   string
+}
+
+// ClientFromEnv returns a client configured by SUMMARIZE_BASE_URL,
+// SUMMARIZE_API_KEY, and SUMMARIZE_MODEL, falling back to the defaults for
+// unset values and to OPENAI_API_KEY for the key.
+func ClientFromEnv() *Client {
+	c := &Client{
+		BaseURL: os.Getenv("SUMMARIZE_BASE_URL"),
+		APIKey:  os.Getenv("SUMMARIZE_API_KEY"),
+		Model:   os.Getenv("SUMMARIZE_MODEL"),
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	if c.APIKey == "" {
+		c.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if c.Model == "" {
+		c.Model = DefaultModel
+	}
+	return c
+}
+
+// Draft is a model's summary and description of a post.
+type Draft struct {
+	// Summary is two or three sentences for the post lists and feeds.
+	Summary string `json:"summary"`
+	// Description is a sentence for search results and link previews.
+	Description string `json:"description"`
+}
+
+const system = `You write the summary and the meta description of a post on a personal software blog.
+Write in the author's voice, in the first person where the post is, plainly and without hype.
+Don't start with "In this post" or "This post", and don't use emoji or markdown.
+The summary is 2 or 3 sentences saying what the post is about and what it concludes.
+The description is one sentence of %d to %d characters for search results.
+Reply with only a JSON object: {"summary": "...", "description": "..."}.`
+
+// Summarize drafts p's summary and a description between minDesc and
+// maxDesc characters long. The model is asked for that length; whether it
+// kept to it is for the caller to check.
+func (c *Client) Summarize(ctx context.Context, p *content.Post, minDesc, maxDesc int) (Draft, error) {
+	text := markdown.Parse([]byte(p.Body), p.BodyLine).PlainText(false)
+	if utf8.RuneCountInString(text) > maxInput {
+		text = string([]rune(text)[:maxInput])
+	}
+	body, err := json.Marshal(map[string]any{
+		"model": c.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": fmt.Sprintf(system, minDesc, maxDesc)},
+			{"role": "user", "content": "Title: " + p.Title + "\nTags: " + strings.Join(p.Tags, ", ") + "\n\n" + text},
+		},
+		"response_format": map[string]string{"type": "json_object"},
+		"temperature":     0.3,
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+"/chat/completions", bytes.NewReader(body),
+	)
+	if err != nil {
+		return Draft{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Draft{}, fmt.Errorf("summarize: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Draft{}, fmt.Errorf("summarize: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Draft{}, fmt.Errorf("summarize: decode response: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return Draft{}, fmt.Errorf("summarize: no reply")
+	}
+	reply := strings.TrimSpace(out.Choices[0].Message.Content)
+	// Some local models fence the object despite being asked not to.
+	reply = strings.TrimPrefix(strings.TrimPrefix(reply, "```json"), "```")
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "```"))
+	var d Draft
+	if err := json.Unmarshal([]byte(reply), &d); err != nil {
+		return Draft{}, fmt.Errorf("summarize: the reply isn't the JSON asked for: %w", err)
+	}
+	d.Summary = strings.Join(strings.Fields(d.Summary), " ")
+	d.Description = strings.Join(strings.Fields(d.Description), " ")
+	if d.Summary == "" || d.Description == "" {
+		return Draft{}, fmt.Errorf("summarize: the reply is missing the summary or description")
+	}
+	return d, nil
+}
@@ -0,0 +1,295 @@
+// Package sw generates the site's service worker. It precaches the home
+// page, the most recent posts, and the stylesheets, scripts, and icons
+// they load, and keeps the pages and images readers visit, so a post read
+// once opens again offline. The precache manifest is written into the
+// script with a revision hash of each file, so a build that changes a file
+// changes the script, and browsers install the new worker and refetch
+// only what changed.
+package sw
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"golang.org/x/net/html"
+
+	"github.com/rednafi/rednafi.com/internal/fingerprint"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// File is the service worker's name in the built site. It's served from
+// the root so its scope is the whole site.
+const File = "sw.js"
+
+// Entry is a precached URL. Revision is a hash of its contents, empty for
+// fingerprinted files, whose URLs change with their contents.
+type Entry struct {
+	URL      string `json:"url"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// Manifest returns the entries of the pages at urls, URL paths in the
+// built site dir, and of the local stylesheets, scripts, and icons they
+// load. Pages that weren't built are left out.
+func Manifest(dir string, urls []string) ([]Entry, error) {
+	var entries []Entry
+	seen := map[string]bool{}
+	// add adds the file at u once and reports whether it's in the build.
+	add := func(u string) (bool, error) {
+		if seen[u] {
+			return false, nil
+		}
+		b, err := os.ReadFile(file(dir, u))
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		seen[u] = true
+		e := Entry{URL: u}
+		if !fingerprint.Hashed(u) {
+			sum := sha256.Sum256(b)
+			e.Revision = hex.EncodeToString(sum[:])[:10]
+		}
+		entries = append(entries, e)
+		return true, nil
+	}
+	var assets []string
+	for _, u := range urls {
+		if ok, err := add(u); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		refs, err := subresources(dir, u)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, refs...)
+	}
+	for _, u := range assets {
+		if _, err := add(u); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// file returns the file in dir that serves the URL path u.
+func file(dir, u string) string {
+	if strings.HasSuffix(u, "/") {
+		u += "index.html"
+	}
+	return filepath.Join(dir, filepath.FromSlash(u))
+}
+
+// subresources returns the URL paths of the local stylesheets, scripts,
+// and icons the page at u loads.
+func subresources(dir, u string) ([]string, error) {
+	b, err := os.ReadFile(file(dir, u))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("sw: %s: %w", u, err)
+	}
+	self := &url.URL{Path: u}
+	var refs []string
+	add := func(ref string) {
+		r, err := self.Parse(strings.TrimSpace(ref))
+		if err != nil || r.Host != "" || r.Path == "" || strings.HasPrefix(ref, "data:") {
+			return
+		}
+		if !slices.Contains(refs, r.Path) {
+			refs = append(refs, r.Path)
+		}
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "link":
+				rel := strings.Fields(strings.ToLower(attr(n, "rel")))
+				if slices.Contains(rel, "stylesheet") || slices.Contains(rel, "icon") || slices.Contains(rel, "modulepreload") ||
+					slices.Contains(rel, "preload") && slices.Contains([]string{"style", "script", "font"}, attr(n, "as")) {
+					add(attr(n, "href"))
+				}
+			case "script":
+				if src := attr(n, "src"); src != "" {
+					add(src)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return refs, nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// Options tune the service worker.
+type Options struct {
+	// Pages and Assets cap the visited pages and images kept for offline
+	// reading, besides the precached ones; the oldest go first.
+	Pages, Assets int
+	// Offline is the precached page shown for a page that isn't cached.
+	Offline string
+}
+
+var script = template.Must(template.New(File).Parse(`// Generated by "blogctl sw" on every build; don't edit.
+const PRECACHE = "precache-{{.Version}}";
+const PAGES = "pages";
+const ASSETS = "assets";
+const MAX_PAGES = {{.Pages}};
+const MAX_ASSETS = {{.Assets}};
+const OFFLINE = {{.Offline}};
+const MANIFEST = {{.Manifest}};
+
+// Precached files are keyed by revision, so a new worker copies the ones
+// that didn't change from the old cache instead of fetching them again.
+const KEYS = new Map(
+  MANIFEST.map((e) => [e.url, e.revision ? e.url + "?__rev=" + e.revision : e.url]),
+);
+
+self.addEventListener("install", (event) => {
+  event.waitUntil(
+    caches.open(PRECACHE).then((cache) =>
+      Promise.all(
+        [...KEYS].map(async ([url, key]) => {
+          const cached = await caches.match(key);
+          if (cached) return cache.put(key, cached);
+          const res = await fetch(url, { cache: "reload" });
+          if (!res.ok) throw new Error(url + ": " + res.status);
+          return cache.put(key, res);
+        }),
+      ),
+    ).then(() => self.skipWaiting()),
+  );
+});
+
+self.addEventListener("activate", (event) => {
+  event.waitUntil(
+    caches.keys()
+      .then((names) =>
+        Promise.all(
+          names
+            .filter((n) => n.startsWith("precache-") && n !== PRECACHE)
+            .map((n) => caches.delete(n)),
+        ),
+      )
+      .then(() => self.clients.claim()),
+  );
+});
+
+async function keep(name, max, req, res) {
+  const cache = await caches.open(name);
+  await cache.put(req, res);
+  const keys = await cache.keys();
+  for (const key of keys.slice(0, Math.max(keys.length - max, 0))) {
+    await cache.delete(key);
+  }
+}
+
+function precached(path) {
+  const key = KEYS.get(path);
+  return key ? caches.open(PRECACHE).then((c) => c.match(key)) : Promise.resolve(undefined);
+}
+
+self.addEventListener("fetch", (event) => {
+  const req = event.request;
+  const url = new URL(req.url);
+  if (req.method !== "GET" || url.origin !== location.origin) return;
+
+  // Pages come from the network while it's there, so they're never stale,
+  // and from the caches when it isn't.
+  if (req.mode === "navigate") {
+    event.respondWith(
+      fetch(req)
+        .then((res) => {
+          if (res.ok) event.waitUntil(keep(PAGES, MAX_PAGES, req, res.clone()));
+          return res;
+        })
+        .catch(async () =>
+          (await caches.match(req, { ignoreSearch: true })) ||
+          (await precached(url.pathname)) ||
+          (await precached(OFFLINE)) ||
+          Response.error(),
+        ),
+    );
+    return;
+  }
+
+  if (KEYS.has(url.pathname)) {
+    event.respondWith(precached(url.pathname).then((res) => res || fetch(req)));
+    return;
+  }
+
+  // Images and fonts visited pages used are kept for offline reading.
+  if (req.destination === "image" || req.destination === "font") {
+    event.respondWith(
+      caches.match(req).then(
+        (cached) =>
+          cached ||
+          fetch(req).then((res) => {
+            if (res.ok) event.waitUntil(keep(ASSETS, MAX_ASSETS, req, res.clone()));
+            return res;
+          }),
+      ),
+    );
+  }
+});
+`))
+
+// Script returns the service worker that precaches entries.
+func Script(entries []Entry, opts Options) ([]byte, error) {
+	manifest, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	offline, err := json.Marshal(opts.Offline)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(manifest)
+	var buf bytes.Buffer
+	err = script.Execute(&buf, map[string]any{
+		"Version":  hex.EncodeToString(sum[:])[:10],
+		"Pages":    opts.Pages,
+		"Assets":   opts.Assets,
+		"Offline":  string(offline),
+		"Manifest": string(manifest),
+	})
+	return buf.Bytes(), err
+}
+
+// Write writes the service worker that precaches entries into the built
+// site dir and reports whether it changed.
+func Write(dir string, entries []Entry, opts Options) (bool, error) {
+	b, err := Script(entries, opts)
+	if err != nil {
+		return false, err
+	}
+	return fsutil.WriteIfChanged(filepath.Join(dir, File), b)
+}
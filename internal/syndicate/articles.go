@@ -0,0 +1,208 @@
+package syndicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Article is a full post republished on another platform.
+type Article struct {
+	Title       string
+	Description string
+	// Markdown is the body converted to the publisher's Flavor.
+	Markdown string
+	// CanonicalURL points search engines back at the original post.
+	CanonicalURL string
+	Tags         []string
+}
+
+// Publisher is a blogging platform articles are cross-posted to. The
+// Result's URI holds the remote article ID that Update takes.
+type Publisher interface {
+	Name() string
+	Flavor() Flavor
+	Create(ctx context.Context, a Article) (Result, error)
+	Update(ctx context.Context, id string, a Article) (Result, error)
+}
+
+// DevTo publishes to dev.to through the Forem API.
+type DevTo struct {
+	HTTP   *http.Client
+	APIKey string
+}
+
+// DevToFromEnv configures dev.to from DEVTO_API_KEY, or returns nil.
+func DevToFromEnv() *DevTo {
+	if k := os.Getenv("DEVTO_API_KEY"); k != "" {
+		return &DevTo{APIKey: k}
+	}
+	return nil
+}
+
+// Name implements Publisher.
+func (d *DevTo) Name() string { return "devto" }
+
+// Flavor implements Publisher.
+func (d *DevTo) Flavor() Flavor { return FlavorDevTo }
+
+// Create implements Publisher.
+func (d *DevTo) Create(ctx context.Context, a Article) (Result, error) {
+	return d.send(ctx, http.MethodPost, "https://dev.to/api/articles", a)
+}
+
+// Update implements Publisher.
+func (d *DevTo) Update(ctx context.Context, id string, a Article) (Result, error) {
+	return d.send(ctx, http.MethodPut, "https://dev.to/api/articles/"+id, a)
+}
+
+func (d *DevTo) send(ctx context.Context, method, u string, a Article) (Result, error) {
+	body, err := json.Marshal(map[string]any{"article": map[string]any{
+		"title":         a.Title,
+		"body_markdown": a.Markdown,
+		"published":     true,
+		"canonical_url": a.CanonicalURL,
+		"description":   a.Description,
+		"tags":          devToTags(a.Tags),
+	}})
+	if err != nil {
+		return Result{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.forem.api-v1+json")
+	req.Header.Set("api-key", d.APIKey)
+	var out struct {
+		ID  int    `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := doJSON(d.HTTP, req, &out); err != nil {
+		return Result{}, err
+	}
+	return Result{URI: strconv.Itoa(out.ID), URL: out.URL, PostedAt: time.Now().UTC()}, nil
+}
+
+// devToTags fits tags to dev.to's rules: at most four, lowercase
+// alphanumerics only.
+func devToTags(tags []string) []string {
+	out := []string{}
+	for _, t := range tags {
+		var b strings.Builder
+		for _, r := range strings.ToLower(t) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				b.WriteRune(r)
+			}
+		}
+		if b.Len() > 0 && len(out) < 4 {
+			out = append(out, b.String())
+		}
+	}
+	return out
+}
+
+// Hashnode publishes to a Hashnode publication through its GraphQL API.
+type Hashnode struct {
+	HTTP          *http.Client
+	Token         string
+	PublicationID string
+}
+
+// HashnodeFromEnv configures Hashnode from HASHNODE_TOKEN and
+// HASHNODE_PUBLICATION_ID, or returns nil.
+func HashnodeFromEnv() *Hashnode {
+	h := &Hashnode{Token: os.Getenv("HASHNODE_TOKEN"), PublicationID: os.Getenv("HASHNODE_PUBLICATION_ID")}
+	if h.Token == "" || h.PublicationID == "" {
+		return nil
+	}
+	return h
+}
+
+// Name implements Publisher.
+func (h *Hashnode) Name() string { return "hashnode" }
+
+// Flavor implements Publisher.
+func (h *Hashnode) Flavor() Flavor { return FlavorCommonMark }
+
+// Create implements Publisher.
+func (h *Hashnode) Create(ctx context.Context, a Article) (Result, error) {
+	input := h.input(a)
+	input["publicationId"] = h.PublicationID
+	return h.mutate(ctx, "publishPost", "PublishPostInput", input)
+}
+
+// Update implements Publisher.
+func (h *Hashnode) Update(ctx context.Context, id string, a Article) (Result, error) {
+	input := h.input(a)
+	input["id"] = id
+	return h.mutate(ctx, "updatePost", "UpdatePostInput", input)
+}
+
+func (h *Hashnode) input(a Article) map[string]any {
+	tags := []map[string]string{}
+	for _, t := range a.Tags {
+		slug := strings.ToLower(strings.Join(strings.Fields(t), "-"))
+		tags = append(tags, map[string]string{"slug": slug, "name": t})
+	}
+	return map[string]any{
+		"title":              a.Title,
+		"subtitle":           a.Description,
+		"contentMarkdown":    a.Markdown,
+		"originalArticleURL": a.CanonicalURL,
+		"tags":               tags,
+	}
+}
+
+func (h *Hashnode) mutate(ctx context.Context, op, inputType string, input map[string]any) (Result, error) {
+	query := fmt.Sprintf(
+		`mutation($input: %s!) { %s(input: $input) { post { id url } } }`, inputType, op,
+	)
+	body, err := json.Marshal(map[string]any{"query": query, "variables": map[string]any{"input": input}})
+	if err != nil {
+		return Result{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://gql.hashnode.com", bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", h.Token)
+
+	var out struct {
+		Data map[string]struct {
+			Post struct {
+				ID  string `json:"id"`
+				URL string `json:"url"`
+			} `json:"post"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := doJSON(h.HTTP, req, &out); err != nil {
+		return Result{}, err
+	}
+	// GraphQL reports failures in the body of a 200 response.
+	if len(out.Errors) > 0 {
+		var errs []error
+		for _, e := range out.Errors {
+			errs = append(errs, errors.New(e.Message))
+		}
+		return Result{}, fmt.Errorf("syndicate: hashnode %s: %w", op, errors.Join(errs...))
+	}
+	p := out.Data[op].Post
+	if p.ID == "" {
+		return Result{}, fmt.Errorf("syndicate: hashnode %s: no post in response", op)
+	}
+	return Result{URI: p.ID, URL: p.URL, PostedAt: time.Now().UTC()}, nil
+}
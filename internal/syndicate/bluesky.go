@@ -0,0 +1,263 @@
+package syndicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Bluesky posts to Bluesky over the AT Protocol, authenticating with an app
+// password.
+type Bluesky struct {
+	HTTP *http.Client
+	// PDS is the account's personal data server. Defaults to
+	// https://bsky.social.
+	PDS         string
+	Handle      string
+	AppPassword string
+}
+
+// BlueskyFromEnv configures a Bluesky target from BLUESKY_HANDLE,
+// BLUESKY_APP_PASSWORD, and optionally BLUESKY_PDS. It returns nil if the
+// credentials aren't set.
+func BlueskyFromEnv() *Bluesky {
+	b := &Bluesky{
+		PDS:         os.Getenv("BLUESKY_PDS"),
+		Handle:      os.Getenv("BLUESKY_HANDLE"),
+		AppPassword: os.Getenv("BLUESKY_APP_PASSWORD"),
+	}
+	if b.Handle == "" || b.AppPassword == "" {
+		return nil
+	}
+	return b
+}
+
+// Name implements Target.
+func (b *Bluesky) Name() string { return "bluesky" }
+
+// blueskyMaxGraphemes is Bluesky's post length limit. Runes are counted
+// instead of graphemes, which errs on the short side.
+const blueskyMaxGraphemes = 300
+
+// Post implements Target. The post carries the link as a rich-text facet and
+// as an external embed, so it renders as a card.
+func (b *Bluesky) Post(ctx context.Context, a Announcement) (Result, error) {
+	var session struct {
+		AccessJwt string `json:"accessJwt"`
+		DID       string `json:"did"`
+		Handle    string `json:"handle"`
+	}
+	err := b.call(ctx, "com.atproto.server.createSession", "", map[string]string{
+		"identifier": b.Handle,
+		"password":   b.AppPassword,
+	}, &session)
+	if err != nil {
+		return Result{}, err
+	}
+
+	title := Truncate(a.Title, blueskyMaxGraphemes-len([]rune(a.URL))-2)
+	text := title + "\n\n" + a.URL
+	start := len(title) + 2 // facets index UTF-8 bytes
+	record := map[string]any{
+		"$type":     "app.bsky.feed.post",
+		"text":      text,
+		"createdAt": time.Now().UTC().Format(time.RFC3339),
+		"langs":     []string{"en"},
+		"facets": []any{map[string]any{
+			"index": map[string]int{"byteStart": start, "byteEnd": start + len(a.URL)},
+			"features": []any{map[string]string{
+				"$type": "app.bsky.richtext.facet#link",
+				"uri":   a.URL,
+			}},
+		}},
+		"embed": map[string]any{
+			"$type": "app.bsky.embed.external",
+			"external": map[string]string{
+				"uri":         a.URL,
+				"title":       a.Title,
+				"description": a.Summary,
+			},
+		},
+	}
+	var created struct {
+		URI string `json:"uri"`
+	}
+	err = b.call(ctx, "com.atproto.repo.createRecord", session.AccessJwt, map[string]any{
+		"repo":       session.DID,
+		"collection": "app.bsky.feed.post",
+		"record":     record,
+	}, &created)
+	if err != nil {
+		return Result{}, err
+	}
+	// at://<did>/app.bsky.feed.post/<rkey>
+	rkey := created.URI[strings.LastIndexByte(created.URI, '/')+1:]
+	return Result{
+		URI:      created.URI,
+		URL:      "https://bsky.app/profile/" + session.Handle + "/post/" + rkey,
+		PostedAt: time.Now().UTC(),
+	}, nil
+}
+
+// call invokes an XRPC procedure on the PDS.
+func (b *Bluesky) call(ctx context.Context, method, token string, in, out any) error {
+	pds := b.PDS
+	if pds == "" {
+		pds = "https://bsky.social"
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, strings.TrimSuffix(pds, "/")+"/xrpc/"+method, bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return doJSON(b.HTTP, req, out)
+}
+
+// doJSON sends req and decodes a JSON response into out, turning non-2xx
+// responses into errors that include the body.
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("syndicate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("syndicate: %s %s: %s: %s",
+			req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("syndicate: decode %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// PostThread implements Threader. Each part replies to the one before,
+// with its code block uploaded as an image and its links as facets.
+func (b *Bluesky) PostThread(ctx context.Context, parts []ThreadPart) (Result, error) {
+	var session struct {
+		AccessJwt string `json:"accessJwt"`
+		DID       string `json:"did"`
+		Handle    string `json:"handle"`
+	}
+	err := b.call(ctx, "com.atproto.server.createSession", "", map[string]string{
+		"identifier": b.Handle,
+		"password":   b.AppPassword,
+	}, &session)
+	if err != nil {
+		return Result{}, err
+	}
+
+	type ref struct {
+		URI string `json:"uri"`
+		CID string `json:"cid"`
+	}
+	var root, parent ref
+	for i, part := range parts {
+		record := map[string]any{
+			"$type":     "app.bsky.feed.post",
+			"text":      part.Text,
+			"createdAt": time.Now().UTC().Format(time.RFC3339),
+			"langs":     []string{"en"},
+		}
+		if facets := linkFacets(part.Text); len(facets) > 0 {
+			record["facets"] = facets
+		}
+		if part.Code != nil {
+			blob, err := b.uploadBlob(ctx, session.AccessJwt, part.Code.PNG, "image/png")
+			if err != nil {
+				return Result{}, err
+			}
+			record["embed"] = map[string]any{
+				"$type":  "app.bsky.embed.images",
+				"images": []any{map[string]any{"alt": part.Code.Alt(), "image": blob}},
+			}
+		}
+		if i > 0 {
+			record["reply"] = map[string]ref{"root": root, "parent": parent}
+		}
+		var created ref
+		err = b.call(ctx, "com.atproto.repo.createRecord", session.AccessJwt, map[string]any{
+			"repo":       session.DID,
+			"collection": "app.bsky.feed.post",
+			"record":     record,
+		}, &created)
+		if err != nil {
+			return Result{}, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		if i == 0 {
+			root = created
+		}
+		parent = created
+	}
+	rkey := root.URI[strings.LastIndexByte(root.URI, '/')+1:]
+	return Result{
+		URI:      root.URI,
+		URL:      "https://bsky.app/profile/" + session.Handle + "/post/" + rkey,
+		PostedAt: time.Now().UTC(),
+	}, nil
+}
+
+// uploadBlob uploads data to the PDS and returns the blob to reference it
+// by in a record.
+func (b *Bluesky) uploadBlob(ctx context.Context, token string, data []byte, mime string) (json.RawMessage, error) {
+	pds := b.PDS
+	if pds == "" {
+		pds = "https://bsky.social"
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, strings.TrimSuffix(pds, "/")+"/xrpc/com.atproto.repo.uploadBlob", bytes.NewReader(data),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mime)
+	req.Header.Set("Authorization", "Bearer "+token)
+	var out struct {
+		Blob json.RawMessage `json:"blob"`
+	}
+	if err := doJSON(b.HTTP, req, &out); err != nil {
+		return nil, err
+	}
+	return out.Blob, nil
+}
+
+var linkRe = regexp.MustCompile(`https?://[^\s]+[^\s.,;:!?)"']`)
+
+// linkFacets marks the links in text, which Bluesky doesn't find on its
+// own. Facets index UTF-8 bytes.
+func linkFacets(text string) []any {
+	var facets []any
+	for _, m := range linkRe.FindAllStringIndex(text, -1) {
+		facets = append(facets, map[string]any{
+			"index": map[string]int{"byteStart": m[0], "byteEnd": m[1]},
+			"features": []any{map[string]string{
+				"$type": "app.bsky.richtext.facet#link",
+				"uri":   text[m[0]:m[1]],
+			}},
+		})
+	}
+	return facets
+}
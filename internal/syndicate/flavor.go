@@ -0,0 +1,94 @@
+package syndicate
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/snippet"
+)
+
+// Flavor is a platform's markdown dialect.
+type Flavor int
+
+const (
+	// FlavorCommonMark needs only the portable fixes: absolute links and plain
+	// fence info strings. Hashnode takes it as is.
+	FlavorCommonMark Flavor = iota
+	// FlavorDevTo is Forem's markdown, which also runs Liquid tags, so code that
+	// contains {% or {{ has to be wrapped in raw tags.
+	FlavorDevTo
+)
+
+var (
+	// inlineLinkRe matches the destination of a root-relative or
+	// fragment-only inline link or image: ](/path) or ](#frag).
+	inlineLinkRe = regexp.MustCompile(`\]\(([/#][^)\s]*)`)
+	// refDefRe matches a reference definition with such a destination.
+	refDefRe = regexp.MustCompile(`^(\s*\[[^\]]+\]:\s*)([/#]\S*)`)
+)
+
+// Markdown converts a post body for republishing. Links relative to the
+// site are made absolute against permalink, so they lead back to
+// rednafi.com, and fence attributes such as {hl_lines=[2]} are dropped.
+func Markdown(body, permalink string, f Flavor) string {
+	base := permalink
+	if i := strings.Index(base, "://"); i >= 0 {
+		if j := strings.IndexByte(base[i+3:], '/'); j >= 0 {
+			base = base[:i+3+j]
+		}
+	}
+	abs := func(dest string) string {
+		if strings.HasPrefix(dest, "#") {
+			return permalink + dest
+		}
+		return base + dest
+	}
+
+	lines := strings.Split(body, "\n")
+	fences := map[int]snippet.Block{} // by 0-based opening line
+	inCode := make([]bool, len(lines))
+	for _, b := range snippet.Parse(body, 1) {
+		fences[b.Line-1] = b
+		for i := b.Line - 1; i < b.End; i++ {
+			inCode[i] = true
+		}
+	}
+
+	var out []string
+	for i, line := range lines {
+		if b, ok := fences[i]; ok {
+			raw := f == FlavorDevTo && (strings.Contains(b.Code, "{%") || strings.Contains(b.Code, "{{"))
+			if raw {
+				out = append(out, b.Indent+"{% raw %}")
+			}
+			// The block's lines, closing fence included, are copied as is.
+			out = append(out, plainFence(line))
+			out = append(out, lines[i+1:b.End]...)
+			if raw {
+				out = append(out, b.Indent+"{% endraw %}")
+			}
+			continue
+		}
+		if inCode[i] {
+			continue
+		}
+		line = inlineLinkRe.ReplaceAllStringFunc(line, func(m string) string {
+			return "](" + abs(m[2:])
+		})
+		line = refDefRe.ReplaceAllStringFunc(line, func(m string) string {
+			sm := refDefRe.FindStringSubmatch(m)
+			return sm[1] + abs(sm[2])
+		})
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// plainFence strips the {...} attributes from an opening fence line, since
+// other platforms don't understand Hugo's.
+func plainFence(line string) string {
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		return strings.TrimRight(line[:i], " ")
+	}
+	return line
+}
@@ -0,0 +1,177 @@
+package syndicate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Mastodon posts statuses through the Mastodon API with an access token
+// that has the write:statuses scope.
+type Mastodon struct {
+	HTTP *http.Client
+	// Server is the instance URL, e.g. https://fosstodon.org.
+	Server string
+	Token  string
+}
+
+// MastodonFromEnv configures a Mastodon target from MASTODON_SERVER and
+// MASTODON_TOKEN. It returns nil if either is unset.
+func MastodonFromEnv() *Mastodon {
+	m := &Mastodon{Server: os.Getenv("MASTODON_SERVER"), Token: os.Getenv("MASTODON_TOKEN")}
+	if m.Server == "" || m.Token == "" {
+		return nil
+	}
+	return m
+}
+
+// Name implements Target.
+func (m *Mastodon) Name() string { return "mastodon" }
+
+// Post implements Target. Tags become hashtags. The request carries an
+// Idempotency-Key derived from the post URL, so a retry after a lost
+// response doesn't create a second status.
+func (m *Mastodon) Post(ctx context.Context, a Announcement) (Result, error) {
+	text := a.Text()
+	if tags := hashtags(a.Tags); tags != "" {
+		text += "\n\n" + tags
+	}
+	form := url.Values{
+		"status":     {text},
+		"visibility": {"public"},
+		"language":   {"en"},
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, strings.TrimSuffix(m.Server, "/")+"/api/v1/statuses",
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return Result{}, err
+	}
+	sum := sha256.Sum256([]byte(a.URL))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+m.Token)
+	req.Header.Set("Idempotency-Key", hex.EncodeToString(sum[:16]))
+
+	var status struct {
+		URI string `json:"uri"`
+		URL string `json:"url"`
+	}
+	if err := doJSON(m.HTTP, req, &status); err != nil {
+		return Result{}, err
+	}
+	return Result{URI: status.URI, URL: status.URL, PostedAt: time.Now().UTC()}, nil
+}
+
+// hashtags turns tags into space-separated hashtags, dropping characters
+// hashtags can't hold.
+func hashtags(tags []string) string {
+	var out []string
+	for _, t := range tags {
+		var b strings.Builder
+		for _, r := range t {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+				b.WriteRune(r)
+			}
+		}
+		if b.Len() > 0 {
+			out = append(out, "#"+b.String())
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// PostThread implements Threader. Each part replies to the one before,
+// with its code block attached as an image. The first is public and the
+// replies unlisted, so the thread doesn't fill followers' timelines.
+func (m *Mastodon) PostThread(ctx context.Context, parts []ThreadPart) (Result, error) {
+	var first Result
+	parent := ""
+	for i, part := range parts {
+		form := url.Values{
+			"status":     {part.Text},
+			"visibility": {"public"},
+			"language":   {"en"},
+		}
+		if i > 0 {
+			form.Set("visibility", "unlisted")
+			form.Set("in_reply_to_id", parent)
+		}
+		if part.Code != nil {
+			id, err := m.uploadMedia(ctx, part.Code.PNG, "code.png", part.Code.Alt())
+			if err != nil {
+				return Result{}, err
+			}
+			form.Set("media_ids[]", id)
+		}
+		req, err := http.NewRequestWithContext(
+			ctx, http.MethodPost, strings.TrimSuffix(m.Server, "/")+"/api/v1/statuses",
+			strings.NewReader(form.Encode()),
+		)
+		if err != nil {
+			return Result{}, err
+		}
+		sum := sha256.Sum256([]byte(part.Text))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+m.Token)
+		req.Header.Set("Idempotency-Key", hex.EncodeToString(sum[:16]))
+
+		var status struct {
+			ID  string `json:"id"`
+			URI string `json:"uri"`
+			URL string `json:"url"`
+		}
+		if err := doJSON(m.HTTP, req, &status); err != nil {
+			return Result{}, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		if i == 0 {
+			first = Result{URI: status.URI, URL: status.URL, PostedAt: time.Now().UTC()}
+		}
+		parent = status.ID
+	}
+	return first, nil
+}
+
+// uploadMedia uploads an image with its description and returns its ID
+// for a status's media_ids.
+func (m *Mastodon) uploadMedia(ctx context.Context, data []byte, name, description string) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("description", description); err != nil {
+		return "", err
+	}
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, strings.TrimSuffix(m.Server, "/")+"/api/v2/media", &body,
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+m.Token)
+	var media struct {
+		ID string `json:"id"`
+	}
+	if err := doJSON(m.HTTP, req, &media); err != nil {
+		return "", err
+	}
+	return media.ID, nil
+}
@@ -0,0 +1,108 @@
+// Package syndicate announces posts on social networks and remembers where
+// each announcement ended up, so a post is never announced twice and the
+// replies can be found later.
+package syndicate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultPath is the record of announcements, keyed by post path. Templates
+// can read it as site.Data.syndication.
+const DefaultPath = "data/syndication.json"
+
+// Announcement is what gets posted about an article.
+type Announcement struct {
+	Title   string
+	URL     string
+	Summary string
+	Tags    []string
+}
+
+// Text is the plain announcement: the title followed by the link.
+func (a Announcement) Text() string {
+	return a.Title + "\n\n" + a.URL
+}
+
+// Result locates an announcement on its network.
+type Result struct {
+	// URI is the network's canonical identifier, e.g. an at:// URI, a
+	// Mastodon status URI, or a dev.to article ID.
+	URI string `json:"uri"`
+	// URL is the announcement's web page.
+	URL      string    `json:"url"`
+	PostedAt time.Time `json:"posted_at"`
+	// Hash identifies the article body that was last published, for
+	// targets that republish whole articles.
+	Hash string `json:"hash,omitempty"`
+}
+
+// Target is a network posts can be announced on.
+type Target interface {
+	// Name identifies the target in the store, e.g. "bluesky".
+	Name() string
+	Post(ctx context.Context, a Announcement) (Result, error)
+}
+
+// Store maps post paths (e.g. "/go/foo/") to their announcements by target
+// name.
+type Store map[string]map[string]Result
+
+// Load reads the store at path. A missing file yields an empty store.
+func Load(path string) (Store, error) {
+	s := Store{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("syndicate: parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the store to path.
+func (s Store) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Announced reports whether post was already announced on target.
+func (s Store) Announced(post, target string) bool {
+	_, ok := s[post][target]
+	return ok
+}
+
+// Record stores the announcement of post on target.
+func (s Store) Record(post, target string, r Result) {
+	if s[post] == nil {
+		s[post] = map[string]Result{}
+	}
+	s[post][target] = r
+}
+
+// Truncate shortens s to at most n runes, ending it with an ellipsis if it
+// was cut.
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+	cut := strings.TrimSpace(string(r[:n-1]))
+	return cut + "…"
+}
@@ -0,0 +1,179 @@
+package syndicate
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// ThreadLimits are the characters a post of a thread can hold on each
+// network. Runes are counted, which errs on the short side of Bluesky's
+// graphemes and of Mastodon counting every link as 23.
+var ThreadLimits = map[string]int{
+	"bluesky":  blueskyMaxGraphemes,
+	"mastodon": 500,
+}
+
+// ThreadPart is a post of a thread.
+type ThreadPart struct {
+	// Text ends with the part's number, as in "3/12".
+	Text string
+	// Code is the code block shown under Text as an image, if any.
+	Code *Code
+}
+
+// Code is a code block a thread shows as an image.
+type Code struct {
+	Lang   string
+	Source string
+	// PNG is the rendered block, filled in by the caller before posting.
+	PNG []byte
+}
+
+// Alt is the image's description: the code itself, as far as the
+// networks' limits allow.
+func (c *Code) Alt() string {
+	lang := c.Lang
+	if lang == "" {
+		lang = "Code"
+	}
+	return Truncate(lang+":\n"+strings.TrimRight(c.Source, "\n"), 1000)
+}
+
+// Threader is a target that can post a thread, each part a reply to the
+// one before.
+type Threader interface {
+	Target
+	PostThread(ctx context.Context, parts []ThreadPart) (Result, error)
+}
+
+// ThreadName is the name a thread on target is recorded under in the
+// store, apart from the target's announcement.
+func ThreadName(target string) string { return target + "-thread" }
+
+// codeMark stands in for the i-th code block in the prose.
+const codeMark = "\x00code "
+
+// Thread splits p into a thread of posts of at most limit characters: the
+// title first, then the prose a paragraph at a time, packed into as few
+// posts as fit and split at sentences, or at words when a sentence is too
+// long, and the link to the post last. Each code block goes under the text
+// that leads into it, as an image. Every post is numbered.
+func Thread(p *content.Post, permalink string, limit int) ([]ThreadPart, error) {
+	var blocks []*Code
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	text := doc.Interleaved(func(lang, src string) string {
+		if strings.TrimSpace(src) == "" {
+			return ""
+		}
+		blocks = append(blocks, &Code{Lang: lang, Source: src})
+		return codeMark + strconv.Itoa(len(blocks)-1)
+	})
+	var items []string
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, codeMark) {
+			line = strings.Join(strings.Fields(line), " ")
+		}
+		if line != "" {
+			items = append(items, line)
+		}
+	}
+	items = append([]string{p.Title}, items...)
+	items = append(items, "Read the whole post: "+permalink)
+
+	// Reserve room for the numbers, with more digits when the thread
+	// runs longer than they count.
+	for digits := 1; ; digits++ {
+		room := limit - len("\n\n/") - 2*digits
+		if room < 40 {
+			return nil, fmt.Errorf("syndicate: %d characters is too few for a thread", limit)
+		}
+		parts := pack(items, blocks, room)
+		if len(strconv.Itoa(len(parts))) > digits {
+			continue
+		}
+		for i := range parts {
+			parts[i].Text = strings.TrimSpace(parts[i].Text + fmt.Sprintf("\n\n%d/%d", i+1, len(parts)))
+		}
+		return parts, nil
+	}
+}
+
+// pack fills posts of at most room characters with items, a paragraph or
+// code mark each. A post ends with its code block, since it's shown last.
+func pack(items []string, blocks []*Code, room int) []ThreadPart {
+	var parts []ThreadPart
+	var cur ThreadPart
+	flush := func() {
+		cur.Text = strings.TrimSpace(cur.Text)
+		if cur.Text != "" || cur.Code != nil {
+			parts = append(parts, cur)
+		}
+		cur = ThreadPart{}
+	}
+	add := func(piece, sep string) {
+		if cur.Code != nil || (cur.Text != "" && utf8.RuneCountInString(cur.Text+sep+piece) > room) {
+			flush()
+		}
+		if cur.Text != "" {
+			cur.Text += sep
+		}
+		cur.Text += piece
+	}
+	for i, item := range items {
+		if n, ok := strings.CutPrefix(item, codeMark); ok {
+			j, _ := strconv.Atoi(n)
+			if cur.Code != nil {
+				flush()
+			}
+			cur.Code = blocks[j]
+			continue
+		}
+		// The title and the link stand alone.
+		if i == 0 || i == len(items)-1 {
+			flush()
+			add(Truncate(item, room), "")
+			if i == 0 {
+				flush()
+			}
+			continue
+		}
+		if utf8.RuneCountInString(item) <= room {
+			add(item, "\n\n")
+			continue
+		}
+		sep := "\n\n"
+		for _, s := range splitSentences(item) {
+			if utf8.RuneCountInString(s) <= room {
+				add(s, sep)
+				sep = " "
+				continue
+			}
+			for _, w := range strings.Fields(s) {
+				add(Truncate(w, room), sep)
+				sep = " "
+			}
+		}
+	}
+	flush()
+	return parts
+}
+
+// splitSentences splits a paragraph after each full stop, question mark,
+// or exclamation mark that a space follows.
+func splitSentences(para string) []string {
+	var out []string
+	start := 0
+	for i := 0; i+1 < len(para); i++ {
+		if strings.IndexByte(".?!", para[i]) >= 0 && para[i+1] == ' ' {
+			out = append(out, para[start:i+1])
+			start = i + 2
+		}
+	}
+	return append(out, strings.TrimSpace(para[start:]))
+}
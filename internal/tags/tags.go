@@ -0,0 +1,114 @@
+// Package tags normalizes the posts' tags against a map of canonical tags
+// and their aliases, so "Golang" and "Go" end up as one taxonomy term.
+package tags
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+)
+
+// DefaultAliases is where the alias map lives. Each key is a canonical tag
+// and its value lists the spellings that should become it:
+//
+//	Go = ["Golang", "go-lang"]
+//	"Incident Post-mortem" = ["Postmortem"]
+const DefaultAliases = "data/tag_aliases.toml"
+
+// Aliases maps a tag, lowercased, to its canonical spelling. Every
+// canonical tag maps to itself, so a miscased "python" becomes "Python".
+type Aliases map[string]string
+
+// LoadAliases reads the alias map at path. A missing file is an empty map.
+// A spelling listed under two canonical tags is an error.
+func LoadAliases(path string) (Aliases, error) {
+	a := Aliases{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string][]string
+	if err := toml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("tags: %s: %w", path, err)
+	}
+	canonical := make([]string, 0, len(raw))
+	for c := range raw {
+		canonical = append(canonical, c)
+	}
+	sort.Strings(canonical)
+	for _, c := range canonical {
+		if err := a.add(c, c); err != nil {
+			return nil, fmt.Errorf("tags: %s: %w", path, err)
+		}
+	}
+	for _, c := range canonical {
+		for _, alias := range raw[c] {
+			if err := a.add(alias, c); err != nil {
+				return nil, fmt.Errorf("tags: %s: %w", path, err)
+			}
+		}
+	}
+	return a, nil
+}
+
+func (a Aliases) add(alias, canonical string) error {
+	k := strings.ToLower(strings.TrimSpace(alias))
+	if prev, ok := a[k]; ok && prev != canonical {
+		return fmt.Errorf("%q is listed under both %q and %q", alias, prev, canonical)
+	}
+	a[k] = canonical
+	return nil
+}
+
+// Normalize maps each tag to its canonical spelling and drops the
+// duplicates that leaves, keeping the first occurrence's position. Tags
+// that aren't in the map are only trimmed.
+func (a Aliases) Normalize(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if c, ok := a[strings.ToLower(t)]; ok {
+			t = c
+		}
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// Orphans returns the tags set on only one post, mapped to that post's
+// path.
+func Orphans(posts []*content.Post) map[string]string {
+	count := map[string]int{}
+	last := map[string]string{}
+	for _, p := range posts {
+		seen := map[string]bool{}
+		for _, t := range p.Tags {
+			if !seen[t] {
+				seen[t] = true
+				count[t]++
+				last[t] = p.Path
+			}
+		}
+	}
+	out := map[string]string{}
+	for t, n := range count {
+		if n == 1 {
+			out[t] = last[t]
+		}
+	}
+	return out
+}
@@ -0,0 +1,216 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"time"
+)
+
+// Chrome returns spans in the Chrome trace event format, which
+// ui.perfetto.dev and chrome://tracing open. Stages that run one after
+// another share a track, with each stage's phases nested under it; a stage
+// starting while others run, as `blogctl build` runs them, gets the first
+// track that's free.
+func Chrome(spans []Span) ([]byte, error) {
+	type event struct {
+		Name string         `json:"name"`
+		Cat  string         `json:"cat,omitempty"`
+		Ph   string         `json:"ph"`
+		TS   int64          `json:"ts"`
+		Dur  int64          `json:"dur,omitempty"`
+		PID  int            `json:"pid"`
+		TID  int            `json:"tid"`
+		Args map[string]any `json:"args,omitempty"`
+	}
+	events := []event{
+		{Name: "process_name", Ph: "M", PID: 1, TID: 1, Args: map[string]any{"name": "build"}},
+	}
+	if len(spans) > 0 {
+		origin := spans[0].Start
+		for _, s := range spans {
+			if s.Start.Before(origin) {
+				origin = s.Start
+			}
+		}
+		tracks := tracks(spans)
+		for i, s := range spans {
+			args := map[string]any{"stage": s.Stage, "pid": s.PID}
+			if s.Err != "" {
+				args["error"] = s.Err
+			}
+			events = append(events, event{
+				Name: s.Name,
+				Cat:  s.Stage,
+				Ph:   "X",
+				TS:   s.Start.Sub(origin).Microseconds(),
+				Dur:  max(s.Dur.Microseconds(), 1),
+				PID:  1,
+				TID:  tracks[i],
+				Args: args,
+			})
+		}
+	}
+	b, err := json.MarshalIndent(struct {
+		TraceEvents     []event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}{events, "ms"}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// tracks returns the track of each span, numbered from 1: stages take the
+// first track free when they start, and their phases take the track of the
+// run of the stage they fall within.
+func tracks(spans []Span) []int {
+	type run struct {
+		stage      string
+		start, end time.Time
+		track      int
+	}
+	order := make([]int, len(spans))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return spans[a].Start.Compare(spans[b].Start) })
+
+	out := make([]int, len(spans))
+	var free []time.Time // when each track's last stage ends
+	var runs []run
+	for _, i := range order {
+		s := spans[i]
+		if s.Depth != 0 {
+			continue
+		}
+		t := slices.IndexFunc(free, func(end time.Time) bool { return !end.After(s.Start) })
+		if t < 0 {
+			t = len(free)
+			free = append(free, time.Time{})
+		}
+		free[t] = s.Start.Add(s.Dur)
+		out[i] = t + 1
+		runs = append(runs, run{s.Stage, s.Start, s.Start.Add(s.Dur), t + 1})
+	}
+	for i, s := range spans {
+		if s.Depth == 0 {
+			continue
+		}
+		out[i] = 1
+		for _, r := range runs {
+			if r.stage == s.Stage && !s.Start.Before(r.start) && !s.Start.After(r.end) {
+				out[i] = r.track
+			}
+		}
+	}
+	return out
+}
+
+// Stage is the time a stage took, summed if it ran more than once.
+type Stage struct {
+	Name string
+	Dur  time.Duration
+	// Failed is true if a run of the stage ended in an error.
+	Failed bool
+}
+
+// Stages returns the stages among spans in the order they started.
+func Stages(spans []Span) []Stage {
+	var out []Stage
+	index := map[string]int{}
+	for _, s := range spans {
+		if s.Depth != 0 {
+			continue
+		}
+		i, ok := index[s.Name]
+		if !ok {
+			i = len(out)
+			index[s.Name] = i
+			out = append(out, Stage{Name: s.Name})
+		}
+		out[i].Dur += s.Dur
+		out[i].Failed = out[i].Failed || s.Err != ""
+	}
+	return out
+}
+
+// DefaultBaseline is where CI keeps the last builds' stage times, cached
+// between runs like the performance budget's baseline.
+const DefaultBaseline = ".build-timing-baseline.json"
+
+// DefaultRuns is how many builds a baseline remembers.
+const DefaultRuns = 5
+
+// Baseline is each stage's times over the last few builds, in
+// milliseconds, oldest first.
+type Baseline map[string][]int64
+
+// LoadBaseline reads the baseline at path, empty if there's none yet.
+func LoadBaseline(path string) (Baseline, error) {
+	b := Baseline{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, json.Unmarshal(data, &b)
+}
+
+// Usual is the median of name's remembered times, and false if there are
+// none.
+func (b Baseline) Usual(name string) (time.Duration, bool) {
+	ms := slices.Clone(b[name])
+	if len(ms) == 0 {
+		return 0, false
+	}
+	slices.Sort(ms)
+	return time.Duration(ms[len(ms)/2]) * time.Millisecond, true
+}
+
+// Add remembers the stages that succeeded, keeping the last runs times of
+// each.
+func (b Baseline) Add(stages []Stage, runs int) {
+	for _, s := range stages {
+		if s.Failed {
+			continue
+		}
+		ms := append(b[s.Name], s.Dur.Milliseconds())
+		b[s.Name] = ms[max(len(ms)-runs, 0):]
+	}
+}
+
+// Save writes b to path.
+func (b Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Regression is a stage slower than usual.
+type Regression struct {
+	Stage string
+	Dur   time.Duration
+	Usual time.Duration
+}
+
+// Regressions returns the stages that took more than threshold (0.25 for
+// 25%) longer than they usually do, and at least floor longer, so
+// second-long stages jittering don't count.
+func Regressions(stages []Stage, b Baseline, threshold float64, floor time.Duration) []Regression {
+	var out []Regression
+	for _, s := range stages {
+		usual, ok := b.Usual(s.Name)
+		if !ok {
+			continue
+		}
+		if float64(s.Dur) > float64(usual)*(1+threshold) && s.Dur-usual >= floor {
+			out = append(out, Regression{Stage: s.Name, Dur: s.Dur, Usual: usual})
+		}
+	}
+	return out
+}
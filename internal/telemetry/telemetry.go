@@ -0,0 +1,196 @@
+// Package telemetry times the build. Each stage of it, a blogctl command
+// or a step `blogctl trace run` wraps, and any phase a stage marks inside
+// itself, records a span to the trace file $BLOGCTL_TRACE names, a line of
+// JSON each, so the separate processes of a CI run add up to one trace.
+// `blogctl trace report` turns the file into a Chrome trace that Perfetto
+// opens, and warns about the stages taking longer than they usually do.
+//
+// Without $BLOGCTL_TRACE nothing is recorded and spans cost next to
+// nothing.
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variables the recorder reads. EnvTrace is the trace file;
+// EnvParent and EnvDepth are set by `blogctl trace run` for the command it
+// wraps, so that a blogctl run inside a traced step nests under it.
+const (
+	EnvTrace  = "BLOGCTL_TRACE"
+	EnvParent = "BLOGCTL_TRACE_PARENT"
+	EnvDepth  = "BLOGCTL_TRACE_DEPTH"
+)
+
+// DefaultTrace is where CI points $BLOGCTL_TRACE.
+const DefaultTrace = ".build-trace.jsonl"
+
+// Span is a timed stage or phase of one.
+type Span struct {
+	Name string `json:"name"`
+	// Stage is the stage the span is part of; a stage's is its own name.
+	Stage string        `json:"stage"`
+	Depth int           `json:"depth"`
+	Start time.Time     `json:"start"`
+	Dur   time.Duration `json:"dur"`
+	PID   int           `json:"pid"`
+	Err   string        `json:"error,omitempty"`
+}
+
+// Recorder appends spans to a trace file.
+type Recorder struct {
+	path  string
+	pid   int
+	stage string
+	depth int
+
+	mu sync.Mutex
+}
+
+// FromEnv returns a recorder for the trace file $BLOGCTL_TRACE names, or
+// nil if it's unset.
+func FromEnv() *Recorder {
+	path := os.Getenv(EnvTrace)
+	if path == "" {
+		return nil
+	}
+	depth, _ := strconv.Atoi(os.Getenv(EnvDepth))
+	return &Recorder{path: path, pid: os.Getpid(), stage: os.Getenv(EnvParent), depth: depth}
+}
+
+// Env returns the environment for a command run as part of stage, so its
+// own spans nest under it.
+func (r *Recorder) Env(stage string, depth int) []string {
+	if r == nil {
+		return nil
+	}
+	return []string{
+		EnvTrace + "=" + r.path,
+		EnvParent + "=" + stage,
+		EnvDepth + "=" + strconv.Itoa(depth),
+	}
+}
+
+// Reset empties the trace file, so that the spans recorded from now on are
+// a trace of their own rather than joining the last build's. It leaves
+// the file alone when r records for a stage of another process's trace,
+// and does nothing for a nil r.
+func (r *Recorder) Reset() error {
+	if r == nil || r.depth > 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.Truncate(r.path, 0); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+	return nil
+}
+
+// Each line is written with a single append, which keeps the lines of
+// processes tracing at once from interleaving.
+func (r *Recorder) record(s Span) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("telemetry: %w", err)
+	}
+	return f.Close()
+}
+
+type ctxKey struct{}
+
+type scope struct {
+	rec   *Recorder
+	stage string
+	depth int
+}
+
+// WithRecorder returns ctx recording the spans started from it to r. A
+// nil r records nothing.
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	if r == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKey{}, scope{rec: r, stage: r.stage, depth: r.depth})
+}
+
+// Timer is a span being timed.
+type Timer struct {
+	rec  *Recorder
+	span Span
+}
+
+// Start starts a span named name inside the one ctx carries, or a new
+// stage if it carries none, and returns the context for the spans inside
+// it. End the span with its Timer.
+func Start(ctx context.Context, name string) (context.Context, *Timer) {
+	sc, ok := ctx.Value(ctxKey{}).(scope)
+	if !ok {
+		return ctx, &Timer{}
+	}
+	s := Span{Name: name, Stage: sc.stage, Depth: sc.depth, Start: time.Now(), PID: sc.rec.pid}
+	if s.Stage == "" {
+		s.Stage = name
+	}
+	ctx = context.WithValue(ctx, ctxKey{}, scope{rec: sc.rec, stage: s.Stage, depth: sc.depth + 1})
+	return ctx, &Timer{rec: sc.rec, span: s}
+}
+
+// Stage is the stage t is part of, "" when nothing's recorded.
+func (t *Timer) Stage() string { return t.span.Stage }
+
+// Depth is how deep t is nested.
+func (t *Timer) Depth() int { return t.span.Depth }
+
+// End records the span with err, the error it ended in if any. The error
+// is writing the trace's.
+func (t *Timer) End(err error) error {
+	if t.rec == nil {
+		return nil
+	}
+	t.span.Dur = time.Since(t.span.Start)
+	if err != nil {
+		t.span.Err = err.Error()
+	}
+	return t.rec.record(t.span)
+}
+
+// Load reads the spans in the trace file at path.
+func Load(path string) ([]Span, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var spans []Span
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var s Span
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return nil, fmt.Errorf("telemetry: %s:%d: %w", path, n, err)
+		}
+		spans = append(spans, s)
+	}
+	return spans, sc.Err()
+}
@@ -0,0 +1,163 @@
+// Package toc builds each post's table of contents from its headings, with
+// the anchors Hugo gives them, and checks that every heading in a post has
+// an anchor of its own. The toc partial reads the result as
+// site.Data.toc in place of Hugo's .TableOfContents, whose depth is set
+// once for the whole site.
+//
+// A post picks the heading levels it lists with
+//
+//	toc:
+//	  min: 2
+//	  max: 4
+//
+// Either key can be left out for its default, h2 to h3 like Hugo's.
+package toc
+
+import (
+	"fmt"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// DefaultPath is where templates read the tables of contents from, as
+// site.Data.toc.
+const DefaultPath = "data/toc.json"
+
+// The heading levels listed when a post doesn't say, the same as Hugo's
+// markup.tableOfContents defaults.
+const (
+	DefaultMin = 2
+	DefaultMax = 3
+)
+
+// Depth is the range of heading levels a table of contents lists.
+type Depth struct {
+	Min, Max int
+}
+
+// DepthOf returns the depth p's toc front matter key asks for.
+func DepthOf(p *content.Post) (Depth, error) {
+	d := Depth{DefaultMin, DefaultMax}
+	v, ok := p.Params["toc"]
+	if !ok {
+		return d, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return d, fmt.Errorf("toc must be a mapping with min and max, not %T", v)
+	}
+	for key, n := range map[string]*int{"min": &d.Min, "max": &d.Max} {
+		switch v := m[key].(type) {
+		case nil:
+		case int:
+			*n = v
+		case int64:
+			*n = int(v)
+		default:
+			return d, fmt.Errorf("toc: %s must be a heading level, not %T", key, v)
+		}
+	}
+	if d.Min < 1 || d.Max > 6 || d.Min > d.Max {
+		return d, fmt.Errorf("toc: min %d to max %d isn't a range of heading levels 1 to 6", d.Min, d.Max)
+	}
+	return d, nil
+}
+
+// Entry is a heading in a table of contents, with the ones under it.
+type Entry struct {
+	Text     string   `json:"text"`
+	ID       string   `json:"id"`
+	Children []*Entry `json:"children,omitempty"`
+}
+
+// Build returns the headings within d as a tree: each heading goes under
+// the nearest one before it of a higher level. A heading with none above
+// it is at the top, whatever its level.
+func Build(headings []markdown.Heading, d Depth) []*Entry {
+	type open struct {
+		level int
+		entry *Entry
+	}
+	// Empty rather than nil, so a post listing no headings at all gets no
+	// table of contents rather than Hugo's.
+	top := []*Entry{}
+	var stack []open
+	for _, h := range headings {
+		if h.Level < d.Min || h.Level > d.Max {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		e := &Entry{Text: h.Text, ID: h.ID}
+		if len(stack) == 0 {
+			top = append(top, e)
+		} else {
+			parent := stack[len(stack)-1].entry
+			parent.Children = append(parent.Children, e)
+		}
+		stack = append(stack, open{h.Level, e})
+	}
+	return top
+}
+
+// Problem is a heading whose anchor isn't its own, at a line of a post.
+type Problem struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.Path, p.Line, p.Msg)
+}
+
+// Check reports the headings that share an anchor with an earlier one in
+// the same post: two set with the same {#id}, or two whose text makes the
+// same one. Hugo tells the latter apart with a -1 suffix, but that anchor
+// moves to another heading as soon as one with the same text is added
+// above it, so the link breaks; an explicit {#id} keeps it.
+func Check(path string, headings []markdown.Heading) []Problem {
+	var problems []Problem
+	first := map[string]markdown.Heading{}
+	for _, h := range headings {
+		if prev, ok := first[h.ID]; ok {
+			problems = append(problems, Problem{path, h.Line, fmt.Sprintf("heading %q has the anchor #%s of line %d", h.Text, h.ID, prev.Line)})
+			continue
+		}
+		first[h.ID] = h
+		if h.Suffixed {
+			problems = append(problems, Problem{path, h.Line, fmt.Sprintf("heading %q repeats an earlier one's anchor and got #%s; give it an {#id}", h.Text, h.ID)})
+		}
+	}
+	return problems
+}
+
+// Posts returns the table of contents of each of posts that has one,
+// keyed by content.Post.DataKey, and the problems found on the way, a bad
+// toc key included.
+func Posts(posts []*content.Post) (map[string][]*Entry, []Problem) {
+	out := map[string][]*Entry{}
+	var problems []Problem
+	for _, p := range posts {
+		headings := markdown.Parse([]byte(p.Body), p.BodyLine).Headings()
+		problems = append(problems, Check(p.Path, headings)...)
+		d, err := DepthOf(p)
+		if err != nil {
+			problems = append(problems, Problem{p.Path, 1, err.Error()})
+			d = Depth{DefaultMin, DefaultMax}
+		}
+		if len(headings) > 0 {
+			out[p.DataKey()] = Build(headings, d)
+		}
+	}
+	return out, problems
+}
+
+// Write saves the tables of contents to path if they differ from what's
+// there, and reports whether it wrote.
+func Write(path string, tocs map[string][]*Entry) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, tocs)
+}
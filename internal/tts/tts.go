@@ -0,0 +1,297 @@
+// Package tts reads posts aloud: it turns a post into a script of its
+// prose, with code blocks skipped or summarized, has a text-to-speech
+// backend voice it a chunk at a time, and records the MP3s, stored in R2
+// under names that change with the script, in data/tts.json for the listen
+// partial's player.
+package tts
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+)
+
+// DefaultPath is where the listen partial reads the recordings from, as
+// site.Data.tts.
+const DefaultPath = "data/tts.json"
+
+// Backend is a text-to-speech service.
+type Backend interface {
+	// Name identifies the backend and its voice, so changing either
+	// records the posts again.
+	Name() string
+	// Limit is the most characters Speak takes at once.
+	Limit() int
+	// Speak returns text read aloud, as MP3.
+	Speak(ctx context.Context, text string) ([]byte, error)
+}
+
+// OpenAI speaks through OpenAI's /v1/audio/speech with OPENAI_API_KEY.
+type OpenAI struct {
+	HTTP  *http.Client
+	Key   string
+	Model string
+	Voice string
+}
+
+// Name implements Backend.
+func (o *OpenAI) Name() string { return "openai/" + o.Model + "/" + o.Voice }
+
+// Limit implements Backend.
+func (o *OpenAI) Limit() int { return 4096 }
+
+// Speak implements Backend.
+func (o *OpenAI) Speak(ctx context.Context, text string) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{
+		"model":           o.Model,
+		"voice":           o.Voice,
+		"input":           text,
+		"response_format": "mp3",
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+o.Key)
+	return speak(o.HTTP, req)
+}
+
+// ElevenLabs speaks through ElevenLabs' text-to-speech API with
+// ELEVENLABS_API_KEY. Voice is a voice ID.
+type ElevenLabs struct {
+	HTTP  *http.Client
+	Key   string
+	Model string
+	Voice string
+}
+
+// Name implements Backend.
+func (e *ElevenLabs) Name() string { return "elevenlabs/" + e.Model + "/" + e.Voice }
+
+// Limit implements Backend.
+func (e *ElevenLabs) Limit() int { return 5000 }
+
+// Speak implements Backend.
+func (e *ElevenLabs) Speak(ctx context.Context, text string) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{"text": text, "model_id": e.Model})
+	if err != nil {
+		return nil, err
+	}
+	u := "https://api.elevenlabs.io/v1/text-to-speech/" + e.Voice + "?output_format=mp3_44100_128"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "audio/mpeg")
+	req.Header.Set("xi-api-key", e.Key)
+	return speak(e.HTTP, req)
+}
+
+func speak(c *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tts: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("tts: %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// FromEnv returns the named backend, "openai" or "elevenlabs", with its
+// key from the environment. model and voice default to the backend's own
+// when empty.
+func FromEnv(name, model, voice string) (Backend, error) {
+	c := &http.Client{Timeout: 5 * time.Minute}
+	switch name {
+	case "openai":
+		key := os.Getenv("OPENAI_API_KEY")
+		if key == "" {
+			return nil, errors.New("tts: OPENAI_API_KEY isn't set")
+		}
+		return &OpenAI{HTTP: c, Key: key, Model: cmp.Or(model, "tts-1-hd"), Voice: cmp.Or(voice, "alloy")}, nil
+	case "elevenlabs":
+		key := os.Getenv("ELEVENLABS_API_KEY")
+		if key == "" {
+			return nil, errors.New("tts: ELEVENLABS_API_KEY isn't set")
+		}
+		if voice == "" {
+			return nil, errors.New("tts: ElevenLabs needs a voice ID")
+		}
+		return &ElevenLabs{HTTP: c, Key: key, Model: cmp.Or(model, "eleven_multilingual_v2"), Voice: voice}, nil
+	}
+	return nil, fmt.Errorf("tts: unknown backend %q", name)
+}
+
+// Code says what happens to code blocks in a script.
+type Code string
+
+const (
+	// CodeSkip leaves them out.
+	CodeSkip Code = "skip"
+	// CodeSummarize says there's a code sample, and in what language.
+	CodeSummarize Code = "summarize"
+)
+
+// Script returns what's read aloud for p: its title, then its prose.
+func Script(p *content.Post, code Code) string {
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	text := doc.Spoken(func(lang string, lines int) string {
+		if code != CodeSummarize {
+			return ""
+		}
+		if lang == "" || lang == "text" || lang == "txt" {
+			return fmt.Sprintf("There's a %d-line snippet here; it's in the written post.", lines)
+		}
+		return fmt.Sprintf("There's a %d-line %s sample here; it's in the written post.", lines, lang)
+	})
+	var paras []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		// Headings and list items end without a stop; give the voice a
+		// pause after them.
+		if !strings.ContainsAny(line[len(line)-1:], ".?!:;") {
+			line += "."
+		}
+		paras = append(paras, line)
+	}
+	return strings.Join(append([]string{p.Title + "."}, paras...), "\n\n")
+}
+
+// Hash identifies the recording of script by b, so the post is recorded
+// again when either changes.
+func Hash(script string, b Backend) string {
+	sum := sha256.Sum256([]byte(b.Name() + "\x00" + script))
+	return hex.EncodeToString(sum[:])
+}
+
+// Chunks splits script into pieces of at most limit characters, at
+// paragraphs where it can, then sentences, then words.
+func Chunks(script string, limit int) []string {
+	var out []string
+	var cur strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			out = append(out, s)
+		}
+		cur.Reset()
+	}
+	add := func(piece, sep string) {
+		if cur.Len() > 0 && utf8.RuneCountInString(cur.String())+len(sep)+utf8.RuneCountInString(piece) > limit {
+			flush()
+		}
+		if cur.Len() > 0 {
+			cur.WriteString(sep)
+		}
+		cur.WriteString(piece)
+	}
+	for _, para := range strings.Split(script, "\n\n") {
+		if utf8.RuneCountInString(para) <= limit {
+			add(para, "\n\n")
+			continue
+		}
+		for _, sentence := range sentences(para) {
+			if utf8.RuneCountInString(sentence) <= limit {
+				add(sentence, " ")
+				continue
+			}
+			for _, w := range strings.Fields(sentence) {
+				add(w, " ")
+			}
+		}
+	}
+	flush()
+	return out
+}
+
+// sentences splits a paragraph after each full stop, question mark, or
+// exclamation mark that a space follows.
+func sentences(para string) []string {
+	var out []string
+	start := 0
+	for i := 0; i+1 < len(para); i++ {
+		if strings.IndexByte(".?!", para[i]) >= 0 && para[i+1] == ' ' {
+			out = append(out, para[start:i+1])
+			start = i + 2
+		}
+	}
+	return append(out, strings.TrimSpace(para[start:]))
+}
+
+// Speak reads script aloud with b, chunk by chunk, and joins the MP3s.
+// MP3 frames stand alone, so the pieces play as one file.
+func Speak(ctx context.Context, b Backend, script string) ([]byte, error) {
+	var out []byte
+	for _, chunk := range Chunks(script, b.Limit()) {
+		mp3, err := b.Speak(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, mp3...)
+	}
+	return out, nil
+}
+
+// Recording is a post's audio as the listen partial plays it.
+type Recording struct {
+	// Hash is the script's; see Hash.
+	Hash string `json:"hash"`
+	// Key is the object's in the bucket, and Src its public URL.
+	Key      string `json:"key"`
+	Src      string `json:"src"`
+	Bytes    int    `json:"bytes"`
+	Seconds  int    `json:"seconds"`
+	Duration string `json:"duration"`
+}
+
+// Manifest maps each post's slug to its recording.
+type Manifest map[string]Recording
+
+// Load reads the manifest at path. A missing file yields an empty manifest.
+func Load(path string) (Manifest, error) {
+	m := Manifest{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("tts: parse %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Save writes the manifest to path.
+func (m Manifest) Save(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
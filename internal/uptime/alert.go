@@ -0,0 +1,191 @@
+package uptime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Alert kinds.
+const (
+	AlertDown      = "down"
+	AlertRecovered = "recovered"
+	AlertCert      = "cert"
+)
+
+// Alert is a change worth telling someone about.
+type Alert struct {
+	Kind    string    `json:"kind"`
+	Target  string    `json:"target"`
+	URL     string    `json:"url"`
+	At      time.Time `json:"at"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Ntfy publishes alerts to an ntfy topic, such as https://ntfy.sh/mytopic.
+type Ntfy struct {
+	HTTP *http.Client
+	// URL is the topic's.
+	URL string
+	// Token is an access token for a protected topic, if it is one.
+	Token string
+}
+
+// Notify publishes a, urgent if something went down.
+func (n *Ntfy) Notify(ctx context.Context, a Alert) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewBufferString(a.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", a.Title)
+	req.Header.Set("Click", a.URL)
+	switch a.Kind {
+	case AlertDown:
+		req.Header.Set("Priority", "urgent")
+		req.Header.Set("Tags", "rotating_light")
+	case AlertCert:
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "lock")
+	default:
+		req.Header.Set("Tags", "white_check_mark")
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return send(n.HTTP, req, "ntfy")
+}
+
+// Webhook posts alerts as JSON, Alert's fields plus a "text" line that
+// Slack and Discord-compatible receivers show as is.
+type Webhook struct {
+	HTTP *http.Client
+	URL  string
+}
+
+// Notify posts a.
+func (w *Webhook) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(struct {
+		Alert
+		Text    string `json:"text"`
+		Content string `json:"content"`
+	}{a, a.Title + ": " + a.Message, a.Title + ": " + a.Message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(w.HTTP, req, "webhook")
+}
+
+func send(client *http.Client, req *http.Request, name string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("uptime: %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("uptime: %s: %s: %s", name, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Watch turns checks into alerts. A target is down after Failures checks
+// in a row fail, so one dropped request doesn't page anyone, and it
+// recovers at the first check that succeeds. A certificate expiring within
+// CertWarn is reported once a day per host until it's renewed.
+type Watch struct {
+	Failures int
+	CertWarn time.Duration
+
+	state    map[string]*targetState
+	certSent map[string]time.Time
+}
+
+type targetState struct {
+	failures int
+	down     bool
+	since    time.Time
+}
+
+// Alerts returns the alerts c raises.
+func (w *Watch) Alerts(c Check) []Alert {
+	if w.state == nil {
+		w.state = map[string]*targetState{}
+		w.certSent = map[string]time.Time{}
+	}
+	st, ok := w.state[c.Target]
+	if !ok {
+		st = &targetState{}
+		w.state[c.Target] = st
+	}
+
+	var alerts []Alert
+	if c.OK() {
+		if st.down {
+			alerts = append(alerts, Alert{
+				Kind: AlertRecovered, Target: c.Target, URL: c.URL, At: c.At,
+				Title:   c.Target + " is back up",
+				Message: fmt.Sprintf("%s answered %d after %s down.", c.URL, c.Status, c.At.Sub(st.since).Round(time.Second)),
+			})
+		}
+		st.failures, st.down = 0, false
+	} else {
+		if st.failures == 0 {
+			st.since = c.At
+		}
+		st.failures++
+		if !st.down && st.failures >= max(w.Failures, 1) {
+			st.down = true
+			alerts = append(alerts, Alert{
+				Kind: AlertDown, Target: c.Target, URL: c.URL, At: c.At,
+				Title:   c.Target + " is down",
+				Message: fmt.Sprintf("%s failed %d check(s) in a row: %s", c.URL, st.failures, c.Err),
+			})
+		}
+	}
+
+	host := c.URL
+	if u, err := url.Parse(c.URL); err == nil {
+		host = u.Host
+	}
+	if !c.CertExpiry.IsZero() && c.CertExpiry.Sub(c.At) < w.CertWarn && c.At.Sub(w.certSent[host]) >= 24*time.Hour {
+		w.certSent[host] = c.At
+		left := c.CertExpiry.Sub(c.At)
+		msg := fmt.Sprintf("The certificate of %s expires in %d day(s), on %s.", host, int(left.Hours()/24), c.CertExpiry.Format(time.DateOnly))
+		if left <= 0 {
+			msg = fmt.Sprintf("The certificate of %s expired on %s.", host, c.CertExpiry.Format(time.DateOnly))
+		}
+		alerts = append(alerts, Alert{
+			Kind: AlertCert, Target: c.Target, URL: c.URL, At: c.At,
+			Title:   "The certificate of " + host + " is expiring",
+			Message: msg,
+		})
+	}
+	return alerts
+}
+
+// Prime feeds past checks, oldest first, through w without alerting, so a
+// restart doesn't repeat the alerts already sent.
+func (w *Watch) Prime(checks []Check) {
+	for _, c := range checks {
+		w.Alerts(c)
+	}
+}
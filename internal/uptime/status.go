@@ -0,0 +1,194 @@
+package uptime
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Days is how far back the status page looks.
+const Days = 30
+
+// MaxIncidents is how many incidents the status page lists.
+const MaxIncidents = 20
+
+// Page is what the status page shows.
+type Page struct {
+	Title     string
+	Home      string
+	Generated time.Time
+	// Up is true when every target's last check succeeded.
+	Up        bool
+	Targets   []Status
+	Incidents []Incident
+}
+
+// Status is a target's recent record.
+type Status struct {
+	Target
+	// Last is the latest check, zero if there's none yet.
+	Last Check
+	// Day and Month are the percentages of checks that succeeded over the
+	// last day and the last Days days, or -1 without any checks.
+	Day   float64
+	Month float64
+	// Latency is the median over the last day.
+	Latency time.Duration
+	// CertDays is how many days the certificate has left, for a target
+	// served over TLS.
+	CertDays int
+	// Bars are the last Days days, oldest first.
+	Bars []Bar
+}
+
+// Bar is a day in a target's record.
+type Bar struct {
+	Date  time.Time
+	Up    int
+	Total int
+}
+
+// Class names the bar's colour on the page.
+func (b Bar) Class() string {
+	switch {
+	case b.Total == 0:
+		return "none"
+	case b.Up == b.Total:
+		return "up"
+	case b.Up == 0:
+		return "down"
+	}
+	return "partial"
+}
+
+// Incident is a run of failed checks of a target.
+type Incident struct {
+	Target string
+	Start  time.Time
+	// End is when the target answered again, zero while it's still down.
+	End time.Time
+	Err string
+}
+
+// Duration is how long the incident lasted, or has so far.
+func (i Incident) Duration(now time.Time) time.Duration {
+	end := i.End
+	if end.IsZero() {
+		end = now
+	}
+	return end.Sub(i.Start).Round(time.Second)
+}
+
+// BuildPage summarizes checks, oldest first, of targets up to now.
+func BuildPage(title, home string, targets []Target, checks []Check, now time.Time) Page {
+	now = now.UTC()
+	p := Page{Title: title, Home: home, Generated: now, Up: true}
+	today := now.Truncate(24 * time.Hour)
+	byTarget := map[string][]Check{}
+	for _, c := range checks {
+		byTarget[c.Target] = append(byTarget[c.Target], c)
+	}
+
+	for _, t := range targets {
+		s := Status{Target: t, Day: -1, Month: -1, Bars: make([]Bar, Days)}
+		for i := range s.Bars {
+			s.Bars[i].Date = today.AddDate(0, 0, i-Days+1)
+		}
+		var day, month, dayUp, monthUp int
+		var latencies []time.Duration
+		var open *Incident
+		for _, c := range byTarget[t.Name] {
+			s.Last = c
+			month++
+			if i := Days - 1 - int(today.Sub(c.At.Truncate(24*time.Hour)).Hours()/24); i >= 0 && i < Days {
+				s.Bars[i].Total++
+				if c.OK() {
+					s.Bars[i].Up++
+				}
+			}
+			if now.Sub(c.At) <= 24*time.Hour {
+				day++
+				latencies = append(latencies, c.Latency)
+				if c.OK() {
+					dayUp++
+				}
+			}
+			switch {
+			case c.OK():
+				monthUp++
+				if open != nil {
+					open.End = c.At
+					p.Incidents = append(p.Incidents, *open)
+					open = nil
+				}
+			case open == nil:
+				open = &Incident{Target: t.Name, Start: c.At, Err: c.Err}
+			}
+		}
+		if open != nil {
+			p.Incidents = append(p.Incidents, *open)
+		}
+		if month > 0 {
+			s.Month = 100 * float64(monthUp) / float64(month)
+		}
+		if day > 0 {
+			s.Day = 100 * float64(dayUp) / float64(day)
+			slices.Sort(latencies)
+			s.Latency = latencies[len(latencies)/2]
+		}
+		if !s.Last.CertExpiry.IsZero() {
+			s.CertDays = int(s.Last.CertExpiry.Sub(now).Hours() / 24)
+		}
+		if s.Last.At.IsZero() || !s.Last.OK() {
+			p.Up = false
+		}
+		p.Targets = append(p.Targets, s)
+	}
+
+	slices.SortStableFunc(p.Incidents, func(a, b Incident) int { return b.Start.Compare(a.Start) })
+	p.Incidents = p.Incidents[:min(len(p.Incidents), MaxIncidents)]
+	return p
+}
+
+//go:embed status.html
+var statusHTML string
+
+var statusTemplate = template.Must(template.New("status").Parse(statusHTML))
+
+// Render returns p as an HTML page.
+func Render(p Page) ([]byte, error) {
+	var b bytes.Buffer
+	if err := statusTemplate.Execute(&b, p); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WritePage writes an HTML page to path, through a temporary file, so a
+// web server reading it never serves half of one.
+func WritePage(path string, html []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".status-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(html); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
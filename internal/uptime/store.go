@@ -0,0 +1,96 @@
+package uptime
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// DefaultDB is the SQLite database cmd/uptimed records checks in.
+const DefaultDB = "uptime.db"
+
+// Store persists checks in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS checks (
+	target      TEXT NOT NULL,
+	url         TEXT NOT NULL,
+	at          INTEGER NOT NULL,
+	status      INTEGER NOT NULL,
+	latency_ms  INTEGER NOT NULL,
+	error       TEXT NOT NULL DEFAULT '',
+	cert_expiry INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS checks_at ON checks (at);
+`
+
+// OpenStore opens (or creates) the database at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("uptime: init %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error { return s.db.Close() }
+
+// Record adds c.
+func (s *Store) Record(ctx context.Context, c Check) error {
+	var expiry int64
+	if !c.CertExpiry.IsZero() {
+		expiry = c.CertExpiry.Unix()
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO checks (target, url, at, status, latency_ms, error, cert_expiry)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		c.Target, c.URL, c.At.Unix(), c.Status, c.Latency.Milliseconds(), c.Err, expiry)
+	return err
+}
+
+// Since returns the checks made at or after t, oldest first.
+func (s *Store) Since(ctx context.Context, t time.Time) ([]Check, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT target, url, at, status, latency_ms, error, cert_expiry
+		FROM checks WHERE at >= ? ORDER BY at, rowid`, t.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Check
+	for rows.Next() {
+		var c Check
+		var at, latency, expiry int64
+		if err := rows.Scan(&c.Target, &c.URL, &at, &c.Status, &latency, &c.Err, &expiry); err != nil {
+			return nil, err
+		}
+		c.At = time.Unix(at, 0).UTC()
+		c.Latency = time.Duration(latency) * time.Millisecond
+		if expiry != 0 {
+			c.CertExpiry = time.Unix(expiry, 0).UTC()
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Prune deletes the checks made before t and returns how many it deleted.
+func (s *Store) Prune(ctx context.Context, t time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM checks WHERE at < ?`, t.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,123 @@
+// Package uptime watches the site and the services around it. Each probe
+// fetches a URL and notes its status, latency, and TLS certificate expiry;
+// the checks are kept in SQLite, turned into alerts when a target goes down,
+// comes back, or its certificate nears expiry, and rendered as a static
+// status page.
+package uptime
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// Target is a URL to probe.
+type Target struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Targets returns the site's pages and feeds worth watching, and the
+// /healthz of each service config.yml says is deployed.
+func Targets(cfg *site.Config) []Target {
+	ts := []Target{
+		{Name: "Home page", URL: cfg.Permalink("/")},
+		{Name: "RSS feed", URL: cfg.Permalink("/index.xml")},
+		{Name: "JSON Feed", URL: cfg.Permalink("/feed.json")},
+		{Name: "Search index", URL: cfg.Permalink("/search/index.json")},
+		{Name: "Sitemap", URL: cfg.Permalink("/sitemap.xml")},
+	}
+	for _, svc := range []struct{ name, base string }{
+		{"Webmention receiver", strings.TrimSuffix(strings.TrimSuffix(cfg.Params.Webmention, "/"), "/webmention")},
+		{"View counter", cfg.Params.ViewCount},
+		{"Kudos", cfg.Params.Kudos},
+		{"CSP reports", cfg.Params.CSPReport},
+	} {
+		if svc.base != "" {
+			ts = append(ts, Target{Name: svc.name, URL: strings.TrimSuffix(svc.base, "/") + "/healthz"})
+		}
+	}
+	return ts
+}
+
+// ParseTargets reads comma-separated name=url pairs, as given to
+// cmd/uptimed's -extra.
+func ParseTargets(s string) ([]Target, error) {
+	var ts []Target
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, u, ok := strings.Cut(pair, "=")
+		if !ok || name == "" || !strings.HasPrefix(u, "http") {
+			return nil, fmt.Errorf("uptime: %q isn't name=url", pair)
+		}
+		ts = append(ts, Target{Name: strings.TrimSpace(name), URL: strings.TrimSpace(u)})
+	}
+	return ts, nil
+}
+
+// Check is the outcome of one probe.
+type Check struct {
+	Target  string        `json:"target"`
+	URL     string        `json:"url"`
+	At      time.Time     `json:"at"`
+	Status  int           `json:"status,omitempty"`
+	Latency time.Duration `json:"latency"`
+	// Err says why the probe failed, and is empty if it didn't.
+	Err string `json:"error,omitempty"`
+	// CertExpiry is when the served certificate expires, zero over plain
+	// HTTP or when the connection failed before the handshake.
+	CertExpiry time.Time `json:"cert_expiry,omitzero"`
+}
+
+// OK reports whether the probe succeeded.
+func (c Check) OK() bool { return c.Err == "" }
+
+// Probe fetches t's URL. Anything but a 2xx or 3xx response, a timeout, or
+// a certificate that doesn't verify is a failure; an expired certificate's
+// expiry is still recorded.
+func Probe(ctx context.Context, client *http.Client, t Target, now time.Time) Check {
+	c := Check{Target: t.Name, URL: t.URL, At: now.UTC()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		c.Err = err.Error()
+		return c
+	}
+	req.Header.Set("User-Agent", "rednafi.com uptimed")
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		c.Latency = time.Since(start)
+		var cve *tls.CertificateVerificationError
+		if errors.As(err, &cve) && len(cve.UnverifiedCertificates) > 0 {
+			c.CertExpiry = cve.UnverifiedCertificates[0].NotAfter.UTC()
+		}
+		c.Err = err.Error()
+		return c
+	}
+	defer resp.Body.Close()
+	// The whole body counts toward the latency, as a reader would wait
+	// for it.
+	_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, 8<<20))
+	c.Latency = time.Since(start)
+	c.Status = resp.StatusCode
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		c.CertExpiry = resp.TLS.PeerCertificates[0].NotAfter.UTC()
+	}
+	switch {
+	case resp.StatusCode >= 400:
+		c.Err = resp.Status
+	case err != nil:
+		c.Err = err.Error()
+	}
+	return c
+}
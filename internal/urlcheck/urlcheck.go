@@ -0,0 +1,299 @@
+// Package urlcheck keeps the site's URLs in one form: every page's
+// canonical link is the URL it's served at, the posts link to the site's
+// own pages by path rather than by https://rednafi.com, and the links
+// end in the trailing slash Hugo serves the pages with instead of
+// leaning on a redirect.
+package urlcheck
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/rednafi/rednafi.com/internal/content"
+	"github.com/rednafi/rednafi.com/internal/markdown"
+	"github.com/rednafi/rednafi.com/internal/redirects"
+)
+
+// Rules reported in Problem.Rule.
+const (
+	RuleCanonical = "canonical"
+	RuleAbsolute  = "absolute"
+	RuleRedirect  = "redirect"
+	RuleSlash     = "trailing-slash"
+)
+
+// Rules lists every rule, in the order they're described.
+var Rules = []string{RuleCanonical, RuleAbsolute, RuleRedirect, RuleSlash}
+
+// Problem is a URL at a line of a file that isn't in the site's form.
+type Problem struct {
+	Path string
+	Line int
+	Rule string
+	Msg  string
+	// Dest is the URL as written and Fix what it should be.
+	Dest, Fix string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", p.Path, p.Line, p.Rule, p.Msg)
+}
+
+// Site knows the URLs the site serves pages at.
+type Site struct {
+	// Host is the site's host, from baseURL.
+	Host string
+	// moved maps an old or differently spelled path, by key, to the path
+	// the page is served at now.
+	moved map[string]string
+}
+
+// NewSite indexes the pages of posts, the aliases in their front matter,
+// and the local redirects in rs, for a site served at baseURL.
+func NewSite(baseURL string, posts []*content.Post, rs []redirects.Redirect) (*Site, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("urlcheck: baseURL %q isn't an absolute URL", baseURL)
+	}
+	s := &Site{Host: u.Host, moved: map[string]string{}}
+	for _, r := range rs {
+		if r.Local() {
+			s.moved[key(r.From)] = slash(r.To)
+		}
+	}
+	for _, p := range posts {
+		if list, ok := p.Params["aliases"].([]any); ok {
+			for _, a := range list {
+				if a, ok := a.(string); ok {
+					s.moved[key(a)] = slash(p.RelPermalink())
+				}
+			}
+		}
+	}
+	// A page's own path wins over a redirect from it.
+	for _, p := range posts {
+		s.moved[key(p.RelPermalink())] = slash(p.RelPermalink())
+	}
+	return s, nil
+}
+
+// slash adds the trailing slash to p when it names a page rather than a
+// file.
+func slash(p string) string {
+	u, err := url.Parse(p)
+	if err != nil || u.Path == "" || strings.HasSuffix(u.Path, "/") || path.Ext(u.Path) != "" {
+		return p
+	}
+	u.Path += "/"
+	return u.String()
+}
+
+// key is how paths are compared: lowercase, as Hugo serves them, and
+// without the trailing slash.
+func key(p string) string {
+	return strings.TrimSuffix(strings.ToLower(p), "/")
+}
+
+// Path returns the path p is served at: where an alias or redirect sends
+// it, or p with the trailing slash when it names a page.
+func (s *Site) Path(p string) string {
+	if to, ok := s.moved[key(p)]; ok {
+		return to
+	}
+	return slash(p)
+}
+
+func (s *Site) isHost(h string) bool {
+	h = strings.ToLower(h)
+	return h == s.Host || h == "www."+s.Host
+}
+
+// Links checks the links in p's body and the url in its front matter; src
+// is p's file. Links to the site's own pages by absolute URL become
+// paths, paths that redirect become the path they redirect to, and page
+// paths get their trailing slash.
+func (s *Site) Links(p *content.Post, src []byte) []Problem {
+	var problems []Problem
+	if p.URL != "" && strings.HasPrefix(p.URL, "/") {
+		if want := s.Path(p.URL); want != p.URL && want == p.URL+"/" {
+			problems = append(problems, Problem{
+				Path: p.Path, Line: frontMatterLine(src, p.BodyLine, "url"), Rule: RuleSlash,
+				Msg:  fmt.Sprintf("url %q leaves off the trailing slash", p.URL),
+				Dest: p.URL, Fix: want,
+			})
+		}
+	}
+
+	doc := markdown.Parse([]byte(p.Body), p.BodyLine)
+	for _, l := range doc.Links() {
+		// A bare URL in the prose names the site rather than linking to a
+		// page, and a path there wouldn't be a link anymore.
+		if l.Text == l.Dest {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(l.Dest))
+		if err != nil {
+			continue
+		}
+		pr := Problem{Path: p.Path, Line: l.Line, Dest: l.Dest}
+		switch {
+		case u.Host != "" && s.isHost(u.Host) && (u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https"):
+			rel := *u
+			rel.Scheme, rel.Host, rel.User = "", "", nil
+			rel.Path = s.Path(orRoot(rel.Path))
+			pr.Rule = RuleAbsolute
+			pr.Msg = fmt.Sprintf("%q hardcodes the site's host; link to %s", l.Dest, rel.String())
+			pr.Fix = rel.String()
+		case u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"):
+			want := s.Path(u.Path)
+			if want == u.Path {
+				continue
+			}
+			fixed := *u
+			fixed.Path = want
+			pr.Fix = fixed.String()
+			if want == u.Path+"/" {
+				pr.Rule = RuleSlash
+				pr.Msg = fmt.Sprintf("%q leaves off the trailing slash", l.Dest)
+			} else {
+				pr.Rule = RuleRedirect
+				pr.Msg = fmt.Sprintf("%q redirects to %s", l.Dest, want)
+			}
+		default:
+			continue
+		}
+		problems = append(problems, pr)
+	}
+	return problems
+}
+
+// orRoot is p, or the home page when p is empty.
+func orRoot(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+// frontMatterLine returns the line of key in the front matter of src,
+// which ends before bodyLine, or 1.
+func frontMatterLine(src []byte, bodyLine int, key string) int {
+	lines := strings.Split(string(src), "\n")
+	for i, l := range lines[:min(len(lines), bodyLine)] {
+		if strings.HasPrefix(l, key+":") || strings.HasPrefix(l, key+" =") || strings.HasPrefix(l, key+"=") {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// Fix rewrites the links in body, which starts at line bodyLine of its
+// file, as problems say, and returns it with the number of links fixed.
+// A link is looked for on its line and the rest of its paragraph, then
+// among the reference definitions.
+func Fix(body string, bodyLine int, problems []Problem) (string, int) {
+	lines := strings.Split(body, "\n")
+	var n int
+	// done holds the definitions already rewritten, which every use of
+	// the reference shares.
+	done := map[[2]string]bool{}
+	for _, p := range problems {
+		if p.Line < bodyLine {
+			continue
+		}
+		fixed := false
+		for i := p.Line - bodyLine; i < len(lines) && strings.TrimSpace(lines[i]) != "" && !fixed; i++ {
+			lines[i], fixed = replaceLink(lines[i], p.Dest, p.Fix)
+		}
+		for i := 0; i < len(lines) && !fixed; i++ {
+			if isDefinition(lines[i]) {
+				if lines[i], fixed = replaceLink(lines[i], p.Dest, p.Fix); fixed {
+					done[[2]string{p.Dest, p.Fix}] = true
+				}
+			}
+		}
+		if fixed || done[[2]string{p.Dest, p.Fix}] {
+			n++
+		}
+	}
+	return strings.Join(lines, "\n"), n
+}
+
+// isDefinition reports whether line is a link reference definition, as
+// in "[name]: https://...".
+func isDefinition(line string) bool {
+	l := strings.TrimSpace(line)
+	return strings.HasPrefix(l, "[") && strings.Contains(l, "]:")
+}
+
+// replaceLink replaces the first dest in line that stands as a whole URL,
+// not part of a longer one.
+func replaceLink(line, dest, fix string) (string, bool) {
+	for from := 0; ; {
+		i := strings.Index(line[from:], dest)
+		if i < 0 {
+			return line, false
+		}
+		i += from
+		end := i + len(dest)
+		before := i == 0 || strings.IndexByte("(< \t\"'", line[i-1]) >= 0
+		after := end == len(line) || strings.IndexByte(") \t\"'>]", line[end]) >= 0
+		if before && after {
+			return line[:i] + fix + line[end:], true
+		}
+		from = i + 1
+	}
+}
+
+// Canonical checks the canonical link of a built page against want, the
+// URL it should name, and returns the problems found in file.
+func Canonical(r io.Reader, file, want string) ([]Problem, error) {
+	z := html.NewTokenizer(r)
+	line := 1
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return []Problem{{Path: file, Line: 1, Rule: RuleCanonical, Msg: "no <link rel=canonical>"}}, nil
+			}
+			return nil, z.Err()
+		}
+		start := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		t := z.Token()
+		if t.Data == "body" {
+			return []Problem{{Path: file, Line: start, Rule: RuleCanonical, Msg: "no <link rel=canonical> in the head"}}, nil
+		}
+		if t.Data != "link" || !slices.Contains(strings.Fields(attr(t, "rel")), "canonical") {
+			continue
+		}
+		got := strings.TrimSpace(attr(t, "href"))
+		switch {
+		case got == want:
+			return nil, nil
+		case got+"/" == want:
+			return []Problem{{Path: file, Line: start, Rule: RuleCanonical, Msg: fmt.Sprintf("%q leaves off the trailing slash of %s", got, want)}}, nil
+		default:
+			return []Problem{{Path: file, Line: start, Rule: RuleCanonical, Msg: fmt.Sprintf("%q isn't the URL the page is served at, %s", got, want)}}, nil
+		}
+	}
+}
+
+func attr(t html.Token, name string) string {
+	for _, a := range t.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultPath is where the counts are baked for templates to read as
+// site.Data.views, so pages show them without JavaScript.
+const DefaultPath = "data/views.json"
+
+// Fetch reads every slug's views from the viewcountd at base.
+func Fetch(ctx context.Context, client *http.Client, base string) (map[string]int, error) {
+	u := strings.TrimSuffix(base, "/") + "/counts"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("views: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("views: GET %s: %s", u, resp.Status)
+	}
+	var counts map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&counts); err != nil {
+		return nil, fmt.Errorf("views: GET %s: %w", u, err)
+	}
+	return counts, nil
+}
+
+// Load reads the counts written by Write. A missing file yields an empty
+// map.
+func Load(path string) (map[string]int, error) {
+	counts := map[string]int{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return counts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &counts); err != nil {
+		return nil, fmt.Errorf("views: parse %s: %w", path, err)
+	}
+	return counts, nil
+}
+
+// Write encodes the counts to path, leaving the file alone if it's
+// unchanged. It reports whether it wrote.
+func Write(path string, counts map[string]int) (bool, error) {
+	return fsutil.WriteJSONIfChanged(path, counts)
+}
@@ -0,0 +1,117 @@
+// Package views counts page views without cookies or stored IP addresses.
+//
+// A visitor is identified by a hash of their IP address and user agent
+// with a salt that lives only in memory and changes every day, so a hit is
+// counted once per visitor, post, and day, and the hashes can't be tied
+// back to an address or linked across days.
+package views
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Store persists view counts in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS counts (
+	slug  TEXT PRIMARY KEY,
+	views INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS seen (
+	day     TEXT NOT NULL,
+	visitor TEXT NOT NULL,
+	slug    TEXT NOT NULL,
+	PRIMARY KEY (day, visitor, slug)
+);
+`
+
+// OpenStore opens (or creates) the database at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("views: init %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error { return s.db.Close() }
+
+// Hit counts a view of slug by visitor, a hash from Hasher, unless the
+// visitor already viewed it on now's day. It returns the slug's count.
+func (s *Store) Hit(ctx context.Context, slug, visitor string, now time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`INSERT OR IGNORE INTO seen (day, visitor, slug) VALUES (?, ?, ?)`,
+		now.UTC().Format(time.DateOnly), visitor, slug)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO counts (slug, views) VALUES (?, 1)
+			ON CONFLICT (slug) DO UPDATE SET views = views + 1`, slug); err != nil {
+			return 0, err
+		}
+	}
+	var views int
+	if err := tx.QueryRowContext(ctx, `SELECT views FROM counts WHERE slug = ?`, slug).Scan(&views); err != nil {
+		return 0, err
+	}
+	return views, tx.Commit()
+}
+
+// Count returns the views of slug, 0 if it has none.
+func (s *Store) Count(ctx context.Context, slug string) (int, error) {
+	var views int
+	err := s.db.QueryRowContext(ctx, `SELECT views FROM counts WHERE slug = ?`, slug).Scan(&views)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return views, err
+}
+
+// All returns the views of every slug that has any.
+func (s *Store) All(ctx context.Context) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT slug, views FROM counts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var (
+			slug  string
+			views int
+		)
+		if err := rows.Scan(&slug, &views); err != nil {
+			return nil, err
+		}
+		out[slug] = views
+	}
+	return out, rows.Err()
+}
+
+// Forget drops the visitor hashes of the days before now's. Their salt is
+// gone, so they can't match a new hit anyway.
+func (s *Store) Forget(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM seen WHERE day < ?`, now.UTC().Format(time.DateOnly))
+	return err
+}
@@ -0,0 +1,38 @@
+package views
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Hasher turns a visitor's IP address and user agent into an opaque ID
+// that is stable for a UTC day. Its salt is random, never stored, and
+// replaced when the day changes; a restart also replaces it, which at
+// worst counts a visitor twice that day.
+type Hasher struct {
+	mu   sync.Mutex
+	day  string
+	salt [32]byte
+}
+
+// Visitor returns the ID of the visitor with ip and userAgent at now.
+func (h *Hasher) Visitor(ip, userAgent string, now time.Time) string {
+	day := now.UTC().Format(time.DateOnly)
+	h.mu.Lock()
+	if h.day != day {
+		h.day = day
+		_, _ = rand.Read(h.salt[:])
+	}
+	salt := h.salt
+	h.mu.Unlock()
+
+	sum := sha256.New()
+	sum.Write(salt[:])
+	sum.Write([]byte(ip))
+	sum.Write([]byte{0})
+	sum.Write([]byte(userAgent))
+	return hex.EncodeToString(sum.Sum(nil)[:16])
+}
@@ -0,0 +1,175 @@
+// Package webhook verifies and reads the webhooks cmd/hookd rebuilds the
+// site on: GitHub pushes, Buttondown subscriber events, and IFTTT applets.
+// GitHub and Buttondown sign the body with HMAC-SHA256 and a secret shared
+// with them; IFTTT can't sign, so its applets send the secret as a token
+// header instead.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrSignature is returned for a webhook whose signature or token doesn't
+// match the secret.
+var ErrSignature = errors.New("webhook: bad signature")
+
+// Event is what a verified webhook is about.
+type Event struct {
+	// Source is the sender's name, like "github".
+	Source string
+	// Name is the event, like "push" or "subscriber.confirmed".
+	Name string
+	// Delivery is the sender's ID for the webhook, if it gives one.
+	Delivery string
+	// Ref is the pushed ref, for GitHub pushes.
+	Ref string
+}
+
+// Source is a sender of webhooks.
+type Source struct {
+	Name string
+	// SecretEnv is the environment variable holding the shared secret.
+	SecretEnv string
+	verify    func(h http.Header, body, secret []byte) error
+	parse     func(h http.Header, body []byte) (Event, error)
+}
+
+// Sources are the senders hookd accepts, by name.
+var Sources = map[string]Source{
+	"github": {
+		Name:      "github",
+		SecretEnv: "HOOKD_GITHUB_SECRET",
+		verify: func(h http.Header, body, secret []byte) error {
+			return VerifyHMAC(secret, body, strings.TrimPrefix(h.Get("X-Hub-Signature-256"), "sha256="))
+		},
+		parse: func(h http.Header, body []byte) (Event, error) {
+			e := Event{Name: h.Get("X-GitHub-Event"), Delivery: h.Get("X-GitHub-Delivery")}
+			if e.Name == "push" {
+				var p struct {
+					Ref string `json:"ref"`
+				}
+				if err := json.Unmarshal(body, &p); err != nil {
+					return e, fmt.Errorf("webhook: github push: %w", err)
+				}
+				e.Ref = p.Ref
+			}
+			return e, nil
+		},
+	},
+	"buttondown": {
+		Name:      "buttondown",
+		SecretEnv: "HOOKD_BUTTONDOWN_SECRET",
+		verify: func(h http.Header, body, secret []byte) error {
+			return VerifyHMAC(secret, body, strings.TrimPrefix(h.Get("X-Buttondown-Signature"), "sha256="))
+		},
+		parse: func(h http.Header, body []byte) (Event, error) {
+			var p struct {
+				EventType string `json:"event_type"`
+				ID        string `json:"id"`
+			}
+			if err := json.Unmarshal(body, &p); err != nil {
+				return Event{}, fmt.Errorf("webhook: buttondown: %w", err)
+			}
+			return Event{Name: p.EventType, Delivery: p.ID}, nil
+		},
+	},
+	"ifttt": {
+		Name:      "ifttt",
+		SecretEnv: "HOOKD_IFTTT_TOKEN",
+		verify: func(h http.Header, _, secret []byte) error {
+			if subtle.ConstantTimeCompare([]byte(h.Get("X-Hookd-Token")), secret) != 1 {
+				return ErrSignature
+			}
+			return nil
+		},
+		parse: func(_ http.Header, body []byte) (Event, error) {
+			var p struct {
+				Event string `json:"event"`
+			}
+			if err := json.Unmarshal(body, &p); err != nil {
+				return Event{}, fmt.Errorf("webhook: ifttt: %w", err)
+			}
+			return Event{Name: p.Event}, nil
+		},
+	},
+}
+
+// Read verifies a webhook's body against secret and returns its event.
+// An empty secret fails every webhook, so a sender without one configured
+// can't trigger anything.
+func (s Source) Read(h http.Header, body []byte, secret string) (Event, error) {
+	if secret == "" {
+		return Event{Source: s.Name}, ErrSignature
+	}
+	if err := s.verify(h, body, []byte(secret)); err != nil {
+		return Event{Source: s.Name}, err
+	}
+	e, err := s.parse(h, body)
+	e.Source = s.Name
+	if err == nil && e.Name == "" {
+		err = fmt.Errorf("webhook: %s: no event name", s.Name)
+	}
+	return e, err
+}
+
+// VerifyHMAC returns ErrSignature unless sig is the hex HMAC-SHA256 of
+// body under secret, comparing in constant time.
+func VerifyHMAC(secret, body []byte, sig string) error {
+	got, err := hex.DecodeString(sig)
+	if err != nil || len(got) != sha256.Size {
+		return ErrSignature
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// Allowlist is the events that trigger a rebuild, as "source:event".
+type Allowlist map[string]bool
+
+// ParseAllowlist reads a comma-separated list like
+// "github:push,ifttt:rebuild". Sources must be known ones.
+func ParseAllowlist(s string) (Allowlist, error) {
+	a := Allowlist{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		src, name, ok := strings.Cut(item, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("webhook: %q isn't source:event", item)
+		}
+		if _, known := Sources[src]; !known {
+			return nil, fmt.Errorf("webhook: unknown source %q in %q", src, item)
+		}
+		a[item] = true
+	}
+	return a, nil
+}
+
+// Allows reports whether e triggers a rebuild.
+func (a Allowlist) Allows(e Event) bool {
+	return a[e.Source+":"+e.Name]
+}
+
+func (a Allowlist) String() string {
+	items := make([]string, 0, len(a))
+	for item := range a {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,45 @@
+package webmention
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+)
+
+// DefaultExportDir is where `blogctl comments export` snapshots the
+// approved mentions, one file per post slug, which templates read as
+// site.Data.webmentions.
+const DefaultExportDir = "data/webmentions"
+
+// WriteExport stores ms as dir/<slug>.json, leaving the file alone if it's
+// unchanged. It reports whether the file was written.
+func WriteExport(dir, slug string, ms []Mention) (bool, error) {
+	return fsutil.WriteJSONIfChanged(filepath.Join(dir, slug+".json"), ms)
+}
+
+// PruneExport removes the files in dir of slugs not in keep, the posts
+// left with no approved mentions. It returns the paths it removed.
+func PruneExport(dir string, keep map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, e := range entries {
+		slug, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok || keep[slug] {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,188 @@
+package webmention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/rednafi/rednafi.com/internal/publicnet"
+)
+
+var (
+	// ErrNoLink means the source page doesn't link to the target.
+	ErrNoLink = errors.New("webmention: source does not link to target")
+	// ErrGone means the source page was deleted (410 Gone).
+	ErrGone = errors.New("webmention: source is gone")
+)
+
+// userAgent identifies the site's webmention traffic.
+const userAgent = "rednafi.com-webmention (+https://rednafi.com)"
+
+// ParseRequest checks the source and target of an incoming mention as the
+// spec requires: both must be http(s) URLs and must differ. accept reports
+// whether target is a page on this site and returns its canonical URL, which
+// is what the mention is stored under.
+func ParseRequest(source, target string, accept func(*url.URL) (*url.URL, bool)) (src, tgt *url.URL, err error) {
+	src, err = parseHTTP(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("source: %w", err)
+	}
+	tgt, err = parseHTTP(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("target: %w", err)
+	}
+	if sameURL(src) == sameURL(tgt) {
+		return nil, nil, errors.New("source and target are the same")
+	}
+	canonical, ok := accept(tgt)
+	if !ok {
+		return nil, nil, errors.New("target is not a post on this site")
+	}
+	return src, canonical, nil
+}
+
+func parseHTTP(s string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("must be an absolute http(s) URL")
+	}
+	u.Fragment = ""
+	return u, nil
+}
+
+// Verifier fetches source pages and checks that they link to the target.
+type Verifier struct {
+	HTTP *http.Client
+	// MaxBody caps how much of the source page is read. Defaults to 1 MiB.
+	MaxBody int64
+}
+
+// Verify fetches source and returns the mention if it links to target. It
+// returns ErrNoLink if the link is missing and ErrGone if the page was
+// deleted; either way an existing mention should be removed.
+func (v *Verifier) Verify(ctx context.Context, source, target *url.URL) (Mention, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.String(), nil)
+	if err != nil {
+		return Mention{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html, */*;q=0.5")
+	client := v.HTTP
+	if client == nil {
+		client = publicnet.Client(15 * time.Second)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Mention{}, fmt.Errorf("webmention: fetch source: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return Mention{}, ErrGone
+	case resp.StatusCode >= 400:
+		return Mention{}, fmt.Errorf("webmention: fetch source: %s", resp.Status)
+	}
+
+	limit := v.MaxBody
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	page, err := scan(io.LimitReader(resp.Body, limit), resp.Request.URL)
+	if err != nil {
+		return Mention{}, fmt.Errorf("webmention: parse source: %w", err)
+	}
+	if !page.links[sameURL(target)] {
+		return Mention{}, ErrNoLink
+	}
+	now := time.Now().UTC()
+	return Mention{
+		Source:   source.String(),
+		Target:   target.String(),
+		Title:    page.title,
+		Author:   page.author,
+		Received: now,
+		Verified: now,
+	}, nil
+}
+
+// sameURL is the form links are compared in. It ignores the scheme, a www.
+// prefix, the fragment, and the trailing slash Hugo adds to every permalink
+// but people often omit.
+func sameURL(u *url.URL) string {
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	key := host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+type sourcePage struct {
+	title  string
+	author string
+	links  map[string]bool
+}
+
+// scan collects the links, title, and author of an HTML page, resolving
+// relative links against base.
+func scan(r io.Reader, base *url.URL) (*sourcePage, error) {
+	p := &sourcePage{links: map[string]bool{}}
+	z := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return p, nil
+			}
+			return nil, z.Err()
+		case html.TextToken:
+			if inTitle && p.title == "" {
+				p.title = strings.TrimSpace(string(z.Text()))
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if tag == "title" {
+				inTitle = true
+			}
+			attrs := map[string]string{}
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+			var ref string
+			switch tag {
+			case "a", "link":
+				ref = attrs["href"]
+			case "img", "video", "audio", "source":
+				ref = attrs["src"]
+			case "meta":
+				if attrs["name"] == "author" && p.author == "" {
+					p.author = attrs["content"]
+				}
+			}
+			if ref == "" {
+				continue
+			}
+			if u, err := base.Parse(ref); err == nil {
+				p.links[sameURL(u)] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package webmention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// ErrNoEndpoint means the target doesn't advertise a webmention endpoint.
+var ErrNoEndpoint = errors.New("webmention: no endpoint")
+
+// Sender discovers endpoints and delivers mentions.
+type Sender struct {
+	HTTP *http.Client
+}
+
+func (s *Sender) client() *http.Client {
+	if s.HTTP != nil {
+		return s.HTTP
+	}
+	return &http.Client{Timeout: 20 * time.Second}
+}
+
+// linkHeaderRe matches one entry of a Link header, e.g.
+// <https://example.com/wm>; rel="webmention".
+var linkHeaderRe = regexp.MustCompile(`<([^>]*)>\s*((?:;\s*[^;,]+)*)`)
+
+// Discover returns target's webmention endpoint, checking the Link header
+// first and then the first <link> or <a> with rel="webmention", as the spec
+// orders it. It returns ErrNoEndpoint if there is none.
+func (s *Sender) Discover(ctx context.Context, target string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webmention: discover: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return "", fmt.Errorf("webmention: discover: %s", resp.Status)
+	case resp.StatusCode >= 400:
+		// A missing or forbidden page won't grow an endpoint by retrying.
+		return "", fmt.Errorf("%w: %s", ErrNoEndpoint, resp.Status)
+	}
+	base := resp.Request.URL
+
+	for _, h := range resp.Header.Values("Link") {
+		for _, m := range linkHeaderRe.FindAllStringSubmatch(h, -1) {
+			if hasRel(linkParam(m[2], "rel"), "webmention") {
+				return resolve(base, m[1])
+			}
+		}
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.Contains(ct, "html") {
+		return "", ErrNoEndpoint
+	}
+
+	z := html.NewTokenizer(io.LimitReader(resp.Body, 1<<20))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return "", ErrNoEndpoint
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		if tag := string(name); tag != "link" && tag != "a" {
+			continue
+		}
+		var rel, href string
+		hasHref := false
+		for hasAttr {
+			var k, v []byte
+			k, v, hasAttr = z.TagAttr()
+			switch string(k) {
+			case "rel":
+				rel = string(v)
+			case "href":
+				href, hasHref = string(v), true
+			}
+		}
+		// An empty href is valid and means the target itself.
+		if hasHref && hasRel(rel, "webmention") {
+			return resolve(base, href)
+		}
+	}
+}
+
+func linkParam(params, key string) string {
+	for _, p := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(k), key) {
+			return strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return ""
+}
+
+func hasRel(rels, want string) bool {
+	for _, r := range strings.Fields(rels) {
+		if strings.EqualFold(r, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func resolve(base *url.URL, ref string) (string, error) {
+	u, err := base.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("webmention: bad endpoint %q: %w", ref, err)
+	}
+	return u.String(), nil
+}
+
+// Send notifies endpoint that source links to target.
+func (s *Sender) Send(ctx context.Context, endpoint, source, target string) error {
+	form := url.Values{"source": {source}, "target": {target}}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("webmention: send: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webmention: send: %s", resp.Status)
+	}
+	return nil
+}
+
+// DefaultSentLog is where `blogctl webmention send` records what it sent.
+// It's checked in so deploys don't resend mentions.
+const DefaultSentLog = "data/webmentions-sent.json"
+
+// Sent records one delivered (or undeliverable) mention.
+type Sent struct {
+	// Endpoint is empty if the target had none.
+	Endpoint string    `json:"endpoint,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// SentPost is the log entry for one of our posts.
+type SentPost struct {
+	// Updated is the post's lastmod when mentions were last sent. A newer
+	// lastmod resends to every target, as the spec asks for updates.
+	Updated time.Time       `json:"updated"`
+	Targets map[string]Sent `json:"targets"`
+}
+
+// SentLog maps post permalinks to what was sent for them.
+type SentLog map[string]SentPost
+
+// LoadSentLog reads the log at path. A missing file yields an empty log.
+func LoadSentLog(path string) (SentLog, error) {
+	l := SentLog{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, fmt.Errorf("webmention: parse %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Save writes the log to path.
+func (l SentLog) Save(path string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Pending returns the targets source should notify given its current
+// outbound links: everything for a new or updated post, including links it
+// no longer has so their receivers can drop the mention, and only links that
+// weren't tried before otherwise.
+func (l SentLog) Pending(source string, updated time.Time, links []string) []string {
+	prev, ok := l[source]
+	if !ok || updated.After(prev.Updated) {
+		seen := map[string]bool{}
+		var out []string
+		for _, t := range links {
+			if !seen[t] {
+				seen[t] = true
+				out = append(out, t)
+			}
+		}
+		for t := range prev.Targets {
+			if !seen[t] {
+				out = append(out, t)
+			}
+		}
+		return out
+	}
+	var out []string
+	for _, t := range links {
+		if _, done := prev.Targets[t]; !done {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Record notes that source notified target.
+func (l SentLog) Record(source, target string, s Sent) {
+	p := l[source]
+	if p.Targets == nil {
+		p.Targets = map[string]Sent{}
+	}
+	p.Targets[target] = s
+	l[source] = p
+}
+
+// Done marks source as fully sent at updated and forgets the targets it no
+// longer links to, which have now been told. Call it only once every
+// pending target was handled, so an interrupted run picks up the rest.
+func (l SentLog) Done(source string, updated time.Time, links []string) {
+	keep := map[string]bool{}
+	for _, t := range links {
+		keep[t] = true
+	}
+	p := l[source]
+	for t := range p.Targets {
+		if !keep[t] {
+			delete(p.Targets, t)
+		}
+	}
+	if p.Targets == nil {
+		p.Targets = map[string]Sent{}
+	}
+	p.Updated = updated
+	l[source] = p
+}
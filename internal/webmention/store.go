@@ -0,0 +1,248 @@
+// Package webmention receives and sends Webmentions
+// (https://www.w3.org/TR/webmention/).
+//
+// Received mentions are verified against the source page and kept in a
+// SQLite database, pending until `blogctl comments approve` approves them.
+// cmd/webmentiond serves the approved ones as JSON, and `blogctl comments
+// export` snapshots them into data/webmentions/ for the build to render
+// statically. Mentions from a blocked domain are turned away.
+package webmention
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Mention is a verified link from Source to one of the site's posts.
+type Mention struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Title and Author are read from the source page, when it has them.
+	Title    string    `json:"title,omitempty"`
+	Author   string    `json:"author,omitempty"`
+	Received time.Time `json:"received"`
+	Verified time.Time `json:"verified"`
+	// Status is StatusPending until the mention is approved.
+	Status string `json:"status"`
+}
+
+// Moderation statuses.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+)
+
+// ErrBlocked is returned by Put for a source on a blocked domain.
+var ErrBlocked = errors.New("webmention: the source's domain is blocked")
+
+// DefaultDB is the SQLite database cmd/webmentiond keeps mentions in.
+const DefaultDB = "webmentions.db"
+
+// Store persists mentions in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS mentions (
+	source   TEXT NOT NULL,
+	target   TEXT NOT NULL,
+	title    TEXT NOT NULL DEFAULT '',
+	author   TEXT NOT NULL DEFAULT '',
+	received INTEGER NOT NULL,
+	verified INTEGER NOT NULL,
+	status   TEXT NOT NULL DEFAULT 'pending',
+	PRIMARY KEY (source, target)
+);
+CREATE INDEX IF NOT EXISTS mentions_target ON mentions (target);
+CREATE TABLE IF NOT EXISTS blocked (
+	domain  TEXT PRIMARY KEY,
+	blocked INTEGER NOT NULL
+);
+`
+
+// addStatus brings a database from before moderation up to date. The
+// mentions it already had were public, so they start out approved.
+const addStatus = `ALTER TABLE mentions ADD COLUMN status TEXT NOT NULL DEFAULT 'approved'`
+
+// OpenStore opens (or creates) the database at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("webmention: init %s: %w", path, err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM pragma_table_info('mentions') WHERE name = 'status'`).Scan(&n); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("webmention: init %s: %w", path, err)
+	}
+	if n == 0 {
+		if _, err := db.Exec(addStatus); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("webmention: migrate %s: %w", path, err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error { return s.db.Close() }
+
+// Put inserts m as pending, or refreshes it if the source already
+// mentioned the target. The original received time and the status are
+// kept. A source on a blocked domain is ErrBlocked.
+func (s *Store) Put(ctx context.Context, m Mention) error {
+	blocked, err := s.Blocked(ctx)
+	if err != nil {
+		return err
+	}
+	if u, err := url.Parse(m.Source); err == nil && OnDomain(u.Hostname(), blocked) {
+		return ErrBlocked
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO mentions (source, target, title, author, received, verified, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (source, target) DO UPDATE SET
+			title = excluded.title,
+			author = excluded.author,
+			verified = excluded.verified`,
+		m.Source, m.Target, m.Title, m.Author, m.Received.Unix(), m.Verified.Unix(), StatusPending,
+	)
+	return err
+}
+
+// Approve approves the mentions by source, of target alone unless target
+// is "". It returns how many it approved.
+func (s *Store) Approve(ctx context.Context, source, target string) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE mentions SET status = ?
+		WHERE source = ? AND (? = '' OR target = ?) AND status != ?`,
+		StatusApproved, source, target, target, StatusApproved)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Block turns away domain and its subdomains from now on, and deletes the
+// mentions they already sent. It returns how many it deleted.
+func (s *Store) Block(ctx context.Context, domain string, now time.Time) (int, error) {
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return 0, errors.New("webmention: no domain to block")
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO blocked (domain, blocked) VALUES (?, ?) ON CONFLICT (domain) DO NOTHING`,
+		domain, now.Unix()); err != nil {
+		return 0, err
+	}
+	ms, err := s.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, m := range ms {
+		if u, err := url.Parse(m.Source); err == nil && OnDomain(u.Hostname(), []string{domain}) {
+			if err := s.Delete(ctx, m.Source, m.Target); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Blocked returns the blocked domains, sorted.
+func (s *Store) Blocked(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT domain FROM blocked ORDER BY domain`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// OnDomain reports whether host is one of domains or a subdomain of one.
+func OnDomain(host string, domains []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes the mention of target by source, if there is one.
+func (s *Store) Delete(ctx context.Context, source, target string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM mentions WHERE source = ? AND target = ?`, source, target)
+	return err
+}
+
+// ForTarget returns the approved mentions of target, oldest first.
+func (s *Store) ForTarget(ctx context.Context, target string) ([]Mention, error) {
+	return s.query(ctx, `WHERE target = ? AND status = ? ORDER BY received, source`, target, StatusApproved)
+}
+
+// List returns the mentions with status, or every one if status is "",
+// oldest first.
+func (s *Store) List(ctx context.Context, status string) ([]Mention, error) {
+	return s.query(ctx, `WHERE ? = '' OR status = ? ORDER BY received, source, target`, status, status)
+}
+
+// All returns every approved mention grouped by target.
+func (s *Store) All(ctx context.Context) (map[string][]Mention, error) {
+	ms, err := s.query(ctx, `WHERE status = ? ORDER BY target, received, source`, StatusApproved)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][]Mention{}
+	for _, m := range ms {
+		out[m.Target] = append(out[m.Target], m)
+	}
+	return out, nil
+}
+
+func (s *Store) query(ctx context.Context, where string, args ...any) ([]Mention, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT source, target, title, author, received, verified, status FROM mentions `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ms := []Mention{}
+	for rows.Next() {
+		var (
+			m                  Mention
+			received, verified int64
+		)
+		if err := rows.Scan(&m.Source, &m.Target, &m.Title, &m.Author, &received, &verified, &m.Status); err != nil {
+			return nil, err
+		}
+		m.Received = time.Unix(received, 0).UTC()
+		m.Verified = time.Unix(verified, 0).UTC()
+		ms = append(ms, m)
+	}
+	return ms, rows.Err()
+}
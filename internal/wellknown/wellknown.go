@@ -0,0 +1,224 @@
+// Package wellknown generates the small files at fixed paths that people
+// and services look for on a site: /.well-known/security.txt (RFC 9116),
+// whose expiry is moved forward on every build so it never lapses,
+// /humans.txt, and the verification files that services like Keybase ask
+// a site to serve. They're all configured under params.wellknown in
+// config.yml and written into static/.
+package wellknown
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/fsutil"
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+// SecurityPath and HumansPath are where the files are served.
+const (
+	SecurityPath = "/.well-known/security.txt"
+	HumansPath   = "/humans.txt"
+)
+
+// DefaultExpiryDays is used when params.wellknown.security.expiryDays
+// isn't set. RFC 9116 advises less than a year, so that stale contacts
+// age out.
+const DefaultExpiryDays = 180
+
+// SecurityTxt renders security.txt as of now. Expires is ExpiryDays past
+// the start of now's day, in UTC, so builds on the same day agree.
+func SecurityTxt(cfg *site.Config, now time.Time) []byte {
+	sec := cfg.Params.WellKnown.Security
+	days := sec.ExpiryDays
+	if days <= 0 {
+		days = DefaultExpiryDays
+	}
+	expires := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, days)
+
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	b.WriteString("# Generated by `blogctl wellknown` from params.wellknown in config.yml.\n")
+	for _, c := range sec.Contact {
+		field("Contact", c)
+	}
+	field("Expires", expires.Format(time.RFC3339))
+	field("Encryption", sec.Encryption)
+	field("Acknowledgments", sec.Acknowledgments)
+	field("Policy", sec.Policy)
+	field("Hiring", sec.Hiring)
+	field("Preferred-Languages", strings.Join(sec.PreferredLanguages, ", "))
+	field("Canonical", cfg.Permalink(SecurityPath))
+	return b.Bytes()
+}
+
+// fieldRe matches a field line: a name of token characters, a colon, and
+// the value.
+var fieldRe = regexp.MustCompile(`^([!#$%&'*+.^_` + "`" + `|~0-9A-Za-z-]+):[ \t]*(.*?)[ \t]*$`)
+
+// uriFields are the fields whose values are URIs; of those, web URIs
+// must use https.
+var uriFields = map[string]bool{
+	"contact": true, "encryption": true, "acknowledgments": true,
+	"policy": true, "hiring": true, "canonical": true,
+}
+
+// CheckSecurityTxt returns where b falls short of RFC 9116 as of now:
+// lines that aren't fields or comments, a missing Contact, an Expires
+// that's missing, repeated, not an RFC 3339 date, past, or more than a
+// year away, a repeated Preferred-Languages, and URIs that aren't
+// absolute or that are web URIs without https.
+func CheckSecurityTxt(b []byte, now time.Time) []error {
+	var errs []error
+	bad := func(line int, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%d: %s", line, fmt.Sprintf(format, args...)))
+	}
+	count := map[string]int{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	n := 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := fieldRe.FindStringSubmatch(line)
+		if m == nil {
+			bad(n, "%q isn't a field or a comment", line)
+			continue
+		}
+		name, value := strings.ToLower(m[1]), m[2]
+		count[name]++
+		switch {
+		case name == "expires":
+			t, err := time.Parse(time.RFC3339, value)
+			switch {
+			case err != nil:
+				bad(n, "Expires %q isn't an RFC 3339 date", value)
+			case !t.After(now):
+				bad(n, "Expires %s has passed", value)
+			case t.After(now.AddDate(1, 0, 0)):
+				bad(n, "Expires %s is more than a year away", value)
+			}
+		case uriFields[name]:
+			u, err := url.Parse(value)
+			switch {
+			case err != nil || u.Scheme == "":
+				bad(n, "%s %q isn't an absolute URI", m[1], value)
+			case u.Scheme == "http":
+				bad(n, "%s %q must use https", m[1], value)
+			}
+		}
+		switch name {
+		case "expires", "preferred-languages":
+			if count[name] == 2 {
+				bad(n, "%s appears more than once", m[1])
+			}
+		}
+	}
+	if count["contact"] == 0 {
+		bad(1, "no Contact")
+	}
+	if count["expires"] == 0 {
+		bad(1, "no Expires")
+	}
+	return errs
+}
+
+// HumansTxt renders humans.txt, with the site last updated at updated.
+func HumansTxt(cfg *site.Config, updated time.Time) []byte {
+	h := cfg.Params.WellKnown.Humans
+	var b bytes.Buffer
+	b.WriteString("/* TEAM */\n")
+	for _, m := range h.Team {
+		fmt.Fprintf(&b, "\t%s: %s\n", m.Role, m.Name)
+		if m.Site != "" {
+			fmt.Fprintf(&b, "\tSite: %s\n", m.Site)
+		}
+		if m.Contact != "" {
+			fmt.Fprintf(&b, "\tContact: %s\n", m.Contact)
+		}
+		b.WriteString("\n")
+	}
+	if len(h.Thanks) > 0 {
+		b.WriteString("/* THANKS */\n")
+		for _, t := range h.Thanks {
+			fmt.Fprintf(&b, "\t%s\n", t)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("/* SITE */\n")
+	if !updated.IsZero() {
+		fmt.Fprintf(&b, "\tLast update: %s\n", updated.UTC().Format("2006/01/02"))
+	}
+	fmt.Fprintf(&b, "\tLanguage: %s\n", cfg.LanguageCode)
+	if len(h.Software) > 0 {
+		fmt.Fprintf(&b, "\tSoftware: %s\n", strings.Join(h.Software, ", "))
+	}
+	return b.Bytes()
+}
+
+// Files returns every file, keyed by site path: security.txt when it has
+// a contact, humans.txt when it has a team, and the verification files.
+// now dates security.txt's expiry and updated humans.txt's last update.
+func Files(cfg *site.Config, now, updated time.Time) (map[string][]byte, error) {
+	wk := cfg.Params.WellKnown
+	files := map[string][]byte{}
+	if len(wk.Security.Contact) > 0 {
+		b := SecurityTxt(cfg, now)
+		if errs := CheckSecurityTxt(b, now); len(errs) > 0 {
+			return nil, fmt.Errorf("wellknown: security.txt: %w", errors.Join(errs...))
+		}
+		files[SecurityPath] = b
+	}
+	if len(wk.Humans.Team) > 0 {
+		files[HumansPath] = HumansTxt(cfg, updated)
+	}
+	for p, body := range wk.Files {
+		switch {
+		case !strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") || path.Clean(p) != p:
+			return nil, fmt.Errorf("wellknown: files: %q must be a clean path to a file", p)
+		case files[p] != nil:
+			return nil, fmt.Errorf("wellknown: files: %s is generated", p)
+		}
+		if !strings.HasSuffix(body, "\n") {
+			body += "\n"
+		}
+		files[p] = []byte(body)
+	}
+	return files, nil
+}
+
+// Write saves files under dir, skipping the unchanged ones, and returns
+// the paths it wrote.
+func Write(dir string, files map[string][]byte) ([]string, error) {
+	names := make([]string, 0, len(files))
+	for p := range files {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	var written []string
+	for _, p := range names {
+		dst := filepath.Join(dir, filepath.FromSlash(p))
+		wrote, err := fsutil.WriteIfChanged(dst, files[p])
+		if err != nil {
+			return written, err
+		}
+		if wrote {
+			written = append(written, dst)
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,151 @@
+package wellknown
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rednafi/rednafi.com/internal/site"
+)
+
+var now = time.Date(2026, 10, 14, 15, 4, 5, 0, time.UTC)
+
+// securityConfig fills in every field security.txt has a line for.
+func securityConfig() *site.Config {
+	cfg := &site.Config{BaseURL: "https://blog.example.net"}
+	sec := &cfg.Params.WellKnown.Security
+	sec.Contact = []string{"mailto:security@blog.example.net", "https://blog.example.net/contact/"}
+	sec.Policy = "https://blog.example.net/security/"
+	sec.PreferredLanguages = []string{"en", "bn"}
+	return cfg
+}
+
+// fields returns the names and values of b's field lines, in order.
+func fields(b []byte) [][2]string {
+	var out [][2]string
+	for line := range strings.SplitSeq(string(b), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, _ := strings.Cut(line, ": ")
+		out = append(out, [2]string{name, value})
+	}
+	return out
+}
+
+func TestSecurityTxtIsValid(t *testing.T) {
+	b := SecurityTxt(securityConfig(), now)
+	if errs := CheckSecurityTxt(b, now); len(errs) > 0 {
+		t.Fatalf("CheckSecurityTxt: %v\n%s", errs, b)
+	}
+
+	var contacts []string
+	var expires string
+	for _, f := range fields(b) {
+		switch f[0] {
+		case "Contact":
+			contacts = append(contacts, f[1])
+		case "Expires":
+			if expires != "" {
+				t.Errorf("Expires appears twice")
+			}
+			expires = f[1]
+		}
+	}
+	if want := securityConfig().Params.WellKnown.Security.Contact; strings.Join(contacts, " ") != strings.Join(want, " ") {
+		t.Errorf("Contact = %q, want %q, best first", contacts, want)
+	}
+	got, err := time.Parse(time.RFC3339, expires)
+	if err != nil {
+		t.Fatalf("Expires %q: %v", expires, err)
+	}
+	if want := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC).AddDate(0, 0, DefaultExpiryDays); !got.Equal(want) {
+		t.Errorf("Expires = %s, want %s", got, want)
+	}
+	if !got.After(now) || got.After(now.AddDate(1, 0, 0)) {
+		t.Errorf("Expires %s isn't in the coming year", got)
+	}
+}
+
+func TestSecurityTxtStableWithinDay(t *testing.T) {
+	cfg := securityConfig()
+	a := SecurityTxt(cfg, time.Date(2026, 10, 14, 0, 0, 1, 0, time.UTC))
+	b := SecurityTxt(cfg, time.Date(2026, 10, 14, 23, 59, 59, 0, time.UTC))
+	if !bytes.Equal(a, b) {
+		t.Errorf("builds on the same day differ:\n%s\n%s", a, b)
+	}
+}
+
+func TestSecurityTxtLayout(t *testing.T) {
+	b := SecurityTxt(securityConfig(), now)
+	if !bytes.HasSuffix(b, []byte("\n")) {
+		t.Error("doesn't end with a newline")
+	}
+	if bytes.Contains(b, []byte("\r")) {
+		t.Error("mixes CR into its LF line endings")
+	}
+	var order []string
+	for _, f := range fields(b) {
+		if len(order) == 0 || order[len(order)-1] != f[0] {
+			order = append(order, f[0])
+		}
+	}
+	want := []string{"Contact", "Expires", "Policy", "Preferred-Languages", "Canonical"}
+	if strings.Join(order, " ") != strings.Join(want, " ") {
+		t.Errorf("fields are in the order %q, want %q", order, want)
+	}
+	if f := fields(b); f[len(f)-1][1] != "https://blog.example.net"+SecurityPath {
+		t.Errorf("Canonical = %q, want the file's own URL", f[len(f)-1][1])
+	}
+
+	// RFC 9116 allows either line ending.
+	crlf := bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+	if errs := CheckSecurityTxt(crlf, now); len(errs) > 0 {
+		t.Errorf("CheckSecurityTxt with CRLF line endings: %v", errs)
+	}
+}
+
+func TestCheckSecurityTxt(t *testing.T) {
+	const expires = "Expires: 2027-01-01T00:00:00Z\n"
+	tests := []struct {
+		name, file string
+		want       string // in the one error reported; "" for none
+	}{
+		{"valid", "Contact: mailto:a@example.com\n" + expires, ""},
+		{"comments and blanks", "# hi\n\nContact: mailto:a@example.com\n" + expires, ""},
+		{"no contact", expires, "no Contact"},
+		{"no expires", "Contact: mailto:a@example.com\n", "no Expires"},
+		{"expired", "Contact: mailto:a@example.com\nExpires: 2026-01-01T00:00:00Z\n", "has passed"},
+		{"too far", "Contact: mailto:a@example.com\nExpires: 2028-01-01T00:00:00Z\n", "more than a year"},
+		{"not RFC 3339", "Contact: mailto:a@example.com\nExpires: January 1, 2027\n", "isn't an RFC 3339 date"},
+		{"twice", "Contact: mailto:a@example.com\n" + expires + expires, "more than once"},
+		{"http", "Contact: http://example.com/\n" + expires, "must use https"},
+		{"relative", "Contact: /contact/\n" + expires, "isn't an absolute URI"},
+		{"not a field", "Contact: mailto:a@example.com\n" + expires + "just text\n", "isn't a field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := CheckSecurityTxt([]byte(tt.file), now)
+			switch {
+			case tt.want == "" && len(errs) > 0:
+				t.Errorf("got %v, want no errors", errs)
+			case tt.want != "" && (len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.want)):
+				t.Errorf("got %v, want one error about %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilesWithoutContact(t *testing.T) {
+	cfg := securityConfig()
+	cfg.Params.WellKnown.Security.Contact = nil
+	files, err := Files(cfg, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files[SecurityPath]; ok {
+		t.Error("wrote security.txt without a contact")
+	}
+}